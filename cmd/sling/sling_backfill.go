@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/slingdata-io/sling-cli/core/sling"
+	"github.com/spf13/cast"
+)
+
+// processBackfill plans the chunked backfill of the replication streams,
+// and runs the chunks (with checkpointing) unless only planning
+func processBackfill(c *g.CliSC) (ok bool, err error) {
+	ok = true
+
+	cfgPath := cast.ToString(c.Vals["replication"])
+	if cfgPath == "" {
+		return false, nil // show help
+	}
+
+	if cast.ToBool(c.Vals["debug"]) {
+		os.Setenv("DEBUG", "LOW")
+		env.InitLogger()
+	}
+
+	overrides := sling.OverrideArgs(os.Args[1:])
+	replication, err := sling.LoadReplicationConfigFromFile(cfgPath, overrides...)
+	if err != nil {
+		return ok, g.Error(err, "could not load replication: %s", cfgPath)
+	}
+
+	opts := sling.BackfillOptions{
+		Streams:     lo.Compact(strings.Split(cast.ToString(c.Vals["streams"]), ",")),
+		Range:       cast.ToString(c.Vals["range"]),
+		ChunkSize:   cast.ToString(c.Vals["chunk"]),
+		Concurrency: cast.ToInt(c.Vals["concurrency"]),
+	}
+
+	plan, err := replication.PlanBackfill(opts)
+	if err != nil {
+		return ok, g.Error(err, "could not plan backfill")
+	}
+
+	if exportPath := cast.ToString(c.Vals["export"]); exportPath != "" {
+		if err = plan.WriteFile(exportPath); err != nil {
+			return ok, err
+		}
+		g.Info("wrote backfill plan to %s", exportPath)
+	}
+
+	if cast.ToBool(c.Vals["plan"]) {
+		printBackfillPlan(plan)
+		return ok, nil
+	} else if len(plan.Chunks) == 0 {
+		g.Warn("no chunks to backfill")
+		return ok, nil
+	}
+
+	g.Info("Sling Backfill [%d chunks, concurrency %d] | %s -> %s", len(plan.Chunks), plan.Concurrency, plan.Source, plan.Target)
+	if plan.Completed > 0 {
+		g.Info("resuming, %d chunks completed previously", plan.Completed)
+	}
+
+	err = replication.RunBackfill(ctx.Ctx, plan)
+	printBackfillPlan(plan)
+	if err != nil {
+		return ok, g.Error(err, "%d of %d chunks pending", plan.Pending(), len(plan.Chunks))
+	}
+	return ok, nil
+}
+
+func printBackfillPlan(plan *sling.BackfillPlan) {
+	if os.Getenv("SLING_OUTPUT") == "json" {
+		fmt.Println(g.Marshal(plan))
+		return
+	}
+
+	fields := []string{"Stream", "Chunk", "Range", "Object", "Status"}
+	rows := [][]any{}
+	details := []string{}
+	for _, chunk := range plan.Chunks {
+		rows = append(rows, []any{
+			chunk.Stream,
+			chunk.Name,
+			chunk.Range,
+			chunk.Object,
+			lo.Ternary(chunk.Status == "", "pending", chunk.Status),
+		})
+		if chunk.Error != "" {
+			details = append(details, g.F("%s: %s", chunk.Name, chunk.Error))
+		}
+	}
+
+	fmt.Println(g.PrettyTable(fields, rows))
+	if plan.Completed > 0 {
+		fmt.Println(g.F("%d chunks completed previously (skipped)", plan.Completed))
+	}
+	for _, detail := range details {
+		fmt.Println(detail)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/integrii/flaggy"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/slingdata-io/sling-cli/core/sling"
+	"github.com/spf13/cast"
+)
+
+// processCleanup removes the orphaned temp tables and staging files of a connection
+func processCleanup(c *g.CliSC) (ok bool, err error) {
+	ok = true
+
+	if cast.ToBool(c.Vals["debug"]) {
+		os.Setenv("DEBUG", "LOW")
+		env.InitLogger()
+	}
+
+	opts := sling.CleanupOptions{
+		Conn:      cast.ToString(c.Vals["conn"]),
+		OlderThan: 24 * time.Hour,
+		DryRun:    cast.ToBool(c.Vals["dry-run"]),
+	}
+	if opts.Conn == "" {
+		flaggy.ShowHelp("")
+		return ok, nil
+	}
+	if val := cast.ToString(c.Vals["older-than"]); val != "" {
+		hours, err := cast.ToIntE(val)
+		if err != nil || hours < 0 {
+			return ok, g.Error("invalid --older-than value: %s (expected a number of hours)", val)
+		}
+		opts.OlderThan = time.Duration(hours) * time.Hour
+	}
+
+	result, err := sling.CleanupTempObjects(opts)
+	if err != nil {
+		return ok, g.Error(err, "could not clean up %s", opts.Conn)
+	}
+
+	verb := "removed"
+	if opts.DryRun {
+		verb = "would remove"
+	}
+	for _, table := range result.Tables {
+		g.Info("%s temp table %s", verb, table)
+	}
+	for _, file := range result.Files {
+		g.Info("%s staging file %s", verb, file)
+	}
+	if len(result.Tables)+len(result.Files) == 0 {
+		g.Info("no orphaned temp objects older than %s in %s", opts.OlderThan, opts.Conn)
+	}
+
+	return ok, nil
+}
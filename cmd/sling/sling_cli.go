@@ -119,7 +119,13 @@ var cliRunFlags = []g.Flag{
 		Name:        "streams",
 		ShortName:   "",
 		Type:        "string",
-		Description: "Only run specific streams from a replication. (comma separated)",
+		Description: "Only run specific streams from a replication (comma separated): names, globs, `tag:<tag>` or `group:<group>`.",
+	},
+	{
+		Name:        "group",
+		ShortName:   "",
+		Type:        "string",
+		Description: "Only run the streams of a group from a replication (comma separated). Same as `--streams group:<name>`.",
 	},
 	{
 		Name:        "stdout",
@@ -133,6 +139,12 @@ var cliRunFlags = []g.Flag{
 		Type:        "string",
 		Description: "in-line environment variable object/map to pass in (JSON or YAML).",
 	},
+	{
+		Name:        "set",
+		ShortName:   "",
+		Type:        "slice",
+		Description: "Override a config value, e.g. `--set streams.users.mode=full-refresh --set defaults.target_options.batch_size=50000`.\n                       Keys with dots can be quoted (`streams.\"public.users\".mode=...`). Values are parsed as YAML. Can be repeated.",
+	},
 	{
 		Name:        "mode",
 		ShortName:   "m",
@@ -169,6 +181,78 @@ var cliRunFlags = []g.Flag{
 		Type:        "string",
 		Description: "The update key to use for incremental.\n",
 	},
+	{
+		Name:        "confirm-keys",
+		ShortName:   "",
+		Type:        "bool",
+		Description: "Confirm the keys discovered from the source metadata before adopting them (see source option `key_discovery`).",
+	},
+	{
+		Name:        "run-id",
+		ShortName:   "",
+		Type:        "string",
+		Description: "The run id to use for the execution (same as env var SLING_RUN_ID). Default is generated with `run-id-format`.",
+	},
+	{
+		Name:        "run-id-format",
+		ShortName:   "",
+		Type:        "string",
+		Description: "The format used to generate run ids: ksuid, ulid, uuid or a template such as `{YYYY}{MM}{DD}_{ulid}` (same as env var SLING_RUN_ID_FORMAT).\n                       Stream run ids use SLING_STREAM_RUN_ID_FORMAT if set (e.g. `{run_id}.{stream_table}`).",
+	},
+	{
+		Name:        "reset-ledger",
+		ShortName:   "",
+		Type:        "bool",
+		Description: "Reset the processed-file ledger of the selected streams before running (see source option `on_seen`).",
+	},
+	{
+		Name:        "preflight",
+		ShortName:   "",
+		Type:        "bool",
+		Description: "Validate all streams before moving any data: connectivity, source read access, CREATE/INSERT on the target schemas and write access to target folders / staging buckets.",
+	},
+	{
+		Name:        "dry-run",
+		ShortName:   "",
+		Type:        "bool",
+		Description: "Show the work of each stream without writing anything: the incremental range, the source rows (counted or estimated), the files to read and the DDL/DML to run on the target.",
+	},
+	{
+		Name:        "preview-sql",
+		ShortName:   "",
+		Type:        "bool",
+		Description: "Print the SQL statements each stream would execute (source query, temp table DDL, pre/post-sql, insert/merge), with the placeholders resolved, without running them.",
+	},
+	{
+		Name:        "manifest",
+		ShortName:   "",
+		Type:        "string",
+		Description: "Write a JSON manifest of the run (streams, objects, column mappings, row counts, watermarks, durations) to a file path, or post it to an http(s) url. Also with SLING_MANIFEST.",
+	},
+	{
+		Name:        "report",
+		ShortName:   "",
+		Type:        "string",
+		Description: "Write a summary report of the run (status, rows, duration & throughput per stream, warnings, config changes since last run) to a file path or object store url. HTML if the extension is .html, otherwise Markdown. Also with SLING_REPORT.",
+	},
+	{
+		Name:        "deadline",
+		ShortName:   "",
+		Type:        "string",
+		Description: "Wall clock deadline of the run, after which the running streams are canceled: a timestamp, a time of day (e.g. 06:00) or a duration (e.g. 2h). Also with SLING_DEADLINE.",
+	},
+	{
+		Name:        "tui",
+		ShortName:   "",
+		Type:        "bool",
+		Description: "Show a live table of the replication streams instead of the log (interactive terminals).",
+	},
+	{
+		Name:        "watch",
+		ShortName:   "",
+		Type:        "bool",
+		Description: "Keep running and load new files as they arrive (file sources, incremental mode). Poll interval is set with env var SLING_WATCH_INTERVAL (default 30s).",
+	},
 	{
 		Name:        "debug",
 		ShortName:   "d",
@@ -191,6 +275,429 @@ var cliRun = &g.CliSC{
 	ExecProcess:           processRun,
 }
 
+var cliScheduler = &g.CliSC{
+	Name:                  "scheduler",
+	Description:           "Run replications according to their `schedule` (long-running)",
+	AdditionalHelpPrepend: "\nSee more details at https://docs.slingdata.io/sling-cli/",
+	Flags: []g.Flag{
+		{
+			Name:        "replication",
+			ShortName:   "r",
+			Type:        "string",
+			Description: "The replication config file(s) to schedule, comma separated (JSON or YAML).",
+		},
+		{
+			Name:        "overlap",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The policy when a run is due while the previous one is running: skip (default), queue or allow.",
+		},
+		{
+			Name:        "status",
+			ShortName:   "",
+			Type:        "bool",
+			Description: "Print the status of the running scheduler.",
+		},
+		{
+			Name:        "debug",
+			ShortName:   "d",
+			Type:        "bool",
+			Description: "Set logging level to DEBUG.",
+		},
+	},
+	ExecProcess: processScheduler,
+}
+
+var cliPeek = &g.CliSC{
+	Name:        "peek",
+	Description: "Show sample rows and the inferred schema of a stream (table, query or file), without a target",
+	PosFlags: []g.Flag{
+		{
+			Name:        "conn",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The connection name.",
+		},
+		{
+			Name:        "stream",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The table (schema.table), SQL query or file path / url.",
+		},
+	},
+	Flags: []g.Flag{
+		{
+			Name:        "limit",
+			ShortName:   "l",
+			Type:        "string",
+			Description: "The number of rows to show (default 100).",
+		},
+		{
+			Name:        "format",
+			ShortName:   "f",
+			Type:        "string",
+			Description: "The output format: table (default), json or csv.",
+		},
+		{
+			Name:        "debug",
+			ShortName:   "d",
+			Type:        "bool",
+			Description: "Set logging level to DEBUG.",
+		},
+	},
+	ExecProcess: processPeek,
+}
+
+var cliDiff = &g.CliSC{
+	Name:                  "diff",
+	Description:           "Compare source streams with their target objects (row counts, columns, checksums), reporting drift",
+	AdditionalHelpPrepend: "\nSee more details at https://docs.slingdata.io/sling-cli/",
+	Flags: []g.Flag{
+		{
+			Name:        "replication",
+			ShortName:   "r",
+			Type:        "string",
+			Description: "The replication config file to compare the streams of (JSON or YAML).",
+		},
+		{
+			Name:        "streams",
+			ShortName:   "",
+			Type:        "string",
+			Description: "Only compare the specified streams, comma separated (with --replication).",
+		},
+		{
+			Name:        "src-conn",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The source database connection (name or URL).",
+		},
+		{
+			Name:        "src-stream",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The source table (schema.table) or SQL query.",
+		},
+		{
+			Name:        "tgt-conn",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The target database connection (name or URL).",
+		},
+		{
+			Name:        "tgt-object",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The target table (schema.table).",
+		},
+		{
+			Name:        "where",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The filter applied to both the source and the target.",
+		},
+		{
+			Name:        "checksum",
+			ShortName:   "",
+			Type:        "bool",
+			Description: "Compare the checksum of each column.",
+		},
+		{
+			Name:        "key",
+			ShortName:   "",
+			Type:        "string",
+			Description: "Compare the rows by hash, matched by the key column(s), comma separated.",
+		},
+		{
+			Name:        "sample",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The number of source rows to compare by key (defaults to all). Uses the primary key if --key is not specified.",
+		},
+		{
+			Name:        "debug",
+			ShortName:   "d",
+			Type:        "bool",
+			Description: "Set logging level to DEBUG.",
+		},
+	},
+	ExecProcess: processDiff,
+}
+
+var cliBackfill = &g.CliSC{
+	Name:                  "backfill",
+	Description:           "Backfill replication streams in chunks of their update key, resuming from the completed chunks",
+	AdditionalHelpPrepend: "\nSee more details at https://docs.slingdata.io/sling-cli/",
+	Flags: []g.Flag{
+		{
+			Name:        "replication",
+			ShortName:   "r",
+			Type:        "string",
+			Description: "The replication config file of the streams (JSON or YAML).",
+		},
+		{
+			Name:        "streams",
+			ShortName:   "",
+			Type:        "string",
+			Description: "Only backfill the specified streams (names or wildcards), comma separated. All streams if not specified.",
+		},
+		{
+			Name:        "range",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The range of the update key to backfill, as start:end (e.g. 2019-01-01:2024-01-01). The whole table if not specified.",
+		},
+		{
+			Name:        "chunk",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The size of the chunks, such as 1mon, 7d or 1d for dates, or 100000 for integers. Uses the stream `chunk_size` if not specified.",
+		},
+		{
+			Name:        "concurrency",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The number of chunks running in parallel (defaults to 1).",
+		},
+		{
+			Name:        "plan",
+			ShortName:   "",
+			Type:        "bool",
+			Description: "Only print the plan of the chunks to run, without running them.",
+		},
+		{
+			Name:        "export",
+			ShortName:   "",
+			Type:        "string",
+			Description: "Export the plan of the chunks to a file (JSON or YAML, by extension).",
+		},
+		{
+			Name:        "set",
+			ShortName:   "",
+			Type:        "slice",
+			Description: "Override a config value, e.g. `--set streams.users.update_key=created_at`. Can be repeated.",
+		},
+		{
+			Name:        "debug",
+			ShortName:   "d",
+			Type:        "bool",
+			Description: "Set logging level to DEBUG.",
+		},
+	},
+	ExecProcess: processBackfill,
+}
+
+var cliValidate = &g.CliSC{
+	Name:        "validate",
+	Description: "Validate replication config files against the config spec (without connecting)",
+	PosFlags: []g.Flag{
+		{
+			Name:        "files...",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The replication config file(s) to validate (JSON or YAML).",
+		},
+	},
+	Flags: []g.Flag{
+		{
+			Name:        "schema",
+			ShortName:   "",
+			Type:        "bool",
+			Description: "Print the JSON Schema of the replication config (for editor autocompletion).",
+		},
+	},
+	ExecProcess: processValidate,
+}
+
+var cliGenerate = &g.CliSC{
+	Name:                  "generate",
+	Singular:              "config",
+	Description:           "Generate config files from the discovery of connections",
+	AdditionalHelpPrepend: "\nSee more details at https://docs.slingdata.io/sling-cli/",
+	SubComs: []*g.CliSC{
+		{
+			Name:        "replication",
+			Description: "write a ready-to-edit replication YAML with the streams (and primary keys) discovered in the source",
+			Flags: []g.Flag{
+				{
+					Name:        "src-conn",
+					ShortName:   "",
+					Type:        "string",
+					Description: "The source database / storage connection (name, conn string or URL).",
+				},
+				{
+					Name:        "tgt-conn",
+					ShortName:   "",
+					Type:        "string",
+					Description: "The target database connection (name, conn string or URL).",
+				},
+				{
+					Name:        "pattern",
+					ShortName:   "p",
+					Type:        "string",
+					Description: "filter streams by glob pattern (e.g. schema.prefix_*, dir/*.csv, dir/**/*.json)",
+				},
+				{
+					Name:        "recursive",
+					ShortName:   "",
+					Type:        "bool",
+					Description: "List all files recursively.",
+				},
+				{
+					Name:        "mode",
+					ShortName:   "m",
+					Type:        "string",
+					Description: "The default load mode (default full-refresh).",
+				},
+				{
+					Name:        "output",
+					ShortName:   "o",
+					Type:        "string",
+					Description: "The file path to write the replication to (default stdout).",
+				},
+				{
+					Name:        "debug",
+					ShortName:   "d",
+					Type:        "bool",
+					Description: "Set logging level to DEBUG.",
+				},
+			},
+		},
+	},
+	ExecProcess: processGenerate,
+}
+
+var cliCleanup = &g.CliSC{
+	Name:                  "cleanup",
+	Description:           "Remove orphaned temp tables and staging files of a connection (e.g. left by killed runs)",
+	AdditionalHelpPrepend: "\nSee more details at https://docs.slingdata.io/sling-cli/",
+	Flags: []g.Flag{
+		{
+			Name:        "conn",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The database or storage connection to clean up (name).",
+		},
+		{
+			Name:        "older-than",
+			ShortName:   "",
+			Type:        "string",
+			Description: "Only remove the objects older than the number of hours (default 24).",
+		},
+		{
+			Name:        "dry-run",
+			ShortName:   "",
+			Type:        "bool",
+			Description: "List the objects to remove, without removing them.",
+		},
+		{
+			Name:        "debug",
+			ShortName:   "d",
+			Type:        "bool",
+			Description: "Set logging level to DEBUG.",
+		},
+	},
+	ExecProcess: processCleanup,
+}
+
+var cliPlugins = &g.CliSC{
+	Name:                  "plugins",
+	Singular:              "connector plugin",
+	Description:           "Manage the community connector plugins",
+	AdditionalHelpPrepend: "\nSee more details at https://docs.slingdata.io/sling-cli/",
+	SubComs: []*g.CliSC{
+		{
+			Name:        "install",
+			Description: "install a plugin executable (local path or https URL) in the plugins folder",
+			PosFlags: []g.Flag{
+				{
+					Name:        "source",
+					ShortName:   "",
+					Type:        "string",
+					Description: "The local path or https URL of the plugin executable",
+				},
+			},
+			Flags: []g.Flag{
+				{
+					Name:        "name",
+					ShortName:   "",
+					Type:        "string",
+					Description: "The name of the plugin. Defaults to the name of the file (sling-plugin-<name>).",
+				},
+				{
+					Name:        "sha256",
+					ShortName:   "",
+					Type:        "string",
+					Description: "The SHA-256 checksum of the plugin executable, verified before installing (required for URLs).",
+				},
+			},
+		},
+		{
+			Name:        "list",
+			Description: "list the installed plugins",
+		},
+		{
+			Name:        "remove",
+			Description: "remove an installed plugin",
+			PosFlags: []g.Flag{
+				{
+					Name:        "name",
+					ShortName:   "",
+					Type:        "string",
+					Description: "The name of the plugin to remove",
+				},
+			},
+		},
+	},
+	ExecProcess: processPlugins,
+}
+
+var cliHistory = &g.CliSC{
+	Name:        "history",
+	Description: "Show the past stream runs recorded in the local history (status, rows, bytes, durations, watermarks, errors)",
+	PosFlags: []g.Flag{
+		{
+			Name:        "stream",
+			ShortName:   "",
+			Type:        "string",
+			Description: "The stream name (accepts * wildcards). All streams if omitted.",
+		},
+	},
+	Flags: []g.Flag{
+		{
+			Name:        "limit",
+			ShortName:   "l",
+			Type:        "string",
+			Description: "The number of runs to show, the latest first (default 20).",
+		},
+		{
+			Name:        "since",
+			ShortName:   "",
+			Type:        "string",
+			Description: "Only show the runs started since a duration ago (e.g. 24h) or a timestamp.",
+		},
+		{
+			Name:        "stats",
+			ShortName:   "",
+			Type:        "bool",
+			Description: "Show the stats per stream instead: runs, failures, last success time, average rows and duration.",
+		},
+		{
+			Name:        "format",
+			ShortName:   "f",
+			Type:        "string",
+			Description: "The output format: table (default) or json.",
+		},
+		{
+			Name:        "debug",
+			ShortName:   "d",
+			Type:        "bool",
+			Description: "Set logging level to DEBUG.",
+		},
+	},
+	ExecuteWithoutFlags: true, // all the streams
+	ExecProcess:         processHistory,
+}
+
 var cliInteractive = &g.CliSC{
 	Name:        "it",
 	Description: "launch interactive mode",
@@ -217,7 +724,7 @@ var cliConns = &g.CliSC{
 					Name:        "name",
 					ShortName:   "",
 					Type:        "string",
-					Description: "The name of the connection to test",
+					Description: "The name of the connection to test (omit with --all)",
 				},
 			},
 			Flags: []g.Flag{
@@ -263,6 +770,12 @@ var cliConns = &g.CliSC{
 				},
 			},
 			Flags: []g.Flag{
+				{
+					Name:        "all",
+					ShortName:   "",
+					Type:        "bool",
+					Description: "Test all the local connections, and report all failures at once.",
+				},
 				{
 					Name:        "debug",
 					ShortName:   "d",
@@ -377,7 +890,35 @@ func init() {
 	examples = string(examplesBytes)
 
 	cliConns.Make().Add()
+
+	// the connection name is not required when testing all (--all)
+	for _, sc := range cliConns.SubComs {
+		if sc.Name == "test" && sc.Sc != nil {
+			for _, pv := range sc.Sc.PositionalFlags {
+				pv.Required = false
+			}
+		}
+	}
 	cliRun.Make().Add()
+	cliScheduler.Make().Add()
+	cliPeek.Make().Add()
+	cliDiff.Make().Add()
+	cliBackfill.Make().Add()
+	cliValidate.Make().Add()
+
+	// the files are not required when printing the schema (--schema)
+	for _, pv := range cliValidate.Sc.PositionalFlags {
+		pv.Required = false
+	}
+	cliGenerate.Make().Add()
+	cliCleanup.Make().Add()
+	cliPlugins.Make().Add()
+	cliHistory.Make().Add()
+
+	// the stream is optional (all streams)
+	for _, pv := range cliHistory.Sc.PositionalFlags {
+		pv.Required = false
+	}
 	cliUpdate.Make().Add()
 
 	if projectID == "" {
@@ -455,25 +996,32 @@ func main() {
 		os.Exit(exitCode)
 	}
 
+	// cancel the running tasks, so that their queries are aborted and their
+	// temp tables / staging files are removed. A second signal exits now.
+	cancelRun := func() {
+		g.SentryClear()
+		if cliRun.Sc.Used || cliScheduler.Sc.Used {
+			interrupted = true
+			ctx.Cancel()
+			select {
+			case <-done:
+			case <-interrupt:
+			case <-kill:
+			case <-time.After(2*sling.CancelGracePeriod + 5*time.Second):
+			}
+		}
+		exit()
+	}
+
 	go func() {
 		select {
 		case <-kill:
 			env.Println("\nkilling process...")
 			exitCode = 111
-			exit()
+			cancelRun()
 		case <-interrupt:
-			g.SentryClear()
-			if cliRun.Sc.Used {
-				env.Println("\ninterrupting...")
-				interrupted = true
-				ctx.Cancel()
-				select {
-				case <-done:
-				case <-time.After(5 * time.Second):
-				}
-			}
-			exit()
-			return
+			env.Println("\ninterrupting...")
+			cancelRun()
 		case <-done:
 			exit()
 		}
@@ -175,7 +175,23 @@ func processConns(c *g.CliSC) (ok bool, err error) {
 
 	case "test":
 		env.SetTelVal("task", g.Marshal(g.M("type", sling.ConnTest)))
+		if cast.ToBool(c.Vals["all"]) {
+			fields, rows, err := entries.TestAll()
+			if asJSON {
+				fmt.Println(g.Marshal(g.M("success", err == nil, "error", g.ErrMsg(err), "fields", fields, "rows", rows)))
+				return ok, nil
+			}
+
+			fmt.Println(g.PrettyTable(fields, rows))
+			return ok, err
+		}
+
 		name := cast.ToString(c.Vals["name"])
+		if name == "" {
+			flaggy.ShowHelp("")
+			return ok, nil
+		}
+
 		if conn := entries.Get(name); conn.Name != "" {
 			env.SetTelVal("conn_type", conn.Connection.Type.String())
 			env.SetTelVal("conn_keys", lo.Keys(conn.Connection.Data))
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/slingdata-io/sling-cli/core/sling"
+	"github.com/spf13/cast"
+)
+
+// processDiff compares the source streams with their target objects,
+// for a replication or a single stream. Errors if drift is found.
+func processDiff(c *g.CliSC) (ok bool, err error) {
+	ok = true
+
+	if cast.ToBool(c.Vals["debug"]) {
+		os.Setenv("DEBUG", "LOW")
+		env.InitLogger()
+	}
+
+	opts := sling.DiffOptions{
+		Checksum: cast.ToBool(c.Vals["checksum"]),
+		Keys:     lo.Compact(strings.Split(cast.ToString(c.Vals["key"]), ",")),
+		Sample:   cast.ToInt(c.Vals["sample"]),
+		Where:    cast.ToString(c.Vals["where"]),
+	}
+
+	var results []sling.DiffResult
+	if cfgPath := cast.ToString(c.Vals["replication"]); cfgPath != "" {
+		replication, err := sling.LoadReplicationConfigFromFile(cfgPath)
+		if err != nil {
+			return ok, g.Error(err, "could not load replication: %s", cfgPath)
+		}
+
+		selectStreams := lo.Compact(strings.Split(cast.ToString(c.Vals["streams"]), ","))
+		if err = replication.Compile(nil, selectStreams...); err != nil {
+			return ok, g.Error(err, "could not compile replication: %s", cfgPath)
+		}
+
+		results, err = replication.Diff(opts)
+		printDiffResults(results)
+		return ok, err
+	}
+
+	cfg := &sling.Config{}
+	cfg.Source.Conn = cast.ToString(c.Vals["src-conn"])
+	cfg.Source.Stream = cast.ToString(c.Vals["src-stream"])
+	cfg.Target.Conn = cast.ToString(c.Vals["tgt-conn"])
+	cfg.Target.Object = cast.ToString(c.Vals["tgt-object"])
+	if cfg.Source.Conn == "" || cfg.Source.Stream == "" || cfg.Target.Conn == "" || cfg.Target.Object == "" {
+		return false, nil // show help
+	}
+
+	result, err := cfg.Diff(opts)
+	if err != nil {
+		return ok, err
+	}
+	printDiffResults([]sling.DiffResult{result})
+
+	if result.HasDrift() {
+		return ok, g.Error("drift found between %s and %s", result.Source, result.Target)
+	}
+	return ok, nil
+}
+
+func printDiffResults(results []sling.DiffResult) {
+	if os.Getenv("SLING_OUTPUT") == "json" {
+		fmt.Println(g.Marshal(results))
+		return
+	}
+
+	fields := []string{"Stream", "Source Rows", "Target Rows", "Columns", "Checksums", "Rows", "Status"}
+	rows := [][]any{}
+	details := []string{}
+	for _, result := range results {
+		columns := lo.Map(result.Columns, func(c sling.ColumnDiff, i int) string {
+			return g.F("%s (%s)", c.Name, c.Issue)
+		})
+		checksums := lo.Map(result.Checksums, func(c sling.ChecksumDiff, i int) string { return c.Column })
+
+		rowsStr := "-"
+		if result.Rows != nil {
+			rowsStr = g.F("%d compared", result.Rows.Compared)
+			if n := result.Rows.MissingInTarget + result.Rows.MissingInSource + result.Rows.Mismatched; n > 0 {
+				rowsStr = g.F("%s, %d missing in target, %d missing in source, %d mismatched", rowsStr, result.Rows.MissingInTarget, result.Rows.MissingInSource, result.Rows.Mismatched)
+				details = append(details, g.F("%s: drifted keys (%s): %s", result.Stream, strings.Join(result.Rows.Keys, ", "), strings.Join(result.Rows.Examples, ", ")))
+			}
+		}
+
+		status := lo.Ternary(result.HasDrift(), "drift", "ok")
+		if result.Error != "" {
+			status = "error"
+			details = append(details, g.F("%s: %s", result.Stream, result.Error))
+		}
+
+		rows = append(rows, []any{
+			result.Stream,
+			result.SourceCount,
+			result.TargetCount,
+			lo.Ternary(len(columns) == 0, "ok", strings.Join(columns, ", ")),
+			lo.Ternary(len(checksums) == 0, "-", "mismatched: "+strings.Join(checksums, ", ")),
+			rowsStr,
+			status,
+		})
+	}
+
+	fmt.Println(g.PrettyTable(fields, rows))
+	for _, detail := range details {
+		fmt.Println(detail)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/flarco/g"
+	"github.com/integrii/flaggy"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/slingdata-io/sling-cli/core/sling"
+	"github.com/spf13/cast"
+)
+
+// processGenerate scaffolds config files from the discovery of connections
+func processGenerate(c *g.CliSC) (ok bool, err error) {
+	ok = true
+
+	if cast.ToBool(c.Vals["debug"]) {
+		os.Setenv("DEBUG", "LOW")
+		env.InitLogger()
+	}
+
+	switch c.UsedSC() {
+	case "replication":
+		opts := sling.GenerateOptions{
+			Source:    cast.ToString(c.Vals["src-conn"]),
+			Target:    cast.ToString(c.Vals["tgt-conn"]),
+			Pattern:   cast.ToString(c.Vals["pattern"]),
+			Recursive: cast.ToBool(c.Vals["recursive"]),
+			Mode:      sling.Mode(cast.ToString(c.Vals["mode"])),
+		}
+		if opts.Source == "" || opts.Target == "" {
+			flaggy.ShowHelp("")
+			return ok, nil
+		}
+
+		content, err := sling.GenerateReplication(opts)
+		if err != nil {
+			return ok, g.Error(err, "could not generate replication")
+		}
+
+		output := cast.ToString(c.Vals["output"])
+		if output == "" {
+			fmt.Print(content)
+			return ok, nil
+		}
+
+		if err = os.WriteFile(output, []byte(content), 0644); err != nil {
+			return ok, g.Error(err, "could not write replication to %s", output)
+		}
+		g.Info("wrote replication to %s", output)
+
+	default:
+		return false, nil
+	}
+
+	return ok, nil
+}
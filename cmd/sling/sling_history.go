@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/slingdata-io/sling-cli/core/sling"
+	"github.com/spf13/cast"
+)
+
+// processHistory shows the past stream runs of the local history,
+// or the stats per stream (--stats)
+func processHistory(c *g.CliSC) (ok bool, err error) {
+	ok = true
+
+	if cast.ToBool(c.Vals["debug"]) {
+		os.Setenv("DEBUG", "LOW")
+		env.InitLogger()
+	}
+
+	filter := sling.HistoryFilter{Stream: cast.ToString(c.Vals["stream"]), Limit: 20}
+	if val := cast.ToString(c.Vals["limit"]); val != "" {
+		if filter.Limit, err = cast.ToIntE(val); err != nil || filter.Limit < 0 {
+			return ok, g.Error("invalid --limit value: %s (expected a number of runs)", val)
+		}
+	}
+	if val := cast.ToString(c.Vals["since"]); val != "" {
+		if duration, err := time.ParseDuration(val); err == nil {
+			filter.Since = time.Now().Add(-duration)
+		} else if filter.Since, err = cast.ToTimeE(val); err != nil {
+			return ok, g.Error("invalid --since value: %s (expected a duration such as 24h, or a timestamp)", val)
+		}
+	}
+
+	stats := cast.ToBool(c.Vals["stats"])
+	if stats {
+		filter.Limit = 0 // all the runs of the period
+	}
+
+	format := strings.ToLower(cast.ToString(c.Vals["format"]))
+	if format == "" {
+		format = lo.Ternary(os.Getenv("SLING_OUTPUT") == "json", "json", "table")
+	} else if !g.In(format, "table", "json") {
+		return ok, g.Error("invalid format: %s (expected table or json)", format)
+	}
+
+	runs, err := sling.HistoryGet(filter)
+	if err != nil {
+		return ok, g.Error(err, "could not get run history")
+	}
+
+	timeStr := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Local().Format("2006-01-02 15:04:05")
+	}
+	durationStr := func(seconds int64) string {
+		return g.DurationString(time.Duration(seconds) * time.Second)
+	}
+
+	if stats {
+		streamStats := sling.HistoryStats(runs)
+		if format == "json" {
+			fmt.Println(g.Marshal(streamStats))
+			return ok, nil
+		}
+
+		rows := lo.Map(streamStats, func(s sling.HistoryStreamStats, i int) []any {
+			return []any{s.Stream, s.Runs, s.Failures, s.LastStatus, timeStr(s.LastRun), timeStr(s.LastSuccess), humanize.Comma(cast.ToInt64(s.AvgRows)), durationStr(s.AvgDuration), s.LastWatermark}
+		})
+		fmt.Println(g.PrettyTable([]string{"Stream", "Runs", "Failures", "Last Status", "Last Run", "Last Success", "Avg Rows", "Avg Duration", "Watermark"}, rows))
+		return ok, nil
+	}
+
+	if format == "json" {
+		fmt.Println(g.Marshal(runs))
+		return ok, nil
+	}
+
+	rows := lo.Map(runs, func(run sling.HistoryRun, i int) []any {
+		errMsg := strings.Split(run.Error, "\n")[0]
+		if len(errMsg) > 60 {
+			errMsg = errMsg[:57] + "..."
+		}
+		return []any{timeStr(run.StartTime), run.Stream, run.Status, humanize.Comma(cast.ToInt64(run.Rows)), humanize.Bytes(run.Bytes), durationStr(run.Duration), run.Watermark, errMsg}
+	})
+	fmt.Println(g.PrettyTable([]string{"Started", "Stream", "Status", "Rows", "Bytes", "Duration", "Watermark", "Error"}, rows))
+	if len(runs) == 0 {
+		g.Info("no recorded runs")
+	}
+
+	return ok, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/spf13/cast"
+)
+
+// processPeek shows the first rows of a stream and its inferred columns
+func processPeek(c *g.CliSC) (ok bool, err error) {
+	ok = true
+
+	if cast.ToBool(c.Vals["debug"]) {
+		os.Setenv("DEBUG", "LOW")
+		env.InitLogger()
+	}
+
+	name, stream := cast.ToString(c.Vals["conn"]), cast.ToString(c.Vals["stream"])
+	if name == "" || stream == "" {
+		return false, nil // show help
+	}
+
+	limit := 100
+	if val := cast.ToInt(c.Vals["limit"]); val > 0 {
+		limit = val
+	}
+
+	format := strings.ToLower(cast.ToString(c.Vals["format"]))
+	if format == "" {
+		format = lo.Ternary(os.Getenv("SLING_OUTPUT") == "json", "json", "table")
+	} else if !g.In(format, "table", "json", "csv") {
+		return ok, g.Error("invalid format: %s (expected table, json or csv)", format)
+	}
+
+	data, err := connection.GetLocalConns().Peek(name, stream, limit)
+	if err != nil {
+		return ok, g.Error(err, "could not peek into %s", stream)
+	}
+
+	switch format {
+	case "json":
+		columns := lo.Map(data.Columns, func(col iop.Column, i int) map[string]any {
+			return g.M("name", col.Name, "type", col.Type, "db_type", col.DbType)
+		})
+		fmt.Println(g.Marshal(g.M("columns", columns, "rows", data.Rows)))
+	case "csv":
+		if _, err = data.WriteCsv(os.Stdout); err != nil {
+			return ok, g.Error(err, "could not write csv")
+		}
+	default:
+		schemaRows := lo.Map(data.Columns, func(col iop.Column, i int) []any {
+			return []any{col.Position, col.Name, col.Type, col.DbType}
+		})
+		fmt.Println(g.PrettyTable([]string{"#", "Column", "Type", "DB Type"}, schemaRows))
+		fmt.Println(data.PrettyTable())
+		g.Info("%d rows shown (limit %d)", len(data.Rows), limit)
+	}
+
+	return ok, nil
+}
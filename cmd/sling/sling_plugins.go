@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/integrii/flaggy"
+	"github.com/slingdata-io/sling-cli/core/dbio/plugin"
+	"github.com/spf13/cast"
+)
+
+// processPlugins installs, lists and removes the connector plugins
+func processPlugins(c *g.CliSC) (ok bool, err error) {
+	ok = true
+
+	switch c.UsedSC() {
+	case "install":
+		source := cast.ToString(c.Vals["source"])
+		if source == "" {
+			flaggy.ShowHelp("")
+			return ok, nil
+		}
+
+		opts := plugin.InstallOptions{
+			Name:   cast.ToString(c.Vals["name"]),
+			SHA256: cast.ToString(c.Vals["sha256"]),
+		}
+		p, err := plugin.Install(ctx.Ctx, source, opts)
+		if err != nil {
+			return ok, g.Error(err, "could not install plugin")
+		}
+		g.Info("installed plugin `%s` in %s. Use it with a connection of type `plugin` and `plugin: %s`", p.Name, p.Path, p.Name)
+
+	case "list":
+		plugins, err := plugin.List(ctx.Ctx)
+		if err != nil {
+			return ok, g.Error(err, "could not list plugins")
+		}
+
+		rows := [][]any{}
+		for _, p := range plugins {
+			rows = append(rows, []any{p.Name, p.Spec.Version, strings.Join(p.Spec.Capabilities, ", "), p.Spec.Description})
+		}
+		if len(rows) == 0 {
+			g.Info("no plugins installed in %s", plugin.Dir())
+			return ok, nil
+		}
+		fmt.Println(g.PrettyTable([]string{"Plugin", "Version", "Capabilities", "Description"}, rows))
+
+	case "remove":
+		name := cast.ToString(c.Vals["name"])
+		if name == "" {
+			flaggy.ShowHelp("")
+			return ok, nil
+		}
+
+		if err = plugin.Remove(name); err != nil {
+			return ok, err
+		}
+		g.Info("plugin `%s` has been removed", name)
+
+	default:
+		return false, nil
+	}
+
+	return ok, nil
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"time"
 
 	"gopkg.in/yaml.v2"
@@ -16,7 +19,9 @@ import (
 	"github.com/slingdata-io/sling-cli/core/env"
 	"github.com/slingdata-io/sling-cli/core/sling"
 
+	"github.com/dustin/go-humanize"
 	"github.com/flarco/g"
+	"github.com/samber/lo"
 	"github.com/spf13/cast"
 )
 
@@ -27,7 +32,15 @@ var (
 	rowCount          = int64(0)
 	totalBytes        = uint64(0)
 	constraintFails   = uint64(0)
+	rejectedRows      = uint64(0) // rows rejected or skipped, per on_error / oversize_policy
 	lookupReplication = func(id string) (r sling.ReplicationConfig, e error) { return }
+	watchMode         = false
+	preflightMode     = false
+	dryRunMode        = false
+	previewSQLMode    = false
+	setOverrides      []string           // with --set, applied to the replication or task config
+	runManifest       *sling.RunManifest // with --manifest / SLING_MANIFEST
+	runCosts          []streamCost       // volume & warehouse usage of the streams run
 
 	runReplication func(string, *sling.Config, ...string) error = replicationRun
 )
@@ -160,8 +173,40 @@ func processRun(c *g.CliSC) (ok bool, err error) {
 			cfg.Source.Select = strings.Split(cast.ToString(v), ",")
 		case "where":
 			cfg.Source.Where = cast.ToString(v)
+		case "confirm-keys":
+			if cast.ToBool(v) {
+				sling.ConfirmKeys = confirmKeys
+			}
+		case "reset-ledger":
+			os.Setenv("SLING_LEDGER_RESET", cast.ToString(cast.ToBool(v)))
+		case "manifest":
+			os.Setenv("SLING_MANIFEST", cast.ToString(v))
+		case "report":
+			os.Setenv("SLING_REPORT", cast.ToString(v))
+		case "deadline":
+			os.Setenv("SLING_DEADLINE", cast.ToString(v))
+		case "watch":
+			watchMode = cast.ToBool(v)
+		case "preflight":
+			preflightMode = cast.ToBool(v)
+		case "dry-run":
+			dryRunMode = cast.ToBool(v)
+		case "preview-sql":
+			previewSQLMode = cast.ToBool(v)
+		case "tui":
+			tuiMode = cast.ToBool(v)
 		case "streams":
-			selectStreams = strings.Split(cast.ToString(v), ",")
+			selectStreams = append(selectStreams, strings.Split(cast.ToString(v), ",")...)
+		case "group":
+			for _, group := range strings.Split(cast.ToString(v), ",") {
+				selectStreams = append(selectStreams, "group:"+strings.TrimSpace(group))
+			}
+		case "set":
+			setOverrides = sling.OverrideArgs(os.Args[1:])
+		case "run-id":
+			os.Setenv("SLING_RUN_ID", cast.ToString(v))
+		case "run-id-format":
+			os.Setenv("SLING_RUN_ID_FORMAT", cast.ToString(v))
 		case "debug":
 			cfg.Options.Debug = cast.ToBool(v)
 			if cfg.Options.Debug && os.Getenv("DEBUG") == "" {
@@ -191,11 +236,40 @@ func processRun(c *g.CliSC) (ok bool, err error) {
 
 	os.Setenv("SLING_CLI", "TRUE")
 	os.Setenv("SLING_CLI_ARGS", g.Marshal(os.Args[1:]))
-	if os.Getenv("SLING_EXEC_ID") == "" {
+	for _, format := range []sling.RunIDFormat{sling.RunIDFormatFromEnv(), sling.StreamRunIDFormatFromEnv()} {
+		if err = format.Validate(); err != nil {
+			return ok, err
+		}
+	}
+	if os.Getenv("SLING_EXEC_ID") == "" || os.Getenv("SLING_RUN_ID") != "" {
 		// set exec id if none provided
 		os.Setenv("SLING_EXEC_ID", sling.NewExecID())
 	}
 
+	// write the run manifest and report at the end (not when watching)
+	manifestURI, reportURI := os.Getenv("SLING_MANIFEST"), os.Getenv("SLING_REPORT")
+	if (manifestURI != "" || reportURI != "") && !watchMode {
+		runManifest = sling.NewRunManifest(os.Getenv("SLING_EXEC_ID"), lo.Ternary(pipelineCfgPath != "", pipelineCfgPath, replicationCfgPath))
+		defer func() {
+			if manifestURI != "" {
+				if err := runManifest.Write(manifestURI); err != nil {
+					g.Warn("could not write run manifest: %s", err.Error())
+				} else {
+					g.Debug("wrote run manifest to %s", manifestURI)
+				}
+			}
+
+			if reportURI != "" {
+				if err := runManifest.WriteReport(reportURI); err != nil {
+					g.Warn("could not write run report: %s", err.Error())
+				} else {
+					g.Info("wrote run report to %s", reportURI)
+				}
+			}
+			runManifest = nil
+		}()
+	}
+
 	// check for update, and print note
 	go checkUpdate(false)
 	defer printUpdateAvailable()
@@ -210,6 +284,11 @@ runReplication:
 		if err != nil {
 			return ok, g.Error(err, "failure running pipeline (see docs @ https://docs.slingdata.io)")
 		}
+	} else if replicationCfgPath != "" && watchMode {
+		err = watchReplication(replicationCfgPath, cfg, selectStreams...)
+		if err != nil {
+			return ok, g.Error(err, "failure watching replication (see docs @ https://docs.slingdata.io/sling-cli)")
+		}
 	} else if replicationCfgPath != "" {
 		//  run replication
 		err = runReplication(replicationCfgPath, cfg, selectStreams...)
@@ -217,11 +296,19 @@ runReplication:
 			return ok, g.Error(err, "failure running replication (see docs @ https://docs.slingdata.io/sling-cli)")
 		}
 	} else {
+		// apply the overrides to the task config
+		if len(setOverrides) > 0 {
+			if err = applyTaskOverrides(cfg, setOverrides); err != nil {
+				return ok, err
+			}
+			setOverrides = nil // not applied again to the replication
+		}
+
 		// run task, add replication config for md5
 		rc := cfg.AsReplication()
 
-		// run as replication is stream is wildcard
-		if cfg.HasWildcard() {
+		// run as replication is stream is wildcard, or when watching / preflighting / dry running / previewing
+		if cfg.HasWildcard() || watchMode || preflightMode || dryRunMode || previewSQLMode {
 			replicationCfgPath = path.Join(env.GetTempFolder(), g.NewTsID("replication.temp")+".json")
 			err = os.WriteFile(replicationCfgPath, []byte(g.Marshal(rc)), 0775)
 			if err != nil {
@@ -268,6 +355,7 @@ func runTask(cfg *sling.Config, replication *sling.ReplicationConfig) (err error
 			taskOptions["tgt_use_bulk"] = task.Config.Target.Options.UseBulk
 			taskOptions["tgt_add_new_columns"] = task.Config.Target.Options.AddNewColumns
 			taskOptions["tgt_adjust_column_type"] = task.Config.Target.Options.AdjustColumnType
+			taskOptions["tgt_column_changes"] = task.Config.Target.Options.ColumnChanges
 			taskOptions["tgt_column_casing"] = task.Config.Target.Options.ColumnCasing
 
 			taskMap["md5"] = task.Config.MD5()
@@ -370,6 +458,9 @@ func runTask(cfg *sling.Config, replication *sling.ReplicationConfig) (err error
 
 	task = sling.NewTask(os.Getenv("SLING_EXEC_ID"), cfg)
 	task.Replication = replication
+	if runTUI != nil {
+		runTUI.SetTask(cfg.StreamName, task)
+	}
 
 	if cast.ToBool(cfg.Env["SLING_DRY_RUN"]) || cast.ToBool(os.Getenv("SLING_DRY_RUN")) {
 		return nil
@@ -399,17 +490,22 @@ func runTask(cfg *sling.Config, replication *sling.ReplicationConfig) (err error
 	// run task
 	setTM()
 	err = task.Execute()
+	runManifest.Add(task)
+	task.RecordHistory()
+	runCosts = append(runCosts, streamCost{Stream: cfg.StreamName, Cost: task.Cost()})
+	rejectedRows = rejectedRows + task.GetRejectCount()
 
 	if err != nil {
 
-		if replication != nil && (len(replication.Tasks) > 1 || projectID != "") {
+		if runTUI == nil && replication != nil && (len(replication.Tasks) > 1 || projectID != "") {
 			// print error right after stream run if there are multiple runs
 			// so it's easy to find. otherwise will print at end
+			// (the live table shows it with --tui)
 			fmt.Fprintf(os.Stderr, "%s\n", env.RedString(g.ErrMsgSimple(err)))
 		}
 
 		// show help text
-		if eh := sling.ErrorHelper(err); eh != "" {
+		if eh := sling.ErrorHelper(err); eh != "" && runTUI == nil {
 			env.Println("")
 			env.Println(env.MagentaString(eh))
 			env.Println("")
@@ -438,13 +534,33 @@ func runTask(cfg *sling.Config, replication *sling.ReplicationConfig) (err error
 	return nil
 }
 
+// watchReplication runs the replication at every poll interval until interrupted,
+// so that new files are replicated as they arrive
+func watchReplication(cfgPath string, cfgOverwrite *sling.Config, selectStreams ...string) (err error) {
+	interval, err := sling.WatchInterval()
+	if err != nil {
+		return err
+	}
+
+	g.Info("watching for new files every %s (ctrl+c to stop)", interval)
+
+	return sling.Watch(ctx.Ctx, interval, func(context.Context) error {
+		return runReplication(cfgPath, cfgOverwrite, selectStreams...)
+	})
+}
+
 func replicationRun(cfgPath string, cfgOverwrite *sling.Config, selectStreams ...string) (err error) {
 	startTime := time.Now()
+	runCosts = nil
+	rejectedRows = 0
 
-	replication, err := sling.LoadReplicationConfigFromFile(cfgPath)
+	replication, err := sling.LoadReplicationConfigFromFile(cfgPath, setOverrides...)
 	if err != nil {
 		if sling.IsJSONorYAML(cfgPath) {
-			replication, err = sling.LoadReplicationConfig(cfgPath) // is JSON
+			var content string // is JSON
+			if content, err = sling.ApplyOverrides(cfgPath, setOverrides); err == nil {
+				replication, err = sling.LoadReplicationConfig(content)
+			}
 		} else if r, e := lookupReplication(cfgPath); r.OriginalCfg() != "" {
 			replication, err = r, e
 		}
@@ -458,11 +574,45 @@ func replicationRun(cfgPath string, cfgOverwrite *sling.Config, selectStreams ..
 		return g.Error(err, "Error compiling replication config")
 	}
 
+	if watchMode {
+		if err = replication.ValidateWatch(); err != nil {
+			return g.Error(err, "cannot watch replication")
+		}
+	}
+
 	if len(replication.Tasks) == 0 {
 		g.Warn("Did not match any streams. Exiting.")
 		return
 	}
 
+	// validate before moving any data (once, not at every poll when watching)
+	if preflightMode {
+		if _, err = replication.Preflight(); err != nil {
+			return g.Error(err, "preflight checks failed")
+		}
+		preflightMode = false
+	}
+
+	// show the work of the streams, without writing anything
+	if dryRunMode {
+		plans, err := replication.DryRun()
+		printDryRun(plans)
+		if err != nil {
+			return g.Error(err, "dry run failed")
+		}
+		return nil
+	}
+
+	// print the SQL statements of the streams, without running them
+	if previewSQLMode {
+		plans, err := replication.PreviewSQL()
+		printSQLPreview(plans)
+		if err != nil {
+			return g.Error(err, "SQL preview failed")
+		}
+		return nil
+	}
+
 	// parse hooks
 	startHooks, err := replication.ParseReplicationHook(sling.HookStageStart)
 	if err != nil {
@@ -475,6 +625,7 @@ func replicationRun(cfgPath string, cfgOverwrite *sling.Config, selectStreams ..
 
 	eG := g.ErrorGroup{}
 	successes := 0
+	ignoredFailures := 0
 
 	// get final stream count
 	streamCnt := 0
@@ -494,6 +645,16 @@ func replicationRun(cfgPath string, cfgOverwrite *sling.Config, selectStreams ..
 		return g.Error(err, "error executing start hooks")
 	}
 
+	// live table of the streams, instead of the log
+	if tuiMode && !watchMode {
+		if tuiAvailable() {
+			runTUI = newReplicationTUI(&replication)
+			runTUI.Start()
+		} else {
+			g.Warn("not an interactive terminal, ignoring --tui")
+		}
+	}
+
 	counter := 0
 	for _, cfg := range replication.Tasks {
 		if interrupted {
@@ -503,13 +664,17 @@ func replicationRun(cfgPath string, cfgOverwrite *sling.Config, selectStreams ..
 		env.LogSink = nil // clear log sink
 
 		if cfg.ReplicationStream.Disabled {
-			println()
+			if runTUI == nil {
+				println()
+			}
 			g.Debug("skipping stream %s since it is disabled", cfg.StreamName)
 			continue
 		} else if streamCnt == 1 {
 			g.Info("Sling Replication | %s -> %s | %s", replication.Source, replication.Target, cfg.StreamName)
 		} else {
-			println()
+			if runTUI == nil {
+				println()
+			}
 			counter++
 			g.Info("[%d / %d] running stream %s", counter, streamCnt, cfg.StreamName)
 		}
@@ -517,13 +682,26 @@ func replicationRun(cfgPath string, cfgOverwrite *sling.Config, selectStreams ..
 		env.TelMap = g.M("begin_time", time.Now().UnixMicro(), "run_mode", "replication") // reset map
 		env.SetTelVal("replication_md5", replication.MD5())
 		err = runTask(cfg, &replication)
+		if runTUI != nil {
+			runTUI.SetDone(cfg.StreamName, err)
+		}
 		if err != nil {
-			eG.Capture(err, cfg.StreamName)
+			if replication.FailsRun(cfg) {
+				eG.Capture(err, cfg.StreamName)
+			} else {
+				g.Warn("ignoring failure of stream %s (optional or on_failure: continue)", cfg.StreamName)
+				ignoredFailures++
+			}
 
 			// if a connection issue, stop
 			if e, ok := err.(*g.ErrType); ok && strings.Contains(e.Debug(), "Could not connect to ") {
 				replication.FailErr = g.ErrMsg(e)
 			}
+
+			if replication.StopAfterFailure(cfg) {
+				g.Warn("stopping the replication after failure of stream %s (on_failure: fail_fast)", cfg.StreamName)
+				break
+			}
 		} else {
 			successes++
 		}
@@ -534,6 +712,11 @@ func replicationRun(cfgPath string, cfgOverwrite *sling.Config, selectStreams ..
 		eG.Capture(err, "end-hooks")
 	}
 
+	if runTUI != nil {
+		runTUI.Stop()
+		runTUI = nil
+	}
+
 	println()
 	delta := time.Since(startTime)
 
@@ -545,13 +728,134 @@ func replicationRun(cfgPath string, cfgOverwrite *sling.Config, selectStreams ..
 		failureStr = env.GreenString(failureStr)
 	}
 
+	if ignoredFailures > 0 {
+		failureStr = failureStr + " | " + g.F("%d Ignored Failures", ignoredFailures)
+	}
+
+	if rejectedRows > 0 {
+		failureStr = failureStr + " | " + env.RedString(g.F("%d Rejected Rows", rejectedRows))
+	}
+
 	if streamCnt > 1 {
+		printCosts(runCosts)
 		g.Info("Sling Replication Completed in %s | %s -> %s | %s | %s\n", g.DurationString(delta), replication.Source, replication.Target, successStr, failureStr)
 	}
 
 	return eG.Err()
 }
 
+type streamCost struct {
+	Stream string
+	Cost   sling.CostState
+}
+
+// printCosts prints the volume of the streams, with the estimated
+// warehouse usage per stream when available (BigQuery, Snowflake)
+func printCosts(costs []streamCost) {
+	total := sling.CostState{}
+	for _, sc := range costs {
+		total.Add(sc.Cost)
+	}
+	if total.BytesRead == 0 && total.BytesWritten == 0 && total.Credits == 0 {
+		return
+	}
+
+	summary := g.F("Volume: %s read | %s written", humanize.Bytes(total.BytesRead), humanize.Bytes(total.BytesWritten))
+	if total.BytesBilled > 0 || total.Credits > 0 {
+		rows := [][]any{}
+		for _, sc := range costs {
+			rows = append(rows, []any{
+				sc.Stream,
+				humanize.Bytes(sc.Cost.BytesRead),
+				humanize.Bytes(sc.Cost.BytesWritten),
+				humanize.Bytes(uint64(sc.Cost.BytesBilled)),
+				g.F("%.4f", sc.Cost.Credits),
+			})
+		}
+		env.Println(g.PrettyTable([]string{"Stream", "Read", "Written", "Billed (BigQuery)", "Credits (Snowflake, est.)"}, rows))
+
+		if total.BytesBilled > 0 {
+			summary = summary + g.F(" | %s billed", humanize.Bytes(uint64(total.BytesBilled)))
+		}
+		if total.Credits > 0 {
+			summary = summary + g.F(" | ~%.4f credits", total.Credits)
+		}
+	}
+	g.Info(summary)
+}
+
+// printDryRun prints the plans of the streams (as JSON with SLING_OUTPUT=json)
+func printDryRun(plans []sling.StreamPlan) {
+	if os.Getenv("SLING_OUTPUT") == "json" {
+		env.Println(g.Marshal(plans))
+		return
+	}
+
+	for _, plan := range plans {
+		lines := []string{g.F("%s -> %s (%s)", plan.Stream, plan.Object, plan.Mode)}
+		if plan.Error != "" {
+			lines = append(lines, "  error: "+plan.Error)
+		}
+		if wm := plan.Watermark; wm != nil {
+			switch {
+			case wm.To != "":
+				lines = append(lines, g.F("  range: %s from %s to %s", wm.Column, wm.From, wm.To))
+			case wm.From != "":
+				lines = append(lines, g.F("  incremental: %s after %s", wm.Column, wm.From))
+			default:
+				lines = append(lines, g.F("  incremental: %s, full load (no target watermark)", wm.Column))
+			}
+		}
+		if plan.Rows >= 0 {
+			lines = append(lines, g.F("  rows: %s%s", humanize.Comma(plan.Rows), lo.Ternary(plan.RowsEstimated, " (estimated)", "")))
+		}
+		if len(plan.Files) > 0 {
+			lines = append(lines, g.F("  files: %d (%s)", len(plan.Files), humanize.Bytes(plan.Bytes)))
+			for _, file := range plan.Files {
+				lines = append(lines, "    "+file)
+			}
+		}
+		if plan.SourceSQL != "" {
+			lines = append(lines, "  source query:", "    "+strings.ReplaceAll(plan.SourceSQL, "\n", "\n    "))
+		}
+		if len(plan.Statements) > 0 {
+			lines = append(lines, "  target statements:")
+			for _, sql := range plan.Statements {
+				lines = append(lines, "    "+strings.ReplaceAll(sql, "\n", "\n    ")+lo.Ternary(strings.HasPrefix(sql, "--"), "", ";"))
+			}
+		}
+		env.Println(strings.Join(lines, "\n") + "\n")
+	}
+}
+
+// printSQLPreview prints the SQL statements of the streams as a script (as
+// JSON with SLING_OUTPUT=json)
+func printSQLPreview(plans []sling.StreamPlan) {
+	if os.Getenv("SLING_OUTPUT") == "json" {
+		env.Println(g.Marshal(plans))
+		return
+	}
+
+	for _, plan := range plans {
+		lines := []string{g.F("-- stream: %s -> %s (%s)", plan.Stream, plan.Object, plan.Mode)}
+		if plan.Error != "" {
+			lines = append(lines, "-- error: "+strings.ReplaceAll(plan.Error, "\n", "\n-- "))
+		}
+		if plan.SourceSQL != "" {
+			lines = append(lines, g.F("\n-- on source (%s)", plan.Source), strings.TrimSuffix(strings.TrimSpace(plan.SourceSQL), ";")+";")
+		} else if len(plan.Files) > 0 {
+			lines = append(lines, g.F("\n-- on source (%s): read %d files", plan.Source, len(plan.Files)))
+		}
+		if len(plan.Statements) > 0 {
+			lines = append(lines, g.F("\n-- on target (%s)", plan.Target))
+			for _, sql := range plan.Statements {
+				lines = append(lines, sql+lo.Ternary(strings.HasPrefix(sql, "--"), "", ";"))
+			}
+		}
+		env.Println(strings.Join(lines, "\n") + "\n")
+	}
+}
+
 func runPipeline(pipelineCfgPath string) (err error) {
 	pipeline, err := sling.LoadPipelineConfigFromFile(pipelineCfgPath)
 	if err != nil {
@@ -596,6 +900,20 @@ func parsePayload(payload string, validate bool) (options map[string]any, err er
 	return options, nil
 }
 
+// applyTaskOverrides applies the --set overrides to the task config, with
+// its keys (e.g. `source.options.limit=10` or `target.options.batch_size=500`)
+func applyTaskOverrides(cfg *sling.Config, overrides []string) (err error) {
+	m := g.M()
+	if err = g.JSONConvert(cfg, &m); err != nil {
+		return g.Error(err, "could not convert task config")
+	} else if err = sling.ApplyOverridesMap(m, overrides); err != nil {
+		return g.Error(err, "invalid --set value")
+	} else if err = g.JSONConvert(m, cfg); err != nil {
+		return g.Error(err, "invalid --set value")
+	}
+	return nil
+}
+
 // setProjectID attempts to get the first sha of the repo
 func setProjectID(cfgPath string) {
 	projectID = os.Getenv("SLING_PROJECT_ID")
@@ -661,3 +979,22 @@ func testOutput(rowCnt int64, totalBytes, constraintFails uint64) error {
 
 	return nil
 }
+
+var confirmKeysMux sync.Mutex
+
+// confirmKeys asks to confirm the keys discovered for the stream (with
+// `--confirm-keys`). They are not confirmed if stdin is not a terminal.
+func confirmKeys(stream string, keys sling.DiscoveredKeys) bool {
+	confirmKeysMux.Lock()
+	defer confirmKeysMux.Unlock()
+
+	stat, err := os.Stdin.Stat()
+	if err != nil || (stat.Mode()&os.ModeCharDevice) == 0 {
+		g.Warn("cannot confirm the discovered keys of %s, stdin is not a terminal", stream)
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "Use the discovered keys of %s (%s)? [y/N]: ", stream, keys)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return g.In(strings.ToLower(strings.TrimSpace(answer)), "y", "yes")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/kardianos/osext"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/slingdata-io/sling-cli/core/sling"
+	"github.com/spf13/cast"
+)
+
+func processScheduler(c *g.CliSC) (ok bool, err error) {
+	ok = true
+
+	if cast.ToBool(c.Vals["debug"]) {
+		os.Setenv("DEBUG", "LOW")
+		env.InitLogger()
+	}
+
+	statusFile := sling.DefaultSchedulerStatusFile()
+	if cast.ToBool(c.Vals["status"]) {
+		return ok, printSchedulerStatus(statusFile)
+	}
+
+	paths := lo.Compact(strings.Split(cast.ToString(c.Vals["replication"]), ","))
+	if len(paths) == 0 {
+		return false, nil // show help
+	}
+
+	overlap := sling.ScheduleOverlap(strings.ToLower(cast.ToString(c.Vals["overlap"])))
+	if overlap == "" {
+		overlap = sling.ScheduleOverlap(strings.ToLower(os.Getenv("SLING_SCHEDULE_OVERLAP")))
+	}
+
+	scheduler, err := sling.NewScheduler(overlap, runScheduledJob)
+	if err != nil {
+		return ok, g.Error(err, "could not create scheduler")
+	}
+	scheduler.StatusFile = statusFile
+
+	for _, cfgPath := range paths {
+		cfgPath = strings.TrimSpace(cfgPath)
+		replication, err := sling.LoadReplicationConfigFromFile(cfgPath)
+		if err != nil {
+			return ok, g.Error(err, "could not load replication: %s", cfgPath)
+		}
+
+		if err = scheduler.AddReplication(cfgPath, replication); err != nil {
+			return ok, g.Error(err, "could not schedule replication: %s", cfgPath)
+		}
+	}
+
+	g.Info(g.Colorize(g.ColorCyan, "Sling Scheduler | https://slingdata.io"))
+	g.Info("status is written to %s", statusFile)
+
+	if err = scheduler.Start(ctx.Ctx); err != nil {
+		return ok, g.Error(err, "scheduler failed")
+	}
+
+	return ok, nil
+}
+
+// runScheduledJob runs the job streams in a separate sling process,
+// so that each run is isolated, the same as `sling run`
+func runScheduledJob(ctx context.Context, job *sling.ScheduleJob) (err error) {
+	bin, err := osext.Executable()
+	if err != nil {
+		return g.Error(err, "could not determine sling executable")
+	}
+
+	cmd := exec.CommandContext(ctx, bin, "run", "-r", job.Replication, "--streams", strings.Join(job.Streams, ","))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "SLING_SCHEDULE="+job.Schedule)
+
+	// interrupt gracefully when the scheduler stops
+	cmd.Cancel = func() error {
+		if runtime.GOOS == "windows" {
+			return cmd.Process.Kill()
+		}
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = 30 * time.Second
+
+	if err = cmd.Run(); err != nil {
+		return g.Error(err, "run failed for streams: %s", strings.Join(job.Streams, ", "))
+	}
+	return nil
+}
+
+// printSchedulerStatus prints the status written by the running scheduler
+func printSchedulerStatus(statusFile string) (err error) {
+	status, err := sling.ReadSchedulerStatus(statusFile)
+	if err != nil {
+		return err
+	}
+
+	if os.Getenv("SLING_OUTPUT") == "json" {
+		fmt.Println(g.Marshal(status))
+		return nil
+	}
+
+	formatTime := func(t *time.Time) string {
+		if t == nil || t.IsZero() {
+			return "-"
+		}
+		return t.Format("2006-01-02 15:04:05")
+	}
+
+	fields := []string{"Replication", "Schedule", "Streams", "Next Run", "Last Start", "Last Status", "Runs", "Failures"}
+	rows := [][]any{}
+	for _, job := range status.Jobs {
+		rows = append(rows, []any{
+			job.Replication,
+			job.Schedule,
+			len(job.Streams),
+			formatTime(&job.NextRun),
+			formatTime(job.LastStart),
+			lo.Ternary(job.LastStatus == "", "-", job.LastStatus),
+			job.Runs,
+			job.Failures,
+		})
+	}
+
+	g.Info("scheduler (pid %d) started at %s, updated at %s", status.PID, formatTime(&status.StartedAt), formatTime(&status.UpdatedAt))
+	fmt.Println(g.PrettyTable(fields, rows))
+
+	return nil
+}
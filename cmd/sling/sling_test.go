@@ -161,7 +161,7 @@ func TestCfgPath(t *testing.T) {
 		assert.EqualValues(t, 111, cfg.Source.Limit())
 		assert.EqualValues(t, "testing", cfg.Target.Options.TableDDL)
 		assert.EqualValues(t, "testing", cfg.Target.Options.TableTmp)
-		assert.EqualValues(t, "testing", cfg.Target.Options.PostSQL)
+		assert.EqualValues(t, "testing", cfg.Target.Options.PostSQL.String())
 
 		return err
 	}
@@ -437,14 +437,14 @@ func runOneTask(t *testing.T, file g.FileItem, connType dbio.Type) {
 			dropViewSQL := g.R(dbConn.GetTemplateValue("core.drop_view"), "view", viewName)
 			dropViewSQL = strings.TrimSpace(dropViewSQL)
 			if preSQL := taskCfg.Target.Options.PreSQL; preSQL != nil {
-				taskCfg.Target.Options.PreSQL = g.String(g.R(
-					*preSQL,
+				taskCfg.Target.Options.PreSQL = sling.NewSQLStatements(g.R(
+					preSQL.String(),
 					"drop_view", dropViewSQL,
 				))
 			}
 			if postSQL := taskCfg.Target.Options.PostSQL; postSQL != nil {
-				taskCfg.Target.Options.PostSQL = g.String(g.R(
-					*postSQL,
+				taskCfg.Target.Options.PostSQL = sling.NewSQLStatements(g.R(
+					postSQL.String(),
 					"drop_view", dropViewSQL,
 				))
 			}
@@ -1087,7 +1087,7 @@ streams:
 		assert.Equal(t, `"my_schema2"."table2"`, config.Target.Object)
 		assert.Equal(t, g.Bool(true), config.Target.Options.AddNewColumns)
 		assert.EqualValues(t, g.Int64(600000), config.Target.Options.FileMaxRows)
-		assert.EqualValues(t, g.String("some sql"), config.Target.Options.PostSQL)
+		assert.EqualValues(t, sling.NewSQLStatements("some sql"), config.Target.Options.PostSQL)
 		assert.EqualValues(t, false, config.ReplicationStream.Disabled)
 	}
 
@@ -1100,7 +1100,7 @@ streams:
 		assert.Equal(t, []string{}, config.Source.PrimaryKey())
 		assert.Equal(t, "", config.Source.UpdateKey)
 		assert.EqualValues(t, g.Int64(0), config.Target.Options.FileMaxRows)
-		assert.EqualValues(t, g.String(""), config.Target.Options.PostSQL)
+		assert.EqualValues(t, sling.NewSQLStatements(), config.Target.Options.PostSQL)
 		assert.EqualValues(t, true, config.ReplicationStream.Disabled)
 		assert.Equal(t, "[{\"name\":\"id\",\"type\":\"string(100)\"}]", g.Marshal(config.Target.Columns))
 		assert.Equal(t, `["trim_space"]`, g.Marshal(config.Transforms))
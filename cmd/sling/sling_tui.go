@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/flarco/g"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/slingdata-io/sling-cli/core/sling"
+)
+
+// tuiMode shows the live table of the streams instead of the log (--tui)
+var tuiMode = false
+
+// runTUI is the terminal UI of the running replication, if any
+var runTUI *replicationTUI
+
+type tuiStream struct {
+	name   string
+	status string // queued, running, success, error, skipped
+	task   *sling.TaskExecution
+	err    error
+	start  time.Time
+	end    time.Time
+}
+
+// replicationTUI redraws a table of the streams (status, rows, rows/sec,
+// bytes, elapsed) in place, with the details of the failed streams. The log
+// is written to a file meanwhile.
+type replicationTUI struct {
+	mu        sync.Mutex
+	title     string
+	streams   []*tuiStream
+	byName    map[string]*tuiStream
+	lines     int // number of lines drawn, to redraw in place
+	logPath   string
+	logFile   *os.File
+	zLogOut   zerolog.Logger
+	zLogErr   zerolog.Logger
+	startTime time.Time
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// tuiAvailable returns true if stderr is a terminal
+func tuiAvailable() bool {
+	stat, err := os.Stderr.Stat()
+	return err == nil && (stat.Mode()&os.ModeCharDevice) != 0
+}
+
+func newReplicationTUI(replication *sling.ReplicationConfig) *replicationTUI {
+	t := &replicationTUI{
+		title:   g.F("Sling Replication | %s -> %s", replication.Source, replication.Target),
+		byName:  map[string]*tuiStream{},
+		logPath: path.Join(env.GetTempFolder(), g.F("sling-%s.log", time.Now().Format("20060102T150405"))),
+		done:    make(chan struct{}),
+	}
+
+	for _, cfg := range replication.Tasks {
+		stream := &tuiStream{name: cfg.StreamName, status: "queued"}
+		if cfg.ReplicationStream != nil && cfg.ReplicationStream.Disabled {
+			stream.status = "skipped"
+		}
+		t.streams = append(t.streams, stream)
+		t.byName[cfg.StreamName] = stream
+	}
+
+	return t
+}
+
+// Start redirects the log to a file, and redraws every half second
+func (t *replicationTUI) Start() {
+	t.startTime = time.Now()
+	t.zLogOut, t.zLogErr = g.ZLogOut, g.ZLogErr
+	sling.ShowProgress = false
+
+	if file, err := os.Create(t.logPath); err == nil {
+		t.logFile = file
+		writer := zerolog.ConsoleWriter{Out: file, NoColor: true, TimeFormat: "2006-01-02 15:04:05"}
+		g.ZLogOut = zerolog.New(writer).With().Timestamp().Logger()
+		g.ZLogErr = g.ZLogOut
+	} else {
+		g.ZLogOut, g.ZLogErr = zerolog.Nop(), zerolog.Nop()
+		t.logPath = ""
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			t.draw()
+			select {
+			case <-ticker.C:
+			case <-t.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop draws the final table and restores the log. The full errors are
+// printed at the end of the run, as usual.
+func (t *replicationTUI) Stop() {
+	close(t.done)
+	t.wg.Wait()
+	t.draw()
+
+	g.ZLogOut, g.ZLogErr = t.zLogOut, t.zLogErr
+	if t.logFile != nil {
+		t.logFile.Close()
+	}
+
+	if t.logPath != "" {
+		fmt.Fprintf(os.Stderr, "\nlog written to %s\n", t.logPath)
+	}
+}
+
+// SetTask sets the running task of the stream
+func (t *replicationTUI) SetTask(name string, task *sling.TaskExecution) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if stream, ok := t.byName[name]; ok {
+		stream.task = task
+		stream.status = "running"
+		stream.start = time.Now()
+	}
+}
+
+// SetDone sets the result of the stream
+func (t *replicationTUI) SetDone(name string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if stream, ok := t.byName[name]; ok {
+		stream.status = lo.Ternary(err != nil, "error", "success")
+		stream.err = err
+		stream.end = time.Now()
+		if stream.start.IsZero() {
+			stream.start = stream.end // failed before starting
+		}
+	}
+}
+
+func (t *replicationTUI) render() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := lo.CountValuesBy(t.streams, func(s *tuiStream) string { return s.status })
+	header := g.F("%s | %s | %d/%d done | %d failed",
+		t.title, g.DurationString(time.Since(t.startTime)),
+		counts["success"]+counts["error"], len(t.streams)-counts["skipped"], counts["error"],
+	)
+
+	rows := [][]any{}
+	details := []string{}
+	for i, stream := range t.streams {
+		rowsStr, rateStr, bytesStr, elapsed := "-", "-", "-", "-"
+		if stream.task != nil {
+			count := stream.task.GetCount()
+			rowRate, _ := stream.task.GetRate(0)
+			inBytes, _ := stream.task.GetBytes()
+			rowsStr = humanize.Comma(int64(count))
+			rateStr = humanize.Comma(rowRate)
+			bytesStr = lo.Ternary(inBytes > 0, humanize.Bytes(inBytes), "-")
+		}
+		if !stream.start.IsZero() {
+			end := lo.Ternary(stream.end.IsZero(), time.Now(), stream.end)
+			elapsed = g.DurationString(end.Sub(stream.start))
+		}
+
+		if stream.err != nil {
+			// first line of the error, the full error is in the log
+			msg, _, _ := strings.Cut(strings.TrimSpace(g.ErrMsgSimple(stream.err)), "\n")
+			details = append(details, g.F("  [%d] %s: %s", i+1, stream.name, msg))
+		}
+
+		rows = append(rows, []any{i + 1, stream.name, stream.status, rowsStr, rateStr, bytesStr, elapsed})
+	}
+
+	output := header + "\n" + g.PrettyTable([]string{"#", "Stream", "Status", "Rows", "Rows/Sec", "Bytes", "Elapsed"}, rows) + "\n"
+	if len(details) > 0 {
+		output = output + "Errors:\n" + strings.Join(details, "\n") + "\n"
+	}
+	if t.logPath != "" {
+		output = output + g.F("log: %s\n", t.logPath)
+	}
+	return output
+}
+
+// draw redraws the output in place
+func (t *replicationTUI) draw() {
+	output := t.render()
+	if t.lines > 0 {
+		fmt.Fprintf(os.Stderr, "\033[%dA\033[J", t.lines)
+	}
+	fmt.Fprint(os.Stderr, output)
+	t.lines = strings.Count(output, "\n")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/integrii/flaggy"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/sling"
+	"github.com/spf13/cast"
+)
+
+// processValidate validates the replication files, printing the issues
+// as `file:line:column: path: message` (or JSON with SLING_OUTPUT=json).
+// Errors if any issue is found, for CI usage. With --schema, prints the
+// JSON Schema instead.
+func processValidate(c *g.CliSC) (ok bool, err error) {
+	ok = true
+
+	if cast.ToBool(c.Vals["schema"]) {
+		fmt.Println(g.Pretty(sling.ReplicationJSONSchema()))
+		return ok, nil
+	}
+
+	paths := lo.Compact(append([]string{cast.ToString(c.Vals["files..."])}, flaggy.TrailingArguments...))
+	if len(paths) == 0 {
+		return false, nil // show help
+	}
+
+	issues := []sling.ValidationIssue{}
+	for _, path := range paths {
+		fileIssues, err := sling.ValidateReplicationFile(path)
+		if err != nil {
+			return ok, err
+		}
+		issues = append(issues, fileIssues...)
+	}
+
+	if os.Getenv("SLING_OUTPUT") == "json" {
+		fmt.Println(g.Marshal(g.M("valid", len(issues) == 0, "issues", issues)))
+	} else {
+		for _, issue := range issues {
+			fmt.Println(issue.String())
+		}
+	}
+
+	if len(issues) > 0 {
+		return ok, g.Error("found %d issue(s) in %s", len(issues), strings.Join(paths, ", "))
+	}
+
+	if os.Getenv("SLING_OUTPUT") != "json" {
+		g.Info("%s: valid", strings.Join(paths, ", "))
+	}
+	return ok, nil
+}
@@ -225,7 +225,7 @@ func (c *Connection) URL() string {
 		switch c.Type {
 		case dbio.TypeFileLocal:
 			url = "file://"
-		case dbio.TypeFileSftp:
+		case dbio.TypeFileSftp, dbio.TypeFileHDFS:
 			url = g.F("%s://%s:%s", c.Type.String(), c.Data["host"], cast.ToString(c.Data["port"]))
 		case dbio.TypeFileFtp:
 			url = g.F("%s://%s:%s", c.Type.String(), c.Data["host"], cast.ToString(c.Data["port"]))
@@ -370,6 +370,11 @@ func (c *Connection) ConnSetDatabase(dbName string) *Connection {
 func (c *Connection) setURL() (err error) {
 	c.setFromEnv()
 
+	// resolve secret references, such as `vault://secret/db#password`
+	if err = c.setFromSecrets(); err != nil {
+		return err
+	}
+
 	// setIfMissing sets a default value if key is not present
 	setIfMissing := func(key string, val interface{}) {
 		if v, ok := c.Data[key]; !ok || v == "" {
@@ -405,10 +410,14 @@ func (c *Connection) setURL() (err error) {
 				setIfMissing("port", U.Port(c.Info().Type.DefPort()))
 			}
 
-			if g.In(c.Type, dbio.TypeDbPostgres, dbio.TypeDbRedshift) {
+			if g.In(c.Type, dbio.TypeDbPostgres, dbio.TypeDbGreenplum, dbio.TypeDbRedshift) {
 				setIfMissing("sslmode", U.PopParam("sslmode"))
 			}
 
+			if c.Type == dbio.TypeDbVertica {
+				setIfMissing("tlsmode", U.PopParam("tlsmode"))
+			}
+
 			if c.Type == dbio.TypeDbSnowflake {
 				setIfMissing("warehouse", U.PopParam("warehouse"))
 			} else if c.Type == dbio.TypeDbBigQuery {
@@ -431,6 +440,11 @@ func (c *Connection) setURL() (err error) {
 				setIfMissing("database", U.PopParam("database"))
 			} else if c.Type == dbio.TypeDbOracle {
 				setIfMissing("sid", pathValue)
+			} else if c.Type == dbio.TypeDbDatabricks {
+				// the path is the sql warehouse id, the catalog is a param
+				setIfMissing("warehouse_id", pathValue)
+				setIfMissing("database", U.GetParam("catalog"))
+				pathValue = ""
 			}
 
 			// set database
@@ -441,7 +455,7 @@ func (c *Connection) setURL() (err error) {
 				setIfMissing(k, v)
 			}
 		}
-		if g.In(c.Type, dbio.TypeFileSftp, dbio.TypeFileFtp) {
+		if g.In(c.Type, dbio.TypeFileSftp, dbio.TypeFileFtp, dbio.TypeFileHDFS) {
 			setIfMissing("user", U.Username())
 			setIfMissing("host", U.Hostname())
 			setIfMissing("password", U.Password())
@@ -501,6 +515,13 @@ func (c *Connection) setURL() (err error) {
 		setIfMissing("port", c.Type.DefPort())
 		setIfMissing("database", c.Data["dbname"])
 		template = "postgresql://{username}:{password}@{host}:{port}/{database}?sslmode={sslmode}"
+	case dbio.TypeDbGreenplum:
+		setIfMissing("username", c.Data["user"])
+		setIfMissing("password", "")
+		setIfMissing("sslmode", "disable")
+		setIfMissing("port", c.Type.DefPort())
+		setIfMissing("database", c.Data["dbname"])
+		template = "greenplum://{username}:{password}@{host}:{port}/{database}?sslmode={sslmode}"
 	case dbio.TypeDbRedshift:
 		setIfMissing("username", c.Data["user"])
 		setIfMissing("password", "")
@@ -508,6 +529,13 @@ func (c *Connection) setURL() (err error) {
 		setIfMissing("port", c.Type.DefPort())
 		setIfMissing("database", c.Data["dbname"])
 		template = "redshift://{username}:{password}@{host}:{port}/{database}?sslmode={sslmode}"
+	case dbio.TypeDbVertica:
+		setIfMissing("username", c.Data["user"])
+		setIfMissing("password", "")
+		setIfMissing("tlsmode", "none")
+		setIfMissing("port", c.Type.DefPort())
+		setIfMissing("database", c.Data["dbname"])
+		template = "vertica://{username}:{password}@{host}:{port}/{database}?tlsmode={tlsmode}"
 	case dbio.TypeDbStarRocks:
 		setIfMissing("username", c.Data["user"])
 		setIfMissing("password", "")
@@ -523,6 +551,16 @@ func (c *Connection) setURL() (err error) {
 		setIfMissing("password", "")
 		setIfMissing("port", c.Type.DefPort())
 		template = "mariadb://{username}:{password}@{host}:{port}/{database}"
+	case dbio.TypeDbSingleStore:
+		setIfMissing("username", c.Data["user"])
+		setIfMissing("password", "")
+		setIfMissing("port", c.Type.DefPort())
+		template = "singlestore://{username}:{password}@{host}:{port}/{database}"
+	case dbio.TypeDbTiDB:
+		setIfMissing("username", c.Data["user"])
+		setIfMissing("password", "")
+		setIfMissing("port", c.Type.DefPort())
+		template = "tidb://{username}:{password}@{host}:{port}/{database}"
 	case dbio.TypeDbBigQuery:
 		setIfMissing("dataset", c.Data["schema"])
 		setIfMissing("schema", c.Data["dataset"])
@@ -575,6 +613,46 @@ func (c *Connection) setURL() (err error) {
 		}
 
 		template = "prometheus://{host}"
+	case dbio.TypeDbInfluxDB:
+		setIfMissing("port", c.Type.DefPort())
+
+		// parse http url
+		if httpUrlStr, ok := c.Data["http_url"]; ok {
+			u, err := url.Parse(cast.ToString(httpUrlStr))
+			if err != nil {
+				g.Warn("invalid http_url: %s", err.Error())
+			} else {
+				setIfMissing("host", u.Hostname())
+			}
+		} else {
+			setIfMissing("http_url", g.F("http://%s:%v", c.Data["host"], c.Data["port"]))
+		}
+
+		template = "influxdb://{host}"
+	case dbio.TypeDbNeo4j:
+		setIfMissing("port", c.Type.DefPort())
+
+		// parse http url
+		if httpUrlStr, ok := c.Data["http_url"]; ok {
+			u, err := url.Parse(cast.ToString(httpUrlStr))
+			if err != nil {
+				g.Warn("invalid http_url: %s", err.Error())
+			} else {
+				setIfMissing("host", u.Hostname())
+			}
+		} else {
+			setIfMissing("http_url", g.F("http://%s:%v", c.Data["host"], c.Data["port"]))
+		}
+
+		template = "neo4j://{host}"
+	case dbio.TypeDbStripe:
+		template = "stripe://"
+	case dbio.TypeDbShopify:
+		template = "shopify://{shop}"
+	case dbio.TypeDbHubSpot:
+		template = "hubspot://"
+	case dbio.TypeDbPlugin:
+		template = "plugin://{plugin}"
 	case dbio.TypeDbBigTable:
 		template = "bigtable://{project}/{instance}?"
 		if _, ok := c.Data["keyfile"]; ok {
@@ -680,6 +758,39 @@ func (c *Connection) setURL() (err error) {
 		if _, ok := c.Data["schema"]; ok {
 			template = template + "&schema={schema}"
 		}
+	case dbio.TypeDbDatabricks:
+		setIfMissing("catalog", c.Data["database"])
+		setIfMissing("port", c.Type.DefPort())
+
+		// parse http path, e.g. /sql/1.0/warehouses/abc123
+		if httpPath := cast.ToString(c.Data["http_path"]); httpPath != "" {
+			setIfMissing("warehouse_id", path.Base(httpPath))
+		}
+
+		// the token or client_id / client_secret are passed as props
+		template = "databricks://{host}/{warehouse_id}?catalog={catalog}"
+		if _, ok := c.Data["schema"]; ok {
+			template = template + "&schema={schema}"
+		}
+	case dbio.TypeDbTeradata:
+		setIfMissing("username", c.Data["user"])
+		setIfMissing("password", "")
+		setIfMissing("schema", c.Data["database"])
+		setIfMissing("port", c.Type.DefPort())
+
+		// the system name registered in the Query Service
+		template = "teradata://{username}:{password}@{host}:{port}/{database}?system={system}"
+	case dbio.TypeDbFirebolt:
+		setIfMissing("account", c.Data["host"])
+		setIfMissing("client_id", c.Data["username"])
+		setIfMissing("client_secret", c.Data["password"])
+		setIfMissing("schema", "public")
+
+		// the engine is optional, queries run on the system engine otherwise
+		template = "firebolt://{client_id}:{client_secret}@{account}/{database}"
+		if _, ok := c.Data["engine"]; ok {
+			template = template + "?engine={engine}"
+		}
 	case dbio.TypeDbClickhouse:
 		setIfMissing("username", c.Data["user"])
 		setIfMissing("username", "") // clickhouse can work without a user
@@ -726,6 +837,9 @@ func (c *Connection) setURL() (err error) {
 		setIfMissing("password", "")
 		setIfMissing("port", c.Type.DefPort())
 		template = c.Type.String() + "://{user}:{password}@{host}:{port}/"
+	case dbio.TypeFileHDFS:
+		setIfMissing("port", c.Type.DefPort())
+		template = c.Type.String() + "://{host}:{port}/"
 	case dbio.TypeFileS3, dbio.TypeFileGoogle, dbio.TypeFileAzure,
 		dbio.TypeFileLocal:
 		return nil
@@ -1,6 +1,7 @@
 package connection
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"github.com/slingdata-io/sling-cli/core/dbio"
 	"github.com/slingdata-io/sling-cli/core/dbio/database"
 	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
 	"github.com/slingdata-io/sling-cli/core/env"
 	"github.com/spf13/cast"
 	"gopkg.in/yaml.v2"
@@ -65,6 +67,106 @@ func (ce ConnEntries) Test(name string) (ok bool, err error) {
 	return
 }
 
+// Peek returns the first rows of the stream of the connection, with the
+// inferred columns. The stream is a table or query for databases, or a file
+// path / url for file systems.
+func (ce ConnEntries) Peek(name, stream string, limit int) (data iop.Dataset, err error) {
+	conn := ce.Get(name)
+	if conn.Name == "" {
+		return data, g.Error("Invalid Connection name: %s. Make sure it is created. See https://docs.slingdata.io/sling-cli/environment", name)
+	}
+	defer conn.Connection.Close()
+
+	switch {
+	case conn.Connection.Type.IsDb():
+		dbConn, err := conn.Connection.AsDatabase()
+		if err != nil {
+			return data, g.Error(err, "could not initialize database connection")
+		} else if err = dbConn.Connect(); err != nil {
+			return data, g.Error(err, "could not connect to %s", name)
+		}
+
+		table, err := database.ParseTableName(stream, dbConn.GetType())
+		if err != nil {
+			return data, g.Error(err, "could not parse stream: %s", stream)
+		}
+
+		ds, err := dbConn.StreamRows(table.Select(database.SelectOptions{Limit: limit}))
+		if err != nil {
+			return data, g.Error(err, "could not query %s", stream)
+		}
+		data, err = ds.Collect(limit)
+		if err != nil {
+			return data, g.Error(err, "could not read %s", stream)
+		}
+	case conn.Connection.Type.IsFile():
+		fs, err := conn.Connection.AsFile()
+		if err != nil {
+			return data, g.Error(err, "could not initialize file connection")
+		}
+
+		// paths are relative to the connection url
+		uri := stream
+		if !strings.Contains(stream, "://") {
+			uri = strings.TrimSuffix(conn.Connection.URL(), "/") + "/" + strings.TrimPrefix(stream, "/")
+			if conn.Connection.Type == dbio.TypeFileLocal {
+				uri = "file://" + stream
+			}
+		}
+
+		df, err := fs.ReadDataflow(filesys.NormalizeURI(fs, uri), iop.FileStreamConfig{Limit: limit})
+		if err != nil {
+			return data, g.Error(err, "could not read %s", uri)
+		}
+		data, err = iop.MergeDataflow(df).Collect(limit)
+		if err != nil {
+			return data, g.Error(err, "could not read %s", uri)
+		}
+	default:
+		return data, g.Error("cannot peek into a %s connection", conn.Connection.Type)
+	}
+
+	return data, nil
+}
+
+// TestAll tests all the connections concurrently, and returns the results
+// as table rows. The error lists the connections which failed.
+func (ce ConnEntries) TestAll() (fields []string, rows [][]any, err error) {
+	fields = []string{"Conn Name", "Conn Type", "Status", "Duration", "Error"}
+	rows = make([][]any, len(ce))
+
+	ctx := g.NewContext(context.Background(), 5)
+	for i, conn := range ce {
+		ctx.Wg.Read.Add()
+		go func(i int, conn ConnEntry) {
+			defer ctx.Wg.Read.Done()
+
+			start := time.Now()
+			_, err := ce.Test(conn.Name)
+			duration := time.Since(start).Round(10 * time.Millisecond).String()
+
+			if err != nil {
+				rows[i] = []any{conn.Name, conn.Description, "failed", duration, g.ErrMsgSimple(err)}
+			} else {
+				rows[i] = []any{conn.Name, conn.Description, "success", duration, ""}
+			}
+		}(i, conn)
+	}
+	ctx.Wg.Read.Wait()
+
+	failed := []string{}
+	for _, row := range rows {
+		if row[2] == "failed" {
+			failed = append(failed, cast.ToString(row[0]))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fields, rows, g.Error("%d of %d connections failed: %s", len(failed), len(rows), strings.Join(failed, ", "))
+	}
+	return fields, rows, nil
+}
+
 var (
 	localConns   ConnEntries
 	localConnsTs time.Time
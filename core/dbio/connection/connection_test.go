@@ -1,6 +1,8 @@
 package connection
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/flarco/g"
@@ -266,3 +268,31 @@ func TestQueryURL(t *testing.T) {
 	// println(url.QueryEscape(password))
 	_ = password
 }
+
+func TestConnectionPeek(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peek.csv")
+	os.WriteFile(path, []byte("id,name\n1,a\n2,b\n3,c\n"), 0644)
+
+	dbURL := "sqlite://" + filepath.Join(t.TempDir(), "peek.db")
+	dbConn, err := NewConnectionFromURL("PEEK_DB", dbURL)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	entries := ConnEntries{LocalFileConnEntry(), {Name: "PEEK_DB", Connection: dbConn}}
+
+	data, err := entries.Peek("LOCAL", path, 2)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"id", "name"}, data.GetFields())
+		assert.Len(t, data.Rows, 2)
+	}
+
+	data, err = entries.Peek("PEEK_DB", "select 1 as x union all select 2 union all select 3", 2)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"x"}, data.GetFields())
+		assert.Len(t, data.Rows, 2)
+	}
+
+	_, err = entries.Peek("MISSING", "t", 2)
+	assert.ErrorContains(t, err, "Invalid Connection name")
+}
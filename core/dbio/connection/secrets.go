@@ -0,0 +1,337 @@
+package connection
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/flarco/g"
+	"github.com/spf13/cast"
+	"golang.org/x/oauth2/google"
+)
+
+// SecretRef is a reference to a value in a secrets manager, such as
+// `vault://secret/db#password`. The fragment is the key to extract
+// when the secret is a JSON object (or a key-value secret in Vault).
+//
+//	vault://<mount>/<path>#<key>                  HashiCorp Vault (VAULT_ADDR, VAULT_TOKEN)
+//	aws-sm://<name or arn>?region=<region>#<key>  AWS Secrets Manager
+//	gcp-sm://<project>/<secret>[/<version>]#<key> GCP Secret Manager
+//	azure-kv://<vault>/<secret>[/<version>]#<key> Azure Key Vault
+type SecretRef struct {
+	Scheme string
+	Path   string
+	Query  url.Values
+	Key    string
+}
+
+// secretFetchers fetch the raw secret value, per scheme
+var secretFetchers = map[string]func(ctx context.Context, ref SecretRef) (string, error){
+	"vault":    fetchVaultSecret,
+	"aws-sm":   fetchAwsSecret,
+	"gcp-sm":   fetchGcpSecret,
+	"azure-kv": fetchAzureSecret,
+}
+
+// secretCache holds the fetched secrets (without key), for the process
+var secretCache sync.Map
+
+// ParseSecretRef parses a secret reference. Returns false if the value
+// is not a secret reference.
+func ParseSecretRef(val string) (ref SecretRef, ok bool) {
+	scheme, rest, found := strings.Cut(strings.TrimSpace(val), "://")
+	if _, known := secretFetchers[strings.ToLower(scheme)]; !found || !known || rest == "" {
+		return ref, false
+	}
+
+	ref.Scheme = strings.ToLower(scheme)
+	rest, ref.Key, _ = strings.Cut(rest, "#")
+	rest, query, _ := strings.Cut(rest, "?")
+	ref.Path = strings.Trim(rest, "/")
+	ref.Query, _ = url.ParseQuery(query)
+
+	return ref, ref.Path != ""
+}
+
+// String returns the reference without the key
+func (ref SecretRef) String() string {
+	s := ref.Scheme + "://" + ref.Path
+	if len(ref.Query) > 0 {
+		s = s + "?" + ref.Query.Encode()
+	}
+	return s
+}
+
+// Resolve fetches the secret (or uses the cached value), and extracts the key
+func (ref SecretRef) Resolve(ctx context.Context) (value string, err error) {
+	raw, cached := secretCache.Load(ref.String())
+	if !cached {
+		g.Debug("fetching secret %s", ref.String())
+		raw, err = secretFetchers[ref.Scheme](ctx, ref)
+		if err != nil {
+			return "", g.Error(err, "could not fetch secret %s", ref.String())
+		}
+		secretCache.Store(ref.String(), raw)
+	}
+
+	return ref.extract(cast.ToString(raw))
+}
+
+// extract returns the value of the key, if specified
+func (ref SecretRef) extract(raw string) (value string, err error) {
+	if ref.Key == "" && ref.Scheme != "vault" {
+		return raw, nil
+	}
+
+	data := map[string]any{}
+	if err = json.Unmarshal([]byte(raw), &data); err != nil {
+		return "", g.Error("secret %s is not a JSON object, cannot extract key `%s`", ref.String(), ref.Key)
+	}
+
+	// vault secrets are key-value, a single value is used if no key is specified
+	if ref.Key == "" && len(data) == 1 {
+		for key := range data {
+			ref.Key = key
+		}
+	} else if ref.Key == "" {
+		return "", g.Error("secret %s has %d keys, specify one with #<key>", ref.String(), len(data))
+	}
+
+	val, ok := data[ref.Key]
+	if !ok {
+		return "", g.Error("key `%s` not found in secret %s", ref.Key, ref.String())
+	}
+
+	if value, err = cast.ToStringE(val); err != nil {
+		value = g.Marshal(val) // in case it's an array or object
+	}
+	return value, nil
+}
+
+// setFromSecrets resolves the property values which reference a secret
+func (c *Connection) setFromSecrets() (err error) {
+	for k, v := range c.Data {
+		val, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		ref, ok := ParseSecretRef(val)
+		if !ok {
+			continue
+		}
+
+		ctx := context.Background()
+		if c.context != nil {
+			ctx = c.context.Ctx
+		}
+
+		if c.Data[k], err = ref.Resolve(ctx); err != nil {
+			return g.Error(err, "could not resolve property `%s`", k)
+		}
+	}
+	return nil
+}
+
+// secretHttpGet gets the body of an http request for a secret
+func secretHttpGet(ctx context.Context, uri string, headers map[string]string) (body []byte, status int, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, 0, g.Error(err, "could not create request")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, g.Error(err, "could not make request")
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, g.Error(err, "could not read response")
+	}
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return nil, resp.StatusCode, g.Error("request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return body, resp.StatusCode, nil
+}
+
+// fetchVaultSecret reads a secret from Vault, using the KV v2 engine
+// (`<mount>/data/<path>`), falling back to KV v1.
+func fetchVaultSecret(ctx context.Context, ref SecretRef) (raw string, err error) {
+	addr := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return "", g.Error("VAULT_ADDR is not set")
+	}
+
+	headers := map[string]string{"X-Vault-Token": os.Getenv("VAULT_TOKEN")}
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		headers["X-Vault-Namespace"] = ns
+	}
+
+	mount, path, _ := strings.Cut(ref.Path, "/")
+	body, status, err := secretHttpGet(ctx, g.F("%s/v1/%s/data/%s", addr, mount, path), headers)
+	if err != nil {
+		return "", err
+	}
+
+	var payload struct {
+		Data map[string]any `json:"data"`
+	}
+
+	if status == http.StatusNotFound {
+		// KV v1
+		body, status, err = secretHttpGet(ctx, g.F("%s/v1/%s", addr, ref.Path), headers)
+		if err != nil {
+			return "", err
+		} else if status == http.StatusNotFound {
+			return "", g.Error("secret not found in vault")
+		}
+		if err = json.Unmarshal(body, &payload); err != nil {
+			return "", g.Error(err, "could not parse vault response")
+		}
+	} else {
+		var v2 struct {
+			Data struct {
+				Data map[string]any `json:"data"`
+			} `json:"data"`
+		}
+		if err = json.Unmarshal(body, &v2); err != nil {
+			return "", g.Error(err, "could not parse vault response")
+		}
+		payload.Data = v2.Data.Data
+	}
+
+	return g.Marshal(payload.Data), nil
+}
+
+// fetchAwsSecret reads a secret from AWS Secrets Manager, using the
+// default credential chain.
+func fetchAwsSecret(ctx context.Context, ref SecretRef) (raw string, err error) {
+	awsConfig := aws.NewConfig()
+	if region := ref.Query.Get("region"); region != "" {
+		awsConfig.Region = aws.String(region)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *awsConfig,
+		SharedConfigState: session.SharedConfigEnable,
+		Profile:           ref.Query.Get("profile"),
+	})
+	if err != nil {
+		return "", g.Error(err, "could not create AWS session")
+	}
+
+	input := &secretsmanager.GetSecretValueInput{SecretId: aws.String(ref.Path)}
+	if version := ref.Query.Get("version"); version != "" {
+		input.VersionStage = aws.String(version)
+	}
+
+	output, err := secretsmanager.New(sess).GetSecretValueWithContext(ctx, input)
+	if err != nil {
+		return "", g.Error(err, "could not get secret value")
+	}
+
+	if output.SecretString != nil {
+		return *output.SecretString, nil
+	}
+	return string(output.SecretBinary), nil
+}
+
+// fetchGcpSecret reads a secret from GCP Secret Manager, using the
+// application default credentials.
+func fetchGcpSecret(ctx context.Context, ref SecretRef) (raw string, err error) {
+	parts := strings.Split(ref.Path, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", g.Error("expected gcp-sm://<project>/<secret>[/<version>]")
+	}
+	version := "latest"
+	if len(parts) == 3 {
+		version = parts[2]
+	}
+
+	ts, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return "", g.Error(err, "could not get GCP credentials")
+	}
+	token, err := ts.Token()
+	if err != nil {
+		return "", g.Error(err, "could not get GCP token")
+	}
+
+	uri := g.F("https://secretmanager.googleapis.com/v1/projects/%s/secrets/%s/versions/%s:access", parts[0], parts[1], version)
+	body, status, err := secretHttpGet(ctx, uri, map[string]string{"Authorization": "Bearer " + token.AccessToken})
+	if err != nil {
+		return "", err
+	} else if status == http.StatusNotFound {
+		return "", g.Error("secret not found")
+	}
+
+	var payload struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err = json.Unmarshal(body, &payload); err != nil {
+		return "", g.Error(err, "could not parse secret manager response")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload.Payload.Data)
+	if err != nil {
+		return "", g.Error(err, "could not decode secret payload")
+	}
+	return string(data), nil
+}
+
+// fetchAzureSecret reads a secret from Azure Key Vault, using the
+// default Azure credential chain.
+func fetchAzureSecret(ctx context.Context, ref SecretRef) (raw string, err error) {
+	parts := strings.Split(ref.Path, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", g.Error("expected azure-kv://<vault>/<secret>[/<version>]")
+	}
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return "", g.Error(err, "could not get Azure credentials")
+	}
+	token, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{"https://vault.azure.net/.default"}})
+	if err != nil {
+		return "", g.Error(err, "could not get Azure token")
+	}
+
+	uri := g.F("https://%s.vault.azure.net/secrets/%s", parts[0], strings.Join(parts[1:], "/"))
+	body, status, err := secretHttpGet(ctx, uri+"?api-version=7.4", map[string]string{"Authorization": "Bearer " + token.Token})
+	if err != nil {
+		return "", err
+	} else if status == http.StatusNotFound {
+		return "", g.Error("secret not found")
+	}
+
+	var payload struct {
+		Value string `json:"value"`
+	}
+	if err = json.Unmarshal(body, &payload); err != nil {
+		return "", g.Error(err, "could not parse key vault response")
+	}
+	return payload.Value, nil
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestBigQueryStorageWriteEncode(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.IntegerFieldType},
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "amount", Type: bigquery.NumericFieldType},
+		{Name: "rate", Type: bigquery.FloatFieldType},
+		{Name: "active", Type: bigquery.BooleanFieldType},
+		{Name: "birth_date", Type: bigquery.DateFieldType},
+		{Name: "updated_at", Type: bigquery.TimestampFieldType},
+		{Name: "local_dt", Type: bigquery.DateTimeFieldType},
+	}
+
+	sws, err := newStorageWriteSchema(schema)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("sling_row.proto"),
+		Syntax:      proto.String("proto2"),
+		MessageType: []*descriptorpb.DescriptorProto{sws.descriptor},
+	}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	md := fd.Messages().Get(0)
+
+	ts := time.Date(2024, 3, 15, 10, 30, 0, 123000, time.UTC)
+	columns := iop.NewColumnsFromFields("ID", "name", "amount", "rate", "active", "birth_date", "updated_at", "local_dt", "extra")
+	row := []any{int64(-5), "hello", "12.345", 1.5, true, ts, ts, ts, "ignored"}
+
+	b, err := sws.encodeRow(columns, row)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	g.AssertNoError(t, proto.Unmarshal(b, msg))
+
+	get := func(name string) any {
+		return msg.Get(md.Fields().ByName(protoreflect.Name(name))).Interface()
+	}
+	assert.EqualValues(t, -5, get("id"))
+	assert.Equal(t, "hello", get("name"))
+	assert.Equal(t, "12.345", get("amount"))
+	assert.Equal(t, 1.5, get("rate"))
+	assert.Equal(t, true, get("active"))
+	assert.EqualValues(t, 19797, get("birth_date"))
+	assert.EqualValues(t, ts.UnixMicro(), get("updated_at"))
+	assert.Equal(t, "2024-03-15 10:30:00.000123", get("local_dt"))
+
+	// nulls are omitted
+	b, err = sws.encodeRow(columns, []any{int64(1), nil})
+	g.AssertNoError(t, err)
+	msg = dynamicpb.NewMessage(md)
+	g.AssertNoError(t, proto.Unmarshal(b, msg))
+	assert.False(t, msg.Has(md.Fields().ByName("name")))
+
+	// repeated / record columns are not supported
+	_, err = newStorageWriteSchema(bigquery.Schema{{Name: "tags", Type: bigquery.StringFieldType, Repeated: true}})
+	assert.Error(t, err)
+}
@@ -5,12 +5,15 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"database/sql"
+	"errors"
 	"fmt"
 	"math"
 	"net/url"
 	"os"
 	"path"
+	"regexp"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -37,6 +40,7 @@ import (
 	_ "github.com/flarco/bigquery"
 	// _ "github.com/solcates/go-sql-bigquery"
 	"github.com/spf13/cast"
+	"gopkg.in/yaml.v2"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -64,6 +68,7 @@ type Connection interface {
 	BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error)
 	CastColumnForSelect(srcColumn iop.Column, tgtColumn iop.Column) string
 	CastColumnsForSelect(srcColumns iop.Columns, tgtColumns iop.Columns) []string
+	ChecksumExpr(col iop.Column, colName string) string
 	Close() error
 	Commit() error
 	CompareChecksums(tableName string, columns iop.Columns) (err error)
@@ -122,6 +127,7 @@ type Connection interface {
 	Query(sql string, options ...map[string]interface{}) (iop.Dataset, error)
 	QueryContext(ctx context.Context, sql string, options ...map[string]interface{}) (iop.Dataset, error)
 	Quote(field string, normalize ...bool) string
+	QuoteNames(names ...string) []string
 	RenameTable(table string, newTable string) (err error)
 	Rollback() error
 	RunAnalysis(string, map[string]interface{}) (iop.Dataset, error)
@@ -167,6 +173,7 @@ type BaseConn struct {
 	template    dbio.Template
 	schemata    Schemata
 	properties  map[string]string
+	planned     map[string]iop.Columns // columns of the planned tables (dry run)
 	sshClient   *iop.SSHClient
 	Log         []string
 }
@@ -208,6 +215,20 @@ func init() {
 
 }
 
+// TempCloudFolder returns the folder of the temporary files in cloud storage,
+// used for staging: the `temp_cloud_folder` property value of the connection
+// if provided, else SLING_TEMP_CLOUD_FOLDER
+func TempCloudFolder(propValue string) string {
+	if folder := strings.Trim(propValue, "/"); folder != "" {
+		return folder
+	}
+	return tempCloudStorageFolder
+}
+
+func (conn *BaseConn) tempCloudFolder() string {
+	return TempCloudFolder(conn.GetProp("temp_cloud_folder"))
+}
+
 // NewConn return the most proper connection for a given database
 func NewConn(URL string, props ...string) (Connection, error) {
 	return NewConnContext(context.Background(), URL, props...)
@@ -261,8 +282,18 @@ func NewConnContext(ctx context.Context, URL string, props ...string) (Connectio
 		}
 	} else if strings.HasPrefix(URL, "redshift") {
 		conn = &RedshiftConn{URL: URL}
+	} else if strings.HasPrefix(URL, "greenplum") {
+		conn = &GreenplumConn{PostgresConn: PostgresConn{URL: URL}}
+	} else if strings.HasPrefix(URL, "vertica") {
+		conn = &VerticaConn{URL: URL}
 	} else if strings.HasPrefix(URL, "trino") {
 		conn = &TrinoConn{URL: URL}
+	} else if strings.HasPrefix(URL, "databricks") {
+		conn = &DatabricksConn{URL: URL}
+	} else if strings.HasPrefix(URL, "teradata") {
+		conn = &TeradataConn{URL: URL}
+	} else if strings.HasPrefix(URL, "firebolt") {
+		conn = &FireboltConn{URL: URL}
 	} else if strings.HasPrefix(URL, "sqlserver:") {
 		conn = &MsSQLServerConn{URL: URL}
 	} else if strings.HasPrefix(URL, "starrocks:") {
@@ -275,7 +306,15 @@ func NewConnContext(ctx context.Context, URL string, props ...string) (Connectio
 		conn = &ElasticsearchConn{URL: URL}
 	} else if strings.HasPrefix(URL, "prometheus") {
 		conn = &PrometheusConn{URL: URL}
-	} else if strings.HasPrefix(URL, "mariadb:") {
+	} else if strings.HasPrefix(URL, "influxdb") {
+		conn = &InfluxDBConn{URL: URL}
+	} else if strings.HasPrefix(URL, "neo4j") {
+		conn = &Neo4jConn{URL: URL}
+	} else if strings.HasPrefix(URL, "stripe:") || strings.HasPrefix(URL, "shopify:") || strings.HasPrefix(URL, "hubspot:") {
+		conn = &SaaSConn{URL: URL}
+	} else if strings.HasPrefix(URL, "plugin:") {
+		conn = &PluginConn{URL: URL}
+	} else if strings.HasPrefix(URL, "mariadb:") || strings.HasPrefix(URL, "singlestore:") || strings.HasPrefix(URL, "tidb:") {
 		conn = &MySQLConn{URL: URL}
 	} else if strings.HasPrefix(URL, "oracle:") {
 		conn = &OracleConn{URL: URL}
@@ -335,9 +374,9 @@ func NewConnContext(ctx context.Context, URL string, props ...string) (Connectio
 func getDriverName(conn Connection) (driverName string) {
 	dbType := conn.GetType()
 	switch dbType {
-	case dbio.TypeDbPostgres, dbio.TypeDbRedshift:
+	case dbio.TypeDbPostgres, dbio.TypeDbGreenplum, dbio.TypeDbRedshift:
 		driverName = "postgres"
-	case dbio.TypeDbMySQL, dbio.TypeDbMariaDB, dbio.TypeDbStarRocks:
+	case dbio.TypeDbMySQL, dbio.TypeDbMariaDB, dbio.TypeDbSingleStore, dbio.TypeDbTiDB, dbio.TypeDbStarRocks:
 		driverName = "mysql"
 	case dbio.TypeDbOracle:
 		driverName = "oracle"
@@ -369,7 +408,7 @@ func getDriverName(conn Connection) (driverName string) {
 
 func getDialector(conn Connection) (driverDialector gorm.Dialector) {
 	switch conn.GetType() {
-	case dbio.TypeDbPostgres, dbio.TypeDbRedshift:
+	case dbio.TypeDbPostgres, dbio.TypeDbGreenplum, dbio.TypeDbRedshift:
 		driverDialector = postgres.Open(conn.Self().BaseURL())
 	case dbio.TypeDbSQLite:
 		driverDialector = sqlite.Open(conn.Self().GetURL())
@@ -397,6 +436,45 @@ func (conn *BaseConn) ConnString() string {
 	return conn.URL
 }
 
+// timeoutContext returns the context with the timeout of the connection
+// property `key` (query_timeout for source queries, statement_timeout for
+// target statements), in seconds
+func (conn *BaseConn) timeoutContext(ctx context.Context, key string) (context.Context, context.CancelFunc) {
+	if timeout := conn.timeout(key); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return ctx, func() {}
+}
+
+func (conn *BaseConn) timeout(key string) time.Duration {
+	timeout := time.Duration(cast.ToInt64(conn.GetProp(key))) * time.Second
+	if conn.Type == dbio.TypeDbTrino && key == "query_timeout" {
+		timeout = timeout * 60 // trino query_timeout property is in minutes
+	}
+	return timeout
+}
+
+// serverTimeout returns the lowest of the query and statement timeouts,
+// for the server-side session settings
+func (conn *BaseConn) serverTimeout() (timeout time.Duration) {
+	for _, key := range []string{"query_timeout", "statement_timeout"} {
+		if val := conn.timeout(key); val > 0 && (timeout == 0 || val < timeout) {
+			timeout = val
+		}
+	}
+	return timeout
+}
+
+// timeoutError returns a clear error when the query was cancelled by the
+// timeout of the connection property `key`, otherwise the original error
+// (e.g. the deadline of the calling context)
+func (conn *BaseConn) timeoutError(ctx context.Context, key string, err error) error {
+	if conn.timeout(key) > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return g.Error("query cancelled after exceeding the %s of %s", key, conn.timeout(key))
+	}
+	return err
+}
+
 // GetURL returns the processed URL
 func (conn *BaseConn) GetURL(newURL ...string) string {
 	if len(newURL) > 0 {
@@ -659,10 +737,14 @@ func (conn *BaseConn) Connect(timeOut ...int) (err error) {
 			if err != nil {
 				msg := ""
 				switch conn.Type {
-				case dbio.TypeDbPostgres, dbio.TypeDbRedshift:
+				case dbio.TypeDbPostgres, dbio.TypeDbGreenplum, dbio.TypeDbRedshift:
 					if val := conn.GetProp("sslmode"); !strings.EqualFold(val, "require") {
 						msg = " (try adding `sslmode=require` or `sslmode=disable`)"
 					}
+				case dbio.TypeDbVertica:
+					if val := conn.GetProp("tlsmode"); val == "" || strings.EqualFold(val, "none") {
+						msg = " (try adding `tlsmode=server` or `tlsmode=server-strict`)"
+					}
 				case dbio.TypeDbSnowflake:
 					if strings.Contains(err.Error(), "000605") {
 						// retry, snowflake server-side error
@@ -759,12 +841,30 @@ func (conn *BaseConn) GetGormConn(config *gorm.Config) (*gorm.DB, error) {
 
 // GetTemplateValue returns the value of the path
 func (conn *BaseConn) GetTemplateValue(path string) (value string) {
-	return conn.Type.GetTemplateValue(path)
+	if conn.template.Core == nil {
+		return conn.Type.GetTemplateValue(path)
+	}
+	return conn.template.Value(path)
 }
 
-// LoadTemplates loads the appropriate yaml template
+// LoadTemplates loads the appropriate yaml template, with the overrides of
+// the `templates` property (e.g. `{"core.insert": "..."}`)
 func (conn *BaseConn) LoadTemplates() (err error) {
 	conn.template, err = conn.Type.Template()
+	if err != nil {
+		return
+	}
+
+	if val := conn.GetProp("templates"); val != "" {
+		overrides := map[string]any{}
+		if err = yaml.Unmarshal([]byte(val), &overrides); err != nil {
+			return g.Error(err, "could not parse templates property")
+		}
+		conn.template = conn.template.Clone()
+		if err = conn.template.Override(overrides); err != nil {
+			return g.Error(err, "invalid templates property")
+		}
+	}
 	return
 }
 
@@ -820,7 +920,8 @@ func (conn *BaseConn) StreamRowsContext(ctx context.Context, query string, optio
 		return ds, g.Error("Empty Query")
 	}
 
-	queryContext := g.NewContext(ctx)
+	timeoutCtx, cancelTimeout := conn.timeoutContext(ctx, "query_timeout")
+	queryContext := g.NewContext(timeoutCtx)
 
 	conn.LogSQL(query)
 	var result *sqlx.Rows
@@ -834,7 +935,11 @@ func (conn *BaseConn) StreamRowsContext(ctx context.Context, query string, optio
 		// for clickhouse
 		err = nil
 	} else if err != nil {
+		defer cancelTimeout()
 		queryContext.Cancel()
+		if err := conn.timeoutError(timeoutCtx, "query_timeout", nil); err != nil {
+			return ds, err
+		}
 		if strings.Contains(query, noDebugKey) && !g.IsDebugLow() {
 			return ds, g.Error(err, "SQL Error")
 		}
@@ -846,6 +951,7 @@ func (conn *BaseConn) StreamRowsContext(ctx context.Context, query string, optio
 		dbColTypes, err := getColumnTypes(result)
 		if err != nil {
 			queryContext.Cancel()
+			cancelTimeout()
 			return ds, g.Error(err, "could not get column types")
 		}
 
@@ -921,7 +1027,7 @@ func (conn *BaseConn) StreamRowsContext(ctx context.Context, query string, optio
 
 		// Check for context cancellation when Next() returns false
 		if ctxErr := queryContext.Ctx.Err(); ctxErr != nil {
-			it.Context.CaptureErr(g.Error(ctxErr, "query context canceled"))
+			it.Context.CaptureErr(conn.timeoutError(timeoutCtx, "query_timeout", g.Error(ctxErr, "query context canceled")))
 		} else if err = result.Err(); err != nil {
 			// Double check result.Err() in case error occurred between previous check
 			it.Context.CaptureErr(g.Error(err, "error after row iteration"))
@@ -932,13 +1038,18 @@ func (conn *BaseConn) StreamRowsContext(ctx context.Context, query string, optio
 	}
 
 	ds = iop.NewDatastreamIt(queryContext.Ctx, conn.Data.Columns, nextFunc)
+	ds.Defer(cancelTimeout)
 	ds.NoDebug = strings.Contains(query, noDebugKey)
 	ds.Inferred = !InferDBStream && ds.Columns.Sourced()
 	if !ds.NoDebug {
 		// don't set metadata for internal queries
 		ds.SetMetadata(conn.GetProp("METADATA"))
 		conn.setTransforms(ds.Columns)
-		ds.SetConfig(conn.Props())
+		if err = ds.SetConfig(conn.Props()); err != nil {
+			result.Close()
+			queryContext.Cancel()
+			return ds, err
+		}
 	}
 
 	err = ds.Start()
@@ -1142,6 +1253,9 @@ func (conn *BaseConn) ExecContext(ctx context.Context, q string, args ...interfa
 		return
 	}
 
+	ctx, cancel := conn.timeoutContext(ctx, "statement_timeout")
+	defer cancel()
+
 	if conn.tx != nil {
 		result, err = conn.tx.ExecContext(ctx, q, args...)
 		q = q + noDebugKey // just to not show twice the sql in error since tx does
@@ -1152,7 +1266,9 @@ func (conn *BaseConn) ExecContext(ctx context.Context, q string, args ...interfa
 		err = g.Error("no connection instance")
 	}
 	if err != nil {
-		if strings.Contains(q, noDebugKey) {
+		if tErr := conn.timeoutError(ctx, "statement_timeout", nil); tErr != nil {
+			err = tErr
+		} else if strings.Contains(q, noDebugKey) {
 			err = g.Error(err, "Error executing query [tx: %t]", conn.tx != nil)
 		} else {
 			err = g.Error(err, "Error executing [tx: %t] %s", conn.tx != nil, env.Clean(conn.Props(), q))
@@ -1286,6 +1402,24 @@ func (conn *BaseConn) GetCount(tableFName string) (uint64, error) {
 	return cast.ToUint64(data.Rows[0][0]), nil
 }
 
+// GetCountEstimate returns the estimated count of records of a table, from
+// the table statistics when available (template row_count_estimates),
+// otherwise with a count query
+func GetCountEstimate(conn Connection, table Table) (uint64, error) {
+	if _, ok := conn.Template().Metadata["row_count_estimates"]; ok {
+		values := g.M("schema", table.Schema, "table", table.Name)
+		data, err := conn.SubmitTemplate("single", conn.Template().Metadata, "row_count_estimates", values)
+		if err != nil {
+			g.Debug("could not get row count estimate for %s: %s", table.FullName(), err.Error())
+		} else if records := data.Records(); len(records) > 0 {
+			if cnt := cast.ToFloat64(records[0]["count"]); cnt >= 0 {
+				return uint64(cnt), nil // not analyzed if negative
+			}
+		}
+	}
+	return conn.GetCount(table.FullName())
+}
+
 // GetSchemas returns schemas
 func (conn *BaseConn) GetSchemas() (iop.Dataset, error) {
 	// fields: [schema_name]
@@ -1416,7 +1550,7 @@ func SQLColumns(colTypes []ColumnType, conn Connection) (columns iop.Columns) {
 		}
 
 		if colType.IsSourced() || col.Sourced {
-			if col.IsString() && g.In(conn.GetType(), dbio.TypeDbSQLServer, dbio.TypeDbSnowflake, dbio.TypeDbOracle, dbio.TypeDbPostgres, dbio.TypeDbRedshift) {
+			if col.IsString() && g.In(conn.GetType(), dbio.TypeDbSQLServer, dbio.TypeDbSnowflake, dbio.TypeDbOracle, dbio.TypeDbPostgres, dbio.TypeDbGreenplum, dbio.TypeDbRedshift) {
 				col.Sourced = true
 				col.DbPrecision = colType.Length
 			}
@@ -1428,6 +1562,16 @@ func SQLColumns(colTypes []ColumnType, conn Connection) (columns iop.Columns) {
 				col.Stats.MaxDecLen = lo.Ternary(colType.Scale > ddlMinDecScale, colType.Scale, ddlMinDecScale)
 			}
 
+			// keep the declared precision & scale of decimals (e.g. numeric(38,10)),
+			// for the target DDL and file formats
+			declared := colType.Precision > 0 && colType.Scale >= 0 && colType.Scale <= colType.Precision
+			if col.Type == iop.DecimalType && declared && g.In(conn.GetType(), dbio.TypeDbPostgres, dbio.TypeDbGreenplum, dbio.TypeDbRedshift, dbio.TypeDbVertica, dbio.TypeDbClickhouse, dbio.TypeDbAzure, dbio.TypeDbTrino) {
+				col.Sourced = true
+				col.DbPrecision = colType.Precision
+				col.DbScale = colType.Scale
+				col.Stats.MaxDecLen = lo.Ternary(colType.Scale > ddlMinDecScale, colType.Scale, ddlMinDecScale)
+			}
+
 			if g.In(conn.GetType(), dbio.TypeDbMySQL) {
 				// TODO: cannot use sourced length/scale, unreliable.
 				col.DbPrecision = 0
@@ -1484,7 +1628,7 @@ func (conn *BaseConn) GetSQLColumns(table Table) (columns iop.Columns, err error
 // TableExists returns true if the table exists
 func TableExists(conn Connection, tableFName string) (exists bool, err error) {
 
-	table, err := ParseTableName(tableFName, conn.GetType())
+	table, err := ParseConnTableName(tableFName, conn)
 	if err != nil {
 		return false, g.Error(err, "could not parse table name: "+tableFName)
 	}
@@ -1591,19 +1735,38 @@ func (conn *BaseConn) GetTableColumns(table *Table, fields ...string) (columns i
 }
 
 func (conn *BaseConn) GetColumns(tableFName string, fields ...string) (columns iop.Columns, err error) {
-	table, err := ParseTableName(tableFName, conn.Type)
+	table, err := ParseConnTableName(tableFName, conn.Self())
 	if err != nil {
 		return columns, g.Error(err, "could not parse table name: "+tableFName)
 	}
 
+	if cols, ok := conn.planned[strings.ToLower(table.FullName())]; ok {
+		return cols.Clone(), nil
+	}
+
 	return conn.Self().GetTableColumns(&table, fields...)
 }
 
+// SetPlannedColumns sets the columns of a table which is not created yet,
+// returned by GetColumns, to generate the statements of a dry run
+func (conn *BaseConn) SetPlannedColumns(tableFName string, columns iop.Columns) (err error) {
+	table, err := ParseConnTableName(tableFName, conn.Self())
+	if err != nil {
+		return g.Error(err, "could not parse table name: "+tableFName)
+	}
+
+	if conn.planned == nil {
+		conn.planned = map[string]iop.Columns{}
+	}
+	conn.planned[strings.ToLower(table.FullName())] = columns.Clone()
+	return nil
+}
+
 // GetColumnsFull returns columns for given table. `tableName` should
 // include schema and table, example: `schema1.table2`
 // fields should be `schema_name|table_name|table_type|column_name|data_type|column_id`
 func (conn *BaseConn) GetColumnsFull(tableFName string) (iop.Dataset, error) {
-	table, err := ParseTableName(tableFName, conn.Type)
+	table, err := ParseConnTableName(tableFName, conn.Self())
 	if err != nil {
 		return iop.Dataset{}, g.Error(err, "could not parse table name: "+tableFName)
 	}
@@ -1616,7 +1779,7 @@ func (conn *BaseConn) GetColumnsFull(tableFName string) (iop.Dataset, error) {
 
 // GetPrimaryKeys returns primark keys for given table.
 func (conn *BaseConn) GetPrimaryKeys(tableFName string) (iop.Dataset, error) {
-	table, err := ParseTableName(tableFName, conn.Type)
+	table, err := ParseConnTableName(tableFName, conn.Self())
 	if err != nil {
 		return iop.Dataset{}, g.Error(err, "could not parse table name: "+tableFName)
 	}
@@ -1627,9 +1790,106 @@ func (conn *BaseConn) GetPrimaryKeys(tableFName string) (iop.Dataset, error) {
 	)
 }
 
+// LoadColumnDetails sets the comments (as description), NOT NULL flags and
+// primary key columns of the table from the database metadata, when available
+func LoadColumnDetails(conn Connection, table Table, columns iop.Columns) (err error) {
+	colIndex := map[string]int{}
+	for i, col := range columns {
+		colIndex[strings.ToLower(col.Name)] = i
+	}
+	getColumn := func(name string) *iop.Column {
+		if i, ok := colIndex[strings.ToLower(name)]; ok {
+			return &columns[i]
+		}
+		return nil
+	}
+
+	values := g.M("schema", table.Schema, "table", table.Name)
+	if _, ok := conn.Template().Metadata["column_details"]; ok {
+		data, err := conn.SubmitTemplate("single", conn.Template().Metadata, "column_details", values)
+		if err != nil {
+			return g.Error(err, "could not get column details for %s", table.FullName())
+		}
+
+		for _, rec := range data.Records() {
+			col := getColumn(cast.ToString(rec["column_name"]))
+			if col == nil {
+				continue
+			}
+			if comment := cast.ToString(rec["comment"]); comment != "" {
+				col.Description = comment
+			}
+			nullable := strings.ToLower(cast.ToString(rec["is_nullable"]))
+			if g.In(nullable, "no", "n", "false", "0") {
+				col.SetMetadata("not_null", "true")
+			}
+		}
+	} else {
+		g.Debug("column details are not supported for %s", conn.GetType())
+	}
+
+	if _, ok := conn.Template().Metadata["primary_keys"]; ok {
+		data, err := conn.SubmitTemplate("single", conn.Template().Metadata, "primary_keys", values)
+		if err != nil {
+			return g.Error(err, "could not get primary keys for %s", table.FullName())
+		}
+
+		for _, rec := range data.Records() {
+			if col := getColumn(cast.ToString(rec["column_name"])); col != nil {
+				col.SetMetadata(iop.PrimaryKey.MetadataKey(), "source")
+			}
+		}
+	}
+
+	return nil
+}
+
+// CommentColumns sets the column comments of the table from the column descriptions
+func CommentColumns(conn Connection, table Table, columns iop.Columns) (err error) {
+	template := conn.GetTemplateValue("core.comment_column")
+	if template == "" {
+		g.Debug("column comments are not supported for %s", conn.GetType())
+		return nil
+	}
+
+	sqls := []string{}
+	for _, col := range columns {
+		if col.Description == "" {
+			continue
+		}
+
+		nativeType, err := conn.GetNativeType(col)
+		if err != nil {
+			return g.Error(err, "no native mapping for column %s", col.Name)
+		} else if col.IsNotNull() {
+			nativeType = nativeType + " not null"
+		}
+
+		sqls = append(sqls, g.R(
+			template,
+			"table", table.FullName(),
+			"column", conn.Quote(col.Name),
+			"type", nativeType,
+			"value", "'"+strings.ReplaceAll(col.Description, "'", "''")+"'",
+			"schema_name", table.Schema,
+			"table_name", table.Name,
+			"column_name", col.Name,
+		))
+	}
+
+	if len(sqls) == 0 {
+		return nil
+	}
+
+	if _, err = conn.ExecMulti(sqls...); err != nil {
+		return g.Error(err, "could not set column comments for %s", table.FullName())
+	}
+	return nil
+}
+
 // GetIndexes returns indexes for given table.
 func (conn *BaseConn) GetIndexes(tableFName string) (iop.Dataset, error) {
-	table, err := ParseTableName(tableFName, conn.Type)
+	table, err := ParseConnTableName(tableFName, conn.Self())
 	if err != nil {
 		return iop.Dataset{}, g.Error(err, "could not parse table name: "+tableFName)
 	}
@@ -1643,7 +1903,7 @@ func (conn *BaseConn) GetIndexes(tableFName string) (iop.Dataset, error) {
 // GetDDL returns DDL for given table.
 func (conn *BaseConn) GetDDL(tableFName string) (string, error) {
 
-	table, err := ParseTableName(tableFName, conn.Type)
+	table, err := ParseConnTableName(tableFName, conn.Self())
 	if err != nil {
 		return "", g.Error(err, "could not parse table name: "+tableFName)
 	}
@@ -1682,7 +1942,7 @@ func (conn *BaseConn) GetDDL(tableFName string) (string, error) {
 
 // CreateTemporaryTable creates a temp table based on provided columns
 func (conn *BaseConn) CreateTemporaryTable(tableName string, cols iop.Columns) (err error) {
-	table, err := ParseTableName(tableName, conn.Type)
+	table, err := ParseConnTableName(tableName, conn.Self())
 	if err != nil {
 		return g.Error(err, "Could not parse table name: "+tableName)
 	}
@@ -1714,7 +1974,7 @@ func (conn *BaseConn) CreateTable(tableName string, cols iop.Columns, tableDDL s
 		return nil
 	}
 
-	table, err := ParseTableName(tableName, conn.Type)
+	table, err := ParseConnTableName(tableName, conn.Self())
 	if err != nil {
 		return g.Error(err, "Could not parse table name: "+tableName)
 	}
@@ -1929,7 +2189,7 @@ func (conn *BaseConn) ProcessTemplate(level, text string, values map[string]inte
 			// get all columns then
 			var table Table
 			tableFName := g.F("%s.%s", values["schema"], values["table"])
-			table, err = ParseTableName(tableFName, conn.GetType())
+			table, err = ParseConnTableName(tableFName, conn.Self())
 			if err != nil {
 				err = g.Error(err, "could not parse table name")
 				return
@@ -1969,7 +2229,7 @@ func (conn *BaseConn) ProcessTemplate(level, text string, values map[string]inte
 			err = g.Error("missing 'tables' key")
 		} else {
 			for _, tableFName := range cast.ToStringSlice(tableFNames) {
-				table, err := ParseTableName(tableFName, conn.Type)
+				table, err := ParseConnTableName(tableFName, conn.Self())
 				if err != nil {
 					return "", g.Error(err, "could not parse table name: "+tableFName)
 				}
@@ -2159,7 +2419,18 @@ func (conn *BaseConn) Unquote(field string) string {
 
 // Quote adds quotes to the field name
 func (conn *BaseConn) Quote(field string, normalize ...bool) string {
-	return conn.Type.Quote(field, normalize...)
+	return conn.Type.QuoteWith(GetIdentifierQuoting(conn), field, normalize...)
+}
+
+// QuoteNames adds quotes to the field names
+func (conn *BaseConn) QuoteNames(names ...string) []string {
+	return lo.Map(names, func(name string, i int) string { return conn.Quote(name) })
+}
+
+// GetIdentifierQuoting returns the quoting policy of the identifiers of the
+// connection, from the `identifier_quoting` property (blank for the default)
+func GetIdentifierQuoting(conn interface{ GetProp(...string) string }) dbio.IdentifierQuoting {
+	return dbio.IdentifierQuoting(conn.GetProp("identifier_quoting"))
 }
 
 // GenerateInsertStatement returns the proper INSERT statement
@@ -2293,6 +2564,11 @@ func (conn *BaseConn) GenerateDDL(table Table, data iop.Dataset, temporary bool)
 
 		// normalize column name uppercase/lowercase
 		columnDDL := conn.Self().Quote(col.Name) + " " + nativeType
+		if col.IsNotNull() && !temporary && !g.In(conn.GetType(), dbio.TypeDbClickhouse, dbio.TypeDbProton) {
+			columnDDL = columnDDL + " not null"
+		} else if conn.GetType() == dbio.TypeDbFirebolt {
+			columnDDL = columnDDL + " null" // firebolt columns are not nullable by default
+		}
 		columnsDDL = append(columnsDDL, columnDDL)
 	}
 
@@ -2400,6 +2676,61 @@ func (conn *BaseConn) BulkExportFlow(table Table) (df *iop.Dataflow, err error)
 	return df, nil
 }
 
+// BulkExportFlowParallel creates a dataflow from multiple tables or queries,
+// reading up to `concurrency` of them at the same time (output will not be in order)
+func BulkExportFlowParallel(conn Connection, tables []Table, concurrency int) (df *iop.Dataflow, err error) {
+	if concurrency <= 0 || concurrency > len(tables) {
+		concurrency = len(tables)
+	}
+
+	df = iop.NewDataflowContext(conn.Context().Ctx)
+	dsCh := make(chan *iop.Datastream)
+
+	go func() {
+		defer close(dsCh)
+
+		exportCtx := g.NewContext(conn.Context().Ctx, concurrency)
+		for _, table := range tables {
+			// a slot is held until the datastream is fully read
+			exportCtx.Wg.Read.Add()
+			if df.Err() != nil {
+				exportCtx.Wg.Read.Done()
+				break
+			}
+
+			g.Debug("reading partition: %s", table.SQL)
+			go func(table Table) {
+				ds, err := conn.Self().BulkExportStream(table)
+				if err != nil {
+					exportCtx.Wg.Read.Done()
+					df.Context.CaptureErr(g.Error(err, "Error running query"))
+					df.Context.Cancel()
+					return
+				}
+				ds.Defer(func() { exportCtx.Wg.Read.Done() })
+
+				select {
+				case dsCh <- ds:
+				case <-df.Context.Ctx.Done():
+					ds.Close()
+				}
+			}(table)
+		}
+		exportCtx.Wg.Read.Wait()
+	}()
+
+	go df.PushStreamChan(dsCh)
+
+	// wait for first ds to start streaming.
+	// columns need to be populated
+	err = df.WaitReady()
+	if err != nil {
+		return df, g.Error(err)
+	}
+
+	return df, nil
+}
+
 // BulkExportFlowCSV creates a dataflow from a sql query, using CSVs
 func (conn *BaseConn) BulkExportFlowCSV(table Table) (df *iop.Dataflow, err error) {
 
@@ -2503,6 +2834,10 @@ func (conn *BaseConn) GenerateUpsertSQL(srcTable string, tgtTable string, pkFiel
 		return "", g.Error("Did not find upsert in template for %s", conn.GetType())
 	}
 
+	if upsertMap["preserve_set_fields"] != "" && !strings.Contains(sqlTemplate, "{set_fields}") {
+		return "", g.Error("update_columns / ignore_update_columns are not supported for %s", conn.GetType())
+	}
+
 	sql = g.R(
 		sqlTemplate,
 		"src_table", srcTable,
@@ -2518,6 +2853,31 @@ func (conn *BaseConn) GenerateUpsertSQL(srcTable string, tgtTable string, pkFiel
 	return
 }
 
+// GenerateMergeSQL renders a user-provided merge template (the `merge_sql`
+// property) instead of the generated upsert. The placeholders are the table
+// names ({temp_table} / {src_table}, {target_table} / {tgt_table}) and the
+// upsert expressions ({pk_fields}, {set_fields}, {insert_fields}, {src_fields},
+// {tgt_fields}, {src_tgt_pk_equal}...).
+func (conn *BaseConn) GenerateMergeSQL(template, srcTable, tgtTable string, pkFields []string) (sql string, err error) {
+	upsertMap, err := conn.GenerateUpsertExpressions(srcTable, tgtTable, pkFields)
+	if err != nil {
+		err = g.Error(err, "could not generate upsert variables")
+		return
+	}
+
+	values := []string{
+		"src_table", srcTable,
+		"tgt_table", tgtTable,
+		"temp_table", srcTable,
+		"target_table", tgtTable,
+	}
+	for key, value := range upsertMap {
+		values = append(values, key, value)
+	}
+
+	return g.R(template, values...), nil
+}
+
 // GenerateUpsertExpressions returns a map with needed expressions
 func (conn *BaseConn) GenerateUpsertExpressions(srcTable string, tgtTable string, pkFields []string) (exprs map[string]string, err error) {
 
@@ -2547,14 +2907,28 @@ func (conn *BaseConn) GenerateUpsertExpressions(srcTable string, tgtTable string
 		pkFieldMap[pkField] = ""
 	}
 
+	// with the ignore policy, columns missing in the target are not merged
+	if strings.EqualFold(conn.GetProp("column_changes"), "ignore") {
+		srcColumns = lo.Filter(srcColumns, func(col iop.Column, i int) bool {
+			return tgtColumns.GetColumn(col.Name) != nil
+		})
+	}
+
 	cols, err := conn.ValidateColumnNames(tgtColumns, srcColumns.Names(), false)
 	if err != nil {
 		err = g.Error(err, "columns mismatch")
 		return
 	}
 
-	tgtFields := conn.Type.QuoteNames(cols.Names()...)
+	isUpdateColumn, err := conn.getUpdateColumnsFilter(tgtColumns)
+	if err != nil {
+		err = g.Error(err, "invalid update columns")
+		return
+	}
+
+	tgtFields := conn.QuoteNames(cols.Names()...)
 	setFields := []string{}
+	preserveSetFields := []string{}
 	insertFields := []string{}
 	placeholderFields := []string{}
 	for _, srcColName := range cols.Names() {
@@ -2571,35 +2945,100 @@ func (conn *BaseConn) GenerateUpsertExpressions(srcTable string, tgtTable string
 
 		phExpr := strings.ReplaceAll(colExpr, colNameQ, g.F("ph.%s", colNameQ))
 		placeholderFields = append(placeholderFields, phExpr)
-		if _, ok := pkFieldMap[colNameQ]; !ok {
-			// is not a pk field
-			setSrcExpr := strings.ReplaceAll(colExpr, colNameQ, g.F("src.%s", colNameQ))
-			setField := g.F("%s = %s", colNameQ, setSrcExpr)
-			setFields = append(setFields, setField)
+		if _, ok := pkFieldMap[colNameQ]; ok {
+			continue // is a pk field
+		} else if !isUpdateColumn(colNameQ) {
+			// keep the target value, for delete/insert upserts
+			preserveSetFields = append(preserveSetFields, g.F("%s = tgt.%s", colNameQ, colNameQ))
+			continue
 		}
+
+		setSrcExpr := strings.ReplaceAll(colExpr, colNameQ, g.F("src.%s", colNameQ))
+		setField := g.F("%s = %s", colNameQ, setSrcExpr)
+		setFields = append(setFields, setField)
+	}
+
+	if len(setFields) == 0 && len(preserveSetFields) > 0 {
+		err = g.Error("no columns left to update with the provided update columns")
+		return
 	}
 
 	// cast into the correct type
 	srcFields := conn.Self().CastColumnsForSelect(srcColumns, tgtColumns)
 
 	exprs = map[string]string{
-		"src_tgt_pk_equal":   strings.Join(pkEqualFields, " and "),
-		"src_upd_pk_equal":   strings.ReplaceAll(strings.Join(pkEqualFields, ", "), "tgt.", "upd."),
-		"src_fields":         strings.Join(srcFields, ", "),
-		"tgt_fields":         strings.Join(tgtFields, ", "),
-		"insert_fields":      strings.Join(insertFields, ", "),
-		"pk_fields":          strings.Join(pkFields, ", "),
-		"set_fields":         strings.Join(setFields, ", "),
-		"placeholder_fields": strings.Join(placeholderFields, ", "),
+		"src_tgt_pk_equal":    strings.Join(pkEqualFields, " and "),
+		"src_upd_pk_equal":    strings.ReplaceAll(strings.Join(pkEqualFields, ", "), "tgt.", "upd."),
+		"src_fields":          strings.Join(srcFields, ", "),
+		"tgt_fields":          strings.Join(tgtFields, ", "),
+		"insert_fields":       strings.Join(insertFields, ", "),
+		"pk_fields":           strings.Join(pkFields, ", "),
+		"set_fields":          strings.Join(setFields, ", "),
+		"placeholder_fields":  strings.Join(placeholderFields, ", "),
+		"preserve_set_fields": strings.Join(preserveSetFields, ", "),
 	}
 
 	return
 }
 
+// getUpdateColumnsFilter returns a function which returns true if the quoted
+// column is to be updated when merging, based on the `update_columns`
+// and `ignore_update_columns` properties (all columns by default)
+func (conn *BaseConn) getUpdateColumnsFilter(tgtColumns iop.Columns) (isUpdateColumn func(colNameQ string) bool, err error) {
+	getColumnsMap := func(key string) (colMap map[string]bool, err error) {
+		val := strings.TrimSpace(conn.GetProp(key))
+		if val == "" || val == "[]" || val == "null" {
+			return nil, nil
+		}
+
+		names := []string{}
+		if strings.HasPrefix(val, "[") {
+			if err = g.Unmarshal(val, &names); err != nil {
+				return nil, g.Error(err, "could not parse %s", key)
+			}
+		} else {
+			names = strings.Split(val, ",")
+		}
+		for i := range names {
+			names[i] = strings.TrimSpace(names[i])
+		}
+
+		cols, err := conn.ValidateColumnNames(tgtColumns, names, true)
+		if err != nil {
+			return nil, g.Error(err, "invalid %s", key)
+		}
+
+		colMap = map[string]bool{}
+		for _, name := range cols.Names() {
+			colMap[name] = true
+		}
+		return colMap, nil
+	}
+
+	updateCols, err := getColumnsMap("update_columns")
+	if err != nil {
+		return nil, err
+	}
+
+	ignoreCols, err := getColumnsMap("ignore_update_columns")
+	if err != nil {
+		return nil, err
+	}
+
+	isUpdateColumn = func(colNameQ string) bool {
+		if updateCols != nil && !updateCols[colNameQ] {
+			return false
+		}
+		return !ignoreCols[colNameQ]
+	}
+
+	return isUpdateColumn, nil
+}
+
 // GetColumnStats analyzes the table and returns the column statistics
 func (conn *BaseConn) GetColumnStats(tableName string, fields ...string) (columns iop.Columns, err error) {
 
-	table, err := ParseTableName(tableName, conn.GetType())
+	table, err := ParseConnTableName(tableName, conn.Self())
 	if err != nil {
 		return columns, g.Error(err, "could not parse table name")
 	}
@@ -2783,9 +3222,9 @@ func GetOptimizeTableStatements(conn Connection, table *Table, newColumns iop.Co
 
 		// for starrocks
 		fields := append(table.Columns.Names(), colNameTemp)
-		fields = conn.GetType().QuoteNames(fields...) // add quotes
+		fields = conn.QuoteNames(fields...) // add quotes
 		updatedFields := append(
-			conn.GetType().QuoteNames(table.Columns.Names()...), // add quotes
+			conn.QuoteNames(table.Columns.Names()...), // add quotes
 			oldColCasted)
 
 		ddlParts = append(ddlParts, g.R(
@@ -2824,9 +3263,9 @@ func GetOptimizeTableStatements(conn Connection, table *Table, newColumns iop.Co
 			return !strings.EqualFold(name, col.Name)
 		})
 		fields = append(otherNames, col.Name)
-		fields = conn.GetType().QuoteNames(fields...) // add quotes
+		fields = conn.QuoteNames(fields...) // add quotes
 		updatedFields = append(otherNames, colNameTemp)
-		updatedFields = conn.GetType().QuoteNames(updatedFields...) // add quotes
+		updatedFields = conn.QuoteNames(updatedFields...) // add quotes
 
 		ddlParts = append(ddlParts, g.R(
 			conn.GetTemplateValue("core.rename_column"),
@@ -2865,6 +3304,36 @@ func (conn *BaseConn) OptimizeTable(table *Table, newColumns iop.Columns, isTemp
 	return ok, nil
 }
 
+// ChecksumExpr returns the checksum expression of the column (to be summed),
+// according to its type
+func (conn *BaseConn) ChecksumExpr(col iop.Column, colName string) string {
+	expr := ""
+	switch {
+	case col.Type == iop.JsonType:
+		expr = conn.GetTemplateValue("function.checksum_json")
+	case col.IsString():
+		expr = conn.GetTemplateValue("function.checksum_string")
+	case col.IsInteger():
+		expr = conn.GetTemplateValue("function.checksum_integer")
+	case col.IsFloat():
+		expr = conn.GetTemplateValue("function.checksum_decimal")
+	case col.IsDecimal():
+		expr = conn.GetTemplateValue("function.checksum_decimal")
+	case col.IsDate():
+		expr = conn.GetTemplateValue("function.checksum_date")
+		if expr == "" {
+			expr = conn.GetTemplateValue("function.checksum_datetime")
+		}
+	case col.IsDatetime():
+		expr = conn.GetTemplateValue("function.checksum_datetime")
+	case col.IsBool():
+		expr = conn.GetTemplateValue("function.checksum_boolean")
+	default:
+		expr = "0"
+	}
+	return g.R(expr, "field", conn.Self().Quote(colName))
+}
+
 // CompareChecksums compares the checksum values from the database side
 // to the checkum values from the StreamProcessor
 func (conn *BaseConn) CompareChecksums(tableName string, columns iop.Columns) (err error) {
@@ -2876,7 +3345,7 @@ func (conn *BaseConn) CompareChecksums(tableName string, columns iop.Columns) (e
 		}
 	}()
 
-	table, err := ParseTableName(tableName, conn.GetType())
+	table, err := ParseConnTableName(tableName, conn.Self())
 	if err != nil {
 		return g.Error(err, "could not parse table name")
 	}
@@ -2906,32 +3375,8 @@ func (conn *BaseConn) CompareChecksums(tableName string, columns iop.Columns) (e
 			continue // making sure it is a common column
 		}
 
-		expr := ""
-		switch {
-		case col.Type == iop.JsonType:
-			expr = conn.GetTemplateValue("function.checksum_json")
-		case col.IsString():
-			expr = conn.GetTemplateValue("function.checksum_string")
-		case col.IsInteger():
-			expr = conn.GetTemplateValue("function.checksum_integer")
-		case col.IsFloat():
-			expr = conn.GetTemplateValue("function.checksum_decimal")
-		case col.IsDecimal():
-			expr = conn.GetTemplateValue("function.checksum_decimal")
-		case col.IsDate():
-			expr = conn.GetTemplateValue("function.checksum_date")
-			if expr == "" {
-				expr = conn.GetTemplateValue("function.checksum_datetime")
-			}
-		case col.IsDatetime():
-			expr = conn.GetTemplateValue("function.checksum_datetime")
-		case col.IsBool():
-			expr = conn.GetTemplateValue("function.checksum_boolean")
-		default:
-			expr = "0"
-		}
 		colName := fieldsMap[strings.ToLower(col.Name)]
-		expr = g.R(expr, "field", conn.Self().Quote(cast.ToString(colName)))
+		expr := conn.ChecksumExpr(col, cast.ToString(colName))
 		exprs = append(exprs, g.F("sum(%s) as %s", expr, conn.Self().Quote(cast.ToString(colName))))
 		exprMap[strings.ToLower(col.Name)] = g.F("sum(%s)", expr)
 	}
@@ -3115,6 +3560,25 @@ func settingMppBulkImportFlow(conn Connection, compressor iop.CompressorType) {
 	conn.SetProp("PARALLEL", "true")
 }
 
+// bulkLoadContext returns the context used by parallel bulk loaders, limited by the
+// `concurrency` property (the number of files loaded at once)
+func bulkLoadContext(conn Connection, defaultLimit ...int) *g.Context {
+	if val := cast.ToInt(conn.GetProp("concurrency")); val > 0 {
+		return g.NewContext(conn.Context().Ctx, val)
+	}
+	return g.NewContext(conn.Context().Ctx, defaultLimit...)
+}
+
+// fileReadyChannel returns the channel of files written and ready to load. The
+// `max_in_flight_batches` property limits its buffer, so that reading slows down
+// when the target is the bottleneck
+func fileReadyChannel(conn Connection, defaultSize int) chan filesys.FileReady {
+	if val := cast.ToInt(conn.GetProp("max_in_flight_batches")); val > 0 {
+		return make(chan filesys.FileReady, val)
+	}
+	return make(chan filesys.FileReady, defaultSize)
+}
+
 func (conn *BaseConn) AddMissingColumns(table Table, newCols iop.Columns) (ok bool, err error) {
 	cols, err := conn.GetColumns(table.FullName())
 	if err != nil {
@@ -3130,6 +3594,11 @@ func (conn *BaseConn) AddMissingColumns(table Table, newCols iop.Columns) (ok bo
 		if err != nil {
 			return false, g.Error(err, "no native mapping")
 		}
+		// new rows omitting the column get the default value
+		if col.Default != nil {
+			nativeType = nativeType + " default " + defaultValueExpr(conn.GetType(), col.Default)
+		}
+
 		sql := g.R(
 			conn.Template().Core["add_column"],
 			"table", table.FullName(),
@@ -3143,6 +3612,21 @@ func (conn *BaseConn) AddMissingColumns(table Table, newCols iop.Columns) (ok bo
 			return false, g.Error(err, "could not add column %s to table %s", col.Name, table.FullName())
 		}
 
+		// backfill existing rows with the default value
+		if col.Default != nil {
+			sql = g.R(
+				conn.GetTemplateValue("core.backfill_column"),
+				"table", table.FullName(),
+				"column", conn.Self().Quote(col.Name),
+				"value", defaultValueExpr(conn.GetType(), col.Default),
+			)
+			g.Debug("backfilling new column %s with default value", col.Name)
+			_, err = conn.Exec(sql)
+			if err != nil {
+				return false, g.Error(err, "could not backfill column %s in table %s", col.Name, table.FullName())
+			}
+		}
+
 		if g.In(conn.GetType(), dbio.TypeDbBigQuery) {
 			// avoid rate limit error
 			time.Sleep(2 * time.Second)
@@ -3152,6 +3636,52 @@ func (conn *BaseConn) AddMissingColumns(table Table, newCols iop.Columns) (ok bo
 	return len(missing) > 0, nil
 }
 
+// defaultValueExpr returns the SQL expression of a column default value.
+// Strings are quoted as literals, unless they are an expression: a number,
+// a quoted literal (`'unknown'`), a keyword such as `current_timestamp` or
+// a function call such as `now()`. Booleans are 1 / 0 for the databases
+// without boolean literals.
+func defaultValueExpr(dbType dbio.Type, val any) string {
+	switch v := val.(type) {
+	case string:
+		if g.In(strings.ToLower(v), "true", "false") {
+			return defaultValueExpr(dbType, cast.ToBool(v))
+		} else if isDefaultExpr(v) {
+			return v
+		}
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case bool:
+		if g.In(dbType, dbio.TypeDbSQLServer, dbio.TypeDbAzure, dbio.TypeDbAzureDWH, dbio.TypeDbOracle, dbio.TypeDbTeradata) {
+			return lo.Ternary(v, "1", "0")
+		}
+		return lo.Ternary(v, "true", "false")
+	case time.Time:
+		return "'" + v.Format("2006-01-02 15:04:05") + "'"
+	default:
+		return cast.ToString(v)
+	}
+}
+
+var defaultExprKeywords = []string{
+	"null", "true", "false", "current_timestamp", "current_date", "current_time",
+	"localtimestamp", "localtime", "sysdate", "systimestamp", "current_user",
+}
+
+var defaultExprFunc = regexp.MustCompile(`^[\w.]+\s*\(.*\)$`)
+
+// isDefaultExpr returns true if the default value is an SQL expression
+func isDefaultExpr(val string) bool {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return false
+	} else if strings.HasPrefix(val, "'") && strings.HasSuffix(val, "'") && len(val) > 1 {
+		return true
+	} else if _, err := strconv.ParseFloat(val, 64); err == nil {
+		return true
+	}
+	return g.In(strings.ToLower(val), defaultExprKeywords...) || defaultExprFunc.MatchString(val)
+}
+
 // TestPermissions tests the needed permissions in a given connection
 func TestPermissions(conn Connection, tableName string) (err error) {
 
@@ -3256,7 +3786,7 @@ func CopyFromS3(conn Connection, tableFName, s3Path string) (err error) {
 		return
 	}
 
-	table, err := ParseTableName(tableFName, conn.GetType())
+	table, err := ParseConnTableName(tableFName, conn)
 	if err != nil {
 		return g.Error(err, "could not parse table name")
 	}
@@ -3306,7 +3836,7 @@ func CopyFromAzure(conn Connection, tableFName, azPath string) (err error) {
 		return g.Error(err)
 	}
 
-	table, err := ParseTableName(tableFName, conn.GetType())
+	table, err := ParseConnTableName(tableFName, conn)
 	if err != nil {
 		return g.Error(err, "could not parse table name")
 	}
@@ -12,6 +12,7 @@ import (
 	"path"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dustin/go-humanize"
@@ -40,6 +41,8 @@ type BigQueryConn struct {
 	Location  string
 	Datasets  []string
 	Mux       sync.Mutex
+
+	bytesProcessed atomic.Int64 // total bytes processed by the query jobs
 }
 
 // Init initiates the object
@@ -94,23 +97,32 @@ func (conn *BigQueryConn) Init() error {
 	return nil
 }
 
-func (conn *BigQueryConn) getNewClient(timeOut ...int) (client *bigquery.Client, err error) {
-	var authOption option.ClientOption
+// getAuthOption returns the google client auth option from the provided credentials
+func (conn *BigQueryConn) getAuthOption() (authOption option.ClientOption, err error) {
 	var credJsonBody string
 
-	to := 15
-	if len(timeOut) > 0 {
-		to = timeOut[0]
+	useWorkloadIdentity, err := filesys.UseWorkloadIdentity(conn.GetProp("auth"))
+	if err != nil {
+		return nil, err
 	}
 
-	if val := conn.GetProp("GC_KEY_BODY"); val != "" {
+	if useWorkloadIdentity {
+		var projectID string
+		authOption, projectID, err = filesys.GoogleWorkloadIdentityOption()
+		if err != nil {
+			return nil, err
+		}
+		if conn.ProjectID == "" {
+			conn.ProjectID = projectID
+		}
+	} else if val := conn.GetProp("GC_KEY_BODY"); val != "" {
 		credJsonBody = val
 		authOption = option.WithCredentialsJSON([]byte(val))
 	} else if val := conn.GetProp("GC_KEY_FILE"); val != "" {
 		authOption = option.WithCredentialsFile(val)
 		b, err := os.ReadFile(val)
 		if err != nil {
-			return client, g.Error(err, "could not read google cloud key file")
+			return nil, g.Error(err, "could not read google cloud key file")
 		}
 		credJsonBody = string(b)
 	} else if val := conn.GetProp("GC_CRED_API_KEY"); val != "" {
@@ -119,13 +131,13 @@ func (conn *BigQueryConn) getNewClient(timeOut ...int) (client *bigquery.Client,
 		authOption = option.WithCredentialsFile(val)
 		b, err := os.ReadFile(val)
 		if err != nil {
-			return client, g.Error(err, "could not read google cloud key file")
+			return nil, g.Error(err, "could not read google cloud key file")
 		}
 		credJsonBody = string(b)
 	} else {
 		creds, err := google.FindDefaultCredentials(conn.BaseConn.Context().Ctx)
 		if err != nil {
-			return client, g.Error(err, "No Google credentials provided or could not find Application Default Credentials.")
+			return nil, g.Error(err, "No Google credentials provided or could not find Application Default Credentials.")
 		}
 		authOption = option.WithCredentials(creds)
 	}
@@ -136,6 +148,20 @@ func (conn *BigQueryConn) getNewClient(timeOut ...int) (client *bigquery.Client,
 		conn.ProjectID = cast.ToString(m["project_id"])
 	}
 
+	return authOption, nil
+}
+
+func (conn *BigQueryConn) getNewClient(timeOut ...int) (client *bigquery.Client, err error) {
+	to := 15
+	if len(timeOut) > 0 {
+		to = timeOut[0]
+	}
+
+	authOption, err := conn.getAuthOption()
+	if err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithTimeout(conn.BaseConn.Context().Ctx, time.Duration(to)*time.Second)
 	defer cancel()
 
@@ -251,9 +277,10 @@ func (conn *BigQueryConn) ExecContext(ctx context.Context, sql string, args ...i
 		res.TotalRows = it.TotalRows + res.TotalRows
 	}
 
-	// if bp, cj := getBytesProcessed(it); bp > 0 {
-	// 	g.DebugLow("BigQuery job %s (%d children) => Processed %d bytes", q.JobID, cj, bp)
-	// }
+	if bp, cj := getBytesProcessed(it); bp > 0 {
+		conn.bytesProcessed.Add(bp)
+		g.Trace("BigQuery job %s (%d children) => Processed %d bytes", q.JobID, cj, bp)
+	}
 
 	result = res
 
@@ -272,18 +299,22 @@ func (conn *BigQueryConn) GenerateDDL(table Table, data iop.Dataset, temporary b
 		// allow custom SQL expression for partitioning
 		partitionBy = g.F("partition by %s", strings.Join(keys, ", "))
 	} else if keyCols := data.Columns.GetKeys(iop.PartitionKey); len(keyCols) > 0 {
-		colNames := conn.GetType().QuoteNames(keyCols.Names()...)
+		colNames := conn.QuoteNames(keyCols.Names()...)
 		partitionBy = g.F("partition by %s", strings.Join(colNames, ", "))
 	}
 	sql = strings.ReplaceAll(sql, "{partition_by}", partitionBy)
 
 	clusterBy := ""
 	if keyCols := data.Columns.GetKeys(iop.ClusterKey); len(keyCols) > 0 {
-		colNames := conn.GetType().QuoteNames(keyCols.Names()...)
+		colNames := conn.QuoteNames(keyCols.Names()...)
 		clusterBy = g.F("cluster by %s", strings.Join(colNames, ", "))
 	}
 	sql = strings.ReplaceAll(sql, "{cluster_by}", clusterBy)
 
+	if days := cast.ToInt(conn.GetProp("partition_expiration_days")); days > 0 && partitionBy != "" && !temporary {
+		sql = strings.TrimSpace(sql) + g.F(" options(partition_expiration_days=%d)", days)
+	}
+
 	return strings.TrimSpace(sql), nil
 }
 
@@ -467,9 +498,10 @@ func (conn *BigQueryConn) StreamRowsContext(ctx context.Context, sql string, opt
 		return ds, g.Error(err, "could start datastream")
 	}
 
-	// if bp, cj := getBytesProcessed(it); bp > 0 {
-	// 	g.Debug("BigQuery job %s (%d children) => Processed %d bytes", q.JobID, cj, bp)
-	// }
+	if bp, cj := getBytesProcessed(it); bp > 0 {
+		conn.bytesProcessed.Add(bp)
+		g.Trace("BigQuery job %s (%d children) => Processed %d bytes", q.JobID, cj, bp)
+	}
 
 	return
 }
@@ -558,6 +590,10 @@ func (conn *BigQueryConn) BulkImportFlow(tableFName string, df *iop.Dataflow) (c
 		}
 	}
 
+	if strings.EqualFold(conn.GetProp("load_method"), "storage_write") {
+		return conn.importViaStorageWrite(tableFName, df)
+	}
+
 	if gcBucket := conn.GetProp("GC_BUCKET"); gcBucket == "" {
 		return conn.importViaLocalStorage(tableFName, df)
 	}
@@ -584,7 +620,7 @@ func (conn *BigQueryConn) importViaLocalStorage(tableFName string, df *iop.Dataf
 
 	g.Info("importing into bigquery via local storage")
 
-	fileReadyChn := make(chan filesys.FileReady, 10)
+	fileReadyChn := fileReadyChannel(conn, 10)
 
 	go func() {
 		config := iop.LoaderStreamConfig(true)
@@ -597,7 +633,7 @@ func (conn *BigQueryConn) importViaLocalStorage(tableFName string, df *iop.Dataf
 
 	}()
 
-	table, err := ParseTableName(tableFName, conn.Type)
+	table, err := ParseConnTableName(tableFName, conn)
 	if err != nil {
 		err = g.Error(err, "could not parse table name: "+tableFName)
 		return
@@ -658,7 +694,7 @@ func (conn *BigQueryConn) importViaGoogleStorage(tableFName string, df *iop.Data
 	gcsPath := fmt.Sprintf(
 		"gs://%s/%s/%s.csv",
 		gcBucket,
-		tempCloudStorageFolder,
+		conn.tempCloudFolder(),
 		tableFName,
 	)
 
@@ -675,7 +711,7 @@ func (conn *BigQueryConn) importViaGoogleStorage(tableFName string, df *iop.Data
 
 	g.Info("importing into bigquery via google storage")
 
-	fileReadyChn := make(chan filesys.FileReady, 10)
+	fileReadyChn := fileReadyChannel(conn, 10)
 
 	go func() {
 		config := iop.LoaderStreamConfig(true)
@@ -689,7 +725,7 @@ func (conn *BigQueryConn) importViaGoogleStorage(tableFName string, df *iop.Data
 
 	}()
 
-	table, err := ParseTableName(tableFName, conn.Type)
+	table, err := ParseConnTableName(tableFName, conn)
 	if err != nil {
 		err = g.Error(err, "could not parse table name: "+tableFName)
 		return
@@ -916,7 +952,7 @@ func (conn *BigQueryConn) Unload(tables ...Table) (gsPath string, err error) {
 		return
 	}
 
-	gsPath = fmt.Sprintf("gs://%s/%s/stream/%s.csv", gcBucket, tempCloudStorageFolder, cast.ToString(g.Now()))
+	gsPath = fmt.Sprintf("gs://%s/%s/stream/%s.csv", gcBucket, conn.tempCloudFolder(), cast.ToString(g.Now()))
 
 	filesys.Delete(gsFs, gsPath)
 
@@ -936,6 +972,38 @@ func (conn *BigQueryConn) Unload(tables ...Table) (gsPath string, err error) {
 	return gsPath, err
 }
 
+// StagingTypes returns the object stores supported for staging
+func (conn *BigQueryConn) StagingTypes() []dbio.Type {
+	return []dbio.Type{dbio.TypeFileGoogle}
+}
+
+// UnloadToStorage exports the table into the files of the gcs folder
+func (conn *BigQueryConn) UnloadToStorage(table Table, folderURL string) (err error) {
+	if StagingType(folderURL) != dbio.TypeFileGoogle {
+		return g.Error("bigquery cannot unload to %s", folderURL)
+	}
+
+	g.Info("unloading from bigquery to %s", folderURL)
+	gcsURI := strings.TrimSuffix(folderURL, "/") + "/" + StagingFilePrefix + "-*.csv.gz"
+	return conn.ExportToGCS(table.Select(), gcsURI)
+}
+
+// LoadFromStorage loads the files of the gcs folder into the table
+func (conn *BigQueryConn) LoadFromStorage(tableFName, folderURL string, columns iop.Columns) (err error) {
+	if StagingType(folderURL) != dbio.TypeFileGoogle {
+		return g.Error("bigquery cannot load from %s", folderURL)
+	}
+
+	table, err := ParseConnTableName(tableFName, conn)
+	if err != nil {
+		return g.Error(err, "could not parse table name")
+	}
+
+	// the unloaded files are gzipped
+	gcsURI := strings.TrimSuffix(folderURL, "/") + "/" + StagingFilePrefix + "*.gz"
+	return conn.CopyFromGCS(gcsURI, table, columns)
+}
+
 // CopyToGCS Copy table to gc storage
 func (conn *BigQueryConn) ExportToGCS(sql string, gcsURI string) error {
 
@@ -1278,6 +1346,12 @@ func (conn *BigQueryConn) GetSchemata(level SchemataLevel, schemaName string, ta
 	return schemata, nil
 }
 
+// BytesProcessed returns the total bytes processed by the query jobs
+// of the connection, which are billed with on-demand pricing
+func (conn *BigQueryConn) BytesProcessed() int64 {
+	return conn.bytesProcessed.Load()
+}
+
 func getBytesProcessed(it *bigquery.RowIterator) (bytesProcessed int64, childJobs int64) {
 	if job := it.SourceJob(); job != nil {
 		if status, err := job.Status(context.Background()); err == nil {
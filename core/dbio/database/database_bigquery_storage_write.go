@@ -0,0 +1,294 @@
+package database
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/apiv1/storagepb"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"cloud.google.com/go/civil"
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// storageWriteField is a table field mapped to its protobuf field
+type storageWriteField struct {
+	number protowire.Number
+	typ    bigquery.FieldType
+}
+
+// storageWriteSchema maps the table schema to a protobuf descriptor used by the
+// Storage Write API. Numeric, datetime & time values are sent as strings,
+// which the API converts into the column type.
+type storageWriteSchema struct {
+	descriptor *descriptorpb.DescriptorProto
+	fields     map[string]storageWriteField // lower case name => field
+}
+
+func newStorageWriteSchema(schema bigquery.Schema) (sws *storageWriteSchema, err error) {
+	sws = &storageWriteSchema{
+		descriptor: &descriptorpb.DescriptorProto{Name: proto.String("sling_row")},
+		fields:     map[string]storageWriteField{},
+	}
+
+	for i, field := range schema {
+		var protoType descriptorpb.FieldDescriptorProto_Type
+		switch field.Type {
+		case bigquery.StringFieldType, bigquery.GeographyFieldType, bigquery.JSONFieldType,
+			bigquery.NumericFieldType, bigquery.BigNumericFieldType,
+			bigquery.DateTimeFieldType, bigquery.TimeFieldType:
+			protoType = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		case bigquery.IntegerFieldType, bigquery.TimestampFieldType:
+			protoType = descriptorpb.FieldDescriptorProto_TYPE_INT64
+		case bigquery.DateFieldType:
+			protoType = descriptorpb.FieldDescriptorProto_TYPE_INT32
+		case bigquery.FloatFieldType:
+			protoType = descriptorpb.FieldDescriptorProto_TYPE_DOUBLE
+		case bigquery.BooleanFieldType:
+			protoType = descriptorpb.FieldDescriptorProto_TYPE_BOOL
+		case bigquery.BytesFieldType:
+			protoType = descriptorpb.FieldDescriptorProto_TYPE_BYTES
+		default:
+			return nil, g.Error("unsupported column type for Storage Write API: %s (%s)", field.Name, field.Type)
+		}
+
+		if field.Repeated {
+			return nil, g.Error("repeated columns are not supported for Storage Write API: %s", field.Name)
+		}
+
+		number := int32(i + 1)
+		sws.descriptor.Field = append(sws.descriptor.Field, &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(field.Name),
+			Number: proto.Int32(number),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:   protoType.Enum(),
+		})
+		sws.fields[strings.ToLower(field.Name)] = storageWriteField{number: protowire.Number(number), typ: field.Type}
+	}
+
+	return sws, nil
+}
+
+// encodeRow serializes a row into the protobuf wire format.
+// Null values and columns not present in the table are omitted.
+func (sws *storageWriteSchema) encodeRow(columns iop.Columns, row []any) (b []byte, err error) {
+	for i, val := range row {
+		if val == nil || i >= len(columns) {
+			continue
+		}
+
+		field, ok := sws.fields[strings.ToLower(columns[i].Name)]
+		if !ok {
+			continue
+		}
+
+		b, err = field.append(b, val)
+		if err != nil {
+			return nil, g.Error(err, "could not encode value for column %s", columns[i].Name)
+		}
+	}
+	return b, nil
+}
+
+func (f storageWriteField) append(b []byte, val any) ([]byte, error) {
+	toTime := func() (time.Time, error) {
+		if t, ok := val.(time.Time); ok {
+			return t, nil
+		}
+		return cast.ToTimeE(val)
+	}
+
+	switch f.typ {
+	case bigquery.IntegerFieldType:
+		v, err := cast.ToInt64E(val)
+		if err != nil {
+			return b, err
+		}
+		b = protowire.AppendTag(b, f.number, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(v)), nil
+	case bigquery.TimestampFieldType:
+		t, err := toTime()
+		if err != nil {
+			return b, err
+		}
+		b = protowire.AppendTag(b, f.number, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(t.UnixMicro())), nil
+	case bigquery.DateFieldType:
+		t, err := toTime()
+		if err != nil {
+			return b, err
+		}
+		days := civil.DateOf(t).DaysSince(civil.Date{Year: 1970, Month: 1, Day: 1})
+		b = protowire.AppendTag(b, f.number, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(int64(days))), nil
+	case bigquery.DateTimeFieldType:
+		t, err := toTime()
+		if err != nil {
+			return b, err
+		}
+		b = protowire.AppendTag(b, f.number, protowire.BytesType)
+		return protowire.AppendString(b, t.Format("2006-01-02 15:04:05.999999")), nil
+	case bigquery.TimeFieldType:
+		if t, ok := val.(time.Time); ok {
+			val = t.Format("15:04:05.999999")
+		}
+	case bigquery.FloatFieldType:
+		v, err := cast.ToFloat64E(val)
+		if err != nil {
+			return b, err
+		}
+		b = protowire.AppendTag(b, f.number, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(v)), nil
+	case bigquery.BooleanFieldType:
+		v, err := cast.ToBoolE(val)
+		if err != nil {
+			return b, err
+		}
+		b = protowire.AppendTag(b, f.number, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(v)), nil
+	case bigquery.BytesFieldType:
+		v, ok := val.([]byte)
+		if !ok {
+			v = []byte(cast.ToString(val))
+		}
+		b = protowire.AppendTag(b, f.number, protowire.BytesType)
+		return protowire.AppendBytes(b, v), nil
+	}
+
+	v, err := cast.ToStringE(val)
+	if err != nil {
+		return b, err
+	}
+	b = protowire.AppendTag(b, f.number, protowire.BytesType)
+	return protowire.AppendString(b, v), nil
+}
+
+// importViaStorageWrite loads a dataflow with the Storage Write API, into a pending stream.
+// The rows become visible atomically once the stream is committed (exactly-once),
+// and no Google Cloud Storage bucket is needed.
+// https://cloud.google.com/bigquery/docs/write-api
+func (conn *BigQueryConn) importViaStorageWrite(tableFName string, df *iop.Dataflow) (count uint64, err error) {
+	table, err := ParseConnTableName(tableFName, conn)
+	if err != nil {
+		return 0, g.Error(err, "could not parse table name: "+tableFName)
+	}
+	projectID := lo.Ternary(table.Database != "", table.Database, conn.ProjectID)
+
+	ctx := conn.Context().Ctx
+	metadata, err := conn.Client.DatasetInProject(projectID, table.Schema).Table(table.Name).Metadata(ctx)
+	if err != nil {
+		return 0, g.Error(err, "could not get table metadata: "+tableFName)
+	}
+
+	sws, err := newStorageWriteSchema(metadata.Schema)
+	if err != nil {
+		return 0, g.Error(err, "could not map schema of table %s", tableFName)
+	}
+
+	authOption, err := conn.getAuthOption()
+	if err != nil {
+		return 0, g.Error(err, "could not get credentials")
+	}
+
+	client, err := managedwriter.NewClient(ctx, conn.ProjectID, authOption)
+	if err != nil {
+		return 0, g.Error(err, "could not create Storage Write client")
+	}
+	defer client.Close()
+
+	parent := managedwriter.TableParentFromParts(projectID, table.Schema, table.Name)
+	maxInFlight := lo.Ternary(cast.ToInt(conn.GetProp("max_in_flight_batches")) > 0, cast.ToInt(conn.GetProp("max_in_flight_batches")), 10)
+	stream, err := client.NewManagedStream(ctx,
+		managedwriter.WithDestinationTable(parent),
+		managedwriter.WithType(managedwriter.PendingStream),
+		managedwriter.WithSchemaDescriptor(sws.descriptor),
+		managedwriter.WithMaxInflightRequests(maxInFlight),
+	)
+	if err != nil {
+		return 0, g.Error(err, "could not create write stream for %s", tableFName)
+	}
+	defer stream.Close()
+
+	g.Info("importing into bigquery via storage write api")
+
+	// each append request is limited to 10MB
+	maxRows := lo.Ternary(cast.ToInt(conn.GetProp("batch_size")) > 0, cast.ToInt(conn.GetProp("batch_size")), 10000)
+	maxBytes := 8 * 1024 * 1024
+	rows := [][]byte{}
+	rowBytes := 0
+	offset := int64(0)
+	results := []*managedwriter.AppendResult{}
+
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		result, err := stream.AppendRows(ctx, rows, managedwriter.WithOffset(offset))
+		if err != nil {
+			return g.Error(err, "could not append rows")
+		}
+		results = append(results, result)
+		offset += int64(len(rows))
+		rows = [][]byte{}
+		rowBytes = 0
+		return nil
+	}
+
+	for ds := range df.StreamCh {
+		for batch := range ds.BatchChan {
+			for row := range batch.Rows {
+				b, err := sws.encodeRow(batch.Columns, row)
+				if err != nil {
+					df.Context.CaptureErr(err)
+					return count, g.Error(err, "could not encode row")
+				}
+				rows = append(rows, b)
+				rowBytes += len(b)
+				count++
+
+				if len(rows) >= maxRows || rowBytes >= maxBytes {
+					if err = flush(); err != nil {
+						df.Context.CaptureErr(err)
+						return count, g.Error(err)
+					}
+				}
+			}
+		}
+	}
+
+	if err = flush(); err != nil {
+		return count, g.Error(err)
+	} else if err = df.Err(); err != nil {
+		return count, g.Error(err, "Error importing to BigQuery")
+	}
+
+	for _, result := range results {
+		if _, err = result.GetResult(ctx); err != nil {
+			return count, g.Error(err, "error appending rows to %s", tableFName)
+		}
+	}
+
+	if _, err = stream.Finalize(ctx); err != nil {
+		return count, g.Error(err, "could not finalize write stream")
+	}
+
+	resp, err := client.BatchCommitWriteStreams(ctx, &storagepb.BatchCommitWriteStreamsRequest{
+		Parent:       parent,
+		WriteStreams: []string{stream.StreamName()},
+	})
+	if err != nil {
+		return count, g.Error(err, "could not commit write stream")
+	} else if streamErrs := resp.GetStreamErrors(); len(streamErrs) > 0 {
+		return count, g.Error("could not commit write stream: %s", streamErrs[0].GetErrorMessage())
+	}
+
+	g.Debug("loaded %d rows via storage write api into %s", count, tableFName)
+	return count, nil
+}
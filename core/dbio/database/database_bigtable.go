@@ -332,7 +332,7 @@ func (conn *BigTableConn) GetSchemata(level SchemataLevel, schemaName string, ta
 }
 
 func (conn *BigTableConn) GetColumnsFull(tableFName string) (iop.Dataset, error) {
-	table, err := ParseTableName(tableFName, conn.Type)
+	table, err := ParseConnTableName(tableFName, conn)
 	if err != nil {
 		return iop.Dataset{}, g.Error(err, "could not parse table name: "+tableFName)
 	}
@@ -13,7 +13,9 @@ import (
 	"github.com/slingdata-io/sling-cli/core/env"
 	"github.com/spf13/cast"
 
-	_ "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/samber/lo"
 
 	"github.com/flarco/g"
 )
@@ -86,18 +88,18 @@ func (conn *ClickhouseConn) GenerateDDL(table Table, data iop.Dataset, temporary
 	orderBy := "tuple()"
 	primaryKey := ""
 	if keyCols := data.Columns.GetKeys(iop.PrimaryKey); len(keyCols) > 0 {
-		colNames := conn.GetType().QuoteNames(keyCols.Names()...)
+		colNames := conn.QuoteNames(keyCols.Names()...)
 		primaryKey = g.F("primary key (%s)", strings.Join(colNames, ", "))
 		orderBy = strings.Join(colNames, ", ")
 	}
-	ddl = g.R(ddl, "primary_key", primaryKey, "order_by", orderBy)
+	ddl = g.R(ddl, "primary_key", primaryKey, "order_by", orderBy, "engine", conn.tableEngineDDL())
 
 	partitionBy := ""
 	if keys, ok := table.Keys[iop.PartitionKey]; ok {
 		// allow custom SQL expression for partitioning
 		partitionBy = g.F("partition by (%s)", strings.Join(keys, ", "))
 	} else if keyCols := data.Columns.GetKeys(iop.PartitionKey); len(keyCols) > 0 {
-		colNames := conn.GetType().QuoteNames(keyCols.Names()...)
+		colNames := conn.QuoteNames(keyCols.Names()...)
 		partitionBy = g.F("partition by %s", strings.Join(colNames, ", "))
 	}
 	ddl = strings.ReplaceAll(ddl, "{partition_by}", partitionBy)
@@ -105,11 +107,64 @@ func (conn *ClickhouseConn) GenerateDDL(table Table, data iop.Dataset, temporary
 	return strings.TrimSpace(ddl), nil
 }
 
+// tableEngineDDL returns the table engine for new tables, from the `engine` property.
+// Defaults to `MergeTree`. With `ReplacingMergeTree`, the primary key is used as the
+// sorting key, so that rows with the same key are deduplicated.
+func (conn *ClickhouseConn) tableEngineDDL() string {
+	if engine := strings.TrimSpace(conn.GetProp("engine")); engine != "" {
+		return engine
+	}
+	return "MergeTree"
+}
+
+// insertContext returns the context for inserts, with the `async_insert`
+// settings when enabled (`async_insert` & `wait_for_async_insert` properties)
+func (conn *ClickhouseConn) insertContext() context.Context {
+	ctx := conn.Context().Ctx
+	if settings := conn.insertSettings(); len(settings) > 0 {
+		ctx = clickhouse.Context(ctx, clickhouse.WithSettings(settings))
+	}
+	return ctx
+}
+
+func (conn *ClickhouseConn) insertSettings() clickhouse.Settings {
+	settings := clickhouse.Settings{}
+	if cast.ToBool(conn.GetProp("async_insert")) {
+		settings["async_insert"] = 1
+		settings["wait_for_async_insert"] = 1
+		if val := conn.GetProp("wait_for_async_insert"); val != "" {
+			settings["wait_for_async_insert"] = lo.Ternary(cast.ToBool(val), 1, 0)
+		}
+	}
+	return settings
+}
+
+// insertDb returns the database handle used to load data. When connected via
+// `http_url`, setting `load_protocol: native` loads over the native TCP protocol
+// (host & port), which is more efficient for large volumes.
+func (conn *ClickhouseConn) insertDb() (db *sqlx.DB, closeFunc func(), err error) {
+	closeFunc = func() {}
+	if conn.GetProp("http_url") == "" || !strings.EqualFold(conn.GetProp("load_protocol"), "native") {
+		return conn.Db(), closeFunc, nil
+	}
+
+	db, err = sqlx.Open("clickhouse", conn.BaseConn.ConnString())
+	if err != nil {
+		return nil, closeFunc, g.Error(err, "could not open native connection for loading")
+	} else if err = db.PingContext(conn.Context().Ctx); err != nil {
+		db.Close()
+		return nil, closeFunc, g.Error(err, "could not connect via native protocol for loading")
+	}
+
+	g.Debug("loading into clickhouse via native protocol")
+	return db, func() { db.Close() }, nil
+}
+
 // BulkImportStream inserts a stream into a table
 func (conn *ClickhouseConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
 	var columns iop.Columns
 
-	table, err := ParseTableName(tableFName, conn.GetType())
+	table, err := ParseConnTableName(tableFName, conn)
 	if err != nil {
 		err = g.Error(err, "could not get table name for import")
 		return
@@ -118,6 +173,12 @@ func (conn *ClickhouseConn) BulkImportStream(tableFName string, ds *iop.Datastre
 	// set default schema
 	conn.Exec(g.F("use `%s`", table.Schema))
 
+	db, closeDb, err := conn.insertDb()
+	if err != nil {
+		return count, g.Error(err)
+	}
+	defer closeDb()
+
 	// set OnSchemaChange
 	if df := ds.Df(); df != nil && cast.ToBool(conn.GetProp("adjust_column_type")) {
 		oldOnColumnChanged := df.OnColumnChanged
@@ -149,13 +210,12 @@ func (conn *ClickhouseConn) BulkImportStream(tableFName string, ds *iop.Datastre
 
 		err = func() error {
 			// COPY needs a transaction
-			if conn.Tx() == nil {
-				err = conn.Begin(&sql.TxOptions{Isolation: sql.LevelDefault})
-				if err != nil {
-					return g.Error(err, "could not begin")
-				}
-				defer conn.Rollback()
+			ctx := conn.insertContext()
+			tx, err := db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelDefault})
+			if err != nil {
+				return g.Error(err, "could not begin")
 			}
+			defer tx.Rollback()
 
 			insCols, err := conn.ValidateColumnNames(columns, batch.Columns.Names(), true)
 			if err != nil {
@@ -168,7 +228,7 @@ func (conn *ClickhouseConn) BulkImportStream(tableFName string, ds *iop.Datastre
 				1,
 			)
 
-			stmt, err := conn.Prepare(insertStatement)
+			stmt, err := tx.PrepareContext(ctx, insertStatement)
 			if err != nil {
 				g.Trace("%s: %#v", table, columns.Names())
 				return g.Error(err, "could not prepare statement")
@@ -238,7 +298,7 @@ func (conn *ClickhouseConn) BulkImportStream(tableFName string, ds *iop.Datastre
 				count++
 				// Do insert
 				ds.Context.Lock()
-				_, err := stmt.Exec(row...)
+				_, err := stmt.ExecContext(ctx, row...)
 				ds.Context.Unlock()
 				if err != nil {
 					ds.Context.CaptureErr(g.Error(err, "could not COPY into table %s", tableFName))
@@ -252,7 +312,7 @@ func (conn *ClickhouseConn) BulkImportStream(tableFName string, ds *iop.Datastre
 				return g.Error(err, "could not close statement")
 			}
 
-			err = conn.Commit()
+			err = tx.Commit()
 			if err != nil {
 				return g.Error(err, "could not commit transaction")
 			}
@@ -289,7 +349,7 @@ func (conn *ClickhouseConn) GenerateInsertStatement(tableName string, cols iop.C
 	}
 
 	if conn.GetProp("http_url") != "" {
-		table, _ := ParseTableName(tableName, conn.GetType())
+		table, _ := ParseConnTableName(tableName, conn)
 		tableName = table.NameQ()
 	}
 
@@ -311,6 +371,25 @@ func (conn *ClickhouseConn) GenerateUpsertSQL(srcTable string, tgtTable string,
 		return
 	}
 
+	if upsertMap["preserve_set_fields"] != "" {
+		err = g.Error("update_columns / ignore_update_columns are not supported for ClickHouse")
+		return
+	}
+
+	// ReplacingMergeTree deduplicates rows by sorting key (the primary key),
+	// keeping the last inserted version, so there is no need for a delete mutation
+	if engine := conn.tableEngine(tgtTable); strings.Contains(engine, "ReplacingMergeTree") {
+		g.Debug("target table %s is %s, upserting via insert", tgtTable, engine)
+		sql = g.R(
+			"insert into {tgt_table} ({insert_fields}) select {src_fields} from {src_table} src",
+			"src_table", srcTable,
+			"tgt_table", tgtTable,
+			"insert_fields", upsertMap["insert_fields"],
+			"src_fields", upsertMap["src_fields"],
+		)
+		return
+	}
+
 	sqlTempl := `
 	alter table {tgt_table}
 	delete where ({pk_fields}) in (
@@ -337,6 +416,26 @@ func (conn *ClickhouseConn) GenerateUpsertSQL(srcTable string, tgtTable string,
 	return
 }
 
+// tableEngine returns the engine of an existing table
+func (conn *ClickhouseConn) tableEngine(tableFName string) string {
+	table, err := ParseConnTableName(tableFName, conn)
+	if err != nil {
+		return ""
+	}
+
+	sql := g.R(
+		conn.template.Core["table_engine"],
+		"schema", table.Schema,
+		"table", table.Name,
+	)
+	data, err := conn.Query(sql)
+	if err != nil || len(data.Rows) == 0 {
+		g.LogError(err, "could not get table engine for %s", tableFName)
+		return ""
+	}
+	return cast.ToString(data.Rows[0][0])
+}
+
 func processClickhouseInsertRow(columns iop.Columns, row []any) []any {
 	for i := range row {
 		if columns[i].Type == iop.DecimalType {
@@ -0,0 +1,939 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/flarco/g/net"
+	"github.com/samber/lo"
+	"github.com/shopspring/decimal"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/spf13/cast"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// DatabricksConn is a Databricks SQL Warehouse connection. Statements are
+// submitted with the SQL Statement Execution API, and bulk loads are staged
+// in a Unity Catalog volume
+type DatabricksConn struct {
+	BaseConn
+	URL         string
+	Host        string
+	WarehouseID string
+	Catalog     string
+	Mux         sync.Mutex
+	client      http.Client
+	tokenSource oauth2.TokenSource
+}
+
+// Init initiates the object
+func (conn *DatabricksConn) Init() error {
+
+	conn.BaseConn.URL = conn.URL
+	conn.BaseConn.Type = dbio.TypeDbDatabricks
+
+	conn.Host = conn.GetProp("host")
+	conn.WarehouseID = conn.GetProp("warehouse_id")
+	if httpPath := conn.GetProp("http_path"); conn.WarehouseID == "" && httpPath != "" {
+		// e.g. /sql/1.0/warehouses/abc123
+		conn.WarehouseID = path.Base(httpPath)
+	}
+
+	// databricks://token:{token}@{host}/{warehouse_id}?catalog={catalog}
+	if u, err := net.NewURL(conn.URL); err == nil {
+		conn.Host = lo.Ternary(conn.Host != "", conn.Host, u.Hostname())
+		conn.WarehouseID = lo.Ternary(conn.WarehouseID != "", conn.WarehouseID, strings.Trim(u.Path(), "/"))
+		if conn.GetProp("token") == "" && u.Password() != "" {
+			conn.SetProp("token", u.Password())
+		}
+	}
+
+	conn.Catalog = conn.GetProp("catalog")
+	if conn.Catalog == "" {
+		conn.Catalog = conn.GetProp("database")
+	}
+
+	conn.client = http.Client{Timeout: 5 * time.Minute}
+
+	instance := Connection(conn)
+	conn.BaseConn.instance = &instance
+
+	return conn.BaseConn.Init()
+}
+
+// baseURL returns the workspace url. A scheme is only provided
+// for testing against a local server
+func (conn *DatabricksConn) baseURL() string {
+	host := strings.TrimSuffix(conn.Host, "/")
+	if strings.HasPrefix(host, "http://") || strings.HasPrefix(host, "https://") {
+		return host
+	}
+	return "https://" + host
+}
+
+// setTokenSource uses OAuth machine-to-machine auth when a service principal
+// is provided, otherwise a personal access token
+func (conn *DatabricksConn) setTokenSource() error {
+	clientID := conn.GetProp("client_id")
+	clientSecret := conn.GetProp("client_secret")
+
+	if clientID != "" && clientSecret != "" {
+		config := clientcredentials.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			TokenURL:     conn.baseURL() + "/oidc/v1/token",
+			Scopes:       []string{"all-apis"},
+		}
+		ctx := context.WithValue(conn.context.Ctx, oauth2.HTTPClient, &conn.client)
+		conn.tokenSource = oauth2.ReuseTokenSource(nil, config.TokenSource(ctx))
+		return nil
+	}
+
+	token := conn.GetProp("token")
+	if token == "" {
+		token = conn.GetProp("password")
+	}
+	if token == "" {
+		return g.Error("did not provide a token, or client_id & client_secret for Databricks")
+	}
+
+	conn.tokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	return nil
+}
+
+func (conn *DatabricksConn) makeRequest(ctx context.Context, method, route string, body []byte, headers ...map[string]string) (resp *http.Response, err error) {
+	tries := 0
+	URL := route
+	if strings.HasPrefix(route, "/") {
+		URL = conn.baseURL() + route
+	}
+
+	reqHeaders := map[string]string{"Content-Type": "application/json"}
+	if strings.HasPrefix(URL, conn.baseURL()) {
+		// external links are pre-signed, and must not receive the token
+		token, err := conn.tokenSource.Token()
+		if err != nil {
+			return nil, g.Error(err, "could not obtain Databricks access token")
+		}
+		reqHeaders["Authorization"] = "Bearer " + token.AccessToken
+	}
+	if len(headers) > 0 {
+		for k, v := range headers[0] {
+			reqHeaders[k] = v
+		}
+	}
+
+retry:
+	tries++
+	g.Trace("request #%d for %s @ %s", tries, method, URL)
+
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, URL, bodyReader)
+	if err != nil {
+		return nil, g.Error(err, "could not make request for %s @ %s", method, route)
+	}
+
+	for k, v := range reqHeaders {
+		req.Header.Set(k, v)
+	}
+
+	resp, err = conn.client.Do(req)
+	if err != nil {
+		err = g.Error(err, "could not perform request")
+		return
+	}
+
+	// retry logic
+	if (resp.StatusCode >= 502 || resp.StatusCode == 429) && tries <= 4 {
+		resp.Body.Close()
+		delay := tries * 5
+		g.Debug("databricks request failed %d: %s. Retrying in %d seconds.", resp.StatusCode, resp.Status, delay)
+		time.Sleep(time.Duration(delay * int(time.Second)))
+		goto retry
+	}
+
+	if resp.StatusCode >= 400 || resp.StatusCode < 200 {
+		respBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		err = g.Error("Unexpected Response %d: %s (%s %s) => %s", resp.StatusCode, resp.Status, method, route, string(respBytes))
+		return
+	}
+
+	return
+}
+
+// Connect connects to the database
+func (conn *DatabricksConn) Connect(timeOut ...int) (err error) {
+	if conn.Host == "" {
+		return g.Error("did not provide host for Databricks")
+	} else if conn.WarehouseID == "" {
+		return g.Error("did not provide warehouse_id (or http_path) for Databricks")
+	}
+
+	if err = conn.setTokenSource(); err != nil {
+		return g.Error(err, "could not set Databricks credentials")
+	}
+
+	// test the warehouse
+	_, err = conn.executeStatement(conn.context.Ctx, "select 1", "INLINE")
+	if err != nil {
+		return g.Error(err, "could not connect to Databricks warehouse %s", conn.WarehouseID)
+	}
+
+	if !cast.ToBool(conn.GetProp("silent")) {
+		g.Debug(`opened "%s" connection (%s)`, conn.Type, conn.GetProp("sling_conn_id"))
+	}
+
+	conn.SetProp("connected", "true")
+
+	return nil
+}
+
+type databricksColumn struct {
+	Name          string `json:"name"`
+	TypeName      string `json:"type_name"`
+	TypeText      string `json:"type_text"`
+	Position      int    `json:"position"`
+	TypePrecision int    `json:"type_precision"`
+	TypeScale     int    `json:"type_scale"`
+}
+
+type databricksExternalLink struct {
+	ChunkIndex            int    `json:"chunk_index"`
+	RowCount              int64  `json:"row_count"`
+	ExternalLink          string `json:"external_link"`
+	NextChunkInternalLink string `json:"next_chunk_internal_link"`
+}
+
+type databricksChunk struct {
+	ChunkIndex            int                      `json:"chunk_index"`
+	RowCount              int64                    `json:"row_count"`
+	DataArray             [][]any                  `json:"data_array"`
+	ExternalLinks         []databricksExternalLink `json:"external_links"`
+	NextChunkInternalLink string                   `json:"next_chunk_internal_link"`
+}
+
+// nextLink returns the internal link of the following chunk, if any
+func (c *databricksChunk) nextLink() string {
+	if c.NextChunkInternalLink != "" {
+		return c.NextChunkInternalLink
+	}
+	if len(c.ExternalLinks) > 0 {
+		return c.ExternalLinks[len(c.ExternalLinks)-1].NextChunkInternalLink
+	}
+	return ""
+}
+
+type databricksStatement struct {
+	StatementID string `json:"statement_id"`
+	Status      struct {
+		State string `json:"state"`
+		Error struct {
+			ErrorCode string `json:"error_code"`
+			Message   string `json:"message"`
+		} `json:"error"`
+	} `json:"status"`
+	Manifest struct {
+		Schema struct {
+			Columns []databricksColumn `json:"columns"`
+		} `json:"schema"`
+		TotalRowCount int64 `json:"total_row_count"`
+	} `json:"manifest"`
+	Result *databricksChunk `json:"result"`
+}
+
+func (s *databricksStatement) LastInsertId() (int64, error) {
+	return -1, nil
+}
+
+// RowsAffected returns the `num_affected_rows` value of DML statements
+func (s *databricksStatement) RowsAffected() (int64, error) {
+	cols := s.Manifest.Schema.Columns
+	if len(cols) > 0 && cols[0].Name == "num_affected_rows" && s.Result != nil && len(s.Result.DataArray) > 0 {
+		return cast.ToInt64(s.Result.DataArray[0][0]), nil
+	}
+	return -1, nil
+}
+
+// executeStatement submits the statement and polls until it completes.
+// Parameters are bound by name (`:p1`, `:p2`...) as strings, the insert
+// statement casts them to the column types
+func (conn *DatabricksConn) executeStatement(ctx context.Context, query, disposition string, args ...any) (stmt *databricksStatement, err error) {
+	params := make([]map[string]any, len(args))
+	for i, arg := range args {
+		params[i] = g.M("name", g.F("p%d", i+1))
+		if val := databricksParamValue(arg); val != nil {
+			params[i]["value"] = *val
+		}
+	}
+
+	payload := g.M(
+		"statement", query,
+		"warehouse_id", conn.WarehouseID,
+		"wait_timeout", "30s",
+		"on_wait_timeout", "CONTINUE",
+		"disposition", disposition,
+		"format", "JSON_ARRAY",
+	)
+	if conn.Catalog != "" {
+		payload["catalog"] = conn.Catalog
+	}
+	if schema := conn.GetProp("schema"); schema != "" {
+		payload["schema"] = schema
+	}
+	if len(params) > 0 {
+		payload["parameters"] = params
+	}
+
+	stmt = &databricksStatement{}
+	if err = conn.decodeResponse(ctx, "POST", "/api/2.0/sql/statements", []byte(g.Marshal(payload)), stmt); err != nil {
+		return nil, g.Error(err, "could not submit statement")
+	}
+
+	for g.In(stmt.Status.State, "PENDING", "RUNNING") {
+		select {
+		case <-ctx.Done():
+			// cancel on the warehouse, ctx is done so use the connection context
+			conn.makeRequest(conn.context.Ctx, "POST", g.F("/api/2.0/sql/statements/%s/cancel", stmt.StatementID), nil)
+			return nil, g.Error(ctx.Err(), "statement canceled")
+		case <-time.After(time.Second):
+		}
+
+		if err = conn.decodeResponse(ctx, "GET", "/api/2.0/sql/statements/"+stmt.StatementID, nil, stmt); err != nil {
+			return nil, g.Error(err, "could not get statement status")
+		}
+	}
+
+	if stmt.Status.State != "SUCCEEDED" {
+		return nil, g.Error("statement %s: [%s] %s", strings.ToLower(stmt.Status.State), stmt.Status.Error.ErrorCode, stmt.Status.Error.Message)
+	}
+
+	return stmt, nil
+}
+
+func (conn *DatabricksConn) decodeResponse(ctx context.Context, method, route string, body []byte, obj any) (err error) {
+	resp, err := conn.makeRequest(ctx, method, route, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err = json.NewDecoder(resp.Body).Decode(obj); err != nil {
+		return g.Error(err, "could not decode response")
+	}
+	return nil
+}
+
+// databricksParamValue returns the string form of a parameter value,
+// nil meaning NULL
+func databricksParamValue(val any) *string {
+	var s string
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		s = v.Format("2006-01-02 15:04:05.999999Z07:00")
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		s = v.Format("2006-01-02 15:04:05.999999Z07:00")
+	case decimal.Decimal:
+		s = v.String()
+	case []byte:
+		s = string(v)
+	default:
+		s = cast.ToString(v)
+	}
+	return &s
+}
+
+// ExecContext runs a sql query with context, returns `error`
+func (conn *DatabricksConn) ExecContext(ctx context.Context, q string, args ...interface{}) (result sql.Result, err error) {
+	err = reconnectIfClosed(conn)
+	if err != nil {
+		err = g.Error(err, "Could not reconnect")
+		return
+	}
+
+	if strings.TrimSpace(q) == "" {
+		g.Warn("Empty Query")
+		return
+	}
+
+	conn.LogSQL(q, args...)
+
+	stmt, err := conn.executeStatement(ctx, q, "INLINE", args...)
+	if err != nil {
+		if strings.Contains(q, noDebugKey) {
+			err = g.Error(err, "Error executing query")
+		} else {
+			err = g.Error(err, "Error executing %s", env.Clean(conn.Props(), q))
+		}
+		return
+	}
+
+	return stmt, nil
+}
+
+// StreamRowsContext streams the rows of a sql query with context. The results
+// are fetched in chunks from the external links, so large results are not
+// held in memory
+func (conn *DatabricksConn) StreamRowsContext(ctx context.Context, query string, options ...map[string]interface{}) (ds *iop.Datastream, err error) {
+	err = reconnectIfClosed(conn)
+	if err != nil {
+		err = g.Error(err, "Could not reconnect")
+		return
+	}
+
+	opts := getQueryOptions(options)
+	Limit := uint64(0) // infinite
+	if val := cast.ToUint64(opts["limit"]); val > 0 {
+		Limit = val
+	}
+
+	fetchedColumns := iop.Columns{}
+	if val, ok := opts["columns"].(iop.Columns); ok {
+		fetchedColumns = val
+	}
+
+	start := time.Now()
+	if strings.TrimSpace(query) == "" {
+		return ds, g.Error("Empty Query")
+	}
+
+	queryContext := g.NewContext(ctx)
+
+	conn.LogSQL(query)
+
+	stmt, err := conn.executeStatement(queryContext.Ctx, query, "EXTERNAL_LINKS")
+	if err != nil {
+		queryContext.Cancel()
+		if strings.Contains(query, noDebugKey) && !g.IsDebugLow() {
+			return ds, g.Error(err, "SQL Error")
+		}
+		return ds, g.Error(err, "SQL Error for:\n"+query)
+	}
+
+	colTypes := lo.Map(stmt.Manifest.Schema.Columns, func(col databricksColumn, i int) ColumnType {
+		return ColumnType{
+			Name:             col.Name,
+			DatabaseTypeName: col.TypeName,
+			FetchedColumn:    fetchedColumns.GetColumn(col.Name),
+			Precision:        col.TypePrecision,
+			Scale:            col.TypeScale,
+			Nullable:         true,
+			Sourced:          col.TypeName != "DECIMAL",
+		}
+	})
+
+	conn.Data.SQL = query
+	conn.Data.Duration = time.Since(start).Seconds()
+	conn.Data.Rows = [][]interface{}{}
+	conn.Data.Columns = SQLColumns(colTypes, conn)
+	conn.Data.NoDebug = !strings.Contains(query, noDebugKey)
+
+	chunk := stmt.Result
+	rows := [][]any{}
+	rowIdx := 0
+
+	nextFunc := func(it *iop.Iterator) bool {
+		if Limit > 0 && it.Counter >= Limit {
+			return false
+		}
+
+		for rowIdx >= len(rows) {
+			if chunk == nil {
+				return false
+			}
+
+			rows, err = conn.fetchChunkRows(queryContext.Ctx, chunk)
+			if err != nil {
+				it.Context.CaptureErr(g.Error(err, "could not fetch result chunk %d", chunk.ChunkIndex))
+				return false
+			}
+			rowIdx = 0
+
+			if link := chunk.nextLink(); link != "" {
+				chunk = &databricksChunk{}
+				if err = conn.decodeResponse(queryContext.Ctx, "GET", link, nil, chunk); err != nil {
+					it.Context.CaptureErr(g.Error(err, "could not get next result chunk"))
+					return false
+				}
+			} else {
+				chunk = nil
+			}
+		}
+
+		it.Row = rows[rowIdx]
+		rowIdx++
+		return true
+	}
+
+	ds = iop.NewDatastreamIt(queryContext.Ctx, conn.Data.Columns, nextFunc)
+	ds.NoDebug = strings.Contains(query, noDebugKey)
+	ds.Inferred = !InferDBStream && ds.Columns.Sourced()
+	if !ds.NoDebug {
+		// don't set metadata for internal queries
+		ds.SetMetadata(conn.GetProp("METADATA"))
+		conn.setTransforms(ds.Columns)
+		ds.SetConfig(conn.Props())
+	}
+
+	err = ds.Start()
+	if err != nil {
+		queryContext.Cancel()
+		return ds, g.Error(err, "could start datastream")
+	}
+
+	return
+}
+
+// fetchChunkRows returns the rows of a chunk, downloading the external links
+func (conn *DatabricksConn) fetchChunkRows(ctx context.Context, chunk *databricksChunk) (rows [][]any, err error) {
+	if len(chunk.ExternalLinks) == 0 {
+		return chunk.DataArray, nil
+	}
+
+	for _, link := range chunk.ExternalLinks {
+		var linkRows [][]any
+		if err = conn.decodeResponse(ctx, "GET", link.ExternalLink, nil, &linkRows); err != nil {
+			return nil, g.Error(err, "could not download external link")
+		}
+		rows = append(rows, linkRows...)
+	}
+
+	return rows, nil
+}
+
+// GenerateInsertStatement returns the proper INSERT statement. The bound
+// values are strings, so they are cast to the column types
+func (conn *DatabricksConn) GenerateInsertStatement(tableName string, cols iop.Columns, numRows int) string {
+
+	values := make([]string, len(cols))
+	qFields := make([]string, len(cols)) // quoted fields
+
+	valuesStr := ""
+	c := 0
+	for n := 0; n < numRows; n++ {
+		for i, col := range cols {
+			c++
+			values[i] = conn.bindVar(i+1, col.Name, n, c)
+			if col.DbType != "" {
+				values[i] = g.F("cast(%s as %s)", values[i], col.DbType)
+			}
+			qFields[i] = conn.Self().Quote(col.Name)
+		}
+		valuesStr += fmt.Sprintf("(%s),", strings.Join(values, ", "))
+	}
+
+	statement := g.R(
+		"insert into {table} ({fields}) values  {values}",
+		"table", tableName,
+		"fields", strings.Join(qFields, ", "),
+		"values", strings.TrimSuffix(valuesStr, ","),
+	)
+	g.Trace("insert statement: "+strings.Split(statement, ") values  ")[0]+")"+" x %d", numRows)
+	return statement
+}
+
+// GenerateUpsertSQL generates the upsert SQL
+func (conn *DatabricksConn) GenerateUpsertSQL(srcTable string, tgtTable string, pkFields []string) (sql string, err error) {
+
+	upsertMap, err := conn.BaseConn.GenerateUpsertExpressions(srcTable, tgtTable, pkFields)
+	if err != nil {
+		err = g.Error(err, "could not generate upsert variables")
+		return
+	}
+
+	sqlTempl := `
+	merge into {tgt_table} tgt
+	using (select {src_fields} from {src_table}) src
+	on ({src_tgt_pk_equal})
+	when matched then
+		update set {set_fields}
+	when not matched then
+		insert ({insert_fields}) values ({src_fields_values})
+	`
+
+	sql = g.R(
+		sqlTempl,
+		"src_table", srcTable,
+		"tgt_table", tgtTable,
+		"src_tgt_pk_equal", upsertMap["src_tgt_pk_equal"],
+		"set_fields", upsertMap["set_fields"],
+		"insert_fields", upsertMap["insert_fields"],
+		"src_fields", upsertMap["src_fields"],
+		"src_fields_values", strings.ReplaceAll(upsertMap["placeholder_fields"], "ph.", "src."),
+	)
+
+	return
+}
+
+// BulkImportStream bulk import stream
+func (conn *DatabricksConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	df, err := iop.MakeDataFlow(ds)
+	if err != nil {
+		err = g.Error(err, "Could not MakeDataFlow")
+		return
+	}
+	return conn.BulkImportFlow(tableFName, df)
+}
+
+// BulkImportFlow imports via a Unity Catalog volume when the `volume` prop
+// is provided, otherwise with batch inserts
+func (conn *DatabricksConn) BulkImportFlow(tableFName string, df *iop.Dataflow) (count uint64, err error) {
+	defer df.CleanUp()
+
+	// set OnSchemaChange
+	if df != nil && cast.ToBool(conn.GetProp("adjust_column_type")) {
+		oldOnColumnChanged := df.OnColumnChanged
+		df.OnColumnChanged = func(col iop.Column) error {
+			// prevent any new writers
+			conn.Mux.Lock()
+			defer conn.Mux.Unlock()
+
+			// use pre-defined function
+			if err := oldOnColumnChanged(col); err != nil {
+				return g.Error(err, "could not process ColumnChange for Databricks")
+			}
+			return nil
+		}
+	}
+
+	if conn.GetProp("volume") != "" && conn.GetProp("use_bulk") != "false" {
+		settingMppBulkImportFlow(conn, iop.GzipCompressorType)
+		return conn.CopyViaVolume(tableFName, df)
+	}
+
+	for ds := range df.StreamCh {
+		c, err := conn.InsertBatchStream(tableFName, ds)
+		if err != nil {
+			return 0, g.Error(err, "could not insert")
+		}
+		count += c
+	}
+
+	return count, nil
+}
+
+// volumePath returns the volume folder path for the table. The `volume` prop
+// can be a full path (`/Volumes/catalog/schema/volume`), a qualified name
+// (`catalog.schema.volume`) or a volume name in the table's schema
+func (conn *DatabricksConn) volumePath(table Table) (string, error) {
+	volume := strings.TrimSuffix(conn.GetProp("volume"), "/")
+	if !strings.HasPrefix(volume, "/Volumes/") {
+		parts := strings.Split(volume, ".")
+		switch len(parts) {
+		case 1:
+			catalog := lo.Ternary(table.Database != "", table.Database, conn.Catalog)
+			if catalog == "" || table.Schema == "" {
+				return "", g.Error("cannot resolve volume %s without a catalog and schema", volume)
+			}
+			parts = []string{catalog, table.Schema, volume}
+		case 3:
+		default:
+			return "", g.Error("invalid volume: %s", volume)
+		}
+		volume = "/Volumes/" + strings.Join(parts, "/")
+	}
+
+	return path.Join(volume, "sling", env.CleanTableName(table.FullName()), g.NowFileStr()), nil
+}
+
+// CopyViaVolume writes the dataflow into gzipped CSV files, uploads them
+// to a Unity Catalog volume and loads them with COPY INTO
+// https://docs.databricks.com/en/sql/language-manual/delta-copy-into.html
+func (conn *DatabricksConn) CopyViaVolume(tableFName string, df *iop.Dataflow) (count uint64, err error) {
+
+	loadContext := bulkLoadContext(conn)
+
+	table, err := ParseTableName(tableFName, conn.Type)
+	if err != nil {
+		return 0, g.Error(err, "could not parse table name: "+tableFName)
+	}
+
+	volumeFolderPath, err := conn.volumePath(table)
+	if err != nil {
+		return 0, g.Error(err, "could not determine volume path")
+	}
+
+	// Write the ds to a temp file
+	folderPath := path.Join(env.GetTempFolder(), "databricks", "put", env.CleanTableName(tableFName), g.NowFileStr())
+
+	// delete folder when done
+	df.Defer(func() { env.RemoveAllLocalTempFile(folderPath) })
+
+	// delete volume files when done
+	df.Defer(func() {
+		if err := conn.VolumeDelete(volumeFolderPath); err != nil {
+			g.Warn("could not delete volume folder %s: %s", volumeFolderPath, err.Error())
+		}
+	})
+
+	fileReadyChn := fileReadyChannel(conn, 10000)
+	go func() {
+		fs, err := filesys.NewFileSysClient(dbio.TypeFileLocal, conn.PropArrExclude("url")...)
+		if err != nil {
+			df.Context.CaptureErr(g.Error(err, "Could not get fs client for Local"))
+			return
+		}
+
+		config := iop.LoaderStreamConfig(true)
+		config.DatetimeFormat = conn.Type.GetTemplateValue("variable.timestampz_layout")
+		_, err = fs.WriteDataflowReady(df, folderPath, fileReadyChn, config)
+
+		if err != nil {
+			df.Context.CaptureErr(g.Error(err, "Error writing dataflow to disk: "+folderPath))
+			return
+		}
+
+	}()
+
+	doPut := func(file filesys.FileReady) {
+		defer loadContext.Wg.Write.Done()
+		defer func() { env.RemoveLocalTempFile(file.Node.Path()) }()
+
+		volumeFilePath := path.Join(volumeFolderPath, path.Base(file.Node.Path()))
+		if err := conn.VolumePUT(file.Node.Path(), volumeFilePath); err != nil {
+			df.Context.CaptureErr(g.Error(err, "Error copying to Databricks volume: "+volumeFolderPath))
+		}
+	}
+
+	for file := range fileReadyChn {
+		if df.Err() != nil || loadContext.Err() != nil {
+			break
+		}
+
+		conn.Mux.Lock() // to not collide with schema change
+		loadContext.Wg.Write.Add()
+		go doPut(file)
+		conn.Mux.Unlock()
+	}
+
+	loadContext.Wg.Write.Wait()
+
+	if loadContext.Err() != nil {
+		return 0, loadContext.Err()
+	}
+
+	if df.Err() != nil {
+		return 0, g.Error(df.Err())
+	}
+
+	// cast the CSV strings to the table column types
+	columns, err := conn.GetColumns(tableFName, df.Columns.Names()...)
+	if err != nil {
+		return 0, g.Error(err, "could not get column list")
+	}
+
+	srcColumns := make([]string, len(columns))
+	for i, col := range columns {
+		colQ := conn.Quote(col.Name)
+		dbType := strings.ToLower(col.DbType)
+		switch {
+		case dbType == "variant":
+			srcColumns[i] = g.F("parse_json(%s) as %s", colQ, colQ)
+		case strings.HasPrefix(dbType, "array") || strings.HasPrefix(dbType, "map") || strings.HasPrefix(dbType, "struct"):
+			srcColumns[i] = g.F("from_json(%s, '%s') as %s", colQ, col.DbType, colQ)
+		case dbType == "" || strings.HasPrefix(dbType, "string"):
+			srcColumns[i] = colQ
+		default:
+			srcColumns[i] = g.F("cast(%s as %s) as %s", colQ, col.DbType, colQ)
+		}
+	}
+
+	sql := g.R(
+		conn.template.Core["copy_from_volume"],
+		"table", tableFName,
+		"src_columns", strings.Join(srcColumns, ", "),
+		"volume_path", volumeFolderPath,
+	)
+
+	if _, err = conn.Exec(sql); err != nil {
+		return 0, g.Error(err, "Error with COPY INTO")
+	}
+
+	return df.Count(), nil
+}
+
+// VolumePUT uploads a local file into a volume with the Files API
+func (conn *DatabricksConn) VolumePUT(filePath, volumeFilePath string) (err error) {
+	body, err := os.ReadFile(filePath)
+	if err != nil {
+		return g.Error(err, "could not read file %s", filePath)
+	}
+
+	resp, err := conn.makeRequest(
+		conn.context.Ctx, "PUT", "/api/2.0/fs/files"+volumeFilePath+"?overwrite=true",
+		body, map[string]string{"Content-Type": "application/octet-stream"},
+	)
+	if err != nil {
+		return g.Error(err, "could not PUT file %s", volumeFilePath)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// VolumeDelete deletes the files of a volume folder, and the folder
+func (conn *DatabricksConn) VolumeDelete(volumeFolderPath string) (err error) {
+	var listing struct {
+		Contents []struct {
+			Path        string `json:"path"`
+			IsDirectory bool   `json:"is_directory"`
+		} `json:"contents"`
+	}
+
+	err = conn.decodeResponse(conn.context.Ctx, "GET", "/api/2.0/fs/directories"+volumeFolderPath, nil, &listing)
+	if err != nil {
+		if strings.Contains(err.Error(), "404") {
+			return nil // nothing was uploaded
+		}
+		return g.Error(err, "could not list volume folder")
+	}
+
+	for _, entry := range listing.Contents {
+		route := lo.Ternary(entry.IsDirectory, "/api/2.0/fs/directories", "/api/2.0/fs/files") + entry.Path
+		resp, err := conn.makeRequest(conn.context.Ctx, "DELETE", route, nil)
+		if err != nil {
+			return g.Error(err, "could not delete %s", entry.Path)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := conn.makeRequest(conn.context.Ctx, "DELETE", "/api/2.0/fs/directories"+volumeFolderPath, nil)
+	if err != nil {
+		return g.Error(err, "could not delete %s", volumeFolderPath)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// InsertBatchStream inserts a stream into a table in batches
+func (conn *DatabricksConn) InsertBatchStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+
+	var columns iop.Columns
+	batchSize := cast.ToInt(conn.GetTemplateValue("variable.batch_values")) / len(ds.Columns)
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	// default 10 concurrent requests
+	concurrency := 10
+	if val := conn.GetProp("insert_concurrency"); val != "" {
+		concurrency = cast.ToInt(val)
+	}
+	insertContext := g.NewContext(ds.Context.Ctx, concurrency)
+
+	// in case schema change is needed, cannot alter while inserting
+	mux := ds.Context.Mux
+	if df := ds.Df(); df != nil {
+		mux = df.Context.Mux
+	}
+
+	insertBatch := func(bColumns iop.Columns, rows [][]interface{}) error {
+		defer insertContext.Wg.Write.Done()
+
+		insCols, err := conn.ValidateColumnNames(columns, bColumns.Names(), true)
+		if err != nil {
+			return g.Error(err, "columns mismatch")
+		}
+
+		insertTemplate := conn.Self().GenerateInsertStatement(tableFName, insCols, len(rows))
+		vals := []interface{}{}
+		for _, row := range rows {
+			vals = append(vals, row...)
+		}
+
+		_, err = conn.ExecContext(ds.Context.Ctx, insertTemplate+noDebugKey, vals...)
+		if err != nil {
+			batchErrStr := g.F("Batch Size: %d rows x %d cols = %d (%d vals)", len(rows), len(bColumns), len(rows)*len(bColumns), len(vals))
+			if len(insertTemplate) > 3000 {
+				insertTemplate = insertTemplate[:3000]
+			}
+			g.Debug(g.F("%s\n%s \n%s", err.Error(), batchErrStr, fmt.Sprintf("Insert: %s", insertTemplate)))
+			insertContext.CaptureErr(err)
+			return err
+		}
+
+		return nil
+	}
+
+	batchRows := [][]any{}
+	var batch *iop.Batch
+
+	for batch = range ds.BatchChan {
+
+		if batch.ColumnsChanged() || batch.IsFirst() {
+			// make sure fields match
+			mux.Lock()
+			insertContext.Wg.Write.Wait() // wait for any pending queries
+			columns, err = conn.GetColumns(tableFName, batch.Columns.Names()...)
+			if err != nil {
+				mux.Unlock()
+				err = g.Error(err, "could not get column list")
+				return
+			}
+			mux.Unlock()
+		}
+
+		for row := range batch.Rows {
+			batchRows = append(batchRows, row)
+			count++
+			if len(batchRows) == batchSize {
+				insertContext.Wg.Write.Add()
+				select {
+				case <-insertContext.Ctx.Done():
+					return count, insertContext.Err()
+				case <-ds.Context.Ctx.Done():
+					return count, ds.Context.Err()
+				default:
+					go insertBatch(batch.Columns, batchRows)
+				}
+
+				// reset
+				batchRows = [][]interface{}{}
+			}
+		}
+
+	}
+
+	// remaining batch
+	if len(batchRows) > 0 {
+		g.Trace("remaining batchSize %d", len(batchRows))
+		insertContext.Wg.Write.Add()
+		err = insertBatch(batch.Columns, batchRows)
+		if err != nil {
+			return count - cast.ToUint64(len(batchRows)), g.Error(err, "insertBatch")
+		}
+	}
+
+	insertContext.Wg.Write.Wait()
+
+	if err = insertContext.Err(); err != nil {
+		return count, g.Error(err, "insertBatch")
+	}
+
+	return
+}
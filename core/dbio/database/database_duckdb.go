@@ -178,16 +178,56 @@ func (conn *DuckDbConn) InsertStream(tableFName string, ds *iop.Datastream) (cou
 	return conn.BulkImportFlow(tableFName, df)
 }
 
+// copyMethod returns the bulk import method from the `copy_method` property.
+// Defaults to `appender` when using the native driver.
+func (conn *DuckDbConn) copyMethod() string {
+	if method := conn.GetProp("copy_method"); method != "" {
+		return method
+	} else if conn.duck.IsNative() {
+		return "appender"
+	}
+	return ""
+}
+
+// importViaAppender appends the rows with the appender of the native driver,
+// instead of generating SQL. Falls back to CSV files if not possible.
+func (conn *DuckDbConn) importViaAppender(tableFName string, df *iop.Dataflow) (count uint64, err error) {
+	table, err := ParseConnTableName(tableFName, conn)
+	if err != nil {
+		err = g.Error(err, "could not get table name for import")
+		return
+	}
+
+	tableColumns, err := conn.GetColumns(tableFName)
+	if err != nil {
+		return 0, g.Error(err, "could not get columns for %s", tableFName)
+	}
+
+	if !conn.duck.CanAppend(tableColumns) {
+		g.Debug("cannot use appender for %s (requires native driver and supported column types), using csv files", tableFName)
+		return conn.importViaTempCSVs(tableFName, df)
+	}
+
+	_, err = conn.duck.Append(conn.Context().Ctx, table.Schema, table.Name, tableColumns, iop.MergeDataflow(df))
+	if err != nil {
+		return df.Count(), g.Error(err, "could not append into %s", tableFName)
+	} else if err = df.Err(); err != nil {
+		return df.Count(), g.Error(err)
+	}
+
+	return df.Count(), nil
+}
+
 func (conn *DuckDbConn) importViaTempCSVs(tableFName string, df *iop.Dataflow) (count uint64, err error) {
 
-	table, err := ParseTableName(tableFName, conn.GetType())
+	table, err := ParseConnTableName(tableFName, conn)
 	if err != nil {
 		err = g.Error(err, "could not get table name for import")
 		return
 	}
 
 	folderPath := path.Join(env.GetTempFolder(), "duckdb", "import", env.CleanTableName(tableFName), g.NowFileStr())
-	fileReadyChn := make(chan filesys.FileReady, 3)
+	fileReadyChn := fileReadyChannel(conn, 3)
 
 	go func() {
 		fs, err := filesys.NewFileSysClient(dbio.TypeFileLocal, conn.PropArrExclude("url")...)
@@ -245,7 +285,7 @@ func (conn *DuckDbConn) importViaTempCSVs(tableFName string, df *iop.Dataflow) (
 
 func (conn *DuckDbConn) importViaHTTP(tableFName string, df *iop.Dataflow) (count uint64, err error) {
 
-	table, err := ParseTableName(tableFName, conn.GetType())
+	table, err := ParseConnTableName(tableFName, conn)
 	if err != nil {
 		err = g.Error(err, "could not get table name for import")
 		return
@@ -17,7 +17,9 @@ import (
 )
 
 func (conn *DuckDbConn) BulkImportFlow(tableFName string, df *iop.Dataflow) (count uint64, err error) {
-	switch conn.GetProp("copy_method") {
+	switch conn.copyMethod() {
+	case "appender":
+		return conn.importViaAppender(tableFName, df)
 	case "named_pipes":
 		return conn.importViaNamedPipe(tableFName, df)
 	case "csv_files":
@@ -31,7 +33,7 @@ func (conn *DuckDbConn) BulkImportFlow(tableFName string, df *iop.Dataflow) (cou
 
 func (conn *DuckDbConn) importViaNamedPipe(tableFName string, df *iop.Dataflow) (count uint64, err error) {
 
-	table, err := ParseTableName(tableFName, conn.GetType())
+	table, err := ParseConnTableName(tableFName, conn)
 	if err != nil {
 		err = g.Error(err, "could not get table name for import")
 		return
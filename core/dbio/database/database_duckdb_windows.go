@@ -7,7 +7,9 @@ import (
 )
 
 func (conn *DuckDbConn) BulkImportFlow(tableFName string, df *iop.Dataflow) (count uint64, err error) {
-	switch conn.GetProp("copy_method") {
+	switch conn.copyMethod() {
+	case "appender":
+		return conn.importViaAppender(tableFName, df)
 	case "csv_files":
 		return conn.importViaTempCSVs(tableFName, df)
 	case "http_server":
@@ -336,7 +336,7 @@ func (conn *ElasticsearchConn) StreamRowsContext(ctx context.Context, tableName
 	}
 
 	// Create the search request
-	table, _ := ParseTableName(tableName, conn.Type)
+	table, _ := ParseConnTableName(tableName, conn)
 	indexName := table.Name
 	res, err := conn.Client.Search(
 		conn.Client.Search.WithContext(ctx),
@@ -367,10 +367,10 @@ func (conn *ElasticsearchConn) StreamRowsContext(ctx context.Context, tableName
 	// Create base datastream
 	ds = iop.NewDatastreamContext(ctx, iop.Columns{})
 
-	// Handle flattening option
-	flatten := true
-	if val := conn.GetProp("flatten"); val != "" {
-		flatten = cast.ToBool(val)
+	// Handle flattening options
+	flatten, err := iop.ParseFlattenOptions(conn.Props(), true)
+	if err != nil {
+		return ds, g.Error(err, "invalid flatten options")
 	}
 
 	// Create a custom decoder for Elasticsearch scrolling
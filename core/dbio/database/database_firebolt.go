@@ -0,0 +1,847 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/flarco/g"
+	"github.com/flarco/g/net"
+	"github.com/samber/lo"
+	"github.com/shopspring/decimal"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/spf13/cast"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// FireboltConn is a Firebolt connection. Statements are submitted with the
+// Firebolt REST API, and bulk loads are staged in S3 then inserted from
+// an external table
+type FireboltConn struct {
+	BaseConn
+	URL         string
+	Account     string
+	Engine      string
+	EngineURL   string
+	Mux         sync.Mutex
+	client      http.Client
+	tokenSource oauth2.TokenSource
+	params      url.Values // the session parameters, e.g. database & engine
+	paramsMux   sync.Mutex
+}
+
+// Init initiates the object
+func (conn *FireboltConn) Init() error {
+
+	conn.BaseConn.URL = conn.URL
+	conn.BaseConn.Type = dbio.TypeDbFirebolt
+
+	conn.Account = conn.GetProp("account")
+	conn.Engine = conn.GetProp("engine")
+	conn.EngineURL = conn.GetProp("engine_url")
+
+	// firebolt://{client_id}:{client_secret}@{account}/{database}?engine={engine}
+	if u, err := net.NewURL(conn.URL); err == nil {
+		conn.Account = lo.Ternary(conn.Account != "", conn.Account, u.Hostname())
+		conn.Engine = lo.Ternary(conn.Engine != "", conn.Engine, u.GetParam("engine"))
+		for key, val := range map[string]string{
+			"client_id":     u.Username(),
+			"client_secret": u.Password(),
+			"database":      strings.Trim(u.Path(), "/"),
+		} {
+			if conn.GetProp(key) == "" && val != "" {
+				conn.SetProp(key, val)
+			}
+		}
+	}
+
+	conn.client = http.Client{Timeout: 30 * time.Minute}
+	conn.params = url.Values{}
+
+	instance := Connection(conn)
+	conn.BaseConn.instance = &instance
+
+	return conn.BaseConn.Init()
+}
+
+// authURL returns the url of the identity service
+func (conn *FireboltConn) authURL() string {
+	if val := conn.GetProp("auth_url"); val != "" {
+		return strings.TrimSuffix(val, "/")
+	}
+	return "https://id.app.firebolt.io"
+}
+
+// apiURL returns the url of the account api
+func (conn *FireboltConn) apiURL() string {
+	if val := conn.GetProp("api_url"); val != "" {
+		return strings.TrimSuffix(val, "/")
+	}
+	return "https://api.app.firebolt.io"
+}
+
+// engineURL returns the url of the engine running the queries. The api
+// returns it without a scheme
+func (conn *FireboltConn) engineURL() string {
+	engineURL := strings.TrimSuffix(conn.EngineURL, "/")
+	if strings.HasPrefix(engineURL, "http://") || strings.HasPrefix(engineURL, "https://") {
+		return engineURL
+	}
+	return "https://" + engineURL
+}
+
+// setTokenSource uses the client credentials of the service account
+func (conn *FireboltConn) setTokenSource() error {
+	clientID := conn.GetProp("client_id")
+	clientSecret := conn.GetProp("client_secret")
+	if clientID == "" || clientSecret == "" {
+		return g.Error("did not provide client_id & client_secret for Firebolt")
+	}
+
+	config := clientcredentials.Config{
+		ClientID:       clientID,
+		ClientSecret:   clientSecret,
+		TokenURL:       conn.authURL() + "/oauth/token",
+		EndpointParams: url.Values{"audience": {"https://api.firebolt.io"}},
+		AuthStyle:      oauth2.AuthStyleInParams,
+	}
+	ctx := context.WithValue(conn.context.Ctx, oauth2.HTTPClient, &conn.client)
+	conn.tokenSource = oauth2.ReuseTokenSource(nil, config.TokenSource(ctx))
+	return nil
+}
+
+func (conn *FireboltConn) makeRequest(ctx context.Context, method, URL string, body []byte) (resp *http.Response, err error) {
+	tries := 0
+
+	token, err := conn.tokenSource.Token()
+	if err != nil {
+		return nil, g.Error(err, "could not get Firebolt access token")
+	}
+
+retry:
+	tries++
+	g.Trace("request #%d for %s @ %s", tries, method, URL)
+
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, URL, bodyReader)
+	if err != nil {
+		return nil, g.Error(err, "could not make request for %s @ %s", method, URL)
+	}
+
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	resp, err = conn.client.Do(req)
+	if err != nil {
+		err = g.Error(err, "could not perform request")
+		return
+	}
+
+	// retry logic
+	if (resp.StatusCode >= 502 || resp.StatusCode == 429) && tries <= 4 {
+		resp.Body.Close()
+		delay := tries * 5
+		g.Debug("firebolt request failed %d: %s. Retrying in %d seconds.", resp.StatusCode, resp.Status, delay)
+		time.Sleep(time.Duration(delay * int(time.Second)))
+		goto retry
+	}
+
+	if resp.StatusCode >= 400 || resp.StatusCode < 200 {
+		respBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		err = g.Error("Unexpected Response %d: %s => %s", resp.StatusCode, resp.Status, string(respBytes))
+		return
+	}
+
+	return
+}
+
+// Connect connects to the database
+func (conn *FireboltConn) Connect(timeOut ...int) (err error) {
+	if conn.Account == "" && conn.EngineURL == "" {
+		return g.Error("did not provide account for Firebolt")
+	}
+
+	if err = conn.setTokenSource(); err != nil {
+		return g.Error(err, "could not set Firebolt credentials")
+	}
+
+	if err = conn.resolveEngine(conn.context.Ctx); err != nil {
+		return g.Error(err, "could not connect to Firebolt")
+	}
+
+	if !cast.ToBool(conn.GetProp("silent")) {
+		g.Debug(`opened "%s" connection (%s)`, conn.Type, conn.GetProp("sling_conn_id"))
+	}
+
+	conn.SetProp("connected", "true")
+
+	return nil
+}
+
+// resolveEngine gets the url of the account's system engine, unless the
+// `engine_url` prop is provided, then switches to the database and engine.
+// The server replies with the session parameters and the endpoint to use
+func (conn *FireboltConn) resolveEngine(ctx context.Context) (err error) {
+	if conn.EngineURL == "" {
+		resp, err := conn.makeRequest(ctx, "GET", g.F("%s/web/v3/account/%s/engineUrl", conn.apiURL(), url.PathEscape(conn.Account)), nil)
+		if err != nil {
+			return g.Error(err, "could not get system engine url for account %s", conn.Account)
+		}
+		defer resp.Body.Close()
+
+		var result struct {
+			EngineURL string `json:"engineUrl"`
+		}
+		if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return g.Error(err, "could not decode system engine url")
+		}
+		conn.EngineURL = result.EngineURL
+	}
+
+	if database := conn.GetProp("database"); database != "" {
+		if err = conn.execQuery(ctx, g.F(`use database "%s"`, database)); err != nil {
+			return g.Error(err, "could not use database %s", database)
+		}
+	}
+
+	if conn.Engine != "" {
+		if err = conn.execQuery(ctx, g.F(`use engine "%s"`, conn.Engine)); err != nil {
+			return g.Error(err, "could not use engine %s", conn.Engine)
+		}
+	} else {
+		// test the system engine
+		if err = conn.execQuery(ctx, "select 1"); err != nil {
+			return g.Error(err, "could not query system engine")
+		}
+	}
+
+	return nil
+}
+
+// submitQuery posts the query to the engine. The session updates in the
+// response headers are applied to the following queries
+func (conn *FireboltConn) submitQuery(ctx context.Context, query string) (resp *http.Response, err error) {
+	conn.paramsMux.Lock()
+	params := url.Values{}
+	for key, vals := range conn.params {
+		params[key] = vals
+	}
+	engineURL := conn.engineURL()
+	conn.paramsMux.Unlock()
+
+	params.Set("output_format", "JSON_Compact")
+
+	resp, err = conn.makeRequest(ctx, "POST", engineURL+"/?"+params.Encode(), []byte(query))
+	if err != nil {
+		return nil, err
+	}
+
+	conn.paramsMux.Lock()
+	defer conn.paramsMux.Unlock()
+
+	// e.g. `database=my_db`
+	if val := resp.Header.Get("Firebolt-Update-Parameters"); val != "" {
+		for _, pair := range strings.Split(val, ",") {
+			if key, value, ok := strings.Cut(pair, "="); ok {
+				conn.params.Set(strings.TrimSpace(key), strings.TrimSpace(value))
+			}
+		}
+	}
+
+	// e.g. `https://my-engine.firebolt.io?engine=my_engine`
+	if val := resp.Header.Get("Firebolt-Update-Endpoint"); val != "" {
+		u, err := url.Parse(val)
+		if err != nil {
+			resp.Body.Close()
+			return nil, g.Error(err, "invalid engine endpoint: %s", val)
+		}
+		for key := range u.Query() {
+			conn.params.Set(key, u.Query().Get(key))
+		}
+		u.RawQuery = ""
+		conn.EngineURL = u.String()
+	}
+
+	return resp, nil
+}
+
+// execQuery submits the query and discards the response
+func (conn *FireboltConn) execQuery(ctx context.Context, query string) (err error) {
+	resp, err := conn.submitQuery(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+type fireboltColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type fireboltResult struct{}
+
+func (r fireboltResult) LastInsertId() (int64, error) {
+	return -1, nil
+}
+
+func (r fireboltResult) RowsAffected() (int64, error) {
+	return -1, nil
+}
+
+// ExecContext runs a sql query with context, returns `error`
+func (conn *FireboltConn) ExecContext(ctx context.Context, q string, args ...interface{}) (result sql.Result, err error) {
+	err = reconnectIfClosed(conn)
+	if err != nil {
+		err = g.Error(err, "Could not reconnect")
+		return
+	}
+
+	if len(args) > 0 {
+		return nil, g.Error("Firebolt does not support bind parameters")
+	}
+
+	if strings.TrimSpace(q) == "" {
+		g.Warn("Empty Query")
+		return
+	}
+
+	conn.LogSQL(q)
+
+	err = conn.execQuery(ctx, q)
+	if err != nil {
+		if strings.Contains(q, noDebugKey) {
+			err = g.Error(err, "Error executing query")
+		} else {
+			err = g.Error(err, "Error executing %s", env.Clean(conn.Props(), q))
+		}
+		return
+	}
+
+	return fireboltResult{}, nil
+}
+
+// StreamRowsContext streams the rows of a sql query with context. The response
+// is decoded as it is received, so large results are not held in memory
+func (conn *FireboltConn) StreamRowsContext(ctx context.Context, query string, options ...map[string]interface{}) (ds *iop.Datastream, err error) {
+	err = reconnectIfClosed(conn)
+	if err != nil {
+		err = g.Error(err, "Could not reconnect")
+		return
+	}
+
+	opts := getQueryOptions(options)
+	Limit := uint64(0) // infinite
+	if val := cast.ToUint64(opts["limit"]); val > 0 {
+		Limit = val
+	}
+
+	fetchedColumns := iop.Columns{}
+	if val, ok := opts["columns"].(iop.Columns); ok {
+		fetchedColumns = val
+	}
+
+	start := time.Now()
+	if strings.TrimSpace(query) == "" {
+		return ds, g.Error("Empty Query")
+	}
+
+	queryContext := g.NewContext(ctx)
+
+	conn.LogSQL(query)
+
+	resp, err := conn.submitQuery(queryContext.Ctx, query)
+	if err != nil {
+		queryContext.Cancel()
+		if strings.Contains(query, noDebugKey) && !g.IsDebugLow() {
+			return ds, g.Error(err, "SQL Error")
+		}
+		return ds, g.Error(err, "SQL Error for:\n"+query)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+
+	// the columns precede the data in the response, e.g.
+	// {"meta":[{"name":"id","type":"int"}],"data":[[1],[2]],"rows":2,"statistics":{"elapsed":0.01}}
+	fbColumns, err := fireboltSeekData(decoder)
+	if err != nil {
+		resp.Body.Close()
+		queryContext.Cancel()
+		return ds, g.Error(err, "could not decode response for:\n"+query)
+	}
+
+	colTypes := lo.Map(fbColumns, func(col fireboltColumn, i int) ColumnType {
+		dbType, precision, scale := fireboltColumnType(col.Type)
+		return ColumnType{
+			Name:             col.Name,
+			DatabaseTypeName: dbType,
+			FetchedColumn:    fetchedColumns.GetColumn(col.Name),
+			Precision:        precision,
+			Scale:            scale,
+			Nullable:         true,
+			Sourced:          dbType != "numeric",
+		}
+	})
+
+	conn.Data.SQL = query
+	conn.Data.Duration = time.Since(start).Seconds()
+	conn.Data.Rows = [][]interface{}{}
+	conn.Data.Columns = SQLColumns(colTypes, conn)
+	conn.Data.NoDebug = !strings.Contains(query, noDebugKey)
+
+	nextFunc := func(it *iop.Iterator) bool {
+		if Limit > 0 && it.Counter >= Limit {
+			resp.Body.Close()
+			return false
+		}
+
+		if fbColumns == nil || !decoder.More() {
+			resp.Body.Close()
+			return false
+		}
+
+		var row []any
+		if err := decoder.Decode(&row); err != nil {
+			it.Context.CaptureErr(g.Error(err, "error decoding row"))
+			resp.Body.Close()
+			return false
+		}
+
+		for i, val := range row {
+			if num, ok := val.(json.Number); ok {
+				row[i] = num.String() // keep the precision of large numbers
+			}
+		}
+
+		it.Row = row
+		return true
+	}
+
+	ds = iop.NewDatastreamIt(queryContext.Ctx, conn.Data.Columns, nextFunc)
+	ds.NoDebug = strings.Contains(query, noDebugKey)
+	ds.Inferred = !InferDBStream && ds.Columns.Sourced()
+	if !ds.NoDebug {
+		// don't set metadata for internal queries
+		ds.SetMetadata(conn.GetProp("METADATA"))
+		conn.setTransforms(ds.Columns)
+		ds.SetConfig(conn.Props())
+	}
+
+	err = ds.Start()
+	if err != nil {
+		queryContext.Cancel()
+		return ds, g.Error(err, "could start datastream")
+	}
+
+	return
+}
+
+// fireboltSeekData reads the response until the data array, and returns the
+// columns. The columns are nil if the response has no result set
+func fireboltSeekData(decoder *json.Decoder) (columns []fireboltColumn, err error) {
+	t, err := decoder.Token()
+	if err == io.EOF {
+		return nil, nil // empty body
+	} else if err != nil {
+		return nil, err
+	} else if t != json.Delim('{') {
+		return nil, g.Error("invalid JSON structure: expected {, got %v", t)
+	}
+
+	for decoder.More() {
+		t, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t {
+		case "meta":
+			if err = decoder.Decode(&columns); err != nil {
+				return nil, g.Error(err, "error decoding columns")
+			}
+			if columns == nil {
+				columns = []fireboltColumn{}
+			}
+		case "data":
+			if columns == nil {
+				return nil, g.Error("invalid JSON structure: expected meta before data")
+			}
+			if t, err := decoder.Token(); err != nil {
+				return nil, err
+			} else if t != json.Delim('[') {
+				return nil, g.Error("invalid JSON structure: expected [, got %v", t)
+			}
+			return columns, nil
+		default:
+			var skip json.RawMessage
+			if err = decoder.Decode(&skip); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return nil, nil // no result set
+}
+
+// fireboltColumnType returns the type name, precision and scale of a result
+// column type, e.g. `numeric(38, 9) null`
+func fireboltColumnType(typ string) (dbType string, precision, scale int) {
+	dbType = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(typ)), " null")
+	name, args, ok := strings.Cut(dbType, "(")
+	if !ok {
+		return dbType, 0, 0
+	}
+
+	if name == "numeric" || name == "decimal" {
+		parts := strings.Split(strings.TrimSuffix(args, ")"), ",")
+		precision = cast.ToInt(strings.TrimSpace(parts[0]))
+		if len(parts) > 1 {
+			scale = cast.ToInt(strings.TrimSpace(parts[1]))
+		}
+	}
+
+	return name, precision, scale
+}
+
+// fireboltLiteral returns the value as a sql literal. Values are quoted
+// strings, cast to the column types by the insert statement
+func fireboltLiteral(val any) string {
+	var s string
+	switch v := val.(type) {
+	case nil:
+		return "null"
+	case time.Time:
+		s = v.Format("2006-01-02 15:04:05.999999-07:00")
+	case *time.Time:
+		if v == nil {
+			return "null"
+		}
+		s = v.Format("2006-01-02 15:04:05.999999-07:00")
+	case decimal.Decimal:
+		s = v.String()
+	case []byte:
+		s = `\x` + hex.EncodeToString(v)
+	default:
+		s = cast.ToString(v)
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// GenerateInsertValues returns the insert statement with the values of the
+// rows as literals, since the REST API does not bind parameters
+func (conn *FireboltConn) GenerateInsertValues(tableName string, cols iop.Columns, rows [][]any) string {
+	valuesRows := make([]string, len(rows))
+	for r, row := range rows {
+		values := make([]string, len(cols))
+		for i, col := range cols {
+			var val any
+			if i < len(row) {
+				val = row[i]
+			}
+			values[i] = fireboltLiteral(val)
+			if val != nil && col.DbType != "" && !strings.EqualFold(col.DbType, "text") {
+				values[i] = g.F("cast(%s as %s)", values[i], col.DbType)
+			}
+		}
+		valuesRows[r] = "(" + strings.Join(values, ", ") + ")"
+	}
+
+	return g.R(
+		"insert into {table} ({fields}) values {values}",
+		"table", tableName,
+		"fields", strings.Join(conn.QuoteNames(cols.Names()...), ", "),
+		"values", strings.Join(valuesRows, ", "),
+	)
+}
+
+// BulkImportStream bulk import stream
+func (conn *FireboltConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	df, err := iop.MakeDataFlow(ds)
+	if err != nil {
+		err = g.Error(err, "Could not MakeDataFlow")
+		return
+	}
+	return conn.BulkImportFlow(tableFName, df)
+}
+
+// BulkImportFlow imports via S3 when the `AWS_BUCKET` prop is provided,
+// otherwise with batch inserts
+func (conn *FireboltConn) BulkImportFlow(tableFName string, df *iop.Dataflow) (count uint64, err error) {
+	defer df.CleanUp()
+
+	// set OnSchemaChange
+	if df != nil && cast.ToBool(conn.GetProp("adjust_column_type")) {
+		oldOnColumnChanged := df.OnColumnChanged
+		df.OnColumnChanged = func(col iop.Column) error {
+			// prevent any new writers
+			conn.Mux.Lock()
+			defer conn.Mux.Unlock()
+
+			// use pre-defined function
+			if err := oldOnColumnChanged(col); err != nil {
+				return g.Error(err, "could not process ColumnChange for Firebolt")
+			}
+			return nil
+		}
+	}
+
+	if conn.GetProp("AWS_BUCKET") != "" && conn.GetProp("use_bulk") != "false" {
+		return conn.CopyViaS3(tableFName, df)
+	}
+
+	for ds := range df.StreamCh {
+		c, err := conn.InsertBatchStream(tableFName, ds)
+		if err != nil {
+			return 0, g.Error(err, "could not insert")
+		}
+		count += c
+	}
+
+	return count, nil
+}
+
+// CopyViaS3 writes the dataflow into gzipped CSV files in S3, then
+// inserts them into the table from an external table over the folder
+// https://docs.firebolt.io/sql_reference/commands/data-definition/create-external-table.html
+func (conn *FireboltConn) CopyViaS3(tableFName string, df *iop.Dataflow) (count uint64, err error) {
+	settingMppBulkImportFlow(conn, iop.GzipCompressorType)
+
+	table, err := ParseTableName(tableFName, conn.Type)
+	if err != nil {
+		return 0, g.Error(err, "could not parse table name: "+tableFName)
+	}
+
+	s3Path := fmt.Sprintf(
+		"s3://%s/%s/%s/%s",
+		conn.GetProp("AWS_BUCKET"),
+		conn.tempCloudFolder(),
+		env.CleanTableName(tableFName),
+		g.NowFileStr(),
+	)
+
+	s3Fs, err := filesys.NewFileSysClient(dbio.TypeFileS3, conn.PropArr()...)
+	if err != nil {
+		return 0, g.Error(err, "Could not get fs client for S3")
+	}
+
+	df.Defer(func() {
+		if !cast.ToBool(os.Getenv("SLING_KEEP_TEMP")) {
+			filesys.Delete(s3Fs, s3Path)
+		}
+	}) // cleanup
+
+	g.Info("writing to s3 for firebolt import")
+	s3Fs.SetProp("null_as", `\N`)
+	bw, err := filesys.WriteDataflow(s3Fs, df, s3Path)
+	if err != nil {
+		return df.Count(), g.Error(err, "error writing to s3")
+	}
+	g.DebugLow("total written: %s to %s", humanize.Bytes(cast.ToUint64(bw)), s3Path)
+
+	columns, err := conn.GetColumns(tableFName, df.Columns.Names()...)
+	if err != nil {
+		return df.Count(), g.Error(err, "could not get column list")
+	}
+
+	externalTable := Table{
+		Schema:  table.Schema,
+		Name:    g.F("%s_sling_ext_%d", table.Name, time.Now().UnixNano()),
+		Dialect: conn.Type,
+	}
+
+	createSQL, insertSQL := conn.copyFromS3SQL(tableFName, externalTable.FullName(), s3Path+"/", columns)
+
+	if _, err = conn.Exec(createSQL + noDebugKey); err != nil {
+		return df.Count(), g.Error(err, "could not create external table")
+	}
+	defer conn.Exec(g.R(conn.template.Core["drop_table"], "table", externalTable.FullName()))
+
+	if _, err = conn.Exec(insertSQL); err != nil {
+		return df.Count(), g.Error(err, "could not insert from external table")
+	}
+
+	return df.Count(), nil
+}
+
+// copyFromS3SQL generates the statements creating the external table over
+// the CSV files, and inserting its rows. The columns are read as text and
+// cast to the table column types
+func (conn *FireboltConn) copyFromS3SQL(tableFName, externalTableFName, s3URL string, columns iop.Columns) (createSQL, insertSQL string) {
+	colTypes := make([]string, len(columns))
+	srcColumns := make([]string, len(columns))
+	for i, col := range columns {
+		colQ := conn.Quote(col.Name)
+		colTypes[i] = colQ + " text null"
+
+		srcColumns[i] = g.F(`nullif(%s, '\N')`, colQ)
+		if col.DbType != "" && !strings.EqualFold(col.DbType, "text") {
+			srcColumns[i] = g.F("cast(%s as %s)", srcColumns[i], col.DbType)
+		}
+	}
+
+	createSQL = g.R(
+		conn.template.Core["create_external_table"],
+		"table", externalTableFName,
+		"col_types", strings.Join(colTypes, ", "),
+		"credentials", conn.credentialsExpr(),
+		"s3_url", s3URL,
+	)
+
+	insertSQL = g.R(
+		conn.template.Core["insert_from_external"],
+		"table", tableFName,
+		"tgt_columns", strings.Join(conn.QuoteNames(columns.Names()...), ", "),
+		"src_columns", strings.Join(srcColumns, ", "),
+		"external_table", externalTableFName,
+	)
+
+	return
+}
+
+// credentialsExpr returns the credentials clause of the external table.
+// The role is used when `AWS_ROLE_ARN` is provided, none for public buckets
+func (conn *FireboltConn) credentialsExpr() string {
+	if role := conn.GetProp("AWS_ROLE_ARN"); role != "" {
+		return g.F("credentials = (aws_role_arn = '%s')", role)
+	}
+
+	AwsID := conn.GetProp("AWS_ACCESS_KEY_ID")
+	AwsAccessKey := conn.GetProp("AWS_SECRET_ACCESS_KEY")
+	if AwsID == "" && AwsAccessKey == "" {
+		return ""
+	}
+
+	expr := g.F("aws_key_id = '%s' aws_secret_key = '%s'", AwsID, AwsAccessKey)
+	if token := conn.GetProp("AWS_SESSION_TOKEN"); token != "" {
+		expr = expr + g.F(" aws_session_token = '%s'", token)
+	}
+
+	return "credentials = (" + expr + ")"
+}
+
+// InsertBatchStream inserts a stream into a table in batches
+func (conn *FireboltConn) InsertBatchStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+
+	var columns iop.Columns
+	batchSize := cast.ToInt(conn.GetTemplateValue("variable.batch_values")) / len(ds.Columns)
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	// default 10 concurrent requests
+	concurrency := 10
+	if val := conn.GetProp("insert_concurrency"); val != "" {
+		concurrency = cast.ToInt(val)
+	}
+	insertContext := g.NewContext(ds.Context.Ctx, concurrency)
+
+	// in case schema change is needed, cannot alter while inserting
+	mux := ds.Context.Mux
+	if df := ds.Df(); df != nil {
+		mux = df.Context.Mux
+	}
+
+	insertBatch := func(bColumns iop.Columns, rows [][]interface{}) error {
+		defer insertContext.Wg.Write.Done()
+
+		insCols, err := conn.ValidateColumnNames(columns, bColumns.Names(), true)
+		if err != nil {
+			return g.Error(err, "columns mismatch")
+		}
+
+		insertSQL := conn.GenerateInsertValues(tableFName, insCols, rows)
+		_, err = conn.ExecContext(ds.Context.Ctx, insertSQL+noDebugKey)
+		if err != nil {
+			batchErrStr := g.F("Batch Size: %d rows x %d cols = %d", len(rows), len(bColumns), len(rows)*len(bColumns))
+			if len(insertSQL) > 3000 {
+				insertSQL = insertSQL[:3000]
+			}
+			g.Debug(g.F("%s\n%s \n%s", err.Error(), batchErrStr, fmt.Sprintf("Insert: %s", insertSQL)))
+			insertContext.CaptureErr(err)
+			return err
+		}
+
+		return nil
+	}
+
+	batchRows := [][]any{}
+	var batch *iop.Batch
+
+	for batch = range ds.BatchChan {
+
+		if batch.ColumnsChanged() || batch.IsFirst() {
+			// make sure fields match
+			mux.Lock()
+			insertContext.Wg.Write.Wait() // wait for any pending queries
+			columns, err = conn.GetColumns(tableFName, batch.Columns.Names()...)
+			if err != nil {
+				mux.Unlock()
+				err = g.Error(err, "could not get column list")
+				return
+			}
+			mux.Unlock()
+		}
+
+		for row := range batch.Rows {
+			batchRows = append(batchRows, row)
+			count++
+			if len(batchRows) == batchSize {
+				insertContext.Wg.Write.Add()
+				select {
+				case <-insertContext.Ctx.Done():
+					return count, insertContext.Err()
+				case <-ds.Context.Ctx.Done():
+					return count, ds.Context.Err()
+				default:
+					go insertBatch(batch.Columns, batchRows)
+				}
+
+				// reset
+				batchRows = [][]interface{}{}
+			}
+		}
+
+	}
+
+	// remaining batch
+	if len(batchRows) > 0 {
+		g.Trace("remaining batchSize %d", len(batchRows))
+		insertContext.Wg.Write.Add()
+		err = insertBatch(batch.Columns, batchRows)
+		if err != nil {
+			return count - cast.ToUint64(len(batchRows)), g.Error(err, "insertBatch")
+		}
+	}
+
+	insertContext.Wg.Write.Wait()
+
+	if err = insertContext.Err(); err != nil {
+		return count, g.Error(err, "insertBatch")
+	}
+
+	return
+}
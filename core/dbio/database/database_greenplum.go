@@ -0,0 +1,107 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+)
+
+// GreenplumConn is a Greenplum connection, over the Postgres protocol
+type GreenplumConn struct {
+	PostgresConn
+}
+
+// Init initiates the object
+func (conn *GreenplumConn) Init() error {
+
+	conn.BaseConn.URL = conn.URL
+	conn.BaseConn.Type = dbio.TypeDbGreenplum
+	conn.BaseConn.defaultPort = 5432
+
+	// the CopyToStdout function is slower than just select
+	conn.BaseConn.SetProp("allow_bulk_export", "false")
+
+	instance := Connection(conn)
+	conn.BaseConn.instance = &instance
+
+	return conn.BaseConn.Init()
+}
+
+// ConnString returns the connection string for the postgres driver
+func (conn *GreenplumConn) ConnString() string {
+	return strings.Replace(conn.PostgresConn.ConnString(), "greenplum://", "postgresql://", 1)
+}
+
+// GenerateDDL generates a DDL based on a dataset, with the distribution
+// of the table across the segments
+func (conn *GreenplumConn) GenerateDDL(table Table, data iop.Dataset, temporary bool) (ddl string, err error) {
+	ddl, err = conn.BaseConn.GenerateDDL(table, data, temporary)
+	if err != nil {
+		return ddl, g.Error(err)
+	}
+
+	ddl, err = table.AddPrimaryKeyToDDL(ddl, data.Columns)
+	if err != nil {
+		return ddl, g.Error(err)
+	}
+
+	ddl = strings.ReplaceAll(ddl, "{distributed_by}", conn.distributedBy(table, data.Columns))
+
+	for _, index := range table.Indexes(data.Columns) {
+		ddl = ddl + ";\n" + index.CreateDDL()
+	}
+
+	return strings.TrimSpace(ddl), nil
+}
+
+// distributedBy returns the distribution clause: the distribution keys, else
+// the primary key (must be included in the distribution key), else random
+func (conn *GreenplumConn) distributedBy(table Table, columns iop.Columns) string {
+	distCols := []string{}
+	if keys, ok := table.Keys[iop.DistributionKey]; ok && len(keys) > 0 {
+		distCols = keys
+	} else if keyCols := columns.GetKeys(iop.DistributionKey); len(keyCols) > 0 {
+		distCols = keyCols.Names()
+	} else if keyCols := columns.GetKeys(iop.PrimaryKey); len(keyCols) > 0 {
+		distCols = keyCols.Names()
+	}
+
+	if len(distCols) == 0 {
+		return "distributed randomly"
+	}
+	return g.F("distributed by (%s)", strings.Join(conn.QuoteNames(distCols...), ", "))
+}
+
+// GenerateUpsertSQL generates the upsert SQL. Greenplum 6 has no `on conflict`
+// nor data-modifying CTEs, so the matching rows are deleted and re-inserted.
+func (conn *GreenplumConn) GenerateUpsertSQL(srcTable string, tgtTable string, pkFields []string) (sql string, err error) {
+
+	upsertMap, err := conn.BaseConn.GenerateUpsertExpressions(srcTable, tgtTable, pkFields)
+	if err != nil {
+		err = g.Error(err, "could not generate upsert variables")
+		return
+	}
+
+	sqlTempl := `
+	delete from {tgt_table} tgt
+	using {src_table} src
+	where {src_tgt_pk_equal};
+
+	insert into {tgt_table}
+	({insert_fields})
+	select {src_fields} from {src_table} src
+	`
+
+	sql = g.R(
+		sqlTempl,
+		"src_table", srcTable,
+		"tgt_table", tgtTable,
+		"src_tgt_pk_equal", upsertMap["src_tgt_pk_equal"],
+		"insert_fields", upsertMap["insert_fields"],
+		"src_fields", upsertMap["src_fields"],
+	)
+
+	return
+}
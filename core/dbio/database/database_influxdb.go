@@ -0,0 +1,433 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+)
+
+// TimeSeries are the options of the time-series targets (timescale,
+// influxdb), set with the `time_series` property
+type TimeSeries struct {
+	TimeColumn    string   `json:"time_column,omitempty" yaml:"time_column,omitempty"`       // the hypertable dimension / points timestamp
+	ChunkInterval string   `json:"chunk_interval,omitempty" yaml:"chunk_interval,omitempty"` // timescale chunk_time_interval, e.g. `1 day`
+	Tags          []string `json:"tags,omitempty" yaml:"tags,omitempty"`                     // influxdb tag columns
+	Fields        []string `json:"fields,omitempty" yaml:"fields,omitempty"`                 // influxdb field columns, all the others by default
+	Precision     string   `json:"precision,omitempty" yaml:"precision,omitempty"`           // influxdb timestamp precision: ns (default), us, ms or s
+}
+
+// timeSeriesPrecisions are the divisors of the unix nanoseconds
+var timeSeriesPrecisions = map[string]int64{"ns": 1, "us": 1e3, "ms": 1e6, "s": 1e9}
+
+// Validate checks the time-series options
+func (ts *TimeSeries) Validate() error {
+	if ts == nil {
+		return nil
+	}
+	if _, ok := timeSeriesPrecisions[ts.Precision]; ts.Precision != "" && !ok {
+		return g.Error("invalid time_series precision (%s). Expected ns, us, ms or s", ts.Precision)
+	}
+	for _, tag := range ts.Tags {
+		if g.In(strings.ToLower(tag), lowerNames(ts.Fields)...) {
+			return g.Error("time_series column %s cannot be both a tag and a field", tag)
+		}
+	}
+	return nil
+}
+
+// getTimeSeries returns the time-series options of the connection, nil if
+// not set
+func getTimeSeries(conn Connection) (ts *TimeSeries, err error) {
+	val := conn.GetProp("time_series")
+	if val == "" || val == "null" {
+		return nil, nil
+	}
+
+	ts = &TimeSeries{}
+	if err = g.Unmarshal(val, ts); err != nil {
+		return nil, g.Error(err, "could not parse time_series option")
+	}
+	return ts, ts.Validate()
+}
+
+func lowerNames(names []string) []string {
+	lower := make([]string, len(names))
+	for i, name := range names {
+		lower[i] = strings.ToLower(name)
+	}
+	return lower
+}
+
+// InfluxDBConn is an InfluxDB connection, writing points with the line
+// protocol over HTTP (v2 API with a token, else v1 API)
+type InfluxDBConn struct {
+	BaseConn
+	URL    string
+	Client *http.Client
+}
+
+// Init initiates the object
+func (conn *InfluxDBConn) Init() error {
+
+	conn.BaseConn.URL = conn.URL
+	conn.BaseConn.Type = dbio.TypeDbInfluxDB
+
+	instance := Connection(conn)
+	conn.BaseConn.instance = &instance
+	return conn.BaseConn.Init()
+}
+
+// Connect connects to the database
+func (conn *InfluxDBConn) Connect(timeOut ...int) error {
+	conn.Client = &http.Client{}
+
+	tlsConfig, err := conn.makeTlsConfig()
+	if err != nil {
+		return g.Error(err)
+	} else if tlsConfig != nil {
+		conn.Client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+
+	resp, err := conn.request(http.MethodGet, "/ping", nil, nil)
+	if err != nil {
+		return g.Error(err, "Failed to connect to InfluxDB")
+	}
+	resp.Body.Close()
+
+	g.Debug(`opened "%s" connection (%s)`, conn.Type, conn.GetProp("sling_conn_id"))
+
+	return nil
+}
+
+func (conn *InfluxDBConn) Close() error {
+	g.Debug(`closed "%s" connection (%s)`, conn.Type, conn.GetProp("sling_conn_id"))
+	return nil
+}
+
+// NewTransaction creates a new transaction
+func (conn *InfluxDBConn) NewTransaction(ctx context.Context, options ...*sql.TxOptions) (tx Transaction, err error) {
+	// does not support transaction
+	return
+}
+
+// GetColumns returns no columns, since the measurements are schemaless
+func (conn *InfluxDBConn) GetColumns(tableFName string, fields ...string) (columns iop.Columns, err error) {
+	return nil, g.Error("measurement %s not found (schemaless)", tableFName)
+}
+
+func (conn *InfluxDBConn) ExecContext(ctx context.Context, sql string, args ...interface{}) (result sql.Result, err error) {
+	return nil, g.Error("ExecContext not implemented on InfluxDBConn")
+}
+
+// request sends a request to the http_url, with the credentials
+func (conn *InfluxDBConn) request(method, path string, params url.Values, body io.Reader) (resp *http.Response, err error) {
+	URL := strings.TrimSuffix(conn.GetProp("http_url"), "/") + path
+	if len(params) > 0 {
+		URL = URL + "?" + params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(conn.Context().Ctx, method, URL, body)
+	if err != nil {
+		return nil, g.Error(err, "could not create request")
+	}
+
+	if token := conn.GetProp("token"); token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	} else if user := conn.GetProp("user", "username"); user != "" {
+		req.SetBasicAuth(user, conn.GetProp("password"))
+	}
+
+	resp, err = conn.Client.Do(req)
+	if err != nil {
+		return nil, g.Error(err, "could not send request to %s", path)
+	} else if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, g.Error("InfluxDB returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return resp, nil
+}
+
+// writeLines posts the points in line protocol
+func (conn *InfluxDBConn) writeLines(lines []byte, precision string) (err error) {
+	params := url.Values{}
+	path := "/api/v2/write"
+	if conn.GetProp("token") != "" {
+		params.Set("org", conn.GetProp("org"))
+		params.Set("bucket", conn.GetProp("bucket", "database"))
+		params.Set("precision", precision)
+	} else {
+		// v1 compatibility API
+		path = "/write"
+		params.Set("db", conn.GetProp("database", "bucket"))
+		params.Set("precision", map[string]string{"ns": "n", "us": "u", "ms": "ms", "s": "s"}[precision])
+	}
+
+	resp, err := conn.request(http.MethodPost, path, params, bytes.NewReader(lines))
+	if err != nil {
+		return g.Error(err, "could not write points")
+	}
+	return resp.Body.Close()
+}
+
+// DropTable deletes all the points of the measurements
+func (conn *InfluxDBConn) DropTable(tableNames ...string) (err error) {
+	for _, tableName := range tableNames {
+		table, err := ParseConnTableName(tableName, conn)
+		if err != nil {
+			return g.Error(err, "could not parse table name: "+tableName)
+		}
+
+		var resp *http.Response
+		if conn.GetProp("token") != "" {
+			params := url.Values{}
+			params.Set("org", conn.GetProp("org"))
+			params.Set("bucket", conn.GetProp("bucket", "database"))
+			body := g.Marshal(g.M(
+				"start", "1970-01-01T00:00:00Z",
+				"stop", time.Unix(0, math.MaxInt64).UTC().Format(time.RFC3339),
+				"predicate", g.F(`_measurement="%s"`, strings.ReplaceAll(table.Name, `"`, `\"`)),
+			))
+			resp, err = conn.request(http.MethodPost, "/api/v2/delete", params, strings.NewReader(body))
+		} else {
+			// v1 compatibility API
+			params := url.Values{}
+			params.Set("db", conn.GetProp("database", "bucket"))
+			params.Set("q", g.F(`DROP MEASUREMENT "%s"`, strings.ReplaceAll(table.Name, `"`, `\"`)))
+			resp, err = conn.request(http.MethodPost, "/query", params, nil)
+		}
+		if err != nil {
+			return g.Error(err, "could not delete points of %s", table.Name)
+		}
+		resp.Body.Close()
+
+		g.Debug("deleted points of measurement %s", table.Name)
+	}
+	return nil
+}
+
+// InsertBatchStream writes the points in line protocol
+func (conn *InfluxDBConn) InsertBatchStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	return conn.BulkImportStream(tableFName, ds)
+}
+
+// BulkImportStream writes the points in line protocol, in batches of
+// `batch_size` points. The measurement is the table name.
+func (conn *InfluxDBConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	table, err := ParseConnTableName(tableFName, conn)
+	if err != nil {
+		return 0, g.Error(err, "could not parse table name: "+tableFName)
+	}
+
+	ts, err := getTimeSeries(conn)
+	if err != nil {
+		return 0, g.Error(err)
+	} else if ts == nil {
+		ts = &TimeSeries{}
+	}
+
+	precision := ts.Precision
+	if precision == "" {
+		precision = "ns"
+	}
+
+	batchSize := cast.ToInt(conn.GetProp("batch_size"))
+	if batchSize <= 0 {
+		batchSize = 5000
+	}
+
+	var lp *lineProtocol
+	var buf bytes.Buffer
+	points := 0
+	flush := func() error {
+		if points == 0 {
+			return nil
+		}
+		if err := conn.writeLines(buf.Bytes(), precision); err != nil {
+			return err
+		}
+		buf.Reset()
+		points = 0
+		return nil
+	}
+
+	for batch := range ds.BatchChan {
+		if batch.ColumnsChanged() || batch.IsFirst() || lp == nil {
+			if lp, err = newLineProtocol(table.Name, batch.Columns, ts); err != nil {
+				return count, g.Error(err, "could not map columns to points")
+			}
+		}
+
+		for row := range batch.Rows {
+			line, err := lp.Line(row)
+			if err != nil {
+				ds.Context.CaptureErr(err)
+				return count, g.Error(err, "could not format point")
+			} else if line == "" {
+				continue // no field values
+			}
+
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+			points++
+			count++
+
+			if points >= batchSize {
+				if err = flush(); err != nil {
+					ds.Context.CaptureErr(err)
+					return count, err
+				}
+			}
+		}
+	}
+
+	if err = flush(); err != nil {
+		return count, err
+	}
+
+	return count, ds.Err()
+}
+
+// lineProtocol formats rows into points of a measurement
+type lineProtocol struct {
+	measurement  string
+	columns      iop.Columns
+	timeIndex    int
+	tagIndexes   []int
+	fieldIndexes []int
+	divisor      int64
+}
+
+func newLineProtocol(measurement string, columns iop.Columns, ts *TimeSeries) (lp *lineProtocol, err error) {
+	lp = &lineProtocol{
+		measurement: escapeLineProtocol(measurement, ", "),
+		columns:     columns,
+		timeIndex:   -1,
+		divisor:     timeSeriesPrecisions["ns"],
+	}
+	if divisor, ok := timeSeriesPrecisions[ts.Precision]; ok {
+		lp.divisor = divisor
+	}
+
+	// the time column, else the first timestamp column
+	for i, col := range columns {
+		if ts.TimeColumn != "" && strings.EqualFold(col.Name, ts.TimeColumn) {
+			lp.timeIndex = i
+			break
+		} else if ts.TimeColumn == "" && col.Type.IsDatetime() {
+			lp.timeIndex = i
+			break
+		}
+	}
+	if ts.TimeColumn != "" && lp.timeIndex == -1 {
+		return nil, g.Error("did not find time_column %s", ts.TimeColumn)
+	}
+
+	tags, fields := lowerNames(ts.Tags), lowerNames(ts.Fields)
+	for i, col := range columns {
+		switch name := strings.ToLower(col.Name); {
+		case i == lp.timeIndex:
+		case g.In(name, tags...):
+			lp.tagIndexes = append(lp.tagIndexes, i)
+		case len(fields) == 0 || g.In(name, fields...):
+			lp.fieldIndexes = append(lp.fieldIndexes, i)
+		}
+	}
+
+	if len(lp.tagIndexes) != len(tags) {
+		return nil, g.Error("did not find all time_series tags (%s)", strings.Join(ts.Tags, ", "))
+	} else if len(lp.fieldIndexes) == 0 {
+		return nil, g.Error("no field columns to write")
+	}
+
+	return lp, nil
+}
+
+// Line returns the point of the row, blank if the fields are all null
+func (lp *lineProtocol) Line(row []any) (line string, err error) {
+	var sb strings.Builder
+	sb.WriteString(lp.measurement)
+
+	for _, i := range lp.tagIndexes {
+		val := cast.ToString(row[i])
+		if row[i] == nil || val == "" {
+			continue // tags cannot be blank
+		}
+		sb.WriteString("," + escapeLineProtocol(lp.columns[i].Name, ",= ") + "=" + escapeLineProtocol(val, ",= "))
+	}
+
+	fields := 0
+	for _, i := range lp.fieldIndexes {
+		if row[i] == nil {
+			continue // nulls are omitted
+		}
+
+		val, err := lp.fieldValue(lp.columns[i], row[i])
+		if err != nil {
+			return "", g.Error(err, "invalid value for field %s", lp.columns[i].Name)
+		}
+
+		sep := ","
+		if fields == 0 {
+			sep = " "
+		}
+		sb.WriteString(sep + escapeLineProtocol(lp.columns[i].Name, ",= ") + "=" + val)
+		fields++
+	}
+
+	if fields == 0 {
+		return "", nil
+	}
+
+	if lp.timeIndex > -1 && row[lp.timeIndex] != nil {
+		t, err := cast.ToTimeE(row[lp.timeIndex])
+		if err != nil {
+			return "", g.Error(err, "invalid timestamp for %s", lp.columns[lp.timeIndex].Name)
+		}
+		sb.WriteString(" " + strconv.FormatInt(t.UnixNano()/lp.divisor, 10))
+	}
+
+	return sb.String(), nil
+}
+
+func (lp *lineProtocol) fieldValue(col iop.Column, val any) (string, error) {
+	switch {
+	case col.Type.IsInteger():
+		i, err := cast.ToInt64E(val)
+		return strconv.FormatInt(i, 10) + "i", err
+	case col.Type.IsNumber():
+		f, err := cast.ToFloat64E(val)
+		return strconv.FormatFloat(f, 'f', -1, 64), err
+	case col.Type.IsBool():
+		b, err := cast.ToBoolE(val)
+		return strconv.FormatBool(b), err
+	case col.Type.IsDatetime() || col.Type.IsDate():
+		if t, ok := val.(time.Time); ok {
+			val = t.Format(time.RFC3339Nano)
+		}
+	}
+
+	s := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(cast.ToString(val))
+	return `"` + s + `"`, nil
+}
+
+// escapeLineProtocol escapes the characters with a backslash
+func escapeLineProtocol(val, chars string) string {
+	for _, c := range chars {
+		val = strings.ReplaceAll(val, string(c), `\`+string(c))
+	}
+	return strings.ReplaceAll(val, "\n", `\n`)
+}
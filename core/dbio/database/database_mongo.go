@@ -236,7 +236,7 @@ func (conn *MongoDBConn) StreamRowsContext(ctx context.Context, collectionName s
 
 	queryContext := g.NewContext(ctx)
 
-	table, _ := ParseTableName(collectionName, conn.Type)
+	table, _ := ParseConnTableName(collectionName, conn)
 
 	collection := conn.Client.Database(table.Schema).Collection(table.Name)
 
@@ -270,9 +270,9 @@ func (conn *MongoDBConn) StreamRowsContext(ctx context.Context, collectionName s
 
 	ds = iop.NewDatastreamContext(queryContext.Ctx, nil)
 
-	flatten := true
-	if val := conn.GetProp("flatten"); val != "" {
-		flatten = cast.ToBool(val)
+	flatten, err := iop.ParseFlattenOptions(conn.Props(), true)
+	if err != nil {
+		return ds, g.Error(err, "invalid flatten options")
 	}
 	js := iop.NewJSONStream(ds, cur, flatten, conn.GetProp("jmespath"))
 	js.HasMapPayload = true
@@ -13,10 +13,12 @@ import (
 
 	"github.com/flarco/g"
 	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/spf13/cast"
 	"github.com/xo/dburl"
 )
 
-// MySQLConn is a MySQL or MariaDB connection
+// MySQLConn is a MySQL, MariaDB, SingleStore or TiDB connection
 type MySQLConn struct {
 	BaseConn
 	URL string
@@ -31,6 +33,11 @@ func (conn *MySQLConn) Init() error {
 
 	if strings.HasPrefix(conn.URL, "mariadb://") {
 		conn.BaseConn.Type = dbio.TypeDbMariaDB
+	} else if strings.HasPrefix(conn.URL, "singlestore://") {
+		conn.BaseConn.Type = dbio.TypeDbSingleStore
+	} else if strings.HasPrefix(conn.URL, "tidb://") {
+		conn.BaseConn.Type = dbio.TypeDbTiDB
+		conn.BaseConn.defaultPort = 4000
 	}
 
 	// Turn off Bulk export for now
@@ -38,8 +45,9 @@ func (conn *MySQLConn) Init() error {
 	conn.BaseConn.SetProp("allow_bulk_export", "false")
 
 	// InsertBatchStream is faster than LoadDataInFile
+	// SingleStore loads natively with LOAD DATA, no mysql client needed
 	if conn.BaseConn.GetProp("allow_bulk_import") == "" {
-		conn.BaseConn.SetProp("allow_bulk_import", "false")
+		conn.BaseConn.SetProp("allow_bulk_import", cast.ToString(conn.BaseConn.Type == dbio.TypeDbSingleStore))
 	}
 
 	instance := Connection(conn)
@@ -55,7 +63,9 @@ func (conn *MySQLConn) GetURL(newURL ...string) string {
 		connURL = newURL[0]
 	}
 
-	connURL = strings.Replace(connURL, "mariadb://", "mysql://", 1)
+	for _, scheme := range []string{"mariadb://", "singlestore://", "tidb://"} {
+		connURL = strings.Replace(connURL, scheme, "mysql://", 1)
+	}
 	u, err := dburl.Parse(connURL)
 	if err != nil {
 		g.LogError(err, "could not parse MySQL URL")
@@ -101,6 +111,16 @@ func (conn *MySQLConn) GetURL(newURL ...string) string {
 		}
 	}
 
+	// bulk DML execution of TiDB (system variable), e.g. `bulk`
+	if val := conn.GetProp("tidb_dml_type"); val != "" && conn.GetType() == dbio.TypeDbTiDB {
+		query.Set("tidb_dml_type", g.F("'%s'", val))
+	}
+
+	// server-side timeout of the select statements (system variable)
+	if timeout := conn.serverTimeout(); timeout > 0 {
+		query.Set("max_execution_time", cast.ToString(timeout.Milliseconds()))
+	}
+
 	// make tls
 	if query.Get("tls") == "custom" {
 		query.Set("tls", conn.GetProp("sling_conn_id"))
@@ -142,6 +162,16 @@ func (conn *MySQLConn) GenerateDDL(table Table, data iop.Dataset, temporary bool
 		return ddl, g.Error(err)
 	}
 
+	switch conn.GetType() {
+	case dbio.TypeDbSingleStore:
+		ddl, err = conn.addSingleStoreKeys(table, ddl, data.Columns)
+		if err != nil {
+			return ddl, g.Error(err)
+		}
+	case dbio.TypeDbTiDB:
+		ddl = strings.ReplaceAll(ddl, "{table_options}", conn.tidbTableOptions(data.Columns))
+	}
+
 	for _, index := range table.Indexes(data.Columns) {
 		ddl = ddl + ";\n" + index.CreateDDL()
 	}
@@ -183,6 +213,10 @@ func (conn *MySQLConn) BulkExportStream(table Table) (ds *iop.Datastream, err er
 
 // BulkImportStream bulk import stream
 func (conn *MySQLConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	if conn.GetType() == dbio.TypeDbSingleStore && conn.GetProp("allow_bulk_import") == "true" {
+		return conn.LoadDataLocal(tableFName, ds)
+	}
+
 	_, err = exec.LookPath("mysql")
 	if err != nil {
 		g.Trace("mysql not found in path. Using cursor...")
@@ -312,6 +346,93 @@ func (conn *MySQLConn) LoadDataInFile(tableFName string, ds *iop.Datastream) (co
 	return ds.Count, nil
 }
 
+// LoadDataLocal bulk imports with LOAD DATA LOCAL INFILE through the driver,
+// streaming the CSV rows from a registered reader (no mysql client needed)
+func (conn *MySQLConn) LoadDataLocal(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	// needs to get columns to shape stream
+	columns, err := conn.GetColumns(tableFName, ds.Columns.Names()...)
+	if err != nil {
+		return 0, g.Error(err, "could not get column list")
+	}
+
+	ds, err = ds.Shape(columns)
+	if err != nil {
+		return 0, g.Error(err, "could not shape stream")
+	}
+
+	readerName := g.RandSuffix(g.F("sling-%s-", env.CleanTableName(tableFName)), 5)
+	mysql.RegisterReaderHandler(readerName, func() io.Reader {
+		return ds.NewCsvReader(iop.DefaultStreamConfig())
+	})
+	defer mysql.DeregisterReaderHandler(readerName)
+
+	_, err = conn.ExecContext(ds.Context.Ctx, conn.loadDataLocalSQL(tableFName, readerName, ds.Columns))
+	if err != nil {
+		return ds.Count, g.Error(err, "could not load data into %s", tableFName)
+	}
+
+	return ds.Count, nil
+}
+
+// loadDataLocalSQL returns the LOAD DATA statement reading the CSV (with
+// header) of the registered reader
+func (conn *MySQLConn) loadDataLocalSQL(tableFName, readerName string, columns iop.Columns) string {
+	return g.R(
+		`LOAD DATA LOCAL INFILE 'Reader::{reader}' INTO TABLE {table} FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '"' LINES TERMINATED BY '\n' NULL DEFINED BY '' IGNORE 1 LINES ({fields})`,
+		"reader", readerName,
+		"table", tableFName,
+		"fields", strings.Join(conn.QuoteNames(columns.Names()...), ", "),
+	)
+}
+
+// addSingleStoreKeys adds the shard key (distribution keys) and the sort key
+// (sort keys) of the SingleStore table. Without a shard key, the table is
+// sharded by its primary key, else randomly.
+func (conn *MySQLConn) addSingleStoreKeys(table Table, ddl string, columns iop.Columns) (string, error) {
+	keyNames := func(keyType iop.KeyType) []string {
+		if keys, ok := table.Keys[keyType]; ok && len(keys) > 0 {
+			return keys
+		}
+		return columns.GetKeys(keyType).Names()
+	}
+
+	keyDefs := []string{}
+	if names := keyNames(iop.DistributionKey); len(names) > 0 {
+		keyDefs = append(keyDefs, g.F("shard key (%s)", strings.Join(conn.QuoteNames(names...), ", ")))
+	}
+	if names := keyNames(iop.SortKey); len(names) > 0 {
+		keyDefs = append(keyDefs, g.F("sort key (%s)", strings.Join(conn.QuoteNames(names...), ", ")))
+	}
+	if len(keyDefs) == 0 {
+		return ddl, nil
+	}
+
+	// add keys right before the last parenthesis
+	ddl = strings.TrimSpace(ddl)
+	lastParen := strings.LastIndex(ddl, ")")
+	if lastParen == -1 {
+		return ddl, g.Error("could not find last parenthesis")
+	}
+	return ddl[:lastParen] + ", " + strings.Join(keyDefs, ", ") + ddl[lastParen:], nil
+}
+
+// tidbTableOptions returns the TiDB table options. Without a primary key,
+// the implicit row IDs are sharded to avoid a write hotspot on one region.
+func (conn *MySQLConn) tidbTableOptions(columns iop.Columns) string {
+	if len(columns.GetKeys(iop.PrimaryKey)) > 0 {
+		return ""
+	}
+
+	bits := cast.ToInt(conn.GetProp("shard_row_id_bits"))
+	if val := conn.GetProp("shard_row_id_bits"); val == "" {
+		bits = 4
+	}
+	if bits <= 0 {
+		return ""
+	}
+	return g.F("shard_row_id_bits = %d pre_split_regions = %d", bits, min(bits, 4))
+}
+
 // UPSERT
 // https://vladmihalcea.com/how-do-upsert-and-merge-work-in-oracle-sql-server-postgresql-and-mysql/
 // GenerateUpsertSQL generates the upsert SQL
@@ -323,13 +444,13 @@ func (conn *MySQLConn) GenerateUpsertSQL(srcTable string, tgtTable string, pkFie
 		return
 	}
 
-	srcT, err := ParseTableName(srcTable, conn.GetType())
+	srcT, err := ParseConnTableName(srcTable, conn)
 	if err != nil {
 		err = g.Error(err, "could not generate parse srcTable")
 		return
 	}
 
-	tgtT, err := ParseTableName(tgtTable, conn.GetType())
+	tgtT, err := ParseConnTableName(tgtTable, conn)
 	if err != nil {
 		err = g.Error(err, "could not generate parse tgtTable")
 		return
@@ -0,0 +1,491 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/spf13/cast"
+)
+
+// Graph maps the rows to the nodes or relationships of a graph target
+// (neo4j), set with the `graph` property. The key properties are the primary
+// key columns.
+type Graph struct {
+	Label        string     `json:"label,omitempty" yaml:"label,omitempty"`               // node label, the target object by default
+	Relationship string     `json:"relationship,omitempty" yaml:"relationship,omitempty"` // relationship type, the target object by default
+	From         *GraphNode `json:"from,omitempty" yaml:"from,omitempty"`                 // start node of the relationships
+	To           *GraphNode `json:"to,omitempty" yaml:"to,omitempty"`                     // end node of the relationships
+}
+
+// GraphNode matches the existing node of a relationship, on its key
+// properties (property name => row column)
+type GraphNode struct {
+	Label string            `json:"label" yaml:"label"`
+	Keys  map[string]string `json:"keys" yaml:"keys"`
+}
+
+// IsRelationship returns true if the rows are loaded as relationships
+func (gr *Graph) IsRelationship() bool {
+	return gr != nil && (gr.From != nil || gr.To != nil)
+}
+
+// Validate checks the graph options
+func (gr *Graph) Validate() error {
+	if !gr.IsRelationship() {
+		return nil
+	} else if gr.From == nil || gr.To == nil {
+		return g.Error("graph relationships require both the from and to nodes")
+	}
+	for name, node := range map[string]*GraphNode{"from": gr.From, "to": gr.To} {
+		if node.Label == "" {
+			return g.Error("graph %s node requires a label", name)
+		} else if len(node.Keys) == 0 {
+			return g.Error("graph %s node requires keys (property: column)", name)
+		}
+	}
+	return nil
+}
+
+// getGraph returns the graph options of the connection, nil if not set
+func getGraph(conn Connection) (gr *Graph, err error) {
+	val := conn.GetProp("graph")
+	if val == "" || val == "null" {
+		return nil, nil
+	}
+
+	gr = &Graph{}
+	if err = g.Unmarshal(val, gr); err != nil {
+		return nil, g.Error(err, "could not parse graph option")
+	}
+	return gr, gr.Validate()
+}
+
+// Neo4jConn is a Neo4j connection, running Cypher statements with the HTTP
+// transactional API
+type Neo4jConn struct {
+	BaseConn
+	URL    string
+	Client *http.Client
+}
+
+// Init initiates the object
+func (conn *Neo4jConn) Init() error {
+
+	conn.BaseConn.URL = conn.URL
+	conn.BaseConn.Type = dbio.TypeDbNeo4j
+
+	instance := Connection(conn)
+	conn.BaseConn.instance = &instance
+	return conn.BaseConn.Init()
+}
+
+// Connect connects to the database
+func (conn *Neo4jConn) Connect(timeOut ...int) (err error) {
+	conn.Client = &http.Client{}
+
+	tlsConfig, err := conn.makeTlsConfig()
+	if err != nil {
+		return g.Error(err)
+	} else if tlsConfig != nil {
+		conn.Client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+
+	if _, err = conn.run(conn.Context().Ctx, "return 1", nil); err != nil {
+		return g.Error(err, "Failed to connect to Neo4j")
+	}
+
+	if !cast.ToBool(conn.GetProp("silent")) {
+		g.Debug(`opened "%s" connection (%s)`, conn.Type, conn.GetProp("sling_conn_id"))
+	}
+
+	conn.SetProp("connected", "true")
+
+	return nil
+}
+
+func (conn *Neo4jConn) Close() error {
+	conn.SetProp("connected", "false")
+	g.Debug(`closed "%s" connection (%s)`, conn.Type, conn.GetProp("sling_conn_id"))
+	return nil
+}
+
+// NewTransaction creates a new transaction
+func (conn *Neo4jConn) NewTransaction(ctx context.Context, options ...*sql.TxOptions) (tx Transaction, err error) {
+	// each request is committed
+	return
+}
+
+// GetColumns returns no columns, since the graph is schemaless
+func (conn *Neo4jConn) GetColumns(tableFName string, fields ...string) (columns iop.Columns, err error) {
+	return nil, g.Error("label %s not found (schemaless)", tableFName)
+}
+
+type neo4jResponse struct {
+	Results []struct {
+		Stats map[string]any `json:"stats"`
+	} `json:"results"`
+	Errors []struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (r neo4jResponse) LastInsertId() (int64, error) {
+	return -1, nil
+}
+
+// RowsAffected returns the number of nodes & relationships created or deleted
+func (r neo4jResponse) RowsAffected() (int64, error) {
+	var count int64
+	for _, result := range r.Results {
+		for _, key := range []string{"nodes_created", "nodes_deleted", "relationships_created", "relationships_deleted"} {
+			count += cast.ToInt64(result.Stats[key])
+		}
+	}
+	return count, nil
+}
+
+// run commits the Cypher statement, with the parameters
+func (conn *Neo4jConn) run(ctx context.Context, cypher string, params map[string]any) (response neo4jResponse, err error) {
+	statement := g.M("statement", cypher, "includeStats", true)
+	if len(params) > 0 {
+		statement["parameters"] = params
+	}
+	body := g.Marshal(g.M("statements", []any{statement}))
+
+	database := conn.GetProp("database")
+	if database == "" {
+		database = "neo4j"
+	}
+	URL := g.F("%s/db/%s/tx/commit", strings.TrimSuffix(conn.GetProp("http_url"), "/"), database)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, URL, strings.NewReader(body))
+	if err != nil {
+		return response, g.Error(err, "could not create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if user := conn.GetProp("user", "username"); user != "" {
+		req.SetBasicAuth(user, conn.GetProp("password"))
+	}
+
+	resp, err := conn.Client.Do(req)
+	if err != nil {
+		return response, g.Error(err, "could not send request")
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return response, g.Error(err, "could not read from request body")
+	} else if resp.StatusCode >= 300 {
+		return response, g.Error("Neo4j returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBytes)))
+	}
+
+	if err = g.Unmarshal(string(respBytes), &response); err != nil {
+		return response, g.Error(err, "could not unmarshal from request body")
+	} else if len(response.Errors) > 0 {
+		return response, g.Error("%s: %s", response.Errors[0].Code, response.Errors[0].Message)
+	}
+
+	return response, nil
+}
+
+// ExecContext runs a Cypher statement
+func (conn *Neo4jConn) ExecContext(ctx context.Context, q string, args ...interface{}) (result sql.Result, err error) {
+	err = reconnectIfClosed(conn)
+	if err != nil {
+		err = g.Error(err, "Could not reconnect")
+		return
+	}
+
+	if strings.TrimSpace(q) == "" {
+		g.Warn("Empty Query")
+		return
+	}
+
+	conn.LogSQL(q, args...)
+
+	response, err := conn.run(ctx, q, nil)
+	if err != nil {
+		if strings.Contains(q, noDebugKey) {
+			err = g.Error(err, "Error executing query")
+		} else {
+			err = g.Error(err, "Error executing %s", env.Clean(conn.Props(), q))
+		}
+		return
+	}
+
+	return response, nil
+}
+
+// DropTable deletes the nodes of the labels (with their relationships), or
+// the relationships of the types when loading relationships
+func (conn *Neo4jConn) DropTable(tableNames ...string) (err error) {
+	gr, err := getGraph(conn)
+	if err != nil {
+		return g.Error(err)
+	}
+
+	for _, tableName := range tableNames {
+		table, err := ParseConnTableName(tableName, conn)
+		if err != nil {
+			return g.Error(err, "could not parse table name: "+tableName)
+		}
+
+		cypher := neo4jDeleteCypher(table.Name, gr)
+		if _, err = conn.Exec(cypher); err != nil {
+			return g.Error(err, "could not delete graph data of %s", table.Name)
+		}
+	}
+	return nil
+}
+
+// InsertBatchStream merges the rows into the graph
+func (conn *Neo4jConn) InsertBatchStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	return conn.BulkImportStream(tableFName, ds)
+}
+
+// BulkImportStream merges the rows into nodes or relationships, in batches of
+// `batch_size` rows with UNWIND. The label / relationship type is the table
+// name, unless specified in the `graph` property.
+func (conn *Neo4jConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	table, err := ParseConnTableName(tableFName, conn)
+	if err != nil {
+		return 0, g.Error(err, "could not parse table name: "+tableFName)
+	}
+
+	gr, err := getGraph(conn)
+	if err != nil {
+		return 0, g.Error(err)
+	}
+
+	keys := []string{}
+	if pk := conn.GetProp("primary_key"); pk != "" {
+		keys = strings.Split(pk, ",")
+	}
+
+	batchSize := cast.ToInt(conn.GetProp("batch_size"))
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	var cypher string
+	var columns iop.Columns
+	rows := []map[string]any{}
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		if _, err := conn.run(ds.Context.Ctx, cypher, g.M("rows", rows)); err != nil {
+			return g.Error(err, "could not merge rows into %s", table.Name)
+		}
+		rows = []map[string]any{}
+		return nil
+	}
+
+	for batch := range ds.BatchChan {
+		if batch.ColumnsChanged() || batch.IsFirst() || cypher == "" {
+			if err = flush(); err != nil {
+				ds.Context.CaptureErr(err)
+				return count, err
+			}
+			columns = batch.Columns
+			if cypher, err = neo4jMergeCypher(table.Name, columns, keys, gr); err != nil {
+				return count, g.Error(err, "could not map columns to graph")
+			}
+			conn.LogSQL(cypher)
+		}
+
+		for row := range batch.Rows {
+			rows = append(rows, neo4jRow(columns, row))
+			count++
+
+			if len(rows) >= batchSize {
+				if err = flush(); err != nil {
+					ds.Context.CaptureErr(err)
+					return count, err
+				}
+			}
+		}
+	}
+
+	if err = flush(); err != nil {
+		return count, err
+	}
+
+	return count, ds.Err()
+}
+
+// neo4jRow returns the parameter values of the row, the temporal values as
+// ISO strings (converted in the Cypher statement)
+func neo4jRow(columns iop.Columns, row []any) map[string]any {
+	rec := make(map[string]any, len(columns))
+	for i, col := range columns {
+		if i >= len(row) || row[i] == nil {
+			rec[col.Name] = nil
+			continue
+		}
+
+		switch val := row[i]; {
+		case col.Type.IsInteger():
+			rec[col.Name] = cast.ToInt64(val)
+		case col.Type.IsNumber():
+			rec[col.Name] = cast.ToFloat64(val)
+		case col.Type.IsBool():
+			rec[col.Name] = cast.ToBool(val)
+		case col.Type.IsDatetime() || col.Type.IsDate():
+			t, err := cast.ToTimeE(val)
+			if err != nil {
+				rec[col.Name] = cast.ToString(val)
+			} else if col.Type == iop.DateType {
+				rec[col.Name] = t.Format(time.DateOnly)
+			} else if col.Type == iop.TimestampzType {
+				rec[col.Name] = t.Format(time.RFC3339Nano)
+			} else {
+				rec[col.Name] = t.Format("2006-01-02T15:04:05.999999999")
+			}
+		default:
+			rec[col.Name] = cast.ToString(val)
+		}
+	}
+	return rec
+}
+
+// neo4jQuote quotes the name with backticks
+func neo4jQuote(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// neo4jValue returns the expression of the row value, converting the
+// temporal values
+func neo4jValue(col iop.Column) string {
+	expr := "row." + neo4jQuote(col.Name)
+	switch {
+	case col.Type == iop.DateType:
+		return "date(" + expr + ")"
+	case col.Type == iop.TimestampzType:
+		return "datetime(" + expr + ")"
+	case col.Type.IsDatetime():
+		return "localdatetime(" + expr + ")"
+	}
+	return expr
+}
+
+// neo4jProps returns the properties map of the columns, e.g. {`id`: row.`id`}
+func neo4jProps(columns iop.Columns, names []string) (props string, err error) {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		col := columns.GetColumn(name)
+		if col == nil {
+			return "", g.Error("did not find key column %s", name)
+		}
+		parts[i] = neo4jQuote(col.Name) + ": " + neo4jValue(*col)
+	}
+	return "{" + strings.Join(parts, ", ") + "}", nil
+}
+
+// neo4jNodeMatch returns the MATCH of a relationship node, on its keys
+func neo4jNodeMatch(alias string, columns iop.Columns, node *GraphNode) (match string, keyCols []string, err error) {
+	properties := make([]string, 0, len(node.Keys))
+	for property := range node.Keys {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+
+	parts := make([]string, len(properties))
+	for i, property := range properties {
+		col := columns.GetColumn(node.Keys[property])
+		if col == nil {
+			return "", nil, g.Error("did not find key column %s", node.Keys[property])
+		}
+		parts[i] = neo4jQuote(property) + ": " + neo4jValue(*col)
+		keyCols = append(keyCols, strings.ToLower(col.Name))
+	}
+
+	match = g.F("MATCH (%s:%s {%s})", alias, neo4jQuote(node.Label), strings.Join(parts, ", "))
+	return match, keyCols, nil
+}
+
+// neo4jMergeCypher returns the statement merging the `$rows` into nodes
+// (on the key properties, else created) or relationships between matched
+// nodes
+func neo4jMergeCypher(name string, columns iop.Columns, keys []string, gr *Graph) (cypher string, err error) {
+	if gr == nil {
+		gr = &Graph{}
+	}
+
+	lines := []string{"UNWIND $rows AS row"}
+	skip := lowerNames(keys) // not set again
+	alias := "n"
+
+	if gr.IsRelationship() {
+		alias = "r"
+		relType := lo.Ternary(gr.Relationship != "", gr.Relationship, name)
+
+		fromMatch, fromCols, err := neo4jNodeMatch("a", columns, gr.From)
+		if err != nil {
+			return "", g.Error(err, "invalid graph from node")
+		}
+		toMatch, toCols, err := neo4jNodeMatch("b", columns, gr.To)
+		if err != nil {
+			return "", g.Error(err, "invalid graph to node")
+		}
+		skip = append(append(skip, fromCols...), toCols...)
+
+		relProps := ""
+		if len(keys) > 0 {
+			if relProps, err = neo4jProps(columns, keys); err != nil {
+				return "", err
+			}
+			relProps = " " + relProps
+		}
+
+		lines = append(lines, fromMatch, toMatch, g.F("MERGE (a)-[r:%s%s]->(b)", neo4jQuote(relType), relProps))
+	} else if len(keys) > 0 {
+		props, err := neo4jProps(columns, keys)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, g.F("MERGE (n:%s %s)", neo4jQuote(lo.Ternary(gr.Label != "", gr.Label, name)), props))
+	} else {
+		lines = append(lines, g.F("CREATE (n:%s)", neo4jQuote(lo.Ternary(gr.Label != "", gr.Label, name))))
+	}
+
+	sets := []string{}
+	for _, col := range columns {
+		if g.In(strings.ToLower(col.Name), skip...) {
+			continue
+		}
+		sets = append(sets, g.F("%s.%s = %s", alias, neo4jQuote(col.Name), neo4jValue(col)))
+	}
+	if len(sets) > 0 {
+		lines = append(lines, "SET "+strings.Join(sets, ", "))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// neo4jDeleteCypher returns the statement deleting the nodes of the label,
+// or the relationships of the type
+func neo4jDeleteCypher(name string, gr *Graph) string {
+	if gr.IsRelationship() {
+		return g.F("MATCH ()-[r:%s]->() DELETE r", neo4jQuote(lo.Ternary(gr.Relationship != "", gr.Relationship, name)))
+	}
+
+	label := name
+	if gr != nil && gr.Label != "" {
+		label = gr.Label
+	}
+	return g.F("MATCH (n:%s) DETACH DELETE n", neo4jQuote(label))
+}
@@ -61,7 +61,14 @@ func (conn *OracleConn) Init() error {
 	// set MAX_DECIMALS to import for numeric types
 	conn.SetProp("MAX_DECIMALS", "9")
 
-	return conn.BaseConn.Init()
+	if err := conn.BaseConn.Init(); err != nil {
+		return err
+	}
+
+	// kerberos (GSSAPI) authentication
+	registerKerberos(conn)
+
+	return nil
 }
 
 func (conn *OracleConn) Version() int {
@@ -240,10 +247,10 @@ func (conn *OracleConn) sqlldrPath() string {
 func (conn *OracleConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
 	_, err = exec.LookPath(conn.sqlldrPath())
 	if err != nil {
-		g.Debug("sqlldr not found in path. Using cursor...")
-		return conn.BaseConn.InsertBatchStream(tableFName, ds)
+		g.Debug("sqlldr not found in path. Using array inserts...")
+		return conn.ArrayInsert(tableFName, ds)
 	} else if conn.GetProp("allow_bulk_import") != "true" {
-		return conn.BaseConn.InsertBatchStream(tableFName, ds)
+		return conn.ArrayInsert(tableFName, ds)
 	}
 
 	// needs to get columns to shape stream
@@ -269,6 +276,150 @@ func (conn *OracleConn) BulkImportStream(tableFName string, ds *iop.Datastream)
 	return countTot, nil
 }
 
+// ArrayInsert inserts the stream with array binding, sending each batch of
+// rows (prop `array_size`) in a single execution. By default, the batches are
+// direct-path inserts (APPEND_VALUES hint), committed separately like sqlldr.
+// Set prop `direct_path` to false for conventional inserts in the transaction.
+func (conn *OracleConn) ArrayInsert(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	if conn.GetProp("array_insert") == "false" {
+		return conn.BaseConn.InsertBatchStream(tableFName, ds)
+	}
+
+	columns, err := conn.GetColumns(tableFName, ds.Columns.Names()...)
+	if err != nil {
+		return 0, g.Error(err, "could not get column list")
+	}
+
+	ds, err = ds.Shape(columns)
+	if err != nil {
+		return 0, g.Error(err, "could not shape stream")
+	}
+
+	arraySize := cast.ToInt(conn.GetProp("array_size"))
+	if arraySize <= 0 {
+		arraySize = 10000
+	}
+
+	// direct-path inserts lock the table until committed, cannot be
+	// followed by other inserts in the same transaction
+	directPath := conn.GetProp("direct_path") != "false"
+	insertSQL := conn.arrayInsertSQL(tableFName, ds.Columns, directPath)
+	conn.LogSQL(insertSQL)
+
+	var stmt *sql.Stmt
+	if tx := conn.Tx(); tx != nil && !directPath {
+		stmt, err = tx.Prepare(insertSQL)
+	} else {
+		stmt, err = conn.Db().PrepareContext(ds.Context.Ctx, insertSQL)
+	}
+	if err != nil {
+		return 0, g.Error(err, "could not prepare array insert")
+	}
+	defer stmt.Close()
+
+	rows := make([][]any, 0, arraySize)
+	insertRows := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+
+		// one array of values per column
+		args := make([]any, len(ds.Columns))
+		for i := range ds.Columns {
+			values := make([]any, len(rows))
+			for r, row := range rows {
+				if i < len(row) {
+					values[r] = row[i]
+				}
+			}
+			args[i] = values
+		}
+
+		if _, err := stmt.ExecContext(ds.Context.Ctx, args...); err != nil {
+			return g.Error(err, "could not insert array of %d rows into %s", len(rows), tableFName)
+		}
+		count += uint64(len(rows))
+		rows = rows[:0]
+		return nil
+	}
+
+	for row := range ds.Rows() {
+		rows = append(rows, row)
+		if len(rows) < arraySize {
+			continue
+		}
+		if err = insertRows(); err != nil {
+			ds.Context.CaptureErr(err)
+			ds.Context.Cancel()
+			return count, err
+		}
+	}
+
+	if err = insertRows(); err != nil {
+		ds.Context.CaptureErr(err)
+		ds.Context.Cancel()
+		return count, err
+	}
+
+	if err = ds.Err(); err != nil {
+		return count, g.Error(err, "context error")
+	}
+
+	return count, nil
+}
+
+// arrayInsertSQL returns the INSERT statement with one bind variable per column
+func (conn *OracleConn) arrayInsertSQL(tableFName string, columns iop.Columns, directPath bool) string {
+	qFields := make([]string, len(columns))
+	values := make([]string, len(columns))
+	for i, col := range columns {
+		qFields[i] = conn.Self().Quote(col.Name)
+		values[i] = g.F(":%d", i+1)
+	}
+
+	return g.R(
+		"insert {hint}into {table} ({fields}) values ({values})",
+		"hint", lo.Ternary(directPath, "/*+ APPEND_VALUES */ ", ""),
+		"table", tableFName,
+		"fields", strings.Join(qFields, ", "),
+		"values", strings.Join(values, ", "),
+	)
+}
+
+// ChunkByRowID splits the read of an Oracle table into `p` ROWID range
+// queries, each covering about the same number of rows
+var ChunkByRowID = func(conn Connection, table Table, p int) ([]Table, error) {
+	if p <= 1 {
+		return []Table{table}, nil
+	} else if conn.GetType() != dbio.TypeDbOracle {
+		return nil, g.Error("cannot chunk by rowid for %s, only for oracle", conn.GetType())
+	} else if table.Name == "" {
+		return nil, g.Error("cannot chunk by rowid a custom SQL stream, must be a table")
+	}
+
+	sql := g.R(
+		conn.GetTemplateValue("core.rowid_ranges"),
+		"table", table.FDQN(),
+		"chunks", cast.ToString(p),
+	)
+	data, err := conn.Query(sql)
+	if err != nil {
+		return nil, g.Error(err, "could not get rowid ranges of %s", table.FDQN())
+	} else if len(data.Rows) == 0 {
+		return []Table{table}, nil // no rows
+	}
+
+	conds := []string{}
+	for _, row := range data.Rows {
+		conds = append(conds, g.F(
+			"rowid between chartorowid('%s') and chartorowid('%s')",
+			cast.ToString(row[0]), cast.ToString(row[1]),
+		))
+	}
+
+	return table.chunkTables(conn, table.chunkBaseSQL(), conds), nil
+}
+
 // SQLLoad uses sqlldr to Bulk Import
 // cat test1.csv | sqlldr system/oracle@oracle.host:1521/xe control=sqlldr.ctl log=/dev/stdout bad=/dev/stderr
 // cannot import when newline in value. Need to scan for new lines.
@@ -0,0 +1,373 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/dbio/plugin"
+	"github.com/spf13/cast"
+)
+
+// PluginConn is a connection to a community connector plugin (see package
+// plugin). The streams of the plugin are read and written as tables.
+type PluginConn struct {
+	BaseConn
+	URL    string
+	Plugin *plugin.Plugin
+}
+
+// Init initiates the object
+func (conn *PluginConn) Init() error {
+
+	conn.BaseConn.URL = conn.URL
+	conn.BaseConn.Type = dbio.TypeDbPlugin
+
+	instance := Connection(conn)
+	conn.BaseConn.instance = &instance
+	return conn.BaseConn.Init()
+}
+
+// name returns the name of the plugin, from the `plugin` property or the
+// URL (plugin://<name>)
+func (conn *PluginConn) name() string {
+	if name := conn.GetProp("plugin"); name != "" {
+		return name
+	}
+	name := strings.TrimPrefix(conn.URL, "plugin://")
+	return strings.Split(strings.Split(name, "/")[0], "?")[0]
+}
+
+// Connect finds the plugin and checks the config
+func (conn *PluginConn) Connect(timeOut ...int) (err error) {
+	conn.Plugin, err = plugin.Get(conn.Context().Ctx, conn.name())
+	if err != nil {
+		return g.Error(err, "could not load plugin")
+	}
+
+	if err = conn.Plugin.Call(conn.Context().Ctx, "check", conn.request(""), nil); err != nil {
+		return g.Error(err, "could not connect with plugin %s", conn.Plugin.Name)
+	}
+
+	if !cast.ToBool(conn.GetProp("silent")) {
+		g.Debug(`opened "%s" connection (%s) with plugin %s v%s`, conn.Type, conn.GetProp("sling_conn_id"), conn.Plugin.Name, conn.Plugin.Spec.Version)
+	}
+
+	conn.SetProp("connected", "true")
+
+	return nil
+}
+
+func (conn *PluginConn) Close() error {
+	conn.SetProp("connected", "false")
+	g.Debug(`closed "%s" connection (%s)`, conn.Type, conn.GetProp("sling_conn_id"))
+	return nil
+}
+
+// NewTransaction creates a new transaction
+func (conn *PluginConn) NewTransaction(ctx context.Context, options ...*sql.TxOptions) (tx Transaction, err error) {
+	// does not support transaction
+	return
+}
+
+func (conn *PluginConn) ExecContext(ctx context.Context, sql string, args ...interface{}) (result sql.Result, err error) {
+	return nil, g.Error("ExecContext not implemented on PluginConn")
+}
+
+// request returns the request of the stream, with the connection
+// properties as config
+func (conn *PluginConn) request(stream string) *plugin.Request {
+	config := map[string]string{}
+	for k, v := range conn.Props() {
+		if k == "METADATA" || strings.HasPrefix(k, "_") {
+			continue
+		}
+		config[k] = v
+	}
+	return &plugin.Request{Config: config, Stream: stream}
+}
+
+// can returns an error if the plugin does not have the capability
+func (conn *PluginConn) can(capability string) error {
+	if conn.Plugin == nil {
+		return g.Error("plugin connection is not connected")
+	} else if !conn.Plugin.Spec.Can(capability) {
+		return g.Error("plugin %s cannot %s (capabilities: %s)", conn.Plugin.Name, capability, strings.Join(conn.Plugin.Spec.Capabilities, ", "))
+	}
+	return nil
+}
+
+// pluginDecoder decodes the records read, waiting for the plugin at the end
+type pluginDecoder struct {
+	decoder *json.Decoder
+	wait    func() error
+	cancel  context.CancelFunc // stops the plugin
+	limit   int
+	count   int
+	done    bool
+}
+
+func (d *pluginDecoder) Decode(obj any) (err error) {
+	if d.done {
+		return io.EOF
+	} else if d.limit > 0 && d.count >= d.limit {
+		d.done = true
+		d.cancel()
+		go d.wait() // reaps the stopped plugin
+		return io.EOF
+	}
+
+	if err = d.decoder.Decode(obj); err == io.EOF {
+		d.done = true
+		if err = d.wait(); err != nil {
+			return err
+		}
+		return io.EOF
+	} else if err != nil {
+		return g.Error(err, "could not decode record")
+	}
+
+	d.count++
+	return nil
+}
+
+func (conn *PluginConn) BulkExportFlow(table Table) (df *iop.Dataflow, err error) {
+	options, _ := g.UnmarshalMap(table.SQL)
+	ds, err := conn.StreamRowsContext(conn.Context().Ctx, table.Name, options)
+	if err != nil {
+		return df, g.Error(err, "could start datastream")
+	}
+
+	df, err = iop.MakeDataFlow(ds)
+	if err != nil {
+		return df, g.Error(err, "could start dataflow")
+	}
+
+	return
+}
+
+// StreamRowsContext reads the records of the stream from the plugin
+func (conn *PluginConn) StreamRowsContext(ctx context.Context, stream string, Opts ...map[string]interface{}) (ds *iop.Datastream, err error) {
+	opts := getQueryOptions(Opts)
+	if err = conn.can(plugin.CapabilityRead); err != nil {
+		return ds, err
+	}
+
+	if strings.TrimSpace(stream) == "" {
+		g.Warn("Empty stream name")
+		return ds, nil
+	}
+
+	req := conn.request(stream)
+	req.Options = map[string]any{}
+	for _, key := range []string{"fields", "limit", "update_key", "value", "start_value", "end_value"} {
+		if val, ok := opts[key]; ok {
+			req.Options[key] = val
+		}
+	}
+
+	if !cast.ToBool(opts["silent"]) {
+		conn.LogSQL(g.Marshal(g.M("plugin", conn.Plugin.Name, "stream", stream, "options", req.Options)))
+	}
+
+	queryContext := g.NewContext(ctx)
+	pluginCtx, cancel := context.WithCancel(queryContext.Ctx)
+	decoder, wait, err := conn.Plugin.Read(pluginCtx, *req)
+	if err != nil {
+		cancel()
+		return ds, g.Error(err, "could not read %s", stream)
+	}
+
+	ds = iop.NewDatastreamContext(queryContext.Ctx, nil)
+
+	flatten, err := iop.ParseFlattenOptions(conn.Props(), true)
+	if err != nil {
+		cancel()
+		return ds, g.Error(err, "invalid flatten options")
+	}
+
+	pd := &pluginDecoder{decoder: decoder, wait: wait, cancel: cancel, limit: cast.ToInt(opts["limit"])}
+	js := iop.NewJSONStream(ds, pd, flatten, conn.GetProp("jmespath"))
+	js.HasMapPayload = true
+
+	ds.SetIterator(ds.NewIterator(ds.Columns, js.NextFunc))
+	ds.SetMetadata(conn.GetProp("METADATA"))
+	ds.SetConfig(conn.Props())
+
+	err = ds.Start()
+	if err != nil {
+		cancel()
+		return ds, g.Error(err, "could start datastream")
+	}
+
+	return
+}
+
+// GetTableColumns returns the columns of the first records of the stream,
+// an error if the plugin cannot read (schemaless target)
+func (conn *PluginConn) GetTableColumns(table *Table, fields ...string) (columns iop.Columns, err error) {
+	if err = conn.can(plugin.CapabilityRead); err != nil {
+		return nil, g.Error("stream %s not found (schemaless)", table.Name)
+	}
+
+	ds, err := conn.StreamRowsContext(conn.Context().Ctx, table.Name, g.M("limit", 10, "silent", true))
+	if err != nil {
+		return columns, g.Error(err, "could not get columns of %s", table.Name)
+	}
+
+	data, err := ds.Collect(10)
+	if err != nil {
+		return columns, g.Error(err, "could not collect to get columns")
+	}
+
+	for i := range data.Columns {
+		data.Columns[i].Table = table.Name
+		data.Columns[i].DbType = "-"
+	}
+
+	return data.Columns, nil
+}
+
+// DropTable deletes the data of the streams
+func (conn *PluginConn) DropTable(tableNames ...string) (err error) {
+	if err = conn.can(plugin.CapabilityWrite); err != nil {
+		return err
+	}
+
+	for _, tableName := range tableNames {
+		table, err := ParseConnTableName(tableName, conn)
+		if err != nil {
+			return g.Error(err, "could not parse table name: "+tableName)
+		}
+
+		if err = conn.Plugin.Call(conn.Context().Ctx, "drop", conn.request(table.Name), nil); err != nil {
+			return g.Error(err, "could not delete data of %s", table.Name)
+		}
+		g.Debug("deleted data of stream %s", table.Name)
+	}
+	return nil
+}
+
+// InsertBatchStream writes the records with the plugin
+func (conn *PluginConn) InsertBatchStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	return conn.BulkImportStream(tableFName, ds)
+}
+
+// BulkImportStream writes the records with the plugin, one JSON record
+// per line (with the same values as the Neo4j parameters)
+func (conn *PluginConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	if err = conn.can(plugin.CapabilityWrite); err != nil {
+		return 0, err
+	}
+
+	table, err := ParseConnTableName(tableFName, conn)
+	if err != nil {
+		return 0, g.Error(err, "could not parse table name: "+tableFName)
+	}
+
+	req := conn.request(table.Name)
+	if pk := conn.GetProp("primary_key"); pk != "" {
+		req.Options = map[string]any{"primary_key": strings.Split(pk, ",")}
+	}
+	for _, col := range ds.Columns {
+		req.Columns = append(req.Columns, plugin.Column{Name: col.Name, Type: string(col.Type)})
+	}
+
+	encoder, wait, err := conn.Plugin.Write(ds.Context.Ctx, *req)
+	if err != nil {
+		return 0, g.Error(err, "could not write %s", table.Name)
+	}
+
+	for batch := range ds.BatchChan {
+		for row := range batch.Rows {
+			if err = encoder.Encode(neo4jRow(batch.Columns, row)); err != nil {
+				ds.Context.CaptureErr(err)
+				wait()
+				return count, g.Error(err, "could not send record to plugin %s", conn.Plugin.Name)
+			}
+			count++
+		}
+	}
+
+	if err = wait(); err != nil {
+		return count, g.Error(err, "could not write %s", table.Name)
+	}
+
+	return count, ds.Err()
+}
+
+// GetSchemas returns the plugin as the schema
+func (conn *PluginConn) GetSchemas() (data iop.Dataset, err error) {
+	data = iop.NewDataset(iop.NewColumnsFromFields("schema_name"))
+	data.Append([]interface{}{conn.name()})
+	return data, nil
+}
+
+// streams returns the streams of the plugin
+func (conn *PluginConn) streams() (streams []string, err error) {
+	if err = conn.can(plugin.CapabilityRead); err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Streams []string `json:"streams"`
+	}
+	if err = conn.Plugin.Call(conn.Context().Ctx, "streams", conn.request(""), &result); err != nil {
+		return nil, g.Error(err, "could not list streams")
+	}
+	return result.Streams, nil
+}
+
+// GetTables returns the streams of the plugin
+func (conn *PluginConn) GetTables(schema string) (data iop.Dataset, err error) {
+	data = iop.NewDataset(iop.NewColumnsFromFields("table_name"))
+	streams, err := conn.streams()
+	if err != nil {
+		return data, err
+	}
+	for _, name := range streams {
+		data.Append([]interface{}{name})
+	}
+	return data, nil
+}
+
+// GetSchemata returns the streams of the plugin, as tables
+func (conn *PluginConn) GetSchemata(level SchemataLevel, schemaName string, tableNames ...string) (Schemata, error) {
+	currDatabase := conn.name()
+	schemata := Schemata{
+		Databases: map[string]Database{},
+		conn:      conn,
+	}
+
+	schema := Schema{Name: currDatabase, Database: currDatabase, Tables: map[string]Table{}}
+	if g.In(level, SchemataLevelTable, SchemataLevelColumn) {
+		streams, err := conn.streams()
+		if err != nil {
+			return schemata, err
+		}
+
+		for _, name := range streams {
+			table := Table{Name: name, Schema: schema.Name, Database: currDatabase, Dialect: conn.GetType()}
+			if level == SchemataLevelColumn && g.In(name, tableNames...) {
+				columns, err := conn.GetTableColumns(&table)
+				if err != nil {
+					return schemata, g.Error(err, "could not get columns")
+				}
+				table.Columns = columns
+			}
+			schema.Tables[strings.ToLower(name)] = table
+		}
+	}
+
+	schemata.Databases[strings.ToLower(currDatabase)] = Database{
+		Name:    currDatabase,
+		Schemas: map[string]Schema{strings.ToLower(schema.Name): schema},
+	}
+
+	return schemata, nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net/url"
 	"os/exec"
 	"strings"
 	"time"
@@ -38,7 +39,29 @@ func (conn *PostgresConn) Init() error {
 	instance := Connection(conn)
 	conn.BaseConn.instance = &instance
 
-	return conn.BaseConn.Init()
+	if err := conn.BaseConn.Init(); err != nil {
+		return err
+	}
+
+	// kerberos (GSSAPI) authentication
+	registerKerberos(conn)
+
+	return nil
+}
+
+// ConnString returns the connection string, with the server-side statement
+// timeout when a query or statement timeout is set
+func (conn *PostgresConn) ConnString() string {
+	connString := conn.BaseConn.ConnString()
+	if timeout := conn.serverTimeout(); timeout > 0 {
+		if u, err := url.Parse(connString); err == nil && u.Scheme != "" {
+			query := u.Query()
+			query.Set("statement_timeout", cast.ToString(timeout.Milliseconds()))
+			u.RawQuery = query.Encode()
+			connString = u.String()
+		}
+	}
+	return connString
 }
 
 // CopyToStdout Copy TO STDOUT
@@ -82,20 +105,86 @@ func (conn *PostgresConn) GenerateDDL(table Table, data iop.Dataset, temporary b
 		return ddl, g.Error(err)
 	}
 
+	// declarative partitioning (not for temporary tables)
 	partitionBy := ""
-	if keyCols := data.Columns.GetKeys(iop.PartitionKey); len(keyCols) > 0 {
-		colNames := conn.GetType().QuoteNames(keyCols.Names()...)
-		partitionBy = g.F("partition by range (%s)", strings.Join(colNames, ", "))
+	partitionType := strings.ToLower(conn.GetProp("partition_type"))
+	if partitionType == "" {
+		partitionType = "range"
+	}
+
+	partitionExprs := []string{}
+	if keys, ok := table.Keys[iop.PartitionKey]; ok {
+		// allow custom SQL expression for partitioning
+		for _, key := range keys {
+			if col := data.Columns.GetColumn(key); col != nil {
+				partitionExprs = append(partitionExprs, conn.Quote(col.Name))
+			} else {
+				partitionExprs = append(partitionExprs, g.F("(%s)", key))
+			}
+		}
+	} else if keyCols := data.Columns.GetKeys(iop.PartitionKey); len(keyCols) > 0 {
+		partitionExprs = conn.QuoteNames(keyCols.Names()...)
+	}
+
+	if len(partitionExprs) > 0 && !temporary {
+		if !g.In(partitionType, "range", "list", "hash") {
+			return ddl, g.Error("invalid partition_type (%s). Expected range, list or hash", partitionType)
+		}
+		partitionBy = g.F("partition by %s (%s)", partitionType, strings.Join(partitionExprs, ", "))
 	}
 	ddl = strings.ReplaceAll(ddl, "{partition_by}", partitionBy)
 
+	// create a default partition so that rows can be inserted right away
+	if partitionBy != "" {
+		defaultTable := table
+		defaultTable.Name = table.Name + "_default"
+		partitionOf := "default"
+		if partitionType == "hash" {
+			partitionOf = "for values with (modulus 1, remainder 0)"
+		}
+		ddl = ddl + ";\n" + g.F("create table if not exists %s partition of %s %s", defaultTable.FullName(), table.FullName(), partitionOf)
+	}
+
 	for _, index := range table.Indexes(data.Columns) {
 		ddl = ddl + ";\n" + index.CreateDDL()
 	}
 
+	// timescale hypertable (not for temporary tables)
+	if ts, err := getTimeSeries(conn); err != nil {
+		return ddl, g.Error(err)
+	} else if ts != nil && ts.TimeColumn != "" && !temporary {
+		hypertable, err := conn.hypertableSQL(table, data.Columns, ts)
+		if err != nil {
+			return ddl, g.Error(err)
+		}
+		ddl = ddl + ";\n" + hypertable
+	}
+
 	return strings.TrimSpace(ddl), nil
 }
 
+// hypertableSQL returns the SQL converting the table into a timescale
+// hypertable, partitioned in chunks on the time column
+func (conn *PostgresConn) hypertableSQL(table Table, columns iop.Columns, ts *TimeSeries) (sql string, err error) {
+	col := columns.GetColumn(ts.TimeColumn)
+	if col == nil {
+		return "", g.Error("did not find time_column %s", ts.TimeColumn)
+	}
+
+	chunkInterval := ""
+	if ts.ChunkInterval != "" {
+		chunkInterval = g.F(", chunk_time_interval => interval '%s'", strings.ReplaceAll(ts.ChunkInterval, "'", "''"))
+	}
+
+	sql = g.F(
+		"select create_hypertable('%s', '%s'%s, if_not_exists => true)",
+		strings.ReplaceAll(table.FullName(), "'", "''"),
+		strings.ReplaceAll(col.Name, "'", "''"),
+		chunkInterval,
+	)
+	return sql, nil
+}
+
 // BulkExportStream uses the bulk dumping (COPY)
 func (conn *PostgresConn) BulkExportStream(table Table) (ds *iop.Datastream, err error) {
 	_, err = exec.LookPath("psql")
@@ -126,7 +215,7 @@ func (conn *PostgresConn) BulkImportStream(tableFName string, ds *iop.Datastream
 
 	mux := ds.Context.Mux
 
-	table, err := ParseTableName(tableFName, conn.GetType())
+	table, err := ParseConnTableName(tableFName, conn)
 	if err != nil {
 		err = g.Error(err, "could not get table name for import")
 		return
@@ -90,7 +90,7 @@ func (conn *ProtonConn) GenerateDDL(table Table, data iop.Dataset, temporary boo
 		// allow custom SQL expression for partitioning
 		partitionBy = g.F("partition by (%s)", strings.Join(keys, ", "))
 	} else if keyCols := data.Columns.GetKeys(iop.PartitionKey); len(keyCols) > 0 {
-		colNames := conn.GetType().QuoteNames(keyCols.Names()...)
+		colNames := conn.QuoteNames(keyCols.Names()...)
 		partitionBy = g.F("partition by %s", strings.Join(colNames, ", "))
 	}
 	sql = strings.ReplaceAll(sql, "{partition_by}", partitionBy)
@@ -102,7 +102,7 @@ func (conn *ProtonConn) GenerateDDL(table Table, data iop.Dataset, temporary boo
 func (conn *ProtonConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
 	var columns iop.Columns
 
-	table, err := ParseTableName(tableFName, conn.GetType())
+	table, err := ParseConnTableName(tableFName, conn)
 	if err != nil {
 		err = g.Error(err, "could not get table name for import")
 		return
@@ -306,7 +306,7 @@ func (conn *ProtonConn) GenerateInsertStatement(tableName string, cols iop.Colum
 	}
 
 	if conn.GetProp("http_url") != "" {
-		table, _ := ParseTableName(tableName, conn.GetType())
+		table, _ := ParseConnTableName(tableName, conn)
 		tableName = table.NameQ()
 	}
 
@@ -328,6 +328,11 @@ func (conn *ProtonConn) GenerateUpsertSQL(srcTable string, tgtTable string, pkFi
 		return
 	}
 
+	if upsertMap["preserve_set_fields"] != "" {
+		err = g.Error("update_columns / ignore_update_columns are not supported for Proton")
+		return
+	}
+
 	// proton does not support upsert with delete
 	sqlTempl := `
 	insert into {tgt_table}
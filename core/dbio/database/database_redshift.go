@@ -14,7 +14,9 @@ import (
 	"github.com/dustin/go-humanize"
 	"github.com/flarco/g"
 	"github.com/jmoiron/sqlx"
+	"github.com/samber/lo"
 	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/env"
 	"github.com/spf13/cast"
 )
 
@@ -71,14 +73,14 @@ func (conn *RedshiftConn) GenerateDDL(table Table, data iop.Dataset, temporary b
 
 	distKey := ""
 	if keyCols := data.Columns.GetKeys(iop.DistributionKey); len(keyCols) > 0 {
-		colNames := conn.GetType().QuoteNames(keyCols.Names()...)
+		colNames := conn.QuoteNames(keyCols.Names()...)
 		distKey = g.F("distkey(%s)", strings.Join(colNames, ", "))
 	}
 	sql = strings.ReplaceAll(sql, "{dist_key}", distKey)
 
 	sortKey := ""
 	if keyCols := data.Columns.GetKeys(iop.SortKey); len(keyCols) > 0 {
-		colNames := conn.GetType().QuoteNames(keyCols.Names()...)
+		colNames := conn.QuoteNames(keyCols.Names()...)
 		sortKey = g.F("compound sortkey(%s)", strings.Join(colNames, ", "))
 	}
 	sql = strings.ReplaceAll(sql, "{sort_key}", sortKey)
@@ -93,72 +95,15 @@ func (conn *RedshiftConn) Unload(ctx *g.Context, tables ...Table) (s3Path string
 		return "", g.Error("need to set AWS_BUCKET")
 	}
 
-	AwsID := conn.GetProp("AWS_ACCESS_KEY_ID")
-	AwsAccessKey := conn.GetProp("AWS_SECRET_ACCESS_KEY")
-	AwsSessionToken := conn.GetProp("AWS_SESSION_TOKEN")
-
-	AwsSessionTokenExpr := ""
-	if AwsSessionToken != "" {
-		AwsSessionTokenExpr = g.F(";token=%s", AwsSessionToken)
-	}
+	credentials := conn.copyCredentialsExpr()
 
 	g.Info("unloading from redshift to s3")
 	queryContext := g.NewContext(ctx.Ctx)
 	unload := func(table Table, s3PathPart string) {
-
 		defer queryContext.Wg.Write.Done()
-
-		// if it is limited, create temp table first, unload and drop
-		matched, _ := regexp.MatchString(`limit\s+\d+`, strings.ToLower(table.Select()))
-		if matched || table.limit > 0 {
-			// create temp table
-			tempTable := table.Clone()
-			tempTable.Name = fmt.Sprintf("temp_unload_%d", time.Now().UnixNano())
-
-			createSQL := g.F("create temporary table %s as %s", tempTable.Name, table.Select())
-
-			// update unload SQL to use temp table
-			unloadSQL := g.R(
-				conn.template.Core["copy_to_s3"],
-				"sql", g.F("select * from %s", tempTable.Name),
-				"s3_path", s3PathPart,
-				"aws_access_key_id", AwsID,
-				"aws_secret_access_key", AwsAccessKey,
-				"aws_session_token_expr", AwsSessionTokenExpr,
-				"parallel", conn.GetProp("PARALLEL"),
-			)
-
-			dropTableSQL := g.F("drop table if exists %s", tempTable.Name)
-
-			_, err = conn.ExecMulti(createSQL, unloadSQL, dropTableSQL)
-			if err != nil {
-				err = g.Error(err, "could not create temp table for unload")
-				queryContext.CaptureErr(err)
-				return
-			}
-
-		} else {
-
-			sql := strings.ReplaceAll(strings.ReplaceAll(table.Select(), "\n", " "), "'", "''")
-
-			unloadSQL := g.R(
-				conn.template.Core["copy_to_s3"],
-				"sql", sql,
-				"s3_path", s3PathPart,
-				"aws_access_key_id", AwsID,
-				"aws_secret_access_key", AwsAccessKey,
-				"parallel", conn.GetProp("PARALLEL"),
-			)
-
-			_, err = conn.Exec(unloadSQL)
-			if err != nil {
-				cleanSQL := strings.ReplaceAll(unloadSQL, AwsID, "*****")
-				cleanSQL = strings.ReplaceAll(cleanSQL, AwsAccessKey, "*****")
-				err = g.Error(err, fmt.Sprintf("SQL Error for %s:\n%s", s3PathPart, cleanSQL))
-				queryContext.CaptureErr(err)
-			}
+		if err := conn.unloadToS3(table, s3PathPart, credentials); err != nil {
+			queryContext.CaptureErr(err)
 		}
-
 	}
 
 	s3Fs, err := filesys.NewFileSysClient(dbio.TypeFileS3, conn.PropArr()...)
@@ -167,7 +112,7 @@ func (conn *RedshiftConn) Unload(ctx *g.Context, tables ...Table) (s3Path string
 		return
 	}
 
-	s3Path = fmt.Sprintf("s3://%s/%s/stream/%s.csv", conn.GetProp("AWS_BUCKET"), tempCloudStorageFolder, cast.ToString(g.Now()))
+	s3Path = fmt.Sprintf("s3://%s/%s/stream/%s.csv", conn.GetProp("AWS_BUCKET"), conn.tempCloudFolder(), cast.ToString(g.Now()))
 
 	filesys.Delete(s3Fs, s3Path)
 	for i, table := range tables {
@@ -186,6 +131,87 @@ func (conn *RedshiftConn) Unload(ctx *g.Context, tables ...Table) (s3Path string
 	return s3Path, err
 }
 
+// unloadToS3 unloads the table into the files of the s3 path prefix
+func (conn *RedshiftConn) unloadToS3(table Table, s3PathPart, credentials string) (err error) {
+	// if it is limited, create temp table first, unload and drop
+	matched, _ := regexp.MatchString(`limit\s+\d+`, strings.ToLower(table.Select()))
+	if matched || table.limit > 0 {
+		// create temp table
+		tempTable := table.Clone()
+		tempTable.Name = fmt.Sprintf("temp_unload_%d", time.Now().UnixNano())
+
+		createSQL := g.F("create temporary table %s as %s", tempTable.Name, table.Select())
+
+		// update unload SQL to use temp table
+		unloadSQL := g.R(
+			conn.template.Core["copy_to_s3"],
+			"sql", g.F("select * from %s", tempTable.Name),
+			"s3_path", s3PathPart,
+			"credentials", credentials,
+			"parallel", conn.GetProp("PARALLEL"),
+		)
+
+		dropTableSQL := g.F("drop table if exists %s", tempTable.Name)
+
+		_, err = conn.ExecMulti(createSQL, unloadSQL, dropTableSQL)
+		if err != nil {
+			return g.Error(err, "could not create temp table for unload")
+		}
+
+	} else {
+
+		sql := strings.ReplaceAll(strings.ReplaceAll(table.Select(), "\n", " "), "'", "''")
+
+		unloadSQL := g.R(
+			conn.template.Core["copy_to_s3"],
+			"sql", sql,
+			"s3_path", s3PathPart,
+			"credentials", credentials,
+			"parallel", conn.GetProp("PARALLEL"),
+		)
+
+		_, err = conn.Exec(unloadSQL)
+		if err != nil {
+			return g.Error(err, fmt.Sprintf("SQL Error for %s:\n%s", s3PathPart, env.Clean(conn.Props(), unloadSQL)))
+		}
+	}
+	return nil
+}
+
+// StagingTypes returns the object stores supported for staging
+func (conn *RedshiftConn) StagingTypes() []dbio.Type {
+	return []dbio.Type{dbio.TypeFileS3}
+}
+
+// UnloadToStorage unloads the table into the files of the s3 folder
+func (conn *RedshiftConn) UnloadToStorage(table Table, folderURL string) (err error) {
+	if StagingType(folderURL) != dbio.TypeFileS3 {
+		return g.Error("redshift cannot unload to %s", folderURL)
+	}
+
+	g.Info("unloading from redshift to %s", folderURL)
+	filePrefix := strings.TrimSuffix(folderURL, "/") + "/" + StagingFilePrefix
+	return conn.unloadToS3(table, filePrefix, conn.copyCredentialsExpr())
+}
+
+// LoadFromStorage loads the files of the s3 folder into the table
+func (conn *RedshiftConn) LoadFromStorage(tableFName, folderURL string, columns iop.Columns) (err error) {
+	if StagingType(folderURL) != dbio.TypeFileS3 {
+		return g.Error("redshift cannot load from %s", folderURL)
+	}
+
+	// the unloaded files have `\N` as null
+	s3Path := strings.TrimSuffix(folderURL, "/") + "/" + StagingFilePrefix
+	sql := conn.copyFromS3SQL(tableFName, s3Path, columns) + ` NULL AS '\\N'`
+
+	g.Debug("copying into redshift from %s", s3Path)
+	if _, err = conn.Exec(sql); err != nil {
+		conn.WarnStlLoadErrors(err)
+		return g.Error(err, "could not load from %s", folderURL)
+	}
+	return nil
+}
+
 // BulkExportStream reads in bulk
 func (conn *RedshiftConn) BulkExportStream(table Table) (ds *iop.Datastream, err error) {
 
@@ -262,7 +288,7 @@ func (conn *RedshiftConn) BulkImportFlow(tableFName string, df *iop.Dataflow) (c
 	s3Path := fmt.Sprintf(
 		"s3://%s/%s/%s",
 		conn.GetProp("AWS_BUCKET"),
-		tempCloudStorageFolder,
+		conn.tempCloudFolder(),
 		tableFName,
 	)
 
@@ -291,7 +317,14 @@ func (conn *RedshiftConn) BulkImportFlow(tableFName string, df *iop.Dataflow) (c
 	}
 	g.DebugLow("total written: %s to %s", humanize.Bytes(cast.ToUint64(bw)), s3Path)
 
-	_, err = conn.CopyFromS3(tableFName, s3Path, df.Columns)
+	// use a manifest when multiple files were written, so that only
+	// these files are loaded (the prefix could match other objects)
+	copyPath, err := conn.writeManifest(s3Fs, s3Path)
+	if err != nil {
+		return df.Count(), g.Error(err, "could not generate manifest")
+	}
+
+	_, err = conn.CopyFromS3(tableFName, copyPath, df.Columns)
 	if err != nil {
 		return df.Count(), g.Error(err, "error copying into redshift from s3")
 	}
@@ -339,6 +372,17 @@ func (conn *RedshiftConn) GenerateUpsertSQL(srcTable string, tgtTable string, pk
 	from {src_table} src
 	`
 
+	// keep the target values of the columns not to update
+	if preserveSetFields := upsertMap["preserve_set_fields"]; preserveSetFields != "" {
+		sqlTempl = `
+	update {src_table}
+	set {preserve_set_fields}
+	from {tgt_table} tgt
+	where {src_tgt_pk_equal_tgt}
+	;
+	` + sqlTempl
+	}
+
 	sql = g.R(
 		sqlTempl,
 		"src_table", srcTable,
@@ -346,18 +390,74 @@ func (conn *RedshiftConn) GenerateUpsertSQL(srcTable string, tgtTable string, pk
 		"insert_fields", upsertMap["insert_fields"],
 		"src_fields", upsertMap["src_fields"],
 		"src_tgt_pk_equal", srcTgtPkEqual,
+		"src_tgt_pk_equal_tgt", strings.ReplaceAll(upsertMap["src_tgt_pk_equal"], "src.", srcTable+"."),
+		"preserve_set_fields", upsertMap["preserve_set_fields"],
 	)
 	return
 }
 
-// CopyFromS3 uses the COPY INTO Table command from AWS S3
-func (conn *RedshiftConn) CopyFromS3(tableFName, s3Path string, columns iop.Columns) (count uint64, err error) {
+// redshiftManifestSuffix is the file name suffix of a COPY manifest
+const redshiftManifestSuffix = ".manifest"
+
+// writeManifest lists the files written under the s3 folder. If there are multiple,
+// a COPY manifest is written and its path is returned, otherwise the file path.
+// https://docs.aws.amazon.com/redshift/latest/dg/loading-data-files-using-manifest.html
+func (conn *RedshiftConn) writeManifest(s3Fs filesys.FileSysClient, s3Path string) (copyPath string, err error) {
+	nodes, err := s3Fs.ListRecursive(s3Path)
+	if err != nil {
+		return "", g.Error(err, "could not list files in %s", s3Path)
+	}
+
+	uris := []string{}
+	for _, uri := range nodes.Files().URIs() {
+		// the prefix could match other objects, such as `my_table_2`
+		if strings.HasPrefix(uri, s3Path+"/") && !strings.HasSuffix(uri, redshiftManifestSuffix) {
+			uris = append(uris, uri)
+		}
+	}
+
+	switch len(uris) {
+	case 0:
+		return s3Path, nil
+	case 1:
+		return uris[0], nil
+	}
+
+	copyPath = s3Path + "/sling" + redshiftManifestSuffix
+	_, err = s3Fs.Write(copyPath, strings.NewReader(redshiftManifest(uris)))
+	if err != nil {
+		return "", g.Error(err, "could not write manifest to %s", copyPath)
+	}
+	g.Debug("wrote manifest with %d files to %s", len(uris), copyPath)
+
+	return copyPath, nil
+}
+
+// redshiftManifest generates a COPY manifest for the file uris
+func redshiftManifest(uris []string) string {
+	entries := make([]map[string]any, len(uris))
+	for i, uri := range uris {
+		entries[i] = g.M("url", uri, "mandatory", true)
+	}
+	return g.Marshal(g.M("entries", entries))
+}
+
+// copyCredentialsExpr returns the authorization clause for COPY and UNLOAD.
+// The IAM role is used when `iam_role` is provided, or when no access keys are
+// provided, in which case the default IAM role of the cluster is used.
+func (conn *RedshiftConn) copyCredentialsExpr() string {
+	if role := conn.GetProp("IAM_ROLE", "AWS_IAM_ROLE"); role != "" {
+		if strings.EqualFold(role, "default") {
+			return "iam_role default"
+		}
+		return g.F("iam_role '%s'", role)
+	}
+
 	AwsID := conn.GetProp("AWS_ACCESS_KEY_ID")
 	AwsAccessKey := conn.GetProp("AWS_SECRET_ACCESS_KEY")
 	AwsSessionToken := conn.GetProp("AWS_SESSION_TOKEN")
-	if (AwsID == "" || AwsAccessKey == "") && (AwsSessionToken == "") {
-		err = g.Error("Need to set 'AWS_ACCESS_KEY_ID' and 'AWS_SECRET_ACCESS_KEY' or 'AWS_SESSION_TOKEN' to copy to redshift from S3")
-		return
+	if AwsID == "" && AwsAccessKey == "" && AwsSessionToken == "" {
+		return "iam_role default"
 	}
 
 	AwsSessionTokenExpr := ""
@@ -365,20 +465,34 @@ func (conn *RedshiftConn) CopyFromS3(tableFName, s3Path string, columns iop.Colu
 		AwsSessionTokenExpr = g.F(";token=%s", AwsSessionToken)
 	}
 
-	tgtColumns := conn.GetType().QuoteNames(columns.Names()...)
+	return g.F(
+		"credentials 'aws_access_key_id=%s;aws_secret_access_key=%s%s'",
+		AwsID, AwsAccessKey, AwsSessionTokenExpr,
+	)
+}
+
+// copyFromS3SQL generates the COPY statement. Additional options
+// can be provided with the `copy_options` property.
+func (conn *RedshiftConn) copyFromS3SQL(tableFName, s3Path string, columns iop.Columns) string {
+	tgtColumns := conn.QuoteNames(columns.Names()...)
 
-	g.Debug("copying into redshift from s3")
-	g.Debug("url: " + s3Path)
 	sql := g.R(
 		conn.template.Core["copy_from_s3"],
 		"tgt_table", tableFName,
 		"tgt_columns", strings.Join(tgtColumns, ", "),
 		"s3_path", s3Path,
-		"aws_access_key_id", AwsID,
-		"aws_secret_access_key", AwsAccessKey,
-		"aws_session_token_expr", AwsSessionTokenExpr,
+		"credentials", conn.copyCredentialsExpr(),
+		"manifest", lo.Ternary(strings.HasSuffix(s3Path, redshiftManifestSuffix), "MANIFEST", ""),
+		"copy_options", conn.GetProp("copy_options"),
 	)
-	sql = conn.setEmptyAsNull(sql)
+	return strings.TrimSpace(conn.setEmptyAsNull(sql))
+}
+
+// CopyFromS3 uses the COPY INTO Table command from AWS S3
+func (conn *RedshiftConn) CopyFromS3(tableFName, s3Path string, columns iop.Columns) (count uint64, err error) {
+	g.Debug("copying into redshift from s3")
+	g.Debug("url: " + s3Path)
+	sql := conn.copyFromS3SQL(tableFName, s3Path, columns)
 
 	_, err = conn.Exec(sql)
 	if err != nil {
@@ -0,0 +1,638 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+)
+
+// SaaSConn is a connection to the REST API of a SaaS application (stripe,
+// shopify, hubspot). The resources (e.g. `customers`) are read as tables, page
+// by page, with the incremental filter applied by the API when possible.
+type SaaSConn struct {
+	BaseConn
+	URL    string
+	Client *http.Client
+}
+
+// saasResources are the common resources of the APIs, listed as tables
+var saasResources = map[dbio.Type][]string{
+	dbio.TypeDbStripe:  {"balance_transactions", "charges", "customers", "disputes", "events", "invoices", "payment_intents", "payouts", "prices", "products", "refunds", "subscriptions"},
+	dbio.TypeDbShopify: {"customers", "orders", "products", "custom_collections", "smart_collections", "price_rules"},
+	dbio.TypeDbHubSpot: {"companies", "contacts", "deals", "line_items", "products", "quotes", "tickets"},
+}
+
+// Init initiates the object
+func (conn *SaaSConn) Init() error {
+
+	conn.BaseConn.URL = conn.URL
+	conn.Client = &http.Client{Timeout: 5 * time.Minute}
+	switch {
+	case strings.HasPrefix(conn.URL, "shopify:"):
+		conn.BaseConn.Type = dbio.TypeDbShopify
+	case strings.HasPrefix(conn.URL, "hubspot:"):
+		conn.BaseConn.Type = dbio.TypeDbHubSpot
+	default:
+		conn.BaseConn.Type = dbio.TypeDbStripe
+	}
+
+	instance := Connection(conn)
+	conn.BaseConn.instance = &instance
+	return conn.BaseConn.Init()
+}
+
+// Connect connects to the API, checking the credentials
+func (conn *SaaSConn) Connect(timeOut ...int) (err error) {
+	ping := map[dbio.Type]string{
+		dbio.TypeDbStripe:  "/v1/balance",
+		dbio.TypeDbShopify: "/shop.json",
+		dbio.TypeDbHubSpot: "/crm/v3/objects/contacts?limit=1",
+	}[conn.GetType()]
+
+	if _, _, err = conn.request(conn.Context().Ctx, saasRequest{Method: http.MethodGet, URL: conn.baseURL() + ping}); err != nil {
+		return g.Error(err, "Failed to connect to %s", conn.GetType().Name())
+	}
+
+	if !cast.ToBool(conn.GetProp("silent")) {
+		g.Debug(`opened "%s" connection (%s)`, conn.Type, conn.GetProp("sling_conn_id"))
+	}
+
+	conn.SetProp("connected", "true")
+
+	return nil
+}
+
+func (conn *SaaSConn) Close() error {
+	conn.SetProp("connected", "false")
+	g.Debug(`closed "%s" connection (%s)`, conn.Type, conn.GetProp("sling_conn_id"))
+	return nil
+}
+
+// NewTransaction creates a new transaction
+func (conn *SaaSConn) NewTransaction(ctx context.Context, options ...*sql.TxOptions) (tx Transaction, err error) {
+	// does not support transaction
+	return
+}
+
+func (conn *SaaSConn) ExecContext(ctx context.Context, sql string, args ...interface{}) (result sql.Result, err error) {
+	return nil, g.Error("ExecContext not implemented on SaaSConn")
+}
+
+// baseURL returns the API URL, overridden with the `base_url` property
+func (conn *SaaSConn) baseURL() string {
+	if baseURL := conn.GetProp("base_url"); baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/")
+	}
+
+	switch conn.GetType() {
+	case dbio.TypeDbShopify:
+		shop := strings.TrimSuffix(strings.TrimPrefix(conn.GetProp("shop"), "https://"), "/")
+		if !strings.Contains(shop, ".") {
+			shop = shop + ".myshopify.com"
+		}
+		version := conn.GetProp("api_version")
+		if version == "" {
+			version = "2024-10"
+		}
+		return g.F("https://%s/admin/api/%s", shop, version)
+	case dbio.TypeDbHubSpot:
+		return "https://api.hubapi.com"
+	}
+	return "https://api.stripe.com"
+}
+
+// authenticate sets the credentials of the request
+func (conn *SaaSConn) authenticate(req *http.Request) {
+	switch conn.GetType() {
+	case dbio.TypeDbStripe:
+		req.Header.Set("Authorization", "Bearer "+conn.GetProp("api_key", "secret_key"))
+		if version := conn.GetProp("api_version"); version != "" {
+			req.Header.Set("Stripe-Version", version)
+		}
+	case dbio.TypeDbShopify:
+		req.Header.Set("X-Shopify-Access-Token", conn.GetProp("access_token"))
+	case dbio.TypeDbHubSpot:
+		req.Header.Set("Authorization", "Bearer "+conn.GetProp("access_token", "api_key"))
+	}
+}
+
+// saasRequest is the request of a page
+type saasRequest struct {
+	Method string
+	URL    string
+	Body   map[string]any // json body
+}
+
+// request sends the request, retrying when rate-limited (429) or when the
+// API is unavailable (5xx), up to `max_retries` times (5 by default)
+func (conn *SaaSConn) request(ctx context.Context, sr saasRequest) (body []byte, header http.Header, err error) {
+	maxRetries := 5
+	if val := conn.GetProp("max_retries"); val != "" {
+		maxRetries = cast.ToInt(val)
+	}
+
+	for attempt := 0; ; attempt++ {
+		var reqBody io.Reader
+		if sr.Body != nil {
+			reqBody = strings.NewReader(g.Marshal(sr.Body))
+		}
+
+		req, err := http.NewRequestWithContext(ctx, sr.Method, sr.URL, reqBody)
+		if err != nil {
+			return nil, nil, g.Error(err, "could not create request")
+		}
+		conn.authenticate(req)
+		req.Header.Set("Accept", "application/json")
+		if sr.Body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		g.Trace("%s request #%d: %s %s", conn.Type, attempt+1, sr.Method, sr.URL)
+		resp, err := conn.Client.Do(req)
+		if err != nil {
+			return nil, nil, g.Error(err, "could not send request")
+		}
+
+		body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, g.Error(err, "could not read from request body")
+		}
+
+		if (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500) && attempt < maxRetries {
+			delay := saasRetryDelay(resp.Header, attempt)
+			g.Debug("%s request returned status %d, retrying in %s", conn.Type, resp.StatusCode, delay)
+			select {
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			case <-time.After(delay):
+			}
+			continue
+		} else if resp.StatusCode >= 300 {
+			return nil, nil, g.Error("%s returned status %d: %s", conn.GetType().Name(), resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+
+		return body, resp.Header, nil
+	}
+}
+
+// saasRetryDelay returns the delay of the Retry-After header (in seconds),
+// else an exponential backoff
+func saasRetryDelay(header http.Header, attempt int) time.Duration {
+	if val := header.Get("Retry-After"); val != "" {
+		if seconds, err := cast.ToFloat64E(val); err == nil {
+			return time.Duration(seconds * float64(time.Second))
+		}
+	}
+	return time.Duration(math.Min(math.Pow(2, float64(attempt)), 60)) * time.Second
+}
+
+// saasQuery are the options of a resource read
+type saasQuery struct {
+	Resource   string
+	Fields     []string
+	Limit      int
+	UpdateKey  string
+	Value      string // incremental: the records updated after
+	StartValue string // backfill range
+	EndValue   string
+}
+
+func newSaaSQuery(resource string, opts map[string]any) saasQuery {
+	trim := func(key string) string { return strings.Trim(cast.ToString(opts[key]), `'"`) }
+	q := saasQuery{
+		Resource:   resource,
+		Limit:      cast.ToInt(opts["limit"]),
+		UpdateKey:  trim("update_key"),
+		Value:      trim("value"),
+		StartValue: trim("start_value"),
+		EndValue:   trim("end_value"),
+	}
+	if q.Value == "null" {
+		q.Value = ""
+	}
+	for _, field := range cast.ToStringSlice(opts["fields"]) {
+		if field = strings.TrimSpace(field); field != "" && field != "*" {
+			q.Fields = append(q.Fields, field)
+		}
+	}
+	return q
+}
+
+// Keep returns true if the record is within the incremental value or the
+// backfill range, when filtering after reading
+func (q saasQuery) Keep(rec map[string]any) bool {
+	if q.UpdateKey == "" {
+		return true
+	}
+	val, ok := rec[q.UpdateKey]
+	if !ok {
+		return true
+	}
+
+	switch {
+	case q.Value != "":
+		return saasCompare(val, q.Value) > 0
+	case q.StartValue != "" && q.EndValue != "":
+		return saasCompare(val, q.StartValue) >= 0 && saasCompare(val, q.EndValue) <= 0
+	}
+	return true
+}
+
+// saasCompare compares the value with the bound, as timestamps, numbers or
+// strings
+func saasCompare(val any, bound string) int {
+	if val == nil {
+		return -1
+	}
+
+	if f, err := cast.ToFloat64E(val); err == nil {
+		if b, err := cast.ToFloat64E(bound); err == nil {
+			return cmpFloat(f, b)
+		} else if bt, err := cast.ToTimeE(bound); err == nil {
+			return cmpFloat(f, float64(bt.Unix())) // unix timestamp
+		}
+	}
+
+	if t, err := cast.ToTimeE(val); err == nil {
+		if bt, err := cast.ToTimeE(bound); err == nil {
+			return t.Compare(bt)
+		}
+	}
+
+	return strings.Compare(cast.ToString(val), bound)
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// saasTime parses the bound value (unix seconds or timestamp)
+func saasTime(val string) (t time.Time, ok bool) {
+	if val == "" {
+		return t, false
+	} else if i, err := cast.ToInt64E(val); err == nil {
+		return time.Unix(i, 0).UTC(), true
+	}
+	t, err := cast.ToTimeE(val)
+	return t.UTC(), err == nil
+}
+
+// saasPage is a page of records, with the request of the next page (nil if
+// the last)
+type saasPage struct {
+	Records []map[string]any
+	Next    *saasRequest
+}
+
+// firstRequest returns the request of the first page, with the incremental
+// filter applied by the API when the update key supports it
+func (conn *SaaSConn) firstRequest(q saasQuery) (sr saasRequest) {
+	params := url.Values{}
+	sr = saasRequest{Method: http.MethodGet}
+
+	switch conn.GetType() {
+	case dbio.TypeDbStripe:
+		// https://docs.stripe.com/api/pagination
+		params.Set("limit", "100")
+		if q.UpdateKey == "created" {
+			if t, ok := saasTime(q.Value); ok {
+				params.Set("created[gt]", cast.ToString(t.Unix()))
+			}
+			if t, ok := saasTime(q.StartValue); ok {
+				params.Set("created[gte]", cast.ToString(t.Unix()))
+			}
+			if t, ok := saasTime(q.EndValue); ok {
+				params.Set("created[lte]", cast.ToString(t.Unix()))
+			}
+		}
+		sr.URL = g.F("%s/v1/%s?%s", conn.baseURL(), q.Resource, params.Encode())
+
+	case dbio.TypeDbShopify:
+		// https://shopify.dev/docs/api/usage/pagination-rest
+		params.Set("limit", "250")
+		if q.Resource == "orders" {
+			params.Set("status", "any") // open orders by default
+		}
+		if len(q.Fields) > 0 {
+			params.Set("fields", strings.Join(q.Fields, ","))
+		}
+		if g.In(q.UpdateKey, "updated_at", "created_at") {
+			if t, ok := saasTime(q.Value); ok {
+				params.Set(q.UpdateKey+"_min", t.Format(time.RFC3339))
+			}
+			if t, ok := saasTime(q.StartValue); ok {
+				params.Set(q.UpdateKey+"_min", t.Format(time.RFC3339))
+			}
+			if t, ok := saasTime(q.EndValue); ok {
+				params.Set(q.UpdateKey+"_max", t.Format(time.RFC3339))
+			}
+		}
+		sr.URL = g.F("%s/%s.json?%s", conn.baseURL(), q.Resource, params.Encode())
+
+	case dbio.TypeDbHubSpot:
+		// https://developers.hubspot.com/docs/api/crm/search
+		property := map[string]string{"updatedAt": "hs_lastmodifieddate", "createdAt": "hs_createdate"}[q.UpdateKey]
+		if q.Resource == "contacts" {
+			property = map[string]string{"updatedAt": "lastmodifieddate", "createdAt": "createdate"}[q.UpdateKey]
+		}
+
+		filters := []map[string]any{}
+		if t, ok := saasTime(q.Value); ok && property != "" {
+			filters = append(filters, g.M("propertyName", property, "operator", "GT", "value", t.UnixMilli()))
+		} else if start, ok := saasTime(q.StartValue); ok && property != "" {
+			if end, ok := saasTime(q.EndValue); ok {
+				filters = append(filters, g.M("propertyName", property, "operator", "BETWEEN", "value", start.UnixMilli(), "highValue", end.UnixMilli()))
+			}
+		}
+
+		if len(filters) > 0 {
+			// the search is limited to 10,000 records per query
+			sr.Method = http.MethodPost
+			sr.URL = g.F("%s/crm/v3/objects/%s/search", conn.baseURL(), q.Resource)
+			sr.Body = g.M(
+				"filterGroups", []any{g.M("filters", filters)},
+				"sorts", []any{g.M("propertyName", property, "direction", "ASCENDING")},
+				"limit", 100,
+			)
+			if len(q.Fields) > 0 {
+				sr.Body["properties"] = q.Fields
+			}
+			return sr
+		}
+
+		params.Set("limit", "100")
+		if len(q.Fields) > 0 {
+			params.Set("properties", strings.Join(q.Fields, ","))
+		}
+		sr.URL = g.F("%s/crm/v3/objects/%s?%s", conn.baseURL(), q.Resource, params.Encode())
+	}
+
+	return sr
+}
+
+var linkNextRegex = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// fetch returns the page of the request, with the request of the next page
+func (conn *SaaSConn) fetch(ctx context.Context, q saasQuery, sr saasRequest) (page saasPage, err error) {
+	body, header, err := conn.request(ctx, sr)
+	if err != nil {
+		return page, g.Error(err, "could not get %s page", q.Resource)
+	}
+
+	var payload map[string]any
+	if err = g.Unmarshal(string(body), &payload); err != nil {
+		return page, g.Error(err, "could not unmarshal %s page", q.Resource)
+	}
+
+	records := func(key string) []map[string]any {
+		recs := []map[string]any{}
+		for _, rec := range cast.ToSlice(payload[key]) {
+			if m, ok := rec.(map[string]any); ok {
+				recs = append(recs, m)
+			}
+		}
+		return recs
+	}
+
+	switch conn.GetType() {
+	case dbio.TypeDbStripe:
+		page.Records = records("data")
+		if cast.ToBool(payload["has_more"]) && len(page.Records) > 0 {
+			lastID := cast.ToString(page.Records[len(page.Records)-1]["id"])
+			page.Next = &saasRequest{Method: sr.Method, URL: saasSetParam(sr.URL, "starting_after", lastID)}
+		}
+
+	case dbio.TypeDbShopify:
+		page.Records = records(path.Base(q.Resource))
+		if matches := linkNextRegex.FindStringSubmatch(header.Get("Link")); len(matches) > 1 {
+			page.Next = &saasRequest{Method: http.MethodGet, URL: matches[1]}
+		}
+
+	case dbio.TypeDbHubSpot:
+		// the properties are the columns of the record
+		for _, rec := range records("results") {
+			props, _ := rec["properties"].(map[string]any)
+			delete(rec, "properties")
+			for k, v := range props {
+				if _, ok := rec[k]; !ok {
+					rec[k] = v
+				}
+			}
+			page.Records = append(page.Records, rec)
+		}
+
+		paging, _ := payload["paging"].(map[string]any)
+		next, _ := paging["next"].(map[string]any)
+		if after := cast.ToString(next["after"]); after != "" {
+			if sr.Body != nil {
+				nextBody := g.M()
+				for k, v := range sr.Body {
+					nextBody[k] = v
+				}
+				nextBody["after"] = after
+				page.Next = &saasRequest{Method: sr.Method, URL: sr.URL, Body: nextBody}
+			} else {
+				page.Next = &saasRequest{Method: sr.Method, URL: saasSetParam(sr.URL, "after", after)}
+			}
+		}
+	}
+
+	return page, nil
+}
+
+// saasSetParam sets the query parameter of the URL
+func saasSetParam(URL, key, val string) string {
+	u, err := url.Parse(URL)
+	if err != nil {
+		return URL
+	}
+	params := u.Query()
+	params.Set(key, val)
+	u.RawQuery = params.Encode()
+	return u.String()
+}
+
+// saasPager decodes the pages of records, fetching the next page when needed
+type saasPager struct {
+	conn  *SaaSConn
+	ctx   context.Context
+	query saasQuery
+	next  *saasRequest
+	count int
+}
+
+// Decode sets the records of the next page (as an array)
+func (p *saasPager) Decode(obj any) error {
+	if p.next == nil || (p.query.Limit > 0 && p.count >= p.query.Limit) {
+		return io.EOF
+	}
+
+	page, err := p.conn.fetch(p.ctx, p.query, *p.next)
+	if err != nil {
+		return err
+	}
+	p.next = page.Next
+
+	records := []any{}
+	for _, rec := range page.Records {
+		if !p.query.Keep(rec) {
+			continue
+		} else if p.query.Limit > 0 && p.count >= p.query.Limit {
+			break
+		}
+		records = append(records, rec)
+		p.count++
+	}
+
+	if payload, ok := obj.(*any); ok {
+		*payload = records
+		return nil
+	}
+	return g.JSONConvert(records, obj)
+}
+
+// BulkExportFlow reads the resource, with the options of the table SQL
+// (a json of the fields and incremental values)
+func (conn *SaaSConn) BulkExportFlow(table Table) (df *iop.Dataflow, err error) {
+	options, _ := g.UnmarshalMap(table.SQL)
+	ds, err := conn.StreamRowsContext(conn.Context().Ctx, table.Name, options)
+	if err != nil {
+		return df, g.Error(err, "could start datastream")
+	}
+
+	df, err = iop.MakeDataFlow(ds)
+	if err != nil {
+		return df, g.Error(err, "could start dataflow")
+	}
+
+	return
+}
+
+// StreamRowsContext reads the records of the resource, page by page
+func (conn *SaaSConn) StreamRowsContext(ctx context.Context, resource string, Opts ...map[string]interface{}) (ds *iop.Datastream, err error) {
+	opts := getQueryOptions(Opts)
+	if table, err := ParseConnTableName(resource, conn); err == nil && table.Name != "" {
+		resource = table.Name
+	}
+
+	if strings.TrimSpace(resource) == "" {
+		g.Warn("Empty resource name")
+		return ds, nil
+	}
+
+	queryContext := g.NewContext(ctx)
+	query := newSaaSQuery(resource, opts)
+	first := conn.firstRequest(query)
+
+	if !cast.ToBool(opts["silent"]) {
+		conn.LogSQL(g.Marshal(g.M("method", first.Method, "url", first.URL, "body", first.Body)))
+	}
+
+	ds = iop.NewDatastreamContext(queryContext.Ctx, nil)
+
+	flatten, err := iop.ParseFlattenOptions(conn.Props(), true)
+	if err != nil {
+		return ds, g.Error(err, "invalid flatten options")
+	}
+
+	pager := &saasPager{conn: conn, ctx: queryContext.Ctx, query: query, next: &first}
+	js := iop.NewJSONStream(ds, pager, flatten, conn.GetProp("jmespath"))
+
+	ds.SetIterator(ds.NewIterator(ds.Columns, js.NextFunc))
+	ds.SetMetadata(conn.GetProp("METADATA"))
+	ds.SetConfig(conn.Props())
+
+	err = ds.Start()
+	if err != nil {
+		queryContext.Cancel()
+		return ds, g.Error(err, "could start datastream")
+	}
+
+	return
+}
+
+// GetTableColumns returns the columns of the first records of the resource
+func (conn *SaaSConn) GetTableColumns(table *Table, fields ...string) (columns iop.Columns, err error) {
+	ds, err := conn.StreamRowsContext(conn.Context().Ctx, table.Name, g.M("limit", 10, "silent", true))
+	if err != nil {
+		return columns, g.Error(err, "could not get columns of %s", table.Name)
+	}
+
+	data, err := ds.Collect(10)
+	if err != nil {
+		return columns, g.Error(err, "could not collect to get columns")
+	}
+
+	for i := range data.Columns {
+		data.Columns[i].Table = table.Name
+		data.Columns[i].DbType = "-"
+	}
+
+	return data.Columns, nil
+}
+
+// GetSchemas returns the API as the schema
+func (conn *SaaSConn) GetSchemas() (data iop.Dataset, err error) {
+	data = iop.NewDataset(iop.NewColumnsFromFields("schema_name"))
+	data.Append([]interface{}{conn.GetType().String()})
+	return data, nil
+}
+
+// GetTables returns the common resources of the API
+func (conn *SaaSConn) GetTables(schema string) (data iop.Dataset, err error) {
+	data = iop.NewDataset(iop.NewColumnsFromFields("table_name"))
+	for _, name := range saasResources[conn.GetType()] {
+		data.Append([]interface{}{name})
+	}
+	return data, nil
+}
+
+// GetSchemata returns the common resources of the API, as tables
+func (conn *SaaSConn) GetSchemata(level SchemataLevel, schemaName string, tableNames ...string) (Schemata, error) {
+	currDatabase := conn.GetType().String()
+	schemata := Schemata{
+		Databases: map[string]Database{},
+		conn:      conn,
+	}
+
+	schema := Schema{Name: currDatabase, Database: currDatabase, Tables: map[string]Table{}}
+	if g.In(level, SchemataLevelTable, SchemataLevelColumn) {
+		for _, name := range saasResources[conn.GetType()] {
+			table := Table{Name: name, Schema: schema.Name, Database: currDatabase, Dialect: conn.GetType()}
+			if level == SchemataLevelColumn && g.In(name, tableNames...) {
+				columns, err := conn.GetTableColumns(&table)
+				if err != nil {
+					return schemata, g.Error(err, "could not get columns")
+				}
+				table.Columns = columns
+			}
+			schema.Tables[strings.ToLower(name)] = table
+		}
+	}
+
+	schemata.Databases[strings.ToLower(currDatabase)] = Database{
+		Name:    currDatabase,
+		Schemas: map[string]Schema{strings.ToLower(schema.Name): schema},
+	}
+
+	return schemata, nil
+}
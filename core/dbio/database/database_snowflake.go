@@ -5,6 +5,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path"
 	"runtime"
@@ -112,6 +113,12 @@ func (conn *SnowflakeConn) ConnString() string {
 		connString = connString + "&authenticator=SNOWFLAKE_JWT&privateKey=" + epk
 	}
 
+	// server-side timeout (session parameter)
+	if timeout := conn.serverTimeout(); timeout > 0 {
+		sep := lo.Ternary(strings.Contains(connString, "?"), "&", "?")
+		connString = g.F("%s%sSTATEMENT_TIMEOUT_IN_SECONDS=%d", connString, sep, int64(timeout.Seconds()))
+	}
+
 	connString = strings.TrimSuffix(connString, "?")
 
 	connString = strings.ReplaceAll(
@@ -140,6 +147,10 @@ func (conn *SnowflakeConn) Connect(timeOut ...int) error {
 	}
 	if len(data.Rows) > 0 {
 		conn.SetProp("warehouse", cast.ToString(data.Rows[0][0]))
+		if col := data.Columns.GetColumn("size"); col != nil {
+			// to estimate the credits used (see CreditsPerHour)
+			conn.SetProp("warehouse_size", cast.ToString(data.Rows[0][col.Position-1]))
+		}
 	}
 
 	if val := conn.GetProp("database"); val != "" {
@@ -154,6 +165,24 @@ func (conn *SnowflakeConn) Connect(timeOut ...int) error {
 	return err
 }
 
+// CreditsPerHour returns the credits per hour of the warehouse,
+// from its size (X-Small is 1 credit, doubling with each size)
+func (conn *SnowflakeConn) CreditsPerHour() float64 {
+	size := strings.ToLower(conn.GetProp("warehouse_size"))
+	size = strings.NewReplacer("-", "", " ", "", "_", "").Replace(size)
+	sizes := []string{"xsmall", "small", "medium", "large", "xlarge", "2xlarge", "3xlarge", "4xlarge", "5xlarge", "6xlarge"}
+	aliases := map[string]string{"xxlarge": "2xlarge", "xxxlarge": "3xlarge"}
+	if alias, ok := aliases[size]; ok {
+		size = alias
+	}
+	for i, s := range sizes {
+		if s == size {
+			return math.Pow(2, float64(i))
+		}
+	}
+	return 0
+}
+
 func getEncodedPrivateKey(pemStr, passphrase string) (epk string, err error) {
 	block, _ := pem.Decode([]byte(pemStr))
 	if block == nil {
@@ -220,7 +249,7 @@ func (conn *SnowflakeConn) GenerateDDL(table Table, data iop.Dataset, temporary
 		// allow custom SQL expression for clustering
 		clusterBy = g.F("cluster by (%s)", strings.Join(keys, ", "))
 	} else if keyCols := data.Columns.GetKeys(iop.ClusterKey); len(keyCols) > 0 {
-		colNames := conn.GetType().QuoteNames(keyCols.Names()...)
+		colNames := conn.QuoteNames(keyCols.Names()...)
 		clusterBy = g.F("cluster by (%s)", strings.Join(colNames, ", "))
 	}
 	sql = strings.ReplaceAll(sql, "{cluster_by}", clusterBy)
@@ -344,7 +373,7 @@ func (conn *SnowflakeConn) CopyToS3(tables ...Table) (s3Path string, err error)
 		return
 	}
 
-	s3Path = fmt.Sprintf("s3://%s/%s/stream/%s.csv", s3Bucket, tempCloudStorageFolder, cast.ToString(g.Now()))
+	s3Path = fmt.Sprintf("s3://%s/%s/stream/%s.csv", s3Bucket, conn.tempCloudFolder(), cast.ToString(g.Now()))
 
 	filesys.Delete(s3Fs, s3Path)
 	for i, table := range tables {
@@ -409,7 +438,7 @@ func (conn *SnowflakeConn) CopyToAzure(tables ...Table) (azPath string, err erro
 		"azure://%s.blob.core.windows.net/%s/%s-%s",
 		conn.GetProp("AZURE_ACCOUNT"),
 		conn.GetProp("AZURE_CONTAINER"),
-		tempCloudStorageFolder,
+		conn.tempCloudFolder(),
 		cast.ToString(g.Now()),
 	)
 
@@ -433,6 +462,65 @@ func (conn *SnowflakeConn) CopyToAzure(tables ...Table) (azPath string, err erro
 	return azPath, err
 }
 
+// StagingTypes returns the object stores supported for staging
+func (conn *SnowflakeConn) StagingTypes() []dbio.Type {
+	return []dbio.Type{dbio.TypeFileS3, dbio.TypeFileAzure}
+}
+
+// UnloadToStorage unloads the table into the files of the s3 or azure folder
+func (conn *SnowflakeConn) UnloadToStorage(table Table, folderURL string) (err error) {
+	filePrefix := strings.TrimSuffix(folderURL, "/") + "/" + StagingFilePrefix
+
+	var unloadSQL string
+	switch StagingType(folderURL) {
+	case dbio.TypeFileS3:
+		AwsID := conn.GetProp("AWS_ACCESS_KEY_ID", "ACCESS_KEY_ID")
+		AwsAccessKey := conn.GetProp("AWS_SECRET_ACCESS_KEY", "SECRET_ACCESS_KEY")
+		if AwsID == "" || AwsAccessKey == "" {
+			return g.Error("Need to set 'AWS_ACCESS_KEY_ID' and 'AWS_SECRET_ACCESS_KEY' to unload to S3 from snowflake")
+		}
+		unloadSQL = g.R(
+			conn.template.Core["copy_to_s3"],
+			"sql", table.Select(),
+			"s3_path", filePrefix,
+			"aws_access_key_id", AwsID,
+			"aws_secret_access_key", AwsAccessKey,
+		)
+	case dbio.TypeFileAzure:
+		azToken, err := getAzureToken(conn)
+		if err != nil {
+			return g.Error(err)
+		}
+		conn.SetProp("azure_sas_token", azToken)
+		unloadSQL = g.R(
+			conn.template.Core["copy_to_azure"],
+			"sql", table.Select(),
+			"azure_path", azureStagingPath(strings.TrimSuffix(folderURL, "/")),
+			"azure_sas_token", azToken,
+		)
+	default:
+		return g.Error("snowflake cannot unload to %s", folderURL)
+	}
+
+	g.Info("unloading from snowflake to %s", folderURL)
+	if _, err = conn.Exec(unloadSQL); err != nil {
+		return g.Error(err, "could not unload to %s", folderURL)
+	}
+	return nil
+}
+
+// LoadFromStorage loads the files of the s3 or azure folder into the table
+func (conn *SnowflakeConn) LoadFromStorage(tableFName, folderURL string, columns iop.Columns) (err error) {
+	folderURL = strings.TrimSuffix(folderURL, "/") + "/"
+	switch StagingType(folderURL) {
+	case dbio.TypeFileS3:
+		return conn.CopyFromS3(tableFName, folderURL)
+	case dbio.TypeFileAzure:
+		return conn.CopyFromAzure(tableFName, azureStagingPath(folderURL))
+	}
+	return g.Error("snowflake cannot load from %s", folderURL)
+}
+
 // BulkImportFlow bulk import flow
 func (conn *SnowflakeConn) BulkImportFlow(tableFName string, df *iop.Dataflow) (count uint64, err error) {
 	defer df.CleanUp()
@@ -459,6 +547,10 @@ func (conn *SnowflakeConn) BulkImportFlow(tableFName string, df *iop.Dataflow) (
 		}
 	}
 
+	if strings.EqualFold(conn.GetProp("load_method"), "streaming") {
+		return conn.StreamingImportFlow(tableFName, df)
+	}
+
 	settingMppBulkImportFlow(conn, iop.ZStandardCompressorType)
 
 	if conn.GetProp("use_bulk") != "false" {
@@ -470,7 +562,7 @@ func (conn *SnowflakeConn) BulkImportFlow(tableFName string, df *iop.Dataflow) (
 		default:
 		}
 
-		table, err := ParseTableName(tableFName, conn.Type)
+		table, err := ParseConnTableName(tableFName, conn)
 		if err != nil {
 			return 0, g.Error(err, "could not parse table name: "+tableFName)
 		}
@@ -519,7 +611,7 @@ func (conn *SnowflakeConn) CopyViaAWS(tableFName string, df *iop.Dataflow) (coun
 	s3Path := fmt.Sprintf(
 		"s3://%s/%s/%s",
 		conn.GetProp("AWS_BUCKET"),
-		tempCloudStorageFolder,
+		conn.tempCloudFolder(),
 		tableFName,
 	)
 
@@ -593,7 +685,7 @@ func (conn *SnowflakeConn) CopyViaAzure(tableFName string, df *iop.Dataflow) (co
 		"azure://%s.blob.core.windows.net/%s/%s-%s",
 		conn.GetProp("AZURE_ACCOUNT"),
 		conn.GetProp("AZURE_CONTAINER"),
-		tempCloudStorageFolder,
+		conn.tempCloudFolder(),
 		tableFName,
 	)
 
@@ -657,7 +749,7 @@ func (conn *SnowflakeConn) UnloadViaStage(tables ...Table) (filePath string, unl
 	stageFolderPath := fmt.Sprintf(
 		"@%s/%s/%s",
 		conn.GetProp("internal_stage"),
-		tempCloudStorageFolder,
+		conn.tempCloudFolder(),
 		cast.ToString(g.Now()),
 	)
 
@@ -738,14 +830,14 @@ func (conn *SnowflakeConn) UnloadViaStage(tables ...Table) (filePath string, unl
 // https://docs.snowflake.com/en/sql-reference/sql/copy-into-table.html
 func (conn *SnowflakeConn) CopyViaStage(tableFName string, df *iop.Dataflow) (count uint64, err error) {
 
-	context := g.NewContext(conn.Context().Ctx)
+	context := bulkLoadContext(conn)
 
 	if conn.GetProp("internal_stage") == "" {
 		return 0, g.Error("Prop internal_stage is required")
 	}
 
 	if conn.GetProp("schema") == "" {
-		table, err := ParseTableName(tableFName, conn.Type)
+		table, err := ParseConnTableName(tableFName, conn)
 		if err != nil {
 			return 0, g.Error(err, "could not parse table name: "+tableFName)
 		}
@@ -761,7 +853,7 @@ func (conn *SnowflakeConn) CopyViaStage(tableFName string, df *iop.Dataflow) (co
 	// delete folder when done
 	df.Defer(func() { env.RemoveAllLocalTempFile(folderPath) })
 
-	fileReadyChn := make(chan filesys.FileReady, 10000)
+	fileReadyChn := fileReadyChannel(conn, 10000)
 	go func() {
 		fs, err := filesys.NewFileSysClient(dbio.TypeFileLocal, conn.PropArrExclude("url")...)
 		if err != nil {
@@ -996,7 +1088,7 @@ func (conn *SnowflakeConn) GenerateUpsertSQL(srcTable string, tgtTable string, p
 // include schema and table, example: `schema1.table2`
 // fields should be `schema_name|table_name|table_type|column_name|data_type|column_id`
 func (conn *SnowflakeConn) GetColumnsFull(tableFName string) (data iop.Dataset, err error) {
-	table, err := ParseTableName(tableFName, conn.Type)
+	table, err := ParseConnTableName(tableFName, conn)
 	if err != nil {
 		return data, g.Error(err, "could not parse table name: "+tableFName)
 	}
@@ -0,0 +1,369 @@
+package database
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+	"github.com/youmark/pkcs8"
+)
+
+// SnowpipeStreamingClient loads rows via the Snowpipe Streaming REST API
+// https://docs.snowflake.com/en/user-guide/snowpipe-streaming/snowpipe-streaming-high-performance-rest-api
+type SnowpipeStreamingClient struct {
+	conn       *SnowflakeConn
+	account    string // upper case account identifier
+	user       string
+	accountURL string
+	ingestHost string
+	token      string
+	privateKey *rsa.PrivateKey
+	client     *http.Client
+}
+
+// snowpipeChannel is an open Snowpipe Streaming channel
+type snowpipeChannel struct {
+	path              string // databases/{db}/schemas/{schema}/pipes/{pipe}
+	name              string
+	continuationToken string
+	offsetToken       int64
+}
+
+// NewSnowpipeStreamingClient creates a client with key-pair authentication
+func NewSnowpipeStreamingClient(conn *SnowflakeConn) (sc *SnowpipeStreamingClient, err error) {
+	pk := conn.GetProp("private_key")
+	if pk == "" {
+		return nil, g.Error("Snowpipe Streaming requires key-pair authentication, please provide `private_key` or `private_key_path`")
+	}
+
+	block, _ := pem.Decode([]byte(pk))
+	if block == nil {
+		return nil, g.Error("invalid private key data: no PEM block found")
+	}
+	key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(conn.GetProp("private_key_passphrase")))
+	if err != nil {
+		return nil, g.Error(err, "could not parse private key")
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, g.Error("private key must be an RSA key for Snowpipe Streaming")
+	}
+
+	u, _ := url.Parse(conn.URL)
+	account := conn.GetProp("account")
+	if account == "" && u != nil {
+		account = strings.TrimSuffix(u.Hostname(), ".snowflakecomputing.com")
+	}
+	user := conn.GetProp("user", "username")
+	if user == "" && u != nil {
+		user = u.User.Username()
+	}
+	if account == "" || user == "" {
+		return nil, g.Error("Snowpipe Streaming requires the `account` and `user` properties")
+	}
+
+	accountURL := "https://" + account + ".snowflakecomputing.com"
+	if host := conn.GetProp("host"); host != "" {
+		accountURL = "https://" + host
+	}
+
+	sc = &SnowpipeStreamingClient{
+		conn:       conn,
+		account:    strings.ToUpper(strings.Split(account, ".")[0]),
+		user:       strings.ToUpper(user),
+		accountURL: accountURL,
+		privateKey: rsaKey,
+		client:     &http.Client{Timeout: 5 * time.Minute},
+	}
+
+	return sc, nil
+}
+
+// jwt generates a key-pair JWT token
+// https://docs.snowflake.com/en/developer-guide/sql-api/authenticating#using-key-pair-authentication
+func (sc *SnowpipeStreamingClient) jwt() (token string, err error) {
+	pubDER, err := x509.MarshalPKIXPublicKey(&sc.privateKey.PublicKey)
+	if err != nil {
+		return "", g.Error(err, "could not marshal public key")
+	}
+	fingerprint := sha256.Sum256(pubDER)
+	qualifiedUser := sc.account + "." + sc.user
+
+	now := time.Now()
+	header := g.Marshal(g.M("alg", "RS256", "typ", "JWT"))
+	claims := g.Marshal(g.M(
+		"iss", qualifiedUser+".SHA256:"+base64.StdEncoding.EncodeToString(fingerprint[:]),
+		"sub", qualifiedUser,
+		"iat", now.Unix(),
+		"exp", now.Add(time.Hour).Unix(),
+	))
+
+	enc := base64.RawURLEncoding
+	payload := enc.EncodeToString([]byte(header)) + "." + enc.EncodeToString([]byte(claims))
+	hashed := sha256.Sum256([]byte(payload))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, sc.privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", g.Error(err, "could not sign JWT")
+	}
+
+	return payload + "." + enc.EncodeToString(signature), nil
+}
+
+// request submits an http request, returning the decoded JSON response
+func (sc *SnowpipeStreamingClient) request(method, URL string, body io.Reader, headers map[string]string) (resp map[string]any, err error) {
+	req, err := http.NewRequestWithContext(sc.conn.Context().Ctx, method, URL, body)
+	if err != nil {
+		return nil, g.Error(err, "could not create request")
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := sc.client.Do(req)
+	if err != nil {
+		return nil, g.Error(err, "could not submit request: %s %s", method, URL)
+	}
+	defer res.Body.Close()
+
+	respBytes, _ := io.ReadAll(res.Body)
+	if res.StatusCode >= 300 {
+		return nil, g.Error("Snowpipe Streaming request failed (%s %s) => %d: %s", method, URL, res.StatusCode, string(respBytes))
+	}
+
+	resp = g.M()
+	if len(respBytes) > 0 {
+		if err = json.Unmarshal(respBytes, &resp); err != nil {
+			// some responses are plain text (e.g. hostname, scoped token)
+			resp["text"] = strings.TrimSpace(string(respBytes))
+		}
+	}
+	return resp, nil
+}
+
+// authenticate determines the ingest host and obtains a scoped token
+func (sc *SnowpipeStreamingClient) authenticate() (err error) {
+	jwt, err := sc.jwt()
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{
+		"Authorization":                        "Bearer " + jwt,
+		"X-Snowflake-Authorization-Token-Type": "KEYPAIR_JWT",
+	}
+	resp, err := sc.request("GET", sc.accountURL+"/v2/streaming/hostname", nil, headers)
+	if err != nil {
+		return g.Error(err, "could not get ingest host")
+	}
+	sc.ingestHost = cast.ToString(resp["text"])
+	if sc.ingestHost == "" {
+		sc.ingestHost = cast.ToString(resp["hostname"])
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("scope", sc.ingestHost)
+	headers = map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	headers["Authorization"] = "Bearer " + jwt
+	resp, err = sc.request("POST", sc.accountURL+"/oauth/token", strings.NewReader(form.Encode()), headers)
+	if err != nil {
+		return g.Error(err, "could not get scoped token")
+	}
+	sc.token = cast.ToString(resp["text"])
+
+	return nil
+}
+
+func (sc *SnowpipeStreamingClient) headers() map[string]string {
+	return map[string]string{
+		"Authorization":                        "Bearer " + sc.token,
+		"X-Snowflake-Authorization-Token-Type": "OAUTH",
+	}
+}
+
+// openChannel opens a channel on the table's pipe (the default pipe is `{table}-STREAMING`)
+func (sc *SnowpipeStreamingClient) openChannel(table Table) (channel *snowpipeChannel, err error) {
+	pipe := sc.conn.GetProp("streaming_pipe")
+	if pipe == "" {
+		pipe = table.Name + "-STREAMING"
+	}
+
+	database := table.Database
+	if database == "" {
+		database = sc.conn.GetProp("database")
+	}
+
+	channel = &snowpipeChannel{
+		path: g.F("databases/%s/schemas/%s/pipes/%s", database, table.Schema, pipe),
+		name: "sling_" + strings.ToLower(g.RandSuffix("", 6)),
+	}
+
+	URL := g.F("https://%s/v2/streaming/%s/channels/%s", sc.ingestHost, channel.path, channel.name)
+	resp, err := sc.request("PUT", URL, strings.NewReader("{}"), sc.headers())
+	if err != nil {
+		return nil, g.Error(err, "could not open channel")
+	}
+	channel.continuationToken = cast.ToString(resp["next_continuation_token"])
+
+	return channel, nil
+}
+
+// appendRows appends rows (as NDJSON) into the channel
+func (sc *SnowpipeStreamingClient) appendRows(channel *snowpipeChannel, rows []byte) (err error) {
+	channel.offsetToken++
+	URL := g.F(
+		"https://%s/v2/streaming/data/%s/channels/%s/rows?continuationToken=%s&offsetToken=%d",
+		sc.ingestHost, channel.path, channel.name, url.QueryEscape(channel.continuationToken), channel.offsetToken,
+	)
+
+	headers := sc.headers()
+	headers["Content-Type"] = "application/x-ndjson"
+	resp, err := sc.request("POST", URL, bytes.NewReader(rows), headers)
+	if err != nil {
+		return g.Error(err, "could not append rows")
+	}
+	channel.continuationToken = cast.ToString(resp["next_continuation_token"])
+
+	return nil
+}
+
+// waitCommitted waits until the last offset token is committed
+func (sc *SnowpipeStreamingClient) waitCommitted(channel *snowpipeChannel, timeout time.Duration) (err error) {
+	URL := g.F("https://%s/v2/streaming/%s:bulk-channel-status", sc.ingestHost, channel.path)
+	body := g.Marshal(g.M("channel_names", []string{channel.name}))
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		resp, err := sc.request("POST", URL, strings.NewReader(body), sc.headers())
+		if err != nil {
+			return g.Error(err, "could not get channel status")
+		}
+
+		statuses, _ := resp["channel_statuses"].(map[string]any)
+		status, _ := statuses[channel.name].(map[string]any)
+		if committed := cast.ToInt64(status["committed_offset_token"]); committed >= channel.offsetToken {
+			return nil
+		} else if errCnt := cast.ToInt64(status["rows_error_count"]); errCnt > 0 {
+			return g.Error("Snowpipe Streaming channel %s has %d row errors: %s", channel.name, errCnt, cast.ToString(status["last_error_message"]))
+		}
+
+		time.Sleep(time.Second)
+	}
+
+	return g.Error("timeout waiting for Snowpipe Streaming channel %s to commit", channel.name)
+}
+
+// dropChannel drops the channel
+func (sc *SnowpipeStreamingClient) dropChannel(channel *snowpipeChannel) (err error) {
+	URL := g.F("https://%s/v2/streaming/%s/channels/%s", sc.ingestHost, channel.path, channel.name)
+	_, err = sc.request("DELETE", URL, nil, sc.headers())
+	return err
+}
+
+// StreamingImportFlow loads a dataflow into a table via Snowpipe Streaming
+func (conn *SnowflakeConn) StreamingImportFlow(tableFName string, df *iop.Dataflow) (count uint64, err error) {
+	table, err := ParseConnTableName(tableFName, conn)
+	if err != nil {
+		return 0, g.Error(err, "could not parse table name: %s", tableFName)
+	} else if table.Schema == "" {
+		table.Schema = conn.GetProp("schema")
+	}
+
+	sc, err := NewSnowpipeStreamingClient(conn)
+	if err != nil {
+		return 0, g.Error(err, "could not create Snowpipe Streaming client")
+	} else if err = sc.authenticate(); err != nil {
+		return 0, g.Error(err, "could not authenticate for Snowpipe Streaming")
+	}
+
+	channel, err := sc.openChannel(table)
+	if err != nil {
+		return 0, g.Error(err)
+	}
+	defer sc.dropChannel(channel)
+
+	// rows are appended in batches, each request should stay under 16MB
+	maxRows := lo.Ternary(cast.ToInt(conn.GetProp("batch_size")) > 0, cast.ToInt(conn.GetProp("batch_size")), 10000)
+	maxBytes := 4 * 1024 * 1024
+	buf := bytes.Buffer{}
+	rowCnt := 0
+
+	flush := func() error {
+		if rowCnt == 0 {
+			return nil
+		}
+		if err := sc.appendRows(channel, buf.Bytes()); err != nil {
+			return err
+		}
+		buf.Reset()
+		rowCnt = 0
+		return nil
+	}
+
+	for ds := range df.StreamCh {
+		for batch := range ds.BatchChan {
+			names := batch.Columns.Names()
+			for row := range batch.Rows {
+				rec := make(map[string]any, len(names))
+				for i, val := range row {
+					if i >= len(names) {
+						break
+					}
+					if t, ok := val.(time.Time); ok {
+						val = t.Format(time.RFC3339Nano)
+					}
+					rec[names[i]] = val
+				}
+
+				recBytes, err := json.Marshal(rec)
+				if err != nil {
+					return count, g.Error(err, "could not encode row")
+				}
+				buf.Write(recBytes)
+				buf.WriteByte('\n')
+				rowCnt++
+				count++
+
+				if rowCnt >= maxRows || buf.Len() >= maxBytes {
+					if err = flush(); err != nil {
+						df.Context.CaptureErr(err)
+						return count, g.Error(err)
+					}
+				}
+			}
+		}
+	}
+
+	if err = flush(); err != nil {
+		return count, g.Error(err)
+	} else if err = df.Err(); err != nil {
+		return count, g.Error(err)
+	}
+
+	timeoutSec := lo.Ternary(cast.ToInt(conn.GetProp("streaming_commit_timeout")) > 0, cast.ToInt(conn.GetProp("streaming_commit_timeout")), 300)
+	timeout := time.Duration(timeoutSec) * time.Second
+	if err = sc.waitCommitted(channel, timeout); err != nil {
+		return count, g.Error(err)
+	}
+
+	g.Debug("loaded %d rows via Snowpipe Streaming into %s", count, tableFName)
+	return count, nil
+}
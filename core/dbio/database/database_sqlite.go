@@ -112,7 +112,7 @@ func (conn *SQLiteConn) BulkImportStream(tableFName string, ds *iop.Datastream)
 	conn.Close()
 	defer conn.Connect()
 
-	table, err := ParseTableName(tableFName, conn.GetType())
+	table, err := ParseConnTableName(tableFName, conn)
 	if err != nil {
 		err = g.Error(err, "could not get table name for import")
 		return
@@ -199,6 +199,17 @@ func (conn *MsSQLServerConn) ConnString() string {
 		azuread.ActiveDirectoryDeviceCode,
 		azuread.ActiveDirectoryApplication,
 	}
+	// workload identity: AKS workload identity (via the default credential
+	// chain) or managed identity, with the client id as `user id`
+	if useWorkloadIdentity, _ := filesys.UseWorkloadIdentity(conn.GetProp("auth")); useWorkloadIdentity && conn.GetProp("fedauth") == "" {
+		if os.Getenv("AZURE_FEDERATED_TOKEN_FILE") != "" {
+			conn.SetProp("fedauth", azuread.ActiveDirectoryDefault)
+		} else {
+			conn.SetProp("fedauth", azuread.ActiveDirectoryManagedIdentity)
+		}
+		U.SetParam("fedauth", conn.GetProp("fedauth"))
+	}
+
 	if fedAuth := conn.GetProp("fedauth"); g.In(fedAuth, AdAuthStrings...) {
 		conn.SetProp("driver", "azuresql")
 	}
@@ -716,7 +727,7 @@ func (conn *MsSQLServerConn) CopyViaAzure(tableFName string, df *iop.Dataflow) (
 		"https://%s.blob.core.windows.net/%s/%s-%s",
 		conn.GetProp("AZURE_ACCOUNT"),
 		conn.GetProp("AZURE_CONTAINER"),
-		tempCloudStorageFolder,
+		conn.tempCloudFolder(),
 		sanitizedTableFName,
 	)
 
@@ -733,7 +744,7 @@ func (conn *MsSQLServerConn) CopyViaAzure(tableFName string, df *iop.Dataflow) (
 
 	// defer func() { azFs.Delete(azPath + "*") }() // cleanup
 
-	fileReadyChn := make(chan filesys.FileReady, 10000)
+	fileReadyChn := fileReadyChannel(conn, 10000)
 	go func() {
 		var bw int64
 		bw, err = azFs.WriteDataflowReady(df, azPath, fileReadyChn, iop.DefaultStreamConfig())
@@ -319,20 +319,20 @@ func (conn *StarRocksConn) GenerateDDL(table Table, data iop.Dataset, temporary
 
 	if len(primaryKeyCols) > 0 {
 		tableDistro = "primary"
-		distroColNames = conn.GetType().QuoteNames(primaryKeyCols.Names()...)
+		distroColNames = conn.QuoteNames(primaryKeyCols.Names()...)
 	} else if len(dupKeyCols) > 0 {
 		tableDistro = "duplicate"
-		distroColNames = conn.GetType().QuoteNames(dupKeyCols.Names()...)
+		distroColNames = conn.QuoteNames(dupKeyCols.Names()...)
 	} else if len(aggKeyCols) > 0 {
 		tableDistro = "aggregate"
-		distroColNames = conn.GetType().QuoteNames(aggKeyCols.Names()...)
+		distroColNames = conn.QuoteNames(aggKeyCols.Names()...)
 	} else if len(uniqueKeyCols) > 0 {
 		tableDistro = "unique"
-		distroColNames = conn.GetType().QuoteNames(uniqueKeyCols.Names()...)
+		distroColNames = conn.QuoteNames(uniqueKeyCols.Names()...)
 	}
 
 	// set hash key
-	hashColNames := conn.GetType().QuoteNames(hashKeyCols.Names()...)
+	hashColNames := conn.QuoteNames(hashKeyCols.Names()...)
 	ddl = strings.ReplaceAll(ddl, "{hash_key}", strings.Join(hashColNames, ", "))
 
 	// set table distribution type & keys
@@ -402,7 +402,7 @@ func (conn *StarRocksConn) StreamLoad(feURL, tableFName string, df *iop.Dataflow
 		return count, g.Error(err, "invalid url for FE")
 	}
 
-	table, err := ParseTableName(tableFName, conn.Type)
+	table, err := ParseConnTableName(tableFName, conn)
 	if err != nil {
 		return count, g.Error(err, "could not parse table: %s", tableFName)
 	}
@@ -441,7 +441,7 @@ func (conn *StarRocksConn) StreamLoad(feURL, tableFName string, df *iop.Dataflow
 	// 	}
 	// }
 
-	fileReadyChn := make(chan filesys.FileReady, 10)
+	fileReadyChn := fileReadyChannel(conn, 10)
 	go func() {
 		fs.SetProp("null_as", `\N`)
 		_, err = fs.WriteDataflowReady(df, localPath, fileReadyChn, iop.DefaultStreamConfig())
@@ -491,7 +491,7 @@ func (conn *StarRocksConn) StreamLoad(feURL, tableFName string, df *iop.Dataflow
 		}
 	}
 
-	loadCtx := g.NewContext(conn.context.Ctx, 3)
+	loadCtx := bulkLoadContext(conn, 3)
 
 	loadFromLocal := func(localFile filesys.FileReady, tableFName string) {
 		defer loadCtx.Wg.Write.Done()
@@ -0,0 +1,916 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/flarco/g/net"
+	"github.com/samber/lo"
+	"github.com/shopspring/decimal"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/spf13/cast"
+)
+
+// TeradataConn is a Teradata connection. Statements are submitted with the
+// Teradata Query Service REST API, and bulk loads / exports run with the
+// `tdload` utility (FastLoad / FastExport protocols) when it is installed
+type TeradataConn struct {
+	BaseConn
+	URL    string
+	Host   string
+	Port   int
+	System string
+	client http.Client
+}
+
+// Init initiates the object
+func (conn *TeradataConn) Init() error {
+
+	conn.BaseConn.URL = conn.URL
+	conn.BaseConn.Type = dbio.TypeDbTeradata
+
+	conn.Host = conn.GetProp("host")
+	conn.Port = cast.ToInt(conn.GetProp("port"))
+	conn.System = conn.GetProp("system")
+
+	// teradata://{username}:{password}@{host}:{port}/{database}?system={system}
+	if u, err := net.NewURL(conn.URL); err == nil {
+		conn.Host = lo.Ternary(conn.Host != "", conn.Host, u.Hostname())
+		conn.Port = lo.Ternary(conn.Port != 0, conn.Port, u.Port(dbio.TypeDbTeradata.DefPort()))
+		conn.System = lo.Ternary(conn.System != "", conn.System, u.GetParam("system"))
+		for key, val := range map[string]string{
+			"username": u.Username(),
+			"password": u.Password(),
+			"database": strings.Trim(u.Path(), "/"),
+		} {
+			if conn.GetProp(key) == "" && val != "" {
+				conn.SetProp(key, val)
+			}
+		}
+	}
+
+	conn.client = http.Client{Timeout: 30 * time.Minute}
+	if cast.ToBool(conn.GetProp("skip_verify")) {
+		// the query service is often set up with a self-signed certificate
+		conn.client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+
+	instance := Connection(conn)
+	conn.BaseConn.instance = &instance
+
+	return conn.BaseConn.Init()
+}
+
+// baseURL returns the url of the system in the query service. A scheme is
+// only provided for testing against a local server
+func (conn *TeradataConn) baseURL() string {
+	host := strings.TrimSuffix(conn.Host, "/")
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = g.F("https://%s:%d", host, conn.Port)
+	}
+	return g.F("%s/systems/%s", host, url.PathEscape(conn.System))
+}
+
+// tdpid returns the database host used by tdload, which can differ
+// from the query service host
+func (conn *TeradataConn) tdpid() string {
+	if val := conn.GetProp("tdpid"); val != "" {
+		return val
+	}
+	if u, err := url.Parse(conn.Host); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return conn.Host
+}
+
+func (conn *TeradataConn) tdloadPath() string {
+	if val := conn.GetProp("tdload_path"); val != "" {
+		return val
+	}
+	return "tdload"
+}
+
+func (conn *TeradataConn) makeRequest(ctx context.Context, method, route string, body []byte) (resp *http.Response, err error) {
+	tries := 0
+	URL := conn.baseURL() + route
+
+retry:
+	tries++
+	g.Trace("request #%d for %s @ %s", tries, method, URL)
+
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, URL, bodyReader)
+	if err != nil {
+		return nil, g.Error(err, "could not make request for %s @ %s", method, route)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(conn.GetProp("username"), conn.GetProp("password"))
+
+	resp, err = conn.client.Do(req)
+	if err != nil {
+		err = g.Error(err, "could not perform request")
+		return
+	}
+
+	// retry logic
+	if (resp.StatusCode >= 502 || resp.StatusCode == 429) && tries <= 4 {
+		resp.Body.Close()
+		delay := tries * 5
+		g.Debug("teradata request failed %d: %s. Retrying in %d seconds.", resp.StatusCode, resp.Status, delay)
+		time.Sleep(time.Duration(delay * int(time.Second)))
+		goto retry
+	}
+
+	if resp.StatusCode >= 400 || resp.StatusCode < 200 {
+		respBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		err = g.Error("Unexpected Response %d: %s (%s %s) => %s", resp.StatusCode, resp.Status, method, route, string(respBytes))
+		return
+	}
+
+	return
+}
+
+// Connect connects to the database
+func (conn *TeradataConn) Connect(timeOut ...int) (err error) {
+	if conn.Host == "" {
+		return g.Error("did not provide host for Teradata")
+	} else if conn.System == "" {
+		return g.Error("did not provide the query service system for Teradata")
+	}
+
+	// test the system
+	_, err = conn.submitQuery(conn.context.Ctx, "select 1")
+	if err != nil {
+		return g.Error(err, "could not connect to Teradata system %s", conn.System)
+	}
+
+	if !cast.ToBool(conn.GetProp("silent")) {
+		g.Debug(`opened "%s" connection (%s)`, conn.Type, conn.GetProp("sling_conn_id"))
+	}
+
+	conn.SetProp("connected", "true")
+
+	return nil
+}
+
+type teradataColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type teradataResult struct {
+	ResultSet bool             `json:"resultSet"`
+	RowCount  int64            `json:"rowCount"`
+	Columns   []teradataColumn `json:"columns"`
+	Data      [][]any          `json:"data"`
+}
+
+type teradataResponse struct {
+	Results []teradataResult `json:"results"`
+}
+
+func (r *teradataResponse) LastInsertId() (int64, error) {
+	return -1, nil
+}
+
+// RowsAffected returns the row count of the DML statements
+func (r *teradataResponse) RowsAffected() (int64, error) {
+	count := int64(0)
+	for _, result := range r.Results {
+		if !result.ResultSet {
+			count += result.RowCount
+		}
+	}
+	return count, nil
+}
+
+// queryPayload returns the request body of a query. With batch, the
+// statement is executed once per row of params (e.g. for inserts)
+func (conn *TeradataConn) queryPayload(query string, params [][]any) []byte {
+	payload := g.M(
+		"query", query,
+		"format", "array",
+		"includeColumns", true,
+		"rowLimit", 0, // no limit, the default is 1000
+	)
+	if len(params) > 0 {
+		values := make([][]any, len(params))
+		for r, row := range params {
+			values[r] = make([]any, len(row))
+			for i, val := range row {
+				values[r][i] = teradataParamValue(val)
+			}
+		}
+		payload["params"] = values
+		payload["batch"] = len(params) > 1
+	}
+	return []byte(g.Marshal(payload))
+}
+
+// submitQuery runs the query and decodes the full response
+func (conn *TeradataConn) submitQuery(ctx context.Context, query string, params ...[]any) (response *teradataResponse, err error) {
+	resp, err := conn.makeRequest(ctx, "POST", "/queries", conn.queryPayload(query, params))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	response = &teradataResponse{}
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err = decoder.Decode(response); err != nil {
+		return nil, g.Error(err, "could not decode response")
+	}
+	return response, nil
+}
+
+// teradataParamValue returns the json value of a parameter. Timestamps
+// are provided as strings, which teradata casts to the column type
+func teradataParamValue(val any) any {
+	switch v := val.(type) {
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.000000-07:00")
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return v.Format("2006-01-02 15:04:05.000000-07:00")
+	case decimal.Decimal:
+		return v.String()
+	case []byte:
+		return string(v)
+	case bool:
+		return cast.ToString(v)
+	}
+	return val
+}
+
+// ExecContext runs a sql query with context, returns `error`
+func (conn *TeradataConn) ExecContext(ctx context.Context, q string, args ...interface{}) (result sql.Result, err error) {
+	err = reconnectIfClosed(conn)
+	if err != nil {
+		err = g.Error(err, "Could not reconnect")
+		return
+	}
+
+	if strings.TrimSpace(q) == "" {
+		g.Warn("Empty Query")
+		return
+	}
+
+	conn.LogSQL(q, args...)
+
+	var params [][]any
+	if len(args) > 0 {
+		params = [][]any{args}
+	}
+
+	response, err := conn.submitQuery(ctx, q, params...)
+	if err != nil {
+		if strings.Contains(q, noDebugKey) {
+			err = g.Error(err, "Error executing query")
+		} else {
+			err = g.Error(err, "Error executing %s", env.Clean(conn.Props(), q))
+		}
+		return
+	}
+
+	return response, nil
+}
+
+// StreamRowsContext streams the rows of a sql query with context. The response
+// is decoded as it is received, so large results are not held in memory
+func (conn *TeradataConn) StreamRowsContext(ctx context.Context, query string, options ...map[string]interface{}) (ds *iop.Datastream, err error) {
+	err = reconnectIfClosed(conn)
+	if err != nil {
+		err = g.Error(err, "Could not reconnect")
+		return
+	}
+
+	opts := getQueryOptions(options)
+	Limit := uint64(0) // infinite
+	if val := cast.ToUint64(opts["limit"]); val > 0 {
+		Limit = val
+	}
+
+	fetchedColumns := iop.Columns{}
+	if val, ok := opts["columns"].(iop.Columns); ok {
+		fetchedColumns = val
+	}
+
+	start := time.Now()
+	if strings.TrimSpace(query) == "" {
+		return ds, g.Error("Empty Query")
+	}
+
+	queryContext := g.NewContext(ctx)
+
+	conn.LogSQL(query)
+
+	resp, err := conn.makeRequest(queryContext.Ctx, "POST", "/queries", conn.queryPayload(query, nil))
+	if err != nil {
+		queryContext.Cancel()
+		if strings.Contains(query, noDebugKey) && !g.IsDebugLow() {
+			return ds, g.Error(err, "SQL Error")
+		}
+		return ds, g.Error(err, "SQL Error for:\n"+query)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+
+	// the columns precede the data in the response, e.g.
+	// {"queryDuration":12,"results":[{"resultSet":true,"columns":[{"name":"id","type":"INTEGER"}],"data":[[1],[2]],"rowCount":2}]}
+	tdColumns, err := teradataSeekData(decoder)
+	if err != nil {
+		resp.Body.Close()
+		queryContext.Cancel()
+		return ds, g.Error(err, "could not decode response for:\n"+query)
+	}
+
+	colTypes := lo.Map(tdColumns, func(col teradataColumn, i int) ColumnType {
+		return ColumnType{
+			Name:             col.Name,
+			DatabaseTypeName: col.Type,
+			FetchedColumn:    fetchedColumns.GetColumn(col.Name),
+			Nullable:         true,
+			Sourced:          !strings.EqualFold(col.Type, "DECIMAL"),
+		}
+	})
+
+	conn.Data.SQL = query
+	conn.Data.Duration = time.Since(start).Seconds()
+	conn.Data.Rows = [][]interface{}{}
+	conn.Data.Columns = SQLColumns(colTypes, conn)
+	conn.Data.NoDebug = !strings.Contains(query, noDebugKey)
+
+	nextFunc := func(it *iop.Iterator) bool {
+		if Limit > 0 && it.Counter >= Limit {
+			resp.Body.Close()
+			return false
+		}
+
+		if tdColumns == nil || !decoder.More() {
+			resp.Body.Close()
+			return false
+		}
+
+		var row []any
+		if err := decoder.Decode(&row); err != nil {
+			it.Context.CaptureErr(g.Error(err, "error decoding row"))
+			resp.Body.Close()
+			return false
+		}
+
+		for i, val := range row {
+			if num, ok := val.(json.Number); ok {
+				row[i] = num.String() // keep the precision of large numbers
+			}
+		}
+
+		it.Row = row
+		return true
+	}
+
+	ds = iop.NewDatastreamIt(queryContext.Ctx, conn.Data.Columns, nextFunc)
+	ds.NoDebug = strings.Contains(query, noDebugKey)
+	ds.Inferred = !InferDBStream && ds.Columns.Sourced()
+	if !ds.NoDebug {
+		// don't set metadata for internal queries
+		ds.SetMetadata(conn.GetProp("METADATA"))
+		conn.setTransforms(ds.Columns)
+		ds.SetConfig(conn.Props())
+	}
+
+	err = ds.Start()
+	if err != nil {
+		queryContext.Cancel()
+		return ds, g.Error(err, "could start datastream")
+	}
+
+	return
+}
+
+// teradataSeekData reads the response until the data array of the first
+// result, and returns its columns. The columns are nil if the first result
+// has no result set
+func teradataSeekData(decoder *json.Decoder) (columns []teradataColumn, err error) {
+	expectDelim := func(delim json.Delim) error {
+		if t, err := decoder.Token(); err != nil {
+			return err
+		} else if t != delim {
+			return g.Error("invalid JSON structure: expected %s, got %v", delim, t)
+		}
+		return nil
+	}
+
+	if err = expectDelim('{'); err != nil {
+		return nil, err
+	}
+
+	// find the results array
+	for {
+		t, err := decoder.Token()
+		if err != nil {
+			return nil, g.Error(err, "did not find results")
+		}
+		if t == "results" {
+			break
+		}
+		var skip json.RawMessage
+		if err = decoder.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = expectDelim('['); err != nil {
+		return nil, err
+	} else if !decoder.More() {
+		return nil, nil // no results
+	} else if err = expectDelim('{'); err != nil {
+		return nil, err
+	}
+
+	for decoder.More() {
+		t, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t {
+		case "columns":
+			if err = decoder.Decode(&columns); err != nil {
+				return nil, g.Error(err, "error decoding columns")
+			}
+			if columns == nil {
+				columns = []teradataColumn{}
+			}
+		case "data":
+			if columns == nil {
+				return nil, g.Error("invalid JSON structure: expected columns before data")
+			}
+			return columns, expectDelim('[')
+		default:
+			var skip json.RawMessage
+			if err = decoder.Decode(&skip); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return nil, nil // no result set
+}
+
+// BulkImportStream bulk import stream
+func (conn *TeradataConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	_, err = exec.LookPath(conn.tdloadPath())
+	if err != nil {
+		g.Debug("tdload not found in path. Using batch inserts...")
+		return conn.InsertBatchStream(tableFName, ds)
+	} else if conn.GetProp("use_bulk") == "false" {
+		return conn.InsertBatchStream(tableFName, ds)
+	}
+
+	// needs to get columns to shape stream
+	columns, err := conn.GetColumns(tableFName)
+	if err != nil {
+		err = g.Error(err, "could not get column list")
+		return
+	}
+
+	ds, err = ds.Shape(columns)
+	if err != nil {
+		err = g.Error(err, "could not shape stream")
+		return
+	}
+
+	count, err = conn.TdLoad(tableFName, ds)
+	if err != nil {
+		return 0, g.Error(err, "Error with TdLoad")
+	}
+
+	return count, nil
+}
+
+// TdLoad writes the stream into a delimited file, and loads it with tdload.
+// Into an empty table (such as the temp table) tdload uses FastLoad.
+// https://docs.teradata.com/r/Teradata-Parallel-Transporter-Quick-Start-Guide/June-2022/Moving-Data-with-Teradata-PT-Easy-Loader
+func (conn *TeradataConn) TdLoad(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	table, err := ParseTableName(tableFName, conn.Type)
+	if err != nil {
+		return 0, g.Error(err, "could not parse table name: "+tableFName)
+	}
+
+	dataPath := path.Join(env.GetTempFolder(), g.NewTsID(g.F("teradata.%s", env.CleanTableName(tableFName)))+".csv")
+	defer func() { env.RemoveLocalTempFile(dataPath) }()
+
+	file, err := os.Create(dataPath)
+	if err != nil {
+		return 0, g.Error(err, "could not create temp file")
+	}
+
+	g.Debug("writing to temp csv file: %s", dataPath)
+	err = conn.writeDelimited(ds, file)
+	file.Close()
+	if err != nil {
+		return ds.Count, g.Error(err, "could not write to temp file")
+	}
+
+	err = conn.runTdload(g.M(
+		"TargetTdpId", conn.tdpid(),
+		"TargetUserName", conn.GetProp("username"),
+		"TargetUserPassword", conn.GetProp("password"),
+		"TargetWorkingDatabase", table.Schema,
+		"TargetTable", table.FullName(),
+		"SourceFileName", dataPath,
+		"SourceFormat", "Delimited",
+		"SourceTextDelimiter", ",",
+		"SourceOpenQuoteMark", `"`,
+		"SourceCloseQuoteMark", `"`,
+		"SourceQuotedData", "Optional",
+	))
+	if err != nil {
+		return ds.Count, err
+	}
+
+	return ds.Count, ds.Err()
+}
+
+// BulkExportFlow exports the table with tdload when it is installed,
+// which uses the FastExport protocol
+func (conn *TeradataConn) BulkExportFlow(table Table) (df *iop.Dataflow, err error) {
+	if _, err := exec.LookPath(conn.tdloadPath()); err != nil {
+		g.Debug("tdload not found in path. Using query service...")
+		return conn.BaseConn.BulkExportFlow(table)
+	} else if conn.GetProp("use_bulk") == "false" {
+		return conn.BaseConn.BulkExportFlow(table)
+	}
+
+	columns, err := conn.GetSQLColumns(table)
+	if err != nil {
+		err = g.Error(err, "Could not get columns.")
+		return
+	}
+
+	dataPath := path.Join(env.GetTempFolder(), g.NewTsID(g.F("teradata.%s", env.CleanTableName(table.FullName())))+".csv")
+
+	err = conn.runTdload(g.M(
+		"SourceTdpId", conn.tdpid(),
+		"SourceUserName", conn.GetProp("username"),
+		"SourceUserPassword", conn.GetProp("password"),
+		"SourceSelectStmt", conn.exportSelect(table, columns),
+		"TargetFileName", dataPath,
+		"TargetFormat", "Delimited",
+		"TargetTextDelimiter", ",",
+		"TargetOpenQuoteMark", `"`,
+		"TargetCloseQuoteMark", `"`,
+		"TargetQuotedData", "Yes",
+	))
+	if err != nil {
+		env.RemoveLocalTempFile(dataPath)
+		return nil, g.Error(err, "could not export %s", table.FullName())
+	}
+
+	file, err := os.Open(dataPath)
+	if err != nil {
+		env.RemoveLocalTempFile(dataPath)
+		return nil, g.Error(err, "could not open exported file")
+	}
+
+	reader := bufio.NewReader(file)
+	nextFunc := func(it *iop.Iterator) bool {
+		row, err := readDelimitedRecord(reader)
+		if err == io.EOF {
+			return false
+		} else if err != nil {
+			it.Context.CaptureErr(g.Error(err, "could not read exported file"))
+			return false
+		}
+		it.Row = row
+		return true
+	}
+
+	ds := iop.NewDatastreamIt(conn.Context().Ctx, columns, nextFunc)
+	ds.Inferred = true
+	ds.SetMetadata(conn.GetProp("METADATA"))
+	conn.setTransforms(ds.Columns)
+	ds.SetConfig(conn.Props())
+
+	if err = ds.Start(); err != nil {
+		file.Close()
+		env.RemoveLocalTempFile(dataPath)
+		return nil, g.Error(err, "could start datastream")
+	}
+
+	df, err = iop.MakeDataFlow(ds)
+	if err != nil {
+		file.Close()
+		env.RemoveLocalTempFile(dataPath)
+		return nil, g.Error(err, "could not make dataflow")
+	}
+
+	df.Defer(func() {
+		file.Close()
+		env.RemoveLocalTempFile(dataPath)
+	})
+
+	return df, nil
+}
+
+// exportSelect returns the select statement of the export. The delimited
+// format only holds character data, so the other types are cast to varchar
+func (conn *TeradataConn) exportSelect(table Table, columns iop.Columns) string {
+	fields := make([]string, len(columns))
+	for i, col := range columns {
+		qName := conn.Quote(col.Name)
+		dbType := strings.ToLower(strings.Split(col.DbType, "(")[0])
+		switch {
+		case g.In(dbType, "varchar", "char"):
+			fields[i] = qName
+		case col.IsBinary():
+			fields[i] = g.F("from_bytes(%s, 'base16') as %s", qName, qName)
+		case col.IsNumber():
+			fields[i] = g.F("trim(cast(%s as varchar(50))) as %s", qName, qName)
+		case col.IsDate() || col.IsDatetime() || col.Type == iop.BoolType:
+			fields[i] = g.F("cast(%s as varchar(50)) as %s", qName, qName)
+		default:
+			fields[i] = g.F("cast(%s as varchar(32000)) as %s", qName, qName)
+		}
+	}
+
+	return g.F("select %s from (%s) as t", strings.Join(fields, ", "), table.Select())
+}
+
+// runTdload runs tdload with the job variables. The variables are written
+// into a file, so the credentials are not part of the command line
+func (conn *TeradataConn) runTdload(jobVars map[string]any) (err error) {
+	var stderr, stdout bytes.Buffer
+
+	keys := lo.Keys(jobVars)
+	sort.Strings(keys)
+
+	lines := []string{}
+	for _, key := range keys {
+		value := strings.ReplaceAll(cast.ToString(jobVars[key]), "'", "''")
+		lines = append(lines, g.F("%s = '%s'", key, value))
+	}
+
+	jobVarsPath := path.Join(env.GetTempFolder(), g.NewTsID("teradata.tdload")+".jobvars")
+	err = os.WriteFile(jobVarsPath, []byte(strings.Join(lines, ",\n")+"\n"), 0600)
+	if err != nil {
+		return g.Error(err, "Error writing to "+jobVarsPath)
+	}
+	defer func() { env.RemoveLocalTempFile(jobVarsPath) }()
+
+	jobName := g.F("sling_%d", time.Now().UnixNano())
+	proc := exec.CommandContext(conn.Context().Ctx, conn.tdloadPath(), "-j", jobVarsPath, jobName)
+	proc.Stderr = &stderr
+	proc.Stdout = &stdout
+
+	cmdStr := strings.Join(proc.Args, " ")
+	g.Debug(cmdStr)
+
+	if err = proc.Run(); err != nil {
+		return g.Error(
+			err,
+			fmt.Sprintf(
+				"Teradata tdload Command:\n%s\n\nTeradata tdload Error:%s\n%s",
+				cmdStr, env.Clean(conn.Props(), stderr.String()), env.Clean(conn.Props(), stdout.String()),
+			),
+		)
+	}
+
+	return nil
+}
+
+// writeDelimited writes the stream for tdload. The values are quoted, and
+// NULLs are written as unquoted empty values
+func (conn *TeradataConn) writeDelimited(ds *iop.Datastream, writer io.Writer) (err error) {
+	w := bufio.NewWriter(writer)
+	timestampLayout := conn.GetTemplateValue("variable.timestamp_layout")
+	timestampzLayout := conn.GetTemplateValue("variable.timestampz_layout")
+
+	for row0 := range ds.Rows() {
+		row := make([]string, len(row0))
+		for i, val := range row0 {
+			if val == nil {
+				continue
+			}
+
+			valS := ds.Sp.CastToString(i, val, ds.Columns[i].Type)
+			switch ds.Columns[i].Type {
+			case iop.DateType:
+				val = ds.Sp.CastValWithoutStats(i, val, ds.Columns[i].Type)
+				if t, ok := val.(time.Time); ok {
+					valS = t.Format("2006-01-02")
+				}
+			case iop.DatetimeType, iop.TimestampType:
+				val = ds.Sp.CastValWithoutStats(i, val, ds.Columns[i].Type)
+				if t, ok := val.(time.Time); ok {
+					valS = t.Format(timestampLayout)
+				}
+			case iop.TimestampzType:
+				val = ds.Sp.CastValWithoutStats(i, val, ds.Columns[i].Type)
+				if t, ok := val.(time.Time); ok {
+					valS = t.Format(timestampzLayout)
+				}
+			}
+			row[i] = `"` + strings.ReplaceAll(valS, `"`, `""`) + `"`
+		}
+
+		if _, err = w.WriteString(strings.Join(row, ",") + "\n"); err != nil {
+			ds.Context.CaptureErr(g.Error(err, "Error writing row"))
+			ds.Context.Cancel()
+			return
+		}
+	}
+
+	return w.Flush()
+}
+
+// readDelimitedRecord reads a record written by tdload. The quoted values
+// are strings, and the unquoted empty values are NULLs
+func readDelimitedRecord(r *bufio.Reader) (row []any, err error) {
+	var value strings.Builder
+	quoted, inQuotes, started := false, false, false
+
+	appendValue := func() {
+		if !quoted && value.Len() == 0 {
+			row = append(row, nil)
+		} else {
+			row = append(row, value.String())
+		}
+		value.Reset()
+		quoted = false
+	}
+
+	for {
+		c, _, err := r.ReadRune()
+		if err == io.EOF {
+			if !started {
+				return nil, io.EOF
+			} else if inQuotes {
+				return nil, g.Error("unterminated quoted value")
+			}
+			appendValue()
+			return row, nil
+		} else if err != nil {
+			return nil, err
+		}
+		started = true
+
+		switch {
+		case inQuotes && c == '"':
+			// a doubled quote is an escaped quote
+			if next, _, err := r.ReadRune(); err == nil && next == '"' {
+				value.WriteRune('"')
+			} else {
+				if err == nil {
+					r.UnreadRune()
+				}
+				inQuotes = false
+			}
+		case inQuotes:
+			value.WriteRune(c)
+		case c == '"' && value.Len() == 0:
+			inQuotes, quoted = true, true
+		case c == ',':
+			appendValue()
+		case c == '\r':
+		case c == '\n':
+			appendValue()
+			return row, nil
+		default:
+			value.WriteRune(c)
+		}
+	}
+}
+
+// InsertBatchStream inserts the stream in batches. Each batch is a single
+// request, executing the insert statement once per row
+func (conn *TeradataConn) InsertBatchStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+
+	var columns iop.Columns
+	batchSize := cast.ToInt(conn.GetTemplateValue("variable.batch_rows"))
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	// default 10 concurrent requests
+	concurrency := 10
+	if val := conn.GetProp("insert_concurrency"); val != "" {
+		concurrency = cast.ToInt(val)
+	}
+	insertContext := g.NewContext(ds.Context.Ctx, concurrency)
+
+	// in case schema change is needed, cannot alter while inserting
+	mux := ds.Context.Mux
+	if df := ds.Df(); df != nil {
+		mux = df.Context.Mux
+	}
+
+	insertBatch := func(bColumns iop.Columns, rows [][]interface{}) error {
+		defer insertContext.Wg.Write.Done()
+
+		insCols, err := conn.ValidateColumnNames(columns, bColumns.Names(), true)
+		if err != nil {
+			return g.Error(err, "columns mismatch")
+		}
+
+		insertTemplate := conn.Self().GenerateInsertStatement(tableFName, insCols, 1)
+		conn.LogSQL(insertTemplate + noDebugKey)
+
+		_, err = conn.submitQuery(ds.Context.Ctx, insertTemplate, rows...)
+		if err != nil {
+			batchErrStr := g.F("Batch Size: %d rows x %d cols = %d", len(rows), len(bColumns), len(rows)*len(bColumns))
+			g.Debug(g.F("%s\n%s \n%s", err.Error(), batchErrStr, fmt.Sprintf("Insert: %s", insertTemplate)))
+			insertContext.CaptureErr(err)
+			return err
+		}
+
+		return nil
+	}
+
+	batchRows := [][]any{}
+	var batch *iop.Batch
+
+	for batch = range ds.BatchChan {
+
+		if batch.ColumnsChanged() || batch.IsFirst() {
+			// make sure fields match
+			mux.Lock()
+			insertContext.Wg.Write.Wait() // wait for any pending queries
+			columns, err = conn.GetColumns(tableFName, batch.Columns.Names()...)
+			if err != nil {
+				mux.Unlock()
+				err = g.Error(err, "could not get column list")
+				return
+			}
+			mux.Unlock()
+		}
+
+		for row := range batch.Rows {
+			batchRows = append(batchRows, row)
+			count++
+			if len(batchRows) == batchSize {
+				insertContext.Wg.Write.Add()
+				select {
+				case <-insertContext.Ctx.Done():
+					return count, insertContext.Err()
+				case <-ds.Context.Ctx.Done():
+					return count, ds.Context.Err()
+				default:
+					go insertBatch(batch.Columns, batchRows)
+				}
+
+				// reset
+				batchRows = [][]interface{}{}
+			}
+		}
+
+	}
+
+	// remaining batch
+	if len(batchRows) > 0 {
+		g.Trace("remaining batchSize %d", len(batchRows))
+		insertContext.Wg.Write.Add()
+		err = insertBatch(batch.Columns, batchRows)
+		if err != nil {
+			return count - cast.ToUint64(len(batchRows)), g.Error(err, "insertBatch")
+		}
+	}
+
+	insertContext.Wg.Write.Wait()
+
+	if err = insertContext.Err(); err != nil {
+		return count, g.Error(err, "insertBatch")
+	}
+
+	return
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/vertica/vertica-sql-go"
+)
+
+// VerticaConn is a Vertica connection
+type VerticaConn struct {
+	BaseConn
+	URL string
+}
+
+// Init initiates the object
+func (conn *VerticaConn) Init() error {
+
+	conn.BaseConn.URL = conn.URL
+	conn.BaseConn.Type = dbio.TypeDbVertica
+	conn.BaseConn.defaultPort = 5433
+
+	instance := Connection(conn)
+	conn.BaseConn.instance = &instance
+
+	return conn.BaseConn.Init()
+}
+
+// GenerateDDL generates a DDL based on a dataset, with the sort order and
+// the segmentation of the table projection
+func (conn *VerticaConn) GenerateDDL(table Table, data iop.Dataset, temporary bool) (ddl string, err error) {
+	ddl, err = conn.BaseConn.GenerateDDL(table, data, temporary)
+	if err != nil {
+		return ddl, g.Error(err)
+	}
+
+	ddl, err = table.AddPrimaryKeyToDDL(ddl, data.Columns)
+	if err != nil {
+		return ddl, g.Error(err)
+	}
+
+	keyNames := func(keyType iop.KeyType) []string {
+		if keys, ok := table.Keys[keyType]; ok && len(keys) > 0 {
+			return keys
+		}
+		return data.Columns.GetKeys(keyType).Names()
+	}
+
+	orderBy := ""
+	if keys := keyNames(iop.SortKey); len(keys) > 0 {
+		orderBy = g.F("order by %s", strings.Join(conn.QuoteNames(keys...), ", "))
+	}
+
+	segmentedBy := ""
+	if keys := keyNames(iop.DistributionKey); len(keys) > 0 {
+		segmentedBy = g.F("segmented by hash(%s) all nodes", strings.Join(conn.QuoteNames(keys...), ", "))
+	}
+
+	ddl = strings.ReplaceAll(ddl, "{order_by}", orderBy)
+	ddl = strings.ReplaceAll(ddl, "{segmented_by}", segmentedBy)
+
+	return strings.TrimSpace(ddl), nil
+}
+
+// BulkImportStream inserts a stream into a table, with COPY FROM STDIN
+// (streaming the CSV rows through the driver)
+func (conn *VerticaConn) BulkImportStream(tableFName string, ds *iop.Datastream) (count uint64, err error) {
+	// needs to get columns to shape stream
+	columns, err := conn.GetColumns(tableFName, ds.Columns.Names()...)
+	if err != nil {
+		return 0, g.Error(err, "could not get column list")
+	}
+
+	ds, err = ds.Shape(columns)
+	if err != nil {
+		return 0, g.Error(err, "could not shape stream")
+	}
+
+	// empty values are loaded as null
+	sc := iop.LoaderStreamConfig(true)
+	sc.NullAs = ""
+
+	// one COPY per reader (a new reader is started when the columns change)
+	for batchR := range ds.NewCsvReaderChnl(sc) {
+		if err = conn.copyFromStdin(ds.Context.Ctx, tableFName, batchR); err != nil {
+			ds.Context.CaptureErr(err)
+			ds.Context.Cancel()
+			return ds.Count, g.Error(err, "could not copy data into %s", tableFName)
+		}
+	}
+
+	return ds.Count, ds.Err()
+}
+
+// copyFromStdin runs the COPY of the reader. The driver reads the input
+// stream from the vertica context, so the statement runs on the database
+// handle directly (ExecContext would wrap the context).
+func (conn *VerticaConn) copyFromStdin(ctx context.Context, tableFName string, batchR *iop.BatchReader) (err error) {
+	ctx, cancel := conn.timeoutContext(ctx, "statement_timeout")
+	defer cancel()
+
+	vCtx := vertigo.NewVerticaContext(ctx)
+	if err = vCtx.SetCopyInputStream(batchR.Reader); err != nil {
+		return g.Error(err, "could not set copy input stream")
+	}
+
+	sql := conn.copyFromStdinSQL(tableFName, batchR.Columns)
+	conn.LogSQL(sql)
+	if _, err = conn.Db().ExecContext(vCtx, sql); err != nil {
+		return g.Error(err, "could not execute copy")
+	}
+
+	return nil
+}
+
+// copyFromStdinSQL returns the COPY statement reading the CSV (with header)
+// from the input stream
+func (conn *VerticaConn) copyFromStdinSQL(tableFName string, columns iop.Columns) string {
+	return g.R(
+		conn.GetTemplateValue("core.copy_from_stdin"),
+		"table", tableFName,
+		"cols", strings.Join(conn.QuoteNames(columns.Names()...), ", "),
+	)
+}
+
+// GenerateUpsertSQL generates the upsert SQL
+func (conn *VerticaConn) GenerateUpsertSQL(srcTable string, tgtTable string, pkFields []string) (sql string, err error) {
+
+	upsertMap, err := conn.BaseConn.GenerateUpsertExpressions(srcTable, tgtTable, pkFields)
+	if err != nil {
+		err = g.Error(err, "could not generate upsert variables")
+		return
+	}
+
+	sqlTempl := `
+	merge into {tgt_table} tgt
+	using (select {src_fields} from {src_table}) src
+	on ({src_tgt_pk_equal})
+	when matched then
+		update set {set_fields}
+	when not matched then
+		insert ({insert_fields}) values ({src_fields_values})
+	`
+
+	sql = g.R(
+		sqlTempl,
+		"src_table", srcTable,
+		"tgt_table", tgtTable,
+		"src_tgt_pk_equal", upsertMap["src_tgt_pk_equal"],
+		"set_fields", upsertMap["set_fields"],
+		"insert_fields", upsertMap["insert_fields"],
+		"src_fields", upsertMap["src_fields"],
+		"src_fields_values", strings.ReplaceAll(upsertMap["placeholder_fields"], "ph.", "src."),
+	)
+
+	return
+}
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDatabricks mimics the SQL Statement Execution, Files and OIDC APIs
+type fakeDatabricks struct {
+	sync.Mutex
+	server     *httptest.Server
+	links      *httptest.Server // external links are served from another host
+	statements []map[string]any
+	files      map[string][]byte
+	polls      int
+}
+
+func newFakeDatabricks(t *testing.T) *fakeDatabricks {
+	fd := &fakeDatabricks{files: map[string][]byte{}}
+
+	fd.links = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"), "external links must not receive the token")
+		switch r.URL.Path {
+		case "/chunk/0":
+			w.Write([]byte(`[["1","alice","2.50"],["2",null,"3.75"]]`))
+		case "/chunk/1":
+			w.Write([]byte(`[["3","carol",null]]`))
+		}
+	}))
+
+	fd.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fd.Lock()
+		defer fd.Unlock()
+
+		if r.URL.Path == "/oidc/v1/token" {
+			r.ParseForm()
+			assert.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+			assert.Equal(t, "all-apis", r.Form.Get("scope"))
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"m2m-token","token_type":"Bearer","expires_in":3600}`))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer m2m-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/2.0/sql/statements":
+			payload := map[string]any{}
+			json.NewDecoder(r.Body).Decode(&payload)
+			fd.statements = append(fd.statements, payload)
+			w.Write([]byte(fd.respond(payload)))
+		case r.Method == "GET" && r.URL.Path == "/api/2.0/sql/statements/query-1":
+			fd.polls++
+			w.Write([]byte(fd.queryResult()))
+		case r.Method == "GET" && r.URL.Path == "/api/2.0/sql/statements/query-1/result/chunks/1":
+			w.Write([]byte(g.F(`{"chunk_index":1,"external_links":[{"chunk_index":1,"external_link":"%s/chunk/1"}]}`, fd.links.URL)))
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/api/2.0/fs/files/"):
+			assert.Equal(t, "true", r.URL.Query().Get("overwrite"))
+			fd.files[strings.TrimPrefix(r.URL.Path, "/api/2.0/fs/files")], _ = io.ReadAll(r.Body)
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/api/2.0/fs/directories/"):
+			folder := strings.TrimPrefix(r.URL.Path, "/api/2.0/fs/directories")
+			contents := []map[string]any{}
+			for filePath := range fd.files {
+				if strings.HasPrefix(filePath, folder+"/") {
+					contents = append(contents, g.M("path", filePath, "is_directory", false))
+				}
+			}
+			w.Write([]byte(g.Marshal(g.M("contents", contents))))
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/api/2.0/fs/files/"):
+			delete(fd.files, strings.TrimPrefix(r.URL.Path, "/api/2.0/fs/files"))
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/api/2.0/fs/directories/"):
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return fd
+}
+
+func (fd *fakeDatabricks) Close() {
+	fd.server.Close()
+	fd.links.Close()
+}
+
+func (fd *fakeDatabricks) respond(payload map[string]any) string {
+	statement := strings.TrimSpace(cast.ToString(payload["statement"]))
+	switch {
+	case strings.Contains(statement, "from information_schema.columns"):
+		return `{"statement_id":"cols","status":{"state":"SUCCEEDED"},
+			"manifest":{"schema":{"columns":[{"name":"column_name","type_name":"STRING"},{"name":"data_type","type_name":"STRING"},{"name":"precision","type_name":"INT"},{"name":"scale","type_name":"INT"}]}},
+			"result":{"chunk_index":0,"data_array":[["id","bigint",null,null],["name","string",null,null],["amount","decimal(10,2)","10","2"]]}}`
+	case strings.HasPrefix(statement, "select id, name, amount"):
+		return `{"statement_id":"query-1","status":{"state":"PENDING"}}`
+	case strings.HasPrefix(statement, "insert into"):
+		return `{"statement_id":"ins","status":{"state":"SUCCEEDED"},
+			"manifest":{"schema":{"columns":[{"name":"num_affected_rows","type_name":"LONG"},{"name":"num_inserted_rows","type_name":"LONG"}]}},
+			"result":{"chunk_index":0,"data_array":[["2","2"]]}}`
+	case strings.HasPrefix(statement, "select 0 from"):
+		return `{"statement_id":"err","status":{"state":"FAILED","error":{"error_code":"BAD_REQUEST","message":"[TABLE_OR_VIEW_NOT_FOUND] missing"}}}`
+	}
+	return `{"statement_id":"ok","status":{"state":"SUCCEEDED"},"manifest":{"schema":{"columns":[]}},"result":{"chunk_index":0}}`
+}
+
+func (fd *fakeDatabricks) queryResult() string {
+	if fd.polls < 2 {
+		return `{"statement_id":"query-1","status":{"state":"RUNNING"}}`
+	}
+	return g.F(`{"statement_id":"query-1","status":{"state":"SUCCEEDED"},
+		"manifest":{"schema":{"columns":[{"name":"id","type_name":"LONG"},{"name":"name","type_name":"STRING"},{"name":"amount","type_name":"DECIMAL","type_precision":10,"type_scale":2}]},"total_row_count":3},
+		"result":{"chunk_index":0,"external_links":[{"chunk_index":0,"external_link":"%s/chunk/0","next_chunk_internal_link":"/api/2.0/sql/statements/query-1/result/chunks/1"}]}}`, fd.links.URL)
+}
+
+func TestDatabricks(t *testing.T) {
+	fd := newFakeDatabricks(t)
+	defer fd.Close()
+
+	conn, err := NewConn(
+		"databricks://my-workspace/wh123?catalog=main",
+		"host="+fd.server.URL, "client_id=sp", "client_secret=secret",
+		"volume=staging",
+	)
+	if !assert.NoError(t, err) || !assert.NoError(t, conn.Connect()) {
+		return
+	}
+	defer conn.Close()
+
+	dbConn := conn.(*DatabricksConn)
+	assert.Equal(t, "wh123", dbConn.WarehouseID)
+	assert.Equal(t, "main", dbConn.Catalog)
+	assert.Equal(t, "`my_schema`.`my_table`", conn.Quote("my_schema")+"."+conn.Quote("my_table"))
+
+	// polls the statement, and follows the chunks of external links
+	data, err := conn.Query("select id, name, amount from my_schema.my_table")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"id", "name", "amount"}, data.Columns.Names())
+		assert.Equal(t, iop.BigIntType, data.Columns[0].Type)
+		assert.Equal(t, iop.DecimalType, data.Columns[2].Type)
+		if assert.Len(t, data.Rows, 3) {
+			assert.EqualValues(t, 1, data.Rows[0][0])
+			assert.Nil(t, data.Rows[1][1])
+			assert.Equal(t, "carol", data.Rows[2][1])
+		}
+		assert.Equal(t, "wh123", fd.statements[len(fd.statements)-1]["warehouse_id"])
+		assert.Equal(t, "main", fd.statements[len(fd.statements)-1]["catalog"])
+		assert.Equal(t, "EXTERNAL_LINKS", fd.statements[len(fd.statements)-1]["disposition"])
+	}
+
+	// failed statements return the error message
+	_, err = conn.Exec("select 0 from my_schema.missing")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "TABLE_OR_VIEW_NOT_FOUND")
+	}
+
+	// batch inserts bind named parameters, cast to the column types
+	conn.SetProp("volume", "")
+	ds := iop.NewDataset(iop.NewColumnsFromFields("id", "name", "amount"))
+	ds.Append([]any{1, "alice", 2.5}, []any{2, nil, 3.75})
+	count, err := conn.BulkImportStream("my_schema.my_table", ds.Stream())
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 2, count)
+		insert := fd.statements[len(fd.statements)-1]
+		assert.Contains(t, insert["statement"], "cast(:p3 as decimal(10,2))")
+		params := insert["parameters"].([]any)
+		if assert.Len(t, params, 6) {
+			assert.Equal(t, g.M("name", "p2", "value", "alice"), params[1])
+			assert.Equal(t, g.M("name", "p5"), params[4]) // null
+		}
+	}
+
+	// volume staging uploads the files, loads with copy into and cleans up
+	conn.SetProp("volume", "main.my_schema.staging")
+	ds = iop.NewDataset(iop.NewColumnsFromFields("id", "name", "amount"))
+	ds.Append([]any{1, "alice", 2.5}, []any{2, "bob", 3.75})
+	count, err = conn.BulkImportStream("my_schema.my_table", ds.Stream())
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 2, count)
+		copySQL := cast.ToString(fd.statements[len(fd.statements)-1]["statement"])
+		assert.Contains(t, copySQL, "copy into my_schema.my_table")
+		assert.Contains(t, copySQL, "from '/Volumes/main/my_schema/staging/sling/")
+		assert.Contains(t, copySQL, "cast(`amount` as decimal(10,2)) as `amount`")
+		assert.Empty(t, fd.files, "volume files should be deleted")
+	}
+
+	// incremental loads merge into the target
+	sql, err := conn.GenerateUpsertSQL("my_schema.my_table_tmp", "my_schema.my_table", []string{"id"})
+	if assert.NoError(t, err) {
+		assert.Contains(t, sql, "merge into my_schema.my_table tgt")
+		assert.Contains(t, sql, "src.`id` = tgt.`id`")
+		assert.Contains(t, sql, "when not matched then")
+	}
+
+	// the volume name resolves against the table schema
+	table, _ := ParseTableName("my_schema.my_table", conn.GetType())
+	conn.SetProp("volume", "staging")
+	volumePath, err := dbConn.volumePath(table)
+	if assert.NoError(t, err) {
+		assert.True(t, strings.HasPrefix(volumePath, "/Volumes/main/my_schema/staging/sling/my_schema.my_table/"), volumePath)
+	}
+}
@@ -0,0 +1,241 @@
+package database
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+
+	"github.com/flarco/g"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/lib/pq"
+	"github.com/sijms/go-ora/v2/advanced_nego"
+)
+
+// KerberosConfig is the Kerberos (GSSAPI) configuration of a connection.
+// Authenticates with a keytab if provided, otherwise with the credential
+// cache (as obtained with `kinit`).
+type KerberosConfig struct {
+	ConfigFile    string `json:"krb5_config_file"`     // defaults to KRB5_CONFIG or /etc/krb5.conf
+	Realm         string `json:"krb5_realm"`           // defaults to the default realm of the config
+	Principal     string `json:"krb5_principal"`       // defaults to the username, used with the keytab
+	KeytabFile    string `json:"krb5_keytab_file"`     // defaults to KRB5_CLIENT_KTNAME
+	CredCacheFile string `json:"krb5_cred_cache_file"` // defaults to KRB5CCNAME or /tmp/krb5cc_<uid>
+	ServiceName   string `json:"krb5_service_name"`    // overrides the service of the principal name (SPN)
+}
+
+// kerberosConfigs holds the configs of the connections, by host
+var kerberosConfigs sync.Map
+
+// kerberosClients holds the logged in clients, by config
+var kerberosClients sync.Map
+
+func init() {
+	pq.RegisterGSSProvider(func() (pq.GSS, error) { return &kerberosGSS{}, nil })
+	advanced_nego.SetKerberosAuth(&kerberosOracleAuth{})
+}
+
+// registerKerberos registers the kerberos config of the connection, if
+// specified with the `krb5_*` properties or `auth_type: kerberos`.
+// The drivers ask for a token with the server host, which is used to look
+// up the config.
+func registerKerberos(conn Connection) {
+	cfg := KerberosConfig{
+		ConfigFile:    conn.GetProp("krb5_config_file"),
+		Realm:         conn.GetProp("krb5_realm"),
+		Principal:     conn.GetProp("krb5_principal"),
+		KeytabFile:    conn.GetProp("krb5_keytab_file"),
+		CredCacheFile: conn.GetProp("krb5_cred_cache_file"),
+		ServiceName:   conn.GetProp("krb5_service_name"),
+	}
+
+	if cfg == (KerberosConfig{}) && !strings.EqualFold(conn.GetProp("auth_type"), "kerberos") {
+		return
+	}
+
+	host, username := conn.GetProp("host"), conn.GetProp("username")
+	if u, err := url.Parse(conn.GetURL()); err == nil {
+		host = firstNonEmpty(host, u.Hostname())
+		username = firstNonEmpty(username, u.User.Username())
+	}
+
+	if cfg.Principal == "" && cfg.KeytabFile != "" {
+		cfg.Principal = username
+	}
+
+	kerberosConfigs.Store(strings.ToLower(host), cfg)
+}
+
+// getKerberosConfig returns the config registered for the host. If none,
+// the single registered config is used (the server may report another
+// host name), otherwise the defaults from the environment.
+func getKerberosConfig(host string) (cfg KerberosConfig) {
+	if val, ok := kerberosConfigs.Load(strings.ToLower(host)); ok {
+		return val.(KerberosConfig)
+	}
+
+	count := 0
+	kerberosConfigs.Range(func(key, val any) bool {
+		cfg = val.(KerberosConfig)
+		count++
+		return count < 2
+	})
+	if count == 1 {
+		return cfg
+	}
+	return KerberosConfig{}
+}
+
+// Client returns a logged in kerberos client, cached per config
+func (cfg KerberosConfig) Client() (cl *client.Client, err error) {
+	key := g.Marshal(cfg)
+	if val, ok := kerberosClients.Load(key); ok {
+		return val.(*client.Client), nil
+	}
+
+	configFile := firstNonEmpty(cfg.ConfigFile, os.Getenv("KRB5_CONFIG"), "/etc/krb5.conf")
+	krb5Conf, err := config.Load(configFile)
+	if err != nil {
+		return nil, g.Error(err, "could not load kerberos config: %s", configFile)
+	}
+
+	keytabFile := firstNonEmpty(cfg.KeytabFile, strings.TrimPrefix(os.Getenv("KRB5_CLIENT_KTNAME"), "FILE:"))
+	if keytabFile != "" {
+		if cfg.Principal == "" {
+			return nil, g.Error("must provide krb5_principal (or username) to authenticate with keytab")
+		}
+
+		// principal may include the realm, e.g. `user@EXAMPLE.COM`
+		principal, realm, _ := strings.Cut(cfg.Principal, "@")
+		realm = firstNonEmpty(cfg.Realm, realm, krb5Conf.LibDefaults.DefaultRealm)
+
+		kt, err := keytab.Load(keytabFile)
+		if err != nil {
+			return nil, g.Error(err, "could not load keytab: %s", keytabFile)
+		}
+
+		cl = client.NewWithKeytab(principal, realm, kt, krb5Conf, client.DisablePAFXFAST(true))
+		if err = cl.Login(); err != nil {
+			return nil, g.Error(err, "could not login to kerberos with keytab as %s@%s", principal, realm)
+		}
+	} else {
+		ccacheFile := firstNonEmpty(cfg.CredCacheFile, strings.TrimPrefix(os.Getenv("KRB5CCNAME"), "FILE:"))
+		if ccacheFile == "" {
+			if u, err := user.Current(); err == nil {
+				ccacheFile = "/tmp/krb5cc_" + u.Uid
+			}
+		}
+
+		ccache, err := credentials.LoadCCache(ccacheFile)
+		if err != nil {
+			return nil, g.Error(err, "could not load kerberos credential cache: %s (run kinit, or provide krb5_keytab_file)", ccacheFile)
+		}
+
+		cl, err = client.NewFromCCache(ccache, krb5Conf, client.DisablePAFXFAST(true))
+		if err != nil {
+			return nil, g.Error(err, "could not create kerberos client from credential cache")
+		}
+	}
+
+	kerberosClients.Store(key, cl)
+	return cl, nil
+}
+
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(vals ...string) string {
+	for _, val := range vals {
+		if val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
+// kerberosGSS is the GSSAPI provider of the postgres driver
+type kerberosGSS struct {
+	cl *client.Client
+}
+
+// GetInitToken returns the initial token for the service on the host
+func (gss *kerberosGSS) GetInitToken(host string, service string) ([]byte, error) {
+	cfg := getKerberosConfig(host)
+	if cfg.ServiceName != "" {
+		service = cfg.ServiceName
+	}
+
+	// use the canonical host name, as in the service principal name
+	if cname, err := net.LookupCNAME(host); err == nil {
+		host = strings.TrimSuffix(cname, ".")
+	}
+
+	return gss.initToken(cfg, service+"/"+host)
+}
+
+// GetInitTokenFromSpn returns the initial token for the service principal name
+func (gss *kerberosGSS) GetInitTokenFromSpn(spn string) ([]byte, error) {
+	return gss.initToken(getKerberosConfig(""), spn)
+}
+
+func (gss *kerberosGSS) initToken(cfg KerberosConfig, spn string) (token []byte, err error) {
+	if gss.cl, err = cfg.Client(); err != nil {
+		return nil, err
+	}
+
+	ct, err := spnego.SPNEGOClient(gss.cl, spn).InitSecContext()
+	if err != nil {
+		return nil, g.Error(err, "could not get kerberos service ticket for %s", spn)
+	}
+
+	return ct.Marshal()
+}
+
+// Continue checks the response of the server
+func (gss *kerberosGSS) Continue(inToken []byte) (done bool, outToken []byte, err error) {
+	t := &spnego.SPNEGOToken{}
+	if err = t.Unmarshal(inToken); err != nil {
+		return true, nil, g.Error(err, "could not read kerberos response")
+	}
+
+	if !t.Resp || t.NegTokenResp.State() != spnego.NegStateAcceptCompleted {
+		return true, nil, g.Error("kerberos authentication was not accepted by the server")
+	}
+	return true, nil, nil
+}
+
+// kerberosOracleAuth is the kerberos authentication of the oracle driver,
+// used with `auth_type: kerberos`
+type kerberosOracleAuth struct{}
+
+// Authenticate returns the AP-REQ of the service on the server
+func (auth *kerberosOracleAuth) Authenticate(server, service string) ([]byte, error) {
+	cfg := getKerberosConfig(server)
+	if cfg.ServiceName != "" {
+		service = cfg.ServiceName
+	}
+
+	cl, err := cfg.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	spn := service + "/" + server
+	tkt, key, err := cl.GetServiceTicket(spn)
+	if err != nil {
+		return nil, g.Error(err, "could not get kerberos service ticket for %s", spn)
+	}
+
+	token, err := spnego.NewKRB5TokenAPREQ(cl, tkt, key, []int{gssapi.ContextFlagMutual}, []int{flags.APOptionMutualRequired})
+	if err != nil {
+		return nil, g.Error(err, "could not create kerberos request")
+	}
+
+	return token.APReq.Marshal()
+}
@@ -3,8 +3,10 @@ package database
 import (
 	"database/sql"
 	"encoding/json"
+	"regexp"
 	"runtime/debug"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/flarco/g"
@@ -30,15 +32,311 @@ type Table struct {
 
 	Raw string `json:"raw"`
 
+	// Quoting is the quoting policy of the identifiers, of the connection
+	Quoting dbio.IdentifierQuoting `json:"-"`
+
 	limit, offset int
 }
 
+// ChunkByColumn splits the read of a table into `p` range queries over column `c`,
+// based on its min & max values. Null values are read in a separate chunk.
 var ChunkByColumn = func(conn Connection, table Table, c string, p int) ([]Table, error) {
-	return []Table{table}, nil
+	if p <= 1 {
+		return []Table{table}, nil
+	}
+
+	col, err := table.chunkColumn(c)
+	if err != nil {
+		return nil, err
+	}
+
+	baseSQL := table.chunkBaseSQL()
+	sql := g.R(
+		conn.GetTemplateValue("core.partition_bounds"),
+		"column", conn.Quote(col.Name),
+		"sql", baseSQL,
+	)
+	data, err := conn.Query(sql)
+	if err != nil {
+		return nil, g.Error(err, "could not get min/max values of column %s", col.Name)
+	} else if len(data.Rows) == 0 || data.Rows[0][0] == nil || data.Rows[0][1] == nil {
+		return []Table{table}, nil // no values
+	}
+	minVal, maxVal := data.Rows[0][0], data.Rows[0][1]
+
+	// determine the chunk boundaries
+	var bounds []any
+	switch {
+	case col.IsInteger():
+		minI, maxI := cast.ToInt64(cast.ToFloat64(minVal)), cast.ToInt64(cast.ToFloat64(maxVal))
+		if span := maxI - minI + 1; span < int64(p) {
+			p = int(span)
+		}
+		step := (maxI - minI + 1) / int64(p)
+		for i := 0; i < p; i++ {
+			bounds = append(bounds, minI+int64(i)*step)
+		}
+		bounds = append(bounds, maxI)
+	case col.IsNumber():
+		minF, maxF := cast.ToFloat64(minVal), cast.ToFloat64(maxVal)
+		step := (maxF - minF) / float64(p)
+		for i := 0; i < p; i++ {
+			bounds = append(bounds, minF+float64(i)*step)
+		}
+		bounds = append(bounds, maxF)
+	case col.IsDatetime() || col.IsDate():
+		minT, err := cast.ToTimeE(minVal)
+		if err != nil {
+			return nil, g.Error(err, "could not parse min value of column %s", col.Name)
+		}
+		maxT, err := cast.ToTimeE(maxVal)
+		if err != nil {
+			return nil, g.Error(err, "could not parse max value of column %s", col.Name)
+		}
+		step := maxT.Sub(minT) / time.Duration(p)
+		for i := 0; i < p; i++ {
+			bounds = append(bounds, minT.Add(time.Duration(i)*step))
+		}
+		bounds = append(bounds, maxT)
+	default:
+		return nil, g.Error("cannot chunk by column %s of type %s, must be numeric, date or datetime", col.Name, col.Type)
+	}
+
+	colQ := conn.Quote(col.Name)
+	conds := []string{}
+	for i := 0; i < len(bounds)-1; i++ {
+		lower := iop.FormatValue(bounds[i], col.Type, conn.GetType())
+		upper := iop.FormatValue(bounds[i+1], col.Type, conn.GetType())
+		if i == len(bounds)-2 {
+			conds = append(conds, g.F("%s >= %s and %s <= %s", colQ, lower, colQ, upper))
+		} else {
+			conds = append(conds, g.F("%s >= %s and %s < %s", colQ, lower, colQ, upper))
+		}
+	}
+	conds = append(conds, g.F("%s is null", colQ))
+
+	return table.chunkTables(conn, baseSQL, conds), nil
 }
 
-var ChunkByColumnRange = func(conn Connection, t Table, c string, cs, min, max string) ([]string, error) {
-	return []string{}, nil
+// ChunkByRanges splits the read of a table into the provided ranges over column `c`.
+// Each range is formatted as `start,end`, the end value being excluded.
+// An empty start or end value leaves the range open.
+var ChunkByRanges = func(conn Connection, table Table, c string, ranges []string) ([]Table, error) {
+	col, err := table.chunkColumn(c)
+	if err != nil {
+		return nil, err
+	}
+
+	colQ := conn.Quote(col.Name)
+	conds := []string{}
+	for _, rangeStr := range ranges {
+		values := strings.Split(rangeStr, ",")
+		if len(values) != 2 {
+			return nil, g.Error("invalid range (%s), expected format is `start,end`", rangeStr)
+		}
+
+		parts := []string{}
+		if start := strings.TrimSpace(values[0]); start != "" {
+			parts = append(parts, g.F("%s >= %s", colQ, iop.FormatValue(start, col.Type, conn.GetType())))
+		}
+		if end := strings.TrimSpace(values[1]); end != "" {
+			parts = append(parts, g.F("%s < %s", colQ, iop.FormatValue(end, col.Type, conn.GetType())))
+		}
+		if len(parts) == 0 {
+			parts = append(parts, "1=1")
+		}
+		conds = append(conds, strings.Join(parts, " and "))
+	}
+
+	return table.chunkTables(conn, table.chunkBaseSQL(), conds), nil
+}
+
+// ChunkByColumnRange splits the range `min` to `max` of column `c` into chunks of
+// size `cs`, such as `1000` (or `1m`) for integer columns, or `7d` / `1m` (month) for
+// date & datetime columns. Ranges are returned as `start,end`, both values included.
+// Missing min or max values are read from the table.
+var ChunkByColumnRange = func(conn Connection, t Table, c string, cs, min, max string) (ranges []string, err error) {
+	if len(t.Columns) == 0 {
+		t.Columns, err = conn.GetSQLColumns(t)
+		if err != nil {
+			return nil, g.Error(err, "could not get columns of %s", t.FullName())
+		}
+	}
+
+	col, err := t.chunkColumn(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if min == "" || max == "" {
+		sql := g.R(
+			conn.GetTemplateValue("core.partition_bounds"),
+			"column", conn.Quote(col.Name),
+			"sql", t.chunkBaseSQL(),
+		)
+		data, err := conn.Query(sql)
+		if err != nil {
+			return nil, g.Error(err, "could not get min/max values of column %s", col.Name)
+		} else if len(data.Rows) == 0 || data.Rows[0][0] == nil {
+			return ranges, nil // no values
+		}
+
+		if min == "" {
+			min = chunkValueString(col, data.Rows[0][0])
+		}
+		if max == "" {
+			max = chunkValueString(col, data.Rows[0][1])
+		}
+	}
+
+	switch {
+	case col.IsInteger():
+		size, err := parseChunkSizeInt(cs)
+		if err != nil {
+			return nil, err
+		}
+		minI, err := cast.ToInt64E(min)
+		if err != nil {
+			return nil, g.Error(err, "invalid range start value: %s", min)
+		}
+		maxI, err := cast.ToInt64E(max)
+		if err != nil {
+			return nil, g.Error(err, "invalid range end value: %s", max)
+		}
+
+		for start := minI; start <= maxI; start += size {
+			end := lo.Min([]int64{start + size - 1, maxI})
+			ranges = append(ranges, g.F("%d,%d", start, end))
+		}
+	case col.IsDatetime() || col.IsDate():
+		minT, err := cast.ToTimeE(min)
+		if err != nil {
+			return nil, g.Error(err, "invalid range start value: %s", min)
+		}
+		maxT, err := cast.ToTimeE(max)
+		if err != nil {
+			return nil, g.Error(err, "invalid range end value: %s", max)
+		}
+
+		addChunk, err := parseChunkSizeTime(cs)
+		if err != nil {
+			return nil, err
+		}
+
+		// ranges are inclusive, so end the chunk right before the next one
+		layout, precision := chunkTimeLayout(conn, col)
+		for start := minT; !start.After(maxT); start = addChunk(start) {
+			end := addChunk(start).Add(-precision)
+			if end.After(maxT) {
+				end = maxT
+			}
+			ranges = append(ranges, start.Format(layout)+","+end.Format(layout))
+		}
+	default:
+		return nil, g.Error("cannot chunk by column %s of type %s, must be an integer, date or datetime", col.Name, col.Type)
+	}
+
+	return ranges, nil
+}
+
+var chunkSizeRegex = regexp.MustCompile(`^(\d+)\s*([a-zA-Z]*)$`)
+
+func parseChunkSizeInt(cs string) (size int64, err error) {
+	matches := chunkSizeRegex.FindStringSubmatch(strings.TrimSpace(cs))
+	if len(matches) != 3 {
+		return 0, g.Error("invalid chunk size (%s), expected a number such as 10000 or 1m", cs)
+	}
+
+	size = cast.ToInt64(matches[1])
+	switch strings.ToLower(matches[2]) {
+	case "":
+	case "k":
+		size = size * 1000
+	case "m":
+		size = size * 1000 * 1000
+	case "b":
+		size = size * 1000 * 1000 * 1000
+	default:
+		return 0, g.Error("invalid chunk size (%s), expected a number such as 10000 or 1m", cs)
+	}
+
+	if size <= 0 {
+		return 0, g.Error("invalid chunk size (%s), must be greater than 0", cs)
+	}
+	return size, nil
+}
+
+func parseChunkSizeTime(cs string) (addChunk func(time.Time) time.Time, err error) {
+	matches := chunkSizeRegex.FindStringSubmatch(strings.TrimSpace(cs))
+	if len(matches) != 3 || cast.ToInt(matches[1]) <= 0 {
+		return nil, g.Error("invalid chunk size (%s), expected a duration such as 7d or 1m", cs)
+	}
+
+	n := cast.ToInt(matches[1])
+	switch strings.TrimSuffix(strings.ToLower(matches[2]), "s") {
+	case "y", "year":
+		return func(t time.Time) time.Time { return t.AddDate(n, 0, 0) }, nil
+	case "m", "mo", "mon", "month":
+		return func(t time.Time) time.Time { return t.AddDate(0, n, 0) }, nil
+	case "w", "week":
+		return func(t time.Time) time.Time { return t.AddDate(0, 0, 7*n) }, nil
+	case "d", "day":
+		return func(t time.Time) time.Time { return t.AddDate(0, 0, n) }, nil
+	case "h", "hour":
+		return func(t time.Time) time.Time { return t.Add(time.Duration(n) * time.Hour) }, nil
+	case "min", "minute":
+		return func(t time.Time) time.Time { return t.Add(time.Duration(n) * time.Minute) }, nil
+	}
+	return nil, g.Error("invalid chunk size (%s), expected a duration such as 7d or 1m", cs)
+}
+
+// chunkTimeLayout returns the layout and precision of range values for a time column
+func chunkTimeLayout(conn Connection, col *iop.Column) (layout string, precision time.Duration) {
+	switch {
+	case col.IsDate():
+		return "2006-01-02", 24 * time.Hour
+	case conn.GetType() == dbio.TypeDbOracle && strings.EqualFold(col.DbType, "DATE"):
+		return "2006-01-02 15:04:05", time.Second
+	}
+	return "2006-01-02 15:04:05.000000", time.Microsecond
+}
+
+func chunkValueString(col *iop.Column, val any) string {
+	if col.IsDatetime() || col.IsDate() {
+		if t, err := cast.ToTimeE(val); err == nil {
+			return t.Format("2006-01-02 15:04:05.000000")
+		}
+	} else if col.IsInteger() {
+		return cast.ToString(cast.ToInt64(cast.ToFloat64(val)))
+	}
+	return cast.ToString(val)
+}
+
+func (t *Table) chunkColumn(c string) (col *iop.Column, err error) {
+	if col = t.Columns.GetColumn(c); col == nil {
+		return nil, g.Error("did not find column %s in %s", c, t.FullName())
+	}
+	return col, nil
+}
+
+func (t *Table) chunkBaseSQL() string {
+	if t.IsQuery() {
+		return t.SQL
+	}
+	return t.Select()
+}
+
+func (t *Table) chunkTables(conn Connection, baseSQL string, conds []string) (tables []Table) {
+	for _, cond := range conds {
+		chunk := *t
+		chunk.SQL = g.R(
+			conn.GetTemplateValue("core.partition_select"),
+			"sql", baseSQL,
+			"where_cond", cond,
+		)
+		tables = append(tables, chunk)
+	}
+	return
 }
 
 func (t *Table) IsQuery() bool {
@@ -111,52 +409,45 @@ func (t *Table) SetKeys(sourcePKCols []string, updateCol string, tableKeys Table
 }
 
 func (t *Table) FullName() string {
-	q := GetQualifierQuote(t.Dialect)
-
 	fdqnArr := []string{}
 	if t.Schema != "" {
-		fdqnArr = append(fdqnArr, q+t.Schema+q)
+		fdqnArr = append(fdqnArr, QuoteIdentifier(t.Dialect, t.Quoting, t.Schema))
 	}
 	if t.Name != "" {
 		if t.Name == "*" {
 			fdqnArr = append(fdqnArr, t.Name)
 		} else {
-			fdqnArr = append(fdqnArr, q+t.Name+q)
+			fdqnArr = append(fdqnArr, QuoteIdentifier(t.Dialect, t.Quoting, t.Name))
 		}
 	}
 	return strings.Join(fdqnArr, ".")
 }
 
 func (t *Table) DatabaseQ() string {
-	q := GetQualifierQuote(t.Dialect)
-	return q + t.Database + q
+	return QuoteIdentifier(t.Dialect, t.Quoting, t.Database)
 }
 
 func (t *Table) SchemaQ() string {
-	q := GetQualifierQuote(t.Dialect)
-	return q + t.Schema + q
+	return QuoteIdentifier(t.Dialect, t.Quoting, t.Schema)
 }
 
 func (t *Table) NameQ() string {
-	q := GetQualifierQuote(t.Dialect)
-	return q + t.Name + q
+	return QuoteIdentifier(t.Dialect, t.Quoting, t.Name)
 }
 
 func (t *Table) FDQN() string {
-	q := GetQualifierQuote(t.Dialect)
-
 	fdqnArr := []string{}
 	if t.Database != "" {
-		fdqnArr = append(fdqnArr, q+t.Database+q)
+		fdqnArr = append(fdqnArr, QuoteIdentifier(t.Dialect, t.Quoting, t.Database))
 	}
 	if t.Schema != "" {
-		fdqnArr = append(fdqnArr, q+t.Schema+q)
+		fdqnArr = append(fdqnArr, QuoteIdentifier(t.Dialect, t.Quoting, t.Schema))
 	}
 	if t.Name != "" {
 		if t.Name == "*" {
 			fdqnArr = append(fdqnArr, t.Name)
 		} else {
-			fdqnArr = append(fdqnArr, q+t.Name+q)
+			fdqnArr = append(fdqnArr, QuoteIdentifier(t.Dialect, t.Quoting, t.Name))
 		}
 	}
 	return strings.Join(fdqnArr, ".")
@@ -225,6 +516,26 @@ func (t *Table) Select(Opts ...SelectOptions) (sql string) {
 			})
 		}
 
+		if len(m) > 0 {
+			return g.Marshal(m)
+		}
+		return t.SQL
+	case dbio.TypeDbStripe, dbio.TypeDbShopify, dbio.TypeDbHubSpot, dbio.TypeDbPlugin:
+		m, _ := g.UnmarshalMap(t.SQL)
+		if m == nil {
+			m = g.M()
+		}
+
+		if len(fields) > 0 && fields[0] != "*" {
+			m["fields"] = lo.Map(fields, func(v string, i int) string {
+				return strings.TrimSpace(v)
+			})
+		}
+
+		if limit > 0 {
+			m["limit"] = limit
+		}
+
 		if len(m) > 0 {
 			return g.Marshal(m)
 		}
@@ -242,7 +553,7 @@ func (t *Table) Select(Opts ...SelectOptions) (sql string) {
 		if f == "*" || strings.Contains(f, "(") {
 			return f
 		}
-		return q + strings.ReplaceAll(f, q, "") + q
+		return QuoteIdentifier(t.Dialect, t.Quoting, strings.ReplaceAll(f, q, ""))
 	})
 
 	template, err := t.Dialect.Template()
@@ -270,7 +581,7 @@ func (t *Table) Select(Opts ...SelectOptions) (sql string) {
 			if len(fields) == 0 {
 				replaceExprs := []string{}
 				for _, col := range toJsonCols {
-					colQ := t.Dialect.Quote(col.Name)
+					colQ := t.Dialect.QuoteWith(t.Quoting, col.Name)
 					expr := g.F("safe.parse_json(to_json_string(%s)) as %s", colQ, colQ)
 					replaceExprs = append(replaceExprs, expr)
 				}
@@ -284,7 +595,7 @@ func (t *Table) Select(Opts ...SelectOptions) (sql string) {
 				fieldsExprs := []string{}
 				for _, field := range opts.Fields {
 					field = strings.TrimSpace(field)
-					colQ := t.Dialect.Quote(field)
+					colQ := t.Dialect.QuoteWith(t.Quoting, field)
 					if col := toJsonCols.GetColumn(field); col != nil {
 						expr := g.F("safe.parse_json(to_json_string(%s)) as %s", colQ, colQ)
 						fieldsExprs = append(fieldsExprs, expr)
@@ -677,6 +988,14 @@ func (ct *ColumnType) IsSourced() bool {
 	return ct.Sourced
 }
 
+// ParseConnTableName parses the table name for the connection, with its
+// identifier quoting policy
+func ParseConnTableName(text string, conn Connection) (table Table, err error) {
+	table, err = ParseTableName(text, conn.GetType())
+	table.Quoting = GetIdentifierQuoting(conn)
+	return table, err
+}
+
 func ParseTableName(text string, dialect dbio.Type) (table Table, err error) {
 	table.Dialect = dialect
 	table.Raw = text
@@ -847,12 +1166,23 @@ func getColumnsProp(conn Connection) (coerceCols iop.Columns, ok bool) {
 	return coerceCols, false
 }
 
+// QuoteIdentifier quotes the identifier with the qualifier quote of the
+// dialect, per the quoting policy
+func QuoteIdentifier(dialect dbio.Type, quoting dbio.IdentifierQuoting, name string) string {
+	if !dialect.QuoteNeeded(name, quoting) {
+		return name
+	}
+	q := GetQualifierQuote(dialect)
+	return q + name + q
+}
+
 func GetQualifierQuote(dialect dbio.Type) string {
 	quote := `"`
 	switch dialect {
-	case dbio.TypeDbMySQL, dbio.TypeDbMariaDB, dbio.TypeDbStarRocks, dbio.TypeDbBigQuery, dbio.TypeDbClickhouse, dbio.TypeDbProton:
+	case dbio.TypeDbMySQL, dbio.TypeDbMariaDB, dbio.TypeDbSingleStore, dbio.TypeDbTiDB, dbio.TypeDbStarRocks, dbio.TypeDbBigQuery, dbio.TypeDbClickhouse, dbio.TypeDbProton, dbio.TypeDbDatabricks:
 		quote = "`"
-	case dbio.TypeDbBigTable, dbio.TypeDbMongoDB, dbio.TypeDbPrometheus:
+	case dbio.TypeDbBigTable, dbio.TypeDbMongoDB, dbio.TypeDbPrometheus, dbio.TypeDbInfluxDB, dbio.TypeDbNeo4j,
+		dbio.TypeDbStripe, dbio.TypeDbShopify, dbio.TypeDbHubSpot, dbio.TypeDbPlugin:
 		quote = ""
 	}
 	return quote
@@ -864,7 +1194,7 @@ func GetTablesSchemata(conn Connection, tableNames ...string) (schemata Schemata
 
 	schemaTableGroups := map[string][]Table{}
 	for _, tableName := range tableNames {
-		table, err := ParseTableName(tableName, conn.GetType())
+		table, err := ParseConnTableName(tableName, conn)
 		if err != nil {
 			return schemata, g.Error(err, "could not parse table: %s", tableName)
 		}
@@ -1001,7 +1331,9 @@ func (t *Table) AddPrimaryKeyToDDL(ddl string, columns iop.Columns) (string, err
 			prefix = g.F("constraint %s_pkey primary key", strings.ToLower(t.Name))
 		}
 
-		quotedNames := t.Dialect.QuoteNames(pkCols.Names()...)
+		quotedNames := lo.Map(pkCols.Names(), func(name string, i int) string {
+			return t.Dialect.QuoteWith(t.Quoting, name)
+		})
 		ddl = ddl[:lastParen] + g.F(", %s (%s)", prefix, strings.Join(quotedNames, ", ")) + ddl[lastParen:]
 	}
 
@@ -1017,12 +1349,14 @@ type TableIndex struct {
 
 func (ti *TableIndex) CreateDDL() string {
 	dialect := ti.Table.Dialect
-	quotedNames := dialect.QuoteNames(ti.Columns.Names()...)
+	quotedNames := lo.Map(ti.Columns.Names(), func(name string, i int) string {
+		return dialect.QuoteWith(ti.Table.Quoting, name)
+	})
 
 	if ti.Unique {
 		return g.R(
 			dialect.GetTemplateValue("core.create_unique_index"),
-			"index", dialect.Quote(ti.Name),
+			"index", dialect.QuoteWith(ti.Table.Quoting, ti.Name),
 			"table", ti.Table.FDQN(),
 			"cols", strings.Join(quotedNames, ", "),
 		)
@@ -1030,7 +1364,7 @@ func (ti *TableIndex) CreateDDL() string {
 
 	return g.R(
 		dialect.GetTemplateValue("core.create_index"),
-		"index", dialect.Quote(ti.Name),
+		"index", dialect.QuoteWith(ti.Table.Quoting, ti.Name),
 		"table", ti.Table.FDQN(),
 		"cols", strings.Join(quotedNames, ", "),
 	)
@@ -1041,7 +1375,7 @@ func (ti *TableIndex) DropDDL() string {
 
 	return g.R(
 		dialect.GetTemplateValue("core.drop_index"),
-		"index", dialect.Quote(ti.Name),
+		"index", dialect.QuoteWith(ti.Table.Quoting, ti.Name),
 		"name", ti.Name,
 		"table", ti.Table.FDQN(),
 		"schema", ti.Table.SchemaQ(),
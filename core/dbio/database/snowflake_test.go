@@ -0,0 +1,70 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/flarco/g"
+	"github.com/stretchr/testify/assert"
+	"github.com/youmark/pkcs8"
+)
+
+func TestSnowpipeStreamingClient(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	g.AssertNoError(t, err)
+	der, err := pkcs8.MarshalPrivateKey(key, nil, nil)
+	g.AssertNoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	conn, err := NewConn("snowflake://my_user@my_account/my_db")
+	if !assert.NoError(t, err) {
+		return
+	}
+	sfConn, ok := conn.(*SnowflakeConn)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	// requires a private key
+	_, err = NewSnowpipeStreamingClient(sfConn)
+	assert.Error(t, err)
+
+	sfConn.SetProp("private_key", string(keyPEM))
+	sc, err := NewSnowpipeStreamingClient(sfConn)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "MY_ACCOUNT", sc.account)
+	assert.Equal(t, "MY_USER", sc.user)
+	assert.Equal(t, "https://my_account.snowflakecomputing.com", sc.accountURL)
+
+	token, err := sc.jwt()
+	if !assert.NoError(t, err) {
+		return
+	}
+	parts := strings.Split(token, ".")
+	if assert.Len(t, parts, 3) {
+		claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+		g.AssertNoError(t, err)
+		payload, _ := g.UnmarshalMap(string(claims))
+		assert.Equal(t, "MY_ACCOUNT.MY_USER", payload["sub"])
+		assert.Contains(t, payload["iss"], "MY_ACCOUNT.MY_USER.SHA256:")
+	}
+}
+
+func TestSnowflakeCreditsPerHour(t *testing.T) {
+	conn, err := NewConn("snowflake://my_user@my_account/my_db")
+	if !assert.NoError(t, err) {
+		return
+	}
+	sfConn := conn.(*SnowflakeConn)
+
+	for size, credits := range map[string]float64{"X-Small": 1, "Small": 2, "MEDIUM": 4, "X-Large": 16, "2X-Large": 32, "XXLARGE": 32, "6X-Large": 512, "": 0} {
+		sfConn.SetProp("warehouse_size", size)
+		assert.Equal(t, credits, sfConn.CreditsPerHour(), size)
+	}
+}
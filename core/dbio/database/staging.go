@@ -0,0 +1,65 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+)
+
+// StorageStager is a database which unloads query results into the files of
+// an object store, and loads these files into a table, so that warehouses
+// sharing an object store transfer data without streaming the rows.
+// The files are gzipped csv, with a header line and `\N` as null.
+type StorageStager interface {
+	// StagingTypes returns the object stores supported for staging
+	StagingTypes() []dbio.Type
+	// UnloadToStorage writes the rows of the table (or query) into the folder
+	UnloadToStorage(table Table, folderURL string) (err error)
+	// LoadFromStorage loads the files of the folder into the table
+	LoadFromStorage(tableFName, folderURL string, columns iop.Columns) (err error)
+}
+
+// StagingFilePrefix is the name prefix of the unloaded files
+const StagingFilePrefix = "part"
+
+// StagingType returns the object store type of a staging folder url
+func StagingType(folderURL string) dbio.Type {
+	switch {
+	case strings.HasPrefix(folderURL, "s3://"):
+		return dbio.TypeFileS3
+	case strings.HasPrefix(folderURL, "gs://"):
+		return dbio.TypeFileGoogle
+	case strings.HasPrefix(folderURL, "azure://") || strings.Contains(folderURL, ".blob.core.windows.net"):
+		return dbio.TypeFileAzure
+	}
+	return dbio.TypeUnknown
+}
+
+// SupportsStaging returns true if the connection can unload into, and
+// load from, the object store of the staging folder
+func SupportsStaging(conn Connection, folderURL string) bool {
+	stager, ok := conn.(StorageStager)
+	if !ok {
+		return false
+	}
+	return g.In(StagingType(folderURL), stager.StagingTypes()...)
+}
+
+// DeleteStagingFolder deletes the staged files, with the credentials of the connection
+func DeleteStagingFolder(conn Connection, folderURL string) (err error) {
+	props := g.MapToKVArr(conn.Props())
+	props = append(props, "URL="+folderURL)
+	fs, err := filesys.NewFileSysClientFromURL(folderURL, props...)
+	if err != nil {
+		return g.Error(err, "could not get fs client for %s", folderURL)
+	}
+	return filesys.Delete(fs, strings.TrimSuffix(folderURL, "/")+"/")
+}
+
+// azureStagingPath returns the azure:// path of an azure blob url, as used by snowflake
+func azureStagingPath(folderURL string) string {
+	return strings.Replace(strings.Replace(folderURL, "https://", "azure://", 1), "http://", "azure://", 1)
+}
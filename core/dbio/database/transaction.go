@@ -396,6 +396,11 @@ func InsertBatchStream(conn Connection, tx Transaction, tableFName string, ds *i
 			batchSize = 50
 		} else {
 			batchSize = cast.ToInt(conn.GetTemplateValue("variable.batch_values")) / len(columns)
+
+			// custom batch size, cannot exceed the max number of bind values
+			if val := cast.ToInt(conn.GetProp("batch_size")); val > 0 && val < batchSize {
+				batchSize = val
+			}
 		}
 
 		for row := range batch.Rows {
@@ -451,19 +456,24 @@ func InsertBatchStream(conn Connection, tx Transaction, tableFName string, ds *i
 // Upsert upserts from source table into target table
 func Upsert(conn Connection, tx Transaction, sourceTable, targetTable string, pkFields []string) (count int64, err error) {
 
-	srcTable, err := ParseTableName(sourceTable, conn.GetType())
+	srcTable, err := ParseConnTableName(sourceTable, conn)
 	if err != nil {
 		err = g.Error(err, "could not parse source table name")
 		return
 	}
 
-	tgtTable, err := ParseTableName(targetTable, conn.GetType())
+	tgtTable, err := ParseConnTableName(targetTable, conn)
 	if err != nil {
 		err = g.Error(err, "could not parse target table name")
 		return
 	}
 
-	q, err := conn.GenerateUpsertSQL(srcTable.FullName(), tgtTable.FullName(), pkFields)
+	var q string
+	if mergeSQL := conn.GetProp("merge_sql"); mergeSQL != "" {
+		q, err = conn.Base().GenerateMergeSQL(mergeSQL, srcTable.FullName(), tgtTable.FullName(), pkFields)
+	} else {
+		q, err = conn.GenerateUpsertSQL(srcTable.FullName(), tgtTable.FullName(), pkFields)
+	}
 	if err != nil {
 		err = g.Error(err, "could not generate upsert sql")
 		return
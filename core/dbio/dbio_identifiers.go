@@ -0,0 +1,67 @@
+package dbio
+
+import "strings"
+
+// reservedWords are the words reserved by most SQL databases (SQL standard)
+var reservedWords = wordSet(`all alter and any as asc between both by case cast check collate column constraint
+create cross current current_date current_time current_timestamp current_user default delete desc distinct
+drop else end except exists false fetch for foreign from full grant group having in inner insert intersect
+into is join leading left like limit natural not null offset on or order outer primary references right
+select session_user set some table then to trailing true union unique update user using values when where with`)
+
+// reservedWordsType are the additional words reserved by the databases
+var reservedWordsType = map[Type]map[string]bool{
+	TypeDbPostgres:    wordSet(`analyse analyze array asymmetric deferrable do initially lateral only placing returning symmetric variadic window`),
+	TypeDbGreenplum:   wordSet(`analyse analyze array asymmetric deferrable distributed do exclude initially only placing returning symmetric window`),
+	TypeDbRedshift:    wordSet(`analyse analyze array deferrable do initially only placing returning symmetric window`),
+	TypeDbVertica:     wordSet(`analyse analyze array correlation encoded flex ilike ilikeb interval isnull kssl likeb minus notnull nullsequal offset projection segmented timeseries unsegmented`),
+	TypeDbMySQL:       wordSet(`database databases div index interval key keys mod range read rank row rows schema show usage window write`),
+	TypeDbMariaDB:     wordSet(`database databases div index interval key keys mod range read row rows schema show usage window write`),
+	TypeDbSingleStore: wordSet(`database databases div index interval key keys mod range read row rows schema show usage window write`),
+	TypeDbTiDB:        wordSet(`database databases div index interval key keys mod range read rank row rows schema show usage window write`),
+	TypeDbStarRocks:   wordSet(`database databases div index interval key keys range rank read row rows schema show window`),
+	TypeDbOracle:      wordSet(`access comment date file level mode number resource row rowid rownum rows session size start uid`),
+	TypeDbSQLServer:   wordSet(`file identity index key percent plan proc procedure rule schema top tran transaction view`),
+	TypeDbAzure:       wordSet(`file identity index key percent plan proc procedure rule schema top tran transaction view`),
+	TypeDbAzureDWH:    wordSet(`file identity index key percent plan proc procedure rule schema top tran transaction view`),
+	TypeDbSnowflake:   wordSet(`account connection database gscluster ilike increment issue lateral minus qualify regexp rlike row rows sample schema start trigger try_cast view`),
+	TypeDbBigQuery:    wordSet(`array assert_rows_modified at contains define enum escape exclude extract groups hash ignore interval lookup merge new no nulls of over partition preceding proto qualify range recursive respect rollup rows struct tablesample treat unbounded window within`),
+	TypeDbDuckDb:      wordSet(`analyse analyze array asymmetric deferrable do initially lateral only placing pivot qualify returning symmetric unpivot variadic window`),
+	TypeDbMotherDuck:  wordSet(`analyse analyze array asymmetric deferrable do initially lateral only placing pivot qualify returning symmetric unpivot variadic window`),
+	TypeDbTeradata:    wordSet(`abort account date database day hour index minute month password position qualify sample second show title type year zone`),
+	TypeDbFirebolt:    wordSet(`array date explain extract first ilike interval last next nulls over partition quarter rows sample show timestamp top week`),
+}
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+// IsReservedWord returns true if the name is a reserved word of the database
+func (t Type) IsReservedWord(name string) bool {
+	name = strings.ToLower(name)
+	return reservedWords[name] || reservedWordsType[t][name]
+}
+
+// MaxIdentifierLength returns the maximum length of the identifiers of the
+// database, 0 if not limited
+func (t Type) MaxIdentifierLength() int {
+	switch t {
+	case TypeDbPostgres, TypeDbGreenplum:
+		return 63
+	case TypeDbMySQL, TypeDbMariaDB, TypeDbSingleStore, TypeDbTiDB, TypeDbStarRocks:
+		return 64
+	case TypeDbRedshift:
+		return 127
+	case TypeDbOracle, TypeDbSQLServer, TypeDbAzure, TypeDbAzureDWH, TypeDbTeradata, TypeDbVertica:
+		return 128
+	case TypeDbSnowflake:
+		return 255
+	case TypeDbBigQuery:
+		return 300
+	}
+	return 0
+}
@@ -5,10 +5,16 @@ import (
 	"embed"
 	"encoding/csv"
 	"io"
+	"os"
+	"path"
+	"regexp"
 	"strings"
 	"unicode"
 
 	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/spf13/cast"
 	"gopkg.in/yaml.v2"
 )
 
@@ -49,10 +55,14 @@ const (
 	TypeFileHTTP   Type = "http"
 
 	TypeDbPostgres      Type = "postgres"
+	TypeDbGreenplum     Type = "greenplum"
 	TypeDbRedshift      Type = "redshift"
+	TypeDbVertica       Type = "vertica"
 	TypeDbStarRocks     Type = "starrocks"
 	TypeDbMySQL         Type = "mysql"
 	TypeDbMariaDB       Type = "mariadb"
+	TypeDbSingleStore   Type = "singlestore"
+	TypeDbTiDB          Type = "tidb"
 	TypeDbOracle        Type = "oracle"
 	TypeDbBigTable      Type = "bigtable"
 	TypeDbBigQuery      Type = "bigquery"
@@ -65,10 +75,19 @@ const (
 	TypeDbAzure         Type = "azuresql"
 	TypeDbAzureDWH      Type = "azuredwh"
 	TypeDbTrino         Type = "trino"
+	TypeDbDatabricks    Type = "databricks"
+	TypeDbTeradata      Type = "teradata"
+	TypeDbFirebolt      Type = "firebolt"
 	TypeDbClickhouse    Type = "clickhouse"
 	TypeDbMongoDB       Type = "mongodb"
 	TypeDbElasticsearch Type = "elasticsearch"
 	TypeDbPrometheus    Type = "prometheus"
+	TypeDbInfluxDB      Type = "influxdb"
+	TypeDbNeo4j         Type = "neo4j"
+	TypeDbStripe        Type = "stripe"
+	TypeDbShopify       Type = "shopify"
+	TypeDbHubSpot       Type = "hubspot"
+	TypeDbPlugin        Type = "plugin"
 	TypeDbProton        Type = "proton"
 )
 
@@ -86,10 +105,14 @@ var AllType = []struct {
 	{TypeFileSftp, "TypeFileSftp"},
 	{TypeFileHTTP, "TypeFileHTTP"},
 	{TypeDbPostgres, "TypeDbPostgres"},
+	{TypeDbGreenplum, "TypeDbGreenplum"},
 	{TypeDbRedshift, "TypeDbRedshift"},
+	{TypeDbVertica, "TypeDbVertica"},
 	{TypeDbStarRocks, "TypeDbStarRocks"},
 	{TypeDbMySQL, "TypeDbMySQL"},
 	{TypeDbMariaDB, "TypeDbMariaDB"},
+	{TypeDbSingleStore, "TypeDbSingleStore"},
+	{TypeDbTiDB, "TypeDbTiDB"},
 	{TypeDbOracle, "TypeDbOracle"},
 	{TypeDbBigTable, "TypeDbBigTable"},
 	{TypeDbBigQuery, "TypeDbBigQuery"},
@@ -102,10 +125,19 @@ var AllType = []struct {
 	{TypeDbAzure, "TypeDbAzure"},
 	{TypeDbAzureDWH, "TypeDbAzureDWH"},
 	{TypeDbTrino, "TypeDbTrino"},
+	{TypeDbDatabricks, "TypeDbDatabricks"},
+	{TypeDbTeradata, "TypeDbTeradata"},
+	{TypeDbFirebolt, "TypeDbFirebolt"},
 	{TypeDbClickhouse, "TypeDbClickhouse"},
 	{TypeDbElasticsearch, "TypeDbElasticsearch"},
 	{TypeDbMongoDB, "TypeDbMongoDB"},
 	{TypeDbPrometheus, "TypeDbPrometheus"},
+	{TypeDbInfluxDB, "TypeDbInfluxDB"},
+	{TypeDbNeo4j, "TypeDbNeo4j"},
+	{TypeDbStripe, "TypeDbStripe"},
+	{TypeDbShopify, "TypeDbShopify"},
+	{TypeDbHubSpot, "TypeDbHubSpot"},
+	{TypeDbPlugin, "TypeDbPlugin"},
 	{TypeDbProton, "TypeDbProton"},
 }
 
@@ -125,8 +157,9 @@ func ValidateType(tStr string) (Type, bool) {
 
 	switch t {
 	case
-		TypeFileLocal, TypeFileS3, TypeFileAzure, TypeFileGoogle, TypeFileSftp, TypeFileFtp,
-		TypeDbPostgres, TypeDbRedshift, TypeDbStarRocks, TypeDbMySQL, TypeDbMariaDB, TypeDbOracle, TypeDbBigQuery, TypeDbSnowflake, TypeDbSQLite, TypeDbD1, TypeDbSQLServer, TypeDbAzure, TypeDbAzureDWH, TypeDbDuckDb, TypeDbMotherDuck, TypeDbClickhouse, TypeDbTrino, TypeDbMongoDB, TypeDbElasticsearch, TypeDbPrometheus:
+		TypeFileLocal, TypeFileHDFS, TypeFileS3, TypeFileAzure, TypeFileGoogle, TypeFileSftp, TypeFileFtp,
+		TypeDbPostgres, TypeDbGreenplum, TypeDbRedshift, TypeDbVertica, TypeDbStarRocks, TypeDbMySQL, TypeDbMariaDB, TypeDbSingleStore, TypeDbTiDB, TypeDbOracle, TypeDbBigQuery, TypeDbSnowflake, TypeDbSQLite, TypeDbD1, TypeDbSQLServer, TypeDbAzure, TypeDbAzureDWH, TypeDbDuckDb, TypeDbMotherDuck, TypeDbClickhouse, TypeDbTrino, TypeDbDatabricks, TypeDbTeradata, TypeDbFirebolt, TypeDbMongoDB, TypeDbElasticsearch, TypeDbPrometheus, TypeDbInfluxDB, TypeDbNeo4j,
+		TypeDbStripe, TypeDbShopify, TypeDbHubSpot, TypeDbPlugin:
 		return t, true
 	}
 
@@ -142,21 +175,31 @@ func (t Type) String() string {
 func (t Type) DefPort() int {
 	connTypesDefPort := map[Type]int{
 		TypeDbPostgres:      5432,
+		TypeDbGreenplum:     5432,
 		TypeDbRedshift:      5439,
+		TypeDbVertica:       5433,
 		TypeDbStarRocks:     9030,
 		TypeDbMySQL:         3306,
 		TypeDbMariaDB:       3306,
+		TypeDbSingleStore:   3306,
+		TypeDbTiDB:          4000,
 		TypeDbOracle:        1521,
 		TypeDbSQLServer:     1433,
 		TypeDbAzure:         1433,
 		TypeDbTrino:         8080,
+		TypeDbDatabricks:    443,
+		TypeDbTeradata:      1443,
+		TypeDbFirebolt:      443,
 		TypeDbClickhouse:    9000,
 		TypeDbMongoDB:       27017,
 		TypeDbElasticsearch: 9200,
 		TypeDbPrometheus:    9090,
+		TypeDbInfluxDB:      8086,
+		TypeDbNeo4j:         7474,
 		TypeDbProton:        8463,
 		TypeFileFtp:         21,
 		TypeFileSftp:        22,
+		TypeFileHDFS:        9870,
 	}
 	return connTypesDefPort[t]
 }
@@ -169,8 +212,9 @@ func (t Type) DBNameUpperCase() bool {
 // Kind returns the kind of connection
 func (t Type) Kind() Kind {
 	switch t {
-	case TypeDbPostgres, TypeDbRedshift, TypeDbStarRocks, TypeDbMySQL, TypeDbMariaDB, TypeDbOracle, TypeDbBigQuery, TypeDbBigTable,
-		TypeDbSnowflake, TypeDbSQLite, TypeDbD1, TypeDbSQLServer, TypeDbAzure, TypeDbClickhouse, TypeDbTrino, TypeDbDuckDb, TypeDbMotherDuck, TypeDbMongoDB, TypeDbElasticsearch, TypeDbPrometheus, TypeDbProton:
+	case TypeDbPostgres, TypeDbGreenplum, TypeDbRedshift, TypeDbVertica, TypeDbStarRocks, TypeDbMySQL, TypeDbMariaDB, TypeDbSingleStore, TypeDbTiDB, TypeDbOracle, TypeDbBigQuery, TypeDbBigTable,
+		TypeDbSnowflake, TypeDbSQLite, TypeDbD1, TypeDbSQLServer, TypeDbAzure, TypeDbClickhouse, TypeDbTrino, TypeDbDatabricks, TypeDbTeradata, TypeDbFirebolt, TypeDbDuckDb, TypeDbMotherDuck, TypeDbMongoDB, TypeDbElasticsearch, TypeDbPrometheus, TypeDbInfluxDB, TypeDbNeo4j, TypeDbProton,
+		TypeDbStripe, TypeDbShopify, TypeDbHubSpot, TypeDbPlugin:
 		return KindDatabase
 	case TypeFileLocal, TypeFileHDFS, TypeFileS3, TypeFileAzure, TypeFileGoogle, TypeFileSftp, TypeFileFtp, TypeFileHTTP, Type("https"):
 		return KindFile
@@ -211,10 +255,14 @@ func (t Type) NameLong() string {
 		TypeFileHTTP:        "FileSys - HTTP",
 		Type("https"):       "FileSys - HTTP",
 		TypeDbPostgres:      "DB - PostgreSQL",
+		TypeDbGreenplum:     "DB - Greenplum",
 		TypeDbRedshift:      "DB - Redshift",
+		TypeDbVertica:       "DB - Vertica",
 		TypeDbStarRocks:     "DB - StarRocks",
 		TypeDbMySQL:         "DB - MySQL",
 		TypeDbMariaDB:       "DB - MariaDB",
+		TypeDbSingleStore:   "DB - SingleStore",
+		TypeDbTiDB:          "DB - TiDB",
 		TypeDbOracle:        "DB - Oracle",
 		TypeDbBigQuery:      "DB - BigQuery",
 		TypeDbBigTable:      "DB - BigTable",
@@ -226,8 +274,17 @@ func (t Type) NameLong() string {
 		TypeDbSQLServer:     "DB - SQLServer",
 		TypeDbAzure:         "DB - Azure",
 		TypeDbTrino:         "DB - Trino",
+		TypeDbDatabricks:    "DB - Databricks",
+		TypeDbTeradata:      "DB - Teradata",
+		TypeDbFirebolt:      "DB - Firebolt",
 		TypeDbClickhouse:    "DB - Clickhouse",
 		TypeDbPrometheus:    "DB - Prometheus",
+		TypeDbInfluxDB:      "DB - InfluxDB",
+		TypeDbNeo4j:         "DB - Neo4j",
+		TypeDbStripe:        "DB - Stripe",
+		TypeDbShopify:       "DB - Shopify",
+		TypeDbHubSpot:       "DB - HubSpot",
+		TypeDbPlugin:        "DB - Plugin",
 		TypeDbElasticsearch: "DB - Elasticsearch",
 		TypeDbMongoDB:       "DB - MongoDB",
 		TypeDbProton:        "DB - Proton",
@@ -249,10 +306,14 @@ func (t Type) Name() string {
 		TypeFileHTTP:        "HTTP",
 		Type("https"):       "HTTP",
 		TypeDbPostgres:      "PostgreSQL",
+		TypeDbGreenplum:     "Greenplum",
 		TypeDbRedshift:      "Redshift",
+		TypeDbVertica:       "Vertica",
 		TypeDbStarRocks:     "StarRocks",
 		TypeDbMySQL:         "MySQL",
 		TypeDbMariaDB:       "MariaDB",
+		TypeDbSingleStore:   "SingleStore",
+		TypeDbTiDB:          "TiDB",
 		TypeDbOracle:        "Oracle",
 		TypeDbBigQuery:      "BigQuery",
 		TypeDbBigTable:      "BigTable",
@@ -263,8 +324,17 @@ func (t Type) Name() string {
 		TypeDbMotherDuck:    "MotherDuck",
 		TypeDbSQLServer:     "SQLServer",
 		TypeDbTrino:         "Trino",
+		TypeDbDatabricks:    "Databricks",
+		TypeDbTeradata:      "Teradata",
+		TypeDbFirebolt:      "Firebolt",
 		TypeDbClickhouse:    "Clickhouse",
 		TypeDbPrometheus:    "Prometheus",
+		TypeDbInfluxDB:      "InfluxDB",
+		TypeDbNeo4j:         "Neo4j",
+		TypeDbStripe:        "Stripe",
+		TypeDbShopify:       "Shopify",
+		TypeDbHubSpot:       "HubSpot",
+		TypeDbPlugin:        "Plugin",
 		TypeDbElasticsearch: "Elasticsearch",
 		TypeDbMongoDB:       "MongoDB",
 		TypeDbAzure:         "Azure",
@@ -312,6 +382,77 @@ func (template Template) Value(path string) (value string) {
 	return value
 }
 
+// Clone returns a copy of the template, to override without altering the
+// cached template of the type
+func (template Template) Clone() Template {
+	return Template{
+		Core:           lo.Assign(template.Core),
+		Metadata:       lo.Assign(template.Metadata),
+		Analysis:       lo.Assign(template.Analysis),
+		Function:       lo.Assign(template.Function),
+		GeneralTypeMap: lo.Assign(template.GeneralTypeMap),
+		NativeTypeMap:  lo.Assign(template.NativeTypeMap),
+		NativeStatsMap: lo.Assign(template.NativeStatsMap),
+		Variable:       lo.Assign(template.Variable),
+	}
+}
+
+// Set sets the value of the path, e.g. `core.insert`
+func (template Template) Set(path, value string) error {
+	if key, ok := strings.CutPrefix(path, "native_stat_map."); ok {
+		template.NativeStatsMap[key] = cast.ToBool(value)
+		return nil
+	}
+
+	prefixes := map[string]map[string]string{
+		"core.":             template.Core,
+		"analysis.":         template.Analysis,
+		"function.":         template.Function,
+		"metadata.":         template.Metadata,
+		"general_type_map.": template.GeneralTypeMap,
+		"native_type_map.":  template.NativeTypeMap,
+		"variable.":         template.Variable,
+	}
+	for prefix, dict := range prefixes {
+		if key, ok := strings.CutPrefix(path, prefix); ok && key != "" {
+			dict[key] = value
+			return nil
+		}
+	}
+	return g.Error("invalid template path: %s", path)
+}
+
+// Override sets the values of the overrides, keyed by path (e.g.
+// `core.insert`) or by section (e.g. `core: {insert: ...}`)
+func (template Template) Override(overrides map[string]any) (err error) {
+	for key, value := range overrides {
+		section, err := cast.ToStringMapE(value)
+		if err != nil {
+			if err = template.Set(key, cast.ToString(value)); err != nil {
+				return err
+			}
+			continue
+		}
+		for subKey, subValue := range section {
+			if err = template.Set(key+"."+subKey, cast.ToString(subValue)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// TemplatesDir is the folder of the template overrides: a `<type>.yaml` file
+// (e.g. `postgres.yaml`) overrides entries of the built-in template of the
+// type. Set with SLING_TEMPLATES_DIR, defaults to `templates` in the sling
+// home directory.
+func TemplatesDir() string {
+	if dir := os.Getenv("SLING_TEMPLATES_DIR"); dir != "" {
+		return dir
+	}
+	return path.Join(env.HomeDir, "templates")
+}
+
 // a cache for templates (so we only read once)
 var typeTemplate = map[Type]Template{}
 
@@ -452,6 +593,22 @@ func (t Type) Template() (template Template, err error) {
 		template.GeneralTypeMap[gt] = rec[t.String()]
 	}
 
+	// user overrides
+	overridePath := path.Join(TemplatesDir(), t.String()+".yaml")
+	if g.PathExists(overridePath) {
+		overrideBytes, err := os.ReadFile(overridePath)
+		if err != nil {
+			return template, g.Error(err, "could not read "+overridePath)
+		}
+
+		overrides := map[string]any{}
+		if err = yaml.Unmarshal(overrideBytes, &overrides); err != nil {
+			return template, g.Error(err, "could not unmarshal "+overridePath)
+		} else if err = template.Override(overrides); err != nil {
+			return template, g.Error(err, "invalid template overrides in "+overridePath)
+		}
+	}
+
 	// cache
 	typeTemplate[t] = template
 
@@ -467,6 +624,11 @@ func (t Type) Unquote(field string) string {
 
 // Quote adds quotes to the field name
 func (t Type) Quote(field string, normalize ...bool) string {
+	return t.QuoteWith("", field, normalize...)
+}
+
+// QuoteWith adds quotes to the field name, per the quoting policy
+func (t Type) QuoteWith(quoting IdentifierQuoting, field string, normalize ...bool) string {
 	Normalize := true
 	if len(normalize) > 0 {
 		Normalize = normalize[0]
@@ -483,9 +645,57 @@ func (t Type) Quote(field string, normalize ...bool) string {
 	}
 	q := template.Variable["quote_char"]
 	field = t.Unquote(field)
+	if !t.QuoteNeeded(field, quoting) {
+		return field
+	}
 	return q + field + q
 }
 
+// IdentifierQuoting is the quoting policy of the identifiers in the
+// generated SQL
+type IdentifierQuoting string
+
+const (
+	IdentifierQuotingAlways   IdentifierQuoting = "always"    // quotes all the identifiers. The default.
+	IdentifierQuotingNever    IdentifierQuoting = "never"     // never quotes the identifiers
+	IdentifierQuotingAsNeeded IdentifierQuoting = "as-needed" // quotes the reserved words, and the identifiers which are not plain words in the casing of the database
+)
+
+// Validate checks the quoting policy value
+func (iq IdentifierQuoting) Validate() error {
+	switch IdentifierQuoting(strings.ToLower(string(iq))) {
+	case "", IdentifierQuotingAlways, IdentifierQuotingNever, IdentifierQuotingAsNeeded:
+		return nil
+	}
+	return g.Error("invalid identifier_quoting value (%s). Expected always, never or as-needed", iq)
+}
+
+var plainIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// OrDefault returns the quoting policy if set, else the one of the
+// SLING_IDENTIFIER_QUOTING env var, else always.
+func (iq IdentifierQuoting) OrDefault() IdentifierQuoting {
+	if iq != "" {
+		return IdentifierQuoting(strings.ToLower(string(iq)))
+	} else if val := os.Getenv("SLING_IDENTIFIER_QUOTING"); val != "" {
+		return IdentifierQuoting(strings.ToLower(val))
+	}
+	return IdentifierQuotingAlways
+}
+
+// QuoteNeeded returns true if the identifier is to be quoted, per the
+// quoting policy (the default one if blank)
+func (t Type) QuoteNeeded(name string, quoting IdentifierQuoting) bool {
+	switch quoting.OrDefault() {
+	case IdentifierQuotingNever:
+		return false
+	case IdentifierQuotingAsNeeded:
+		normalized := lo.Ternary(t.DBNameUpperCase(), strings.ToUpper(name), strings.ToLower(name))
+		return name != normalized || !plainIdentifier.MatchString(name) || t.IsReservedWord(name)
+	}
+	return true
+}
+
 func (t Type) QuoteNames(names ...string) (newNames []string) {
 	newNames = make([]string, len(names))
 	for i := range names {
@@ -11,6 +11,7 @@ import (
 	"runtime"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -90,8 +91,8 @@ func NewFileSysClientContext(ctx context.Context, fst dbio.Type, props ...string
 		concurrencyLimit = 1 // can only write 1 file at a time
 	case dbio.TypeFileSftp:
 		fsClient = &SftpFileSysClient{}
-	// case HDFSFileSys:
-	// 	fsClient = fsClient
+	case dbio.TypeFileHDFS:
+		fsClient = &HDFSFileSysClient{}
 	case dbio.TypeFileAzure:
 		fsClient = &AzureFileSysClient{}
 	case dbio.TypeFileGoogle:
@@ -155,6 +156,9 @@ func NewFileSysClientFromURLContext(ctx context.Context, url string, props ...st
 	case strings.HasPrefix(url, "sftp://"):
 		props = append(props, "URL="+url)
 		return NewFileSysClientContext(ctx, dbio.TypeFileSftp, props...)
+	case strings.HasPrefix(url, "hdfs://"):
+		props = append(props, "URL="+url)
+		return NewFileSysClientContext(ctx, dbio.TypeFileHDFS, props...)
 	case strings.HasPrefix(url, "gs://"):
 		props = append(props, "URL="+url)
 		return NewFileSysClientContext(ctx, dbio.TypeFileGoogle, props...)
@@ -211,7 +215,7 @@ func NormalizeURI(fs FileSysClient, uri string) string {
 		uri = strings.ReplaceAll(uri, `\`, `/`)
 
 		return fs.Prefix("") + strings.TrimPrefix(uri, fs.Prefix())
-	case dbio.TypeFileSftp:
+	case dbio.TypeFileSftp, dbio.TypeFileHDFS:
 		path := strings.TrimPrefix(uri, fs.FsType().String()+"://")
 		u, err := net.NewURL(uri)
 		if strings.Contains(uri, "://") && err == nil {
@@ -434,6 +438,21 @@ func (fs *BaseFileSysClient) GetRefTs() time.Time {
 	return ts
 }
 
+// NewEncryptor returns the client-side encryptor from the `encryption`
+// properties, or nil if files are not encrypted
+func NewEncryptor(fs FileSysClient) (iop.Encryptor, error) {
+	return iop.NewEncryptor(iop.EncryptionConfigFromProps(func(key string) string { return fs.GetProp(key) }))
+}
+
+// DecryptReader decrypts the reader if files are encrypted
+func DecryptReader(fs FileSysClient, reader io.Reader) (io.Reader, error) {
+	encryptor, err := NewEncryptor(fs)
+	if err != nil || encryptor == nil {
+		return reader, err
+	}
+	return encryptor.Decrypt(reader)
+}
+
 // GetDatastream return a datastream for the given path
 func (fs *BaseFileSysClient) GetDatastream(uri string, cfg ...iop.FileStreamConfig) (ds *iop.Datastream, err error) {
 	Cfg := iop.FileStreamConfig{} // infinite
@@ -445,7 +464,9 @@ func (fs *BaseFileSysClient) GetDatastream(uri string, cfg ...iop.FileStreamConf
 	ds.SafeInference = true
 	ds.SetMetadata(fs.GetProp("METADATA"))
 	ds.Metadata.StreamURL.Value = uri
-	ds.SetConfig(fs.Props())
+	if err = ds.SetConfig(fs.Props()); err != nil {
+		return nil, err
+	}
 
 	if Cfg.Format == dbio.FileTypeNone {
 		Cfg.Format = InferFileFormat(uri)
@@ -492,6 +513,11 @@ func (fs *BaseFileSysClient) GetDatastream(uri string, cfg ...iop.FileStreamConf
 			return
 		}
 
+		if reader, err = DecryptReader(fs.Self(), reader); err != nil {
+			ds.Context.CaptureErr(g.Error(err, "error decrypting %s", uri))
+			return
+		}
+
 		// Wait for reader to start reading or err
 		for {
 			// Try peeking
@@ -614,7 +640,7 @@ func (fs *BaseFileSysClient) ReadDataflow(url string, cfg ...iop.FileStreamConfi
 		Cfg.Format = nodes.InferFormat()
 	}
 
-	if g.In(Cfg.Format, dbio.FileTypeParquet) && Cfg.ComputeWithDuckDB() {
+	if g.In(Cfg.Format, dbio.FileTypeParquet) && Cfg.ComputeWithDuckDB() && fs.GetProp("encryption") == "" {
 		// if g.In(fs.FsType(), dbio.TypeFileLocal, dbio.TypeFileS3, dbio.TypeFileAzure) {
 		// azure read gives issues...
 		if g.In(fs.FsType(), dbio.TypeFileLocal, dbio.TypeFileS3) {
@@ -736,6 +762,125 @@ func WriteDataflow(fs FileSysClient, df *iop.Dataflow, url string) (bw int64, er
 	return fs.Self().WriteDataflowReady(df, url, fileReadyChn, sp.Config)
 }
 
+// WriteDataflowPartitioned writes a dataflow to a file sys, partitioned by the
+// time value of the key column, with Hive-style folders replacing the partition
+// fields of the url (e.g. `{part_year}` with `created_at_year=2024`).
+// Each partition is written as a separate dataflow.
+func WriteDataflowPartitioned(fs FileSysClient, df *iop.Dataflow, url, key string) (bw int64, err error) {
+	if len(iop.ExtractPartitionFields(url)) == 0 {
+		return WriteDataflow(fs, df, url)
+	}
+
+	// the partition fields are folders, if no file name is provided
+	parts := strings.Split(strings.TrimSuffix(url, "/"), "/")
+	if strings.Contains(parts[len(parts)-1], "{part_") {
+		url = strings.TrimSuffix(url, "/") + "/*"
+	}
+
+	ds := iop.MergeDataflow(df)
+	keyCol := ds.Columns.GetColumn(key)
+	if keyCol == nil {
+		return 0, g.Error("did not find partition key column: %s", key)
+	}
+	keyI := keyCol.Position - 1
+
+	type partition struct {
+		rows chan []any
+		ds   *iop.Datastream
+	}
+
+	var mux sync.Mutex
+	partitions := map[string]*partition{}
+	wg := sync.WaitGroup{}
+
+	newPartition := func(partURL string) *partition {
+		rows := iop.MakeRowsChan()
+		nextFunc := func(it *iop.Iterator) bool {
+			for it.Row = range rows {
+				return true
+			}
+			return false
+		}
+
+		p := &partition{rows: rows, ds: iop.NewDatastreamIt(df.Context.Ctx, ds.Columns, nextFunc)}
+		p.ds.Inferred = true
+		p.ds.Sp.Config = ds.Sp.Config
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := p.ds.Start()
+			if err != nil {
+				df.Context.CaptureErr(g.Error(err, "could not start partition stream"))
+				for range rows {
+				} // drain
+				return
+			}
+
+			pDf, err := iop.MakeDataFlow(p.ds)
+			if err != nil {
+				df.Context.CaptureErr(g.Error(err, "could not make partition dataflow"))
+				for range rows {
+				} // drain
+				return
+			}
+
+			g.Debug("writing partition %s", partURL)
+			pBw, err := WriteDataflow(fs, pDf, partURL)
+			if err != nil {
+				df.Context.CaptureErr(g.Error(err, "could not write partition %s", partURL))
+			}
+
+			mux.Lock()
+			bw += pBw
+			mux.Unlock()
+		}()
+
+		return p
+	}
+
+	rowsCh := ds.Rows()
+	for row := range rowsCh {
+		var value *time.Time
+		if t, err := ds.Sp.CastToTime(row[keyI]); err == nil && !t.IsZero() {
+			value = &t
+		} else if row[keyI] != nil {
+			df.Context.CaptureErr(g.Error(err, "could not parse partition key value: %v", row[keyI]))
+			break
+		}
+
+		partURL := iop.FormatPartitionPath(url, keyCol.Name, value)
+		p, ok := partitions[partURL]
+		if !ok {
+			p = newPartition(partURL)
+			partitions[partURL] = p
+		}
+
+		select {
+		case <-df.Context.Ctx.Done():
+		case p.rows <- row:
+			continue
+		}
+		break
+	}
+
+	for _, p := range partitions {
+		close(p.rows)
+	}
+	go func() {
+		for range rowsCh {
+		} // drain, if stopped early
+	}()
+	wg.Wait()
+
+	if err = df.Err(); err != nil {
+		return bw, g.Error(err)
+	}
+
+	return bw, nil
+}
+
 // GetReaders returns one or more readers from specified paths in specified FileSysClient
 func (fs *BaseFileSysClient) GetReaders(paths ...string) (readers []io.Reader, err error) {
 	if len(paths) == 0 {
@@ -773,7 +918,10 @@ func (fs *BaseFileSysClient) WriteDataflowReady(df *iop.Dataflow, url string, fi
 
 	// use provided config or get from dataflow
 	if val := fs.GetProp("COMPRESSION"); val != "" && sc.Compression == iop.NoneCompressorType {
-		sc.Compression = iop.CompressorType(strings.ToLower(val))
+		sc.Compression = *iop.CompressorType(val).Normalize()
+	}
+	if val := fs.GetProp("COMPRESSION_LEVEL"); val != "" && sc.CompressionLevel == 0 {
+		sc.CompressionLevel = cast.ToInt(val)
 	}
 	if val := fs.GetProp("FILE_MAX_ROWS"); val != "" && sc.FileMaxRows == 0 {
 		sc.FileMaxRows = cast.ToInt64(val)
@@ -814,8 +962,27 @@ func (fs *BaseFileSysClient) WriteDataflowReady(df *iop.Dataflow, url string, fi
 		url = strings.TrimSuffix(url, "/"+lastPart)
 	}
 
+	// templated output path, with a file per part number
+	var layout *OutputLayout
+	if IsTemplatedPath(url) {
+		singleFile = false
+		sc.FileMaxRows = lo.Ternary(sc.FileMaxRows == 0, 100000, sc.FileMaxRows)
+		sc.FileMaxBytes = lo.Ternary(sc.FileMaxBytes == 0, 50000000, sc.FileMaxBytes)
+		layout = NewOutputLayout(
+			url,
+			cast.ToInt(fs.GetProp("PART_NUMBER_PADDING")),
+			cast.ToInt(fs.GetProp("FOLDER_MAX_FILES")),
+		)
+	}
+
+	// client-side encryption
+	encryptor, err := NewEncryptor(fsClient)
+	if err != nil {
+		return 0, g.Error(err, "could not initialize encryption")
+	}
+
 	// adjust fileBytesLimit due to compression
-	if g.In(iop.CompressorType(sc.Compression), iop.GzipCompressorType, iop.ZStandardCompressorType, iop.SnappyCompressorType) {
+	if g.In(iop.CompressorType(sc.Compression), iop.GzipCompressorType, iop.ZStandardCompressorType, iop.SnappyCompressorType, iop.Bzip2CompressorType, iop.Lz4CompressorType) {
 		sc.FileMaxBytes = sc.FileMaxBytes * 6 // compressed, multiply
 	}
 
@@ -850,12 +1017,21 @@ func (fs *BaseFileSysClient) WriteDataflowReady(df *iop.Dataflow, url string, fi
 			fileCount++
 			fileSuffix := lo.Ternary(fileExt == "", fileFormat.Ext(), fileExt)
 			subPartURL := fmt.Sprintf("%s.%04d%s", partURL, fileCount, fileSuffix)
-			if singleFile {
+			switch {
+			case singleFile:
 				subPartURL = partURL
+			case layout != nil:
+				subPartURL = layout.Next()
+			}
+
+			// file name is provided, compression may be in the extension
+			if singleFile || layout != nil {
 				for _, comp := range []iop.CompressorType{
 					iop.GzipCompressorType,
 					iop.SnappyCompressorType,
 					iop.ZStandardCompressorType,
+					iop.Bzip2CompressorType,
+					iop.Lz4CompressorType,
 				} {
 					compressor := iop.NewCompressor(comp)
 					if strings.HasSuffix(subPartURL, compressor.Suffix()) {
@@ -866,15 +1042,33 @@ func (fs *BaseFileSysClient) WriteDataflowReady(df *iop.Dataflow, url string, fi
 				}
 			}
 
-			compressor := iop.NewCompressor(sc.Compression)
+			compressor := iop.NewCompressorLevel(sc.Compression, sc.CompressionLevel)
 			if fileFormat == dbio.FileTypeParquet {
 				compressor = iop.NewCompressor("none") // compression is done internally
 			} else {
 				subPartURL = subPartURL + compressor.Suffix()
 			}
 
+			reader := batchR.Reader
+			if g.In(fileFormat, dbio.FileTypeCsv, dbio.FileTypeJson, dbio.FileTypeJsonLines) {
+				// convert to the target encoding
+				encReader, err := sc.EncodeReader(reader)
+				if err != nil {
+					return g.Error(err, "could not encode file")
+				}
+				reader = encReader
+			}
+
+			reader = compressor.Compress(reader)
+			if encryptor != nil {
+				reader = encryptor.Encrypt(reader)
+				if !singleFile && layout == nil {
+					subPartURL = subPartURL + encryptor.Suffix()
+				}
+			}
+
 			g.Trace("writing stream to " + subPartURL)
-			go writePart(compressor.Compress(batchR.Reader), batchR, subPartURL)
+			go writePart(reader, batchR, subPartURL)
 			localCtx.Wg.Read.Add()
 			// localCtx.MemBasedLimit(98) // wait until memory is lower than 90%
 
@@ -940,13 +1134,17 @@ func (fs *BaseFileSysClient) WriteDataflowReady(df *iop.Dataflow, url string, fi
 		localCtx.Wg.Read.Wait()
 	}
 
-	err = Delete(fsClient, url)
-	if err != nil {
-		err = g.Error(err, "Could not delete url")
-		return
+	// templated paths are not deleted beforehand, files with the same
+	// path are overwritten. Folders are created when writing
+	if layout == nil {
+		err = Delete(fsClient, url)
+		if err != nil {
+			err = g.Error(err, "Could not delete url")
+			return
+		}
 	}
 
-	if !singleFile && g.In(fsClient.FsType(), dbio.TypeFileLocal, dbio.TypeFileSftp, dbio.TypeFileFtp) {
+	if !singleFile && layout == nil && g.In(fsClient.FsType(), dbio.TypeFileLocal, dbio.TypeFileSftp, dbio.TypeFileFtp) {
 		path, err := fsClient.GetPath(url)
 		if err != nil {
 			return 0, g.Error(err, "Error Parsing url: "+url)
@@ -1030,7 +1228,7 @@ func Delete(fs FileSysClient, uri string) (err error) {
 		if len(host) == 0 && len(p) == 0 {
 			return g.Error("invalid uri / path for overwriting (root): %s", uri)
 		}
-	case dbio.TypeFileSftp:
+	case dbio.TypeFileSftp, dbio.TypeFileHDFS:
 		if len(p) == 0 {
 			return g.Error("invalid uri / path for overwriting (root): %s", uri)
 		}
@@ -1069,7 +1267,9 @@ func GetDataflow(fs FileSysClient, nodes FileNodes, cfg iop.FileStreamConfig) (d
 	go func() {
 		defer close(dsCh)
 
-		allowMerging := strings.ToLower(os.Getenv("SLING_MERGE_READERS")) != "false" && !cfg.ShouldUseDuckDB()
+		// read multiple files concurrently (output will not be in order)
+		parallel := cfg.Concurrency > 1 && len(nodes.Files()) > 1
+		allowMerging := strings.ToLower(os.Getenv("SLING_MERGE_READERS")) != "false" && !cfg.ShouldUseDuckDB() && !parallel
 
 		pushDatastream := func(ds *iop.Datastream) {
 			// use selected fields only when not parquet
@@ -1094,6 +1294,16 @@ func GetDataflow(fs FileSysClient, nodes FileNodes, cfg iop.FileStreamConfig) (d
 			}
 		}
 
+		// split a single large local csv / ndjson file into byte ranges, parsed in parallel
+		if path, format, chunks, header, ok := splitNodeChunks(fs, nodes, cfg); ok {
+			uri := nodes.Files()[0].URI
+			g.Debug("reading %s in %d chunks", uri, len(chunks))
+			for _, chunk := range chunks {
+				pushDatastream(getChunkDatastream(fs, uri, path, format, chunk, header))
+			}
+			return // done
+		}
+
 		if allowMerging && (cfg.Format.IsJson() || isFiletype(dbio.FileTypeJson, nodes.URIs()...) || isFiletype(dbio.FileTypeJsonLines, nodes.URIs()...)) {
 			ds, err := MergeReaders(fs, dbio.FileTypeJson, nodes, cfg)
 			if err != nil {
@@ -1127,6 +1337,9 @@ func GetDataflow(fs FileSysClient, nodes FileNodes, cfg iop.FileStreamConfig) (d
 			return // done
 		}
 
+		readCtx := g.NewContext(df.Context.Ctx, lo.Ternary(parallel, cfg.Concurrency, 1))
+		defer readCtx.Wg.Read.Wait()
+
 		for _, node := range nodes {
 			uri := node.URI
 			if strings.HasSuffix(uri, "/") {
@@ -1139,6 +1352,27 @@ func GetDataflow(fs FileSysClient, nodes FileNodes, cfg iop.FileStreamConfig) (d
 				}
 			}
 
+			if parallel {
+				// a slot is held until the file is fully read
+				readCtx.Wg.Read.Add()
+				if df.Err() != nil {
+					readCtx.Wg.Read.Done()
+					return
+				}
+
+				go func(uri string) {
+					ds, err := fs.GetDatastream(uri, cfg)
+					if err != nil {
+						readCtx.Wg.Read.Done()
+						df.Context.CaptureErr(g.Error(err, "Unable to process "+uri))
+						return
+					}
+					ds.Defer(func() { readCtx.Wg.Read.Done() })
+					pushDatastream(ds)
+				}(uri)
+				continue
+			}
+
 			ds, err := fs.GetDatastream(uri, cfg)
 			if err != nil {
 				df.Context.CaptureErr(g.Error(err, "Unable to process "+uri))
@@ -1493,7 +1727,9 @@ func MergeReaders(fs FileSysClient, fileType dbio.FileType, nodes FileNodes, cfg
 	ds.SafeInference = true
 	ds.SetMetadata(fs.GetProp("METADATA"))
 	ds.Metadata.StreamURL.Value = url
-	ds.SetConfig(fs.Client().Props())
+	if err = ds.SetConfig(fs.Client().Props()); err != nil {
+		return nil, err
+	}
 	g.Debug("reading single datastream from %s [format=%s]", url, fileType)
 
 	setError := func(err error) {
@@ -1571,6 +1807,11 @@ func MergeReaders(fs FileSysClient, fileType dbio.FileType, nodes FileNodes, cfg
 					return
 				}
 
+				if reader, err = DecryptReader(fs, reader); err != nil {
+					setError(g.Error(err, "Error decrypting %s", node.URI))
+					return
+				}
+
 				r := &iop.ReaderReady{Reader: reader, URI: node.URI}
 				readerChn <- r
 			}(node)
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
@@ -79,16 +80,47 @@ func (fs *AzureFileSysClient) GetPath(uri string) (path string, err error) {
 	return path, err
 }
 
+// clientOptions returns the client options, with the retry settings
+func (fs *AzureFileSysClient) clientOptions() *azblob.ClientOptions {
+	options := &azblob.ClientOptions{}
+	if uploadOpts, _ := GetUploadOptions(fs); uploadOpts.HasRetries() {
+		options.Retry = policy.RetryOptions{
+			MaxRetries:    int32(uploadOpts.MaxRetries),
+			RetryDelay:    uploadOpts.RetryDelay,
+			MaxRetryDelay: uploadOpts.MaxRetryDelay,
+		}
+	}
+	return options
+}
+
 // Connect initiates the fs client connection
 func (fs *AzureFileSysClient) Connect() (err error) {
+	if _, err = GetUploadOptions(fs); err != nil {
+		return g.Error(err, "invalid upload options")
+	}
+
+	useWorkloadIdentity, err := UseWorkloadIdentity(fs.GetProp("AUTH"))
+	if err != nil {
+		return err
+	}
 
 	serviceURL := g.F("https://%s.blob.core.windows.net/", fs.account)
-	if cs := fs.GetProp("CONN_STR"); cs != "" {
+	if useWorkloadIdentity {
+		cred, err := AzureWorkloadIdentityCredential(fs.GetProp("CLIENT_ID"))
+		if err != nil {
+			return err
+		}
+
+		fs.client, err = azblob.NewClient(serviceURL, cred, fs.clientOptions())
+		if err != nil {
+			return g.Error(err, "Could not connect to Azure using workload identity")
+		}
+	} else if cs := fs.GetProp("CONN_STR"); cs != "" {
 		connProps := g.KVArrToMap(strings.Split(cs, ";")...)
 		fs.account = connProps["AccountName"]
 		fs.key = connProps["AccountKey"]
 
-		fs.client, err = azblob.NewClientFromConnectionString(cs, &azblob.ClientOptions{})
+		fs.client, err = azblob.NewClientFromConnectionString(cs, fs.clientOptions())
 		if err != nil {
 			err = g.Error(err, "Could not connect to Azure using provided CONN_STR")
 			return
@@ -100,7 +132,7 @@ func (fs *AzureFileSysClient) Connect() (err error) {
 			return
 		}
 
-		fs.client, err = azblob.NewClientWithNoCredential(cs, &azblob.ClientOptions{})
+		fs.client, err = azblob.NewClientWithNoCredential(cs, fs.clientOptions())
 		if err != nil {
 			err = g.Error(err, "Could not connect to Azure using provided SAS_SVC_URL")
 			return
@@ -111,7 +143,7 @@ func (fs *AzureFileSysClient) Connect() (err error) {
 			return g.Error(err, "Could not process shared key / account key")
 		}
 
-		fs.client, err = azblob.NewClientWithSharedKeyCredential(serviceURL, cred, &azblob.ClientOptions{})
+		fs.client, err = azblob.NewClientWithSharedKeyCredential(serviceURL, cred, fs.clientOptions())
 		if err != nil {
 			return g.Error(err, "Could not connect to Azure using shared key credentials")
 		}
@@ -121,7 +153,7 @@ func (fs *AzureFileSysClient) Connect() (err error) {
 			return g.Error(err, "No Azure credentials provided")
 		}
 
-		fs.client, err = azblob.NewClient(serviceURL, cred, &azblob.ClientOptions{})
+		fs.client, err = azblob.NewClient(serviceURL, cred, fs.clientOptions())
 		if err != nil {
 			return g.Error(err, "Could not connect to Azure using default credentials")
 		}
@@ -304,9 +336,30 @@ func (fs *AzureFileSysClient) Write(uri string, reader io.Reader) (bw int64, err
 		return
 	}
 
+	uploadOpts, err := GetUploadOptions(fs)
+	if err != nil {
+		return 0, g.Error(err, "invalid upload options")
+	}
+
+	options := &blockblob.UploadStreamOptions{
+		BlockSize:   uploadOpts.PartSize,
+		Concurrency: uploadOpts.Concurrency,
+	}
+	if uploadOpts.Checksum {
+		// each block is validated by the service
+		options.TransactionalValidation = blob.TransferValidationTypeComputeCRC64()
+	}
+
+	tiers := lo.Map(blob.PossibleAccessTierValues(), func(t blob.AccessTier, i int) string { return string(t) })
+	if tier, err := GetStorageClass(fs, tiers); err != nil {
+		return 0, err
+	} else if tier != "" {
+		options.AccessTier = lo.ToPtr(blob.AccessTier(tier))
+	}
+
 	countingReader := io.TeeReader(reader, &azureWriteCounter{&bw})
 
-	_, err = fs.client.UploadStream(fs.Context().Ctx, fs.container, path, countingReader, &blockblob.UploadStreamOptions{})
+	_, err = fs.client.UploadStream(fs.Context().Ctx, fs.container, path, countingReader, options)
 	if err != nil {
 		err = g.Error(err, "Error UploadStream: "+uri)
 		return
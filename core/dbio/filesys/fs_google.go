@@ -2,12 +2,14 @@ package filesys
 
 import (
 	"context"
+	"hash/crc32"
 	"io"
 	"os"
 	"strings"
 
 	gcstorage "cloud.google.com/go/storage"
 	"github.com/flarco/g"
+	"github.com/googleapis/gax-go/v2"
 	"github.com/samber/lo"
 	"github.com/spf13/cast"
 	"golang.org/x/oauth2/google"
@@ -70,7 +72,17 @@ func (fs *GoogleFileSysClient) Connect() (err error) {
 	var authOption option.ClientOption
 	var credJsonBody string
 
-	if val := fs.GetProp("KEY_BODY"); val != "" {
+	useWorkloadIdentity, err := UseWorkloadIdentity(fs.GetProp("AUTH"))
+	if err != nil {
+		return err
+	}
+
+	if useWorkloadIdentity {
+		authOption, fs.projectID, err = GoogleWorkloadIdentityOption()
+		if err != nil {
+			return err
+		}
+	} else if val := fs.GetProp("KEY_BODY"); val != "" {
 		credJsonBody = val
 		authOption = option.WithCredentialsJSON([]byte(val))
 	} else if val := fs.GetProp("KEY_FILE"); val != "" {
@@ -119,8 +131,40 @@ func (fs *GoogleFileSysClient) Write(path string, reader io.Reader) (bw int64, e
 		return
 	}
 
+	uploadOpts, err := GetUploadOptions(fs)
+	if err != nil {
+		return 0, g.Error(err, "invalid upload options")
+	}
+
 	obj := fs.client.Bucket(fs.bucket).Object(key)
+	if uploadOpts.HasRetries() {
+		// chunks are retried with backoff, even if not idempotent
+		backoff := gax.Backoff{Initial: uploadOpts.RetryDelay, Max: uploadOpts.MaxRetryDelay, Multiplier: 2}
+		retryOpts := []gcstorage.RetryOption{gcstorage.WithBackoff(backoff), gcstorage.WithPolicy(gcstorage.RetryAlways)}
+		if uploadOpts.MaxRetries > 0 {
+			retryOpts = append(retryOpts, gcstorage.WithMaxAttempts(uploadOpts.MaxRetries+1))
+		}
+		obj = obj.Retryer(retryOpts...)
+	}
+
+	storageClass, err := GetStorageClass(fs, gcsStorageClasses)
+	if err != nil {
+		return 0, err
+	}
+
 	wc := obj.NewWriter(fs.Context().Ctx)
+	wc.StorageClass = storageClass
+	wc.KMSKeyName = fs.GetProp("kms_key_id") // customer-managed encryption key
+	if uploadOpts.PartSize > 0 {
+		wc.ChunkSize = int(uploadOpts.PartSize)
+	}
+
+	// compute the CRC32C while streaming, to compare with the object's
+	hash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	if uploadOpts.Checksum {
+		reader = io.TeeReader(reader, hash)
+	}
+
 	bw, err = io.Copy(wc, reader)
 	if err != nil {
 		err = g.Error(err, "Error Copying")
@@ -131,9 +175,19 @@ func (fs *GoogleFileSysClient) Write(path string, reader io.Reader) (bw int64, e
 		err = g.Error(err, "Error Closing writer")
 		return
 	}
+
+	if uploadOpts.Checksum {
+		if attrs := wc.Attrs(); attrs != nil && attrs.CRC32C != hash.Sum32() {
+			obj.Delete(fs.Context().Ctx) // corrupted, do not leave it
+			return bw, g.Error("checksum mismatch for uploaded object %s (crc32c %d != %d)", key, attrs.CRC32C, hash.Sum32())
+		}
+	}
 	return
 }
 
+// gcsStorageClasses are the storage classes of GCS objects
+var gcsStorageClasses = []string{"STANDARD", "NEARLINE", "COLDLINE", "ARCHIVE", "MULTI_REGIONAL", "REGIONAL", "DURABLE_REDUCED_AVAILABILITY"}
+
 // GetReader returns the reader for the given path
 func (fs *GoogleFileSysClient) GetReader(path string) (reader io.Reader, err error) {
 	key, err := fs.GetPath(path)
@@ -0,0 +1,531 @@
+package filesys
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+// HDFSFileSysClient is for HDFS file ops, via the WebHDFS REST API
+// of the namenode (or an HttpFS gateway). The native RPC protocol is
+// not supported: `hdfs://host:port` must point to the HTTP port of the
+// namenode (9870 by default) or of the HttpFS server (14000).
+type HDFSFileSysClient struct {
+	BaseFileSysClient
+	client    *http.Client
+	krbClient *client.Client
+	baseURL   *url.URL
+}
+
+// hdfsFileStatus is the FileStatus object of the WebHDFS API
+type hdfsFileStatus struct {
+	PathSuffix       string `json:"pathSuffix"`
+	Type             string `json:"type"`
+	Length           int64  `json:"length"`
+	ModificationTime int64  `json:"modificationTime"`
+}
+
+// hdfsRemoteException is the error object of the WebHDFS API
+type hdfsRemoteException struct {
+	RemoteException struct {
+		Exception string `json:"exception"`
+		Message   string `json:"message"`
+	} `json:"RemoteException"`
+}
+
+// Init initializes the fs client
+func (fs *HDFSFileSysClient) Init(ctx context.Context) (err error) {
+	instance := FileSysClient(fs)
+	fs.BaseFileSysClient.instance = &instance
+	fs.BaseFileSysClient.context = g.NewContext(ctx)
+
+	for _, key := range g.ArrStr("HOST", "PORT", "USER", "KEYTAB", "PRINCIPAL", "REALM", "KRB5_CONF", "KRB5_CCACHE") {
+		if fs.GetProp(key) == "" {
+			fs.SetProp(key, fs.GetProp("HDFS_"+key))
+		}
+	}
+
+	return fs.Connect()
+}
+
+// Prefix returns the url prefix
+func (fs *HDFSFileSysClient) Prefix(suffix ...string) string {
+	return g.F("%s://%s:%s", fs.FsType().String(), fs.GetProp("host"), fs.GetProp("port")) + strings.Join(suffix, "")
+}
+
+// GetPath returns the path of url
+func (fs *HDFSFileSysClient) GetPath(uri string) (path string, err error) {
+	// normalize, in case url is provided without prefix
+	uri = NormalizeURI(fs, uri)
+
+	_, path, err = ParseURL(uri)
+	if err != nil {
+		return
+	}
+
+	return path, err
+}
+
+// Connect initiates the WebHDFS client, authenticating with
+// Kerberos (SPNEGO) when a keytab, password or credentials cache is provided
+func (fs *HDFSFileSysClient) Connect() (err error) {
+	if fs.GetProp("URL") != "" {
+		u, err := url.Parse(fs.GetProp("URL"))
+		if err != nil {
+			return g.Error(err, "could not parse HDFS URL")
+		}
+
+		if user := u.User.Username(); user != "" && fs.GetProp("USER") == "" {
+			fs.SetProp("USER", user)
+		}
+		if host := u.Hostname(); host != "" {
+			fs.SetProp("HOST", host)
+		}
+		if port := u.Port(); port != "" {
+			fs.SetProp("PORT", port)
+		}
+	}
+
+	if fs.GetProp("HOST") == "" {
+		return g.Error("did not provide HDFS host")
+	} else if fs.GetProp("PORT") == "" {
+		fs.SetProp("PORT", cast.ToString(fs.FsType().DefPort()))
+	}
+
+	scheme := lo.Ternary(cast.ToBool(fs.GetProp("SSL")), "https", "http")
+	fs.baseURL = &url.URL{
+		Scheme: scheme,
+		Host:   fs.GetProp("HOST") + ":" + fs.GetProp("PORT"),
+		Path:   "/webhdfs/v1",
+	}
+
+	// redirects to the datanodes are handled in doRequest
+	fs.client = &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	if fs.GetProp("KEYTAB") != "" || fs.GetProp("KRB5_CCACHE") != "" || (fs.GetProp("PRINCIPAL") != "" && fs.GetProp("PASSWORD") != "") {
+		if err = fs.connectKerberos(); err != nil {
+			return g.Error(err, "could not authenticate with kerberos")
+		}
+	}
+
+	return nil
+}
+
+// connectKerberos logs in to the KDC, with the keytab, the password
+// or the credentials cache of the principal
+func (fs *HDFSFileSysClient) connectKerberos() (err error) {
+	krb5Conf := fs.GetProp("KRB5_CONF")
+	if krb5Conf == "" {
+		krb5Conf = lo.Ternary(os.Getenv("KRB5_CONFIG") != "", os.Getenv("KRB5_CONFIG"), "/etc/krb5.conf")
+	}
+
+	krbConfig, err := config.Load(krb5Conf)
+	if err != nil {
+		return g.Error(err, "could not load krb5 config: %s", krb5Conf)
+	}
+
+	// principal as `user@REALM`
+	user, realm, _ := strings.Cut(fs.GetProp("PRINCIPAL"), "@")
+	if fs.GetProp("REALM") != "" {
+		realm = fs.GetProp("REALM")
+	} else if realm == "" {
+		realm = krbConfig.LibDefaults.DefaultRealm
+	}
+
+	switch {
+	case fs.GetProp("KEYTAB") != "":
+		kt, err := keytab.Load(fs.GetProp("KEYTAB"))
+		if err != nil {
+			return g.Error(err, "could not load keytab: %s", fs.GetProp("KEYTAB"))
+		}
+		fs.krbClient = client.NewWithKeytab(user, realm, kt, krbConfig, client.DisablePAFXFAST(true))
+	case fs.GetProp("KRB5_CCACHE") != "":
+		ccache, err := credentials.LoadCCache(fs.GetProp("KRB5_CCACHE"))
+		if err != nil {
+			return g.Error(err, "could not load credentials cache: %s", fs.GetProp("KRB5_CCACHE"))
+		}
+		fs.krbClient, err = client.NewFromCCache(ccache, krbConfig, client.DisablePAFXFAST(true))
+		if err != nil {
+			return g.Error(err, "could not create kerberos client from credentials cache")
+		}
+		return nil
+	default:
+		fs.krbClient = client.NewWithPassword(user, realm, fs.GetProp("PASSWORD"), krbConfig, client.DisablePAFXFAST(true))
+	}
+
+	return fs.krbClient.Login()
+}
+
+// Close closes the client
+func (fs *HDFSFileSysClient) Close() error {
+	if fs.krbClient != nil {
+		fs.krbClient.Destroy()
+	}
+	return nil
+}
+
+// makeURL returns the WebHDFS url of the operation on the path
+func (fs *HDFSFileSysClient) makeURL(op, path string, params map[string]string) string {
+	u := *fs.baseURL
+	u.Path = u.Path + "/" + strings.TrimPrefix(path, "/")
+
+	query := url.Values{}
+	query.Set("op", op)
+	if token := fs.GetProp("DELEGATION_TOKEN"); token != "" {
+		query.Set("delegation", token)
+	} else if user := fs.GetProp("USER"); user != "" && fs.krbClient == nil {
+		query.Set("user.name", user)
+	}
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// doRequest submits the request to the namenode, and follows the redirect
+// to the datanode holding the data (for OPEN and CREATE operations)
+func (fs *HDFSFileSysClient) doRequest(method, op, path string, params map[string]string, body io.Reader) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(fs.Context().Ctx, method, fs.makeURL(op, path, params), nil)
+	if err != nil {
+		return nil, g.Error(err, "could not create request")
+	}
+
+	if err = fs.authenticate(req); err != nil {
+		return nil, err
+	}
+
+	resp, err = fs.client.Do(req)
+	if err != nil {
+		return nil, g.Error(err, "could not submit request %s %s", op, path)
+	}
+
+	if g.In(resp.StatusCode, http.StatusTemporaryRedirect, http.StatusFound, http.StatusSeeOther) {
+		location := resp.Header.Get("Location")
+		resp.Body.Close()
+
+		if body == nil {
+			body = http.NoBody
+		}
+		req, err = http.NewRequestWithContext(fs.Context().Ctx, method, location, body)
+		if err != nil {
+			return nil, g.Error(err, "could not create request for %s", location)
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+
+		// datanodes accept the delegation token of the location,
+		// HttpFS redirects to itself and requires authentication
+		if strings.HasPrefix(location, "/") || req.URL.Host == fs.baseURL.Host {
+			req.URL.Scheme, req.URL.Host = fs.baseURL.Scheme, fs.baseURL.Host
+			if err = fs.authenticate(req); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err = fs.client.Do(req)
+		if err != nil {
+			return nil, g.Error(err, "could not submit request %s %s", op, path)
+		}
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		respBytes, _ := io.ReadAll(resp.Body)
+
+		var remoteErr hdfsRemoteException
+		if json.Unmarshal(respBytes, &remoteErr) == nil && remoteErr.RemoteException.Exception != "" {
+			return resp, g.Error("%s: %s", remoteErr.RemoteException.Exception, remoteErr.RemoteException.Message)
+		}
+		return resp, g.Error("unexpected response for %s %s (%s): %s", op, path, resp.Status, string(respBytes))
+	}
+
+	return resp, nil
+}
+
+// authenticate sets the SPNEGO header when using kerberos
+func (fs *HDFSFileSysClient) authenticate(req *http.Request) (err error) {
+	if fs.krbClient == nil {
+		return nil
+	}
+
+	// service principal is HTTP/<namenode host> by default
+	if err = spnego.SetSPNEGOHeader(fs.krbClient, req, fs.GetProp("SPN")); err != nil {
+		return g.Error(err, "could not set SPNEGO header")
+	}
+	return nil
+}
+
+// getStatus returns the file status of the path, or nil if not found
+func (fs *HDFSFileSysClient) getStatus(path string) (status *hdfsFileStatus, err error) {
+	resp, err := fs.doRequest(http.MethodGet, "GETFILESTATUS", path, nil, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		FileStatus hdfsFileStatus `json:"FileStatus"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, g.Error(err, "could not decode file status")
+	}
+
+	return &result.FileStatus, nil
+}
+
+// listStatus returns the file statuses of the directory children
+func (fs *HDFSFileSysClient) listStatus(path string) (statuses []hdfsFileStatus, err error) {
+	resp, err := fs.doRequest(http.MethodGet, "LISTSTATUS", path, nil, nil)
+	if err != nil {
+		return nil, g.Error(err, "error listing path: %#v", path)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		FileStatuses struct {
+			FileStatus []hdfsFileStatus `json:"FileStatus"`
+		} `json:"FileStatuses"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, g.Error(err, "could not decode file statuses")
+	}
+
+	return result.FileStatuses.FileStatus, nil
+}
+
+func (fs *HDFSFileSysClient) makeNode(path string, status hdfsFileStatus) FileNode {
+	if status.PathSuffix != "" {
+		path = strings.TrimSuffix(path, "/") + "/" + status.PathSuffix
+	}
+	return FileNode{
+		URI:     g.F("%s%s", fs.Prefix("/"), strings.TrimPrefix(path, "/")),
+		Updated: status.ModificationTime / 1000,
+		Size:    cast.ToUint64(status.Length),
+		IsDir:   status.Type == "DIRECTORY",
+	}
+}
+
+// List list objects in path
+func (fs *HDFSFileSysClient) List(uri string) (nodes FileNodes, err error) {
+	path, err := fs.GetPath(uri)
+	if err != nil {
+		err = g.Error(err, "Error Parsing url: "+uri)
+		return
+	}
+
+	pattern, err := makeGlob(NormalizeURI(fs, uri))
+	if err != nil {
+		err = g.Error(err, "Error Parsing url pattern: "+uri)
+		return
+	}
+
+	if pattern == nil {
+		status, err := fs.getStatus(strings.TrimSuffix(path, "/"))
+		if err != nil {
+			return nodes, g.Error(err, "error getting status of path: %#v", path)
+		} else if status == nil {
+			return nodes, nil
+		} else if status.Type != "DIRECTORY" || !strings.HasSuffix(path, "/") {
+			nodes.Add(fs.makeNode(path, *status))
+			return nodes, nil
+		}
+	} else {
+		path = GetDeepestParent(path)
+	}
+
+	statuses, err := fs.listStatus(path)
+	if err != nil {
+		return
+	}
+
+	for _, status := range statuses {
+		nodes.AddWhere(pattern, 0, fs.makeNode(path, status))
+	}
+
+	return
+}
+
+// ListRecursive list objects in path recursively
+func (fs *HDFSFileSysClient) ListRecursive(uri string) (nodes FileNodes, err error) {
+	path, err := fs.GetPath(uri)
+	if err != nil {
+		err = g.Error(err, "Error Parsing url: "+uri)
+		return
+	}
+
+	pattern, err := makeGlob(NormalizeURI(fs, uri))
+	if err != nil {
+		err = g.Error(err, "Error Parsing url pattern: "+uri)
+		return
+	}
+
+	if pattern != nil {
+		path = GetDeepestParent(path)
+	} else {
+		status, err := fs.getStatus(strings.TrimSuffix(path, "/"))
+		if err != nil {
+			return nodes, g.Error(err, "error getting status of path: %#v", path)
+		} else if status == nil {
+			return nodes, nil
+		} else if status.Type != "DIRECTORY" {
+			nodes.Add(fs.makeNode(path, *status))
+			return nodes, nil
+		}
+	}
+
+	ts := fs.GetRefTs().Unix()
+
+	statuses, err := fs.listStatus(path)
+	if err != nil {
+		return
+	}
+
+	for _, status := range statuses {
+		node := fs.makeNode(path, status)
+		if node.IsDir {
+			subNodes, err := fs.ListRecursive(node.URI + "/")
+			if err != nil {
+				return nil, g.Error(err, "error listing sub path")
+			}
+			nodes.AddWhere(pattern, ts, subNodes...)
+		} else {
+			nodes.AddWhere(pattern, ts, node)
+		}
+	}
+
+	return
+}
+
+// Delete deletes the path recursively
+func (fs *HDFSFileSysClient) delete(uri string) (err error) {
+	path, err := fs.GetPath(uri)
+	if err != nil {
+		err = g.Error(err, "Error Parsing url: "+uri)
+		return
+	}
+
+	resp, err := fs.doRequest(http.MethodDelete, "DELETE", path, map[string]string{"recursive": "true"}, nil)
+	if err != nil {
+		return g.Error(err, "error deleting path "+uri)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// MkdirAll creates child directories
+func (fs *HDFSFileSysClient) MkdirAll(path string) (err error) {
+	resp, err := fs.doRequest(http.MethodPut, "MKDIRS", path, nil, nil)
+	if err != nil {
+		return g.Error(err, "Unable to create directory "+path)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (fs *HDFSFileSysClient) Write(urlStr string, reader io.Reader) (bw int64, err error) {
+	path, err := fs.GetPath(urlStr)
+	if err != nil {
+		err = g.Error(err, "Error Parsing url: "+urlStr)
+		return
+	}
+	// manage concurrency
+	defer fs.Context().Wg.Write.Done()
+	fs.Context().Wg.Write.Add()
+
+	// count the bytes sent
+	counter := &hdfsByteCounter{reader: reader}
+
+	// CREATE also creates the parent directories
+	params := map[string]string{"overwrite": "true"}
+	if val := fs.GetProp("REPLICATION"); val != "" {
+		params["replication"] = val
+	}
+	if val := fs.GetProp("BLOCK_SIZE"); val != "" {
+		params["blocksize"] = val
+	}
+
+	resp, err := fs.doRequest(http.MethodPut, "CREATE", path, params, counter)
+	if err != nil {
+		err = g.Error(err, "Unable to write "+path)
+		return
+	}
+	resp.Body.Close()
+
+	return counter.count, nil
+}
+
+// GetReader return a reader for the given path
+func (fs *HDFSFileSysClient) GetReader(urlStr string) (reader io.Reader, err error) {
+	path, err := fs.GetPath(urlStr)
+	if err != nil {
+		err = g.Error(err, "Error Parsing url: "+urlStr)
+		return
+	}
+
+	resp, err := fs.doRequest(http.MethodGet, "OPEN", path, nil, nil)
+	if err != nil {
+		err = g.Error(err, "Unable to open "+path)
+		return
+	}
+
+	pipeR, pipeW := io.Pipe()
+
+	go func() {
+		defer pipeW.Close()
+		defer resp.Body.Close()
+
+		_, err = io.Copy(pipeW, bufio.NewReader(resp.Body))
+		if err != nil {
+			fs.Context().CaptureErr(g.Error(err, "Error writing from reader"))
+			fs.Context().Cancel()
+			g.LogError(fs.Context().Err())
+		}
+	}()
+
+	return pipeR, err
+}
+
+// GetWriter creates the file if non-existent and return a writer
+func (fs *HDFSFileSysClient) GetWriter(urlStr string) (writer io.Writer, err error) {
+	pipeR, pipeW := io.Pipe()
+
+	go func() {
+		_, err := fs.Write(urlStr, pipeR)
+		pipeR.CloseWithError(err)
+	}()
+
+	return pipeW, nil
+}
+
+type hdfsByteCounter struct {
+	reader io.Reader
+	count  int64
+}
+
+func (bc *hdfsByteCounter) Read(p []byte) (n int, err error) {
+	n, err = bc.reader.Read(p)
+	bc.count += int64(n)
+	return
+}
@@ -0,0 +1,69 @@
+package filesys
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Placeholders of templated output paths, resolved for each file written
+const (
+	PartNumberPlaceholder = "{part_number}"
+	PartFolderPlaceholder = "{part_folder}"
+)
+
+// IsTemplatedPath returns true if the path contains the `{part_number}` placeholder
+func IsTemplatedPath(path string) bool {
+	return strings.Contains(path, PartNumberPlaceholder)
+}
+
+// OutputLayout generates the paths of the files written with a templated
+// output path, such as `s3://bucket/{stream_table}/{YYYY}/part-{part_number}.parquet`.
+// Part numbers are sequential across the streams of a dataflow.
+type OutputLayout struct {
+	Template       string
+	Padding        int // width of the zero-padded numbers
+	FolderMaxFiles int // max files per folder, before moving to the next `{part_folder}`
+
+	count int
+	mux   sync.Mutex
+}
+
+// NewOutputLayout creates a layout from the template. When the max files per
+// folder is set without a `{part_folder}` placeholder, the files are nested
+// into numbered sub-folders.
+func NewOutputLayout(template string, padding, folderMaxFiles int) *OutputLayout {
+	if padding <= 0 {
+		padding = 4
+	}
+
+	if folderMaxFiles > 0 && !strings.Contains(template, PartFolderPlaceholder) {
+		i := strings.LastIndex(template, "/")
+		template = template[:i+1] + PartFolderPlaceholder + "/" + template[i+1:]
+	}
+
+	return &OutputLayout{Template: template, Padding: padding, FolderMaxFiles: folderMaxFiles}
+}
+
+// Next returns the path of the next file
+func (ol *OutputLayout) Next() string {
+	ol.mux.Lock()
+	ol.count++
+	number := ol.count
+	ol.mux.Unlock()
+
+	folder := 1
+	if ol.FolderMaxFiles > 0 {
+		folder = (number-1)/ol.FolderMaxFiles + 1
+	}
+
+	path := strings.ReplaceAll(ol.Template, PartNumberPlaceholder, fmt.Sprintf("%0*d", ol.Padding, number))
+	return strings.ReplaceAll(path, PartFolderPlaceholder, fmt.Sprintf("%0*d", ol.Padding, folder))
+}
+
+// Count returns the number of file paths generated
+func (ol *OutputLayout) Count() int {
+	ol.mux.Lock()
+	defer ol.mux.Unlock()
+	return ol.count
+}
@@ -122,7 +122,9 @@ func (fs *LocalFileSysClient) GetDatastream(uri string, cfg ...iop.FileStreamCon
 	ds.SafeInference = true
 	ds.SetMetadata(fs.GetProp("METADATA"))
 	ds.Metadata.StreamURL.Value = path
-	ds.SetConfig(fs.Props())
+	if err = ds.SetConfig(fs.Props()); err != nil {
+		return nil, err
+	}
 
 	// set selectFields for pruning at source
 	ds.Columns = iop.NewColumnsFromFields(Cfg.Select...)
@@ -13,8 +13,10 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -135,7 +137,27 @@ func (fs *S3FileSysClient) Connect() (err error) {
 		// LogLevel: aws.LogLevel(aws.LogDebugWithHTTPBody),
 	}
 
-	if cast.ToBool(fs.GetProp("USE_ENVIRONMENT")) {
+	// retries of failed requests, such as multipart upload parts
+	uploadOpts, err := GetUploadOptions(fs)
+	if err != nil {
+		return g.Error(err, "invalid upload options")
+	} else if uploadOpts.HasRetries() || uploadOpts.Checksum {
+		awsConfig.Retryer = newS3Retryer(uploadOpts)
+	}
+
+	useWorkloadIdentity, err := UseWorkloadIdentity(fs.GetProp("AUTH"))
+	if err != nil {
+		return err
+	}
+
+	if useWorkloadIdentity {
+		// IRSA / EKS Pod Identity, resolved by the default credential chain
+		if !AwsWorkloadIdentityDetected() {
+			return g.Error("auth is %s, but no AWS workload identity was found (expected AWS_WEB_IDENTITY_TOKEN_FILE for IRSA, or AWS_CONTAINER_CREDENTIALS_FULL_URI for EKS Pod Identity)", AuthWorkloadIdentity)
+		}
+		g.Debug("using AWS workload identity credentials")
+		goto skipUseEnv
+	} else if cast.ToBool(fs.GetProp("USE_ENVIRONMENT")) {
 		goto useEnv
 	} else if profile := fs.GetProp("PROFILE"); profile != "" {
 		// Fall back to profile if specified
@@ -160,7 +182,10 @@ useEnv:
 	// Use environment credentials (AWS SDK will automatically pick these up)
 	g.Debug("using default AWS environment credentials")
 	_, err = credentials.NewEnvCredentials().Get()
-	if err != nil {
+	if err != nil && AwsWorkloadIdentityDetected() {
+		g.Debug("using AWS workload identity credentials (detected)")
+		err = nil
+	} else if err != nil {
 		err = g.Error(err, "Could not AWS environment credentials.")
 		return
 	}
@@ -386,8 +411,20 @@ func (fs *S3FileSysClient) Write(uri string, reader io.Reader) (bw int64, err er
 		return
 	}
 
+	uploadOpts, err := GetUploadOptions(fs)
+	if err != nil {
+		return 0, g.Error(err, "invalid upload options")
+	}
+
 	uploader := s3manager.NewUploader(fs.getSession())
 	uploader.Concurrency = fs.Context().Wg.Limit
+	if uploadOpts.Concurrency > 0 {
+		uploader.Concurrency = uploadOpts.Concurrency
+	}
+	if uploadOpts.PartSize > 0 {
+		// max 10,000 parts, so large exports need larger parts
+		uploader.PartSize = max(uploadOpts.PartSize, s3manager.MinUploadPartSize)
+	}
 
 	// Create pipe to get bytes written
 	pr, pw := io.Pipe()
@@ -403,13 +440,24 @@ func (fs *S3FileSysClient) Write(uri string, reader io.Reader) (bw int64, err er
 
 	// Upload the file to S3.
 	ServerSideEncryption, SSEKMSKeyId := fs.getEncryptionParams()
-	_, err = uploader.UploadWithContext(fs.Context().Ctx, &s3manager.UploadInput{
+	input := &s3manager.UploadInput{
 		Bucket:               aws.String(fs.bucket),
 		Key:                  aws.String(key),
 		Body:                 pr,
 		ServerSideEncryption: ServerSideEncryption,
 		SSEKMSKeyId:          SSEKMSKeyId,
-	})
+	}
+	if uploadOpts.Checksum {
+		// each part is validated by S3, and retried if corrupted
+		input.ChecksumAlgorithm = aws.String(s3.ChecksumAlgorithmCrc32)
+	}
+	if storageClass, err := GetStorageClass(fs, s3.StorageClass_Values()); err != nil {
+		return 0, err
+	} else if storageClass != "" {
+		input.StorageClass = aws.String(storageClass)
+	}
+
+	_, err = uploader.UploadWithContext(fs.Context().Ctx, input)
 	if err != nil {
 		err = g.Error(err, "failed to upload file: "+key)
 		return
@@ -420,7 +468,36 @@ func (fs *S3FileSysClient) Write(uri string, reader io.Reader) (bw int64, err er
 	return
 }
 
-// getEncryptionParams returns the encryption params if specified
+// s3Retryer retries failed requests with exponential backoff, including
+// parts rejected for a checksum mismatch (BadDigest)
+type s3Retryer struct {
+	client.DefaultRetryer
+}
+
+func newS3Retryer(uo UploadOptions) s3Retryer {
+	retryer := client.DefaultRetryer{
+		NumMaxRetries:    client.DefaultRetryerMaxNumRetries,
+		MinRetryDelay:    uo.RetryDelay,
+		MaxRetryDelay:    uo.MaxRetryDelay,
+		MinThrottleDelay: uo.RetryDelay,
+		MaxThrottleDelay: uo.MaxRetryDelay,
+	}
+	if uo.MaxRetries > 0 {
+		retryer.NumMaxRetries = uo.MaxRetries
+	}
+	return s3Retryer{retryer}
+}
+
+// ShouldRetry returns true if the request should be retried
+func (r s3Retryer) ShouldRetry(req *request.Request) bool {
+	if aerr, ok := req.Error.(awserr.Error); ok && g.In(aerr.Code(), "BadDigest", "InvalidDigest") {
+		return true
+	}
+	return r.DefaultRetryer.ShouldRetry(req)
+}
+
+// getEncryptionParams returns the encryption params if specified.
+// A KMS key (`kms_key_id`) without algorithm implies SSE-KMS.
 func (fs *S3FileSysClient) getEncryptionParams() (sse, kmsKeyId *string) {
 	if val := fs.GetProp("encryption_algorithm"); val != "" {
 		if g.In(val, "AES256", "aws:kms", "aws:kms:dsse") {
@@ -428,8 +505,11 @@ func (fs *S3FileSysClient) getEncryptionParams() (sse, kmsKeyId *string) {
 		}
 	}
 
-	if val := fs.GetProp("encryption_kms_key"); val != "" {
-		if sse != nil && g.In(*sse, "aws:kms", "aws:kms:dsse") {
+	if val := fs.GetProp("encryption_kms_key", "kms_key_id"); val != "" {
+		if sse == nil {
+			sse = aws.String(s3.ServerSideEncryptionAwsKms)
+		}
+		if g.In(*sse, "aws:kms", "aws:kms:dsse") {
 			kmsKeyId = aws.String(val)
 		}
 	}
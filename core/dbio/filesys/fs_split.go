@@ -0,0 +1,197 @@
+package filesys
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+)
+
+// DefaultSplitSize is the minimum size of the byte ranges of a split file
+var DefaultSplitSize int64 = 64 * 1024 * 1024
+
+// FileChunk is a byte range of a file, aligned to record boundaries
+type FileChunk struct {
+	Start int64
+	End   int64 // exclusive
+}
+
+// SplitFile splits a local csv or ndjson file into at most count byte ranges
+// of at least minSize bytes, starting at the beginning of a record. For csv,
+// the boundaries are outside of quoted values, and the header line (if any)
+// is returned to be prepended to each chunk.
+func SplitFile(path string, format dbio.FileType, count int, minSize int64, hasHeader bool, quote byte) (chunks []FileChunk, header []byte, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, g.Error(err, "could not open %s", path)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, nil, g.Error(err, "could not stat %s", path)
+	}
+	size := stat.Size()
+
+	if minSize <= 0 {
+		minSize = DefaultSplitSize
+	}
+	chunkSize := max(size/int64(max(count, 1)), minSize)
+
+	// scan the file sequentially, to track the quotes
+	reader := bufio.NewReaderSize(file, 1024*1024)
+
+	// compressed files cannot be split
+	if magic, _ := reader.Peek(10); iop.DetectCompression(magic) != iop.NoneCompressorType {
+		return []FileChunk{{Start: 0, End: size}}, nil, nil
+	}
+
+	var pos, start int64
+	inQuote := false
+
+	if format == dbio.FileTypeCsv && hasHeader {
+		for {
+			line, err := reader.ReadBytes('\n')
+			header = append(header, line...)
+			inQuote = inQuote != (bytes.Count(line, []byte{quote})%2 == 1)
+			if err == io.EOF || (err == nil && !inQuote) {
+				break
+			} else if err != nil {
+				return nil, nil, g.Error(err, "could not read header of %s", path)
+			}
+		}
+		pos, start = int64(len(header)), int64(len(header))
+	}
+
+	if size-start < 2*minSize || count < 2 {
+		return []FileChunk{{Start: start, End: size}}, header, nil
+	}
+
+	block := make([]byte, 1024*1024)
+	target := start + chunkSize
+	for len(chunks) < count-1 {
+		n, err := io.ReadFull(reader, block)
+		if n == 0 {
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, nil, g.Error(err, "could not read %s", path)
+		}
+		data := block[:n]
+
+		// block before the next boundary, only the quote parity matters
+		if pos+int64(n) <= target {
+			if format == dbio.FileTypeCsv {
+				inQuote = inQuote != (bytes.Count(data, []byte{quote})%2 == 1)
+			}
+			pos += int64(n)
+			continue
+		}
+
+		for i, b := range data {
+			if b == quote && format == dbio.FileTypeCsv {
+				inQuote = !inQuote
+			} else if b == '\n' && !inQuote && pos+int64(i) >= target && len(chunks) < count-1 {
+				end := pos + int64(i) + 1
+				chunks = append(chunks, FileChunk{Start: start, End: end})
+				start, target = end, end+chunkSize
+			}
+		}
+		pos += int64(n)
+	}
+
+	if start < size {
+		chunks = append(chunks, FileChunk{Start: start, End: size})
+	}
+
+	return chunks, header, nil
+}
+
+// splitNodeChunks returns the chunks of a single large local csv or ndjson
+// file, to parse in parallel when the read concurrency is more than 1.
+// Compressed and encrypted files are read sequentially.
+func splitNodeChunks(fs FileSysClient, nodes FileNodes, cfg iop.FileStreamConfig) (path string, format dbio.FileType, chunks []FileChunk, header []byte, ok bool) {
+	files := nodes.Files()
+	if cfg.Concurrency < 2 || len(files) != 1 || fs.FsType() != dbio.TypeFileLocal || cfg.ShouldUseDuckDB() {
+		return
+	}
+
+	node := files[0]
+	format = cfg.Format
+	if format == dbio.FileTypeNone {
+		format = InferFileFormat(node.URI)
+	}
+
+	minSize := cfg.SplitSize
+	if minSize <= 0 {
+		minSize = DefaultSplitSize
+	}
+
+	switch {
+	case int64(node.Size) < 2*minSize:
+		return
+	case fs.GetProp("ENCRYPTION") != "":
+		return
+	case !g.In(format, dbio.FileTypeCsv, dbio.FileTypeJsonLines):
+		return
+	case format == dbio.FileTypeCsv && !g.In(fs.GetProp("ESCAPE"), "", `"`):
+		return // quotes escaped with another character cannot be tracked
+	}
+
+	quote := byte('"')
+	if val := fs.GetProp("QUOTE"); len(val) == 1 {
+		quote = val[0]
+	}
+	hasHeader := fs.GetProp("HEADER") == "" || cast.ToBool(fs.GetProp("HEADER"))
+
+	path = strings.TrimPrefix(node.Path(), "file://")
+	chunks, header, err := SplitFile(path, format, cfg.Concurrency, minSize, hasHeader, quote)
+	if err != nil {
+		g.Warn("could not split %s, reading sequentially: %s", node.URI, err.Error())
+		return path, format, nil, nil, false
+	}
+
+	return path, format, chunks, header, len(chunks) > 1
+}
+
+// getChunkDatastream returns the datastream of a chunk of a split file
+func getChunkDatastream(fs FileSysClient, uri, path string, format dbio.FileType, chunk FileChunk, header []byte) (ds *iop.Datastream) {
+	ds = iop.NewDatastreamContext(fs.Context().Ctx, nil)
+	ds.SafeInference = true
+	ds.SetMetadata(fs.GetProp("METADATA"))
+	ds.Metadata.StreamURL.Value = uri
+	if err := ds.SetConfig(fs.Props()); err != nil {
+		ds.Context.CaptureErr(err)
+	}
+
+	go func() {
+		file, err := os.Open(path)
+		if err != nil {
+			ds.Context.CaptureErr(g.Error(err, "could not open %s", path))
+			return
+		}
+		defer file.Close()
+
+		var reader io.Reader = io.NewSectionReader(file, chunk.Start, chunk.End-chunk.Start)
+		if len(header) > 0 {
+			reader = io.MultiReader(bytes.NewReader(header), reader)
+		}
+
+		g.Debug("reading datastream from %s [format=%s, bytes=%d-%d]", uri, format, chunk.Start, chunk.End)
+		if format == dbio.FileTypeJsonLines {
+			err = ds.ConsumeJsonReader(reader)
+		} else {
+			err = ds.ConsumeCsvReader(reader)
+		}
+		if err != nil {
+			ds.Context.CaptureErr(g.Error(err, "Error consuming chunk of %s", uri))
+		}
+	}()
+
+	return ds
+}
@@ -2,19 +2,27 @@ package filesys
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	arrowParquet "github.com/apache/arrow/go/v16/parquet"
 	"github.com/apache/arrow/go/v16/parquet/compress"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/clbanning/mxj/v2"
 	"github.com/flarco/g/net"
 	"github.com/linkedin/goavro/v2"
 	"github.com/parquet-go/parquet-go"
+	"github.com/samber/lo"
 	"github.com/slingdata-io/sling-cli/core/dbio"
 	"github.com/spf13/cast"
 
@@ -93,6 +101,32 @@ func TestFileSysLocalCsv(t *testing.T) {
 
 }
 
+func TestFileSysLocalParallelRead(t *testing.T) {
+	t.Parallel()
+	fs, err := NewFileSysClient(dbio.TypeFileLocal)
+	assert.NoError(t, err)
+
+	folder := t.TempDir()
+	for i := 1; i <= 5; i++ {
+		content := "id,name\n"
+		for j := 1; j <= 10; j++ {
+			content += fmt.Sprintf("%d,name_%d\n", i*100+j, j)
+		}
+		_, err = fs.Write(fmt.Sprintf("%s/file%d.csv", folder, i), strings.NewReader(content))
+		g.AssertNoError(t, err)
+	}
+
+	df, err := fs.ReadDataflow(folder, iop.FileStreamConfig{Format: dbio.FileTypeCsv, Concurrency: 3})
+	if !g.AssertNoError(t, err) {
+		return
+	}
+
+	data, err := df.Collect()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 50, len(data.Rows))
+	assert.Len(t, df.Streams, 5) // one stream per file
+}
+
 func TestFileSysLocalFormat(t *testing.T) {
 	t.Parallel()
 	iop.SampleSize = 4
@@ -1103,6 +1137,114 @@ func TestFileSysNormalizeURI(t *testing.T) {
 	assert.Equal(t, "sftp://sling.uri.test:2222//path/to/write/{stream_file_name}", NormalizeURI(fs, u))
 }
 
+func TestFileSysOutputLayout(t *testing.T) {
+	assert.True(t, IsTemplatedPath("s3://bucket/users/part-{part_number}.csv"))
+	assert.False(t, IsTemplatedPath("s3://bucket/users/*.csv"))
+
+	layout := NewOutputLayout("s3://bucket/users/part-{part_number}.parquet", 0, 0)
+	assert.Equal(t, "s3://bucket/users/part-0001.parquet", layout.Next())
+	assert.Equal(t, "s3://bucket/users/part-0002.parquet", layout.Next())
+
+	// nested into numbered folders
+	layout = NewOutputLayout("file:///tmp/users/{part_number}.csv", 2, 2)
+	paths := []string{layout.Next(), layout.Next(), layout.Next()}
+	assert.Equal(t, []string{
+		"file:///tmp/users/01/01.csv",
+		"file:///tmp/users/01/02.csv",
+		"file:///tmp/users/02/03.csv",
+	}, paths)
+
+	layout = NewOutputLayout("gs://bucket/batch={part_folder}/part-{part_number}.csv", 3, 1)
+	layout.Next()
+	assert.Equal(t, "gs://bucket/batch=002/part-002.csv", layout.Next())
+	assert.Equal(t, 2, layout.Count())
+}
+
+func TestFileSysUploadOptions(t *testing.T) {
+	fs, err := NewFileSysClient(dbio.TypeFileLocal,
+		"UPLOAD_PART_SIZE=67108864", "UPLOAD_CONCURRENCY=8", "UPLOAD_MAX_RETRIES=5",
+		"UPLOAD_RETRY_DELAY=500ms", "UPLOAD_MAX_RETRY_DELAY=30", "UPLOAD_CHECKSUM=true",
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	uo, err := GetUploadOptions(fs)
+	assert.NoError(t, err)
+	assert.Equal(t, UploadOptions{
+		PartSize:      64 * 1024 * 1024,
+		Concurrency:   8,
+		MaxRetries:    5,
+		RetryDelay:    500 * time.Millisecond,
+		MaxRetryDelay: 30 * time.Second,
+		Checksum:      true,
+	}, uo)
+	assert.True(t, uo.HasRetries())
+
+	retryer := newS3Retryer(uo)
+	assert.Equal(t, 5, retryer.MaxRetries())
+	req := &request.Request{Error: awserr.New("BadDigest", "checksum mismatch", nil)}
+	assert.True(t, retryer.ShouldRetry(req))
+
+	fs.SetProp("UPLOAD_RETRY_DELAY", "1m")
+	_, err = GetUploadOptions(fs)
+	assert.ErrorContains(t, err, "cannot be greater than")
+
+	fs.SetProp("UPLOAD_RETRY_DELAY", "soon")
+	_, err = GetUploadOptions(fs)
+	assert.ErrorContains(t, err, "invalid upload_retry_delay")
+
+	// storage class, matched case-insensitively
+	storageClass, err := GetStorageClass(fs, gcsStorageClasses)
+	assert.NoError(t, err)
+	assert.Empty(t, storageClass)
+
+	fs.SetProp("STORAGE_CLASS", "intelligent_tiering")
+	storageClass, err = GetStorageClass(fs, []string{"STANDARD", "INTELLIGENT_TIERING"})
+	assert.NoError(t, err)
+	assert.Equal(t, "INTELLIGENT_TIERING", storageClass)
+
+	fs.SetProp("STORAGE_CLASS", "cool")
+	storageClass, err = GetStorageClass(fs, []string{"Hot", "Cool", "Archive"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Cool", storageClass)
+
+	_, err = GetStorageClass(fs, gcsStorageClasses)
+	assert.ErrorContains(t, err, "invalid storage_class")
+
+	// kms key implies SSE-KMS
+	s3Fs := &S3FileSysClient{}
+	s3Fs.BaseFileSysClient.context = g.NewContext(context.Background())
+	s3Fs.SetProp("KMS_KEY_ID", "arn:aws:kms:us-east-1:111122223333:key/abc")
+	sse, kmsKey := s3Fs.getEncryptionParams()
+	assert.Equal(t, "aws:kms", g.PtrVal(sse))
+	assert.Equal(t, "arn:aws:kms:us-east-1:111122223333:key/abc", g.PtrVal(kmsKey))
+}
+
+func TestFileSysWorkloadIdentity(t *testing.T) {
+	for _, key := range []string{"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"} {
+		t.Setenv(key, "")
+	}
+
+	_, err := NewFileSysClient(dbio.TypeFileS3, "BUCKET=test", "AUTH=keys")
+	assert.ErrorContains(t, err, "invalid auth")
+
+	_, err = NewFileSysClient(dbio.TypeFileS3, "BUCKET=test", "AUTH=workload_identity")
+	assert.ErrorContains(t, err, "no AWS workload identity was found")
+
+	// IRSA, credentials are resolved by the session when used
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "/var/run/secrets/eks.amazonaws.com/serviceaccount/token")
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/sling")
+	assert.True(t, AwsWorkloadIdentityDetected())
+
+	_, err = NewFileSysClient(dbio.TypeFileS3, "BUCKET=test", "AUTH=workload_identity")
+	assert.NoError(t, err)
+
+	// detected without the auth property
+	_, err = NewFileSysClient(dbio.TypeFileS3, "BUCKET=test")
+	assert.NoError(t, err)
+}
+
 func TestFileSysSftp(t *testing.T) {
 	t.Parallel()
 
@@ -1557,3 +1699,263 @@ func TestCopyRecursive(t *testing.T) {
 		_ = Delete(tt.toFs, tt.toPath)
 	}
 }
+
+func TestFileSysHDFS(t *testing.T) {
+	// emulates the WebHDFS api of a namenode, redirecting reads
+	// and writes to a datanode
+	files := map[string][]byte{}
+	var mux sync.Mutex
+
+	remoteErr := func(w http.ResponseWriter, code int, exception, msg string) {
+		w.WriteHeader(code)
+		fmt.Fprintf(w, `{"RemoteException":{"exception":%q,"message":%q}}`, exception, msg)
+	}
+
+	datanode := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		path := strings.TrimPrefix(r.URL.Path, "/webhdfs/v1")
+		switch r.Method {
+		case http.MethodGet:
+			w.Write(files[path])
+		case http.MethodPut:
+			files[path], _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer datanode.Close()
+
+	users := map[string]bool{}
+	namenode := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/webhdfs/v1"), "/")
+		users[r.URL.Query().Get("user.name")] = true
+
+		children := map[string]string{}
+		for key, data := range files {
+			if rest, ok := strings.CutPrefix(key, path+"/"); ok {
+				name, _, isDir := strings.Cut(rest, "/")
+				if isDir {
+					children[name] = fmt.Sprintf(`{"pathSuffix":%q,"type":"DIRECTORY","length":0,"modificationTime":1700000000000}`, name)
+				} else {
+					children[name] = fmt.Sprintf(`{"pathSuffix":%q,"type":"FILE","length":%d,"modificationTime":1700000000000}`, name, len(data))
+				}
+			}
+		}
+
+		switch r.URL.Query().Get("op") {
+		case "GETFILESTATUS":
+			if data, ok := files[path]; ok {
+				fmt.Fprintf(w, `{"FileStatus":{"pathSuffix":"","type":"FILE","length":%d,"modificationTime":1700000000000}}`, len(data))
+			} else if len(children) > 0 {
+				fmt.Fprint(w, `{"FileStatus":{"pathSuffix":"","type":"DIRECTORY","length":0,"modificationTime":1700000000000}}`)
+			} else {
+				remoteErr(w, http.StatusNotFound, "FileNotFoundException", "File does not exist: "+path)
+			}
+		case "LISTSTATUS":
+			if len(children) == 0 {
+				remoteErr(w, http.StatusNotFound, "FileNotFoundException", "File "+path+" does not exist.")
+				return
+			}
+			fmt.Fprintf(w, `{"FileStatuses":{"FileStatus":[%s]}}`, strings.Join(lo.Values(children), ","))
+		case "OPEN", "CREATE":
+			http.Redirect(w, r, datanode.URL+r.URL.Path, http.StatusTemporaryRedirect)
+		case "DELETE":
+			for key := range files {
+				if key == path || strings.HasPrefix(key, path+"/") {
+					delete(files, key)
+				}
+			}
+			fmt.Fprint(w, `{"boolean":true}`)
+		case "MKDIRS":
+			fmt.Fprint(w, `{"boolean":true}`)
+		default:
+			remoteErr(w, http.StatusBadRequest, "IllegalArgumentException", "invalid op")
+		}
+	}))
+	defer namenode.Close()
+
+	nnURL, _ := url.Parse(namenode.URL)
+	fs, err := NewFileSysClientFromURL("hdfs://"+nnURL.Host+"/", "USER=sling")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, dbio.TypeFileHDFS, fs.FsType())
+	assert.Equal(t, nnURL.Hostname(), fs.GetProp("host"))
+
+	// write
+	for _, name := range []string{"data/a.csv", "data/b.csv", "data/sub/c.csv"} {
+		bw, err := fs.Write(fs.Prefix("/")+"tmp/"+name, strings.NewReader("col1\nvalue\n"))
+		assert.NoError(t, err)
+		assert.EqualValues(t, 11, bw)
+	}
+	assert.True(t, users["sling"])
+
+	// list
+	nodes, err := fs.List(fs.Prefix("/") + "tmp/data/")
+	if assert.NoError(t, err) {
+		assert.Len(t, nodes.Files(), 2)
+		assert.Len(t, nodes.Folders(), 1)
+		assert.Contains(t, nodes.URIs(), fs.Prefix("/")+"tmp/data/a.csv")
+	}
+
+	nodes, err = fs.List(fs.Prefix("/") + "tmp/data/*.csv")
+	if assert.NoError(t, err) {
+		assert.Len(t, nodes, 2)
+	}
+
+	nodes, err = fs.ListRecursive(fs.Prefix("/") + "tmp/data/")
+	if assert.NoError(t, err) {
+		assert.Len(t, nodes.Files(), 3)
+		assert.Contains(t, nodes.URIs(), fs.Prefix("/")+"tmp/data/sub/c.csv")
+		assert.EqualValues(t, 11, nodes.Files()[0].Size)
+	}
+
+	nodes, err = fs.List(fs.Prefix("/") + "tmp/missing/")
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 0)
+
+	// read
+	reader, err := fs.GetReader(fs.Prefix("/") + "tmp/data/b.csv")
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(reader)
+		assert.Equal(t, "col1\nvalue\n", string(data))
+	}
+
+	df, err := fs.ReadDataflow(fs.Prefix("/") + "tmp/data/")
+	if assert.NoError(t, err) {
+		data, err := iop.MergeDataflow(df).Collect(0)
+		assert.NoError(t, err)
+		assert.Len(t, data.Rows, 3)
+	}
+
+	// delete
+	err = Delete(fs, fs.Prefix("/")+"tmp/data/sub")
+	assert.NoError(t, err)
+	nodes, err = fs.ListRecursive(fs.Prefix("/") + "tmp/data/")
+	if assert.NoError(t, err) {
+		assert.Len(t, nodes.Files(), 2)
+	}
+
+	// remote exceptions are surfaced
+	_, err = fs.Self().(*HDFSFileSysClient).listStatus("tmp/missing")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "FileNotFoundException")
+	}
+}
+
+func TestFileSysSplitFile(t *testing.T) {
+	folder := t.TempDir()
+
+	// csv with quoted line breaks & quotes
+	var buf strings.Builder
+	buf.WriteString("id,text\n")
+	for i := 0; i < 300; i++ {
+		if i%3 == 0 {
+			fmt.Fprintf(&buf, "%d,\"multi\nline \"\"%d\"\"\"\n", i, i)
+		} else {
+			fmt.Fprintf(&buf, "%d,plain %d\n", i, i)
+		}
+	}
+	csvPath := folder + "/big.csv"
+	assert.NoError(t, os.WriteFile(csvPath, []byte(buf.String()), 0644))
+
+	chunks, header, err := SplitFile(csvPath, dbio.FileTypeCsv, 4, 500, true, '"')
+	if assert.NoError(t, err) {
+		assert.Equal(t, "id,text\n", string(header))
+		assert.Len(t, chunks, 4)
+		content := buf.String()
+		for i, chunk := range chunks {
+			// each chunk starts at a record
+			assert.Regexp(t, `^\d+,`, content[chunk.Start:chunk.End], "chunk %d", i)
+			if i > 0 {
+				assert.Equal(t, chunks[i-1].End, chunk.Start)
+			}
+		}
+		assert.EqualValues(t, len(content), chunks[3].End)
+	}
+
+	// small files are not split
+	chunks, _, err = SplitFile(csvPath, dbio.FileTypeCsv, 4, int64(len(buf.String())), true, '"')
+	assert.NoError(t, err)
+	assert.Len(t, chunks, 1)
+
+	// the chunks are parsed in parallel
+	fs, err := NewFileSysClient(dbio.TypeFileLocal)
+	if !assert.NoError(t, err) {
+		return
+	}
+	df, err := fs.ReadDataflow("file://"+csvPath, iop.FileStreamConfig{Concurrency: 4, SplitSize: 500})
+	if assert.NoError(t, err) {
+		data, err := iop.MergeDataflow(df).Collect(0)
+		assert.NoError(t, err)
+		assert.Len(t, data.Rows, 300)
+		assert.Len(t, data.Columns, 2)
+		texts := map[string]bool{}
+		for _, row := range data.Rows {
+			texts[cast.ToString(row[1])] = true
+		}
+		assert.True(t, texts["multi\nline \"3\""])
+		assert.True(t, texts["plain 299"])
+	}
+
+	// ndjson
+	buf.Reset()
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&buf, `{"id":%d,"text":"line\n%d"}`+"\n", i, i)
+	}
+	jsonPath := folder + "/big.jsonl"
+	assert.NoError(t, os.WriteFile(jsonPath, []byte(buf.String()), 0644))
+
+	df, err = fs.ReadDataflow("file://"+jsonPath, iop.FileStreamConfig{Concurrency: 3, SplitSize: 1000})
+	if assert.NoError(t, err) {
+		data, err := iop.MergeDataflow(df).Collect(0)
+		assert.NoError(t, err)
+		assert.Len(t, data.Rows, 300)
+	}
+}
+
+func TestFileSysEncryption(t *testing.T) {
+	folder := t.TempDir()
+
+	for _, props := range [][]string{
+		{"ENCRYPTION=aes-gcm", "ENCRYPTION_KEY=hunter2"},
+		{"ENCRYPTION=gpg", "ENCRYPTION_KEY=hunter2"},
+		{"ENCRYPTION=age", "ENCRYPTION_KEY=hunter2"},
+	} {
+		fs, err := NewFileSysClient(dbio.TypeFileLocal, append(props, "FILE_MAX_ROWS=1")...)
+		if !assert.NoError(t, err) {
+			return
+		}
+		encryptor, _ := NewEncryptor(fs)
+		uri := g.F("file://%s/%s/", folder, strings.TrimPrefix(encryptor.Suffix(), "."))
+
+		// the parts written are encrypted & suffixed
+		ds := iop.NewDataset(iop.NewColumnsFromFields("id", "name"))
+		ds.Append([]any{1, "alice"}, []any{2, "bob"})
+		df, _ := iop.MakeDataFlow(ds.Stream())
+		_, err = WriteDataflow(fs, df, uri)
+		if !assert.NoError(t, err, props[0]) {
+			continue
+		}
+
+		paths, err := fs.ListRecursive(uri)
+		if assert.NoError(t, err) && assert.NotEmpty(t, paths, props[0]) {
+			assert.True(t, strings.HasSuffix(paths[0].URI, encryptor.Suffix()), paths[0].URI)
+			content, _ := os.ReadFile(strings.TrimPrefix(paths[0].URI, "file://"))
+			assert.NotContains(t, string(content), "alice", props[0])
+		}
+
+		// the files are decrypted when read
+		df, err = fs.ReadDataflow(uri, iop.FileStreamConfig{Format: dbio.FileTypeCsv})
+		if assert.NoError(t, err, props[0]) {
+			data, err := iop.MergeDataflow(df).Collect(0)
+			assert.NoError(t, err, props[0])
+			if assert.Len(t, data.Rows, 2, props[0]) {
+				names := []string{cast.ToString(data.Rows[0][1]), cast.ToString(data.Rows[1][1])}
+				assert.ElementsMatch(t, []string{"alice", "bob"}, names)
+			}
+		}
+	}
+}
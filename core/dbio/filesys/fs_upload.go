@@ -0,0 +1,76 @@
+package filesys
+
+import (
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/spf13/cast"
+)
+
+// UploadOptions are the tuning settings of the object store writers
+// (S3, GCS, Azure), from the connection or target properties
+type UploadOptions struct {
+	PartSize      int64         // bytes per part (s3), chunk (gcs) or block (azure)
+	Concurrency   int           // parts uploaded in parallel (s3, azure)
+	MaxRetries    int           // retries of a failed part
+	RetryDelay    time.Duration // initial backoff delay, doubled on each retry
+	MaxRetryDelay time.Duration // maximum backoff delay
+	Checksum      bool          // validate the uploaded parts with checksums
+}
+
+// GetUploadOptions returns the upload settings of the file system client.
+// Delays accept durations (`500ms`, `2s`) or a number of seconds.
+func GetUploadOptions(fs FileSysClient) (uo UploadOptions, err error) {
+	uo.PartSize = cast.ToInt64(fs.GetProp("UPLOAD_PART_SIZE"))
+	uo.Concurrency = cast.ToInt(fs.GetProp("UPLOAD_CONCURRENCY"))
+	uo.MaxRetries = cast.ToInt(fs.GetProp("UPLOAD_MAX_RETRIES"))
+	uo.Checksum = cast.ToBool(fs.GetProp("UPLOAD_CHECKSUM"))
+
+	if uo.PartSize < 0 || uo.Concurrency < 0 || uo.MaxRetries < 0 {
+		return uo, g.Error("upload_part_size, upload_concurrency and upload_max_retries cannot be negative")
+	}
+
+	if uo.RetryDelay, err = parseUploadDelay(fs.GetProp("UPLOAD_RETRY_DELAY")); err != nil {
+		return uo, g.Error(err, "invalid upload_retry_delay")
+	} else if uo.MaxRetryDelay, err = parseUploadDelay(fs.GetProp("UPLOAD_MAX_RETRY_DELAY")); err != nil {
+		return uo, g.Error(err, "invalid upload_max_retry_delay")
+	}
+
+	if uo.MaxRetryDelay > 0 && uo.RetryDelay > uo.MaxRetryDelay {
+		return uo, g.Error("upload_retry_delay (%s) cannot be greater than upload_max_retry_delay (%s)", uo.RetryDelay, uo.MaxRetryDelay)
+	}
+
+	return uo, nil
+}
+
+// HasRetries returns true if the retry settings are provided
+func (uo UploadOptions) HasRetries() bool {
+	return uo.MaxRetries > 0 || uo.RetryDelay > 0 || uo.MaxRetryDelay > 0
+}
+
+// GetStorageClass returns the storage class (s3, gcs) or access tier (azure)
+// of the written objects, from the `storage_class` property. The value is
+// matched case-insensitively with the valid values of the service.
+func GetStorageClass(fs FileSysClient, valid []string) (string, error) {
+	val := strings.TrimSpace(fs.GetProp("STORAGE_CLASS"))
+	if val == "" {
+		return "", nil
+	}
+
+	for _, v := range valid {
+		if strings.EqualFold(v, val) {
+			return v, nil
+		}
+	}
+	return "", g.Error("invalid storage_class for %s: %s. Expected one of: %s", fs.FsType(), val, strings.Join(valid, ", "))
+}
+
+func parseUploadDelay(val string) (time.Duration, error) {
+	if val == "" {
+		return 0, nil
+	} else if seconds, err := cast.ToFloat64E(val); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(val)
+}
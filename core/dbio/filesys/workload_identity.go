@@ -0,0 +1,82 @@
+package filesys
+
+import (
+	"os"
+	"strings"
+
+	"cloud.google.com/go/compute/metadata"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/flarco/g"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+)
+
+// AuthWorkloadIdentity is the value of the `auth` property to authenticate
+// with the identity of the workload (pod or VM) instead of static keys:
+// AWS IRSA / EKS Pod Identity, GCP Workload Identity (metadata server) and
+// Azure Workload Identity / Managed Identity. Without the `auth` property,
+// the workload identity is used when detected and no keys are provided.
+const AuthWorkloadIdentity = "workload_identity"
+
+// UseWorkloadIdentity returns true if the `auth` property is workload_identity
+func UseWorkloadIdentity(auth string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(auth)) {
+	case "":
+		return false, nil
+	case AuthWorkloadIdentity:
+		return true, nil
+	}
+	return false, g.Error("invalid auth: %s (expected %s)", auth, AuthWorkloadIdentity)
+}
+
+// AwsWorkloadIdentityDetected returns true if the environment provides AWS
+// credentials via IRSA (web identity token) or EKS Pod Identity / ECS task
+// roles (container credentials). These are resolved by the default
+// credential chain of the AWS session.
+func AwsWorkloadIdentityDetected() bool {
+	return os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "" ||
+		os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "" ||
+		os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != ""
+}
+
+// GoogleWorkloadIdentityOption returns the client option authenticating
+// with the service account of the workload, from the metadata server
+// (GKE Workload Identity or the VM service account), with its project id.
+func GoogleWorkloadIdentityOption() (authOption option.ClientOption, projectID string, err error) {
+	if !metadata.OnGCE() {
+		return nil, "", g.Error("auth is %s, but the GCP metadata server is not available", AuthWorkloadIdentity)
+	}
+
+	projectID, err = metadata.ProjectID()
+	if err != nil {
+		return nil, "", g.Error(err, "could not get project id from GCP metadata server")
+	}
+
+	ts := google.ComputeTokenSource("", "https://www.googleapis.com/auth/cloud-platform")
+	return option.WithTokenSource(ts), projectID, nil
+}
+
+// AzureWorkloadIdentityCredential returns the credential of the workload:
+// the AKS Workload Identity if the federated token is provided, otherwise the
+// Managed Identity (user-assigned if clientID is provided).
+func AzureWorkloadIdentityCredential(clientID string) (cred azcore.TokenCredential, err error) {
+	if os.Getenv("AZURE_FEDERATED_TOKEN_FILE") != "" {
+		cred, err = azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{ClientID: clientID})
+		if err != nil {
+			return nil, g.Error(err, "could not create Azure workload identity credential")
+		}
+		return cred, nil
+	}
+
+	options := &azidentity.ManagedIdentityCredentialOptions{}
+	if clientID != "" {
+		options.ID = azidentity.ClientID(clientID)
+	}
+
+	cred, err = azidentity.NewManagedIdentityCredential(options)
+	if err != nil {
+		return nil, g.Error(err, "could not create Azure managed identity credential")
+	}
+	return cred, nil
+}
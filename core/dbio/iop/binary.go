@@ -0,0 +1,78 @@
+package iop
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"unicode/utf8"
+
+	"github.com/flarco/g"
+	"github.com/spf13/cast"
+)
+
+// BinaryEncoding is the encoding of binary values in text formats (csv, json)
+type BinaryEncoding string
+
+const (
+	BinaryEncodingHex    BinaryEncoding = "hex"
+	BinaryEncodingBase64 BinaryEncoding = "base64"
+)
+
+// BinaryOverflow is what happens with binary values larger than `binary_max_size`
+type BinaryOverflow string
+
+const (
+	BinaryOverflowTruncate BinaryOverflow = "truncate" // keep the first bytes
+	BinaryOverflowNull     BinaryOverflow = "null"     // set as null
+	BinaryOverflowError    BinaryOverflow = "error"    // fail the stream
+)
+
+// ValidateBinaryOptions checks the binary encoding and overflow values
+func ValidateBinaryOptions(encoding BinaryEncoding, overflow BinaryOverflow) error {
+	if !g.In(encoding, "", BinaryEncodingHex, BinaryEncodingBase64) {
+		return g.Error("invalid binary_encoding (%s). Expected hex or base64", encoding)
+	} else if !g.In(overflow, "", BinaryOverflowTruncate, BinaryOverflowNull, BinaryOverflowError) {
+		return g.Error("invalid binary_overflow (%s). Expected truncate, null or error", overflow)
+	}
+	return nil
+}
+
+// EncodeBinary returns the text form of a binary value. Without encoding,
+// valid UTF-8 is kept as is, and other bytes are hex-escaped (`\x0a1b`)
+// instead of being mangled.
+func (sc *StreamConfig) EncodeBinary(val any) string {
+	var b []byte
+	switch v := val.(type) {
+	case []byte:
+		b = v
+	default:
+		b = []byte(cast.ToString(v))
+	}
+
+	switch sc.BinaryEncoding {
+	case BinaryEncodingHex:
+		return hex.EncodeToString(b)
+	case BinaryEncodingBase64:
+		return base64.StdEncoding.EncodeToString(b)
+	}
+
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return `\x` + hex.EncodeToString(b)
+}
+
+// limitBinary applies the size limit of binary values (`binary_max_size`).
+// A nil value is returned if set as null.
+func (sc *StreamConfig) limitBinary(colName string, b []byte) ([]byte, error) {
+	if sc.BinaryMaxSize <= 0 || int64(len(b)) <= sc.BinaryMaxSize {
+		return b, nil
+	}
+
+	switch sc.BinaryOverflow {
+	case BinaryOverflowNull:
+		return nil, nil
+	case BinaryOverflowError:
+		return nil, g.Error("binary value of column %s is %d bytes, over the binary_max_size of %d bytes", colName, len(b), sc.BinaryMaxSize)
+	}
+	return b[:sc.BinaryMaxSize], nil // truncate by default
+}
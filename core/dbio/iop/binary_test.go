@@ -0,0 +1,53 @@
+package iop
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinaryValues(t *testing.T) {
+	columns := NewColumns(Columns{
+		{Name: "id", Type: IntegerType, Sourced: true},
+		{Name: "data", Type: BinaryType, Sourced: true},
+	}...)
+	blob := []byte{0x00, 0xff, 0x10, 0x20, 0x30}
+
+	// text encoding
+	sc := StreamConfig{}
+	assert.Equal(t, `\x00ff102030`, sc.EncodeBinary(blob))
+	assert.Equal(t, "hello", sc.EncodeBinary([]byte("hello")))
+	sc.BinaryEncoding = BinaryEncodingHex
+	assert.Equal(t, "00ff102030", sc.EncodeBinary(blob))
+	sc.BinaryEncoding = BinaryEncodingBase64
+	assert.Equal(t, "AP8QIDA=", sc.EncodeBinary(blob))
+
+	// size limit & overflow policy
+	for overflow, expected := range map[string]any{
+		"truncate": []byte{0x00, 0xff, 0x10},
+		"null":     nil,
+	} {
+		sp := NewStreamProcessor()
+		sp.SetConfig(map[string]string{"binary_max_size": "3", "binary_overflow": overflow})
+		row := sp.CastRow([]any{1, blob}, columns)
+		assert.Equal(t, expected, row[1], overflow)
+	}
+
+	sp := NewStreamProcessor()
+	sp.SetConfig(map[string]string{"binary_max_size": "10"})
+	row := sp.CastRow([]any{1, blob}, columns)
+	assert.Equal(t, blob, row[1])
+
+	_, err := (&StreamConfig{BinaryMaxSize: 3, BinaryOverflow: BinaryOverflowError}).limitBinary("data", blob)
+	assert.ErrorContains(t, err, "over the binary_max_size")
+
+	assert.NoError(t, ValidateBinaryOptions(BinaryEncodingHex, BinaryOverflowNull))
+	assert.Error(t, ValidateBinaryOptions("base32", ""))
+
+	// csv values are not mangled
+	sp = NewStreamProcessor()
+	sp.SetConfig(map[string]string{"binary_encoding": "hex"})
+	assert.Equal(t, "00ff102030", sp.CastToString(1, blob, BinaryType))
+	sp.SetConfig(map[string]string{"binary_encoding": ""})
+	assert.Equal(t, `\x00ff102030`, sp.CastToString(1, blob, BinaryType))
+}
@@ -0,0 +1,62 @@
+package iop
+
+import (
+	"io"
+	"strings"
+
+	"github.com/flarco/g"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
+)
+
+// GetCharset returns the character encoding from its name (e.g. `windows-1252`,
+// `shift_jis`, `iso-8859-1`, `latin1`). A nil encoding is returned for UTF-8,
+// since no conversion is needed.
+func GetCharset(name string) (enc encoding.Encoding, err error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "", "utf8", "utf-8":
+		return nil, nil
+	case "latin1":
+		name = "iso-8859-1"
+	}
+
+	// IANA names first, since HTML maps iso-8859-1 to windows-1252
+	if enc, err = ianaindex.IANA.Encoding(name); err == nil && enc != nil {
+		return enc, nil
+	}
+
+	if enc, err = htmlindex.Get(name); err == nil && enc != nil {
+		return enc, nil
+	}
+
+	return nil, g.Error("unsupported encoding: %s", name)
+}
+
+// ValidateCharset checks the encoding name
+func ValidateCharset(name string) error {
+	_, err := GetCharset(name)
+	return err
+}
+
+// DecodeReader converts the reader from the encoding (`encoding`) to UTF-8
+func (sc *StreamConfig) DecodeReader(reader io.Reader) (io.Reader, error) {
+	enc, err := GetCharset(sc.Encoding)
+	if err != nil || enc == nil {
+		return reader, err
+	}
+	return transform.NewReader(reader, enc.NewDecoder()), nil
+}
+
+// EncodeReader converts the reader from UTF-8 to the encoding (`encoding`).
+// Characters which cannot be represented are replaced.
+func (sc *StreamConfig) EncodeReader(reader io.Reader) (io.Reader, error) {
+	enc, err := GetCharset(sc.Encoding)
+	if err != nil || enc == nil {
+		return reader, err
+	}
+	encoder := encoding.ReplaceUnsupported(enc.NewEncoder())
+	return transform.NewReader(reader, encoder), nil
+}
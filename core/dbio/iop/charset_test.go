@@ -0,0 +1,69 @@
+package iop
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestCharset(t *testing.T) {
+	for name, expected := range map[string]any{
+		"":             nil,
+		"UTF-8":        nil,
+		"latin1":       charmap.ISO8859_1,
+		"ISO-8859-1":   charmap.ISO8859_1,
+		"windows-1252": charmap.Windows1252,
+		"Shift_JIS":    japanese.ShiftJIS,
+		"sjis":         japanese.ShiftJIS,
+	} {
+		enc, err := GetCharset(name)
+		if assert.NoError(t, err, name) && expected != nil {
+			assert.Equal(t, expected, enc, name)
+		} else {
+			assert.Nil(t, enc, name)
+		}
+	}
+	assert.Error(t, ValidateCharset("utf-99"))
+
+	// read windows-1252 & shift-jis files
+	for encName, text := range map[string]string{
+		"windows-1252": "café, naïve €",
+		"shift_jis":    "こんにちは",
+	} {
+		enc, _ := GetCharset(encName)
+		content, err := enc.NewEncoder().String("id,name\n1,\"" + text + "\"\n")
+		assert.NoError(t, err)
+		assert.NotContains(t, content, text) // not utf-8
+
+		ds := NewDatastream(nil)
+		ds.SetConfig(map[string]string{"encoding": encName})
+		err = ds.ConsumeCsvReader(strings.NewReader(content))
+		if !assert.NoError(t, err, encName) {
+			continue
+		}
+		data, err := ds.Collect(0)
+		if assert.NoError(t, err) && assert.Len(t, data.Rows, 1) {
+			assert.Equal(t, text, data.Rows[0][1], encName)
+		}
+
+		// write back in encoding
+		sc := StreamConfig{Encoding: encName}
+		reader, err := sc.EncodeReader(strings.NewReader(text))
+		assert.NoError(t, err)
+		encoded, _ := io.ReadAll(reader)
+		decoded, _ := enc.NewDecoder().Bytes(encoded)
+		assert.Equal(t, text, string(decoded))
+	}
+
+	// unsupported characters are replaced
+	sc := StreamConfig{Encoding: "iso-8859-1"}
+	reader, _ := sc.EncodeReader(strings.NewReader("a€b"))
+	encoded, _ := io.ReadAll(reader)
+	assert.True(t, bytes.HasPrefix(encoded, []byte("a")) && bytes.HasSuffix(encoded, []byte("b")))
+	assert.NotContains(t, string(encoded), "€")
+}
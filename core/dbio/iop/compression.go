@@ -3,15 +3,18 @@ package iop
 import (
 	"archive/zip"
 	"bufio"
+	"bytes"
 	"compress/gzip"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/dsnet/compress/bzip2"
 	"github.com/flarco/g"
 	"github.com/klauspost/compress/s2"
 	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
 )
 
 // Compressor implements differnt kind of compression
@@ -38,6 +41,10 @@ const (
 	SnappyCompressorType CompressorType = "snappy"
 	// ZStandardCompressorType is for ZStandard
 	ZStandardCompressorType CompressorType = "zstd"
+	// Bzip2CompressorType is for Bzip2
+	Bzip2CompressorType CompressorType = "bzip2"
+	// Lz4CompressorType is for LZ4 (frame format)
+	Lz4CompressorType CompressorType = "lz4"
 )
 
 var AllCompressorType = []struct {
@@ -50,13 +57,33 @@ var AllCompressorType = []struct {
 	{GzipCompressorType, "GzipCompressorType"},
 	{SnappyCompressorType, "SnappyCompressorType"},
 	{ZStandardCompressorType, "ZStandardCompressorType"},
+	{Bzip2CompressorType, "Bzip2CompressorType"},
+	{Lz4CompressorType, "Lz4CompressorType"},
 }
 
-// Normalize converts to lowercase
+// Normalize converts to lowercase, with aliases
 func (ct CompressorType) Normalize() *CompressorType {
+	switch ct.String() {
+	case "gz":
+		return g.Ptr(GzipCompressorType)
+	case "bz2":
+		return g.Ptr(Bzip2CompressorType)
+	case "zstandard":
+		return g.Ptr(ZStandardCompressorType)
+	}
 	return g.Ptr(CompressorType(ct.String()))
 }
 
+// Validate checks the compression type, for writing
+func (ct CompressorType) Validate() error {
+	switch *ct.Normalize() {
+	case "", AutoCompressorType, NoneCompressorType, ZipCompressorType, GzipCompressorType,
+		SnappyCompressorType, ZStandardCompressorType, Bzip2CompressorType, Lz4CompressorType:
+		return nil
+	}
+	return g.Error("invalid compression: %s", ct)
+}
+
 // String converts to lowercase
 func (ct CompressorType) String() string {
 	return strings.ToLower(string(ct))
@@ -131,15 +158,25 @@ func Unzip(src string, dest string) (nodes []map[string]any, err error) {
 }
 
 func NewCompressor(cpType CompressorType) Compressor {
+	return NewCompressorLevel(cpType, 0)
+}
+
+// NewCompressorLevel returns a compressor with the compression level
+// (0 is the default level of the codec)
+func NewCompressorLevel(cpType CompressorType, level int) Compressor {
 	var compressor Compressor
 	switch cpType {
 	// case ZipCompressorType:
 	case GzipCompressorType:
-		compressor = &GzipCompressor{cpType: cpType, suffix: ".gz"}
+		compressor = &GzipCompressor{cpType: cpType, suffix: ".gz", level: level}
 	case SnappyCompressorType:
-		compressor = &SnappyCompressor{cpType: cpType, suffix: ".snappy"}
+		compressor = &SnappyCompressor{cpType: cpType, suffix: ".snappy", level: level}
 	case ZStandardCompressorType:
-		compressor = &ZStandardCompressor{cpType: cpType, suffix: ".zst"}
+		compressor = &ZStandardCompressor{cpType: cpType, suffix: ".zst", level: level}
+	case Bzip2CompressorType:
+		compressor = &Bzip2Compressor{cpType: cpType, suffix: ".bz2", level: level}
+	case Lz4CompressorType:
+		compressor = &Lz4Compressor{cpType: cpType, suffix: ".lz4", level: level}
 	default:
 		compressor = &NoneCompressor{cpType: NoneCompressorType, suffix: ""}
 	}
@@ -168,12 +205,18 @@ type GzipCompressor struct {
 	Compressor
 	cpType CompressorType
 	suffix string
+	level  int
 }
 
 // Compress uses gzip to compress
 func (cp *GzipCompressor) Compress(reader io.Reader) io.Reader {
+	level := gzip.BestSpeed
+	if cp.level > 0 {
+		level = min(cp.level, gzip.BestCompression)
+	}
+
 	pr, pw := io.Pipe()
-	gw, _ := gzip.NewWriterLevel(pw, gzip.BestSpeed)
+	gw, _ := gzip.NewWriterLevel(pw, level)
 	go func() {
 		_, err := io.Copy(gw, reader)
 		if err != nil {
@@ -204,13 +247,23 @@ type SnappyCompressor struct {
 	Compressor
 	cpType CompressorType
 	suffix string
+	level  int
 }
 
 // Compress uses gzip to compress
 func (cp *SnappyCompressor) Compress(reader io.Reader) io.Reader {
 
+	// levels 2 & 3 are better & best compression (slower)
+	opts := []s2.WriterOption{s2.WriterSnappyCompat()}
+	switch {
+	case cp.level == 2:
+		opts = append(opts, s2.WriterBetterCompression())
+	case cp.level >= 3:
+		opts = append(opts, s2.WriterBestCompression())
+	}
+
 	pr, pw := io.Pipe()
-	w := s2.NewWriter(pw)
+	w := s2.NewWriter(pw, opts...)
 	go func() {
 		_, err := io.Copy(w, reader)
 		if err != nil {
@@ -247,13 +300,19 @@ type ZStandardCompressor struct {
 	Compressor
 	cpType CompressorType
 	suffix string
+	level  int
 }
 
 // Compress uses gzip to compress
 func (cp *ZStandardCompressor) Compress(reader io.Reader) io.Reader {
 
+	level := zstd.SpeedFastest
+	if cp.level > 0 {
+		level = zstd.EncoderLevelFromZstd(cp.level) // zstd levels (1-22)
+	}
+
 	pr, pw := io.Pipe()
-	w, err := zstd.NewWriter(pw, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	w, err := zstd.NewWriter(pw, zstd.WithEncoderLevel(level))
 	if err != nil {
 		g.Warn("Could not compress using ZStandard")
 		return reader
@@ -284,6 +343,118 @@ func (cp *ZStandardCompressor) Suffix() string {
 	return cp.suffix
 }
 
+type Bzip2Compressor struct {
+	Compressor
+	cpType CompressorType
+	suffix string
+	level  int
+}
+
+// Compress uses bzip2 to compress. The errors are returned by the reader,
+// so that the stream is never written uncompressed.
+func (cp *Bzip2Compressor) Compress(reader io.Reader) io.Reader {
+
+	level := bzip2.DefaultCompression
+	if cp.level > 0 {
+		level = min(cp.level, bzip2.BestCompression) // levels 1-9
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := bzip2.NewWriter(pw, &bzip2.WriterConfig{Level: level})
+		if err != nil {
+			pw.CloseWithError(g.Error(err, "could not compress stream with bzip2"))
+			return
+		}
+
+		if _, err = io.Copy(w, reader); err != nil {
+			w.Close()
+			pw.CloseWithError(g.Error(err, "could not compress stream with bzip2"))
+			return
+		}
+		pw.CloseWithError(w.Close())
+	}()
+
+	return pr
+}
+
+// Decompress uses bzip2 to decompress
+func (cp *Bzip2Compressor) Decompress(reader io.Reader) (bReader io.Reader, err error) {
+	bReader, err = bzip2.NewReader(reader, nil)
+	if err != nil {
+		return nil, g.Error(err, "Error decompressing with bzip2")
+	}
+	return bReader, nil
+}
+
+func (cp *Bzip2Compressor) Suffix() string {
+	return cp.suffix
+}
+
+type Lz4Compressor struct {
+	Compressor
+	cpType CompressorType
+	suffix string
+	level  int
+}
+
+// Compress uses lz4 (frame format) to compress
+func (cp *Lz4Compressor) Compress(reader io.Reader) io.Reader {
+
+	pr, pw := io.Pipe()
+	w := lz4.NewWriter(pw)
+	if cp.level > 0 {
+		// levels 1-9, from fast to high compression
+		level := lz4.CompressionLevel(1 << (8 + min(cp.level, 9)))
+		if err := w.Apply(lz4.CompressionLevelOption(level)); err != nil {
+			g.Warn("could not set lz4 compression level: %s", err.Error())
+		}
+	}
+
+	go func() {
+		_, err := io.Copy(w, reader)
+		if err != nil {
+			g.LogError(g.Error(err, "could not compress stream with lz4"))
+		}
+		w.Close()
+		pw.Close()
+	}()
+
+	return pr
+}
+
+// Decompress uses lz4 to decompress
+func (cp *Lz4Compressor) Decompress(reader io.Reader) (lReader io.Reader, err error) {
+	return lz4.NewReader(reader), nil
+}
+
+func (cp *Lz4Compressor) Suffix() string {
+	return cp.suffix
+}
+
+// magic bytes of the compression formats
+var compressionMagicBytes = []struct {
+	cpType CompressorType
+	magic  []byte
+}{
+	{GzipCompressorType, []byte{0x1f, 0x8b}},
+	{ZStandardCompressorType, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{Bzip2CompressorType, []byte("BZh")},
+	{Lz4CompressorType, []byte{0x04, 0x22, 0x4d, 0x18}},
+	{SnappyCompressorType, []byte("\xff\x06\x00\x00sNaPpY")}, // framing format
+	{SnappyCompressorType, []byte("\xff\x06\x00\x00S2sTwO")}, // s2 stream
+}
+
+// DetectCompression returns the compression type from the magic bytes
+func DetectCompression(header []byte) CompressorType {
+	for _, cm := range compressionMagicBytes {
+		if bytes.HasPrefix(header, cm.magic) {
+			return cm.cpType
+		}
+	}
+	return NoneCompressorType
+}
+
 // AutoDecompress auto detects compression to decompress. Otherwise return same reader
 func AutoDecompress(reader io.Reader) (gReader io.Reader, err error) {
 	bReader, ok := reader.(*bufio.Reader)
@@ -291,21 +462,27 @@ func AutoDecompress(reader io.Reader) (gReader io.Reader, err error) {
 		bReader = bufio.NewReader(reader)
 	}
 
-	testBytes, err := bReader.Peek(2)
-	if err != nil {
+	testBytes, _ := bReader.Peek(10) // fewer bytes if short
+	if len(testBytes) < 2 {
 		// return bReader, g.Error(err, "Error Peeking")
 		return bReader, nil
 	}
 
 	// https://stackoverflow.com/a/28332019
-	if testBytes[0] == 31 && testBytes[1] == 139 {
-		// is gzip
+	switch cpType := DetectCompression(testBytes); cpType {
+	case GzipCompressorType:
 		gReader, err = gzip.NewReader(bReader)
 		if err != nil {
 			return bReader, g.Error(err, "Error using gzip.NewReader")
 		}
-	} else {
+	case NoneCompressorType:
 		gReader = bReader
+	default:
+		g.Trace("auto-decompressing %s", cpType)
+		gReader, err = NewCompressor(cpType).Decompress(bReader)
+		if err != nil {
+			return bReader, g.Error(err, "could not decompress %s", cpType)
+		}
 	}
 
 	return gReader, err
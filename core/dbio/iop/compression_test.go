@@ -1,9 +1,11 @@
 package iop
 
 import (
+	"bytes"
 	"io"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/flarco/g"
 	"github.com/stretchr/testify/assert"
@@ -45,4 +47,64 @@ func TestCompression(t *testing.T) {
 	g.AssertNoError(t, err)
 	assert.Equal(t, value, string(result))
 
+	// lz4
+	reader = strings.NewReader(value)
+	cp = NewCompressor(Lz4CompressorType)
+	cReader = cp.Compress(reader)
+	dReader, err = cp.Decompress(cReader)
+	g.AssertNoError(t, err)
+	result, err = io.ReadAll(dReader)
+	g.AssertNoError(t, err)
+	assert.Equal(t, value, string(result))
+
+	// bzip2, "testing" compressed with bzip2 -9
+	bz2Bytes := []byte{
+		0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x21, 0x3d,
+		0x8f, 0x48, 0x00, 0x00, 0x02, 0x81, 0x80, 0x02, 0xa1, 0x0c, 0x00, 0x20,
+		0x00, 0x30, 0xc0, 0x08, 0x63, 0x45, 0x11, 0x0b, 0x85, 0xdc, 0x91, 0x4e,
+		0x14, 0x24, 0x08, 0x4f, 0x63, 0xd2, 0x00,
+	}
+	dReader, err = NewCompressor(Bzip2CompressorType).Decompress(bytes.NewReader(bz2Bytes))
+	g.AssertNoError(t, err)
+	result, err = io.ReadAll(dReader)
+	g.AssertNoError(t, err)
+	assert.Equal(t, value, string(result))
+	assert.NoError(t, Bzip2CompressorType.Validate())
+	assert.NoError(t, CompressorType("ZSTD").Validate())
+
+	// levels & auto-detection from magic bytes
+	longValue := strings.Repeat(value+",", 1000)
+	for _, cpType := range []CompressorType{GzipCompressorType, ZStandardCompressorType, SnappyCompressorType, Lz4CompressorType, Bzip2CompressorType} {
+		for _, level := range []int{0, 1, 3, 9} {
+			cp = NewCompressorLevel(cpType, level)
+			compressed, err := io.ReadAll(cp.Compress(strings.NewReader(longValue)))
+			g.AssertNoError(t, err)
+			assert.Equal(t, cpType, DetectCompression(compressed), cpType)
+
+			dReader, err = AutoDecompress(bytes.NewReader(compressed))
+			g.AssertNoError(t, err)
+			result, err = io.ReadAll(dReader)
+			g.AssertNoError(t, err)
+			assert.Equal(t, longValue, string(result), "%s level %d", cpType, level)
+		}
+	}
+
+	dReader, err = AutoDecompress(bytes.NewReader(bz2Bytes))
+	g.AssertNoError(t, err)
+	result, err = io.ReadAll(dReader)
+	g.AssertNoError(t, err)
+	assert.Equal(t, value, string(result))
+
+	// bzip2 errors are returned, never written uncompressed
+	_, err = io.ReadAll(NewCompressor(Bzip2CompressorType).Compress(iotest.ErrReader(io.ErrUnexpectedEOF)))
+	assert.Error(t, err)
+
+	// uncompressed & short inputs are untouched
+	for _, raw := range []string{"", "a", value} {
+		dReader, err = AutoDecompress(strings.NewReader(raw))
+		g.AssertNoError(t, err)
+		result, err = io.ReadAll(dReader)
+		g.AssertNoError(t, err)
+		assert.Equal(t, raw, string(result))
+	}
 }
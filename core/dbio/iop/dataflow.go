@@ -32,6 +32,8 @@ type Dataflow struct {
 	closed          bool
 	mux             sync.Mutex
 	SchemaVersion   int // for column type version
+	rowThrottle     *Throttle
+	byteThrottle    *Throttle
 }
 
 // NewDataflow creates a new dataflow
@@ -238,6 +240,22 @@ func (df *Dataflow) SetReady() {
 	}
 }
 
+// SetThrottle limits the rows and bytes per second flowing through the
+// datastreams. A zero value means no limit.
+func (df *Dataflow) SetThrottle(rowsPerSecond, bytesPerSecond int64) {
+	df.mux.Lock()
+	defer df.mux.Unlock()
+	df.rowThrottle = NewThrottle(rowsPerSecond)
+	df.byteThrottle = NewThrottle(bytesPerSecond)
+}
+
+// throttles returns the row and byte throttles of the dataflow
+func (df *Dataflow) throttles() (rowThrottle, byteThrottle *Throttle) {
+	df.mux.Lock()
+	defer df.mux.Unlock()
+	return df.rowThrottle, df.byteThrottle
+}
+
 // SetEmpty sets all underlying datastreams empty
 func (df *Dataflow) SetEmpty() {
 	for _, ds := range df.Streams {
@@ -528,6 +546,17 @@ func (df *Dataflow) Count() (cnt uint64) {
 	return
 }
 
+// RejectCount returns the number of rows rejected or skipped (per `on_error`
+// or `oversize_policy`)
+func (df *Dataflow) RejectCount() (cnt uint64) {
+	if df != nil {
+		for _, ds := range df.Streams {
+			cnt += ds.RejectCount()
+		}
+	}
+	return
+}
+
 // AddEgressBytes add egress bytes
 func (df *Dataflow) AddEgressBytes(bytes uint64) {
 	df.EgressBytes = df.EgressBytes + bytes
@@ -10,10 +10,12 @@ import (
 	"path"
 	"runtime"
 	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	arrowCompress "github.com/apache/arrow/go/v16/parquet/compress"
 	"github.com/flarco/g"
@@ -65,6 +67,7 @@ type Datastream struct {
 	paused        bool
 	pauseChan     chan struct{}
 	unpauseChan   chan struct{}
+	throttled     uint64 // bytes already taken from the throttle
 }
 
 type schemaChg struct {
@@ -83,7 +86,13 @@ type FileStreamConfig struct {
 	IncrementalValue string            `json:"incremental_value"`
 	FileSelect       *[]string         `json:"file_select"`     // a list of files to include.
 	DuckDBFilename   bool              `json:"duckdb_filename"` // stream URL
+	Concurrency      int               `json:"concurrency"`     // number of files read in parallel
+	SplitSize        int64             `json:"split_size"`      // min bytes of the chunks of a file parsed in parallel
 	Props            map[string]string `json:"props"`
+
+	// iceberg time travel
+	SnapshotID        int64  `json:"snapshot_id"`
+	SnapshotTimestamp string `json:"snapshot_timestamp"`
 }
 
 func (sc *FileStreamConfig) ComputeWithDuckDB() bool {
@@ -120,11 +129,15 @@ type KeyValue struct {
 }
 
 type Metadata struct {
-	StreamURL KeyValue `json:"stream_url"`
-	LoadedAt  KeyValue `json:"loaded_at"`
-	RowNum    KeyValue `json:"row_num"`
-	RowID     KeyValue `json:"row_id"`
-	ExecID    KeyValue `json:"exec_id"`
+	StreamURL   KeyValue `json:"stream_url"`
+	LoadedAt    KeyValue `json:"loaded_at"`
+	RowNum      KeyValue `json:"row_num"`
+	RowID       KeyValue `json:"row_id"`
+	ExecID      KeyValue `json:"exec_id"`
+	StreamRunID KeyValue `json:"stream_run_id"`
+	SnapshotAt  KeyValue `json:"snapshot_at"`
+	Stream      KeyValue `json:"stream"`
+	RowHash     KeyValue `json:"row_hash"`
 }
 
 // AsMap return as map
@@ -277,13 +290,30 @@ func (ds *Datastream) SetEmpty() {
 	ds.empty = true
 }
 
-// SetConfig sets the ds.config values
-func (ds *Datastream) SetConfig(configMap map[string]string) {
+// throttle waits for the row (and the bytes counted since the last row)
+// when the dataflow is rate limited
+func (ds *Datastream) throttle() {
+	if ds.df == nil {
+		return
+	}
+
+	rowThrottle, byteThrottle := ds.df.throttles()
+	rowThrottle.Wait(ds.Context.Ctx, 1)
+	if byteThrottle != nil {
+		bytes := ds.Bytes.Load()
+		byteThrottle.Wait(ds.Context.Ctx, int64(bytes-ds.throttled))
+		ds.throttled = bytes
+	}
+}
+
+// SetConfig sets the ds.config values. It returns the error of an
+// invalid filter expression.
+func (ds *Datastream) SetConfig(configMap map[string]string) (err error) {
 	// lower the keys
 	for _, k := range lo.Keys(configMap) {
 		configMap[strings.ToLower(k)] = configMap[k]
 	}
-	ds.Sp.SetConfig(configMap)
+	err = ds.Sp.SetConfig(configMap)
 	ds.config = ds.Sp.Config
 
 	// set columns if empty
@@ -302,6 +332,8 @@ func (ds *Datastream) SetConfig(configMap map[string]string) {
 			ds.Columns[i].Constraint.parse()
 		}
 	}
+
+	return err
 }
 
 // GetConfig get config
@@ -393,13 +425,12 @@ func (ds *Datastream) WaitReady() error {
 
 // Defer runs a given function as close of Datastream
 func (ds *Datastream) Defer(f func()) {
-	ds.deferFuncs = append(ds.deferFuncs, f)
-
 	if ds.closed { // mutex?
-		for _, f := range ds.deferFuncs {
-			f()
-		}
+		f() // already closed, the other funcs have run
+		return
 	}
+
+	ds.deferFuncs = append(ds.deferFuncs, f)
 }
 
 // Close closes the datastream
@@ -535,6 +566,16 @@ func (ds *Datastream) SetIterator(it *Iterator) {
 }
 
 func (ds *Datastream) transformReader(reader io.Reader) (newReader io.Reader, decoded bool) {
+	// convert from the source encoding to UTF-8
+	if ds.Sp.Config.Encoding != "" {
+		newReader, err := ds.Sp.Config.DecodeReader(reader)
+		if err != nil {
+			ds.Context.CaptureErr(g.Error(err, "could not decode file"))
+			return reader, false
+		}
+		return newReader, newReader != reader
+	}
+
 	// decode File if requested
 	if transformsPayload, ok := ds.Sp.Config.Map["transforms"]; ok {
 		columnTransforms := makeColumnTransforms(transformsPayload)
@@ -864,6 +905,74 @@ skipBuffer:
 				return ds.Metadata.ExecID.Value
 			}
 		}
+
+		if ds.Metadata.StreamRunID.Key != "" {
+			ds.Metadata.StreamRunID.Key = ensureName(ds.Metadata.StreamRunID.Key)
+			col := Column{
+				Name:        ds.Metadata.StreamRunID.Key,
+				Type:        StringType,
+				Position:    len(ds.Columns) + 1,
+				Description: "Sling.Metadata.StreamRunID",
+				Metadata:    map[string]string{"sling_metadata": "stream_run_id"},
+			}
+			ds.Columns = append(ds.Columns, col)
+			metaValuesMap[col.Position-1] = func(it *Iterator) any {
+				return ds.Metadata.StreamRunID.Value
+			}
+		}
+
+		if ds.Metadata.SnapshotAt.Key != "" && ds.Metadata.SnapshotAt.Value != nil {
+			ds.Metadata.SnapshotAt.Key = ensureName(ds.Metadata.SnapshotAt.Key)
+			ds.Metadata.SnapshotAt.Value = cast.ToTime(ds.Metadata.SnapshotAt.Value)
+			col := Column{
+				Name:        ds.Metadata.SnapshotAt.Key,
+				Type:        TimestampzType,
+				Position:    len(ds.Columns) + 1,
+				Description: "Sling.Metadata.SnapshotAt",
+				Metadata:    map[string]string{"sling_metadata": "snapshot_at"},
+			}
+			ds.Columns = append(ds.Columns, col)
+			metaValuesMap[col.Position-1] = func(it *Iterator) any {
+				return ds.Metadata.SnapshotAt.Value
+			}
+		}
+
+		if ds.Metadata.Stream.Key != "" {
+			ds.Metadata.Stream.Key = ensureName(ds.Metadata.Stream.Key)
+			col := Column{
+				Name:        ds.Metadata.Stream.Key,
+				Type:        StringType,
+				Position:    len(ds.Columns) + 1,
+				Description: "Sling.Metadata.Stream",
+				Metadata:    map[string]string{"sling_metadata": "stream"},
+			}
+			ds.Columns = append(ds.Columns, col)
+			metaValuesMap[col.Position-1] = func(it *Iterator) any {
+				return ds.Metadata.Stream.Value
+			}
+		}
+
+		if ds.Metadata.RowHash.Key != "" {
+			// hash of the data values only (not the metadata values)
+			opts, _ := ds.Metadata.RowHash.Value.(RowHashOptions)
+			hasher, err := NewRowHasher(ds.Columns, opts)
+			if err != nil {
+				return g.Error(err, "could not init row hash")
+			}
+
+			ds.Metadata.RowHash.Key = ensureName(ds.Metadata.RowHash.Key)
+			col := Column{
+				Name:        ds.Metadata.RowHash.Key,
+				Type:        StringType,
+				Position:    len(ds.Columns) + 1,
+				Description: "Sling.Metadata.RowHash",
+				Metadata:    map[string]string{"sling_metadata": "row_hash"},
+			}
+			ds.Columns = append(ds.Columns, col)
+			metaValuesMap[col.Position-1] = func(it *Iterator) any {
+				return hasher.Hash(it.Row)
+			}
+		}
 	}
 
 	// setMetaValues sets mata column values
@@ -940,6 +1049,10 @@ skipBuffer:
 					goto loop
 				}
 
+				if !ds.Sp.FilterRow(row, ds.Columns) {
+					goto loop
+				}
+
 				if ds.Limited() {
 					break loop
 				}
@@ -999,6 +1112,7 @@ skipBuffer:
 				}
 				break loop
 			default:
+				ds.throttle()
 				ds.CurrentBatch.Push(row)
 			}
 		}
@@ -1011,6 +1125,10 @@ skipBuffer:
 		if !ds.NoDebug {
 			g.Trace("Pushed %d rows for %s", ds.it.Counter, ds.ID)
 		}
+
+		if ds.Sp.filteredCnt > 0 {
+			g.Debug("filter excluded %d rows for %s", ds.Sp.filteredCnt, ds.ID)
+		}
 	}()
 
 	return
@@ -1056,7 +1174,7 @@ func (ds *Datastream) ConsumeJsonReader(reader io.Reader) (err error) {
 	}
 
 	decoder := json.NewDecoder(reader2)
-	js := NewJSONStream(ds, decoder, ds.Sp.Config.Flatten, ds.Sp.Config.Jmespath)
+	js := NewJSONStream(ds, decoder, ds.Sp.Config.FlattenOptions(), ds.Sp.Config.Jmespath)
 	ds.it = ds.NewIterator(ds.Columns, js.NextFunc)
 
 	err = ds.Start()
@@ -1081,7 +1199,7 @@ func (ds *Datastream) ConsumeXmlReader(reader io.Reader) (err error) {
 	}
 
 	decoder := xml.NewDecoder(reader2)
-	js := NewJSONStream(ds, decoder, ds.Sp.Config.Flatten, ds.Sp.Config.Jmespath)
+	js := NewJSONStream(ds, decoder, ds.Sp.Config.FlattenOptions(), ds.Sp.Config.Jmespath)
 	ds.it = ds.NewIterator(ds.Columns, js.NextFunc)
 
 	err = ds.Start()
@@ -1120,7 +1238,7 @@ func (ds *Datastream) ConsumeJsonReaderChl(readerChn chan *ReaderReady, isXML bo
 		} else {
 			decoder = json.NewDecoder(reader2)
 		}
-		jsNew := NewJSONStream(ds, decoder, ds.Sp.Config.Flatten, ds.Sp.Config.Jmespath)
+		jsNew := NewJSONStream(ds, decoder, ds.Sp.Config.FlattenOptions(), ds.Sp.Config.Jmespath)
 
 		return jsNew, nil
 	}
@@ -1183,7 +1301,7 @@ func (ds *Datastream) ConsumeCsvReaderChl(readerChn chan *ReaderReady) (err erro
 
 	c := CSV{
 		NoHeader:        !ds.config.Header,
-		FieldsPerRecord: ds.config.FieldsPerRec,
+		FieldsPerRecord: ds.config.csvFieldsPerRecord(),
 		Escape:          ds.config.Escape,
 		Quote:           ds.config.Quote,
 		Delimiter:       rune(0),
@@ -1308,6 +1426,9 @@ func (ds *Datastream) ConsumeCsvReaderChl(readerChn chan *ReaderReady) (err erro
 
 			return false
 		} else if err != nil {
+			if it.ds.Sp.onParseError(err, row) {
+				goto processNext
+			}
 			it.ds.Context.CaptureErr(g.Error(err, "Error reading file"))
 			return false
 		}
@@ -1367,7 +1488,7 @@ func (ds *Datastream) ConsumeCsvReader(reader io.Reader) (err error) {
 	c := CSV{
 		Reader:          reader,
 		NoHeader:        !ds.config.Header,
-		FieldsPerRecord: ds.config.FieldsPerRec,
+		FieldsPerRecord: ds.config.csvFieldsPerRecord(),
 		Escape:          ds.config.Escape,
 		Quote:           ds.config.Quote,
 		Delimiter:       rune(0),
@@ -1422,11 +1543,15 @@ func (ds *Datastream) ConsumeCsvReader(reader io.Reader) (err error) {
 
 	nextFunc := func(it *Iterator) bool {
 
+	processNext:
 		row, err := r.Read()
 		if err == io.EOF {
 			c.File.Close()
 			return false
 		} else if err != nil {
+			if it.ds.Sp.onParseError(err, row) {
+				goto processNext
+			}
 			it.ds.Context.CaptureErr(g.Error(err, "Error reading file"))
 			return false
 		}
@@ -2172,53 +2297,34 @@ func (ds *Datastream) NewJsonReaderChnl(sc StreamConfig) (readerChn chan *io.Pip
 
 	readerChn <- pipe.Reader
 	tbw := int64(0)
+	bufW := bufio.NewWriterSize(pipe.Writer, jsonBufferSize)
 
 	go func() {
 		defer close(readerChn)
 
 		c := int64(0) // local counter
 
-		bw, _ := pipe.Writer.Write([]byte("["))
+		bw, _ := bufW.Write([]byte("["))
 		tbw = tbw + cast.ToInt64(bw)
 
 		for batch := range ds.BatchChan {
-			fields := batch.Columns.Names()
+			fieldOrder := jsonFieldOrder(batch.Columns)
 
 			for row0 := range batch.Rows {
 				c++
 
-				rec := g.M()
-				for i, val := range row0 {
-					if sVal, ok := val.(string); ok && batch.Columns[i].Type.IsJSON() {
-						if looksLikeJson(sVal) {
-							var v any
-							if err := g.Unmarshal(sVal, &v); err == nil {
-								val = v
-							}
-						} else if sVal == "null" {
-							val = nil
-						}
-					}
-					rec[fields[i]] = val
-				}
-
-				b, err := json.Marshal(rec)
-				if err != nil {
-					ds.Context.CaptureErr(g.Error(err, "error marshaling rec"))
-					ds.Context.Cancel()
-					pipe.Writer.Close()
-					return
-				}
-
 				if !firstRec {
-					bw, _ := pipe.Writer.Write([]byte{','}) // comma in between records
+					bw, _ := bufW.Write([]byte{','}) // comma in between records
 					tbw = tbw + cast.ToInt64(bw)
 				} else {
 					firstRec = false
 				}
 
-				bw, err := pipe.Writer.Write(b)
-				tbw = tbw + cast.ToInt64(bw)
+				bw, err := writeJsonRecord(bufW, batch.Columns, fieldOrder, row0, &sc)
+				tbw = tbw + bw
+				if err == nil {
+					err = bufW.Flush()
+				}
 				if err != nil {
 					ds.Context.CaptureErr(g.Error(err, "error writing row"))
 					ds.Context.Cancel()
@@ -2227,22 +2333,25 @@ func (ds *Datastream) NewJsonReaderChnl(sc StreamConfig) (readerChn chan *io.Pip
 				}
 
 				if (sc.FileMaxRows > 0 && c >= sc.FileMaxRows) || (sc.FileMaxBytes > 0 && tbw >= sc.FileMaxBytes) {
-					pipe.Writer.Write([]byte("]")) // close bracket
-					pipe.Writer.Close()            // close the prior reader?
-					tbw = 0                        // reset
+					bufW.Write([]byte("]")) // close bracket
+					bufW.Flush()
+					pipe.Writer.Close() // close the prior reader?
+					tbw = 0             // reset
 
 					// new reader
 					c = 0
 					firstRec = true
 					pipe = g.NewPipe()
+					bufW.Reset(pipe.Writer)
 					readerChn <- pipe.Reader
-					bw, _ := pipe.Writer.Write([]byte("["))
+					bw, _ := bufW.Write([]byte("["))
 					tbw = tbw + cast.ToInt64(bw)
 				}
 			}
 		}
 
-		pipe.Writer.Write([]byte("]")) // close bracket
+		bufW.Write([]byte("]")) // close bracket
+		bufW.Flush()
 		pipe.Writer.Close()
 	}()
 
@@ -2258,6 +2367,7 @@ func (ds *Datastream) NewJsonLinesReaderChnl(sc StreamConfig) (readerChn chan *i
 
 	readerChn <- pipe.Reader
 	tbw := int64(0)
+	bufW := bufio.NewWriterSize(pipe.Writer, jsonBufferSize)
 
 	go func() {
 		defer close(readerChn)
@@ -2265,36 +2375,20 @@ func (ds *Datastream) NewJsonLinesReaderChnl(sc StreamConfig) (readerChn chan *i
 		c := int64(0) // local counter
 
 		for batch := range ds.BatchChan {
-			fields := batch.Columns.Names()
+			fieldOrder := jsonFieldOrder(batch.Columns)
 
 			for row0 := range batch.Rows {
 				c++
 
-				rec := g.M()
-				for i, val := range row0 {
-					if sVal, ok := val.(string); ok && batch.Columns[i].Type.IsJSON() {
-						if looksLikeJson(sVal) {
-							var v any
-							if err := g.Unmarshal(sVal, &v); err == nil {
-								val = v
-							}
-						} else if sVal == "null" {
-							val = nil
-						}
-					}
-					rec[fields[i]] = val
+				bw, err := writeJsonRecord(bufW, batch.Columns, fieldOrder, row0, &sc)
+				tbw = tbw + bw
+				if err == nil {
+					err = bufW.WriteByte('\n')
+					tbw++
 				}
-
-				b, err := json.Marshal(rec)
-				if err != nil {
-					ds.Context.CaptureErr(g.Error(err, "error marshaling rec"))
-					ds.Context.Cancel()
-					pipe.Writer.Close()
-					return
+				if err == nil {
+					err = bufW.Flush()
 				}
-
-				bw, err := pipe.Writer.Write(append(b, '\n'))
-				tbw = tbw + cast.ToInt64(bw)
 				if err != nil {
 					ds.Context.CaptureErr(g.Error(err, "error writing row"))
 					ds.Context.Cancel()
@@ -2309,6 +2403,7 @@ func (ds *Datastream) NewJsonLinesReaderChnl(sc StreamConfig) (readerChn chan *i
 					// new reader
 					c = 0
 					pipe = g.NewPipe()
+					bufW.Reset(pipe.Writer)
 					readerChn <- pipe.Reader
 				}
 			}
@@ -2319,6 +2414,147 @@ func (ds *Datastream) NewJsonLinesReaderChnl(sc StreamConfig) (readerChn chan *i
 	return readerChn
 }
 
+const (
+	jsonBufferSize = 64 * 1024  // buffer size of the json writers
+	jsonLargeField = 256 * 1024 // text values over this size are streamed
+)
+
+// jsonFieldOrder returns the column indexes ordered by field name, so that
+// the keys are sorted (as when marshalling a map). With duplicate names,
+// the last column is used.
+func jsonFieldOrder(columns Columns) (order []int) {
+	indexes := map[string]int{}
+	for i, col := range columns {
+		indexes[col.Name] = i
+	}
+
+	names := lo.Keys(indexes)
+	sort.Strings(names)
+	for _, name := range names {
+		order = append(order, indexes[name])
+	}
+	return
+}
+
+// writeJsonRecord writes a row as a JSON object. Large text values are
+// written directly from the row value, instead of being copied into a
+// marshalled record, so that wide rows do not multiply memory usage.
+func writeJsonRecord(w *bufio.Writer, columns Columns, order []int, row []any, sc *StreamConfig) (tbw int64, err error) {
+	write := func(b []byte) {
+		if err == nil {
+			var bw int
+			bw, err = w.Write(b)
+			tbw = tbw + int64(bw)
+		}
+	}
+
+	write([]byte{'{'})
+	for n, i := range order {
+		if n > 0 {
+			write([]byte{','})
+		}
+
+		key, _ := json.Marshal(columns[i].Name)
+		write(key)
+		write([]byte{':'})
+
+		var val any
+		if i < len(row) {
+			val = row[i]
+		}
+
+		if sVal, ok := val.(string); ok && columns[i].Type.IsJSON() {
+			if len(sVal) > jsonLargeField && looksLikeJson(sVal) && json.Valid([]byte(sVal)) {
+				write([]byte(sVal)) // already JSON, no need to parse
+				continue
+			} else if looksLikeJson(sVal) {
+				var v any
+				if err := g.Unmarshal(sVal, &v); err == nil {
+					val = v
+				}
+			} else if sVal == "null" {
+				val = nil
+			}
+		} else if val != nil && sc.BinaryEncoding != "" && columns[i].IsBinary() {
+			val = sc.EncodeBinary(val) // base64 by default, from marshalling
+		}
+
+		if sVal, ok := val.(string); ok && len(sVal) > jsonLargeField {
+			if err == nil {
+				var bw int64
+				bw, err = writeJsonString(w, sVal)
+				tbw = tbw + bw
+			}
+			continue
+		}
+
+		b, mErr := json.Marshal(val)
+		if mErr != nil {
+			return tbw, g.Error(mErr, "error marshaling value of %s", columns[i].Name)
+		}
+		write(b)
+	}
+	write([]byte{'}'})
+
+	return tbw, err
+}
+
+// writeJsonString writes a quoted and escaped JSON string, in chunks.
+// Invalid UTF-8 is replaced with U+FFFD, as when marshalling.
+func writeJsonString(w *bufio.Writer, s string) (tbw int64, err error) {
+	const hexChars = "0123456789abcdef"
+
+	write := func(str string) {
+		if err == nil {
+			var bw int
+			bw, err = w.WriteString(str)
+			tbw = tbw + int64(bw)
+		}
+	}
+
+	write(`"`)
+	start := 0
+	for i := 0; i < len(s) && err == nil; {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+
+			write(s[start:i])
+			switch c {
+			case '"', '\\':
+				write(`\` + string(c))
+			case '\n':
+				write(`\n`)
+			case '\r':
+				write(`\r`)
+			case '\t':
+				write(`\t`)
+			default:
+				write(`\u00` + string(hexChars[c>>4]) + string(hexChars[c&0xF]))
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			write(s[start:i])
+			write("\ufffd")
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	write(s[start:])
+	write(`"`)
+
+	return tbw, err
+}
+
 // NewParquetArrowReaderChnl provides a channel of readers as the limit is reached
 // each channel flows as fast as the consumer consumes
 // WARN: Not using this one since it doesn't write Decimals properly.
@@ -2333,6 +2569,7 @@ func (ds *Datastream) NewParquetArrowReaderChnl(sc StreamConfig) (readerChn chan
 		var pw *ParquetArrowWriter
 		var br *BatchReader
 		var err error
+		var cb *ColumnBatch
 
 		defer close(readerChn)
 
@@ -2368,6 +2605,7 @@ func (ds *Datastream) NewParquetArrowReaderChnl(sc StreamConfig) (readerChn chan
 			if err != nil {
 				return g.Error(err, "could not create parquet writer")
 			}
+			cb = NewColumnBatch(pw.Columns(), DefaultColumnBatchSize)
 
 			return nil
 		}
@@ -2381,16 +2619,26 @@ func (ds *Datastream) NewParquetArrowReaderChnl(sc StreamConfig) (readerChn chan
 				}
 			}
 
-			for row := range batch.Rows {
-				err := pw.WriteRow(row)
+			// rows are written in typed column batches
+			for {
+				limit := DefaultColumnBatchSize
+				if sc.FileMaxRows > 0 {
+					limit = int(min(int64(limit), sc.FileMaxRows-br.Counter))
+				}
+				n := batch.NextColumnBatch(cb, limit)
+				if n == 0 {
+					break
+				}
+
+				err := pw.WriteColumnBatch(cb)
 				if err != nil {
-					ds.Context.CaptureErr(g.Error(err, "error writing row"))
+					ds.Context.CaptureErr(g.Error(err, "error writing rows"))
 					ds.Context.Cancel()
 					pipeW.Close()
 					return
 				}
 
-				br.Counter++
+				br.Counter += int64(n)
 
 				if (sc.FileMaxRows > 0 && br.Counter >= sc.FileMaxRows) || (sc.FileMaxBytes > 0 && tbw >= sc.FileMaxBytes) {
 					err = nextPipe(batch)
@@ -0,0 +1,241 @@
+package iop
+
+import (
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// DefaultColumnBatchSize is the number of rows of a column batch
+var DefaultColumnBatchSize = 1024
+
+// VectorKind is the physical type of the values of a column vector
+type VectorKind int
+
+const (
+	VectorString VectorKind = iota
+	VectorInt
+	VectorFloat
+	VectorBool
+	VectorTime
+)
+
+// ColumnVector holds the values of a column in a typed slice, with
+// the validity of each value (false if null). Only the slice
+// of the vector kind is used.
+type ColumnVector struct {
+	Column  *Column
+	Kind    VectorKind
+	Valid   []bool
+	Ints    []int64
+	Floats  []float64
+	Bools   []bool
+	Times   []time.Time
+	Strings []string
+}
+
+// NewColumnVector creates a vector for the column type.
+// Decimals are kept as strings, to preserve the precision.
+func NewColumnVector(col *Column, capacity int) (v *ColumnVector) {
+	v = &ColumnVector{Column: col, Valid: make([]bool, 0, capacity)}
+	switch {
+	case col.IsInteger():
+		v.Kind = VectorInt
+		v.Ints = make([]int64, 0, capacity)
+	case col.IsFloat():
+		v.Kind = VectorFloat
+		v.Floats = make([]float64, 0, capacity)
+	case col.IsBool():
+		v.Kind = VectorBool
+		v.Bools = make([]bool, 0, capacity)
+	case col.IsDatetime() || col.IsDate():
+		v.Kind = VectorTime
+		v.Times = make([]time.Time, 0, capacity)
+	default:
+		v.Kind = VectorString
+		v.Strings = make([]string, 0, capacity)
+	}
+	return v
+}
+
+// Len returns the number of values
+func (v *ColumnVector) Len() int {
+	return len(v.Valid)
+}
+
+// Append casts and appends a value. Values which cannot be cast
+// are appended as the zero value, as with the row writers.
+func (v *ColumnVector) Append(val any) {
+	v.Valid = append(v.Valid, val != nil)
+
+	switch v.Kind {
+	case VectorInt:
+		switch tVal := val.(type) {
+		case int64:
+			v.Ints = append(v.Ints, tVal)
+		case int:
+			v.Ints = append(v.Ints, int64(tVal))
+		case nil:
+			v.Ints = append(v.Ints, 0)
+		default:
+			v.Ints = append(v.Ints, cast.ToInt64(val))
+		}
+	case VectorFloat:
+		switch tVal := val.(type) {
+		case float64:
+			v.Floats = append(v.Floats, tVal)
+		case nil:
+			v.Floats = append(v.Floats, 0)
+		default:
+			v.Floats = append(v.Floats, cast.ToFloat64(val))
+		}
+	case VectorBool:
+		switch tVal := val.(type) {
+		case bool:
+			v.Bools = append(v.Bools, tVal)
+		case nil:
+			v.Bools = append(v.Bools, false)
+		default:
+			v.Bools = append(v.Bools, cast.ToBool(val))
+		}
+	case VectorTime:
+		switch tVal := val.(type) {
+		case time.Time:
+			v.Times = append(v.Times, tVal)
+		case nil:
+			v.Times = append(v.Times, time.Time{})
+		default:
+			tVal2, _ := cast.ToTimeE(val)
+			v.Times = append(v.Times, tVal2)
+		}
+	default:
+		switch tVal := val.(type) {
+		case string:
+			v.Strings = append(v.Strings, tVal)
+		case []byte:
+			v.Strings = append(v.Strings, string(tVal))
+		case nil:
+			v.Strings = append(v.Strings, "")
+		default:
+			v.Strings = append(v.Strings, cast.ToString(val))
+		}
+	}
+}
+
+// Value returns the value at index i, nil if null
+func (v *ColumnVector) Value(i int) any {
+	if !v.Valid[i] {
+		return nil
+	}
+	switch v.Kind {
+	case VectorInt:
+		return v.Ints[i]
+	case VectorFloat:
+		return v.Floats[i]
+	case VectorBool:
+		return v.Bools[i]
+	case VectorTime:
+		return v.Times[i]
+	default:
+		return v.Strings[i]
+	}
+}
+
+// Reset truncates the vector, keeping the allocated slices
+func (v *ColumnVector) Reset() {
+	v.Valid = v.Valid[:0]
+	v.Ints = v.Ints[:0]
+	v.Floats = v.Floats[:0]
+	v.Bools = v.Bools[:0]
+	v.Strings = v.Strings[:0]
+	// release the time locations & strings held
+	clear(v.Times[:cap(v.Times)])
+	v.Times = v.Times[:0]
+}
+
+// ColumnBatch holds a batch of rows in typed column vectors, instead of a
+// []any per row. The vectors are reused from one batch to the next, so
+// the writers of columnar formats do not allocate per row.
+type ColumnBatch struct {
+	Columns  Columns
+	Vectors  []*ColumnVector
+	capacity int
+}
+
+// NewColumnBatch creates a column batch holding up to capacity rows
+func NewColumnBatch(columns Columns, capacity int) (cb *ColumnBatch) {
+	if capacity <= 0 {
+		capacity = DefaultColumnBatchSize
+	}
+	cb = &ColumnBatch{Columns: columns, capacity: capacity}
+	cb.Vectors = make([]*ColumnVector, len(columns))
+	for i := range columns {
+		cb.Vectors[i] = NewColumnVector(&cb.Columns[i], capacity)
+	}
+	return cb
+}
+
+// Len returns the number of rows
+func (cb *ColumnBatch) Len() int {
+	if len(cb.Vectors) == 0 {
+		return 0
+	}
+	return cb.Vectors[0].Len()
+}
+
+// Cap returns the maximum number of rows
+func (cb *ColumnBatch) Cap() int {
+	return cb.capacity
+}
+
+// Full returns true if the batch is at capacity
+func (cb *ColumnBatch) Full() bool {
+	return cb.Len() >= cb.capacity
+}
+
+// Append appends a row. Missing values are null, extra values are ignored.
+func (cb *ColumnBatch) Append(row []any) {
+	for i, v := range cb.Vectors {
+		if i < len(row) {
+			v.Append(row[i])
+		} else {
+			v.Append(nil)
+		}
+	}
+}
+
+// Row returns the row at index i, for the consumers of rows
+func (cb *ColumnBatch) Row(i int) (row []any) {
+	row = make([]any, len(cb.Vectors))
+	for c, v := range cb.Vectors {
+		row[c] = v.Value(i)
+	}
+	return row
+}
+
+// Reset truncates the batch, to be refilled
+func (cb *ColumnBatch) Reset() {
+	for _, v := range cb.Vectors {
+		v.Reset()
+	}
+}
+
+// NextColumnBatch resets cb and fills it with the next rows of the batch,
+// up to its capacity or limit (if > 0). It returns the number of rows,
+// 0 once the batch is closed and drained.
+func (b *Batch) NextColumnBatch(cb *ColumnBatch, limit int) (n int) {
+	cb.Reset()
+	if limit <= 0 || limit > cb.capacity {
+		limit = cb.capacity
+	}
+
+	for n < limit {
+		row, ok := <-b.Rows
+		if !ok {
+			break
+		}
+		cb.Append(row)
+		n++
+	}
+	return n
+}
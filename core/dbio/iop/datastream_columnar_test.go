@@ -0,0 +1,100 @@
+package iop
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumnBatch(t *testing.T) {
+	columns := NewColumns(
+		Columns{
+			{Name: "col_string", Type: StringType},
+			{Name: "col_bool", Type: BoolType},
+			{Name: "col_bigint", Type: BigIntType},
+			{Name: "col_decimal", Type: DecimalType},
+			{Name: "col_float", Type: FloatType},
+			{Name: "col_timestamp", Type: TimestampType},
+		}...,
+	)
+
+	now := time.Now().UTC()
+	cb := NewColumnBatch(columns, 2)
+	assert.Equal(t, VectorString, cb.Vectors[0].Kind)
+	assert.Equal(t, VectorBool, cb.Vectors[1].Kind)
+	assert.Equal(t, VectorInt, cb.Vectors[2].Kind)
+	assert.Equal(t, VectorString, cb.Vectors[3].Kind)
+	assert.Equal(t, VectorFloat, cb.Vectors[4].Kind)
+	assert.Equal(t, VectorTime, cb.Vectors[5].Kind)
+
+	cb.Append([]any{"hello", true, 12, "12.33", 1.5, now})
+	cb.Append([]any{nil, nil, "34"}) // missing values are null
+	assert.Equal(t, 2, cb.Len())
+	assert.True(t, cb.Full())
+
+	assert.Equal(t, []any{"hello", true, int64(12), "12.33", 1.5, now}, cb.Row(0))
+	assert.Equal(t, []any{nil, nil, int64(34), nil, nil, nil}, cb.Row(1))
+
+	cb.Reset()
+	assert.Equal(t, 0, cb.Len())
+	assert.Equal(t, 2, cap(cb.Vectors[2].Ints)) // buffers are reused
+}
+
+func TestColumnBatchParquet(t *testing.T) {
+	columns := NewColumns(
+		Columns{
+			{Name: "id", Type: BigIntType},
+			{Name: "name", Type: StringType},
+			{Name: "amount", Type: DecimalType},
+			{Name: "rate", Type: FloatType},
+			{Name: "active", Type: BoolType},
+			{Name: "created", Type: TimestampType},
+		}...,
+	)
+
+	total := 2500
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	data := NewDataset(columns)
+	for i := 0; i < total; i++ {
+		data.Append([]any{int64(i), cast.ToString(i), "12.50", float64(i) / 2, i%2 == 0, created})
+	}
+
+	// split into files of 1000 rows
+	files := [][]byte{}
+	for br := range data.Stream().NewParquetArrowReaderChnl(StreamConfig{FileMaxRows: 1000}) {
+		content, err := io.ReadAll(br.Reader)
+		assert.NoError(t, err)
+		files = append(files, content)
+	}
+	if !assert.Len(t, files, 3) {
+		return
+	}
+
+	counts := []int{}
+	rows := [][]any{}
+	for _, content := range files {
+		ds := NewDatastream(nil)
+		err := ds.ConsumeParquetReader(bytes.NewReader(content))
+		if !assert.NoError(t, err) {
+			return
+		}
+		data, err := ds.Collect(0)
+		assert.NoError(t, err)
+		counts = append(counts, len(data.Rows))
+		rows = append(rows, data.Rows...)
+	}
+	assert.Equal(t, []int{1000, 1000, 500}, counts)
+
+	if assert.Len(t, rows, total) {
+		assert.EqualValues(t, 1234, cast.ToInt(rows[1234][0]))
+		assert.Equal(t, "1234", cast.ToString(rows[1234][1]))
+		assert.EqualValues(t, 12.5, cast.ToFloat64(rows[1234][2]))
+		assert.EqualValues(t, 617, cast.ToFloat64(rows[1234][3]))
+		assert.Equal(t, true, cast.ToBool(rows[1234][4]))
+		assert.Equal(t, created, cast.ToTime(rows[1234][5]).UTC())
+	}
+}
@@ -45,6 +45,11 @@ type Column struct {
 
 	Constraint *ColumnConstraint `json:"constraint,omitempty"`
 	Metadata   map[string]string `json:"metadata,omitempty"`
+
+	// Default is the default value of the column when it is added to a
+	// target table, also used to backfill the existing rows. Strings are
+	// quoted, unless an SQL expression (such as `current_timestamp`).
+	Default any `json:"default,omitempty"`
 }
 
 // Columns represent many columns
@@ -166,7 +171,9 @@ func IsDummy(columns []Column) bool {
 // NewColumnsFromFields creates Columns from fields
 func NewColumns(cols ...Column) Columns {
 	for i, col := range cols {
-		if string(col.Type) == "" || !col.Type.IsValid() {
+		if string(col.Type) == "" && col.Default != nil {
+			// only a default is specified, keep type unset so it is not cast
+		} else if string(col.Type) == "" || !col.Type.IsValid() {
 			cols[i].Type = StringType
 		}
 		cols[i].Position = i + 1
@@ -335,6 +342,7 @@ func (cols Columns) Clone() (newCols Columns) {
 			Database:    col.Database,
 			Metadata:    col.Metadata,
 			Constraint:  col.Constraint,
+			Default:     col.Default,
 		}
 	}
 	return newCols
@@ -551,6 +559,10 @@ func (cols Columns) Coerce(castCols Columns, hasHeader bool) (newCols Columns) {
 			// assume same order since same number of columns and no header
 			col = castCols[i]
 			newCols[i].Name = col.Name
+			newCols[i].Default = col.Default
+			if col.Type == "" {
+				continue // only a default was provided
+			}
 			newCols[i].Type = col.Type
 			newCols[i].Stats.MaxLen = lo.Ternary(col.Stats.MaxLen > 0, col.Stats.MaxLen, newCols[i].Stats.MaxLen)
 			newCols[i].DbPrecision = lo.Ternary(col.DbPrecision > 0, col.DbPrecision, newCols[i].DbPrecision)
@@ -565,7 +577,10 @@ func (cols Columns) Coerce(castCols Columns, hasHeader bool) (newCols Columns) {
 
 		if j, found := colMap[strings.ToLower(col.Name)]; found {
 			col = castCols[j]
-			if col.Type.IsValid() {
+			newCols[i].Default = col.Default
+			if col.Type == "" {
+				// only a default was provided, keep the type
+			} else if col.Type.IsValid() {
 				g.Debug("casting column '%s' as '%s'", col.Name, col.Type)
 				newCols[i].Type = col.Type
 				newCols[i].Stats.MaxLen = lo.Ternary(col.Stats.MaxLen > 0, col.Stats.MaxLen, newCols[i].Stats.MaxLen)
@@ -876,6 +891,17 @@ func (col *Column) SetLengthPrecisionScale() {
 	}
 }
 
+// DecimalPrecisionScale returns the precision and scale of a decimal column:
+// the sourced values if provided, otherwise defaults for the inferred values
+func (col *Column) DecimalPrecisionScale() (precision, scale int) {
+	if col.Sourced && col.DbPrecision > 0 {
+		return col.DbPrecision, lo.Clamp(col.DbScale, 0, col.DbPrecision)
+	}
+	precision = lo.Ternary(col.DbPrecision == 0, 28, lo.Ternary(col.DbPrecision > 36, 36, col.DbPrecision))
+	scale = lo.Ternary(col.DbScale == 0, 9, lo.Ternary(col.DbScale > 16, 16, col.DbScale))
+	return precision, lo.Ternary(scale > precision, precision, scale)
+}
+
 // EvaluateConstraint evaluates a value against the constraint function
 func (col *Column) EvaluateConstraint(value any, sp *StreamProcessor) (err error) {
 	if c := col.Constraint; c.EvalFunc != nil && !c.EvalFunc(value) {
@@ -897,6 +923,14 @@ func (col *Column) SetMetadata(key string, value string) {
 	col.Metadata[key] = value
 }
 
+// IsNotNull returns true if the column is flagged with a NOT NULL constraint
+func (col *Column) IsNotNull() bool {
+	if col.Metadata == nil {
+		return false
+	}
+	return cast.ToBool(col.Metadata["not_null"])
+}
+
 func (col *Column) IsKeyType(keyType KeyType) bool {
 	if col.Metadata == nil {
 		return false
@@ -937,6 +971,8 @@ func (col *Column) GoType() reflect.Type {
 		return reflect.TypeOf(float64(6.6))
 	case col.IsFloat():
 		return reflect.TypeOf(float64(6.6))
+	case col.IsBinary():
+		return reflect.TypeOf([]byte{})
 	}
 
 	return reflect.TypeOf("string")
@@ -1178,6 +1214,12 @@ func (col *Column) GetNativeType(t dbio.Type) (nativeType string, err error) {
 			precision = lo.Ternary(precision < minPrecision, minPrecision, precision)
 		}
 
+		// the sourced precision can exceed the maximum of the target database
+		if maxPrecision := cast.ToInt(template.Value("variable.max_decimal_precision")); maxPrecision > 0 && precision > maxPrecision {
+			precision = maxPrecision
+		}
+		scale = lo.Clamp(scale, 0, precision)
+
 		nativeType = strings.ReplaceAll(
 			nativeType,
 			"(,)",
@@ -1205,6 +1247,8 @@ func NativeTypeToGeneral(name, dbType string, connType dbio.Type) (colType Colum
 		if strings.HasSuffix(dbType, "[]") {
 			dbType = "list"
 		}
+	} else if connType == dbio.TypeDbFirebolt {
+		dbType = strings.TrimSuffix(dbType, " null")
 	}
 
 	dbType = strings.Split(strings.ToLower(dbType), "(")[0]
@@ -6,6 +6,7 @@ import (
 
 	"github.com/flarco/g"
 	"github.com/shopspring/decimal"
+	"github.com/slingdata-io/sling-cli/core/dbio"
 	"github.com/spf13/cast"
 	"github.com/stretchr/testify/assert"
 )
@@ -313,6 +314,28 @@ func TestParseDecimal(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestDecimalNativeType(t *testing.T) {
+	col := Column{Name: "amount", Type: DecimalType, Sourced: true, DbPrecision: 50, DbScale: 20}
+
+	// sourced precision & scale are kept, within the maximum of the database
+	nativeType, err := col.GetNativeType(dbio.TypeDbMySQL)
+	assert.NoError(t, err)
+	assert.Equal(t, "decimal(50,20)", nativeType)
+
+	nativeType, err = col.GetNativeType(dbio.TypeDbSnowflake)
+	assert.NoError(t, err)
+	assert.Equal(t, "decimal(38,20)", nativeType)
+
+	nativeType, err = col.GetNativeType(dbio.TypeDbPostgres)
+	assert.NoError(t, err)
+	assert.Equal(t, "numeric", nativeType)
+
+	col = Column{Name: "amount", Type: DecimalType, Sourced: true, DbPrecision: 12, DbScale: 4}
+	nativeType, err = col.GetNativeType(dbio.TypeDbSQLServer)
+	assert.NoError(t, err)
+	assert.Equal(t, "decimal(12,4)", nativeType)
+}
+
 func TestDatasetSort(t *testing.T) {
 	columns := NewColumnsFromFields("col1", "col2")
 	data := NewDataset(columns)
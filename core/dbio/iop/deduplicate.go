@@ -0,0 +1,468 @@
+package iop
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/spf13/cast"
+)
+
+// DeduplicateMaxMemKeys is the number of row keys held in memory
+// before the seen keys are spilled to disk
+var DeduplicateMaxMemKeys = 5000000
+
+// DeduplicateOptions are the options to drop duplicate rows
+type DeduplicateOptions struct {
+	Keys       []string // columns identifying a row. All data columns if empty
+	KeepLast   bool     // keep the last occurrence instead of the first
+	MaxMemKeys int      // number of keys held in memory before spilling to disk
+}
+
+// Deduplicator detects duplicate rows by hashing the key column values
+type Deduplicator struct {
+	Dropped uint64
+
+	opts   DeduplicateOptions
+	keyIdx []int
+	set    *spillHashSet
+	folder string
+	buf    bytes.Buffer
+}
+
+type rowKey [16]byte
+
+// NewDeduplicator creates a new deduplicator for the provided columns
+func NewDeduplicator(columns Columns, opts DeduplicateOptions) (d *Deduplicator, err error) {
+	d = &Deduplicator{opts: opts}
+
+	if len(opts.Keys) > 0 {
+		for _, key := range opts.Keys {
+			col := columns.GetColumn(key)
+			if col == nil {
+				return nil, g.Error("deduplicate key column not found: %s", key)
+			}
+			d.keyIdx = append(d.keyIdx, col.Position-1)
+		}
+	} else {
+		// use all columns, except sling metadata columns (which are unique per row)
+		for i, col := range columns {
+			if col.Metadata["sling_metadata"] == "" {
+				d.keyIdx = append(d.keyIdx, i)
+			}
+		}
+	}
+
+	if opts.MaxMemKeys <= 0 {
+		d.opts.MaxMemKeys = DeduplicateMaxMemKeys
+	}
+
+	d.folder = path.Join(env.GetTempFolder(), "dedup", g.RandSuffix("set_", 6))
+	d.set = newSpillHashSet(d.folder, d.opts.MaxMemKeys)
+
+	return d, nil
+}
+
+// Key returns the hash key of the row
+func (d *Deduplicator) Key(row []any) (key rowKey) {
+	d.buf.Reset()
+	for _, i := range d.keyIdx {
+		if i >= len(row) || row[i] == nil {
+			d.buf.WriteByte(0)
+			continue
+		}
+		d.buf.WriteByte(1)
+		d.buf.WriteString(cast.ToString(row[i]))
+		d.buf.WriteByte(0x1f) // unit separator
+	}
+
+	h := fnv.New128a()
+	h.Write(d.buf.Bytes())
+	copy(key[:], h.Sum(nil))
+	return
+}
+
+// IsDuplicate returns true if the row key was seen before.
+// The row key is registered if not.
+func (d *Deduplicator) IsDuplicate(row []any) (bool, error) {
+	added, err := d.set.Add(d.Key(row))
+	if err != nil {
+		return false, g.Error(err, "could not register row key")
+	} else if !added {
+		d.Dropped++
+	}
+	return !added, nil
+}
+
+// Close removes the spilled files
+func (d *Deduplicator) Close() {
+	d.set.Close()
+	env.RemoveAllLocalTempFile(d.folder)
+}
+
+// DeduplicateDataflow returns a new dataflow without the duplicate rows.
+// The streams are merged so that duplicates are detected across all of them.
+// When keeping the last occurrence, the whole stream is spilled to disk
+// before the first row is returned.
+func DeduplicateDataflow(df *Dataflow, opts DeduplicateOptions) (dfN *Dataflow, err error) {
+	dedup, err := NewDeduplicator(df.Columns, opts)
+	if err != nil {
+		return df, err
+	}
+
+	config := df.StreamConfig()
+	dsM := MergeDataflow(df)
+	rows := dsM.Rows()
+
+	var nextFunc func(it *Iterator) bool
+	if opts.KeepLast {
+		nextFunc = dedupKeepLastFunc(dedup, rows)
+	} else {
+		nextFunc = func(it *Iterator) bool {
+			for row := range rows {
+				duplicate, err := dedup.IsDuplicate(row)
+				if err != nil {
+					it.Context.CaptureErr(err)
+					return false
+				} else if !duplicate {
+					it.Row = row
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	dsN := NewDatastreamIt(df.Context.Ctx, dsM.Columns, nextFunc)
+	dsN.it.IsCasted = !opts.KeepLast // kept-last rows are read back as strings
+	dsN.Inferred = true
+	dsN.Sp.Config = config
+	dsN.config = config
+	dsN.Defer(func() {
+		if err := dsM.Err(); err != nil {
+			dsN.Context.CaptureErr(err)
+		}
+		if dedup.Dropped > 0 {
+			g.Debug("deduplicate dropped %d rows", dedup.Dropped)
+		}
+		dedup.Close()
+	})
+
+	if err = dsN.Start(); err != nil {
+		dedup.Close()
+		return df, g.Error(err, "could not start deduplicate stream")
+	}
+
+	dfN, err = MakeDataFlow(dsN)
+	if err != nil {
+		return df, g.Error(err, "could not make deduplicated dataflow")
+	}
+
+	return dfN, nil
+}
+
+// dedupKeepLastFunc spills all rows to disk, keeping the row keys in the
+// same order. The keys are then read backwards: the first occurrence of a
+// key is then the last one of the stream. Kept rows are marked in a bitmap
+// and the rows are read back from disk in the original order.
+func dedupKeepLastFunc(dedup *Deduplicator, rows chan []any) func(it *Iterator) bool {
+	var (
+		rowsFile *os.File
+		reader   *bufio.Reader
+		keep     []uint64 // bitmap of row indexes to keep
+		index    int
+		total    int
+		prepared bool
+	)
+
+	prepare := func(it *Iterator) (err error) {
+		if err = os.MkdirAll(dedup.folder, 0755); err != nil {
+			return g.Error(err, "could not create deduplicate folder")
+		}
+
+		rowsFile, err = os.Create(path.Join(dedup.folder, "rows.jsonl"))
+		if err != nil {
+			return g.Error(err, "could not create deduplicate rows file")
+		}
+
+		keysFile, err := os.Create(path.Join(dedup.folder, "keys.bin"))
+		if err != nil {
+			return g.Error(err, "could not create deduplicate keys file")
+		}
+		defer keysFile.Close()
+
+		rowsW := bufio.NewWriter(rowsFile)
+		keysW := bufio.NewWriter(keysFile)
+		encoder := json.NewEncoder(rowsW)
+		values := []*string{}
+
+		// spill rows and keys
+		for row := range rows {
+			key := dedup.Key(row)
+			if _, err = keysW.Write(key[:]); err != nil {
+				return g.Error(err, "could not write row key")
+			}
+
+			values = values[:0]
+			for i, val := range row {
+				var valS string
+				switch v := val.(type) {
+				case nil:
+					values = append(values, nil)
+					continue
+				case time.Time:
+					valS = v.Format(time.RFC3339Nano) // keep the offset
+				default:
+					valS = it.ds.Sp.CastToString(i, val)
+				}
+				values = append(values, &valS)
+			}
+			if err = encoder.Encode(values); err != nil {
+				return g.Error(err, "could not write row")
+			}
+			total++
+		}
+
+		if err = rowsW.Flush(); err != nil {
+			return g.Error(err, "could not flush rows file")
+		} else if err = keysW.Flush(); err != nil {
+			return g.Error(err, "could not flush keys file")
+		}
+
+		// read keys backwards, first seen is the last occurrence
+		keep = make([]uint64, total/64+1)
+		var key rowKey
+		for i := total - 1; i >= 0; i-- {
+			if _, err = keysFile.ReadAt(key[:], int64(i)*int64(len(key))); err != nil {
+				return g.Error(err, "could not read row key")
+			}
+
+			added, err := dedup.set.Add(key)
+			if err != nil {
+				return g.Error(err, "could not register row key")
+			} else if added {
+				keep[i/64] |= 1 << (uint(i) % 64)
+			} else {
+				dedup.Dropped++
+			}
+		}
+
+		if _, err = rowsFile.Seek(0, io.SeekStart); err != nil {
+			return g.Error(err, "could not seek rows file")
+		}
+		reader = bufio.NewReaderSize(rowsFile, 1024*1024)
+
+		return nil
+	}
+
+	return func(it *Iterator) bool {
+		if !prepared {
+			prepared = true
+			if err := prepare(it); err != nil {
+				it.Context.CaptureErr(err)
+				return false
+			}
+		}
+
+		for ; index < total; index++ {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				it.Context.CaptureErr(g.Error(err, "could not read spilled row"))
+				return false
+			}
+
+			if keep[index/64]&(1<<(uint(index)%64)) == 0 {
+				continue
+			}
+
+			values := []*string{}
+			if err = json.Unmarshal(line, &values); err != nil {
+				it.Context.CaptureErr(g.Error(err, "could not parse spilled row"))
+				return false
+			}
+
+			it.Row = make([]any, len(values))
+			for i, val := range values {
+				if val != nil {
+					it.Row[i] = *val
+				}
+			}
+
+			index++
+			return true
+		}
+
+		rowsFile.Close()
+		return false
+	}
+}
+
+// spillHashSet is a set of row keys, which are spilled to disk as sorted
+// runs once the number of keys in memory reaches maxMem. Each run has a
+// bloom filter to avoid reading from disk for most new keys.
+type spillHashSet struct {
+	mem    map[rowKey]struct{}
+	maxMem int
+	folder string
+	runs   []*hashSetRun
+}
+
+type hashSetRun struct {
+	file  *os.File
+	count int64
+	bloom []uint64
+}
+
+func newSpillHashSet(folder string, maxMem int) *spillHashSet {
+	return &spillHashSet{
+		mem:    map[rowKey]struct{}{},
+		maxMem: maxMem,
+		folder: folder,
+	}
+}
+
+// Add adds the key to the set. Returns false if it already exists.
+func (s *spillHashSet) Add(key rowKey) (added bool, err error) {
+	if _, ok := s.mem[key]; ok {
+		return false, nil
+	}
+
+	for _, run := range s.runs {
+		found, err := run.contains(key)
+		if err != nil {
+			return false, err
+		} else if found {
+			return false, nil
+		}
+	}
+
+	s.mem[key] = struct{}{}
+	if len(s.mem) >= s.maxMem {
+		if err = s.spill(); err != nil {
+			return true, g.Error(err, "could not spill keys to disk")
+		}
+	}
+
+	return true, nil
+}
+
+// spill writes the keys in memory to a sorted run file
+func (s *spillHashSet) spill() (err error) {
+	keys := make([]rowKey, 0, len(s.mem))
+	for key := range s.mem {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i][:], keys[j][:]) < 0
+	})
+
+	if err = os.MkdirAll(s.folder, 0755); err != nil {
+		return g.Error(err, "could not create folder")
+	}
+
+	filePath := path.Join(s.folder, g.F("run_%04d.bin", len(s.runs)+1))
+	file, err := os.Create(filePath)
+	if err != nil {
+		return g.Error(err, "could not create run file")
+	}
+
+	run := &hashSetRun{
+		file:  file,
+		count: int64(len(keys)),
+		bloom: make([]uint64, (len(keys)*10)/64+1), // ~10 bits per key
+	}
+
+	writer := bufio.NewWriter(file)
+	for _, key := range keys {
+		if _, err = writer.Write(key[:]); err != nil {
+			return g.Error(err, "could not write run file")
+		}
+		run.bloomAdd(key)
+	}
+	if err = writer.Flush(); err != nil {
+		return g.Error(err, "could not flush run file")
+	}
+
+	g.Debug("deduplicate: spilled %d keys to %s", len(keys), filePath)
+	s.runs = append(s.runs, run)
+	s.mem = map[rowKey]struct{}{}
+
+	return nil
+}
+
+// Close closes the run files
+func (s *spillHashSet) Close() {
+	for _, run := range s.runs {
+		run.file.Close()
+	}
+	s.runs = nil
+	s.mem = map[rowKey]struct{}{}
+}
+
+func (r *hashSetRun) bloomPositions(key rowKey) (positions [4]uint64) {
+	h1 := binary.LittleEndian.Uint64(key[:8])
+	h2 := binary.LittleEndian.Uint64(key[8:])
+	bits := uint64(len(r.bloom) * 64)
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % bits
+	}
+	return
+}
+
+func (r *hashSetRun) bloomAdd(key rowKey) {
+	for _, pos := range r.bloomPositions(key) {
+		r.bloom[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+// contains checks the bloom filter, then binary searches the run file
+func (r *hashSetRun) contains(key rowKey) (bool, error) {
+	for _, pos := range r.bloomPositions(key) {
+		if r.bloom[pos/64]&(1<<(pos%64)) == 0 {
+			return false, nil
+		}
+	}
+
+	var (
+		low, high = int64(0), r.count - 1
+		val       rowKey
+	)
+	for low <= high {
+		mid := (low + high) / 2
+		if _, err := r.file.ReadAt(val[:], mid*int64(len(val))); err != nil {
+			return false, g.Error(err, "could not read run file")
+		}
+
+		switch bytes.Compare(val[:], key[:]) {
+		case 0:
+			return true, nil
+		case -1:
+			low = mid + 1
+		default:
+			high = mid - 1
+		}
+	}
+
+	return false, nil
+}
+
+// ParseDeduplicateKeep parses the keep value (first or last)
+func ParseDeduplicateKeep(keep string) (keepLast bool, err error) {
+	switch strings.ToLower(strings.TrimSpace(keep)) {
+	case "", "first":
+		return false, nil
+	case "last":
+		return true, nil
+	}
+	return false, g.Error("invalid deduplicate keep value: %s (expected 'first' or 'last')", keep)
+}
@@ -0,0 +1,86 @@
+package iop
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeduplicateDataflow(t *testing.T) {
+	makeDf := func() *Dataflow {
+		data := NewDataset(NewColumnsFromFields("id", "name"))
+		data.Rows = [][]any{
+			{1, "a"}, {2, "b"}, {1, "c"}, {3, "d"}, {2, "b"}, {1, "e"},
+		}
+		df, err := MakeDataFlow(data.Stream(), data.Stream())
+		assert.NoError(t, err)
+		return df
+	}
+
+	type testCase struct {
+		name     string
+		opts     DeduplicateOptions
+		expected [][]any
+	}
+
+	cases := []testCase{
+		{
+			name:     "all columns",
+			opts:     DeduplicateOptions{},
+			expected: [][]any{{1, "a"}, {2, "b"}, {1, "c"}, {3, "d"}, {1, "e"}},
+		},
+		{
+			name:     "key first",
+			opts:     DeduplicateOptions{Keys: []string{"ID"}},
+			expected: [][]any{{1, "a"}, {2, "b"}, {3, "d"}},
+		},
+		{
+			name:     "key last",
+			opts:     DeduplicateOptions{Keys: []string{"id"}, KeepLast: true},
+			expected: [][]any{{3, "d"}, {2, "b"}, {1, "e"}},
+		},
+		{
+			name:     "key first spilled",
+			opts:     DeduplicateOptions{Keys: []string{"id"}, MaxMemKeys: 1},
+			expected: [][]any{{1, "a"}, {2, "b"}, {3, "d"}},
+		},
+	}
+
+	for _, c := range cases {
+		df, err := DeduplicateDataflow(makeDf(), c.opts)
+		if !assert.NoError(t, err, c.name) {
+			continue
+		}
+
+		data, err := df.Collect()
+		if !assert.NoError(t, err, c.name) || !assert.Len(t, data.Rows, len(c.expected), c.name) {
+			continue
+		}
+		for i, row := range data.Rows {
+			assert.EqualValues(t, c.expected[i][0], row[0], c.name)
+			assert.EqualValues(t, c.expected[i][1], row[1], c.name)
+		}
+	}
+
+	_, err := DeduplicateDataflow(makeDf(), DeduplicateOptions{Keys: []string{"missing"}})
+	assert.Error(t, err)
+}
+
+func TestSpillHashSet(t *testing.T) {
+	set := newSpillHashSet(t.TempDir(), 3)
+	defer set.Close()
+
+	d := &Deduplicator{keyIdx: []int{0}}
+	for i := 0; i < 10; i++ {
+		added, err := set.Add(d.Key([]any{i}))
+		assert.NoError(t, err)
+		assert.True(t, added)
+	}
+	assert.Len(t, set.runs, 3)
+
+	for i := 0; i < 12; i++ {
+		added, err := set.Add(d.Key([]any{i}))
+		assert.NoError(t, err)
+		assert.Equal(t, i >= 10, added, i)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/flarco/g"
@@ -31,6 +32,7 @@ var (
 	duckDbReadOnlyHint = "/* -readonly */"
 	duckDbSOFMarker    = "___start_of_duckdb_result___"
 	duckDbEOFMarker    = "___end_of_duckdb_result___"
+	duckDbEOEMarker    = "___end_of_duckdb_error___"
 	DuckDbURISeparator = "|-|+|"
 )
 
@@ -41,15 +43,27 @@ type DuckDb struct {
 	extensions []string
 	secrets    []string
 	query      *duckDbQuery // only one active query at a time
+	db         *sql.DB      // when using the native driver
+	pool       *duckDbPool  // when using a pool of sessions
 }
 
+// duckDbQuery is a query submitted to the duckdb process. Its output is delimited
+// by markers tagged with the query ID: start & end of result on stdout, and end of
+// errors on stderr. Since each stream is ordered, lines are attributed to the right
+// query, and the query is done once both end markers are received.
 type duckDbQuery struct {
+	ID      string
 	Context *g.Context
 	reader  *io.PipeReader
 	writer  *io.PipeWriter
 	err     error
-	started bool
 	done    bool
+
+	mux      sync.Mutex
+	errLines []string
+	writing  bool // between the start & end of result markers
+	outEnded bool // end of result marker received
+	errEnded bool // end of errors marker received
 }
 
 // NewDuckDb creates a new DuckDb instance with the given context and properties
@@ -230,11 +244,56 @@ func (duck *DuckDb) PrepareFsSecretAndURI(uri string) string {
 	return uri
 }
 
-// getLoadExtensionSQL generates SQL statements to load extensions
+// Extensions returns the extensions to load: the ones added and the ones
+// configured with the `extensions` property (a list or comma separated)
+func (duck *DuckDb) Extensions() (extensions []string) {
+	extensions = append(extensions, duck.extensions...)
+
+	val := strings.TrimSpace(duck.setting("extensions"))
+	configured := []string{}
+	if strings.HasPrefix(val, "[") {
+		g.Unmarshal(val, &configured)
+	} else if val != "" {
+		configured = strings.Split(val, ",")
+	}
+
+	for _, extension := range configured {
+		if extension = strings.TrimSpace(extension); extension != "" && !lo.Contains(extensions, extension) {
+			extensions = append(extensions, extension)
+		}
+	}
+	return
+}
+
+// isOffline returns true when extensions must not be downloaded, from the
+// `offline` property or the DUCKDB_OFFLINE / DUCKDB_USE_INSTALLED_EXTENSIONS env vars.
+// Extensions are then only loaded, from the extension directory.
+func (duck *DuckDb) isOffline() bool {
+	if val := duck.setting("offline"); val != "" {
+		return cast.ToBool(val)
+	}
+	return cast.ToBool(os.Getenv("DUCKDB_OFFLINE")) || cast.ToBool(os.Getenv("DUCKDB_USE_INSTALLED_EXTENSIONS"))
+}
+
+// getLoadExtensionSQL generates SQL statements to load extensions.
+// The `extension_directory` property points to pre-bundled extensions, and
+// `extension_repository` installs from a custom repository.
 func (duck *DuckDb) getLoadExtensionSQL() (sql string) {
-	for _, extension := range duck.extensions {
-		if cast.ToBool(os.Getenv("DUCKDB_USE_INSTALLED_EXTENSIONS")) {
+	if dir := duck.setting("extension_directory"); dir != "" {
+		sql += fmt.Sprintf(";SET extension_directory = '%s';", strings.ReplaceAll(dir, "'", "''"))
+	}
+
+	offline := duck.isOffline()
+	if offline {
+		sql += ";SET autoinstall_known_extensions = false;"
+	}
+
+	repository := duck.setting("extension_repository")
+	for _, extension := range duck.Extensions() {
+		if offline {
 			sql += fmt.Sprintf("; LOAD %s;", extension)
+		} else if repository != "" {
+			sql += fmt.Sprintf(";INSTALL %s FROM '%s'; LOAD %s;", extension, strings.ReplaceAll(repository, "'", "''"), extension)
 		} else {
 			sql += fmt.Sprintf(";INSTALL %s; LOAD %s;", extension, extension)
 		}
@@ -242,6 +301,20 @@ func (duck *DuckDb) getLoadExtensionSQL() (sql string) {
 	return
 }
 
+// extensionErr returns a clear error when an extension is missing in offline mode
+func (duck *DuckDb) extensionErr(err error) error {
+	if err == nil || !duck.isOffline() {
+		return err
+	}
+
+	msg := strings.ToLower(err.Error())
+	if strings.Contains(msg, "extension") && (strings.Contains(msg, "not found") || strings.Contains(msg, "install")) {
+		dir := lo.Ternary(duck.setting("extension_directory") != "", duck.setting("extension_directory"), "~/.duckdb/extensions")
+		return g.Error(err, "a DuckDB extension is not installed and offline mode is enabled, so it cannot be downloaded. Pre-install the extensions (%s) into the extension directory (%s)", strings.Join(duck.Extensions(), ", "), dir)
+	}
+	return err
+}
+
 // getCreateSecretSQL generates SQL statements to create secrets
 func (duck *DuckDb) getCreateSecretSQL() (sql string) {
 	for _, secret := range duck.secrets {
@@ -257,6 +330,15 @@ func (duck *DuckDb) Open(timeOut ...int) (err error) {
 		return nil
 	}
 
+	if size := duck.PoolSize(); size > 1 {
+		duck.openPool(size)
+		return nil
+	}
+
+	if duck.useNative() {
+		return duck.openNative()
+	}
+
 	bin, err := EnsureBinDuckDB(duck.GetProp("duckdb_version"))
 	if err != nil {
 		return g.Error(err, "could not get duckdb binary")
@@ -285,7 +367,11 @@ func (duck *DuckDb) Open(timeOut ...int) (err error) {
 
 	if motherduckToken := duck.GetProp("motherduck_token"); motherduckToken != "" {
 		duck.Proc.Env["motherduck_token"] = motherduckToken
-		args = append(args, "md:"+duck.GetProp("database"))
+		if cast.ToBool(duck.GetProp("create_database")) {
+			args = append(args, "md:") // database is created & used after opening
+		} else {
+			args = append(args, "md:"+duck.GetProp("database"))
+		}
 	}
 
 	// default extensions
@@ -312,11 +398,181 @@ func (duck *DuckDb) Open(timeOut ...int) (err error) {
 		return g.Error(err, "could not init connection")
 	}
 
+	return duck.initSession()
+}
+
+// initSession runs the session statements once opened
+func (duck *DuckDb) initSession() (err error) {
+	sessionSQLs, err := duck.sessionSQL()
+	if err != nil {
+		return g.Error(err, "could not prepare session")
+	}
+	for _, sql := range sessionSQLs {
+		if _, err = duck.Exec(sql); err != nil {
+			return g.Error(err, "could not init session")
+		}
+	}
+
 	return nil
 }
 
+// DuckDbAttach is a database attached to the session, from the `attach` property.
+// The property can be a list of paths or of objects (path, alias, read_only, type).
+type DuckDbAttach struct {
+	Path     string `json:"path" yaml:"path"`
+	Alias    string `json:"alias,omitempty" yaml:"alias,omitempty"`
+	ReadOnly bool   `json:"read_only,omitempty" yaml:"read_only,omitempty"`
+	Type     string `json:"type,omitempty" yaml:"type,omitempty"`
+}
+
+// SQL returns the ATTACH statement
+func (a DuckDbAttach) SQL() string {
+	sql := g.F("attach if not exists '%s'", strings.ReplaceAll(a.Path, "'", "''"))
+	if a.Alias != "" {
+		sql += g.F(` as "%s"`, a.Alias)
+	}
+
+	options := []string{}
+	if a.Type != "" {
+		options = append(options, "type "+a.Type)
+	}
+	if a.ReadOnly {
+		options = append(options, "read_only")
+	}
+	if len(options) > 0 {
+		sql += " (" + strings.Join(options, ", ") + ")"
+	}
+	return sql
+}
+
+// attachments parses the `attach` property
+func (duck *DuckDb) attachments() (attachments []DuckDbAttach, err error) {
+	val := strings.TrimSpace(duck.GetProp("attach"))
+	if val == "" {
+		return nil, nil
+	} else if !strings.HasPrefix(val, "[") {
+		// single path
+		return []DuckDbAttach{{Path: val}}, nil
+	}
+
+	items := []any{}
+	if err = g.Unmarshal(val, &items); err != nil {
+		return nil, g.Error(err, "invalid value for attach property")
+	}
+
+	for _, item := range items {
+		attachment := DuckDbAttach{}
+		switch v := item.(type) {
+		case string:
+			attachment.Path = v
+		default:
+			if err = g.Unmarshal(g.Marshal(v), &attachment); err != nil {
+				return nil, g.Error(err, "invalid attach entry: %s", g.Marshal(v))
+			}
+		}
+
+		if attachment.Path == "" {
+			return nil, g.Error("attach entry requires a path: %s", g.Marshal(item))
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, nil
+}
+
+// setting returns a session setting from the properties, or from the
+// file system properties (`fs_props`) when reading files
+func (duck *DuckDb) setting(key string) string {
+	if val := duck.GetProp(key); val != "" {
+		return val
+	}
+
+	fsProps := map[string]string{}
+	g.Unmarshal(duck.GetProp("fs_props"), &fsProps)
+	for k, v := range fsProps {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// settingsSQL returns the statements to apply the resource settings:
+// `memory_limit` (e.g. 4GB), `threads` and `temp_directory` (spill location)
+func (duck *DuckDb) settingsSQL() (sqls []string, err error) {
+	if val := duck.setting("memory_limit"); val != "" {
+		sqls = append(sqls, g.F("set memory_limit = '%s'", strings.ReplaceAll(val, "'", "''")))
+	}
+
+	if val := duck.setting("threads"); val != "" {
+		threads, err := cast.ToIntE(val)
+		if err != nil || threads < 1 {
+			return nil, g.Error("invalid value for threads: %s", val)
+		}
+		sqls = append(sqls, g.F("set threads = %d", threads))
+	}
+
+	if val := duck.setting("temp_directory"); val != "" {
+		sqls = append(sqls, g.F("set temp_directory = '%s'", strings.ReplaceAll(val, "'", "''")))
+	}
+
+	return sqls, nil
+}
+
+// sessionSQL returns the statements to run once the session opens, from the properties:
+// resource settings (`memory_limit`, `threads`, `temp_directory`), the Iceberg catalog,
+// MotherDuck database creation (`create_database`), attached databases (`attach`)
+// and MotherDuck shares of the database (`share`)
+func (duck *DuckDb) sessionSQL() (sqls []string, err error) {
+	isMotherDuck := duck.GetProp("motherduck_token") != ""
+	database := duck.GetProp("database")
+
+	if sqls, err = duck.settingsSQL(); err != nil {
+		return nil, err
+	}
+
+	catalogSQLs, err := duck.icebergCatalogSQL()
+	if err != nil {
+		return nil, err
+	}
+	sqls = append(sqls, catalogSQLs...)
+
+	if isMotherDuck && database != "" && cast.ToBool(duck.GetProp("create_database")) {
+		sqls = append(sqls,
+			g.F("create database if not exists %s", duck.Quote(database)),
+			g.F("use %s", duck.Quote(database)),
+		)
+	}
+
+	attachments, err := duck.attachments()
+	if err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		sqls = append(sqls, attachment.SQL())
+	}
+
+	// shares are kept up to date with the database
+	if share := duck.GetProp("share"); share != "" {
+		if !isMotherDuck || database == "" {
+			return nil, g.Error("the share property requires a MotherDuck database")
+		}
+		sqls = append(sqls, g.F("create share if not exists %s from %s (update automatic)", duck.Quote(share), duck.Quote(database)))
+	}
+
+	return sqls, nil
+}
+
 // Close closes the connection
 func (duck *DuckDb) Close() error {
+	if duck.pool != nil {
+		return duck.closePool()
+	}
+
+	if duck.db != nil {
+		return duck.closeNative()
+	}
+
 	if duck.Proc == nil || duck.Proc.Exited() {
 		return nil
 	}
@@ -390,26 +646,29 @@ func (duck *DuckDb) SubmitSQL(sql string, showChanges bool) (err error) {
 	extensionsSQL := duck.getLoadExtensionSQL()
 	secretSQL := duck.getCreateSecretSQL()
 
-	queryID := g.RandSuffix("", 3) // for debugging
+	dq := duck.query
+	if dq == nil {
+		return g.Error("no active duckdb query")
+	}
 
 	// submit sql to stdin
 	sqlLines := []string{
 		extensionsSQL + ";",
 		secretSQL + ";",
-		g.R("select '{v}' AS marker_{id};", "v", duckDbSOFMarker, "id", queryID),
+		dq.startSQL(),
 		".changes on",
 		sql + ";",
 		".changes off",
-		g.R("select '{v}' AS {v};\n", "v", duckDbEOFMarker),
+		dq.endSQL(),
 	}
 
 	if !showChanges {
 		sqlLines = []string{
 			extensionsSQL + ";",
 			secretSQL + ";",
-			g.R("select '{v}' AS marker_{id};", "v", duckDbSOFMarker, "id", queryID),
+			dq.startSQL(),
 			sql + ";",
-			g.R("select '{v}' AS {v};\n", "v", duckDbEOFMarker),
+			dq.endSQL(),
 		}
 	}
 
@@ -456,6 +715,12 @@ func (duck *DuckDb) ExecContext(ctx context.Context, sql string, args ...interfa
 		}
 	}
 
+	if duck.pool != nil {
+		return duck.execPooled(ctx, sql, args...)
+	} else if duck.db != nil {
+		return duck.execNative(ctx, sql, args...)
+	}
+
 	// one query at a time
 	duck.Context.Lock()
 	defer duck.Context.Unlock()
@@ -494,7 +759,7 @@ func (duck *DuckDb) ExecContext(ctx context.Context, sql string, args ...interfa
 	// Extract total changes from stdout
 	result, err = duck.waitForResult(dq)
 	if err != nil {
-		return result, g.Error(err, "Failed to execute SQL")
+		return result, g.Error(duck.extensionErr(err), "Failed to execute SQL")
 	}
 
 	return result, nil
@@ -502,74 +767,136 @@ func (duck *DuckDb) ExecContext(ctx context.Context, sql string, args ...interfa
 
 func (duck *DuckDb) newQuery(ctx context.Context) (query *duckDbQuery) {
 	stdOutReader, stdOutWriter := io.Pipe() // new pipe
-	duck.query = &duckDbQuery{
+	query = &duckDbQuery{
+		ID:      strings.ToLower(g.RandSuffix("q", 8)),
 		Context: g.NewContext(ctx),
 		reader:  stdOutReader,
 		writer:  stdOutWriter,
 	}
-	return duck.query
-}
 
-// waitForResult waits for the execution of a SQL query and returns the result
-func (duck *DuckDb) waitForResult(dq *duckDbQuery) (result sql.Result, err error) {
+	// stop writing if the query is canceled
+	go func() {
+		<-query.Context.Ctx.Done()
+		query.mux.Lock()
+		defer query.mux.Unlock()
+		if !query.done {
+			query.err = g.Error(query.Context.Ctx.Err(), "query canceled")
+			query.finish()
+		}
+	}()
 
-	stdOutReaderB := bufio.NewReader(dq.reader)
+	duck.query = query
+	return query
+}
 
-	// Extract total changes from stdout
-	// This loop continuously reads the output from the DuckDB process
-	// It looks for lines containing "total_changes:" to update the result
-	// and stops when it encounters the EOF marker
-	var line string
-	for {
-		time.Sleep(10 * time.Millisecond)
+// startSQL returns the statement outputting the start of result marker
+func (dq *duckDbQuery) startSQL() string {
+	return g.F("select '%s%s' AS marker;", duckDbSOFMarker, dq.ID)
+}
 
-		if dq.err != nil {
-			return result, dq.err
-		}
+// endSQL returns the statements outputting the end of result marker on stdout,
+// and the end of errors marker on stderr (as an error)
+func (dq *duckDbQuery) endSQL() string {
+	return g.F("select '%s%s' AS %s%s;\nselect error('%s%s');\n", duckDbEOFMarker, dq.ID, duckDbEOFMarker, dq.ID, duckDbEOEMarker, dq.ID)
+}
 
-		if dq.done {
-			return result, nil
-		}
+// scan processes a line output by the duckdb process. Lines
+// outside of the query markers are from a previous query and are ignored.
+func (dq *duckDbQuery) scan(stderr bool, line string) {
+	dq.mux.Lock()
+	if dq.done {
+		dq.mux.Unlock()
+		return
+	}
 
-		if !dq.started {
-			continue
+	if stderr {
+		if strings.Contains(line, duckDbEOEMarker+dq.ID) {
+			dq.errEnded = true
+			if len(dq.errLines) > 0 {
+				dq.err = g.Error(strings.Join(dq.errLines, "\n"))
+			}
+			dq.checkDone()
+		} else if strings.Contains(line, duckDbEOEMarker) {
+			dq.errLines = nil // errors of a previous query
+		} else {
+			dq.errLines = append(dq.errLines, line)
 		}
-
-		// try peeking
-		_, err := stdOutReaderB.Peek(0)
-		if err != nil {
-			if err == io.EOF {
-				// No more data available, but EOF marker not found yet
-				goto next
+		dq.mux.Unlock()
+		return
+	}
+
+	switch {
+	case strings.Contains(line, duckDbSOFMarker+dq.ID):
+		dq.writing = true
+	case strings.Contains(line, duckDbEOFMarker+dq.ID):
+		dq.writing = false
+		dq.outEnded = true
+		dq.checkDone()
+	case dq.writing:
+		// write without the lock, since it blocks until read
+		dq.mux.Unlock()
+		if _, err := dq.writer.Write([]byte(line + "\n")); err != nil {
+			dq.mux.Lock()
+			if !dq.done {
+				dq.err = g.Error(err, "Failed to write to stdout pipe")
+				dq.finish()
 			}
-			return result, g.Error(err, "could not read output from stdout")
+			dq.mux.Unlock()
 		}
+		return
+	}
+	dq.mux.Unlock()
+}
 
-		for {
-			// read all available lines
-			line, err = stdOutReaderB.ReadString('\n')
-			if len(line) == 0 && err != nil {
-				if err == io.EOF {
-					// No more data available, but EOF marker not found yet
-					goto next
-				}
-				return result, g.Error(err, "could not read output from stdout")
-			}
+// checkDone finishes the query once both end markers are received
+func (dq *duckDbQuery) checkDone() {
+	if dq.outEnded && dq.errEnded {
+		dq.finish()
+	}
+}
 
-			// g.Warn("line | %s", line)
-			if strings.Contains(line, "total_changes:") {
-				parts := strings.Fields(line)
-				if len(parts) >= 4 {
-					totalChanges, err := strconv.ParseUint(parts[3], 10, 64)
-					if err == nil {
-						result = duckDbResult{TotalChanges: cast.ToInt64(totalChanges)}
-					}
+// finish closes the pipe, with the error if any
+func (dq *duckDbQuery) finish() {
+	dq.done = true
+	dq.writing = false
+	if dq.err != nil {
+		dq.writer.CloseWithError(dq.err)
+	} else {
+		dq.writer.Close()
+	}
+	dq.Context.Cancel()
+}
+
+// Err returns the error of the query
+func (dq *duckDbQuery) Err() error {
+	dq.mux.Lock()
+	defer dq.mux.Unlock()
+	return dq.err
+}
+
+// waitForResult waits for the execution of a SQL query and returns the result
+func (duck *DuckDb) waitForResult(dq *duckDbQuery) (result sql.Result, err error) {
+	result = duckDbResult{}
+
+	// Extract total changes from stdout, until the query is done
+	stdOutReaderB := bufio.NewReader(dq.reader)
+	for {
+		line, err := stdOutReaderB.ReadString('\n')
+		if strings.Contains(line, "total_changes:") {
+			parts := strings.Fields(line)
+			if len(parts) >= 4 {
+				totalChanges, err := strconv.ParseUint(parts[3], 10, 64)
+				if err == nil {
+					result = duckDbResult{TotalChanges: cast.ToInt64(totalChanges)}
 				}
-			} else if strings.Contains(line, duckDbEOFMarker) {
-				return result, nil
 			}
 		}
-	next:
+
+		if err == io.EOF {
+			return result, nil
+		} else if err != nil {
+			return result, err // the query error
+		}
 	}
 }
 
@@ -609,6 +936,12 @@ func (duck *DuckDb) StreamContext(ctx context.Context, sql string, options ...ma
 		}
 	}
 
+	if duck.pool != nil {
+		return duck.streamPooled(ctx, sql, options...)
+	} else if duck.db != nil {
+		return duck.streamNative(ctx, sql, options...)
+	}
+
 	queryCtx := g.NewContext(ctx)
 
 	opts := g.M()
@@ -666,82 +999,22 @@ func (duck *DuckDb) StreamContext(ctx context.Context, sql string, options ...ma
 	err = ds.ConsumeCsvReader(dq.reader)
 	if err != nil {
 		ds.Close()
+		if qErr := dq.Err(); qErr != nil {
+			return ds, duck.extensionErr(qErr)
+		}
 		return ds, g.Error(err, "could not read output stream")
 	}
 
-	if dq.err != nil {
-		return ds, dq.err
-	}
-
 	return
 }
 
-// initScanner is set only once
+// initScanner is set only once, lines are handled by the active query
 func (duck *DuckDb) initScanner() {
-
-	errString := strings.Builder{}
-	var errTimer, eofTimer *time.Timer
-
-	var stdOutWriter *io.PipeWriter
-	resetWriter := func() {
-		if stdOutWriter != nil {
-			stdOutWriter.Close()
-		}
-		stdOutWriter = nil // set as nil until next query start
-		duck.query.done = true
-	}
-
 	duck.Proc.SetScanner(func(stderr bool, line string) {
-		// g.Warn("stderr:%v done:%v | %s", stderr, duck.query.done, line)
-
-		if duck.query == nil || duck.query.done {
-			return
-		}
-
-		select {
-		case <-duck.query.Context.Ctx.Done():
-			resetWriter()
-			return
-		default:
-		}
-
-		if stderr {
-			// the issue is we don't know when the error message ends.
-			// so we have a timer to use as a debouce, to concat the error lines
-			if errTimer != nil {
-				errTimer.Stop() // cancel timer for new one
-			}
-
-			// it can occur that the error outputs right after the EOF marker
-			if eofTimer != nil {
-				eofTimer.Stop()
-				eofTimer = nil
-			}
-
-			errString.WriteString(line)
-			errTimer = time.AfterFunc(25*time.Millisecond, func() {
-				duck.query.err = g.Error(errString.String())
-				errString.Reset()
-				resetWriter() // in case writer is active
-			})
-		} else {
-			if strings.Contains(line, duckDbEOFMarker) {
-				eofTimer = time.AfterFunc(25*time.Millisecond, func() {
-					resetWriter() // since result set ended
-				})
-			} else if strings.Contains(line, duckDbSOFMarker) {
-				stdOutWriter = duck.query.writer
-				duck.query.started = true
-			} else if stdOutWriter != nil {
-				_, err := stdOutWriter.Write([]byte(line + "\n"))
-				if err != nil {
-					duck.query.err = g.Error(err, "Failed to write to stdout pipe")
-					resetWriter() // since we errored
-				}
-			}
+		if dq := duck.query; dq != nil {
+			dq.scan(stderr, line)
 		}
 	})
-
 }
 
 type DuckDbCopyOptions struct {
@@ -1169,6 +1442,9 @@ func (duck *DuckDb) MakeScanQuery(format dbio.FileType, uri string, fsc FileStre
 	}
 
 	streamScanner := dbio.TypeDbDuckDb.GetTemplateValue("function." + duck.GetScannerFunc(format))
+	if format == dbio.FileTypeIceberg {
+		streamScanner = duck.icebergScanner(uri, fsc)
+	}
 	if fsc.SQL != "" {
 		sql = g.R(
 			g.R(fsc.SQL, "stream_scanner", streamScanner),
@@ -0,0 +1,391 @@
+package iop
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/spf13/cast"
+)
+
+// DuckDbNativeDriver is the database/sql driver name of the native DuckDB driver.
+// The driver is not compiled in by default (it requires cgo), it is registered when
+// building with `-tags duckdb_native` (see duckdb_native_driver.go).
+var DuckDbNativeDriver = "duckdb"
+
+// useNative returns true when the native driver should be used instead of the
+// duckdb CLI process, from the `duckdb_driver` property or the DUCKDB_DRIVER
+// env var. Values are `cli` (default) or `native`.
+func (duck *DuckDb) useNative() bool {
+	driver := duck.GetProp("duckdb_driver")
+	if driver == "" {
+		driver = os.Getenv("DUCKDB_DRIVER")
+	}
+	return strings.EqualFold(driver, "native")
+}
+
+// nativeDSN returns the data source name for the native driver
+func (duck *DuckDb) nativeDSN() string {
+	dsn := duck.GetProp("instance")
+	params := url.Values{}
+
+	if motherduckToken := duck.GetProp("motherduck_token"); motherduckToken != "" {
+		dsn = "md:" + lo.Ternary(cast.ToBool(duck.GetProp("create_database")), "", duck.GetProp("database"))
+		params.Set("motherduck_token", motherduckToken)
+	}
+
+	if cast.ToBool(duck.GetProp("read_only")) {
+		params.Set("access_mode", "read_only")
+	}
+
+	if len(params) > 0 {
+		dsn = dsn + "?" + params.Encode()
+	}
+	return dsn
+}
+
+// openNative opens the database with the native driver
+func (duck *DuckDb) openNative() (err error) {
+	if !lo.Contains(sql.Drivers(), DuckDbNativeDriver) {
+		return g.Error("the native DuckDB driver is not available in this build (compile with `-tags duckdb_native`), or set `duckdb_driver: cli`")
+	}
+
+	duck.db, err = sql.Open(DuckDbNativeDriver, duck.nativeDSN())
+	if err != nil {
+		return g.Error(err, "could not open duckdb with native driver")
+	}
+
+	// a single connection, so that session state (use, secrets, attach) is kept
+	duck.db.SetMaxOpenConns(1)
+	if err = duck.db.PingContext(duck.Context.Ctx); err != nil {
+		duck.db.Close()
+		duck.db = nil
+		return g.Error(err, "could not connect to duckdb with native driver")
+	}
+
+	// default extensions
+	duck.AddExtension("json")
+
+	duck.SetProp("connected", "true")
+
+	return duck.initSession()
+}
+
+// IsNative returns true if opened with the native driver
+func (duck *DuckDb) IsNative() bool {
+	return duck.db != nil
+}
+
+// closeNative closes the native database
+func (duck *DuckDb) closeNative() (err error) {
+	duck.SetProp("connected", "false")
+	err = duck.db.Close()
+	duck.db = nil
+	if err != nil {
+		return g.Error(err, "could not close duckdb")
+	}
+	return nil
+}
+
+// prepareNative loads the extensions and creates the secrets
+func (duck *DuckDb) prepareNative(ctx context.Context) (err error) {
+	prepSQL := strings.Trim(duck.getLoadExtensionSQL()+duck.getCreateSecretSQL(), "; ")
+	if prepSQL == "" {
+		return nil
+	}
+
+	if _, err = duck.db.ExecContext(ctx, prepSQL); err != nil {
+		return g.Error(duck.extensionErr(err), "could not load extensions / create secrets")
+	}
+	return nil
+}
+
+// logNative logs the sql, masking the properties
+func (duck *DuckDb) logNative(sql string) {
+	propsCombined := map[string]string{}
+	g.Unmarshal(duck.GetProp("fs_props"), &propsCombined)
+	for k, v := range duck.Props() {
+		propsCombined[k] = v
+	}
+	env.LogSQL(propsCombined, sql)
+}
+
+// execNative executes the sql with the native driver, with bound arguments
+func (duck *DuckDb) execNative(ctx context.Context, sql string, args ...any) (result sql.Result, err error) {
+	if err = duck.prepareNative(ctx); err != nil {
+		return nil, err
+	}
+
+	duck.logNative(sql)
+	result, err = duck.db.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return nil, g.Error(err, "Failed to execute SQL")
+	}
+	return result, nil
+}
+
+// streamNative runs the sql with the native driver, returning a datastream
+func (duck *DuckDb) streamNative(ctx context.Context, sql string, options ...map[string]any) (ds *Datastream, err error) {
+	opts := g.M()
+	if len(options) > 0 && options[0] != nil {
+		opts = options[0]
+	}
+
+	if err = duck.prepareNative(ctx); err != nil {
+		return nil, err
+	}
+
+	queryCtx := g.NewContext(ctx)
+	duck.logNative(sql)
+	rows, err := duck.db.QueryContext(queryCtx.Ctx, sql)
+	if err != nil {
+		return nil, g.Error(err, "Failed to execute SQL")
+	}
+
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		return nil, g.Error(err, "could not get column types")
+	}
+
+	columns := make(Columns, len(colTypes))
+	for i, colType := range colTypes {
+		columns[i] = Column{
+			Name:     colType.Name(),
+			DbType:   colType.DatabaseTypeName(),
+			Type:     NativeTypeToGeneral(colType.Name(), colType.DatabaseTypeName(), dbio.TypeDbDuckDb),
+			Position: i + 1,
+			Sourced:  true,
+		}
+	}
+
+	nextFunc := func(it *Iterator) bool {
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				it.Context.CaptureErr(g.Error(err, "error during row iteration"))
+			}
+			rows.Close()
+			return false
+		}
+
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			it.Context.CaptureErr(g.Error(err, "failed to scan"))
+			rows.Close()
+			return false
+		}
+
+		for i, val := range values {
+			values[i] = duckDbNativeValue(val)
+		}
+		it.Row = values
+		return true
+	}
+
+	ds = NewDatastreamIt(queryCtx.Ctx, columns, nextFunc)
+	if cds, ok := opts["datastream"]; ok {
+		// if provided, use it
+		ds = cds.(*Datastream)
+		ds.Columns = columns
+		ds.it = ds.NewIterator(columns, nextFunc)
+	}
+
+	// handle filename, always last column
+	if cast.ToBool(opts["filename"]) {
+		// rename to _sling_stream_url
+		ds.Columns[len(ds.Columns)-1].Name = ds.Metadata.StreamURL.Key
+		ds.Metadata.StreamURL.Key = "" // so it is not added again
+	}
+
+	ds.Inferred = true
+	ds.NoDebug = strings.Contains(sql, env.NoDebugKey)
+	ds.SetConfig(duck.Props())
+	ds.Defer(func() { rows.Close() })
+
+	if err = ds.Start(); err != nil {
+		ds.Close()
+		return ds, g.Error(err, "could not start datastream")
+	}
+
+	return ds, nil
+}
+
+// duckDbNativeValue converts the nested / special values returned by the native driver.
+// Lists & structs are treated as text (JSON), like with the CLI.
+func duckDbNativeValue(val any) any {
+	switch v := val.(type) {
+	case nil, string, bool, int, int8, int16, int32, int64, uint8, uint16, uint32, uint64, float32, float64, []byte, time.Time:
+		return v
+	case []any, map[string]any, map[any]any:
+		return g.Marshal(v)
+	case fmt.Stringer:
+		return v.String() // decimals, uuids, intervals, hugeints
+	}
+	return val
+}
+
+// DuckDbAppender appends rows directly into a table, bypassing SQL.
+// It is provided by the native driver.
+type DuckDbAppender interface {
+	AppendRow(args ...driver.Value) error
+	Flush() error
+	Close() error
+}
+
+// NewDuckDbAppender creates an appender from a native driver connection.
+// It is set when the native driver is compiled in.
+var NewDuckDbAppender func(conn driver.Conn, schema, table string) (DuckDbAppender, error)
+
+// CanAppend returns true if rows can be appended into a table with the
+// provided columns, which requires the native driver and supported column types
+func (duck *DuckDb) CanAppend(tableColumns Columns) bool {
+	if duck.db == nil || NewDuckDbAppender == nil {
+		return false
+	}
+	for _, col := range tableColumns {
+		if _, err := duckDbAppendValue(col.DbType, nil); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Append appends the datastream rows into the table with the appender of the
+// native driver. Values are mapped to the table columns by name and converted
+// to the column types. Columns missing from the stream are appended as nulls.
+func (duck *DuckDb) Append(ctx context.Context, schema, table string, tableColumns Columns, ds *Datastream) (count uint64, err error) {
+	if !duck.CanAppend(tableColumns) {
+		return 0, g.Error("cannot use appender for %s.%s", schema, table)
+	}
+
+	conn, err := duck.db.Conn(ctx)
+	if err != nil {
+		return 0, g.Error(err, "could not get connection")
+	}
+	defer conn.Close()
+
+	flushEvery := lo.Ternary(cast.ToInt(duck.GetProp("batch_size")) > 0, cast.ToUint64(duck.GetProp("batch_size")), 100000)
+
+	err = conn.Raw(func(driverConn any) (err error) {
+		dConn, ok := driverConn.(driver.Conn)
+		if !ok {
+			return g.Error("invalid driver connection")
+		}
+
+		appender, err := NewDuckDbAppender(dConn, schema, table)
+		if err != nil {
+			return g.Error(err, "could not create appender for %s.%s", schema, table)
+		}
+		defer appender.Close()
+
+		values := make([]driver.Value, len(tableColumns))
+		for batch := range ds.BatchChan {
+			// index of stream column for each table column
+			colIndex := make([]int, len(tableColumns))
+			batchColMap := batch.Columns.FieldMap(true)
+			for i, col := range tableColumns {
+				colIndex[i] = -1
+				if j, ok := batchColMap[strings.ToLower(col.Name)]; ok {
+					colIndex[i] = j
+				}
+			}
+
+			for row := range batch.Rows {
+				for i, col := range tableColumns {
+					var val any
+					if j := colIndex[i]; j > -1 && j < len(row) {
+						val = row[j]
+					}
+					if values[i], err = duckDbAppendValue(col.DbType, val); err != nil {
+						return g.Error(err, "could not convert value for column %s", col.Name)
+					}
+				}
+
+				if err = appender.AppendRow(values...); err != nil {
+					return g.Error(err, "could not append row")
+				}
+
+				count++
+				if count%flushEvery == 0 {
+					if err = appender.Flush(); err != nil {
+						return g.Error(err, "could not flush appender")
+					}
+				}
+			}
+		}
+
+		if err = appender.Flush(); err != nil {
+			return g.Error(err, "could not flush appender")
+		}
+		return nil
+	})
+	if err != nil {
+		ds.Context.CaptureErr(err)
+		return count, g.Error(err)
+	}
+
+	return count, nil
+}
+
+// duckDbAppendValue converts the value for the appender, per native column type.
+// An error is returned for column types not supported by the appender.
+func duckDbAppendValue(dbType string, val any) (value driver.Value, err error) {
+	dbType = strings.ToUpper(strings.TrimSpace(dbType))
+	if i := strings.Index(dbType, "("); i > 0 {
+		dbType = dbType[:i]
+	}
+
+	var convert func() (driver.Value, error)
+	switch dbType {
+	case "VARCHAR", "TEXT", "STRING", "JSON":
+		convert = func() (driver.Value, error) { return cast.ToStringE(val) }
+	case "BIGINT", "INT8", "LONG":
+		convert = func() (driver.Value, error) { return cast.ToInt64E(val) }
+	case "INTEGER", "INT4", "INT", "SIGNED":
+		convert = func() (driver.Value, error) { return cast.ToInt32E(val) }
+	case "SMALLINT", "INT2", "SHORT":
+		convert = func() (driver.Value, error) { return cast.ToInt16E(val) }
+	case "TINYINT", "INT1":
+		convert = func() (driver.Value, error) { return cast.ToInt8E(val) }
+	case "DOUBLE", "FLOAT8":
+		convert = func() (driver.Value, error) { return cast.ToFloat64E(val) }
+	case "FLOAT", "FLOAT4", "REAL":
+		convert = func() (driver.Value, error) { return cast.ToFloat32E(val) }
+	case "BOOLEAN", "BOOL", "LOGICAL":
+		convert = func() (driver.Value, error) { return cast.ToBoolE(val) }
+	case "DATE", "TIMESTAMP", "DATETIME", "TIMESTAMP WITH TIME ZONE", "TIMESTAMPTZ":
+		convert = func() (driver.Value, error) {
+			if t, ok := val.(time.Time); ok {
+				return t, nil
+			}
+			return cast.ToTimeE(val)
+		}
+	case "BLOB", "BYTEA", "BINARY", "VARBINARY":
+		convert = func() (driver.Value, error) {
+			if b, ok := val.([]byte); ok {
+				return b, nil
+			}
+			return []byte(cast.ToString(val)), nil
+		}
+	default:
+		return nil, g.Error("column type not supported by appender: %s", dbType)
+	}
+
+	if val == nil {
+		return nil, nil
+	}
+	return convert()
+}
@@ -0,0 +1,21 @@
+//go:build duckdb_native
+
+package iop
+
+import (
+	"database/sql/driver"
+
+	// registers the native DuckDB driver (requires cgo and the
+	// github.com/marcboeker/go-duckdb module), used with `duckdb_driver: native`
+	"github.com/marcboeker/go-duckdb"
+)
+
+func init() {
+	NewDuckDbAppender = func(conn driver.Conn, schema, table string) (DuckDbAppender, error) {
+		appender, err := duckdb.NewAppenderFromConn(conn, schema, table)
+		if err != nil {
+			return nil, err
+		}
+		return appender, nil
+	}
+}
@@ -0,0 +1,161 @@
+package iop
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+
+	"github.com/flarco/g"
+	"github.com/spf13/cast"
+)
+
+// duckDbPool holds the sessions of a pooled DuckDb instance. Each session is a
+// separate DuckDb (its own process or native database), so that queries run
+// concurrently instead of waiting on the single session lock.
+type duckDbPool struct {
+	size     int
+	idle     chan *DuckDb
+	sessions []*DuckDb
+	mux      sync.Mutex
+}
+
+// PoolSize returns the number of sessions to use, from the `pool_size` property.
+// Separate sessions do not share state, so pooling only applies when the
+// instance is used as a compute layer (no database file), is read-only,
+// or is a MotherDuck database. A database file opened for writing can
+// only be held by one process.
+func (duck *DuckDb) PoolSize() int {
+	size := cast.ToInt(duck.GetProp("pool_size"))
+	if size <= 1 {
+		return 1
+	}
+
+	switch {
+	case duck.GetProp("motherduck_token") != "":
+	case cast.ToBool(duck.GetProp("read_only")):
+	case duck.GetProp("instance") == "":
+	default:
+		g.Debug("duckdb pool_size is ignored since instance is not read-only: %s", duck.GetProp("instance"))
+		return 1
+	}
+
+	return size
+}
+
+// IsPooled returns true if queries are dispatched to a pool of sessions
+func (duck *DuckDb) IsPooled() bool {
+	return duck.pool != nil
+}
+
+// openPool initializes the pool. Sessions are opened lazily, when needed.
+func (duck *DuckDb) openPool(size int) {
+	duck.pool = &duckDbPool{size: size, idle: make(chan *DuckDb, size)}
+	duck.SetProp("connected", "true")
+	g.Debug("using duckdb session pool (size %d)", size)
+}
+
+// closePool closes all the sessions of the pool
+func (duck *DuckDb) closePool() (err error) {
+	duck.SetProp("connected", "false")
+
+	duck.pool.mux.Lock()
+	sessions := duck.pool.sessions
+	duck.pool.sessions = nil
+	duck.pool.mux.Unlock()
+	duck.pool = nil
+
+	eG := g.ErrorGroup{}
+	for _, session := range sessions {
+		eG.Capture(session.Close())
+	}
+	if err = eG.Err(); err != nil {
+		return g.Error(err, "could not close duckdb sessions")
+	}
+	return nil
+}
+
+// sessionProps returns the properties for a new session of the pool
+func (duck *DuckDb) sessionProps() (props []string) {
+	for k, v := range duck.Props() {
+		switch strings.ToLower(k) {
+		case "connected", "pool_size":
+			continue
+		}
+		props = append(props, k+"="+v)
+	}
+	return props
+}
+
+// acquireSession returns an idle session, creates a new one if the pool is not
+// full, or waits for a session to be released.
+func (duck *DuckDb) acquireSession(ctx context.Context) (session *DuckDb, err error) {
+	pool := duck.pool
+	if pool == nil {
+		return nil, g.Error("duckdb session pool is not open")
+	}
+
+	select {
+	case session = <-pool.idle:
+	default:
+		pool.mux.Lock()
+		if len(pool.sessions) < pool.size {
+			session = NewDuckDb(duck.Context.Ctx, duck.sessionProps()...)
+			pool.sessions = append(pool.sessions, session)
+		}
+		pool.mux.Unlock()
+
+		if session == nil {
+			select {
+			case session = <-pool.idle:
+			case <-ctx.Done():
+				return nil, g.Error(ctx.Err(), "could not acquire duckdb session")
+			}
+		}
+	}
+
+	// extensions & secrets are submitted with each query
+	session.extensions = append([]string{}, duck.extensions...)
+	session.secrets = append([]string{}, duck.secrets...)
+
+	return session, nil
+}
+
+// releaseSession returns the session to the pool
+func (duck *DuckDb) releaseSession(session *DuckDb) {
+	if duck.pool == nil {
+		session.Close() // pool was closed
+		return
+	}
+	duck.pool.idle <- session
+}
+
+// execPooled executes the sql in a session of the pool
+func (duck *DuckDb) execPooled(ctx context.Context, sql string, args ...any) (result sql.Result, err error) {
+	session, err := duck.acquireSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer duck.releaseSession(session)
+
+	return session.ExecContext(ctx, sql, args...)
+}
+
+// streamPooled runs the sql in a session of the pool. The session is
+// released once the datastream is closed.
+func (duck *DuckDb) streamPooled(ctx context.Context, sql string, options ...map[string]any) (ds *Datastream, err error) {
+	session, err := duck.acquireSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ds, err = session.StreamContext(ctx, sql, options...)
+	if err != nil {
+		duck.releaseSession(session)
+		return ds, err
+	}
+
+	ds.Defer(func() { duck.releaseSession(session) })
+
+	return ds, nil
+}
@@ -2,8 +2,13 @@ package iop
 
 import (
 	"context"
+	"database/sql"
 	"testing"
+	"time"
 
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -128,3 +133,216 @@ func TestDuckDb(t *testing.T) {
 		assert.Contains(t, data.Columns.Names(), "file")
 	})
 }
+
+func TestDuckDbSessionSQL(t *testing.T) {
+	duck := NewDuckDb(context.Background())
+	sqls, err := duck.sessionSQL()
+	assert.NoError(t, err)
+	assert.Empty(t, sqls)
+
+	duck = NewDuckDb(
+		context.Background(),
+		"motherduck_token=token",
+		"database=analytics",
+		"create_database=true",
+		"share=analytics_share",
+		`attach=["/tmp/other.duckdb", {"path": "md:raw", "alias": "raw", "read_only": true}, {"path": "postgres://u:p@host/db", "alias": "pg", "type": "postgres"}]`,
+	)
+	sqls, err = duck.sessionSQL()
+	if assert.NoError(t, err) && assert.Len(t, sqls, 6) {
+		assert.Equal(t, `create database if not exists "analytics"`, sqls[0])
+		assert.Equal(t, `use "analytics"`, sqls[1])
+		assert.Equal(t, `attach if not exists '/tmp/other.duckdb'`, sqls[2])
+		assert.Equal(t, `attach if not exists 'md:raw' as "raw" (read_only)`, sqls[3])
+		assert.Equal(t, `attach if not exists 'postgres://u:p@host/db' as "pg" (type postgres)`, sqls[4])
+		assert.Equal(t, `create share if not exists "analytics_share" from "analytics" (update automatic)`, sqls[5])
+	}
+
+	// shares require motherduck
+	duck = NewDuckDb(context.Background(), "share=my_share")
+	_, err = duck.sessionSQL()
+	assert.Error(t, err)
+}
+
+func TestDuckDbNative(t *testing.T) {
+	duck := NewDuckDb(context.Background(), "instance=/tmp/test.duckdb", "read_only=true")
+	assert.False(t, duck.useNative())
+	assert.Equal(t, "/tmp/test.duckdb?access_mode=read_only", duck.nativeDSN())
+
+	duck = NewDuckDb(context.Background(), "duckdb_driver=native", "motherduck_token=abc", "database=my_db")
+	assert.True(t, duck.useNative())
+	assert.Equal(t, "md:my_db?motherduck_token=abc", duck.nativeDSN())
+
+	// driver is only compiled in with the duckdb_native build tag
+	if !lo.Contains(sql.Drivers(), DuckDbNativeDriver) {
+		err := duck.Open()
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "duckdb_native")
+		}
+	}
+
+	assert.Equal(t, `[1,2]`, duckDbNativeValue([]any{1, 2}))
+	assert.Equal(t, int64(5), duckDbNativeValue(int64(5)))
+	assert.Equal(t, "12.5", duckDbNativeValue(decimal.RequireFromString("12.50")))
+}
+
+func TestDuckDbAppendValue(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	cases := []struct {
+		dbType   string
+		val      any
+		expected any
+	}{
+		{"BIGINT", "12", int64(12)},
+		{"INTEGER", int64(7), int32(7)},
+		{"SMALLINT", 3.0, int16(3)},
+		{"DOUBLE", "1.5", 1.5},
+		{"BOOLEAN", "true", true},
+		{"VARCHAR", 10, "10"},
+		{"TIMESTAMP WITH TIME ZONE", ts, ts},
+		{"DATE", "2024-01-02 03:04:05", ts},
+		{"VARCHAR(255)", nil, nil},
+	}
+
+	for _, c := range cases {
+		val, err := duckDbAppendValue(c.dbType, c.val)
+		if assert.NoError(t, err, c.dbType) {
+			assert.Equal(t, c.expected, val, c.dbType)
+		}
+	}
+
+	_, err := duckDbAppendValue("DECIMAL(10,2)", "1.23")
+	assert.Error(t, err)
+
+	// appender requires the native driver
+	duck := NewDuckDb(context.Background())
+	assert.False(t, duck.CanAppend(Columns{{Name: "id", DbType: "BIGINT"}}))
+}
+
+func TestDuckDbPool(t *testing.T) {
+	// a database file opened for writing cannot be pooled
+	duck := NewDuckDb(context.Background(), "instance=/tmp/test.duckdb", "pool_size=4")
+	assert.Equal(t, 1, duck.PoolSize())
+
+	duck = NewDuckDb(context.Background(), "instance=/tmp/test.duckdb", "read_only=true", "pool_size=4")
+	assert.Equal(t, 4, duck.PoolSize())
+
+	duck = NewDuckDb(context.Background(), "pool_size=2")
+	assert.Equal(t, 2, duck.PoolSize())
+	assert.NoError(t, duck.Open())
+	assert.True(t, duck.IsPooled())
+	duck.AddExtension("httpfs")
+
+	s1, err := duck.acquireSession(context.Background())
+	assert.NoError(t, err)
+	s2, err := duck.acquireSession(context.Background())
+	assert.NoError(t, err)
+	assert.NotSame(t, s1, s2)
+	assert.Empty(t, s1.GetProp("pool_size"))
+	assert.Contains(t, s1.extensions, "httpfs")
+
+	// pool is full, waits for a release
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = duck.acquireSession(ctx)
+	assert.Error(t, err)
+
+	duck.releaseSession(s2)
+	s3, err := duck.acquireSession(context.Background())
+	assert.NoError(t, err)
+	assert.Same(t, s2, s3)
+
+	duck.releaseSession(s1)
+	duck.releaseSession(s3)
+	assert.NoError(t, duck.Close())
+	assert.False(t, duck.IsPooled())
+}
+
+func TestDuckDbSettingsSQL(t *testing.T) {
+	duck := NewDuckDb(context.Background(), "memory_limit=4GB", "threads=2")
+	sqls, err := duck.sessionSQL()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"set memory_limit = '4GB'", "set threads = 2"}, sqls)
+
+	// from the file system properties
+	fsProps := g.Marshal(map[string]string{"TEMP_DIRECTORY": "/scratch/duck", "threads": "4"})
+	duck = NewDuckDb(context.Background(), "fs_props="+fsProps)
+	sqls, err = duck.sessionSQL()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"set threads = 4", "set temp_directory = '/scratch/duck'"}, sqls)
+
+	duck = NewDuckDb(context.Background(), "threads=zero")
+	_, err = duck.sessionSQL()
+	assert.Error(t, err)
+}
+
+func TestDuckDbExtensions(t *testing.T) {
+	duck := NewDuckDb(context.Background(), "extensions=[\"spatial\",\"json\"]", "offline=false")
+	duck.AddExtension("json")
+	assert.Equal(t, []string{"json", "spatial"}, duck.Extensions())
+	assert.Equal(t, ";INSTALL json; LOAD json;;INSTALL spatial; LOAD spatial;", duck.getLoadExtensionSQL())
+
+	duck = NewDuckDb(context.Background(), "extensions=h3", "extension_repository=https://ext.example.com", "offline=false")
+	assert.Equal(t, ";INSTALL h3 FROM 'https://ext.example.com'; LOAD h3;", duck.getLoadExtensionSQL())
+
+	// offline, from a pre-bundled directory
+	fsProps := g.Marshal(map[string]string{"EXTENSIONS": "spatial", "EXTENSION_DIRECTORY": "/opt/duckdb/ext", "OFFLINE": "true"})
+	duck = NewDuckDb(context.Background(), "fs_props="+fsProps)
+	assert.Equal(t, ";SET extension_directory = '/opt/duckdb/ext';;SET autoinstall_known_extensions = false;; LOAD spatial;", duck.getLoadExtensionSQL())
+
+	err := duck.extensionErr(g.Error("IO Error: Extension \"/opt/duckdb/ext/spatial.duckdb_extension\" not found."))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "offline mode is enabled")
+		assert.Contains(t, err.Error(), "/opt/duckdb/ext")
+	}
+	assert.NotContains(t, duck.extensionErr(g.Error("Parser Error")).Error(), "offline")
+}
+
+func TestDuckDbQueryMarkers(t *testing.T) {
+	duck := NewDuckDb(context.Background())
+
+	// output of a previous query is ignored, errors are attributed by query ID
+	dq := duck.newQuery(context.Background())
+	assert.Contains(t, dq.startSQL(), duckDbSOFMarker+dq.ID)
+	assert.Contains(t, dq.endSQL(), "error('"+duckDbEOEMarker+dq.ID+"')")
+
+	go func(dq *duckDbQuery) {
+		dq.scan(true, "Binder Error: stale error")
+		dq.scan(false, duckDbEOFMarker+"qprev")
+		dq.scan(true, "Invalid Input Error: "+duckDbEOEMarker+"qprev")
+		dq.scan(false, "marker")
+		dq.scan(false, duckDbSOFMarker+dq.ID)
+		dq.scan(false, "changes:   2   total_changes: 2")
+		dq.scan(false, duckDbEOFMarker+dq.ID)
+		dq.scan(true, "Invalid Input Error: "+duckDbEOEMarker+dq.ID)
+	}(dq)
+
+	result, err := duck.waitForResult(dq)
+	assert.NoError(t, err)
+	changes, _ := result.RowsAffected()
+	assert.EqualValues(t, 2, changes)
+
+	// error after the result ended
+	dq = duck.newQuery(context.Background())
+	go func(dq *duckDbQuery) {
+		dq.scan(false, duckDbSOFMarker+dq.ID)
+		dq.scan(false, duckDbEOFMarker+dq.ID)
+		dq.scan(true, "Catalog Error: Table with name foo does not exist!")
+		dq.scan(true, "Invalid Input Error: "+duckDbEOEMarker+dq.ID)
+		dq.scan(true, "Invalid Input Error: late line ignored")
+	}(dq)
+
+	_, err = duck.waitForResult(dq)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Table with name foo does not exist")
+		assert.NotContains(t, err.Error(), duckDbEOEMarker)
+	}
+
+	// canceled query
+	ctx, cancel := context.WithCancel(context.Background())
+	dq = duck.newQuery(ctx)
+	cancel()
+	_, err = duck.waitForResult(dq)
+	assert.Error(t, err)
+}
@@ -0,0 +1,424 @@
+package iop
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/flarco/g"
+	"golang.org/x/crypto/openpgp"
+	_ "golang.org/x/crypto/ripemd160" // default hash of keys without preferences
+	"golang.org/x/crypto/scrypt"
+)
+
+// EncryptionType is the client-side encryption of files
+type EncryptionType string
+
+const (
+	// NoneEncryptionType is for no encryption
+	NoneEncryptionType EncryptionType = ""
+	// AesGcmEncryptionType is for AES-256-GCM, with a raw key or passphrase
+	AesGcmEncryptionType EncryptionType = "aes-gcm"
+	// GpgEncryptionType is for OpenPGP, with public keys or a passphrase
+	GpgEncryptionType EncryptionType = "gpg"
+	// AgeEncryptionType is for age, with recipients or a passphrase
+	AgeEncryptionType EncryptionType = "age"
+)
+
+// EncryptionConfig is the configuration of client-side encryption
+type EncryptionConfig struct {
+	Type       EncryptionType
+	Key        string // aes key (32 bytes, base64 or hex) or passphrase
+	PublicKey  string // gpg armored public key(s) or age recipients, content or file path
+	PrivateKey string // gpg armored private key or age identities, content or file path
+}
+
+// EncryptionConfigFromProps returns the encryption config from
+// the `encryption` properties
+func EncryptionConfigFromProps(getProp func(key string) string) EncryptionConfig {
+	return EncryptionConfig{
+		Type:       EncryptionType(strings.ToLower(strings.TrimSpace(getProp("encryption")))),
+		Key:        getProp("encryption_key"),
+		PublicKey:  getProp("encryption_public_key"),
+		PrivateKey: getProp("encryption_private_key"),
+	}
+}
+
+// Encryptor implements client-side encryption
+type Encryptor interface {
+	Encrypt(io.Reader) io.Reader
+	Decrypt(io.Reader) (io.Reader, error)
+	Suffix() string
+}
+
+// NewEncryptor returns the encryptor of the config, or nil if not encrypted
+func NewEncryptor(cfg EncryptionConfig) (Encryptor, error) {
+	switch cfg.Type {
+	case NoneEncryptionType, "none":
+		return nil, nil
+	case AesGcmEncryptionType:
+		if cfg.Key == "" {
+			return nil, g.Error("must provide encryption_key for aes-gcm encryption")
+		}
+		return &AesGcmEncryptor{key: cfg.Key}, nil
+	case GpgEncryptionType:
+		if cfg.Key == "" && cfg.PublicKey == "" && cfg.PrivateKey == "" {
+			return nil, g.Error("must provide encryption_key (passphrase) or encryption_public_key / encryption_private_key for gpg encryption")
+		}
+		return &GpgEncryptor{cfg: cfg}, nil
+	case AgeEncryptionType:
+		if cfg.Key == "" && cfg.PublicKey == "" && cfg.PrivateKey == "" {
+			return nil, g.Error("must provide encryption_key (passphrase) or encryption_public_key / encryption_private_key for age encryption")
+		}
+		return &AgeEncryptor{cfg: cfg}, nil
+	}
+	return nil, g.Error("invalid encryption type: %s (expected aes-gcm, gpg or age)", cfg.Type)
+}
+
+// encryptPipe runs the encrypt func into a pipe
+func encryptPipe(reader io.Reader, encrypt func(w io.Writer, r io.Reader) error) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(encrypt(pw, reader))
+	}()
+	return pr
+}
+
+// AesGcmEncryptor encrypts with AES-256-GCM in chunks of 64KB, so that
+// files are streamed. Each chunk is authenticated with its position and
+// whether it is the last chunk, so that truncation is detected.
+//
+// Format: magic (6) | key mode (1) | salt (16) | nonce prefix (7) | chunks...
+type AesGcmEncryptor struct {
+	key string
+}
+
+const (
+	aesGcmMagic     = "SLGCM\x01"
+	aesGcmChunkSize = 64 * 1024
+	aesGcmKeyRaw    = byte(0)
+	aesGcmKeyScrypt = byte(1)
+)
+
+// rawKey returns the key if it is a 32 byte key encoded in base64 or hex
+func (e *AesGcmEncryptor) rawKey() []byte {
+	if key, err := base64.StdEncoding.DecodeString(e.key); err == nil && len(key) == 32 {
+		return key
+	}
+	if key, err := hex.DecodeString(e.key); err == nil && len(key) == 32 {
+		return key
+	}
+	return nil
+}
+
+// aead returns the cipher for the key mode and salt
+func (e *AesGcmEncryptor) aead(mode byte, salt []byte) (aead cipher.AEAD, err error) {
+	key := e.rawKey()
+	if mode == aesGcmKeyScrypt {
+		key, err = scrypt.Key([]byte(e.key), salt, 32768, 8, 1, 32)
+		if err != nil {
+			return nil, g.Error(err, "could not derive key from passphrase")
+		}
+	} else if key == nil {
+		return nil, g.Error("file was encrypted with a raw key, but encryption_key is not a 32 byte key (base64 or hex)")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, g.Error(err, "could not create cipher")
+	}
+	return cipher.NewGCM(block)
+}
+
+func aesGcmNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[7:11], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// Encrypt encrypts the reader
+func (e *AesGcmEncryptor) Encrypt(reader io.Reader) io.Reader {
+	return encryptPipe(reader, func(w io.Writer, r io.Reader) (err error) {
+		mode := aesGcmKeyScrypt
+		if e.rawKey() != nil {
+			mode = aesGcmKeyRaw
+		}
+
+		header := make([]byte, 24)
+		header[0] = mode
+		if _, err = rand.Read(header[1:]); err != nil {
+			return g.Error(err, "could not generate nonce")
+		}
+		salt, prefix := header[1:17], header[17:24]
+
+		aead, err := e.aead(mode, salt)
+		if err != nil {
+			return err
+		}
+
+		if _, err = w.Write(append([]byte(aesGcmMagic), header...)); err != nil {
+			return err
+		}
+
+		// the last chunk is always shorter than the chunk size (possibly empty)
+		buf := make([]byte, aesGcmChunkSize)
+		for counter := uint32(0); ; counter++ {
+			n, err := io.ReadFull(r, buf)
+			last := n < aesGcmChunkSize
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return g.Error(err, "could not read")
+			}
+
+			sealed := aead.Seal(nil, aesGcmNonce(prefix, counter, last), buf[:n], nil)
+			if _, err = w.Write(sealed); err != nil {
+				return err
+			}
+			if last {
+				return nil
+			}
+		}
+	})
+}
+
+// Decrypt decrypts the reader
+func (e *AesGcmEncryptor) Decrypt(reader io.Reader) (io.Reader, error) {
+	header := make([]byte, len(aesGcmMagic)+24)
+	if _, err := io.ReadFull(reader, header); err != nil || string(header[:len(aesGcmMagic)]) != aesGcmMagic {
+		return nil, g.Error("not an aes-gcm encrypted file")
+	}
+	header = header[len(aesGcmMagic):]
+	salt, prefix := header[1:17], header[17:24]
+
+	aead, err := e.aead(header[0], salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return encryptPipe(reader, func(w io.Writer, r io.Reader) (err error) {
+		buf := make([]byte, aesGcmChunkSize+aead.Overhead())
+		for counter := uint32(0); ; counter++ {
+			n, err := io.ReadFull(r, buf)
+			last := n < len(buf)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return g.Error(err, "could not read")
+			}
+
+			plain, err := aead.Open(nil, aesGcmNonce(prefix, counter, last), buf[:n], nil)
+			if err != nil {
+				return g.Error("could not decrypt: wrong key or corrupted file")
+			}
+			if _, err = w.Write(plain); err != nil {
+				return err
+			}
+			if last {
+				return nil
+			}
+		}
+	}), nil
+}
+
+// Suffix returns the file suffix
+func (e *AesGcmEncryptor) Suffix() string {
+	return ".enc"
+}
+
+// GpgEncryptor encrypts with OpenPGP, to the public keys if provided,
+// otherwise symmetrically with the passphrase (encryption_key).
+type GpgEncryptor struct {
+	cfg EncryptionConfig
+}
+
+// readKeyRing reads an armored key ring from the content or a file path
+func readKeyRing(val string) (openpgp.EntityList, error) {
+	if !strings.Contains(val, "-----BEGIN") {
+		content, err := os.ReadFile(val)
+		if err != nil {
+			return nil, g.Error(err, "could not read key file")
+		}
+		val = string(content)
+	}
+
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewBufferString(val))
+	if err != nil {
+		return nil, g.Error(err, "could not read armored key")
+	}
+	return entities, nil
+}
+
+// Encrypt encrypts the reader
+func (e *GpgEncryptor) Encrypt(reader io.Reader) io.Reader {
+	return encryptPipe(reader, func(w io.Writer, r io.Reader) (err error) {
+		var plainW io.WriteCloser
+		if e.cfg.PublicKey != "" {
+			recipients, err := readKeyRing(e.cfg.PublicKey)
+			if err != nil {
+				return err
+			}
+			plainW, err = openpgp.Encrypt(w, recipients, nil, nil, nil)
+			if err != nil {
+				return g.Error(err, "could not encrypt")
+			}
+		} else {
+			plainW, err = openpgp.SymmetricallyEncrypt(w, []byte(e.cfg.Key), nil, nil)
+			if err != nil {
+				return g.Error(err, "could not encrypt")
+			}
+		}
+
+		if _, err = io.Copy(plainW, r); err != nil {
+			return g.Error(err, "could not encrypt")
+		}
+		return plainW.Close()
+	})
+}
+
+// Decrypt decrypts the reader
+func (e *GpgEncryptor) Decrypt(reader io.Reader) (io.Reader, error) {
+	var keyRing openpgp.EntityList
+	if e.cfg.PrivateKey != "" {
+		var err error
+		if keyRing, err = readKeyRing(e.cfg.PrivateKey); err != nil {
+			return nil, err
+		}
+	}
+
+	tried := false
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if tried {
+			return nil, g.Error("could not decrypt: wrong key or passphrase")
+		}
+		tried = true
+
+		// decrypt the private keys with the passphrase
+		for _, k := range keys {
+			if k.PrivateKey != nil && k.PrivateKey.Encrypted {
+				if err := k.PrivateKey.Decrypt([]byte(e.cfg.Key)); err != nil {
+					return nil, g.Error(err, "could not decrypt private key")
+				}
+			}
+		}
+		return []byte(e.cfg.Key), nil
+	}
+
+	md, err := openpgp.ReadMessage(reader, keyRing, prompt, nil)
+	if err != nil {
+		return nil, g.Error(err, "could not decrypt gpg file")
+	}
+	return &gpgBodyReader{body: md.UnverifiedBody}, nil
+}
+
+// gpgBodyReader keeps the end of the gpg body, since the integrity check
+// is repeated (and fails) when reading again after EOF
+type gpgBodyReader struct {
+	body io.Reader
+	err  error
+}
+
+func (r *gpgBodyReader) Read(p []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, r.err = r.body.Read(p)
+	return n, r.err
+}
+
+// Suffix returns the file suffix
+func (e *GpgEncryptor) Suffix() string {
+	return ".gpg"
+}
+
+// AgeEncryptor encrypts with age, to the recipients if provided,
+// otherwise with the passphrase (encryption_key).
+type AgeEncryptor struct {
+	cfg EncryptionConfig
+}
+
+// readAgeKeys reads the age recipients or identities from the content or a
+// file path, one per line
+func readAgeKeys(val, prefix string) (string, error) {
+	if !strings.Contains(val, prefix) {
+		content, err := os.ReadFile(val)
+		if err != nil {
+			return "", g.Error(err, "could not read key file")
+		}
+		val = string(content)
+	}
+	return val, nil
+}
+
+// Encrypt encrypts the reader
+func (e *AgeEncryptor) Encrypt(reader io.Reader) io.Reader {
+	return encryptPipe(reader, func(w io.Writer, r io.Reader) (err error) {
+		var recipients []age.Recipient
+		if e.cfg.PublicKey != "" {
+			keys, err := readAgeKeys(e.cfg.PublicKey, "age1")
+			if err != nil {
+				return err
+			}
+			recipients, err = age.ParseRecipients(strings.NewReader(keys))
+			if err != nil {
+				return g.Error(err, "could not parse age recipients")
+			}
+		} else {
+			recipient, err := age.NewScryptRecipient(e.cfg.Key)
+			if err != nil {
+				return g.Error(err, "could not use passphrase")
+			}
+			recipients = append(recipients, recipient)
+		}
+
+		plainW, err := age.Encrypt(w, recipients...)
+		if err != nil {
+			return g.Error(err, "could not encrypt")
+		}
+
+		if _, err = io.Copy(plainW, r); err != nil {
+			return g.Error(err, "could not encrypt")
+		}
+		return plainW.Close()
+	})
+}
+
+// Decrypt decrypts the reader
+func (e *AgeEncryptor) Decrypt(reader io.Reader) (io.Reader, error) {
+	var identities []age.Identity
+	if e.cfg.PrivateKey != "" {
+		keys, err := readAgeKeys(e.cfg.PrivateKey, "AGE-SECRET-KEY-")
+		if err != nil {
+			return nil, err
+		}
+		identities, err = age.ParseIdentities(strings.NewReader(keys))
+		if err != nil {
+			return nil, g.Error(err, "could not parse age identities")
+		}
+	} else {
+		identity, err := age.NewScryptIdentity(e.cfg.Key)
+		if err != nil {
+			return nil, g.Error(err, "could not use passphrase")
+		}
+		identities = append(identities, identity)
+	}
+
+	plainR, err := age.Decrypt(reader, identities...)
+	if err != nil {
+		return nil, g.Error(err, "could not decrypt age file")
+	}
+	return plainR, nil
+}
+
+// Suffix returns the file suffix
+func (e *AgeEncryptor) Suffix() string {
+	return ".age"
+}
@@ -0,0 +1,123 @@
+package iop
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func TestEncryption(t *testing.T) {
+	roundTrip := func(encryptor Encryptor, decryptor Encryptor, data []byte) ([]byte, error) {
+		encrypted, err := io.ReadAll(encryptor.Encrypt(bytes.NewReader(data)))
+		if err != nil {
+			return nil, err
+		}
+		reader, err := decryptor.Decrypt(bytes.NewReader(encrypted))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(reader)
+	}
+
+	// aes-gcm, with passphrase & raw key, on chunk boundaries
+	for _, key := range []string{"hunter2", strings.Repeat("ab", 32)} {
+		encryptor, err := NewEncryptor(EncryptionConfig{Type: AesGcmEncryptionType, Key: key})
+		if !assert.NoError(t, err) {
+			return
+		}
+		for _, size := range []int{0, 10, aesGcmChunkSize, 3*aesGcmChunkSize + 7} {
+			data := make([]byte, size)
+			rand.Read(data)
+			decrypted, err := roundTrip(encryptor, encryptor, data)
+			assert.NoError(t, err, size)
+			assert.True(t, bytes.Equal(data, decrypted), size)
+		}
+	}
+
+	// wrong key & truncation are detected
+	data := make([]byte, 2*aesGcmChunkSize+5)
+	rand.Read(data)
+	encryptor, _ := NewEncryptor(EncryptionConfig{Type: AesGcmEncryptionType, Key: "hunter2"})
+	wrong, _ := NewEncryptor(EncryptionConfig{Type: AesGcmEncryptionType, Key: "hunter3"})
+	_, err := roundTrip(encryptor, wrong, data)
+	assert.Error(t, err)
+
+	encrypted, _ := io.ReadAll(encryptor.Encrypt(bytes.NewReader(data)))
+	truncated := encrypted[:len(aesGcmMagic)+24+aesGcmChunkSize+16]
+	reader, err := encryptor.Decrypt(bytes.NewReader(truncated))
+	if assert.NoError(t, err) {
+		_, err = io.ReadAll(reader)
+		assert.Error(t, err)
+	}
+
+	// gpg symmetric
+	encryptor, _ = NewEncryptor(EncryptionConfig{Type: GpgEncryptionType, Key: "hunter2"})
+	decrypted, err := roundTrip(encryptor, encryptor, data)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, decrypted))
+
+	// gpg public key
+	entity, err := openpgp.NewEntity("sling", "", "sling@example.com", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	armored := func(serialize func(w io.Writer) error, blockType string) string {
+		buf := &bytes.Buffer{}
+		w, _ := armor.Encode(buf, blockType, nil)
+		assert.NoError(t, serialize(w))
+		w.Close()
+		return buf.String()
+	}
+	publicKey := armored(entity.Serialize, openpgp.PublicKeyType)
+	privateKey := armored(func(w io.Writer) error { return entity.SerializePrivate(w, nil) }, openpgp.PrivateKeyType)
+
+	encryptor, _ = NewEncryptor(EncryptionConfig{Type: GpgEncryptionType, PublicKey: publicKey})
+	decryptor, _ := NewEncryptor(EncryptionConfig{Type: GpgEncryptionType, PrivateKey: privateKey})
+	decrypted, err = roundTrip(encryptor, decryptor, data)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, decrypted))
+
+	// age passphrase
+	encryptor, _ = NewEncryptor(EncryptionConfig{Type: AgeEncryptionType, Key: "hunter2"})
+	decrypted, err = roundTrip(encryptor, encryptor, data)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, decrypted))
+	assert.Equal(t, ".age", encryptor.Suffix())
+
+	wrong, _ = NewEncryptor(EncryptionConfig{Type: AgeEncryptionType, Key: "hunter3"})
+	_, err = roundTrip(encryptor, wrong, data)
+	assert.Error(t, err)
+
+	// age recipients, from content & from file
+	identity, err := age.GenerateX25519Identity()
+	if !assert.NoError(t, err) {
+		return
+	}
+	identityFile := path.Join(t.TempDir(), "key.txt")
+	os.WriteFile(identityFile, []byte("# created: now\n"+identity.String()+"\n"), 0600)
+
+	encryptor, _ = NewEncryptor(EncryptionConfig{Type: AgeEncryptionType, PublicKey: identity.Recipient().String()})
+	decryptor, _ = NewEncryptor(EncryptionConfig{Type: AgeEncryptionType, PrivateKey: identityFile})
+	decrypted, err = roundTrip(encryptor, decryptor, data)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, decrypted))
+
+	other, _ := age.GenerateX25519Identity()
+	wrong, _ = NewEncryptor(EncryptionConfig{Type: AgeEncryptionType, PrivateKey: other.String()})
+	_, err = roundTrip(encryptor, wrong, data)
+	assert.Error(t, err)
+
+	_, err = NewEncryptor(EncryptionConfig{Type: AgeEncryptionType})
+	assert.Error(t, err)
+	_, err = NewEncryptor(EncryptionConfig{Type: AesGcmEncryptionType})
+	assert.Error(t, err)
+}
@@ -0,0 +1,883 @@
+package iop
+
+import (
+	"go/scanner"
+	"go/token"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cast"
+)
+
+// Expression is a row expression, parsed once and evaluated by the engine
+// for each row. It supports:
+//   - literals: numbers, "strings", true, false, nil, arrays ([1, 2])
+//   - column references: my_col (or lowercase), col("My Col")
+//   - comparisons: ==, !=, <, <=, >, >= (numbers or strings), in [...]
+//   - logic: &&, ||, !
+//   - arithmetic: +, -, *, /, % (+ concatenates strings)
+//   - functions: any transform in TransformsMap (e.g. `lower(name)`), plus the built-ins in exprFuncs
+//
+// Timestamps are strings, compared with `epoch(created_at) >= epoch("2024-01-01")`.
+// An operation on a null value is null, which is false. `==` and `!=`
+// compare with nil, and `false && null` / `true || null` are not null.
+type Expression struct {
+	Text string
+
+	fields  []string
+	eval    exprNode
+	binding atomic.Pointer[exprBinding] // column indexes of the fields
+}
+
+// ExprFunction is a function called in an expression with the evaluated
+// arguments. It returns nil, bool, int, float64, string or []any.
+type ExprFunction = func(args ...any) (any, error)
+
+// exprRow is the row being evaluated, passed to each node
+type exprRow struct {
+	sp      *StreamProcessor
+	columns Columns
+	values  []any
+	indexes map[string]int
+}
+
+// exprNode is a compiled node of the expression
+type exprNode func(r *exprRow) (any, error)
+
+// exprBinding is the column index of the fields, for a number of columns
+type exprBinding struct {
+	numCols int
+	indexes map[string]int
+}
+
+// ParseExpression parses the expression text
+func ParseExpression(text string) (expr *Expression, err error) {
+	p := &exprParser{text: text}
+	if err = p.scan(); err != nil {
+		return nil, g.Error(err, "could not parse expression: %s", text)
+	}
+
+	expr = &Expression{Text: text}
+	if expr.eval, err = p.parseExpr(); err != nil {
+		return nil, g.Error(err, "could not parse expression: %s", text)
+	} else if p.peek().tok != token.EOF {
+		return nil, g.Error("could not parse expression: %s (unexpected %s)", text, p.peek())
+	}
+	expr.fields = p.fields
+
+	return expr, nil
+}
+
+// Fields returns the column names referenced in the expression
+func (e *Expression) Fields() (fields []string) {
+	for _, field := range e.fields {
+		if !g.In(field, fields...) {
+			fields = append(fields, field)
+		}
+	}
+	return
+}
+
+// Eval evaluates the expression against the provided row
+func (e *Expression) Eval(sp *StreamProcessor, columns Columns, row []any) (val any, err error) {
+	binding := e.binding.Load()
+	if binding == nil || binding.numCols != len(columns) {
+		if binding, err = e.bind(columns); err != nil {
+			return nil, err
+		}
+		e.binding.Store(binding)
+	}
+
+	return e.eval(&exprRow{sp: sp, columns: columns, values: row, indexes: binding.indexes})
+}
+
+// EvalBool evaluates the expression and returns its truthiness.
+// A null result is considered false.
+func (e *Expression) EvalBool(sp *StreamProcessor, columns Columns, row []any) (bool, error) {
+	val, err := e.Eval(sp, columns, row)
+	if err != nil {
+		return false, g.Error(err, "could not evaluate expression: %s", e.Text)
+	}
+	return exprTruthy(val), nil
+}
+
+// bind resolves the column index of the fields, by name (or lowercase)
+func (e *Expression) bind(columns Columns) (binding *exprBinding, err error) {
+	binding = &exprBinding{numCols: len(columns), indexes: map[string]int{}}
+	for _, field := range e.Fields() {
+		i := exprColumnIndex(columns, field)
+		if i < 0 {
+			return nil, g.Error("column not found for expression: %s", field)
+		}
+		binding.indexes[field] = i
+	}
+	return binding, nil
+}
+
+// value returns the value of the column index, nil if missing
+func (r *exprRow) value(i int) any {
+	if i < 0 || i >= len(r.values) {
+		return nil
+	}
+	return exprValue(r.values[i])
+}
+
+// exprColumnIndex returns the index of the column by name (or lowercase),
+// -1 if not found
+func exprColumnIndex(columns Columns, name string) int {
+	for i, col := range columns {
+		if col.Name == name {
+			return i
+		}
+	}
+	for i, col := range columns {
+		if strings.EqualFold(col.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+type exprToken struct {
+	tok token.Token
+	lit string
+}
+
+func (t exprToken) String() string {
+	if t.lit != "" {
+		return t.lit
+	} else if t.tok == token.EOF {
+		return "end of expression"
+	}
+	return t.tok.String()
+}
+
+// exprParser compiles the tokens into nodes, by precedence:
+// ||, &&, comparisons, + -, * / %, unary ! -
+type exprParser struct {
+	text   string
+	tokens []exprToken
+	pos    int
+	fields []string
+}
+
+// scan splits the text into tokens, with the go scanner
+func (p *exprParser) scan() (err error) {
+	var s scanner.Scanner
+	src := []byte(p.text)
+	s.Init(token.NewFileSet().AddFile("", -1, len(src)), src, func(pos token.Position, msg string) {
+		if err == nil {
+			err = g.Error("%s at column %d", msg, pos.Column)
+		}
+	}, 0)
+
+	for {
+		_, tok, lit := s.Scan()
+		switch {
+		case err != nil:
+			return err
+		case tok == token.EOF:
+			p.tokens = append(p.tokens, exprToken{tok: tok})
+			return nil
+		case tok == token.SEMICOLON && lit == "\n":
+			continue // automatically inserted
+		case tok == token.ILLEGAL:
+			return g.Error("illegal character %s", lit)
+		case tok.IsKeyword():
+			tok = token.IDENT
+		}
+		p.tokens = append(p.tokens, exprToken{tok: tok, lit: lit})
+	}
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.tok != token.EOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) expect(tok token.Token) error {
+	if t := p.next(); t.tok != tok {
+		return g.Error("expected %s, got %s", tok, t)
+	}
+	return nil
+}
+
+func (p *exprParser) parseExpr() (exprNode, error) {
+	return p.parseOr()
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().tok == token.LOR {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = exprLogic(left, right, true)
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().tok == token.LAND {
+		p.next()
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = exprLogic(left, right, false)
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	switch {
+	case g.In(t.tok, token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ):
+		p.next()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return exprBinary(t.tok, left, right), nil
+	case t.tok == token.IDENT && strings.EqualFold(t.lit, "in"):
+		p.next()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return exprIn(left, right), nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.tok == token.ADD || t.tok == token.SUB; t = p.peek() {
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = exprBinary(t.tok, left, right)
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); g.In(t.tok, token.MUL, token.QUO, token.REM); t = p.peek() {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = exprBinary(t.tok, left, right)
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	switch t := p.peek(); t.tok {
+	case token.NOT, token.SUB:
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return exprUnary(t.tok, operand), nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.tok {
+	case token.INT:
+		val, err := strconv.ParseInt(t.lit, 0, 64)
+		if err != nil {
+			return nil, g.Error("invalid number %s", t.lit)
+		}
+		return exprConst(int(val)), nil
+	case token.FLOAT:
+		val, err := strconv.ParseFloat(t.lit, 64)
+		if err != nil {
+			return nil, g.Error("invalid number %s", t.lit)
+		}
+		return exprConst(val), nil
+	case token.STRING:
+		val, err := strconv.Unquote(t.lit)
+		if err != nil {
+			return nil, g.Error("invalid string %s", t.lit)
+		}
+		return exprConst(val), nil
+	case token.LPAREN:
+		node, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(token.RPAREN)
+	case token.LBRACK:
+		items, err := p.parseList(token.RBRACK)
+		if err != nil {
+			return nil, err
+		}
+		return exprArray(items), nil
+	case token.IDENT:
+		switch t.lit {
+		case "nil":
+			return exprConst(nil), nil
+		case "true", "false":
+			return exprConst(t.lit == "true"), nil
+		}
+
+		if p.peek().tok == token.LPAREN {
+			p.next()
+			args, err := p.parseList(token.RPAREN)
+			if err != nil {
+				return nil, err
+			}
+			return p.function(t.lit, args)
+		}
+
+		field := t.lit
+		p.fields = append(p.fields, field)
+		return func(r *exprRow) (any, error) {
+			return r.value(r.indexes[field]), nil
+		}, nil
+	}
+	return nil, g.Error("unexpected %s", t)
+}
+
+// parseList parses the comma separated nodes, until the closing token
+func (p *exprParser) parseList(closing token.Token) (nodes []exprNode, err error) {
+	if p.peek().tok == closing {
+		p.next()
+		return nodes, nil
+	}
+	for {
+		node, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+
+		if t := p.next(); t.tok == closing {
+			return nodes, nil
+		} else if t.tok != token.COMMA {
+			return nil, g.Error("expected , or %s, got %s", closing, t)
+		}
+	}
+}
+
+// function returns the node calling the function with the evaluated arguments
+func (p *exprParser) function(name string, args []exprNode) (exprNode, error) {
+	evalArgs := func(r *exprRow) (values []any, err error) {
+		values = make([]any, len(args))
+		for i, arg := range args {
+			if values[i], err = arg(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+
+	// col returns the value of a column by name, for names which are not
+	// identifiers, e.g. `col("My Col")`
+	if name == "col" {
+		if len(args) != 1 {
+			return nil, g.Error("expected 1 argument for col, got %d", len(args))
+		}
+		return func(r *exprRow) (any, error) {
+			values, err := evalArgs(r)
+			if err != nil {
+				return nil, err
+			}
+			i := exprColumnIndex(r.columns, cast.ToString(values[0]))
+			if i < 0 {
+				return nil, g.Error("column not found for expression: %s", values[0])
+			}
+			return r.value(i), nil
+		}, nil
+	}
+
+	if fn, ok := exprFuncs[name]; ok {
+		return func(r *exprRow) (any, error) {
+			values, err := evalArgs(r)
+			if err != nil {
+				return nil, err
+			}
+			return fn(values...)
+		}, nil
+	}
+
+	if t, ok := TransformsMap[name]; ok && t.FuncString != nil {
+		if len(args) != 1 {
+			return nil, g.Error("expected 1 argument for %s, got %d", name, len(args))
+		}
+		return func(r *exprRow) (any, error) {
+			values, err := evalArgs(r)
+			if err != nil || values[0] == nil {
+				return nil, err
+			}
+			if r.sp == nil {
+				r.sp = NewStreamProcessor()
+			}
+			return t.FuncString(r.sp, cast.ToString(values[0]))
+		}, nil
+	}
+
+	return nil, g.Error("unknown function %s", name)
+}
+
+func exprConst(val any) exprNode {
+	return func(r *exprRow) (any, error) { return val, nil }
+}
+
+func exprArray(items []exprNode) exprNode {
+	return func(r *exprRow) (any, error) {
+		values := make([]any, len(items))
+		for i, item := range items {
+			val, err := item(r)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = val
+		}
+		return values, nil
+	}
+}
+
+// exprLogic returns the node of && (or ||), with the null logic of SQL:
+// the result is null if it depends on a null operand
+func exprLogic(left, right exprNode, or bool) exprNode {
+	operand := func(node exprNode, r *exprRow) (val *bool, err error) {
+		v, err := node(r)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return nil, g.Error("type error: required bool, but was %s", exprTypeName(v))
+		}
+		return &b, nil
+	}
+
+	return func(r *exprRow) (any, error) {
+		l, err := operand(left, r)
+		if err != nil {
+			return nil, err
+		} else if l != nil && *l == or {
+			return or, nil // short circuit
+		}
+
+		rv, err := operand(right, r)
+		if err != nil {
+			return nil, err
+		} else if rv != nil && *rv == or {
+			return or, nil
+		} else if l == nil || rv == nil {
+			return nil, nil
+		}
+		return !or, nil
+	}
+}
+
+func exprUnary(op token.Token, operand exprNode) exprNode {
+	return func(r *exprRow) (any, error) {
+		v, err := operand(r)
+		if err != nil || v == nil {
+			return nil, err
+		}
+
+		switch val := v.(type) {
+		case bool:
+			if op == token.NOT {
+				return !val, nil
+			}
+		case int:
+			if op == token.SUB {
+				return -val, nil
+			}
+		case float64:
+			if op == token.SUB {
+				return -val, nil
+			}
+		}
+		return nil, g.Error("type error: cannot apply %s to type %s", op, exprTypeName(v))
+	}
+}
+
+func exprBinary(op token.Token, left, right exprNode) exprNode {
+	return func(r *exprRow) (any, error) {
+		l, err := left(r)
+		if err != nil {
+			return nil, err
+		}
+		rv, err := right(r)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case token.EQL:
+			return exprEqual(l, rv), nil
+		case token.NEQ:
+			return !exprEqual(l, rv), nil
+		}
+
+		if l == nil || rv == nil {
+			return nil, nil // null operand
+		}
+
+		switch op {
+		case token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return exprCompare(op, l, rv)
+		}
+		return exprArithmetic(op, l, rv)
+	}
+}
+
+func exprIn(left, right exprNode) exprNode {
+	return func(r *exprRow) (any, error) {
+		l, err := left(r)
+		if err != nil {
+			return nil, err
+		}
+		rv, err := right(r)
+		if err != nil || l == nil || rv == nil {
+			return nil, err
+		}
+
+		items, ok := rv.([]any)
+		if !ok {
+			return nil, g.Error("type error: required array after in, but was %s", exprTypeName(rv))
+		}
+		for _, item := range items {
+			if exprEqual(l, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// exprEqual returns true if the values are equal, numbers by value
+func exprEqual(a, b any) bool {
+	if fa, ok := exprNumber(a); ok {
+		fb, ok := exprNumber(b)
+		return ok && fa == fb
+	}
+	switch av := a.(type) {
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !exprEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func exprCompare(op token.Token, a, b any) (any, error) {
+	var cmp int
+	fa, okA := exprNumber(a)
+	fb, okB := exprNumber(b)
+	sa, okSA := a.(string)
+	sb, okSB := b.(string)
+	switch {
+	case okA && okB:
+		if fa < fb {
+			cmp = -1
+		} else if fa > fb {
+			cmp = 1
+		}
+	case okSA && okSB:
+		cmp = strings.Compare(sa, sb)
+	default:
+		return nil, g.Error("type error: cannot compare type %s and %s", exprTypeName(a), exprTypeName(b))
+	}
+
+	switch op {
+	case token.LSS:
+		return cmp < 0, nil
+	case token.LEQ:
+		return cmp <= 0, nil
+	case token.GTR:
+		return cmp > 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+func exprArithmetic(op token.Token, a, b any) (any, error) {
+	if op == token.ADD {
+		sa, okA := a.(string)
+		sb, okB := b.(string)
+		if okA && okB {
+			return sa + sb, nil
+		}
+	}
+
+	ia, intA := a.(int)
+	ib, intB := b.(int)
+	if intA && intB {
+		switch op {
+		case token.ADD:
+			return ia + ib, nil
+		case token.SUB:
+			return ia - ib, nil
+		case token.MUL:
+			return ia * ib, nil
+		case token.QUO:
+			if ib == 0 {
+				return nil, g.Error("division by zero")
+			} else if ia%ib == 0 {
+				return ia / ib, nil
+			}
+			return float64(ia) / float64(ib), nil
+		case token.REM:
+			if ib == 0 {
+				return nil, g.Error("division by zero")
+			}
+			return ia % ib, nil
+		}
+	}
+
+	fa, okA := exprNumber(a)
+	fb, okB := exprNumber(b)
+	if !okA || !okB {
+		return nil, g.Error("type error: cannot apply %s to type %s and %s", op, exprTypeName(a), exprTypeName(b))
+	}
+	switch op {
+	case token.ADD:
+		return fa + fb, nil
+	case token.SUB:
+		return fa - fb, nil
+	case token.MUL:
+		return fa * fb, nil
+	case token.QUO:
+		if fb == 0 {
+			return nil, g.Error("division by zero")
+		}
+		return fa / fb, nil
+	}
+	if fb == 0 {
+		return nil, g.Error("division by zero")
+	}
+	return math.Mod(fa, fb), nil
+}
+
+// exprNumber returns the float value of a number
+func exprNumber(val any) (float64, bool) {
+	switch v := val.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// exprTypeName returns the type name of a value, for errors
+func exprTypeName(val any) string {
+	switch val.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "bool"
+	case int, float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	}
+	return "unknown"
+}
+
+// exprFuncs are the built-in functions available in expressions,
+// in addition to the transforms in TransformsMap
+var exprFuncs = map[string]ExprFunction{
+	"coalesce": func(args ...any) (any, error) {
+		for _, arg := range args {
+			if arg != nil {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	},
+	"length": func(args ...any) (any, error) {
+		if len(args) != 1 {
+			return nil, g.Error("expected 1 argument, got %d", len(args))
+		} else if args[0] == nil {
+			return nil, nil
+		}
+		return len([]rune(cast.ToString(args[0]))), nil
+	},
+	"contains": func(args ...any) (any, error) {
+		if len(args) != 2 {
+			return nil, g.Error("expected 2 arguments, got %d", len(args))
+		} else if args[0] == nil || args[1] == nil {
+			return nil, nil
+		}
+		return strings.Contains(cast.ToString(args[0]), cast.ToString(args[1])), nil
+	},
+	"starts_with": func(args ...any) (any, error) {
+		if len(args) != 2 {
+			return nil, g.Error("expected 2 arguments, got %d", len(args))
+		} else if args[0] == nil || args[1] == nil {
+			return nil, nil
+		}
+		return strings.HasPrefix(cast.ToString(args[0]), cast.ToString(args[1])), nil
+	},
+	"ends_with": func(args ...any) (any, error) {
+		if len(args) != 2 {
+			return nil, g.Error("expected 2 arguments, got %d", len(args))
+		} else if args[0] == nil || args[1] == nil {
+			return nil, nil
+		}
+		return strings.HasSuffix(cast.ToString(args[0]), cast.ToString(args[1])), nil
+	},
+	// like matches a SQL like pattern (with % and _)
+	"like": func(args ...any) (any, error) {
+		if len(args) != 2 {
+			return nil, g.Error("expected 2 arguments, got %d", len(args))
+		} else if args[0] == nil || args[1] == nil {
+			return nil, nil
+		}
+		regex, err := likeToRegex(cast.ToString(args[1]))
+		if err != nil {
+			return nil, g.Error(err, "invalid like pattern: %s", args[1])
+		}
+		return regex.MatchString(cast.ToString(args[0])), nil
+	},
+	// epoch returns the unix time (seconds) of a date or timestamp
+	"epoch": func(args ...any) (any, error) {
+		if len(args) != 1 {
+			return nil, g.Error("expected 1 argument, got %d", len(args))
+		} else if args[0] == nil {
+			return nil, nil
+		}
+		t, err := cast.ToTimeE(args[0])
+		if err != nil {
+			return nil, g.Error(err, "invalid timestamp: %s", args[0])
+		}
+		return float64(t.UnixNano()) / 1e9, nil
+	},
+	// now returns the current unix time (seconds)
+	"now": func(args ...any) (any, error) {
+		return float64(time.Now().UnixNano()) / 1e9, nil
+	},
+}
+
+// exprValue converts the row value to an expression type (nil, bool, int,
+// float64 or string)
+func exprValue(val any) any {
+	switch v := val.(type) {
+	case nil, bool, int, float64, string:
+		return v
+	case int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return cast.ToInt(v)
+	case float32:
+		return float64(v)
+	case decimal.Decimal:
+		return v.InexactFloat64()
+	case *decimal.Decimal:
+		if v == nil {
+			return nil
+		}
+		return v.InexactFloat64()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return v.Format(time.RFC3339Nano)
+	}
+	return cast.ToString(val)
+}
+
+// exprTruthy returns the boolean value of an evaluated expression
+func exprTruthy(val any) bool {
+	switch v := val.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		b, err := cast.ToBoolE(v)
+		return err == nil && b
+	}
+	f, err := cast.ToFloat64E(val)
+	return err == nil && f != 0
+}
+
+// likeRegexes are the compiled like patterns
+var likeRegexes sync.Map
+
+// likeToRegex converts a SQL like pattern into a regex, cached per pattern
+func likeToRegex(pattern string) (*regexp.Regexp, error) {
+	if regex, ok := likeRegexes.Load(pattern); ok {
+		return regex.(*regexp.Regexp), nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			sb.WriteString(".*")
+		case '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+
+	regex, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, err
+	}
+	likeRegexes.Store(pattern, regex)
+	return regex, nil
+}
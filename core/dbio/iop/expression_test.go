@@ -0,0 +1,126 @@
+package iop
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpression(t *testing.T) {
+	columns := NewColumnsFromFields("id", "Name", "amount", "created_at", "status")
+	row := []any{int64(5), "Alice", 10.5, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), nil}
+
+	type testCase struct {
+		expr     string
+		expected bool
+	}
+
+	cases := []testCase{
+		{`id == 5`, true},
+		{`id == 5 && amount > 10`, true},
+		{`id > 5 || amount < 10`, false},
+		{`!(id > 5)`, true},
+		{`Name == "Alice"`, true},
+		{`name != "Bob"`, true},
+		{`col("Name") == "Alice"`, true},
+		{`lower(name) == "alice"`, true},
+		{`upper(name) in ["ALICE", "BOB"]`, true},
+		{`!(name in ["Alice"])`, false},
+		{`like(name, "Al%")`, true},
+		{`!like(name, "_lice")`, false},
+		{`status == nil`, true},
+		{`status != nil`, false},
+		{`status == "active"`, false},
+		{`status > 1`, false}, // null
+		{`coalesce(status, "none") == "none"`, true},
+		{`epoch(created_at) >= epoch("2024-01-01")`, true},
+		{`epoch(created_at) < epoch("2024-01-01")`, false},
+		{`amount * 2 == 21`, true},
+		{`id % 2 == 1 && length(name) == 5`, true},
+		{`starts_with(name, "A") || ends_with(name, "z")`, true},
+		{`name + "!" == "Alice!"`, true},
+		{`-id < 0`, true},
+		{`status > 1 || id == 5`, true}, // true || null
+		{`status > 1 && id == 5`, false},
+		{`!(status > 1)`, false}, // null
+		{`id / 2 == 2.5 && id / 5 == 1`, true},
+		{`name > "Aaron" && name <= "Alice"`, true},
+	}
+
+	for _, c := range cases {
+		expr, err := ParseExpression(c.expr)
+		if !assert.NoError(t, err, c.expr) {
+			continue
+		}
+		val, err := expr.EvalBool(nil, columns, row)
+		if assert.NoError(t, err, c.expr) {
+			assert.Equal(t, c.expected, val, c.expr)
+		}
+	}
+
+	// invalid expressions
+	for _, text := range []string{`id == `, `id == "abc`, `unknown_func(id)`, `(id == 5`, `id # 5`} {
+		_, err := ParseExpression(text)
+		assert.Error(t, err, text)
+	}
+
+	// missing column
+	expr, err := ParseExpression(`missing == 1 || col("Missing Too") == 1`)
+	assert.NoError(t, err)
+	_, err = expr.EvalBool(nil, columns, row)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"missing"}, expr.Fields())
+
+	// type errors
+	for text, msg := range map[string]string{
+		`name > 1`:     "cannot compare type string and number",
+		`id && true`:   "required bool, but was number",
+		`id in 5`:      "required array after in",
+		`name * 2 > 1`: "cannot apply * to type string and number",
+		`id % 0 == 1`:  "division by zero",
+	} {
+		expr, err = ParseExpression(text)
+		if assert.NoError(t, err, text) {
+			_, err = expr.EvalBool(nil, columns, row)
+			assert.ErrorContains(t, err, msg, text)
+		}
+	}
+
+	// like patterns are compiled once
+	expr, _ = ParseExpression(`like(name, "A_i%")`)
+	for i := 0; i < 3; i++ {
+		val, err := expr.EvalBool(nil, columns, row)
+		assert.NoError(t, err)
+		assert.True(t, val)
+	}
+	regex, ok := likeRegexes.Load("A_i%")
+	if assert.True(t, ok) {
+		cached, _ := likeToRegex("A_i%")
+		assert.Same(t, regex, cached)
+	}
+
+	// the columns are bound again when they change
+	expr, _ = ParseExpression(`name == "Bob"`)
+	val, err := expr.EvalBool(nil, NewColumnsFromFields("name"), []any{"Bob"})
+	assert.NoError(t, err)
+	assert.True(t, val)
+	val, err = expr.EvalBool(nil, NewColumnsFromFields("id", "name"), []any{1, "Bob"})
+	assert.NoError(t, err)
+	assert.True(t, val)
+}
+
+func TestStreamProcessorFilterRow(t *testing.T) {
+	sp := NewStreamProcessor()
+	assert.NoError(t, sp.SetConfig(map[string]string{"filter": "amount >= 10"}))
+
+	columns := NewColumnsFromFields("id", "amount")
+	assert.True(t, sp.FilterRow([]any{1, 20}, columns))
+	assert.False(t, sp.FilterRow([]any{2, 5}, columns))
+	assert.False(t, sp.FilterRow([]any{3, nil}, columns))
+	assert.EqualValues(t, 2, sp.filteredCnt)
+
+	// invalid filters are returned
+	err := NewStreamProcessor().SetConfig(map[string]string{"filter": "amount >= "})
+	assert.ErrorContains(t, err, "could not parse expression")
+}
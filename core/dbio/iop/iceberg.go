@@ -2,6 +2,7 @@ package iop
 
 import (
 	"context"
+	"strings"
 
 	"github.com/flarco/g"
 	"github.com/slingdata-io/sling-cli/core/dbio"
@@ -48,3 +49,117 @@ func (r *IcebergReader) MakeQuery(sc FileStreamConfig) string {
 	sql := r.Duck.MakeScanQuery(dbio.FileTypeIceberg, r.URI, sc)
 	return sql
 }
+
+// IcebergCatalogAlias is the name of the attached Iceberg catalog
+const IcebergCatalogAlias = "iceberg_catalog"
+
+// icebergCatalogType returns the Iceberg catalog type, from the
+// `iceberg_catalog_type` property: rest, glue or s3_tables.
+// When empty, Iceberg tables are read from their metadata path.
+func (duck *DuckDb) icebergCatalogType() string {
+	return strings.ToLower(duck.setting("iceberg_catalog_type"))
+}
+
+// icebergCatalogSQL returns the statements to attach the Iceberg catalog. Properties:
+// `iceberg_catalog_type`, `iceberg_catalog_uri` (REST endpoint), `iceberg_warehouse`
+// (warehouse, Glue account ID or S3 Tables bucket ARN), and the REST credentials
+// `iceberg_client_id`, `iceberg_client_secret`, `iceberg_oauth2_server_uri` or `iceberg_token`.
+func (duck *DuckDb) icebergCatalogSQL() (sqls []string, err error) {
+	catalogType := duck.icebergCatalogType()
+	if catalogType == "" {
+		return nil, nil
+	}
+
+	quote := func(val string) string { return "'" + strings.ReplaceAll(val, "'", "''") + "'" }
+	warehouse := duck.setting("iceberg_warehouse")
+	options := []string{"TYPE ICEBERG"}
+
+	switch catalogType {
+	case "rest":
+		endpoint := duck.setting("iceberg_catalog_uri")
+		if endpoint == "" {
+			return nil, g.Error("iceberg_catalog_uri is required for the rest iceberg catalog")
+		}
+		options = append(options, "ENDPOINT "+quote(endpoint))
+
+		secretOptions := []string{"TYPE ICEBERG"}
+		if token := duck.setting("iceberg_token"); token != "" {
+			secretOptions = append(secretOptions, "TOKEN "+quote(token))
+		} else if clientID := duck.setting("iceberg_client_id"); clientID != "" {
+			secretOptions = append(secretOptions,
+				"CLIENT_ID "+quote(clientID),
+				"CLIENT_SECRET "+quote(duck.setting("iceberg_client_secret")),
+			)
+			if oauthURI := duck.setting("iceberg_oauth2_server_uri"); oauthURI != "" {
+				secretOptions = append(secretOptions, "OAUTH2_SERVER_URI "+quote(oauthURI))
+			}
+		}
+
+		if len(secretOptions) > 1 {
+			secretName := IcebergCatalogAlias + "_secret"
+			sqls = append(sqls, g.F("create or replace secret %s (%s)", secretName, strings.Join(secretOptions, ", ")))
+			options = append(options, "SECRET "+secretName)
+		} else {
+			options = append(options, "AUTHORIZATION_TYPE 'none'")
+		}
+	case "glue", "s3_tables":
+		if warehouse == "" {
+			return nil, g.Error("iceberg_warehouse is required for the %s iceberg catalog (account ID or table bucket ARN)", catalogType)
+		}
+		options = append(options, "ENDPOINT_TYPE "+strings.ToUpper(catalogType))
+	default:
+		return nil, g.Error("invalid iceberg_catalog_type: %s (expected rest, glue or s3_tables)", catalogType)
+	}
+
+	duck.AddExtension("iceberg")
+	sqls = append(sqls, g.F("attach if not exists %s as %s (%s)", quote(warehouse), IcebergCatalogAlias, strings.Join(options, ", ")))
+
+	return sqls, nil
+}
+
+// icebergTableName returns the quoted catalog table name from the uri: the
+// last path part is the namespace & table (`ns.table`), or the last two (`ns/table`)
+func (duck *DuckDb) icebergTableName(uri string) string {
+	pathParts := strings.Split(strings.Trim(uri, "/"), "/")
+	names := strings.Split(pathParts[len(pathParts)-1], ".")
+	if len(names) == 1 && len(pathParts) > 1 {
+		if namespace := pathParts[len(pathParts)-2]; namespace != "" && !strings.HasSuffix(namespace, ":") {
+			names = []string{namespace, names[0]}
+		}
+	}
+
+	parts := []string{IcebergCatalogAlias}
+	for _, name := range names {
+		parts = append(parts, duck.Quote(name))
+	}
+	return strings.Join(parts, ".")
+}
+
+// icebergScanner returns the stream scanner for an Iceberg table, from the
+// catalog or from the metadata path, selecting the snapshot for time travel
+func (duck *DuckDb) icebergScanner(uri string, fsc FileStreamConfig) string {
+	if duck.icebergCatalogType() != "" {
+		snapshotExpr := ""
+		if fsc.SnapshotID != 0 {
+			snapshotExpr = g.F(" AT (VERSION => %d)", fsc.SnapshotID)
+		} else if fsc.SnapshotTimestamp != "" {
+			snapshotExpr = g.F(" AT (TIMESTAMP => TIMESTAMP '%s')", fsc.SnapshotTimestamp)
+		}
+		return g.R(
+			dbio.TypeDbDuckDb.GetTemplateValue("function.iceberg_catalog_scanner"),
+			"table", duck.icebergTableName(uri),
+			"snapshot_expr", snapshotExpr,
+		)
+	}
+
+	snapshotExpr := ""
+	if fsc.SnapshotID != 0 {
+		snapshotExpr = g.F(", snapshot_from_id = %d", fsc.SnapshotID)
+	} else if fsc.SnapshotTimestamp != "" {
+		snapshotExpr = g.F(", snapshot_from_timestamp = TIMESTAMP '%s'", fsc.SnapshotTimestamp)
+	}
+	return g.R(
+		dbio.TypeDbDuckDb.GetTemplateValue("function.iceberg_scanner"),
+		"snapshot_expr", snapshotExpr,
+	)
+}
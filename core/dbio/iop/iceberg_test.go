@@ -1,12 +1,14 @@
 package iop
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
 	"github.com/spf13/cast"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v2"
@@ -189,3 +191,41 @@ func testIcebergReader(t *testing.T, i *IcebergReader) {
 	})
 
 }
+
+func TestIcebergCatalog(t *testing.T) {
+	// direct metadata path, with time travel
+	duck := NewDuckDb(context.Background())
+	sql := duck.MakeScanQuery(dbio.FileTypeIceberg, "s3://bucket/lineitem_iceberg", FileStreamConfig{SnapshotID: 123})
+	assert.Equal(t, "select * from iceberg_scan('s3://bucket/lineitem_iceberg', allow_moved_paths = true, snapshot_from_id = 123)", sql)
+
+	// rest catalog
+	fsProps := g.Marshal(map[string]string{
+		"ICEBERG_CATALOG_TYPE":  "rest",
+		"ICEBERG_CATALOG_URI":   "https://catalog.example.com",
+		"ICEBERG_WAREHOUSE":     "wh",
+		"ICEBERG_CLIENT_ID":     "id",
+		"ICEBERG_CLIENT_SECRET": "secret",
+	})
+	duck = NewDuckDb(context.Background(), "fs_props="+fsProps)
+	sqls, err := duck.sessionSQL()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"create or replace secret iceberg_catalog_secret (TYPE ICEBERG, CLIENT_ID 'id', CLIENT_SECRET 'secret')",
+		"attach if not exists 'wh' as iceberg_catalog (TYPE ICEBERG, ENDPOINT 'https://catalog.example.com', SECRET iceberg_catalog_secret)",
+	}, sqls)
+	assert.Contains(t, duck.Extensions(), "iceberg")
+
+	sql = duck.MakeScanQuery(dbio.FileTypeIceberg, "s3://bucket/sales.orders", FileStreamConfig{SnapshotTimestamp: "2024-01-01 00:00:00"})
+	assert.Equal(t, `select * from iceberg_catalog."sales"."orders" AT (TIMESTAMP => TIMESTAMP '2024-01-01 00:00:00')`, sql)
+	assert.Equal(t, `iceberg_catalog."sales"."orders"`, duck.icebergTableName("/data/sales/orders"))
+
+	// glue catalog
+	duck = NewDuckDb(context.Background(), "iceberg_catalog_type=glue", "iceberg_warehouse=123456789012")
+	sqls, err = duck.sessionSQL()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"attach if not exists '123456789012' as iceberg_catalog (TYPE ICEBERG, ENDPOINT_TYPE GLUE)"}, sqls)
+
+	duck = NewDuckDb(context.Background(), "iceberg_catalog_type=hive")
+	_, err = duck.sessionSQL()
+	assert.Error(t, err)
+}
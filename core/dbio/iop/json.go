@@ -8,7 +8,6 @@ import (
 
 	"github.com/flarco/g"
 	"github.com/jmespath/go-jmespath"
-	"github.com/nqd/flat"
 	"github.com/samber/lo"
 	"github.com/spf13/cast"
 )
@@ -25,11 +24,135 @@ type jsonStream struct {
 	sp       *StreamProcessor
 	decoder  decoderLike
 	jmespath string
-	flatten  bool
+	flatten  FlattenOptions
 	buffer   chan []interface{}
 }
 
-func NewJSONStream(ds *Datastream, decoder decoderLike, flatten bool, jmespath string) *jsonStream {
+// FlattenArrayMode is how arrays are handled when flattening
+type FlattenArrayMode string
+
+const (
+	// FlattenArrayStringify keeps arrays as a JSON string value (default)
+	FlattenArrayStringify FlattenArrayMode = "stringify"
+	// FlattenArrayExplode creates one row per array element
+	FlattenArrayExplode FlattenArrayMode = "explode"
+)
+
+// FlattenOptions are the options for flattening nested records
+type FlattenOptions struct {
+	Enabled   bool             `json:"enabled"`
+	MaxDepth  int              `json:"max_depth"` // nested levels to flatten, 0 means no limit
+	Separator string           `json:"separator"` // defaults to "__"
+	Arrays    FlattenArrayMode `json:"arrays"`    // stringify or explode
+}
+
+// ParseFlattenOptions parses the flatten options from the properties
+// (flatten, flatten_depth, flatten_separator, flatten_arrays)
+func ParseFlattenOptions(props map[string]string, defaultEnabled bool) (fo FlattenOptions, err error) {
+	fo.Enabled = defaultEnabled
+	if val := props["flatten"]; val != "" {
+		fo.Enabled = cast.ToBool(val)
+	}
+
+	if val := props["flatten_depth"]; val != "" {
+		if fo.MaxDepth, err = cast.ToIntE(val); err != nil || fo.MaxDepth < 0 {
+			return fo, g.Error("invalid flatten_depth value: %s", val)
+		}
+	}
+
+	fo.Separator = props["flatten_separator"]
+	fo.Arrays = FlattenArrayMode(strings.ToLower(props["flatten_arrays"]))
+
+	return fo, fo.Validate()
+}
+
+// Validate checks the array mode
+func (fo FlattenOptions) Validate() error {
+	switch fo.Arrays {
+	case "", FlattenArrayStringify, FlattenArrayExplode:
+		return nil
+	}
+	return g.Error("invalid flatten_arrays value: %s (expected 'stringify' or 'explode')", fo.Arrays)
+}
+
+// Flatten flattens the nested maps of the record. When exploding arrays,
+// one record is returned per array element (for each array).
+func (fo FlattenOptions) Flatten(rec map[string]any) []map[string]any {
+	if fo.Separator == "" {
+		fo.Separator = "__"
+	}
+	return fo.flatten("", 0, rec)
+}
+
+func (fo FlattenOptions) flatten(prefix string, depth int, value any) (records []map[string]any) {
+	switch val := value.(type) {
+	case map[interface{}]interface{}:
+		newVal := map[string]any{}
+		for k, v := range val {
+			newVal[cast.ToString(k)] = v
+		}
+		return fo.flatten(prefix, depth, newVal)
+	case map[string]any:
+		if len(val) == 0 || (fo.MaxDepth > 0 && depth > fo.MaxDepth) {
+			return []map[string]any{{prefix: val}}
+		}
+
+		keys := lo.Keys(val)
+		sort.Strings(keys)
+
+		records = []map[string]any{{}}
+		for _, key := range keys {
+			newKey := key
+			if prefix != "" {
+				newKey = prefix + fo.Separator + key
+			}
+			records = crossRecords(records, fo.flatten(newKey, depth+1, val[key]))
+		}
+		return records
+	case []any:
+		if fo.Arrays != FlattenArrayExplode || prefix == "" {
+			return []map[string]any{{prefix: val}}
+		} else if len(val) == 0 {
+			return []map[string]any{{prefix: nil}}
+		}
+
+		// one record per element, nested maps keep the array key as prefix
+		for _, item := range val {
+			records = append(records, fo.flatten(prefix, depth, item)...)
+		}
+		return records
+	default:
+		return []map[string]any{{prefix: val}}
+	}
+}
+
+// crossRecords returns the cartesian product of the partial records
+func crossRecords(left, right []map[string]any) (records []map[string]any) {
+	if len(right) == 1 {
+		for _, rec := range left {
+			for k, v := range right[0] {
+				rec[k] = v
+			}
+		}
+		return left
+	}
+
+	for _, l := range left {
+		for _, r := range right {
+			rec := make(map[string]any, len(l)+len(r))
+			for k, v := range l {
+				rec[k] = v
+			}
+			for k, v := range r {
+				rec[k] = v
+			}
+			records = append(records, rec)
+		}
+	}
+	return records
+}
+
+func NewJSONStream(ds *Datastream, decoder decoderLike, flatten FlattenOptions, jmespath string) *jsonStream {
 	js := &jsonStream{
 		ColumnMap: map[string]*Column{},
 		ds:        ds,
@@ -39,7 +162,7 @@ func NewJSONStream(ds *Datastream, decoder decoderLike, flatten bool, jmespath s
 		buffer:    make(chan []interface{}, 100000),
 		sp:        NewStreamProcessor(),
 	}
-	if !flatten {
+	if !flatten.Enabled {
 		col := &Column{Position: 1, Name: "data", Type: JsonType, FileURI: cast.ToString(js.ds.Metadata.StreamURL.Value)}
 		js.ColumnMap[col.Name] = col
 		js.addColumn(*col)
@@ -183,50 +306,56 @@ func (js *jsonStream) addColumn(cols ...Column) {
 func (js *jsonStream) parseRecords(records []map[string]interface{}) {
 
 	for _, rec := range records {
-		if !js.flatten {
+		if !js.flatten.Enabled {
 			js.buffer <- []interface{}{g.Marshal(rec)}
 			continue
 		}
 
-		newRec, _ := flat.Flatten(rec, &flat.Options{Delimiter: "__", Safe: true})
-		keys := lo.Keys(newRec)
-		sort.Strings(keys)
-
-		row := make([]interface{}, len(js.ds.Columns))
-		colsToAdd := Columns{}
-		for _, colName := range keys {
-			// cast arrays as string
-			if arr, ok := newRec[colName].([]interface{}); ok {
-				newRec[colName] = g.Marshal(arr)
-			}
+		for _, newRec := range js.flatten.Flatten(rec) {
+			js.parseFlatRecord(newRec)
+		}
+	}
+	// g.Debug("JSON Stream -> Parsed %d records", len(records))
+}
 
-			col, ok := js.ColumnMap[colName]
-			if !ok {
-				col = &Column{
-					Name:     colName,
-					Type:     js.ds.Sp.GetType(newRec[colName]),
-					Position: len(js.ds.Columns) + len(colsToAdd) + 1,
-					FileURI:  cast.ToString(js.ds.Metadata.StreamURL.Value),
-				}
-				colsToAdd = append(colsToAdd, *col)
-				row = append(row, nil)
-				js.ColumnMap[col.Name] = col
-			}
-			i := col.Position - 1
-			row[i] = newRec[colName]
+func (js *jsonStream) parseFlatRecord(newRec map[string]any) {
+	keys := lo.Keys(newRec)
+	sort.Strings(keys)
+
+	row := make([]interface{}, len(js.ds.Columns))
+	colsToAdd := Columns{}
+	for _, colName := range keys {
+		// cast arrays and nested maps (past max depth) as string
+		switch newRec[colName].(type) {
+		case []interface{}, map[string]interface{}:
+			newRec[colName] = g.Marshal(newRec[colName])
 		}
 
-		if len(colsToAdd) > 0 {
-			js.addColumn(colsToAdd...)
+		col, ok := js.ColumnMap[colName]
+		if !ok {
+			col = &Column{
+				Name:     colName,
+				Type:     js.ds.Sp.GetType(newRec[colName]),
+				Position: len(js.ds.Columns) + len(colsToAdd) + 1,
+				FileURI:  cast.ToString(js.ds.Metadata.StreamURL.Value),
+			}
+			colsToAdd = append(colsToAdd, *col)
+			row = append(row, nil)
+			js.ColumnMap[col.Name] = col
 		}
+		i := col.Position - 1
+		row[i] = newRec[colName]
+	}
 
-		js.buffer <- row
+	if len(colsToAdd) > 0 {
+		js.addColumn(colsToAdd...)
 	}
-	// g.Debug("JSON Stream -> Parsed %d records", len(records))
+
+	js.buffer <- row
 }
 
 func (js *jsonStream) extractNestedArray(rec map[string]interface{}) (recordsInterf []map[string]interface{}) {
-	if !js.flatten {
+	if !js.flatten.Enabled {
 		return []map[string]interface{}{rec}
 	}
 
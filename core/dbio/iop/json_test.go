@@ -0,0 +1,69 @@
+package iop
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlattenOptions(t *testing.T) {
+	rec := map[string]any{
+		"id":   1,
+		"meta": map[string]any{"a": map[string]any{"b": 2}, "c": 3},
+		"tags": []any{"x", "y"},
+	}
+
+	// defaults: no depth limit, arrays as is (stringified later)
+	records := FlattenOptions{Enabled: true}.Flatten(rec)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, 2, records[0]["meta__a__b"])
+		assert.Equal(t, 3, records[0]["meta__c"])
+		assert.Equal(t, []any{"x", "y"}, records[0]["tags"])
+	}
+
+	// max depth and separator
+	records = FlattenOptions{Enabled: true, MaxDepth: 1, Separator: "."}.Flatten(rec)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, map[string]any{"b": 2}, records[0]["meta.a"])
+		assert.Equal(t, 3, records[0]["meta.c"])
+	}
+
+	// explode arrays
+	rec["items"] = []any{map[string]any{"sku": "s1"}, map[string]any{"sku": "s2"}}
+	records = FlattenOptions{Enabled: true, Arrays: FlattenArrayExplode}.Flatten(rec)
+	if assert.Len(t, records, 4) {
+		assert.Equal(t, "s1", records[0]["items__sku"])
+		assert.Equal(t, "x", records[0]["tags"])
+		assert.Equal(t, "s1", records[1]["items__sku"])
+		assert.Equal(t, "y", records[1]["tags"])
+		assert.Equal(t, "s2", records[3]["items__sku"])
+		assert.Equal(t, 1, records[3]["id"])
+	}
+
+	_, err := ParseFlattenOptions(map[string]string{"flatten_arrays": "wrong"}, true)
+	assert.Error(t, err)
+
+	fo, err := ParseFlattenOptions(map[string]string{"flatten_depth": "2", "flatten_arrays": "EXPLODE"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, FlattenOptions{Enabled: true, MaxDepth: 2, Arrays: FlattenArrayExplode}, fo)
+}
+
+func TestConsumeJsonReaderFlatten(t *testing.T) {
+	payload := `[{"id": 1, "user": {"name": "a", "address": {"city": "x"}}, "roles": ["r1", "r2"]}]`
+
+	ds := NewDatastream(nil)
+	ds.SetConfig(map[string]string{"flatten": "true", "flatten_depth": "1", "flatten_separator": "_", "flatten_arrays": "explode"})
+	err := ds.ConsumeJsonReader(strings.NewReader(payload))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	data, err := ds.Collect(0)
+	assert.NoError(t, err)
+	assert.Len(t, data.Rows, 2)
+	assert.ElementsMatch(t, []string{"id", "roles", "user_address", "user_name"}, data.Columns.Names())
+	if col := data.Columns.GetColumn("user_address"); assert.NotNil(t, col) {
+		assert.Equal(t, `{"city":"x"}`, data.Rows[0][col.Position-1])
+	}
+}
@@ -14,7 +14,6 @@ import (
 	arrowParquet "github.com/apache/arrow/go/v16/parquet"
 	"github.com/flarco/g"
 	"github.com/google/uuid"
-	"github.com/samber/lo"
 	"github.com/spf13/cast"
 
 	parquet "github.com/parquet-go/parquet-go"
@@ -116,17 +115,11 @@ func NewParquetWriter(w io.Writer, columns Columns, codec compress.Codec) (p *Pa
 	// make scale big.Rat numbers
 	decNumScale := make([]*big.Rat, len(columns))
 	for i, col := range columns {
-		if !col.Sourced || col.DbPrecision == 0 {
-			col.DbPrecision = lo.Ternary(col.DbPrecision == 0, 28, lo.Ternary(col.DbPrecision > 36, 36, col.DbPrecision))
-			col.DbScale = lo.Ternary(col.DbScale == 0, 9, lo.Ternary(col.DbScale > 16, 16, col.DbScale))
-		}
-		columns[i] = col
-
-		if col.DbScale > 0 {
-			decNumScale[i] = MakeDecNumScale(col.DbScale)
-		} else {
-			decNumScale[i] = MakeDecNumScale(1)
+		if col.Type == DecimalType {
+			col.DbPrecision, col.DbScale = col.DecimalPrecisionScale()
+			columns[i] = col
 		}
+		decNumScale[i] = MakeDecNumScale(col.DbScale)
 	}
 
 	config, err := parquet.NewWriterConfig()
@@ -153,17 +146,11 @@ func NewParquetWriterMap(w io.Writer, columns Columns, codec compress.Codec) (p
 	// make scale big.Rat numbers
 	decNumScale := make([]*big.Rat, len(columns))
 	for i, col := range columns {
-		if !col.Sourced || col.DbPrecision == 0 {
-			col.DbPrecision = lo.Ternary(col.DbPrecision == 0, 28, lo.Ternary(col.DbPrecision > 36, 36, col.DbPrecision))
-			col.DbScale = lo.Ternary(col.DbScale == 0, 9, lo.Ternary(col.DbScale > 16, 16, col.DbScale))
-		}
-		columns[i] = col
-
-		if col.DbScale > 0 {
-			decNumScale[i] = MakeDecNumScale(col.DbScale)
-		} else {
-			decNumScale[i] = MakeDecNumScale(1)
+		if col.Type == DecimalType {
+			col.DbPrecision, col.DbScale = col.DecimalPrecisionScale()
+			columns[i] = col
 		}
+		decNumScale[i] = MakeDecNumScale(col.DbScale)
 	}
 
 	config, err := parquet.NewWriterConfig()
@@ -193,9 +180,11 @@ func (pw *ParquetWriter) WriteRow(row []any) error {
 			row[i] = cast.ToBool(row[i]) // since is stored as string
 		case col.Type == FloatType:
 			row[i] = cast.ToFloat64(row[i])
+		case col.IsBinary() && row[i] != nil:
+			row[i] = []byte(cast.ToString(row[i]))
 		case col.Type == DecimalType:
 			// row[i] = cast.ToString(row[i])
-			row[i] = StringToDecimalByteArray(cast.ToString(row[i]), pw.decNumScale[i], arrowParquet.Types.FixedLenByteArray, 16)
+			row[i] = StringToDecimalByteArray(cast.ToString(row[i]), pw.decNumScale[i], arrowParquet.Types.FixedLenByteArray, DecimalByteLength(col.DbPrecision))
 		case col.IsDatetime() || col.IsDate():
 			switch valT := row[i].(type) {
 			case time.Time:
@@ -239,8 +228,10 @@ func (pw *ParquetWriter) WriteRec(row []any) error {
 			rec[col.Name] = cast.ToBool(row[i]) // since is stored as string
 		case col.Type == FloatType:
 			rec[col.Name] = cast.ToFloat64(row[i])
+		case col.IsBinary() && row[i] != nil:
+			rec[col.Name] = []byte(cast.ToString(row[i]))
 		case col.Type == DecimalType:
-			rec[col.Name] = StringToDecimalByteArray(cast.ToString(row[i]), pw.decNumScale[i], arrowParquet.Types.FixedLenByteArray, 16)
+			rec[col.Name] = StringToDecimalByteArray(cast.ToString(row[i]), pw.decNumScale[i], arrowParquet.Types.FixedLenByteArray, DecimalByteLength(col.DbPrecision))
 		case col.IsDatetime() || col.IsDate():
 			switch valT := row[i].(type) {
 			case time.Time:
@@ -494,7 +485,7 @@ func nodeOf(col Column, optional bool) parquet.Node {
 		n = parquet.Leaf(parquet.DoubleType)
 		return newNode(&goNode{Node: n, gotype: col.GoType()}, optional)
 	case DecimalType:
-		n = parquet.Decimal(col.DbScale, col.DbPrecision, parquet.FixedLenByteArrayType(16))
+		n = parquet.Decimal(col.DbScale, col.DbPrecision, parquet.FixedLenByteArrayType(DecimalByteLength(col.DbPrecision)))
 		return newNode(&goNode{Node: n, gotype: col.GoType()}, optional)
 	}
 
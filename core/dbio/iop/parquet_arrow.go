@@ -596,16 +596,11 @@ func (p *ParquetArrowWriter) makeSchema() (s *schema.Schema, err error) {
 			node, err = schema.NewPrimitiveNode(col.Name, rep, pType, -1, -1)
 		case col.Type == DecimalType:
 			rep = parquet.Repetitions.Required
-			col.DbPrecision = lo.Ternary(col.DbPrecision == 0, 28, col.DbPrecision)
-			col.DbScale = lo.Ternary(col.DbScale == 0, 9, col.DbScale)
+			col.DbPrecision, col.DbScale = col.DecimalPrecisionScale()
 			p.columns[i] = col
 			lType := schema.NewDecimalLogicalType(int32(col.DbPrecision), int32(col.DbScale))
-			node, err = schema.NewPrimitiveNodeLogical(col.Name, rep, lType, pType, 16, fieldID)
-			if col.DbScale > 0 {
-				p.decNumScale[i] = MakeDecNumScale(col.DbScale)
-			} else {
-				p.decNumScale[i] = MakeDecNumScale(1)
-			}
+			node, err = schema.NewPrimitiveNodeLogical(col.Name, rep, lType, pType, DecimalByteLength(col.DbPrecision), fieldID)
+			p.decNumScale[i] = MakeDecNumScale(col.DbScale)
 		case col.IsInteger():
 			node, err = schema.NewPrimitiveNode(col.Name, rep, pType, -1, -1)
 		case col.IsDatetime() || col.IsDate():
@@ -613,6 +608,8 @@ func (p *ParquetArrowWriter) makeSchema() (s *schema.Schema, err error) {
 			node, err = schema.NewPrimitiveNodeLogical(col.Name, rep, lType, pType, -1, fieldID)
 		case col.IsBool():
 			node = schema.NewBooleanNode(col.Name, rep, fieldID)
+		case col.IsBinary():
+			node, err = schema.NewPrimitiveNode(col.Name, rep, pType, fieldID, -1) // native bytes, not utf8
 		// case col.Type == JsonType:
 		// 	node, err = schema.NewPrimitiveNodeConverted(col.Name, rep, pType, schema.ConvertedTypes.JSON, -1, 0, 0, fieldID)
 		default:
@@ -663,6 +660,124 @@ func (p *ParquetArrowWriter) WriteRow(row []any) (err error) {
 	return
 }
 
+// WriteColumnBatch writes the typed column vectors of a batch, without
+// boxing each value in a row
+func (p *ParquetArrowWriter) WriteColumnBatch(cb *ColumnBatch) (err error) {
+	// rows buffered with WriteRow come first
+	if err = p.writeBuffer(); err != nil {
+		return g.Error(err, "could not write writeBuffer")
+	}
+
+	for i, col := range p.Columns() {
+		if i >= len(cb.Vectors) {
+			break
+		}
+		err = p.writeColumnVector(&col, p.decNumScale[i], p.colWriters[i], cb.Vectors[i])
+		if err != nil {
+			return g.Error(err, "could not write column %s", col.Name)
+		}
+	}
+
+	// size at 128MB per row group
+	if p.rowGroup.TotalBytesWritten() >= 128*1000*1000 {
+		err = p.AppendNewRowGroup()
+		if err != nil {
+			return g.Error(err, "could not append new rowGroup")
+		}
+	}
+	return nil
+}
+
+func (p *ParquetArrowWriter) writeColumnVector(col *Column, decNumScale *big.Rat, writer file.ColumnChunkWriter, v *ColumnVector) (err error) {
+	n := v.Len()
+	if n == 0 {
+		return
+	}
+
+	// the values are cast as with writeColumnValues
+	switch w := writer.(type) {
+	case *file.Int32ColumnChunkWriter:
+		values := make([]int32, n)
+		for i := range values {
+			values[i] = cast.ToInt32(v.Value(i))
+		}
+		_, err = w.WriteBatch(values, nil, nil)
+	case *file.Int64ColumnChunkWriter:
+		values := make([]int64, n)
+		switch v.Kind {
+		case VectorInt:
+			copy(values, v.Ints)
+		case VectorTime:
+			for i, t := range v.Times {
+				values[i] = t.UnixNano()
+			}
+		default:
+			for i := range values {
+				values[i] = cast.ToInt64(v.Value(i))
+			}
+		}
+		_, err = w.WriteBatch(values, nil, nil)
+	case *file.Float32ColumnChunkWriter:
+		values := make([]float32, n)
+		for i := range values {
+			values[i] = cast.ToFloat32(v.Value(i))
+		}
+		_, err = w.WriteBatch(values, nil, nil)
+	case *file.Float64ColumnChunkWriter:
+		if v.Kind == VectorFloat {
+			_, err = w.WriteBatch(v.Floats, nil, nil)
+			break
+		}
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = cast.ToFloat64(v.Value(i))
+		}
+		_, err = w.WriteBatch(values, nil, nil)
+	case *file.BooleanColumnChunkWriter:
+		if v.Kind == VectorBool {
+			_, err = w.WriteBatch(v.Bools, nil, nil)
+			break
+		}
+		values := make([]bool, n)
+		for i := range values {
+			values[i] = cast.ToBool(v.Value(i))
+		}
+		_, err = w.WriteBatch(values, nil, nil)
+	case *file.ByteArrayColumnChunkWriter:
+		values := make([]parquet.ByteArray, n)
+		for i := range values {
+			if !v.Valid[i] {
+				continue // still does not write null
+			}
+			valS := cast.ToString(v.Value(i))
+			if col.Type == DecimalType {
+				values[i] = StringToDecimalByteArray(valS, decNumScale, parquet.Types.ByteArray, DecimalByteLength(col.DbPrecision))
+			} else {
+				values[i] = []byte(valS)
+			}
+		}
+		_, err = w.WriteBatch(values, nil, nil)
+	case *file.FixedLenByteArrayColumnChunkWriter:
+		values := make([]parquet.FixedLenByteArray, n)
+		for i := range values {
+			if !v.Valid[i] {
+				continue // still does not write null
+			}
+			valS := cast.ToString(v.Value(i))
+			if col.Type == DecimalType {
+				values[i] = StringToDecimalByteArray(valS, decNumScale, parquet.Types.FixedLenByteArray, DecimalByteLength(col.DbPrecision))
+			} else {
+				values[i] = []byte(valS)
+			}
+		}
+		_, err = w.WriteBatch(values, nil, nil)
+	default:
+		err = g.Error("unimplemented ColumnChunkWriter: %#v", w)
+	}
+
+	return
+}
+
 func (p *ParquetArrowWriter) writeColumnValues(col *Column, writer file.ColumnChunkWriter, colValuesBatch []any) (err error) {
 	if len(colValuesBatch) == 0 {
 		return
@@ -725,7 +840,7 @@ func (p *ParquetArrowWriter) writeColumnValues(col *Column, writer file.ColumnCh
 			}
 			valS := cast.ToString(val)
 			if col.Type == DecimalType {
-				values[i] = StringToDecimalByteArray(valS, p.decNumScale[col.Position-1], parquet.Types.ByteArray, 16)
+				values[i] = StringToDecimalByteArray(valS, p.decNumScale[col.Position-1], parquet.Types.ByteArray, DecimalByteLength(col.DbPrecision))
 			} else {
 				values[i] = []byte(cast.ToString(val))
 			}
@@ -741,7 +856,7 @@ func (p *ParquetArrowWriter) writeColumnValues(col *Column, writer file.ColumnCh
 			}
 			valS := cast.ToString(val)
 			if col.Type == DecimalType {
-				values[i] = StringToDecimalByteArray(valS, p.decNumScale[col.Position-1], parquet.Types.FixedLenByteArray, 16)
+				values[i] = StringToDecimalByteArray(valS, p.decNumScale[col.Position-1], parquet.Types.FixedLenByteArray, DecimalByteLength(col.DbPrecision))
 			} else {
 				values[i] = []byte(cast.ToString(val))
 			}
@@ -812,11 +927,11 @@ func StringToDecimalByteArray(s string, numSca *big.Rat, pType parquet.Type, len
 		return []byte(cast.ToString(int64(tmp)))
 
 	} else if pType == parquet.Types.FixedLenByteArray {
-		s = num.String()
+		s = num.FloatString(0) // rounded to the scale
 		res := StrIntToBinary(s, "BigEndian", length, strings.HasPrefix(s, "-"))
 		return []byte(res)
 	} else {
-		s = num.String()
+		s = num.FloatString(0) // rounded to the scale
 		res := StrIntToBinary(s, "BigEndian", length, strings.HasPrefix(s, "-"))
 		return []byte(res)
 	}
@@ -887,6 +1002,15 @@ func StrIntToBinary(num string, order string, length int, signed bool) string {
 	return string(bs)
 }
 
+// DecimalByteLength returns the length of the fixed bytes of a decimal:
+// 16 bytes up to a precision of 38, the required size beyond
+func DecimalByteLength(precision int) int {
+	if precision <= 38 {
+		return 16
+	}
+	return decimalFixedLenByteArraySize(precision)
+}
+
 func decimalFixedLenByteArraySize(precision int) int {
 	return int(math.Ceil((math.Log10(2) + float64(precision)) / math.Log10(256)))
 }
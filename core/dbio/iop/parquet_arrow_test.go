@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path"
 	"reflect"
 	"testing"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"github.com/apache/arrow/go/v16/parquet/file"
 	"github.com/apache/arrow/go/v16/parquet/schema"
 	"github.com/flarco/g"
+	"github.com/spf13/cast"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -361,3 +363,71 @@ func (dump *Dumper) Next() (interface{}, bool) {
 
 	return v, true
 }
+
+func TestDecimalPrecision(t *testing.T) {
+	// values with more decimals than the scale are rounded
+	decValBytes := StringToDecimalByteArray("1.23456", MakeDecNumScale(2), parquet.Types.FixedLenByteArray, 16)
+	assert.Equal(t, "1.23", DecimalByteArrayToString(decValBytes, 10, 2))
+	decValBytes = StringToDecimalByteArray("-0.005", MakeDecNumScale(2), parquet.Types.FixedLenByteArray, 16)
+	assert.Equal(t, "-0.01", DecimalByteArrayToString(decValBytes, 10, 2))
+
+	assert.Equal(t, 16, DecimalByteLength(38))
+	assert.Equal(t, 21, DecimalByteLength(50))
+
+	precision, scale := (&Column{Type: DecimalType, Sourced: true, DbPrecision: 50, DbScale: 20}).DecimalPrecisionScale()
+	assert.Equal(t, []int{50, 20}, []int{precision, scale})
+	precision, scale = (&Column{Type: DecimalType, Sourced: true, DbPrecision: 10}).DecimalPrecisionScale()
+	assert.Equal(t, []int{10, 0}, []int{precision, scale})
+	precision, scale = (&Column{Type: DecimalType}).DecimalPrecisionScale()
+	assert.Equal(t, []int{28, 9}, []int{precision, scale})
+
+	// round-trip of extreme precisions through parquet
+	columns := NewColumns(Columns{
+		{Name: "dec_10_0", Type: DecimalType, Sourced: true, DbPrecision: 10},
+		{Name: "dec_38_10", Type: DecimalType, Sourced: true, DbPrecision: 38, DbScale: 10},
+		{Name: "dec_50_20", Type: DecimalType, Sourced: true, DbPrecision: 50, DbScale: 20},
+	}...)
+	rows := [][]any{
+		{"1234567890", "1234567890123456789012345678.0123456789", "123456789012345678901234567890.12345678901234567890"},
+		{"-5", "-0.0000000001", "-0.00000000000000000001"},
+	}
+
+	filePath := path.Join(t.TempDir(), "decimals.parquet")
+	f, err := os.Create(filePath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	pw, err := NewParquetArrowWriter(f, columns, compress.Codecs.Snappy)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, row := range rows {
+		assert.NoError(t, pw.WriteRow(row))
+	}
+	assert.NoError(t, pw.Close()) // closes the file as well
+
+	f, err = os.Open(filePath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+
+	ds := NewDatastream(Columns{})
+	if !assert.NoError(t, ds.ConsumeParquetReaderSeeker(f)) {
+		return
+	}
+	data, err := ds.Collect(0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []int{10, 38, 50}, []int{data.Columns[0].DbPrecision, data.Columns[1].DbPrecision, data.Columns[2].DbPrecision})
+	assert.Equal(t, []int{0, 10, 20}, []int{data.Columns[0].DbScale, data.Columns[1].DbScale, data.Columns[2].DbScale})
+	if assert.Len(t, data.Rows, 2) {
+		for i, row := range rows {
+			for j, val := range row {
+				assert.Equal(t, val, cast.ToString(data.Rows[i][j]))
+			}
+		}
+	}
+}
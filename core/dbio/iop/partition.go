@@ -1,6 +1,7 @@
 package iop
 
 import (
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
@@ -85,6 +86,46 @@ func (level PartitionLevel) TruncateTime(t time.Time) (time.Time, error) {
 	}
 }
 
+// Format returns the partition value of the timestamp, with the
+// same formats as the duckdb partitioned writes
+func (level PartitionLevel) Format(t time.Time) string {
+	switch level {
+	case PartitionLevelYear:
+		return t.Format("2006")
+	case PartitionLevelYearMonth:
+		return t.Format("2006-01")
+	case PartitionLevelMonth:
+		return t.Format("01")
+	case PartitionLevelWeek:
+		_, week := t.ISOWeek()
+		return fmt.Sprintf("%02d", week)
+	case PartitionLevelDay:
+		return t.Format("02")
+	case PartitionLevelHour:
+		return t.Format("15")
+	case PartitionLevelMinute:
+		return t.Format("04")
+	case PartitionLevelSecond:
+		return t.Format("05")
+	}
+	return ""
+}
+
+// FormatPartitionPath replaces the partition fields of the path with
+// Hive-style segments of the key value, such as `{part_year}` with
+// `created_at_year=2024`. A nil value is formatted as `NULL`.
+func FormatPartitionPath(path, key string, value *time.Time) string {
+	for _, level := range ExtractPartitionFields(path) {
+		partValue := "NULL"
+		if value != nil {
+			partValue = level.Format(*value)
+		}
+		segment := g.F("%s_%s=%s", key, level, partValue)
+		path = strings.ReplaceAll(path, g.F("{part_%s}", level), segment)
+	}
+	return path
+}
+
 // ExtractPartitionFields extract the partition fields from the given path
 func ExtractPartitionFields(path string) (levels []PartitionLevel) {
 	// Regex pattern to match {part_*} fields
@@ -99,6 +140,9 @@ func ExtractPartitionFields(path string) (levels []PartitionLevel) {
 		if len(match) > 1 {
 			expression := strings.ReplaceAll(strings.ReplaceAll(match[1], "{", ""), "}", "")
 			expression = strings.TrimPrefix(strings.TrimSpace(expression), "part_")
+			if g.In(expression, "number", "folder") {
+				continue // output layout placeholders, not partitions
+			}
 			partLevel := PartitionLevel(expression)
 			// ensure if matches
 			matched := false
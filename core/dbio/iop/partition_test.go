@@ -137,6 +137,11 @@ func TestPartitionExtractFields(t *testing.T) {
 			path: "/data/static/file.csv",
 			want: []PartitionLevel{},
 		},
+		{
+			name: "output layout placeholders",
+			path: "/data/{part_year}/{part_folder}/part-{part_number}.csv",
+			want: []PartitionLevel{PartitionLevelYear},
+		},
 		{
 			name: "all partition levels",
 			path: "/data/{part_year}/{part_year_month}/{part_month}/{part_week}/{part_day}/{part_hour}/{part_minute}/file.csv",
@@ -594,3 +599,15 @@ func TestGeneratePartURIsFromRange(t *testing.T) {
 		})
 	}
 }
+
+func TestPartitionFormatPath(t *testing.T) {
+	ts := time.Date(2024, 3, 5, 7, 9, 11, 0, time.UTC)
+	path := "s3://bucket/data/{part_year}/{part_month}/{part_day}/file.csv"
+	assert.Equal(t, "s3://bucket/data/ts_year=2024/ts_month=03/ts_day=05/file.csv", FormatPartitionPath(path, "ts", &ts))
+	assert.Equal(t, "s3://bucket/data/ts_year=NULL/ts_month=NULL/ts_day=NULL/file.csv", FormatPartitionPath(path, "ts", nil))
+
+	assert.Equal(t, "2024-03", PartitionLevelYearMonth.Format(ts))
+	assert.Equal(t, "10", PartitionLevelWeek.Format(ts))
+	assert.Equal(t, "07", PartitionLevelHour.Format(ts))
+	assert.Equal(t, "09", PartitionLevelMinute.Format(ts))
+}
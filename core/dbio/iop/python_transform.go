@@ -0,0 +1,453 @@
+package iop
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/apache/arrow/go/v16/arrow/array"
+	"github.com/apache/arrow/go/v16/arrow/ipc"
+	"github.com/apache/arrow/go/v16/arrow/memory"
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+// PythonTransformOptions are the options of a python transform script
+type PythonTransformOptions struct {
+	Script    string // path of the script, defining `transform(batch)`
+	Python    string // python executable, SLING_PYTHON or python3 by default
+	BatchSize int    // number of rows per batch, 10000 by default
+	Format    string // type of the batch passed: pandas (DataFrame, default) or arrow (RecordBatch)
+}
+
+// pythonTransformRunner loads the script and transforms the batches read
+// from stdin, writing the output batches to stdout (Arrow IPC streams).
+// The output schema is the one of the first output batch, the next ones
+// are cast to it. A batch is dropped if the transform returns None.
+const pythonTransformRunner = `
+import importlib.util, sys
+import pyarrow as pa
+
+sink = sys.stdout.buffer
+sys.stdout = sys.stderr  # print() in the script is logged
+
+spec = importlib.util.spec_from_file_location("sling_transform", sys.argv[1])
+module = importlib.util.module_from_spec(spec)
+spec.loader.exec_module(module)
+transform = getattr(module, "transform", None)
+if transform is None:
+    sys.exit("the script does not define a transform(batch) function")
+use_pandas = sys.argv[2] == "pandas"
+
+def to_table(out):
+    if out is None:
+        return None
+    if isinstance(out, pa.RecordBatch):
+        return pa.Table.from_batches([out])
+    if isinstance(out, pa.Table):
+        return out
+    return pa.Table.from_pandas(out, preserve_index=False)
+
+source = pa.ipc.open_stream(sys.stdin.buffer)
+writer, schema = None, None
+for batch in source:
+    table = to_table(transform(batch.to_pandas() if use_pandas else batch))
+    if table is None:
+        continue
+    if writer is None:
+        schema = table.schema.remove_metadata()
+        writer = pa.ipc.new_stream(sink, schema)
+    table = table.replace_schema_metadata(None)
+    if table.schema != schema:
+        table = table.cast(schema)
+    writer.write_table(table)
+    sink.flush()
+
+if writer is None:
+    writer = pa.ipc.new_stream(sink, source.schema)
+writer.close()
+`
+
+// PythonTransformDataflow returns a new dataflow with the rows transformed
+// by the python script, run in a subprocess. The batches of rows are sent
+// and received as Arrow IPC streams. The streams are merged first.
+func PythonTransformDataflow(df *Dataflow, opts PythonTransformOptions) (dfN *Dataflow, err error) {
+	if !g.PathExists(opts.Script) {
+		return df, g.Error("python transform script not found: %s", opts.Script)
+	}
+	if opts.Python == "" {
+		opts.Python = lo.Ternary(os.Getenv("SLING_PYTHON") != "", os.Getenv("SLING_PYTHON"), "python3")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 10000
+	}
+	if opts.Format == "" {
+		opts.Format = "pandas"
+	} else if !g.In(opts.Format, "pandas", "arrow") {
+		return df, g.Error("invalid python transform format: %s (expected 'pandas' or 'arrow')", opts.Format)
+	}
+
+	config := df.StreamConfig()
+	dsM := MergeDataflow(df)
+	rows := dsM.Rows()
+	columns := dsM.Columns
+	schema := arrowSchema(columns)
+
+	ctx, cancel := context.WithCancel(df.Context.Ctx)
+	stderr := &tailWriter{prefix: "[python] "}
+	cmd := exec.CommandContext(ctx, opts.Python, "-c", pythonTransformRunner, opts.Script, opts.Format)
+	cmd.Stderr = stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return df, g.Error(err, "could not get stdin pipe")
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return df, g.Error(err, "could not get stdout pipe")
+	}
+
+	g.Debug("transforming rows with python script %s (batches of %d rows)", opts.Script, opts.BatchSize)
+	if err = cmd.Start(); err != nil {
+		cancel()
+		return df, g.Error(err, "could not start %s", opts.Python)
+	}
+
+	// send the batches
+	writeDone := make(chan error, 1)
+	go func() {
+		var writeErr error
+		defer func() { writeDone <- writeErr }()
+		defer stdin.Close()
+
+		writer := ipc.NewWriter(stdin, ipc.WithSchema(schema))
+		builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+		defer builder.Release()
+
+		count := 0
+		flush := func() error {
+			rec := builder.NewRecord()
+			defer rec.Release()
+			count = 0
+			return writer.Write(rec)
+		}
+
+		for row := range rows {
+			if writeErr != nil {
+				continue // drain
+			}
+			appendArrowRow(builder, columns, row)
+			if count++; count >= opts.BatchSize {
+				writeErr = flush()
+			}
+		}
+		if writeErr == nil && count > 0 {
+			writeErr = flush()
+		}
+		if err := writer.Close(); writeErr == nil {
+			writeErr = err
+		}
+	}()
+
+	// wait reaps the process, with the logged errors
+	wait := func() error {
+		defer cancel()
+		if err := cmd.Wait(); err != nil {
+			return g.Error(err, "python transform failed: %s", stderr.Tail())
+		} else if writeErr := <-writeDone; writeErr != nil {
+			return g.Error(writeErr, "could not send rows to python transform")
+		}
+		return nil
+	}
+
+	// the output schema is read with the first batch
+	reader, err := ipc.NewReader(stdout)
+	if err != nil {
+		df.Context.Cancel() // stops reading the source
+		cmd.Wait()
+		cancel()
+		return df, g.Error(err, "could not read python transform output: %s", stderr.Tail())
+	}
+
+	var (
+		rec    arrow.Record
+		recRow int
+	)
+	nextFunc := func(it *Iterator) bool {
+		for {
+			if rec != nil && recRow < int(rec.NumRows()) {
+				it.Row = arrowRow(rec, recRow)
+				recRow++
+				return true
+			}
+
+			if !reader.Next() {
+				if err := reader.Err(); err != nil && err != io.EOF {
+					it.Context.CaptureErr(g.Error(err, "could not read python transform output"))
+				}
+				return false
+			}
+			rec, recRow = reader.Record(), 0
+		}
+	}
+
+	dsN := NewDatastreamIt(df.Context.Ctx, arrowColumns(reader.Schema()), nextFunc)
+	dsN.Inferred = true
+	dsN.Sp.Config = config
+	dsN.config = config
+	dsN.Defer(func() {
+		reader.Release()
+		if err := wait(); err != nil {
+			dsN.Context.CaptureErr(err)
+		}
+		if err := dsM.Err(); err != nil {
+			dsN.Context.CaptureErr(err)
+		}
+	})
+
+	if err = dsN.Start(); err != nil {
+		return df, g.Error(err, "could not start python transform stream")
+	}
+
+	dfN, err = MakeDataFlow(dsN)
+	if err != nil {
+		return df, g.Error(err, "could not make python transform dataflow")
+	}
+
+	return dfN, nil
+}
+
+// arrowSchema returns the arrow schema of the columns. Decimals are sent
+// as strings, to keep their precision, and the sling type of each column is
+// kept in the field metadata.
+func arrowSchema(columns Columns) *arrow.Schema {
+	fields := make([]arrow.Field, len(columns))
+	for i, col := range columns {
+		var dt arrow.DataType
+		switch {
+		case col.Type.IsInteger():
+			dt = arrow.PrimitiveTypes.Int64
+		case col.Type.IsFloat():
+			dt = arrow.PrimitiveTypes.Float64
+		case col.Type.IsBool():
+			dt = arrow.FixedWidthTypes.Boolean
+		case col.Type.IsDate():
+			dt = arrow.FixedWidthTypes.Date32
+		case col.Type == TimestampzType:
+			dt = &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+		case col.Type.IsDatetime():
+			dt = &arrow.TimestampType{Unit: arrow.Microsecond}
+		case col.Type.IsBinary():
+			dt = arrow.BinaryTypes.Binary
+		default:
+			dt = arrow.BinaryTypes.String
+		}
+		metadata := arrow.NewMetadata([]string{arrowSlingTypeKey}, []string{string(col.Type)})
+		fields[i] = arrow.Field{Name: col.Name, Type: dt, Nullable: true, Metadata: metadata}
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+// appendArrowRow appends the row values to the builder. Values which
+// cannot be cast are appended as nulls.
+func appendArrowRow(builder *array.RecordBuilder, columns Columns, row []any) {
+	for i, fb := range builder.Fields() {
+		var val any
+		if i < len(row) {
+			val = row[i]
+		}
+		if val == nil {
+			fb.AppendNull()
+			continue
+		}
+
+		var err error
+		switch b := fb.(type) {
+		case *array.Int64Builder:
+			var v int64
+			if v, err = cast.ToInt64E(val); err == nil {
+				b.Append(v)
+			}
+		case *array.Float64Builder:
+			var v float64
+			if v, err = cast.ToFloat64E(val); err == nil {
+				b.Append(v)
+			}
+		case *array.BooleanBuilder:
+			var v bool
+			if v, err = cast.ToBoolE(val); err == nil {
+				b.Append(v)
+			}
+		case *array.Date32Builder:
+			var t time.Time
+			if t, err = cast.ToTimeE(val); err == nil {
+				b.Append(arrow.Date32FromTime(t))
+			}
+		case *array.TimestampBuilder:
+			var t time.Time
+			if t, err = cast.ToTimeE(val); err == nil {
+				b.Append(arrow.Timestamp(t.UnixMicro()))
+			}
+		case *array.BinaryBuilder:
+			b.Append([]byte(cast.ToString(val)))
+		case *array.StringBuilder:
+			b.Append(cast.ToString(val))
+		default:
+			err = g.Error("unsupported arrow builder for %s", columns[i].Name)
+		}
+
+		if err != nil {
+			fb.AppendNull()
+		}
+	}
+}
+
+// arrowSlingTypeKey is the field metadata key of the sling column type
+const arrowSlingTypeKey = "sling_type"
+
+// arrowColumns returns the columns of the arrow schema. String fields keep
+// the sling type of the field metadata (such as decimal or json).
+func arrowColumns(schema *arrow.Schema) (columns Columns) {
+	for i, field := range schema.Fields() {
+		col := Column{Name: field.Name, Position: i + 1, Type: StringType}
+		switch dt := field.Type.(type) {
+		case *arrow.Int8Type, *arrow.Int16Type, *arrow.Int32Type, *arrow.Int64Type,
+			*arrow.Uint8Type, *arrow.Uint16Type, *arrow.Uint32Type, *arrow.Uint64Type:
+			col.Type = BigIntType
+		case *arrow.Float16Type, *arrow.Float32Type, *arrow.Float64Type:
+			col.Type = FloatType
+		case *arrow.Decimal128Type:
+			col.Type = DecimalType
+			col.DbPrecision, col.DbScale = int(dt.Precision), int(dt.Scale)
+		case *arrow.BooleanType:
+			col.Type = BoolType
+		case *arrow.Date32Type, *arrow.Date64Type:
+			col.Type = DateType
+		case *arrow.TimestampType:
+			col.Type = lo.Ternary(dt.TimeZone != "", TimestampzType, TimestampType)
+		case *arrow.BinaryType, *arrow.LargeBinaryType:
+			col.Type = BinaryType
+		case *arrow.ListType, *arrow.LargeListType, *arrow.StructType, *arrow.MapType:
+			col.Type = JsonType
+		case *arrow.StringType, *arrow.LargeStringType:
+			if i := field.Metadata.FindKey(arrowSlingTypeKey); i >= 0 {
+				if colType := ColumnType(field.Metadata.Values()[i]); colType.IsString() || colType.IsJSON() || colType.IsDecimal() {
+					col.Type = colType
+				}
+			}
+		}
+		columns = append(columns, col)
+	}
+	return columns
+}
+
+// arrowRow returns the values of the row of the record
+func arrowRow(rec arrow.Record, i int) []any {
+	row := make([]any, rec.NumCols())
+	for j, col := range rec.Columns() {
+		if col.IsNull(i) {
+			continue
+		}
+
+		switch a := col.(type) {
+		case *array.Int8:
+			row[j] = int64(a.Value(i))
+		case *array.Int16:
+			row[j] = int64(a.Value(i))
+		case *array.Int32:
+			row[j] = int64(a.Value(i))
+		case *array.Int64:
+			row[j] = a.Value(i)
+		case *array.Uint8:
+			row[j] = int64(a.Value(i))
+		case *array.Uint16:
+			row[j] = int64(a.Value(i))
+		case *array.Uint32:
+			row[j] = int64(a.Value(i))
+		case *array.Uint64:
+			row[j] = int64(a.Value(i))
+		case *array.Float32:
+			row[j] = float64(a.Value(i))
+		case *array.Float64:
+			row[j] = a.Value(i)
+		case *array.Decimal128:
+			row[j] = a.Value(i).ToString(a.DataType().(*arrow.Decimal128Type).Scale)
+		case *array.Boolean:
+			row[j] = a.Value(i)
+		case *array.String:
+			row[j] = a.Value(i)
+		case *array.LargeString:
+			row[j] = a.Value(i)
+		case *array.Binary:
+			row[j] = string(a.Value(i))
+		case *array.LargeBinary:
+			row[j] = string(a.Value(i))
+		case *array.Date32:
+			row[j] = a.Value(i).ToTime()
+		case *array.Date64:
+			row[j] = a.Value(i).ToTime()
+		case *array.Timestamp:
+			unit := a.DataType().(*arrow.TimestampType).Unit
+			row[j] = a.Value(i).ToTime(unit)
+		default:
+			row[j] = col.ValueStr(i)
+		}
+	}
+	return row
+}
+
+// tailWriter logs the lines written, keeping the last ones
+type tailWriter struct {
+	prefix string
+	mux    sync.Mutex
+	buf    []byte
+	lines  []string
+}
+
+func (w *tailWriter) Write(b []byte) (n int, err error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.addLine(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+func (w *tailWriter) addLine(line string) {
+	if line = strings.TrimSpace(line); line == "" {
+		return
+	}
+	g.Debug("%s%s", w.prefix, line)
+	w.lines = append(w.lines, line)
+	if len(w.lines) > 10 {
+		w.lines = w.lines[1:]
+	}
+}
+
+// Tail returns the last lines written
+func (w *tailWriter) Tail() string {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if len(w.buf) > 0 {
+		w.addLine(string(w.buf))
+		w.buf = nil
+	}
+	return strings.Join(w.lines, "\n")
+}
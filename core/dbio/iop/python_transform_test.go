@@ -0,0 +1,110 @@
+package iop
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPythonTransformDataflow(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script")
+	}
+
+	// returns the batches unchanged, to check the arrow round-trip
+	dir := t.TempDir()
+	python := filepath.Join(dir, "python")
+	script := filepath.Join(dir, "transform.py")
+	assert.NoError(t, os.WriteFile(python, []byte("#!/bin/sh\nexec cat\n"), 0755))
+	assert.NoError(t, os.WriteFile(script, []byte("def transform(batch):\n  return batch\n"), 0644))
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	data := NewDataset(NewColumnsFromFields("id", "name", "amount", "active", "created_at", "day", "price"))
+	data.Columns[0].Type = BigIntType
+	data.Columns[1].Type = StringType
+	data.Columns[2].Type = FloatType
+	data.Columns[3].Type = BoolType
+	data.Columns[4].Type = TimestampzType
+	data.Columns[5].Type = DateType
+	data.Columns[6].Type = DecimalType
+	data.Rows = [][]any{
+		{int64(1), "a", 1.5, true, ts, ts, "10.25"},
+		{int64(2), nil, nil, false, nil, nil, nil},
+		{int64(3), "c", 3.0, nil, ts, ts, "1.5"},
+	}
+	data.Inferred = true
+
+	df, err := MakeDataFlow(data.Stream())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	df, err = PythonTransformDataflow(df, PythonTransformOptions{Script: script, Python: python, BatchSize: 2})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	out, err := df.Collect()
+	if assert.NoError(t, err) && assert.Len(t, out.Rows, 3) {
+		assert.Equal(t, []string{"id", "name", "amount", "active", "created_at", "day", "price"}, out.Columns.Names())
+		assert.Equal(t, TimestampzType, out.Columns[4].Type)
+		assert.Equal(t, DateType, out.Columns[5].Type)
+		assert.Equal(t, DecimalType, out.Columns[6].Type)
+		assert.EqualValues(t, 1, out.Rows[0][0])
+		assert.Equal(t, "a", out.Rows[0][1])
+		assert.Equal(t, 1.5, out.Rows[0][2])
+		assert.Equal(t, "true", out.Rows[0][3]) // bools are kept as strings
+		assert.Equal(t, ts, out.Rows[0][4])
+		assert.Nil(t, out.Rows[1][1])
+		assert.Nil(t, out.Rows[2][3])
+	}
+
+	// the errors of the script are returned
+	assert.NoError(t, os.WriteFile(python, []byte("#!/bin/sh\necho 'no module named pyarrow' >&2\nexit 1\n"), 0755))
+	df, _ = MakeDataFlow(data.Stream())
+	_, err = PythonTransformDataflow(df, PythonTransformOptions{Script: script, Python: python})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no module named pyarrow")
+	}
+
+	_, err = PythonTransformDataflow(df, PythonTransformOptions{Script: "missing.py"})
+	assert.Error(t, err)
+}
+
+// TestPythonTransformPandas runs the transform with python, when pyarrow
+// and pandas are installed
+func TestPythonTransformPandas(t *testing.T) {
+	python := "python3"
+	if err := exec.Command(python, "-c", "import pyarrow, pandas").Run(); err != nil {
+		t.Skip("pyarrow / pandas not installed")
+	}
+
+	script := filepath.Join(t.TempDir(), "transform.py")
+	code := "def transform(df):\n  df['name'] = df['name'].str.upper()\n  df['double'] = df['id'] * 2\n  return df[df['id'] != 2]\n"
+	assert.NoError(t, os.WriteFile(script, []byte(code), 0644))
+
+	data := NewDataset(NewColumnsFromFields("id", "name"))
+	data.Columns[0].Type = BigIntType
+	data.Rows = [][]any{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}}
+	df, err := MakeDataFlow(data.Stream())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	df, err = PythonTransformDataflow(df, PythonTransformOptions{Script: script, Python: python})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	out, err := df.Collect()
+	if assert.NoError(t, err) && assert.Len(t, out.Rows, 2) {
+		assert.Equal(t, []string{"id", "name", "double"}, out.Columns.Names())
+		assert.Equal(t, "C", out.Rows[1][1])
+		assert.EqualValues(t, 6, out.Rows[1][2])
+	}
+}
@@ -0,0 +1,209 @@
+package iop
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/flarco/g"
+	"github.com/flarco/g/csv"
+	"github.com/flarco/g/json"
+	"github.com/spf13/cast"
+)
+
+// OnErrorPolicy is what happens with rows that cannot be parsed
+type OnErrorPolicy string
+
+const (
+	OnErrorSkip  OnErrorPolicy = "skip"  // skip the row
+	OnErrorFail  OnErrorPolicy = "fail"  // fail the stream (default)
+	OnErrorRoute OnErrorPolicy = "route" // skip the row, written to the reject file
+)
+
+// ValidateOnErrorPolicy checks the on_error policy
+func ValidateOnErrorPolicy(policy OnErrorPolicy) error {
+	if !g.In(policy, "", OnErrorSkip, OnErrorFail, OnErrorRoute) {
+		return g.Error("invalid on_error (%s). Expected skip, fail or route", policy)
+	}
+	return nil
+}
+
+// RejectRecord is a row rejected during processing, with the reason
+// and the source location
+type RejectRecord struct {
+	Stream string         `json:"stream,omitempty"`
+	Line   int64          `json:"line,omitempty"`
+	RowNum int64          `json:"row_num,omitempty"`
+	Reason string         `json:"reason"`
+	Record map[string]any `json:"record,omitempty"`
+	Raw    []string       `json:"raw,omitempty"`
+}
+
+// RejectWriter appends rejected rows as JSON lines into a local file.
+// Several writers can append to the same file, since each row is a
+// single write.
+type RejectWriter struct {
+	Path  string
+	Count int64
+	file  *os.File
+	mux   sync.Mutex
+}
+
+// NewRejectWriter opens the reject file for appending
+func NewRejectWriter(path string) (rw *RejectWriter, err error) {
+	if path == "" {
+		return nil, g.Error("no reject file path provided")
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, g.Error(err, "could not create folder for reject file")
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, g.Error(err, "could not open reject file")
+	}
+
+	return &RejectWriter{Path: path, file: file}, nil
+}
+
+// Write appends a rejected row to the file
+func (rw *RejectWriter) Write(rec RejectRecord) (err error) {
+	rw.mux.Lock()
+	defer rw.mux.Unlock()
+
+	if rw.file == nil {
+		return g.Error("reject file is closed: %s", rw.Path)
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return g.Error(err, "could not marshal rejected row")
+	}
+
+	if _, err = rw.file.Write(append(b, '\n')); err != nil {
+		return g.Error(err, "could not write rejected row")
+	}
+
+	rw.Count++
+	return nil
+}
+
+// Close closes the reject file
+func (rw *RejectWriter) Close() error {
+	rw.mux.Lock()
+	defer rw.mux.Unlock()
+
+	if rw.file == nil {
+		return nil
+	}
+
+	err := rw.file.Close()
+	rw.file = nil
+	return err
+}
+
+// ReadRejectFile reads the rejected rows of a reject file
+func ReadRejectFile(path string) (recs []RejectRecord, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, g.Error(err, "could not read reject file")
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+
+		rec := RejectRecord{}
+		if err = json.Unmarshal([]byte(line), &rec); err != nil {
+			return nil, g.Error(err, "could not parse reject file line")
+		}
+		recs = append(recs, rec)
+	}
+
+	return recs, nil
+}
+
+// rejectRow writes the rejected row to the reject file, with the values
+// of the data columns
+func (sp *StreamProcessor) rejectRow(rec RejectRecord, row []any, columns Columns) (err error) {
+	if sp.rejects == nil {
+		sp.rejects, err = NewRejectWriter(sp.Config.RejectFile)
+		if err != nil {
+			return g.Error(err, "could not open reject file")
+		}
+		if sp.ds != nil {
+			sp.ds.Defer(func() { sp.rejects.Close() })
+		}
+	}
+
+	if rec.RowNum == 0 && row != nil {
+		rec.RowNum = cast.ToInt64(sp.N)
+	}
+	if rec.Stream == "" && sp.ds != nil {
+		rec.Stream = cast.ToString(sp.ds.Metadata.StreamURL.Value)
+	}
+
+	if row != nil {
+		rec.Record = map[string]any{}
+		for i, col := range columns {
+			if i < len(row) && col.Metadata["sling_metadata"] == "" {
+				rec.Record[col.Name] = row[i]
+			}
+		}
+	}
+
+	return sp.rejects.Write(rec)
+}
+
+// onParseError applies the on_error policy for a row which cannot be
+// parsed. Returns true if the row is skipped and reading can continue.
+// Only parse errors are handled, since other read errors are not
+// recoverable.
+func (sp *StreamProcessor) onParseError(err error, raw []string) bool {
+	var parseErr *csv.ParseError
+	if !errors.As(err, &parseErr) {
+		return false
+	}
+
+	switch sp.Config.OnError {
+	case OnErrorSkip:
+		sp.rejectCnt++
+		g.Debug("skipping row: %s", err.Error())
+		return true
+	case OnErrorRoute:
+		sp.rejectCnt++
+		rec := RejectRecord{
+			Line:   int64(parseErr.StartLine),
+			Reason: err.Error(),
+			Raw:    append([]string{}, raw...), // reader may reuse the record
+		}
+		if wErr := sp.rejectRow(rec, nil, nil); wErr != nil {
+			if sp.ds != nil {
+				sp.ds.Context.CaptureErr(wErr)
+			}
+			return false
+		}
+		return true
+	}
+
+	return false
+}
+
+// csvFieldsPerRecord returns the number of fields expected per csv record.
+// Rows with a different number of fields than the header are unparseable
+// when the on_error policy is skip or route (instead of being padded).
+func (sc *StreamConfig) csvFieldsPerRecord() int {
+	if sc.FieldsPerRec < 0 && g.In(sc.OnError, OnErrorSkip, OnErrorRoute) {
+		return 0 // set from the header
+	}
+	return sc.FieldsPerRec
+}
+
+// RejectCount returns the number of rows rejected or skipped
+func (ds *Datastream) RejectCount() uint64 {
+	return ds.Sp.rejectCnt
+}
@@ -0,0 +1,57 @@
+package iop
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnErrorPolicy(t *testing.T) {
+	content := "id,amount\n1,10\n2\n3,30\n4,40,extra\n"
+
+	consume := func(configMap map[string]string) (*Datastream, Dataset, error) {
+		if _, ok := configMap["fields_per_rec"]; !ok {
+			configMap["fields_per_rec"] = "-1" // the sling default
+		}
+		ds := NewDatastream(nil)
+		ds.SetConfig(configMap)
+		if err := ds.ConsumeCsvReader(strings.NewReader(content)); err != nil {
+			return ds, Dataset{}, err
+		}
+		data, err := ds.Collect(0)
+		return ds, data, err
+	}
+
+	// rows with missing or extra fields are padded by default
+	_, data, err := consume(map[string]string{})
+	assert.NoError(t, err)
+	assert.Len(t, data.Rows, 4)
+
+	_, _, err = consume(map[string]string{"on_error": "fail", "fields_per_rec": "0"})
+	assert.ErrorContains(t, err, "wrong number of fields")
+
+	ds, data, err := consume(map[string]string{"on_error": "skip"})
+	assert.NoError(t, err)
+	assert.Len(t, data.Rows, 2)
+	assert.EqualValues(t, 2, ds.RejectCount())
+
+	rejectFile := filepath.Join(t.TempDir(), "rejects.jsonl")
+	ds, data, err = consume(map[string]string{"on_error": "route", "reject_file": rejectFile})
+	assert.NoError(t, err)
+	assert.Len(t, data.Rows, 2)
+	assert.EqualValues(t, 2, ds.RejectCount())
+
+	recs, err := ReadRejectFile(rejectFile)
+	if assert.NoError(t, err) && assert.Len(t, recs, 2) {
+		assert.EqualValues(t, 3, recs[0].Line)
+		assert.Equal(t, []string{"2"}, recs[0].Raw)
+		assert.Contains(t, recs[0].Reason, "wrong number of fields")
+		assert.EqualValues(t, 5, recs[1].Line)
+		assert.Equal(t, []string{"4", "40", "extra"}, recs[1].Raw)
+	}
+
+	assert.NoError(t, ValidateOnErrorPolicy(OnErrorRoute))
+	assert.Error(t, ValidateOnErrorPolicy("ignore"))
+}
@@ -0,0 +1,130 @@
+package iop
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/flarco/g"
+	"github.com/spf13/cast"
+)
+
+// RowHashAlgorithm is the hashing algorithm of the row hash
+type RowHashAlgorithm string
+
+const (
+	RowHashMD5    RowHashAlgorithm = "md5"
+	RowHashXXHash RowHashAlgorithm = "xxhash"
+)
+
+// RowHashOptions are the options of the row hash
+type RowHashOptions struct {
+	Algorithm RowHashAlgorithm `json:"algorithm,omitempty" yaml:"algorithm,omitempty"` // md5 (default) or xxhash
+	Columns   []string         `json:"columns,omitempty" yaml:"columns,omitempty"`     // all data columns if empty
+}
+
+// Validate checks the algorithm
+func (o RowHashOptions) Validate() error {
+	if !g.In(o.Algorithm, "", RowHashMD5, RowHashXXHash) {
+		return g.Error("invalid row hash algorithm (%s). Expected md5 or xxhash", o.Algorithm)
+	}
+	return nil
+}
+
+// RowHasher computes the hash of the selected column values of the rows
+type RowHasher struct {
+	algorithm RowHashAlgorithm
+	colIdx    []int
+	sb        strings.Builder
+}
+
+// NewRowHasher creates a new row hasher for the provided columns
+func NewRowHasher(columns Columns, opts RowHashOptions) (h *RowHasher, err error) {
+	if err = opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	h = &RowHasher{algorithm: opts.Algorithm}
+	if h.algorithm == "" {
+		h.algorithm = RowHashMD5
+	}
+
+	if len(opts.Columns) > 0 {
+		for _, name := range opts.Columns {
+			col := columns.GetColumn(name)
+			if col == nil {
+				return nil, g.Error("row hash column not found: %s", name)
+			}
+			h.colIdx = append(h.colIdx, col.Position-1)
+		}
+	} else {
+		// use all columns, except sling metadata columns
+		for i, col := range columns {
+			if col.Metadata["sling_metadata"] == "" {
+				h.colIdx = append(h.colIdx, i)
+			}
+		}
+	}
+
+	return h, nil
+}
+
+// Hash returns the hash of the row
+func (h *RowHasher) Hash(row []any) string {
+	h.sb.Reset()
+	for _, i := range h.colIdx {
+		if i < len(row) {
+			writeCanonical(&h.sb, row[i])
+		} else {
+			writeCanonical(&h.sb, nil)
+		}
+	}
+	return hashString(h.algorithm, h.sb.String())
+}
+
+// RowHash returns the md5 hash of the row values, for change detection.
+// The values are canonicalized so that the hash is stable across runs:
+// nulls are distinguished from empty strings, and times are in UTC.
+func RowHash(values []any) string {
+	var sb strings.Builder
+	for _, val := range values {
+		writeCanonical(&sb, val)
+	}
+	return hashString(RowHashMD5, sb.String())
+}
+
+func hashString(algorithm RowHashAlgorithm, val string) string {
+	if algorithm == RowHashXXHash {
+		return strconv.FormatUint(xxhash.Sum64String(val), 16)
+	}
+	sum := md5.Sum([]byte(val))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeCanonical writes the canonical form of the value
+func writeCanonical(sb *strings.Builder, val any) {
+	switch v := val.(type) {
+	case nil:
+		sb.WriteByte(0) // null marker
+		return
+	case time.Time:
+		sb.WriteByte(1)
+		sb.WriteString(v.UTC().Format(time.RFC3339Nano))
+	case float32:
+		sb.WriteByte(1)
+		sb.WriteString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	case float64:
+		sb.WriteByte(1)
+		sb.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	case []byte:
+		sb.WriteByte(1)
+		sb.Write(v)
+	default:
+		sb.WriteByte(1)
+		sb.WriteString(cast.ToString(v))
+	}
+	sb.WriteByte(0x1f) // unit separator
+}
@@ -0,0 +1,164 @@
+package iop
+
+import (
+	"sort"
+	"unicode/utf8"
+
+	"github.com/flarco/g"
+)
+
+// OversizePolicy is what happens with values larger than `field_max_size`,
+// or rows larger than `row_max_size`
+type OversizePolicy string
+
+const (
+	OversizeTruncate OversizePolicy = "truncate" // keep the first bytes
+	OversizeError    OversizePolicy = "error"    // fail the stream
+	OversizeReject   OversizePolicy = "reject"   // skip the row, written to the reject file
+)
+
+// ValidateOversizePolicy checks the oversize policy
+func ValidateOversizePolicy(policy OversizePolicy) error {
+	if !g.In(policy, "", OversizeTruncate, OversizeError, OversizeReject) {
+		return g.Error("invalid oversize_policy (%s). Expected truncate, error or reject", policy)
+	}
+	return nil
+}
+
+// hasSizeLimits returns true if a field or row size limit is set
+func (sc *StreamConfig) hasSizeLimits() bool {
+	return sc.FieldMaxSize > 0 || sc.RowMaxSize > 0
+}
+
+// valueSize returns the size of a value in bytes. Non-text values
+// are counted as 8 bytes, since they are fixed size.
+func valueSize(val any) int64 {
+	switch v := val.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	}
+	return 8
+}
+
+// truncateString cuts the string to max bytes, without splitting a multi-byte character
+func truncateString(s string, max int64) string {
+	if int64(len(s)) <= max {
+		return s
+	}
+	i := int(max)
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i-- // back to the start of the character
+	}
+	return s[:i]
+}
+
+// truncateValue cuts a text or binary value to max bytes
+func truncateValue(val any, max int64) any {
+	switch v := val.(type) {
+	case string:
+		return truncateString(v, max)
+	case []byte:
+		if int64(len(v)) > max {
+			return v[:max]
+		}
+	}
+	return val
+}
+
+// applySizeLimits applies the field and row size limits (`field_max_size`,
+// `row_max_size`) with the oversize policy. Returns an error if the row is
+// over the limits and cannot be truncated.
+func (sp *StreamProcessor) applySizeLimits(row []any, columns Columns) error {
+	sc := &sp.Config
+
+	// field limit
+	if sc.FieldMaxSize > 0 {
+		for i, val := range row {
+			size := valueSize(val)
+			if size <= sc.FieldMaxSize {
+				continue
+			}
+
+			if sc.OversizePolicy != OversizeTruncate {
+				return g.Error("value of column %s is %d bytes, over the field_max_size of %d bytes", columns[i].Name, size, sc.FieldMaxSize)
+			}
+			row[i] = truncateValue(val, sc.FieldMaxSize)
+		}
+	}
+
+	if sc.RowMaxSize <= 0 {
+		return nil
+	}
+
+	// row limit
+	rowSize := int64(0)
+	for _, val := range row {
+		rowSize += valueSize(val)
+	}
+	if rowSize <= sc.RowMaxSize {
+		return nil
+	} else if sc.OversizePolicy != OversizeTruncate {
+		return g.Error("row is %d bytes, over the row_max_size of %d bytes", rowSize, sc.RowMaxSize)
+	}
+
+	// truncate the largest text values first, until the row fits
+	indexes := make([]int, len(row))
+	for i := range row {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		return valueSize(row[indexes[a]]) > valueSize(row[indexes[b]])
+	})
+
+	for _, i := range indexes {
+		excess := rowSize - sc.RowMaxSize
+		if excess <= 0 {
+			break
+		}
+
+		switch row[i].(type) {
+		case string, []byte:
+		default:
+			continue
+		}
+
+		size := valueSize(row[i])
+		if excess > size {
+			excess = size
+		}
+		row[i] = truncateValue(row[i], size-excess)
+		rowSize = rowSize - size + valueSize(row[i])
+	}
+
+	if rowSize > sc.RowMaxSize {
+		return g.Error("row is %d bytes, over the row_max_size of %d bytes", rowSize, sc.RowMaxSize)
+	}
+	return nil
+}
+
+// checkRowSize enforces the size limits on a casted row. The row is
+// skipped if rejected.
+func (sp *StreamProcessor) checkRowSize(row []any, columns Columns) {
+	err := sp.applySizeLimits(row, columns)
+	if err == nil {
+		return
+	}
+
+	if sp.Config.OversizePolicy == OversizeReject {
+		sp.skipCurrent = true
+		sp.rejectCnt++
+		if err = sp.rejectRow(RejectRecord{Reason: err.Error()}, row, columns); err == nil {
+			return
+		}
+	}
+
+	if sp.ds != nil {
+		sp.ds.Context.CaptureErr(err)
+	} else {
+		g.Warn(err.Error())
+	}
+}
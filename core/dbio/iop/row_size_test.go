@@ -0,0 +1,101 @@
+package iop
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flarco/g"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRowSizeLimits(t *testing.T) {
+	columns := NewColumns(Columns{
+		{Name: "id", Type: IntegerType, Sourced: true},
+		{Name: "name", Type: StringType, Sourced: true},
+		{Name: "body", Type: TextType, Sourced: true},
+	}...)
+
+	// truncate, without splitting multi-byte characters
+	assert.Equal(t, "ab", truncateString("abé", 3))
+	assert.Equal(t, "abé", truncateString("abé", 4))
+
+	sp := NewStreamProcessor()
+	sp.SetConfig(map[string]string{"field_max_size": "5", "oversize_policy": "truncate"})
+	row := sp.CastRow([]any{1, "bob", "0123456789"}, columns)
+	assert.Equal(t, []any{int64(1), "bob", "01234"}, row)
+
+	sp = NewStreamProcessor()
+	sp.SetConfig(map[string]string{"row_max_size": "20", "oversize_policy": "truncate"})
+	row = sp.CastRow([]any{1, "bob", strings.Repeat("x", 30)}, columns)
+	assert.Equal(t, []any{int64(1), "bob", strings.Repeat("x", 9)}, row)
+	assert.False(t, sp.skipCurrent)
+
+	// error
+	sp = NewStreamProcessor()
+	sp.SetConfig(map[string]string{"field_max_size": "5"})
+	err := sp.applySizeLimits([]any{int64(1), "bob", "0123456789"}, columns)
+	assert.ErrorContains(t, err, "over the field_max_size")
+
+	// reject
+	rejectFile := filepath.Join(t.TempDir(), "rejects", "rows.jsonl")
+	sp = NewStreamProcessor()
+	sp.SetConfig(map[string]string{"row_max_size": "20", "oversize_policy": "reject", "reject_file": rejectFile})
+	sp.CastRow([]any{1, "bob", strings.Repeat("x", 30)}, columns)
+	assert.True(t, sp.skipCurrent)
+	sp.skipCurrent = false
+	sp.CastRow([]any{2, "ann", "short"}, columns)
+	assert.False(t, sp.skipCurrent)
+	assert.NoError(t, sp.rejects.Close())
+	assert.EqualValues(t, 1, sp.rejects.Count)
+
+	content, err := os.ReadFile(rejectFile)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if assert.Len(t, lines, 1) {
+		rec := RejectRecord{}
+		assert.NoError(t, g.Unmarshal(lines[0], &rec))
+		assert.EqualValues(t, 1, rec.RowNum)
+		assert.Contains(t, rec.Reason, "over the row_max_size")
+		assert.Equal(t, "bob", rec.Record["name"])
+	}
+
+	assert.NoError(t, ValidateOversizePolicy(OversizeReject))
+	assert.Error(t, ValidateOversizePolicy("skip"))
+}
+
+func TestWriteJsonRecordLarge(t *testing.T) {
+	columns := NewColumns(Columns{
+		{Name: "id", Type: IntegerType},
+		{Name: "body", Type: TextType},
+		{Name: "doc", Type: JsonType},
+	}...)
+
+	body := strings.Repeat("line \"quoted\"\n\tend\x01", jsonLargeField/10) + "\xff"
+	doc := `{"items":[` + strings.Repeat(`{"a":1},`, jsonLargeField/8) + `{"a":2}]}`
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	sc := StreamConfig{}
+	tbw, err := writeJsonRecord(w, columns, jsonFieldOrder(columns), []any{int64(7), body, doc}, &sc)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Flush())
+	assert.EqualValues(t, buf.Len(), tbw)
+
+	rec := map[string]any{}
+	assert.NoError(t, g.Unmarshal(buf.String(), &rec))
+	assert.EqualValues(t, 7, rec["id"])
+	assert.Equal(t, strings.TrimSuffix(body, "\xff")+"�", rec["body"])
+	assert.Len(t, rec["doc"].(map[string]any)["items"], jsonLargeField/8+1)
+
+	// small values are marshalled as before, with sorted keys
+	buf.Reset()
+	w.Reset(&buf)
+	_, err = writeJsonRecord(w, columns, jsonFieldOrder(columns), []any{int64(1), "a\nb", `{"b":1,"a":2}`}, &sc)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, `{"body":"a\nb","doc":{"a":2,"b":1},"id":1}`, buf.String())
+}
@@ -35,6 +35,9 @@ type StreamProcessor struct {
 	unrecognizedDate string
 	warn             bool
 	skipCurrent      bool // whether to skip current row (for constraints)
+	rejects          *RejectWriter
+	rejectCnt        uint64 // number of rows rejected or skipped
+	filteredCnt      uint64 // number of rows excluded by the filter expression
 	parseFuncs       map[string]func(s string) (interface{}, error)
 	decReplRegex     *regexp.Regexp
 	ds               *Datastream
@@ -48,7 +51,8 @@ type StreamProcessor struct {
 type StreamConfig struct {
 	EmptyAsNull       bool                     `json:"empty_as_null"`
 	Header            bool                     `json:"header"`
-	Compression       CompressorType           `json:"compression"` // AUTO | ZIP | GZIP | SNAPPY | NONE
+	Compression       CompressorType           `json:"compression"` // AUTO | ZIP | GZIP | SNAPPY | ZSTD | LZ4 | BZIP2 | NONE
+	CompressionLevel  int                      `json:"compression_level"`
 	NullIf            string                   `json:"null_if"`
 	NullAs            string                   `json:"null_as"`
 	DatetimeFormat    string                   `json:"datetime_format"`
@@ -61,18 +65,42 @@ type StreamConfig struct {
 	BatchLimit        int64                    `json:"batch_limit"`
 	MaxDecimals       int                      `json:"max_decimals"`
 	Flatten           bool                     `json:"flatten"`
+	FlattenDepth      int                      `json:"flatten_depth"`
+	FlattenSeparator  string                   `json:"flatten_separator"`
+	FlattenArrays     FlattenArrayMode         `json:"flatten_arrays"`
 	FieldsPerRec      int                      `json:"fields_per_rec"`
 	Jmespath          string                   `json:"jmespath"`
 	Sheet             string                   `json:"sheet"`
 	ColumnCasing      ColumnCasing             `json:"column_casing"`
+	BinaryEncoding    BinaryEncoding           `json:"binary_encoding"` // hex | base64, for csv & json
+	BinaryMaxSize     int64                    `json:"binary_max_size"` // max bytes of binary values (0 is no limit)
+	BinaryOverflow    BinaryOverflow           `json:"binary_overflow"` // truncate | null | error
+	FieldMaxSize      int64                    `json:"field_max_size"`  // max bytes of a value (0 is no limit)
+	RowMaxSize        int64                    `json:"row_max_size"`    // max bytes of a row (0 is no limit)
+	OversizePolicy    OversizePolicy           `json:"oversize_policy"` // truncate | error | reject
+	RejectFile        string                   `json:"reject_file"`     // local path of the rejected rows (json lines)
+	OnError           OnErrorPolicy            `json:"on_error"`        // skip | fail | route, for unparseable rows
+	Encoding          string                   `json:"encoding"`        // character encoding of the files (e.g. windows-1252), utf-8 by default
 	BoolAsInt         bool                     `json:"-"`
 	Columns           Columns                  `json:"columns"` // list of column types. Can be partial list! likely is!
+	Filter            string                   `json:"filter"`  // row filter expression, evaluated by the engine
 	transforms        map[string]TransformList // array of transform functions to apply
+	filter            *Expression              // compiled row filter expression
 	maxDecimalsFormat string                   `json:"-"`
 
 	Map map[string]string `json:"-"`
 }
 
+// FlattenOptions returns the options for flattening nested records
+func (sc *StreamConfig) FlattenOptions() FlattenOptions {
+	return FlattenOptions{
+		Enabled:   sc.Flatten,
+		MaxDepth:  sc.FlattenDepth,
+		Separator: sc.FlattenSeparator,
+		Arrays:    sc.FlattenArrays,
+	}
+}
+
 func (sc *StreamConfig) ToMap() map[string]string {
 	m := g.M()
 	g.Unmarshal(g.Marshal(sc), &m)
@@ -269,8 +297,9 @@ func (sp *StreamProcessor) ResetConfig() {
 	sp.Config = DefaultStreamConfig()
 }
 
-// SetConfig sets the data.Sp.config values
-func (sp *StreamProcessor) SetConfig(configMap map[string]string) {
+// SetConfig sets the data.Sp.config values. It returns the error of an
+// invalid filter expression.
+func (sp *StreamProcessor) SetConfig(configMap map[string]string) (err error) {
 	if sp == nil {
 		sp = NewStreamProcessor()
 	}
@@ -315,6 +344,18 @@ func (sp *StreamProcessor) SetConfig(configMap map[string]string) {
 		sp.Config.Flatten = cast.ToBool(val)
 	}
 
+	if val, ok := configMap["flatten_depth"]; ok {
+		sp.Config.FlattenDepth = cast.ToInt(val)
+	}
+
+	if val, ok := configMap["flatten_separator"]; ok {
+		sp.Config.FlattenSeparator = val
+	}
+
+	if val, ok := configMap["flatten_arrays"]; ok {
+		sp.Config.FlattenArrays = FlattenArrayMode(strings.ToLower(val))
+	}
+
 	if configMap["max_decimals"] != "" && configMap["max_decimals"] != "-1" {
 		var err error
 		sp.Config.MaxDecimals, err = cast.ToIntE(configMap["max_decimals"])
@@ -345,6 +386,42 @@ func (sp *StreamProcessor) SetConfig(configMap map[string]string) {
 		sp.Config.Sheet = cast.ToString(val)
 	}
 
+	if val, ok := configMap["binary_encoding"]; ok {
+		sp.Config.BinaryEncoding = BinaryEncoding(strings.ToLower(val))
+	}
+
+	if val, ok := configMap["binary_max_size"]; ok {
+		sp.Config.BinaryMaxSize = cast.ToInt64(val)
+	}
+
+	if val, ok := configMap["binary_overflow"]; ok {
+		sp.Config.BinaryOverflow = BinaryOverflow(strings.ToLower(val))
+	}
+
+	if val, ok := configMap["field_max_size"]; ok {
+		sp.Config.FieldMaxSize = cast.ToInt64(val)
+	}
+
+	if val, ok := configMap["row_max_size"]; ok {
+		sp.Config.RowMaxSize = cast.ToInt64(val)
+	}
+
+	if val, ok := configMap["oversize_policy"]; ok {
+		sp.Config.OversizePolicy = OversizePolicy(strings.ToLower(val))
+	}
+
+	if val, ok := configMap["reject_file"]; ok {
+		sp.Config.RejectFile = val
+	}
+
+	if val, ok := configMap["encoding"]; ok {
+		sp.Config.Encoding = val
+	}
+
+	if val, ok := configMap["on_error"]; ok {
+		sp.Config.OnError = OnErrorPolicy(strings.ToLower(val))
+	}
+
 	if val, ok := configMap["skip_blank_lines"]; ok {
 		sp.Config.SkipBlankLines = cast.ToBool(val)
 	}
@@ -365,8 +442,22 @@ func (sp *StreamProcessor) SetConfig(configMap map[string]string) {
 		sp.applyTransforms(val)
 	}
 
+	if val, ok := configMap["filter"]; ok && strings.TrimSpace(val) != "" {
+		filter, parseErr := ParseExpression(val)
+		if parseErr != nil {
+			err = g.Error(parseErr, "invalid filter")
+		} else {
+			sp.Config.Filter = val
+			sp.Config.filter = filter
+		}
+	}
+
 	if val, ok := configMap["compression"]; ok {
-		sp.Config.Compression = CompressorType(strings.ToLower(val))
+		sp.Config.Compression = *CompressorType(val).Normalize()
+	}
+
+	if val, ok := configMap["compression_level"]; ok {
+		sp.Config.CompressionLevel = cast.ToInt(val)
 	}
 
 	if val, ok := configMap["datetime_format"]; ok {
@@ -376,6 +467,8 @@ func (sp *StreamProcessor) SetConfig(configMap map[string]string) {
 			[]string{sp.Config.DatetimeFormat},
 			sp.dateLayouts...)
 	}
+
+	return err
 }
 
 func makeColumnTransforms(transformsPayload string) map[string][]string {
@@ -617,6 +710,29 @@ func (sp *StreamProcessor) CastVal(i int, val interface{}, col *Column) interfac
 	transforms := append(sp.Config.transforms[colKey], sp.Config.transforms["*"]...)
 
 	switch {
+	case col.Type == BinaryType:
+		if !isString {
+			sVal = cast.ToString(val)
+		}
+
+		bVal, err := sp.Config.limitBinary(col.Name, []byte(sVal))
+		if err != nil && sp.ds != nil {
+			sp.ds.Context.CaptureErr(err)
+		} else if err != nil {
+			g.Warn(err.Error())
+		}
+		if bVal == nil {
+			cs.TotalCnt++
+			cs.NullCnt++
+			return nil
+		}
+
+		if l := len(bVal); l > cs.MaxLen {
+			cs.MaxLen = l
+		}
+		cs.StringCnt++
+		sp.rowChecksum[i] = uint64(len(bVal))
+		nVal = bVal
 	case col.Type.IsString():
 		if sVal == "" && val != nil {
 			if reflect.TypeOf(val).Kind() == reflect.Slice || reflect.TypeOf(val).Kind() == reflect.Map {
@@ -922,6 +1038,8 @@ func (sp *StreamProcessor) CastToString(i int, val interface{}, valType ...Colum
 			return "1"
 		}
 		return "0"
+	case typ.IsBinary():
+		return sp.Config.EncodeBinary(val)
 	case typ.IsDecimal() || typ.IsFloat():
 		if RemoveTrailingDecZeros {
 			// attempt to remove trailing zeros, but is 10 times slower
@@ -1300,6 +1418,10 @@ func (sp *StreamProcessor) CastRow(row []interface{}, columns Columns) []interfa
 		row = append(row, nil)
 	}
 
+	if sp.Config.hasSizeLimits() && !sp.skipCurrent {
+		sp.checkRowSize(row, columns)
+	}
+
 	// debug a row, prev
 	if sp.warn {
 		g.Trace("%s -> %#v", sp.unrecognizedDate, row)
@@ -1309,6 +1431,28 @@ func (sp *StreamProcessor) CastRow(row []interface{}, columns Columns) []interfa
 	return row
 }
 
+// FilterRow returns false if the row does not satisfy the filter expression
+func (sp *StreamProcessor) FilterRow(row []any, columns Columns) bool {
+	if sp.Config.filter == nil {
+		return true
+	}
+
+	keep, err := sp.Config.filter.EvalBool(sp, columns, row)
+	if err != nil {
+		if sp.ds != nil {
+			sp.ds.Context.CaptureErr(g.Error(err, "could not evaluate filter"))
+		} else {
+			g.Warn("could not evaluate filter: %s", err.Error())
+		}
+		return false
+	}
+
+	if !keep {
+		sp.filteredCnt++
+	}
+	return keep
+}
+
 // ProcessRow processes a row
 func (sp *StreamProcessor) ProcessRow(row []interface{}) []interface{} {
 	// Ensure usable types
@@ -0,0 +1,66 @@
+package iop
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// throttleMinWait is the minimum wait of the throttle. Smaller waits are
+// accumulated, since sleeping for less is not precise.
+const throttleMinWait = 10 * time.Millisecond
+
+// Throttle is a token bucket limiting a rate per second (of rows or bytes).
+// The bucket is refilled continuously, and holds up to one second of tokens.
+type Throttle struct {
+	rate   float64 // tokens per second
+	tokens float64 // negative when in debt
+	last   time.Time
+	mux    sync.Mutex
+}
+
+// NewThrottle returns a throttle for the rate per second, or nil if no limit
+func NewThrottle(perSecond int64) *Throttle {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &Throttle{rate: float64(perSecond), tokens: float64(perSecond), last: time.Now()}
+}
+
+// Rate returns the rate per second of the throttle
+func (t *Throttle) Rate() int64 {
+	if t == nil {
+		return 0
+	}
+	return int64(t.rate)
+}
+
+// Wait takes n tokens from the bucket, waiting until the debt is refilled
+// (or the context is done)
+func (t *Throttle) Wait(ctx context.Context, n int64) {
+	if t == nil || n <= 0 {
+		return
+	}
+
+	t.mux.Lock()
+	now := time.Now()
+	t.tokens = t.tokens + now.Sub(t.last).Seconds()*t.rate
+	if t.tokens > t.rate {
+		t.tokens = t.rate // max burst of one second
+	}
+	t.last = now
+	t.tokens = t.tokens - float64(n)
+	wait := time.Duration(-t.tokens / t.rate * float64(time.Second))
+	t.mux.Unlock()
+
+	if wait < throttleMinWait {
+		return
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
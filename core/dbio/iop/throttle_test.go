@@ -0,0 +1,56 @@
+package iop
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottle(t *testing.T) {
+	ctx := context.Background()
+
+	// no limit
+	var nilThrottle *Throttle
+	assert.Nil(t, NewThrottle(0))
+	nilThrottle.Wait(ctx, 1000)
+	assert.EqualValues(t, 0, nilThrottle.Rate())
+
+	// first second is the burst, then 100 tokens per second
+	throttle := NewThrottle(100)
+	assert.EqualValues(t, 100, throttle.Rate())
+	start := time.Now()
+	for i := 0; i < 150; i++ {
+		throttle.Wait(ctx, 1)
+	}
+	elapsed := time.Since(start)
+	assert.Greater(t, elapsed, 400*time.Millisecond)
+	assert.Less(t, elapsed, 1500*time.Millisecond)
+
+	// the context cancels the wait
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	throttle.Wait(ctx, 1000)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestDataflowThrottle(t *testing.T) {
+	data := NewDataset(NewColumnsFromFields("a", "b"))
+	for i := 0; i < 60; i++ {
+		data.Append([]any{i, "value"})
+	}
+
+	df, err := MakeDataFlow(data.Stream())
+	if !assert.NoError(t, err) {
+		return
+	}
+	df.SetThrottle(50, 0)
+
+	start := time.Now()
+	data, err = df.Collect()
+	assert.NoError(t, err)
+	assert.Len(t, data.Rows, 60)
+	assert.Greater(t, time.Since(start), 100*time.Millisecond)
+}
@@ -0,0 +1,266 @@
+package iop
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// WasmTransformOptions are the options of a WASM transform module
+type WasmTransformOptions struct {
+	Module    string // path of the WASM module (.wasm)
+	BatchSize int    // number of rows per batch, 10000 by default
+}
+
+// wasmBatch is a batch of rows exchanged with the WASM module, as JSON.
+// The output columns are optional (the input ones by default), and their
+// types are inferred when missing. The module can return an error instead
+// of the rows.
+type wasmBatch struct {
+	Columns []wasmColumn `json:"columns,omitempty"`
+	Rows    [][]any      `json:"rows"`
+	Error   string       `json:"error,omitempty"`
+}
+
+type wasmColumn struct {
+	Name string     `json:"name"`
+	Type ColumnType `json:"type,omitempty"`
+}
+
+// wasmModule is an instance of a WASM transform module, in the embedded
+// runtime. The module exports its memory and the functions:
+//   - alloc(size i32) i32: allocates a buffer for the input batch
+//   - transform(ptr i32, len i32) i64: transforms the input batch, returning
+//     the output batch location, packed as `ptr << 32 | len`
+//   - dealloc(ptr i32, len i32): frees a buffer (optional)
+type wasmModule struct {
+	ctx       context.Context
+	runtime   wazero.Runtime
+	module    api.Module
+	alloc     api.Function
+	transform api.Function
+	dealloc   api.Function
+	stderr    *tailWriter
+}
+
+// newWasmModule compiles and instantiates the module. WASI modules are
+// supported, without access to the files, the network or the environment
+// variables.
+func newWasmModule(ctx context.Context, path string) (wm *wasmModule, err error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, g.Error(err, "could not read wasm transform module: %s", path)
+	}
+
+	wm = &wasmModule{ctx: ctx, stderr: &tailWriter{prefix: "[wasm] "}}
+	wm.runtime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	wasi_snapshot_preview1.MustInstantiate(ctx, wm.runtime)
+
+	compiled, err := wm.runtime.CompileModule(ctx, code)
+	if err != nil {
+		wm.Close()
+		return nil, g.Error(err, "could not compile wasm transform module: %s", path)
+	}
+
+	config := wazero.NewModuleConfig().
+		WithStdout(wm.stderr).
+		WithStderr(wm.stderr).
+		WithStartFunctions("_initialize") // WASI reactor
+	wm.module, err = wm.runtime.InstantiateModule(ctx, compiled, config)
+	if err != nil {
+		wm.Close()
+		return nil, g.Error(err, "could not instantiate wasm transform module: %s", path)
+	}
+
+	wm.alloc = wm.module.ExportedFunction("alloc")
+	wm.transform = wm.module.ExportedFunction("transform")
+	wm.dealloc = wm.module.ExportedFunction("dealloc")
+	if wm.alloc == nil || wm.transform == nil || wm.module.Memory() == nil {
+		wm.Close()
+		return nil, g.Error("wasm transform module must export memory, alloc and transform: %s", path)
+	}
+
+	return wm, nil
+}
+
+// Transform sends the batch to the module, and returns its output batch
+func (wm *wasmModule) Transform(batch wasmBatch) (out wasmBatch, err error) {
+	input, err := json.Marshal(batch)
+	if err != nil {
+		return out, g.Error(err, "could not encode batch")
+	}
+
+	results, err := wm.alloc.Call(wm.ctx, uint64(len(input)))
+	if err != nil {
+		return out, g.Error(err, "could not allocate wasm memory: %s", wm.stderr.Tail())
+	}
+	ptr := uint32(results[0])
+	if !wm.module.Memory().Write(ptr, input) {
+		return out, g.Error("could not write batch to wasm memory (%d bytes at %d)", len(input), ptr)
+	}
+	defer wm.free(ptr, uint32(len(input)))
+
+	results, err = wm.transform.Call(wm.ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return out, g.Error(err, "wasm transform failed: %s", wm.stderr.Tail())
+	}
+
+	outPtr, outLen := uint32(results[0]>>32), uint32(results[0])
+	output, ok := wm.module.Memory().Read(outPtr, outLen)
+	if !ok {
+		return out, g.Error("could not read batch from wasm memory (%d bytes at %d)", outLen, outPtr)
+	}
+	defer wm.free(outPtr, outLen)
+
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	decoder.UseNumber()
+	if err = decoder.Decode(&out); err != nil {
+		return out, g.Error(err, "could not decode wasm transform output")
+	} else if out.Error != "" {
+		return out, g.Error("wasm transform failed: %s", out.Error)
+	}
+
+	for _, row := range out.Rows {
+		wasmRow(row)
+	}
+	return out, nil
+}
+
+func (wm *wasmModule) free(ptr, size uint32) {
+	if wm.dealloc != nil {
+		wm.dealloc.Call(wm.ctx, uint64(ptr), uint64(size))
+	}
+}
+
+// Close releases the module and the runtime
+func (wm *wasmModule) Close() {
+	wm.runtime.Close(context.Background())
+}
+
+// WasmTransformDataflow returns a new dataflow with the rows transformed
+// by the WASM module, compiled from any language. The module runs in the
+// embedded runtime sandbox, and its transform function is called with
+// each batch of rows (as JSON). The streams are merged first.
+func WasmTransformDataflow(df *Dataflow, opts WasmTransformOptions) (dfN *Dataflow, err error) {
+	if !g.PathExists(opts.Module) {
+		return df, g.Error("wasm transform module not found: %s", opts.Module)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 10000
+	}
+
+	wm, err := newWasmModule(df.Context.Ctx, opts.Module)
+	if err != nil {
+		return df, err
+	}
+
+	config := df.StreamConfig()
+	dsM := MergeDataflow(df)
+	rows := dsM.Rows()
+
+	inColumns := make([]wasmColumn, len(dsM.Columns))
+	for i, col := range dsM.Columns {
+		inColumns[i] = wasmColumn{Name: col.Name, Type: col.Type}
+	}
+
+	// nextBatch transforms the next batch of rows read
+	nextBatch := func() (batch wasmBatch, done bool, err error) {
+		in := wasmBatch{Columns: inColumns}
+		for row := range rows {
+			in.Rows = append(in.Rows, row)
+			if len(in.Rows) >= opts.BatchSize {
+				break
+			}
+		}
+		if len(in.Rows) == 0 {
+			return batch, true, nil
+		}
+		batch, err = wm.Transform(in)
+		return batch, false, err
+	}
+
+	g.Debug("transforming rows with wasm module %s (batches of %d rows)", opts.Module, opts.BatchSize)
+
+	// the output columns are read with the first batch
+	batch, done, err := nextBatch()
+	if err != nil {
+		df.Context.Cancel() // stops reading the source
+		wm.Close()
+		return df, err
+	}
+
+	outColumns := lo.Ternary(len(batch.Columns) > 0, batch.Columns, inColumns)
+	inferred := true
+	newColumns := make(Columns, len(outColumns))
+	for i, col := range outColumns {
+		newColumns[i] = Column{Name: col.Name, Position: i + 1, Type: col.Type}
+		if !col.Type.IsValid() {
+			newColumns[i].Type = StringType
+			inferred = false
+		}
+	}
+
+	batchRow := 0
+	nextFunc := func(it *Iterator) bool {
+		for {
+			if batchRow < len(batch.Rows) {
+				it.Row = batch.Rows[batchRow]
+				batchRow++
+				return true
+			} else if done {
+				return false
+			}
+
+			batchRow = 0
+			if batch, done, err = nextBatch(); err != nil {
+				it.Context.CaptureErr(err)
+				return false
+			}
+		}
+	}
+
+	dsN := NewDatastreamIt(df.Context.Ctx, newColumns, nextFunc)
+	dsN.Inferred = inferred
+	dsN.Sp.Config = config
+	dsN.config = config
+	dsN.Defer(func() {
+		wm.Close()
+		if err := dsM.Err(); err != nil {
+			dsN.Context.CaptureErr(err)
+		}
+	})
+
+	if err = dsN.Start(); err != nil {
+		return df, g.Error(err, "could not start wasm transform stream")
+	}
+
+	dfN, err = MakeDataFlow(dsN)
+	if err != nil {
+		return df, g.Error(err, "could not make wasm transform dataflow")
+	}
+
+	return dfN, nil
+}
+
+// wasmRow converts the JSON numbers of the row
+func wasmRow(row []any) []any {
+	for i, val := range row {
+		if num, ok := val.(json.Number); ok {
+			if v, err := num.Int64(); err == nil {
+				row[i] = v
+			} else if v, err := num.Float64(); err == nil {
+				row[i] = v
+			} else {
+				row[i] = num.String()
+			}
+		}
+	}
+	return row
+}
@@ -0,0 +1,150 @@
+package iop
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testWasmModule assembles a module exporting memory, alloc (returning
+// offset 1024) and transform (with the provided body), with the data at
+// offset 0
+func testWasmModule(transformBody []byte, data string) []byte {
+	uleb := func(v int) (b []byte) {
+		for {
+			c := byte(v & 0x7f)
+			v >>= 7
+			if v != 0 {
+				c |= 0x80
+			}
+			b = append(b, c)
+			if v == 0 {
+				return b
+			}
+		}
+	}
+	name := func(s string) []byte { return append(uleb(len(s)), s...) }
+	section := func(id byte, content ...[]byte) []byte {
+		var body []byte
+		for _, c := range content {
+			body = append(body, c...)
+		}
+		return append(append([]byte{id}, uleb(len(body))...), body...)
+	}
+
+	allocBody := []byte{0x00, 0x41, 0x80, 0x08, 0x0b} // i32.const 1024
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	module = append(module, section(1, []byte{0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e})...)
+	module = append(module, section(3, []byte{0x02, 0x00, 0x01})...)
+	module = append(module, section(5, []byte{0x01, 0x00, 0x01})...)
+	module = append(module, section(7,
+		[]byte{0x03}, name("memory"), []byte{0x02, 0x00},
+		name("alloc"), []byte{0x00, 0x00},
+		name("transform"), []byte{0x00, 0x01},
+	)...)
+	module = append(module, section(10,
+		[]byte{0x02}, uleb(len(allocBody)), allocBody,
+		uleb(len(transformBody)), transformBody,
+	)...)
+	if data != "" {
+		module = append(module, section(11, []byte{0x01, 0x00, 0x41, 0x00, 0x0b}, name(data))...)
+	}
+	return module
+}
+
+// returnData returns the body of a transform returning the data at offset 0
+func returnData(data string) []byte {
+	// i64.const len (signed LEB128)
+	body := []byte{0x00, 0x42}
+	for v := len(data); ; v >>= 7 {
+		c := byte(v & 0x7f)
+		if v>>7 == 0 && c&0x40 == 0 {
+			body = append(body, c)
+			break
+		}
+		body = append(body, c|0x80)
+	}
+	return append(body, 0x0b)
+}
+
+func TestWasmTransformDataflow(t *testing.T) {
+	dir := t.TempDir()
+	writeModule := func(name string, module []byte) string {
+		path := filepath.Join(dir, name+".wasm")
+		assert.NoError(t, os.WriteFile(path, module, 0644))
+		return path
+	}
+
+	newData := func() *Dataset {
+		data := NewDataset(NewColumnsFromFields("id", "name", "amount"))
+		data.Columns[0].Type = BigIntType
+		data.Columns[1].Type = StringType
+		data.Columns[2].Type = FloatType
+		data.Rows = [][]any{
+			{int64(1), "a", 1.5},
+			{int64(2), nil, nil},
+			{int64(3), "c", 3.0},
+		}
+		data.Inferred = true
+		return &data
+	}
+
+	// returns the batches unchanged (ptr << 32 | len), to check the round-trip
+	echo := writeModule("echo", testWasmModule([]byte{0x00, 0x20, 0x00, 0xad, 0x42, 0x20, 0x86, 0x20, 0x01, 0xad, 0x84, 0x0b}, ""))
+	df, err := MakeDataFlow(newData().Stream())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	df, err = WasmTransformDataflow(df, WasmTransformOptions{Module: echo, BatchSize: 2})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	out, err := df.Collect()
+	if assert.NoError(t, err) && assert.Len(t, out.Rows, 3) {
+		assert.Equal(t, []string{"id", "name", "amount"}, out.Columns.Names())
+		assert.Equal(t, FloatType, out.Columns[2].Type)
+		assert.EqualValues(t, 1, out.Rows[0][0])
+		assert.Equal(t, "a", out.Rows[0][1])
+		assert.Equal(t, 1.5, out.Rows[0][2])
+		assert.Nil(t, out.Rows[1][1])
+		assert.EqualValues(t, 3, out.Rows[2][0])
+	}
+
+	// new columns, without types
+	output := `{"columns":[{"name":"total"}],"rows":[[10],[20]]}`
+	module := writeModule("total", testWasmModule(returnData(output), output))
+	df, _ = MakeDataFlow(newData().Stream())
+	df, err = WasmTransformDataflow(df, WasmTransformOptions{Module: module})
+	if assert.NoError(t, err) {
+		out, err = df.Collect()
+		if assert.NoError(t, err) && assert.Len(t, out.Rows, 2) {
+			assert.Equal(t, []string{"total"}, out.Columns.Names())
+			assert.True(t, out.Columns[0].Type.IsInteger())
+			assert.EqualValues(t, 20, out.Rows[1][0])
+		}
+	}
+
+	// the errors of the module are returned
+	output = `{"error":"invalid row"}`
+	module = writeModule("error", testWasmModule(returnData(output), output))
+	df, _ = MakeDataFlow(newData().Stream())
+	_, err = WasmTransformDataflow(df, WasmTransformOptions{Module: module})
+	assert.ErrorContains(t, err, "invalid row")
+
+	module = writeModule("trap", testWasmModule([]byte{0x00, 0x00, 0x0b}, "")) // unreachable
+	df, _ = MakeDataFlow(newData().Stream())
+	_, err = WasmTransformDataflow(df, WasmTransformOptions{Module: module})
+	assert.ErrorContains(t, err, "unreachable")
+
+	module = writeModule("empty", []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00})
+	df, _ = MakeDataFlow(newData().Stream())
+	_, err = WasmTransformDataflow(df, WasmTransformOptions{Module: module})
+	assert.ErrorContains(t, err, "must export memory, alloc and transform")
+
+	_, err = WasmTransformDataflow(df, WasmTransformOptions{Module: "missing.wasm"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,399 @@
+// Package plugin runs the community connector plugins. A plugin is an
+// executable named `sling-plugin-<name>` in the plugins folder
+// (`~/.sling/plugins`, or `SLING_PLUGINS_DIR`), which sling calls with an
+// action argument, exchanging JSON on the standard input and output:
+//
+//	spec    prints the Spec of the plugin
+//	check   reads a Request, exits with an error if the config is invalid
+//	streams reads a Request, prints the streams: {"streams": ["users", ...]}
+//	read    reads a Request, prints one JSON record per line
+//	write   reads a Request line, then one JSON record per line
+//	drop    reads a Request, deletes the data of the stream
+//
+// Any output on the standard error is logged at the debug level, and the
+// last lines are returned in the error of a failed call.
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/env"
+)
+
+// Prefix is the file name prefix of the plugin executables
+const Prefix = "sling-plugin-"
+
+// ProtocolVersion is the version of the protocol, passed to the plugins
+// in the `SLING_PLUGIN_PROTOCOL` environment variable
+const ProtocolVersion = "1"
+
+// Capabilities of a plugin
+const (
+	CapabilityRead  = "read"
+	CapabilityWrite = "write"
+)
+
+var nameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Spec is the description of a plugin, printed by the `spec` action
+type Spec struct {
+	Name         string   `json:"name"`
+	Version      string   `json:"version"`
+	Description  string   `json:"description,omitempty"`
+	Capabilities []string `json:"capabilities"` // read, write
+}
+
+// Can returns true if the plugin has the capability
+func (s Spec) Can(capability string) bool {
+	return g.In(capability, s.Capabilities...)
+}
+
+// Request is the input of an action
+type Request struct {
+	Config  map[string]string `json:"config"`            // the connection properties
+	Stream  string            `json:"stream,omitempty"`  // the stream to read / write
+	Options map[string]any    `json:"options,omitempty"` // read: fields, limit, update_key, value, start_value, end_value. write: primary_key
+	Columns []Column          `json:"columns,omitempty"` // write: the columns of the records
+}
+
+// Column is a column of the records written
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Plugin is an installed plugin
+type Plugin struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Spec Spec   `json:"spec"`
+}
+
+// Dir returns the plugins folder
+func Dir() string {
+	return env.HomePluginDir()
+}
+
+func fileName(name string) string {
+	if runtime.GOOS == "windows" {
+		return Prefix + name + ".exe"
+	}
+	return Prefix + name
+}
+
+// Get returns the installed plugin, with its spec
+func Get(ctx context.Context, name string) (p *Plugin, err error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !nameRegex.MatchString(name) {
+		return nil, g.Error("invalid plugin name: %s", name)
+	}
+
+	p = &Plugin{Name: name, Path: filepath.Join(Dir(), fileName(name))}
+	if !g.PathExists(p.Path) {
+		return nil, g.Error("plugin %s is not installed (did not find %s). Install it with `sling plugins install`", name, p.Path)
+	}
+
+	if err = p.loadSpec(ctx); err != nil {
+		return nil, g.Error(err, "could not get spec of plugin %s", name)
+	}
+
+	return p, nil
+}
+
+// List returns the installed plugins
+func List(ctx context.Context) (plugins []*Plugin, err error) {
+	entries, err := os.ReadDir(Dir())
+	if os.IsNotExist(err) {
+		return plugins, nil
+	} else if err != nil {
+		return nil, g.Error(err, "could not list plugins folder")
+	}
+
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".exe")
+		if entry.IsDir() || !strings.HasPrefix(name, Prefix) {
+			continue
+		}
+
+		p, err := Get(ctx, strings.TrimPrefix(name, Prefix))
+		if err != nil {
+			g.Warn("skipping plugin %s: %s", entry.Name(), err.Error())
+			continue
+		}
+		plugins = append(plugins, p)
+	}
+
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+
+	return plugins, nil
+}
+
+// InstallOptions are the options of a plugin install
+type InstallOptions struct {
+	Name   string // the plugin name, from the source file name (sling-plugin-<name>) if empty
+	SHA256 string // the expected checksum of the executable, required for URLs
+}
+
+// Install copies the plugin executable (a local path or an https URL) into
+// the plugins folder. The executable is not run: the name is the provided
+// one (or the one of the file name), and the checksum is verified before it
+// is made executable.
+func Install(ctx context.Context, source string, opts InstallOptions) (p *Plugin, err error) {
+	isURL := strings.HasPrefix(source, "https://")
+	if strings.HasPrefix(source, "http://") {
+		return nil, g.Error("plugins must be downloaded over https: %s", source)
+	} else if isURL && opts.SHA256 == "" {
+		return nil, g.Error("the sha256 checksum of the plugin is required to install from a URL")
+	}
+
+	name := strings.ToLower(strings.TrimSpace(opts.Name))
+	if name == "" {
+		base := strings.TrimSuffix(path.Base(strings.Split(source, "?")[0]), ".exe")
+		if !strings.HasPrefix(base, Prefix) {
+			return nil, g.Error("could not determine the plugin name from %s, provide it with --name", source)
+		}
+		name = strings.TrimPrefix(base, Prefix)
+	}
+	if !nameRegex.MatchString(name) {
+		return nil, g.Error("invalid plugin name: %#v", name)
+	}
+
+	if err = os.MkdirAll(Dir(), 0755); err != nil {
+		return nil, g.Error(err, "could not create plugins folder")
+	}
+
+	tmp, err := os.CreateTemp(Dir(), ".install-*")
+	if err != nil {
+		return nil, g.Error(err, "could not create temp file")
+	}
+	defer os.Remove(tmp.Name())
+
+	var reader io.ReadCloser
+	if isURL {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, g.Error(err, "could not create request")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, g.Error(err, "could not download plugin")
+		} else if resp.StatusCode >= 300 {
+			resp.Body.Close()
+			return nil, g.Error("could not download plugin: status %d", resp.StatusCode)
+		}
+		reader = resp.Body
+	} else if reader, err = os.Open(strings.TrimPrefix(source, "file://")); err != nil {
+		return nil, g.Error(err, "could not open plugin")
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), reader)
+	reader.Close()
+	tmp.Close()
+	if err != nil {
+		return nil, g.Error(err, "could not copy plugin")
+	}
+
+	if checksum := hex.EncodeToString(hash.Sum(nil)); opts.SHA256 != "" && !strings.EqualFold(checksum, strings.TrimSpace(opts.SHA256)) {
+		return nil, g.Error("checksum mismatch for plugin %s: expected %s, got %s", name, opts.SHA256, checksum)
+	} else if err = os.Chmod(tmp.Name(), 0755); err != nil {
+		return nil, g.Error(err, "could not make plugin executable")
+	}
+
+	p = &Plugin{Name: name, Path: filepath.Join(Dir(), fileName(name))}
+	if err = os.Rename(tmp.Name(), p.Path); err != nil {
+		return nil, g.Error(err, "could not install plugin %s", p.Name)
+	}
+
+	return p, nil
+}
+
+// Remove deletes the installed plugin
+func Remove(name string) (err error) {
+	path := filepath.Join(Dir(), fileName(strings.ToLower(name)))
+	if !g.PathExists(path) {
+		return g.Error("plugin %s is not installed", name)
+	}
+	if err = os.Remove(path); err != nil {
+		return g.Error(err, "could not remove plugin %s", name)
+	}
+	return nil
+}
+
+func (p *Plugin) loadSpec(ctx context.Context) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var spec Spec
+	if err = p.Call(ctx, "spec", nil, &spec); err != nil {
+		return err
+	} else if spec.Name == "" {
+		return g.Error("the spec has no name")
+	}
+
+	p.Spec = spec
+	return nil
+}
+
+// command returns the command of the action
+func (p *Plugin) command(ctx context.Context, action string) (cmd *exec.Cmd, stderr *logWriter) {
+	stderr = &logWriter{name: p.Name}
+	cmd = exec.CommandContext(ctx, p.Path, action)
+	cmd.Env = append(os.Environ(), "SLING_PLUGIN_PROTOCOL="+ProtocolVersion)
+	cmd.Stderr = stderr
+	return cmd, stderr
+}
+
+// Call runs the action with the request as input, unmarshalling the output
+// into result (if not nil)
+func (p *Plugin) Call(ctx context.Context, action string, req *Request, result any) (err error) {
+	cmd, stderr := p.command(ctx, action)
+	if req != nil {
+		cmd.Stdin = strings.NewReader(g.Marshal(req) + "\n")
+	}
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err = cmd.Run(); err != nil {
+		return stderr.Error(err, action)
+	}
+
+	if result != nil {
+		if err = json.Unmarshal(stdout.Bytes(), result); err != nil {
+			output := stdout.String()
+			if len(output) > 200 {
+				output = output[:200] + "..."
+			}
+			return g.Error(err, "could not unmarshal output of %s: %s", action, output)
+		}
+	}
+
+	return nil
+}
+
+// Read starts the `read` action, returning the decoder of the records and
+// the function to wait for the end of the process
+func (p *Plugin) Read(ctx context.Context, req Request) (decoder *json.Decoder, wait func() error, err error) {
+	cmd, stderr := p.command(ctx, "read")
+	cmd.Stdin = strings.NewReader(g.Marshal(req) + "\n")
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, g.Error(err, "could not get stdout pipe")
+	} else if err = cmd.Start(); err != nil {
+		return nil, nil, g.Error(err, "could not start plugin %s", p.Name)
+	}
+
+	wait = func() error {
+		if err := cmd.Wait(); err != nil {
+			return stderr.Error(err, "read")
+		}
+		return nil
+	}
+
+	decoder = json.NewDecoder(bufio.NewReader(stdout))
+	decoder.UseNumber()
+	return decoder, wait, nil
+}
+
+// Write starts the `write` action, returning the encoder of the records and
+// the function to close the input and wait for the end of the process
+func (p *Plugin) Write(ctx context.Context, req Request) (encoder *json.Encoder, wait func() error, err error) {
+	cmd, stderr := p.command(ctx, "write")
+	cmd.Stdout = stderr // log any output
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, g.Error(err, "could not get stdin pipe")
+	} else if err = cmd.Start(); err != nil {
+		return nil, nil, g.Error(err, "could not start plugin %s", p.Name)
+	}
+
+	writer := bufio.NewWriter(stdin)
+	wait = func() error {
+		flushErr := writer.Flush()
+		stdin.Close()
+		if err := cmd.Wait(); err != nil {
+			return stderr.Error(err, "write")
+		} else if flushErr != nil {
+			return g.Error(flushErr, "could not write records to plugin %s", p.Name)
+		}
+		return nil
+	}
+
+	encoder = json.NewEncoder(writer)
+	if err = encoder.Encode(req); err != nil {
+		wait()
+		return nil, nil, g.Error(err, "could not write request to plugin %s", p.Name)
+	}
+
+	return encoder, wait, nil
+}
+
+// logWriter logs the lines written by the plugin, keeping the last ones
+type logWriter struct {
+	name  string
+	mux   sync.Mutex
+	buf   []byte
+	lines []string
+}
+
+func (w *logWriter) Write(b []byte) (n int, err error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.addLine(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+func (w *logWriter) addLine(line string) {
+	if line = strings.TrimSpace(line); line == "" {
+		return
+	}
+	g.Debug("[plugin %s] %s", w.name, line)
+	w.lines = append(w.lines, line)
+	if len(w.lines) > 10 {
+		w.lines = w.lines[1:]
+	}
+}
+
+// Error returns the error of the action, with the last lines logged
+func (w *logWriter) Error(err error, action string) error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if len(w.buf) > 0 {
+		w.addLine(string(w.buf))
+		w.buf = nil
+	}
+	if len(w.lines) > 0 {
+		return g.Error(err, "plugin %s failed to %s: %s", w.name, action, strings.Join(w.lines, "\n"))
+	}
+	return g.Error(err, "plugin %s failed to %s", w.name, action)
+}
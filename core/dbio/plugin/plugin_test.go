@@ -0,0 +1,143 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/flarco/g"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPlugin is a plugin reading the `users` stream, and writing the
+// records into the file of the `output` config
+const testPlugin = `#!/bin/sh
+case "$1" in
+  spec) echo '{"name": "test", "version": "0.1.0", "capabilities": ["read", "write"]}' ;;
+  check) grep -q '"token":"secret"' || { echo "invalid token" >&2; exit 1; } ;;
+  streams) cat > /dev/null; echo '{"streams": ["users"]}' ;;
+  read)
+    cat > /dev/null
+    echo '{"id": 1, "name": "Ann"}'
+    echo '{"id": 2, "name": "Bob"}'
+    ;;
+  write)
+    read -r request
+    output=$(echo "$request" | sed 's/.*"output":"\([^"]*\)".*/\1/')
+    cat > "$output"
+    ;;
+esac
+`
+
+func writeTestPlugin(t *testing.T) (source string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell plugin")
+	}
+	t.Setenv("SLING_PLUGINS_DIR", filepath.Join(t.TempDir(), "plugins"))
+	source = filepath.Join(t.TempDir(), "test-plugin.sh")
+	if err := os.WriteFile(source, []byte(testPlugin), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func TestPlugin(t *testing.T) {
+	ctx := context.Background()
+	source := writeTestPlugin(t)
+
+	p, err := Install(ctx, source, InstallOptions{Name: "test"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "test", p.Name)
+	assert.Equal(t, filepath.Join(Dir(), "sling-plugin-test"), p.Path)
+
+	plugins, err := List(ctx)
+	if assert.NoError(t, err) && assert.Len(t, plugins, 1) {
+		assert.Equal(t, "0.1.0", plugins[0].Spec.Version)
+	}
+
+	p, err = Get(ctx, "test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, p.Spec.Can(CapabilityWrite))
+
+	// the error includes the stderr of the plugin
+	err = p.Call(ctx, "check", &Request{Config: map[string]string{"token": "wrong"}}, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid token")
+	}
+	assert.NoError(t, p.Call(ctx, "check", &Request{Config: map[string]string{"token": "secret"}}, nil))
+
+	decoder, wait, err := p.Read(ctx, Request{Stream: "users"})
+	if assert.NoError(t, err) {
+		records := []map[string]any{}
+		for decoder.More() {
+			rec := map[string]any{}
+			if assert.NoError(t, decoder.Decode(&rec)) {
+				records = append(records, rec)
+			}
+		}
+		assert.NoError(t, wait())
+		if assert.Len(t, records, 2) {
+			assert.Equal(t, "Bob", records[1]["name"])
+		}
+	}
+
+	output := filepath.Join(t.TempDir(), "output.jsonl")
+	encoder, wait, err := p.Write(ctx, Request{Config: map[string]string{"output": output}, Stream: "users"})
+	if assert.NoError(t, err) {
+		assert.NoError(t, encoder.Encode(map[string]any{"id": 3}))
+		assert.NoError(t, wait())
+		content, _ := os.ReadFile(output)
+		assert.Equal(t, "{\"id\":3}\n", string(content))
+	}
+
+	assert.NoError(t, Remove("test"))
+	_, err = Get(ctx, "test")
+	assert.Error(t, err)
+	_, err = Get(ctx, "../test")
+	assert.Error(t, err)
+}
+
+func TestPluginInstall(t *testing.T) {
+	ctx := context.Background()
+	source := writeTestPlugin(t)
+	content, _ := os.ReadFile(source)
+	checksum := sha256.Sum256(content)
+
+	// the name is required, since the plugin is not run
+	_, err := Install(ctx, source, InstallOptions{})
+	assert.ErrorContains(t, err, "provide it with --name")
+
+	// only https URLs, with a checksum
+	_, err = Install(ctx, "http://example.com/sling-plugin-test", InstallOptions{SHA256: hex.EncodeToString(checksum[:])})
+	assert.ErrorContains(t, err, "https")
+	_, err = Install(ctx, "https://example.com/sling-plugin-test", InstallOptions{})
+	assert.ErrorContains(t, err, "sha256 checksum")
+
+	// not installed if the checksum does not match
+	_, err = Install(ctx, source, InstallOptions{Name: "test", SHA256: strings.Repeat("0", 64)})
+	assert.ErrorContains(t, err, "checksum mismatch")
+	assert.False(t, g.PathExists(filepath.Join(Dir(), "sling-plugin-test")))
+	entries, _ := os.ReadDir(Dir())
+	assert.Empty(t, entries)
+
+	// the name of the file
+	named := filepath.Join(t.TempDir(), "sling-plugin-users")
+	os.WriteFile(named, content, 0644)
+	p, err := Install(ctx, named, InstallOptions{SHA256: strings.ToUpper(hex.EncodeToString(checksum[:]))})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "users", p.Name)
+		info, err := os.Stat(p.Path)
+		if assert.NoError(t, err) {
+			assert.NotZero(t, info.Mode()&0100)
+		}
+	}
+}
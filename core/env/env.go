@@ -81,6 +81,14 @@ func HomeBinDir() string {
 	return path.Join(HomeDir, "bin")
 }
 
+// HomePluginDir returns the folder of the connector plugins
+func HomePluginDir() string {
+	if dir := os.Getenv("SLING_PLUGINS_DIR"); dir != "" {
+		return dir
+	}
+	return path.Join(HomeDir, "plugins")
+}
+
 func SetTelVal(key string, value any) {
 	TelMux.Lock()
 	TelMap[key] = value
@@ -105,8 +113,8 @@ func SetLogger() {
 		}
 	}
 
-	outputOut := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: "2006-01-02 15:04:05"}
-	outputErr := zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: "2006-01-02 15:04:05"}
+	outputOut := zerolog.ConsoleWriter{Out: secretsWriter{os.Stdout}, TimeFormat: "2006-01-02 15:04:05"}
+	outputErr := zerolog.ConsoleWriter{Out: secretsWriter{os.Stderr}, TimeFormat: "2006-01-02 15:04:05"}
 	outputOut.FormatErrFieldValue = func(i interface{}) string {
 		return fmt.Sprintf("%s", i)
 	}
@@ -124,12 +132,12 @@ func SetLogger() {
 		NoColor = true
 		zerolog.LevelFieldName = "lvl"
 		zerolog.MessageFieldName = "msg"
-		g.ZLogOut = zerolog.New(os.Stdout).With().Timestamp().Logger()
-		g.ZLogErr = zerolog.New(os.Stdout).With().Timestamp().Logger()
+		g.ZLogOut = zerolog.New(secretsWriter{os.Stdout}).With().Timestamp().Logger()
+		g.ZLogErr = zerolog.New(secretsWriter{os.Stdout}).With().Timestamp().Logger()
 	} else {
-		outputErr = zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: "3:04PM"}
+		outputErr = zerolog.ConsoleWriter{Out: secretsWriter{os.Stderr}, TimeFormat: "3:04PM"}
 		if g.IsDebugLow() {
-			outputErr = zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: "2006-01-02 15:04:05"}
+			outputErr = zerolog.ConsoleWriter{Out: secretsWriter{os.Stderr}, TimeFormat: "2006-01-02 15:04:05"}
 		}
 		g.ZLogOut = zerolog.New(outputErr).With().Timestamp().Logger()
 		g.ZLogErr = zerolog.New(outputErr).With().Timestamp().Logger()
@@ -354,8 +362,8 @@ func Clean(props map[string]string, line string) string {
 		if strings.TrimSpace(v) == "" {
 			continue
 		} else if g.In(k, "password", "access_key_id", "secret_access_key", "session_token", "aws_access_key_id", "aws_secret_access_key", "ssh_private_key", "ssh_passphrase", "sas_svc_url", "conn_str") {
-			line = strings.ReplaceAll(line, v, "***")
+			line = strings.ReplaceAll(line, v, SecretMask)
 		}
 	}
-	return line
+	return MaskSecrets(line)
 }
@@ -0,0 +1,114 @@
+package env
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SecretMask replaces the secret values in the logs
+const SecretMask = "***"
+
+var (
+	secretValues = []string{}
+	secretMux    sync.RWMutex
+)
+
+// minSecretSubstring is the length from which a secret value is masked
+// wherever it appears. Shorter values are only masked as whole words, to
+// not mask the same letters or digits in other words or numbers.
+const minSecretSubstring = 4
+
+// AddSecret registers a secret value (such as a secret env value), to be
+// masked in the logs
+func AddSecret(values ...string) {
+	secretMux.Lock()
+	defer secretMux.Unlock()
+
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+
+		found := false
+		for _, v := range secretValues {
+			if v == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			secretValues = append(secretValues, value)
+		}
+	}
+
+	// longest first, in case a secret contains another
+	sort.SliceStable(secretValues, func(i, j int) bool {
+		return len(secretValues[i]) > len(secretValues[j])
+	})
+}
+
+// MaskSecrets replaces the registered secret values in the text
+func MaskSecrets(text string) string {
+	secretMux.RLock()
+	defer secretMux.RUnlock()
+
+	for _, value := range secretValues {
+		if len(value) < minSecretSubstring {
+			text = replaceWord(text, value, SecretMask)
+			continue
+		}
+		text = strings.ReplaceAll(text, value, SecretMask)
+	}
+	return text
+}
+
+// replaceWord replaces the occurrences of the value which are not
+// preceded or followed by a letter, digit or underscore
+func replaceWord(text, value, replacement string) string {
+	isWordChar := func(r rune) bool {
+		return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+
+	var out strings.Builder
+	for {
+		i := strings.Index(text, value)
+		if i == -1 {
+			out.WriteString(text)
+			return out.String()
+		}
+
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		after, _ := utf8.DecodeRuneInString(text[i+len(value):])
+		out.WriteString(text[:i])
+		if (i > 0 && isWordChar(before)) || (i+len(value) < len(text) && isWordChar(after)) {
+			out.WriteString(value)
+		} else {
+			out.WriteString(replacement)
+		}
+		text = text[i+len(value):]
+	}
+}
+
+// secretsWriter masks the secret values of the log lines
+type secretsWriter struct {
+	out io.Writer
+}
+
+func (w secretsWriter) Write(p []byte) (n int, err error) {
+	secretMux.RLock()
+	noSecrets := len(secretValues) == 0
+	secretMux.RUnlock()
+
+	if noSecrets {
+		return w.out.Write(p)
+	}
+
+	if _, err = w.out.Write([]byte(MaskSecrets(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,133 @@
+package sling
+
+import (
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+)
+
+// AfterReadAction is the action applied to the source files once loaded
+type AfterReadAction string
+
+const (
+	// AfterReadDelete deletes the source files
+	AfterReadDelete AfterReadAction = "delete"
+	// AfterReadArchive moves the source files into a folder, keeping the sub-folders
+	AfterReadArchive AfterReadAction = "archive"
+	// AfterReadMove moves the source files into a folder, by file name
+	AfterReadMove AfterReadAction = "move"
+)
+
+// AfterRead is the parsed `after_read` source option, such as
+// `delete`, `archive://landing/archive/{YYYY}/{MM}/` or `move://processed/`.
+// The path is a folder of the source connection, and accepts date placeholders.
+type AfterRead struct {
+	Action AfterReadAction
+	Path   string
+}
+
+// ParseAfterRead parses the `after_read` source option
+func ParseAfterRead(val string) (ar AfterRead, err error) {
+	val = strings.TrimSpace(val)
+	action, path, _ := strings.Cut(val, "://")
+	ar = AfterRead{Action: AfterReadAction(strings.ToLower(action)), Path: path}
+
+	switch ar.Action {
+	case AfterReadDelete:
+		if path != "" {
+			return ar, g.Error("invalid source option after_read: %s (delete does not take a path)", val)
+		}
+	case AfterReadArchive, AfterReadMove:
+		if strings.Trim(path, "/") == "" {
+			return ar, g.Error("invalid source option after_read: %s (expected a folder, e.g. %s://processed/)", val, action)
+		}
+		if !strings.HasSuffix(ar.Path, "/") {
+			ar.Path = ar.Path + "/"
+		}
+	default:
+		return ar, g.Error("invalid source option after_read: %s (expected delete, archive://<path> or move://<path>)", val)
+	}
+
+	return ar, nil
+}
+
+// Destination returns the uri to move a file to, relative to the root folder
+func (ar AfterRead) Destination(fs filesys.FileSysClient, root, uri string, now time.Time) string {
+	folder := filesys.NormalizeURI(fs, g.Rm(ar.Path, iop.GetISO8601DateMap(now)))
+
+	relPath := uri[strings.LastIndex(uri, "/")+1:] // file name
+	if ar.Action == AfterReadArchive && strings.HasPrefix(uri, root) {
+		relPath = strings.TrimPrefix(strings.TrimPrefix(uri, root), "/")
+	}
+
+	return folder + relPath
+}
+
+// usesAfterRead returns true if the source files are processed once loaded
+func (t *TaskExecution) usesAfterRead() bool {
+	return t.Config.sourceIsFile() && !t.Config.Options.StdIn &&
+		g.PtrVal(t.Config.Source.Options).AfterRead != nil
+}
+
+// afterRead deletes or moves the files which were read, once the target
+// was written successfully.
+func (t *TaskExecution) afterRead() (err error) {
+	if !t.usesAfterRead() || len(t.readFiles) == 0 || t.readFs == nil {
+		return nil
+	}
+
+	ar, err := ParseAfterRead(*t.Config.Source.Options.AfterRead)
+	if err != nil {
+		return err
+	}
+
+	fs := t.readFs
+	uri := t.Config.SrcConn.URL()
+	root := filesys.GetDeepestParent(uri)
+	if !strings.ContainsAny(uri, "*?") && !strings.HasSuffix(uri, "/") && t.readFiles[0].URI != uri {
+		root = uri + "/" // folder without trailing slash
+	}
+
+	now := time.Now()
+	if ar.Action != AfterReadDelete {
+		if folder := ar.Destination(fs, root, root, now); strings.HasPrefix(folder, filesys.NormalizeURI(fs, root)) {
+			return g.Error("after_read folder %s cannot be within the source path %s", folder, root)
+		}
+	}
+
+	t.SetProgress("processing %d source files (after_read: %s)", len(t.readFiles), ar.Action)
+
+	eG := g.ErrorGroup{}
+	for _, file := range t.readFiles {
+		if ar.Action != AfterReadDelete {
+			dest := ar.Destination(fs, root, file.URI, now)
+
+			reader, err := fs.GetReader(file.URI)
+			if err != nil {
+				eG.Capture(g.Error(err, "could not read %s", file.URI))
+				continue
+			}
+
+			if _, err = fs.Write(dest, reader); err != nil {
+				eG.Capture(g.Error(err, "could not write %s", dest))
+				continue
+			}
+			g.Debug("copied %s to %s", file.URI, dest)
+		}
+
+		if err = filesys.Delete(fs, file.URI); err != nil {
+			eG.Capture(g.Error(err, "could not delete %s", file.URI))
+			continue
+		}
+		g.Trace("deleted %s", file.URI)
+	}
+
+	if err = eG.Err(); err != nil {
+		return g.Error(err, "could not %s source files after read", ar.Action)
+	}
+
+	return nil
+}
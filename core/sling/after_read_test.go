@@ -0,0 +1,40 @@
+package sling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAfterRead(t *testing.T) {
+	for _, val := range []string{"delete://x", "archive://", "move:///", "copy://x", "remove"} {
+		_, err := ParseAfterRead(val)
+		assert.Error(t, err, val)
+	}
+
+	ar, err := ParseAfterRead("DELETE")
+	assert.NoError(t, err)
+	assert.Equal(t, AfterReadDelete, ar.Action)
+
+	fs, err := filesys.NewFileSysClient(dbio.TypeFileLocal)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	now := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	root := "file:///data/landing/"
+	uri := "file:///data/landing/2024/orders.csv"
+
+	ar, err = ParseAfterRead("archive:///data/archive/{YYYY}{MM}")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "file:///data/archive/202403/2024/orders.csv", ar.Destination(fs, root, uri, now))
+	}
+
+	ar, err = ParseAfterRead("move:///data/processed/")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "file:///data/processed/orders.csv", ar.Destination(fs, root, uri, now))
+	}
+}
@@ -0,0 +1,290 @@
+package sling
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/flarco/g"
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v2"
+)
+
+// BackfillOptions are the options of a chunked backfill (`sling backfill`)
+type BackfillOptions struct {
+	Streams     []string // the streams to backfill (names or patterns), all if empty
+	Range       string   // the range of the update key, e.g. `2019-01-01:2024-01-01`
+	ChunkSize   string   // the size of the chunks, e.g. `1mon`, `7d` or `100000`
+	Concurrency int      // the number of chunks running in parallel
+}
+
+// BackfillChunk is a chunk of a backfill, run as a stream
+type BackfillChunk struct {
+	Stream    string `json:"stream" yaml:"stream"` // the original stream
+	Name      string `json:"name" yaml:"name"`     // the stream name of the chunk
+	Object    string `json:"object" yaml:"object"`
+	UpdateKey string `json:"update_key" yaml:"update_key"`
+	Range     string `json:"range" yaml:"range"`
+	TableTmp  string `json:"table_tmp,omitempty" yaml:"table_tmp,omitempty"`
+	Status    string `json:"status,omitempty" yaml:"status,omitempty"`
+	Error     string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// BackfillPlan is the chunks of a backfill, in run order. The chunks
+// completed by a previous (interrupted) run are skipped.
+type BackfillPlan struct {
+	Source      string           `json:"source" yaml:"source"`
+	Target      string           `json:"target" yaml:"target"`
+	Range       string           `json:"range,omitempty" yaml:"range,omitempty"`
+	ChunkSize   string           `json:"chunk_size,omitempty" yaml:"chunk_size,omitempty"`
+	Concurrency int              `json:"concurrency" yaml:"concurrency"`
+	Completed   int              `json:"completed" yaml:"completed"` // chunks completed previously
+	Chunks      []*BackfillChunk `json:"chunks" yaml:"chunks"`
+
+	tasks []*Config
+}
+
+// parseBackfillRange returns the range as `start,end`. The `start:end` form
+// is accepted when the values have no colons (e.g. dates or integers).
+func parseBackfillRange(rangeStr string) (string, error) {
+	rangeStr = strings.TrimSpace(rangeStr)
+	switch {
+	case rangeStr == "", strings.Contains(rangeStr, ","):
+		return rangeStr, nil
+	case strings.Count(rangeStr, ":") == 1:
+		return strings.Replace(rangeStr, ":", ",", 1), nil
+	}
+	return "", g.Error("invalid range (%s), expected start:end or start,end (such as 2019-01-01:2024-01-01)", rangeStr)
+}
+
+// PlanBackfill sets the selected streams in chunked backfill mode and
+// compiles the replication into the chunks to run. The streams need an
+// update key, and the source and target must be databases.
+func (rd *ReplicationConfig) PlanBackfill(opts BackfillOptions) (plan *BackfillPlan, err error) {
+	if rd.Compiled {
+		return nil, g.Error("cannot plan the backfill of a compiled replication")
+	}
+
+	rangeStr, err := parseBackfillRange(opts.Range)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = rd.ProcessWildcards(); err != nil {
+		return nil, g.Error(err, "could not process streams using wildcard")
+	}
+
+	// the streams to backfill
+	selected := map[string]bool{}
+	if len(opts.Streams) == 0 {
+		for _, name := range rd.streamsOrdered {
+			selected[name] = true
+		}
+	}
+	for _, pattern := range opts.Streams {
+		matches := rd.MatchStreams(pattern)
+		if len(matches) == 0 {
+			return nil, g.Error("did not match any stream: %s", pattern)
+		}
+		for name := range matches {
+			selected[name] = true
+		}
+	}
+
+	// set the streams in chunked backfill mode
+	for name := range selected {
+		// the chunk size of the stream (or defaults) if not provided
+		s := ReplicationStreamConfig{}
+		if rd.Streams[name] != nil {
+			s = *rd.Streams[name]
+		}
+		SetStreamDefaults(name, &s, *rd)
+
+		chunkSize := opts.ChunkSize
+		if chunkSize == "" {
+			chunkSize = cast.ToString(g.PtrVal(s.SourceOptions).ChunkSize)
+		}
+		if chunkSize == "" {
+			return nil, g.Error("did not provide a chunk size for the backfill of stream: %s", name)
+		}
+		if len(s.PrimaryKey()) == 0 || s.UpdateKey == "" {
+			return nil, g.Error("the backfill of stream %s requires a primary_key and an update_key", name)
+		}
+
+		stream := rd.Streams[name]
+		if stream == nil {
+			stream = &ReplicationStreamConfig{}
+			rd.Streams[name] = stream
+		}
+		if stream.SourceOptions == nil {
+			stream.SourceOptions = g.Ptr(g.PtrVal(s.SourceOptions))
+		}
+		stream.Mode = BackfillMode
+		stream.SourceOptions.ChunkSize = chunkSize
+		if rangeStr != "" {
+			stream.SourceOptions.Range = g.Ptr(rangeStr)
+		}
+
+		// provided keys take precedence over the defaults
+		if rd.maps.Streams == nil {
+			rd.maps.Streams = map[string]map[string]any{}
+		}
+		if rd.maps.Streams[name] == nil {
+			rd.maps.Streams[name] = g.M()
+		}
+		rd.maps.Streams[name]["mode"] = string(BackfillMode)
+	}
+
+	rd.backfill = true
+	if err = rd.Compile(nil); err != nil {
+		return nil, g.Error(err, "could not compile the backfill")
+	}
+
+	plan = &BackfillPlan{
+		Source:      rd.Source,
+		Target:      rd.Target,
+		Range:       rangeStr,
+		ChunkSize:   opts.ChunkSize,
+		Concurrency: max(1, opts.Concurrency),
+	}
+
+	// keep the chunks of the selected streams
+	counted := map[*ChunkCheckpoint]bool{}
+	for _, task := range rd.Tasks {
+		checkpoint, ok := rd.checkpoints[task.StreamName]
+		if !ok || !selected[checkpoint.Stream] {
+			continue
+		} else if task.ReplicationStream != nil && task.ReplicationStream.Disabled {
+			continue
+		}
+
+		if !counted[checkpoint] {
+			plan.Completed += len(checkpoint.Completed)
+			counted[checkpoint] = true
+		}
+
+		plan.Chunks = append(plan.Chunks, &BackfillChunk{
+			Stream:    checkpoint.Stream,
+			Name:      task.StreamName,
+			Object:    task.Target.Object,
+			UpdateKey: task.Source.UpdateKey,
+			Range:     g.PtrVal(g.PtrVal(task.Source.Options).Range),
+			TableTmp:  g.PtrVal(task.Target.Options).TableTmp,
+		})
+		plan.tasks = append(plan.tasks, task)
+	}
+	rd.Tasks = plan.tasks
+
+	return plan, nil
+}
+
+// RunBackfill runs the chunks of the plan, several in parallel (the plan
+// concurrency). The chunks of a stream merge into the same target table, so
+// they run one at a time. Each completed chunk is checkpointed, so that
+// running the backfill again resumes with the pending chunks.
+func (rd *ReplicationConfig) RunBackfill(ctx context.Context, plan *BackfillPlan) error {
+	runCtx := g.NewContext(ctx, plan.Concurrency)
+	eG := g.ErrorGroup{}
+	stopped := false
+
+	objectMux := map[string]*sync.Mutex{}
+	for _, chunk := range plan.Chunks {
+		if objectMux[chunk.Object] == nil {
+			objectMux[chunk.Object] = &sync.Mutex{}
+		}
+	}
+
+	for i, cfg := range plan.tasks {
+		chunk := plan.Chunks[i]
+
+		runCtx.Wg.Write.Add()
+		runCtx.Lock()
+		stop := stopped || runCtx.Ctx.Err() != nil
+		runCtx.Unlock()
+		if stop {
+			runCtx.Wg.Write.Done()
+			break
+		}
+
+		g.Info("[%d / %d] running %s (range %s)", i+1, len(plan.tasks), chunk.Name, chunk.Range)
+
+		go func(cfg *Config, chunk *BackfillChunk) {
+			defer runCtx.Wg.Write.Done()
+
+			objectMux[chunk.Object].Lock()
+			defer objectMux[chunk.Object].Unlock()
+
+			runCtx.Lock()
+			stop := stopped || runCtx.Ctx.Err() != nil
+			runCtx.Unlock()
+			if stop {
+				return // stopped while waiting for the previous chunk
+			}
+
+			task := NewTask(os.Getenv("SLING_EXEC_ID"), cfg)
+			task.Replication = rd
+
+			// the tasks share the lock of the replication state
+			task.Context = g.NewContext(runCtx.Ctx)
+			task.Context.Mux = runCtx.Mux
+
+			err := task.Err
+			if err == nil {
+				err = task.Execute()
+				task.RecordHistory()
+			}
+
+			runCtx.Lock()
+			defer runCtx.Unlock()
+
+			chunk.Status = string(task.Status)
+			if err != nil {
+				chunk.Status = string(ExecStatusError)
+				chunk.Error = g.ErrMsgSimple(err)
+				if rd.FailsRun(cfg) {
+					eG.Capture(err, chunk.Name)
+				}
+				if rd.StopAfterFailure(cfg) {
+					g.Warn("stopping the backfill after failure of %s (on_failure: fail_fast)", chunk.Name)
+					stopped = true
+				}
+			}
+		}(cfg, chunk)
+	}
+
+	runCtx.Wg.Write.Wait()
+
+	if err := eG.Err(); err != nil {
+		return g.Error(err, "backfill failed")
+	} else if runCtx.Ctx.Err() != nil {
+		return g.Error("backfill interrupted, run again to resume with the pending chunks")
+	}
+	return nil
+}
+
+// Pending returns the number of chunks not run (or failed)
+func (plan *BackfillPlan) Pending() (count int) {
+	for _, chunk := range plan.Chunks {
+		if chunk.Status != string(ExecStatusSuccess) {
+			count++
+		}
+	}
+	return count
+}
+
+// WriteFile exports the plan to a JSON or YAML file (by extension)
+func (plan *BackfillPlan) WriteFile(path string) (err error) {
+	content := []byte(g.Pretty(plan))
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".json" {
+		if content, err = yaml.Marshal(plan); err != nil {
+			return g.Error(err, "could not marshal backfill plan")
+		}
+	}
+
+	if err = os.WriteFile(path, content, 0644); err != nil {
+		return g.Error(err, "could not write backfill plan: %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package sling
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBackfillRange(t *testing.T) {
+	for text, expected := range map[string]string{
+		"2019-01-01:2024-01-01": "2019-01-01,2024-01-01",
+		"1:1000":                "1,1000",
+		"2019-01-01 00:00:00,2024-01-01 00:00:00": "2019-01-01 00:00:00,2024-01-01 00:00:00",
+		"": "",
+	} {
+		actual, err := parseBackfillRange(text)
+		if assert.NoError(t, err, text) {
+			assert.Equal(t, expected, actual, text)
+		}
+	}
+
+	_, err := parseBackfillRange("2019-01-01")
+	assert.Error(t, err)
+}
+
+func TestBackfill(t *testing.T) {
+	folder := t.TempDir()
+	dbURL := "sqlite://" + filepath.Join(folder, "backfill.db")
+	t.Setenv("BACKFILL_SQLITE", dbURL)
+	t.Setenv("SLING_CHECKPOINT_FOLDER", filepath.Join(folder, "checkpoints"))
+	connection.GetLocalConns(true) // refresh the cached connections
+
+	conn, err := database.NewConn(dbURL)
+	if !assert.NoError(t, err) || !assert.NoError(t, conn.Connect()) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecMulti(`
+		create table orders (id integer, name text);
+		insert into orders
+			with recursive c(id) as (select 1 union all select id + 1 from c limit 25)
+			select id, 'order ' || id from c;
+		create table users as select 1 as id, 'a' as name;
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	replicationYaml := `
+source: BACKFILL_SQLITE
+target: BACKFILL_SQLITE
+defaults:
+  mode: full-refresh
+  object: main.{stream_table}_copy
+  primary_key: id
+  update_key: id
+streams:
+  main.orders:
+  main.users:
+`
+	plan := func(opts BackfillOptions) (*ReplicationConfig, *BackfillPlan) {
+		replication, err := LoadReplicationConfig(replicationYaml)
+		if !assert.NoError(t, err) {
+			return nil, nil
+		}
+		plan, err := replication.PlanBackfill(opts)
+		if !assert.NoError(t, err) {
+			return nil, nil
+		}
+		return &replication, plan
+	}
+
+	// only the selected streams are chunked
+	replication, backfill := plan(BackfillOptions{Streams: []string{"main.orders"}, Range: "1:25", ChunkSize: "10", Concurrency: 2})
+	if backfill == nil {
+		return
+	}
+	assert.Equal(t, 2, backfill.Concurrency)
+	if assert.Len(t, backfill.Chunks, 3) {
+		assert.Equal(t, "main.orders", backfill.Chunks[0].Stream)
+		assert.Equal(t, "1,10", backfill.Chunks[0].Range)
+		assert.Equal(t, "21,25", backfill.Chunks[2].Range)
+		assert.Equal(t, "id", backfill.Chunks[2].UpdateKey)
+	}
+	assert.Len(t, replication.Tasks, 3)
+
+	// the plan can be exported
+	planPath := filepath.Join(folder, "plan.yaml")
+	if assert.NoError(t, backfill.WriteFile(planPath)) {
+		content, _ := os.ReadFile(planPath)
+		assert.Contains(t, string(content), "range: 21,25")
+	}
+
+	// a completed chunk of a previous run is skipped
+	if assert.NoError(t, replication.CheckpointChunk(backfill.Chunks[0].Name, backfill.Chunks[0].Range)) {
+		replication, backfill = plan(BackfillOptions{Streams: []string{"main.orders"}, Range: "1:25", ChunkSize: "10", Concurrency: 2})
+		if backfill == nil {
+			return
+		}
+		assert.Equal(t, 1, backfill.Completed)
+		assert.Len(t, backfill.Chunks, 2)
+	}
+
+	// the backfill checkpoints are apart from those of the replication runs
+	if assert.Len(t, replication.checkpoints, 2) {
+		replicationCheckpoint, err := LoadChunkCheckpoint(
+			"main.orders", "1,25", "10", "BACKFILL_SQLITE", "BACKFILL_SQLITE", "main.{stream_table}_copy", "id",
+		)
+		if assert.NoError(t, err) {
+			assert.Empty(t, replicationCheckpoint.Completed)
+			assert.NotEqual(t, replicationCheckpoint.path, replication.checkpoints[backfill.Chunks[0].Name].path)
+		}
+	}
+
+	// the pending chunks run (one at a time, into the same table), and the
+	// checkpoint is removed
+	if assert.NoError(t, replication.RunBackfill(context.Background(), backfill)) {
+		assert.Zero(t, backfill.Pending())
+		data, err := conn.Query("select count(*) as cnt from orders_copy")
+		if assert.NoError(t, err) {
+			assert.EqualValues(t, 15, cast.ToInt(data.Rows[0][0]))
+		}
+		files, _ := filepath.Glob(filepath.Join(folder, "checkpoints", "*.json"))
+		assert.Empty(t, files)
+	}
+
+	// a chunk size and keys are required
+	cases := []struct {
+		opts    BackfillOptions
+		message string
+	}{
+		{BackfillOptions{Streams: []string{"main.users"}}, "chunk size"},
+		{BackfillOptions{Streams: []string{"main.unknown"}, ChunkSize: "10"}, "did not match any stream"},
+		{BackfillOptions{Streams: []string{"main.users"}, ChunkSize: "10", Range: "1-5"}, "invalid range"},
+	}
+	for _, c := range cases {
+		replication, err := LoadReplicationConfig(replicationYaml)
+		if assert.NoError(t, err) {
+			_, err = replication.PlanBackfill(c.opts)
+			assert.ErrorContains(t, err, c.message)
+		}
+	}
+
+	noKeys, err := LoadReplicationConfig(strings.Replace(replicationYaml, "  primary_key: id\n", "", 1))
+	if assert.NoError(t, err) {
+		_, err = noKeys.PlanBackfill(BackfillOptions{ChunkSize: "10"})
+		assert.ErrorContains(t, err, "requires a primary_key")
+	}
+}
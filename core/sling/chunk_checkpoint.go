@@ -0,0 +1,113 @@
+package sling
+
+import (
+	"os"
+	"path"
+	"sync"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/env"
+)
+
+// ChunkCheckpoint tracks the completed chunks of a chunked backfill stream,
+// so that an interrupted backfill resumes where it left off.
+// It is stored in the sling home directory and removed once all chunks complete.
+type ChunkCheckpoint struct {
+	Stream    string   `json:"stream"`
+	Range     string   `json:"range"`
+	ChunkSize string   `json:"chunk_size"`
+	Chunks    []string `json:"chunks"`    // all chunk ranges
+	Completed []string `json:"completed"` // completed chunk ranges
+
+	path string
+	mux  sync.Mutex
+}
+
+// chunkCheckpointFolder returns the folder where checkpoints are stored
+func chunkCheckpointFolder() string {
+	if val := os.Getenv("SLING_CHECKPOINT_FOLDER"); val != "" {
+		return val
+	}
+	return path.Join(env.HomeDir, "checkpoints")
+}
+
+// LoadChunkCheckpoint loads the checkpoint for the backfill, identified by its key
+// values (connections, stream, range, chunk size...). A new one is returned if not found.
+func LoadChunkCheckpoint(stream, rangeStr, chunkSize string, keyValues ...string) (cp *ChunkCheckpoint, err error) {
+	key := g.MD5(append([]string{stream, rangeStr, chunkSize}, keyValues...)...)
+	cp = &ChunkCheckpoint{
+		Stream:    stream,
+		Range:     rangeStr,
+		ChunkSize: chunkSize,
+		path:      path.Join(chunkCheckpointFolder(), "backfill_"+key+".json"),
+	}
+
+	if !g.PathExists(cp.path) {
+		return cp, nil
+	}
+
+	bytes, err := os.ReadFile(cp.path)
+	if err != nil {
+		return cp, g.Error(err, "could not read checkpoint file: %s", cp.path)
+	} else if err = g.Unmarshal(string(bytes), cp); err != nil {
+		return cp, g.Error(err, "could not parse checkpoint file: %s", cp.path)
+	}
+
+	return cp, nil
+}
+
+// Pending returns the chunks which have not completed.
+// If the chunks differ from the saved ones, the checkpoint is reset.
+func (cp *ChunkCheckpoint) Pending(chunks []string) (pending []string) {
+	cp.mux.Lock()
+	defer cp.mux.Unlock()
+
+	if g.Marshal(cp.Chunks) != g.Marshal(chunks) {
+		cp.Chunks = chunks
+		cp.Completed = []string{}
+	}
+
+	completed := g.ArrMapString(cp.Completed)
+	for _, chunk := range chunks {
+		if _, done := completed[chunk]; !done {
+			pending = append(pending, chunk)
+		}
+	}
+
+	// all chunks were completed previously, start over
+	if len(pending) == 0 {
+		cp.Completed = []string{}
+		return chunks
+	}
+
+	return pending
+}
+
+// MarkCompleted records the chunk range as completed. The checkpoint file
+// is deleted when all chunks are completed.
+func (cp *ChunkCheckpoint) MarkCompleted(chunk string) (err error) {
+	cp.mux.Lock()
+	defer cp.mux.Unlock()
+
+	if !lo.Contains(cp.Completed, chunk) {
+		cp.Completed = append(cp.Completed, chunk)
+	}
+
+	if len(lo.Intersect(cp.Chunks, cp.Completed)) == len(cp.Chunks) {
+		g.Debug("all %d chunks completed for %s", len(cp.Chunks), cp.Stream)
+		if err = os.Remove(cp.path); err != nil && !os.IsNotExist(err) {
+			return g.Error(err, "could not delete checkpoint file: %s", cp.path)
+		}
+		return nil
+	}
+
+	if err = os.MkdirAll(path.Dir(cp.path), 0755); err != nil {
+		return g.Error(err, "could not create checkpoint folder")
+	} else if err = os.WriteFile(cp.path, []byte(g.Marshal(cp)), 0644); err != nil {
+		return g.Error(err, "could not write checkpoint file: %s", cp.path)
+	}
+
+	g.Debug("checkpoint: %d / %d chunks completed for %s", len(cp.Completed), len(cp.Chunks), cp.Stream)
+	return nil
+}
@@ -0,0 +1,139 @@
+package sling
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
+)
+
+// TempTable is a temp table created in a target connection. It is recorded
+// until dropped, so that the orphaned ones (of killed processes) can be
+// removed with `sling cleanup`.
+type TempTable struct {
+	Conn      string    `json:"conn"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TempTableSet records a created temp table.
+// Set by the store, which persists them in the local sling database.
+var TempTableSet = func(table TempTable) (err error) {
+	return nil
+}
+
+// TempTableDelete removes the record of a dropped temp table
+var TempTableDelete = func(conn, name string) (err error) {
+	return nil
+}
+
+// TempTableList returns the recorded temp tables of a connection
+var TempTableList = func(conn string) (tables []TempTable, err error) {
+	return nil, g.Error("temp table records are not available")
+}
+
+// CleanupOptions are the options to remove orphaned temp objects
+type CleanupOptions struct {
+	Conn      string        // connection name
+	OlderThan time.Duration // only objects created (or modified) before
+	DryRun    bool          // list the objects, without removing them
+}
+
+// CleanupResult lists the removed temp objects
+type CleanupResult struct {
+	Tables []string `json:"tables"` // temp tables
+	Files  []string `json:"files"`  // staging files
+}
+
+// CleanupTempObjects removes the orphaned temp objects of a connection,
+// older than `OlderThan`: the recorded temp tables and the files in the
+// staging folder of a database, or the files in the staging folder of a
+// storage connection.
+func CleanupTempObjects(opts CleanupOptions) (result CleanupResult, err error) {
+	conn := connection.GetLocalConns().Get(opts.Conn)
+	if conn.Name == "" {
+		return result, g.Error("did not find connection %s", opts.Conn)
+	}
+	cutoff := time.Now().Add(-opts.OlderThan)
+
+	if conn.Connection.Type.IsFile() {
+		fs, err := conn.Connection.AsFile()
+		if err != nil {
+			return result, g.Error(err, "could not initiate %s", conn.Name)
+		}
+
+		folder := g.F("%s/%s/", strings.TrimSuffix(conn.Connection.URL(), "/"), database.TempCloudFolder(fs.GetProp("temp_cloud_folder")))
+		result.Files, err = cleanupFolder(fs, folder, cutoff, opts.DryRun)
+		return result, err
+	}
+
+	dbConn, err := conn.Connection.AsDatabase()
+	if err != nil {
+		return result, g.Error(err, "could not initiate %s", conn.Name)
+	} else if err = dbConn.Connect(); err != nil {
+		return result, g.Error(err, "could not connect to %s", conn.Name)
+	}
+	defer dbConn.Close()
+
+	tables, err := TempTableList(conn.Name)
+	if err != nil {
+		return result, g.Error(err, "could not list temp tables of %s", conn.Name)
+	}
+	for _, table := range tables {
+		if table.CreatedAt.After(cutoff) {
+			continue // could be in use
+		}
+
+		if !opts.DryRun {
+			if err = dbConn.DropTable(table.Name); err != nil {
+				g.Warn("could not drop temp table %s: %s", table.Name, err.Error())
+				continue
+			} else if err = TempTableDelete(conn.Name, table.Name); err != nil {
+				g.Warn("could not delete record of temp table %s: %s", table.Name, err.Error())
+			}
+		}
+		result.Tables = append(result.Tables, table.Name)
+	}
+
+	if stagingType, stagingURL := preflightStaging(dbConn); stagingURL != "" {
+		fs, err := filesys.NewFileSysClient(stagingType, dbConn.Base().PropArrExclude("url")...)
+		if err != nil {
+			return result, g.Error(err, "could not init staging connection")
+		}
+		result.Files, err = cleanupFolder(fs, stagingURL, cutoff, opts.DryRun)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// cleanupFolder deletes the files of the folder modified before the cutoff
+func cleanupFolder(fs filesys.FileSysClient, folder string, cutoff time.Time, dryRun bool) (files []string, err error) {
+	nodes, err := fs.ListRecursive(folder)
+	if err != nil {
+		return nil, g.Error(err, "could not list staging folder %s", folder)
+	}
+
+	for _, node := range nodes {
+		if node.IsDir || node.Updated == 0 || time.Unix(node.Updated, 0).After(cutoff) {
+			continue
+		}
+
+		if !dryRun {
+			if err = filesys.Delete(fs, node.URI); err != nil {
+				g.Warn("could not delete staging file %s: %s", node.URI, err.Error())
+				continue
+			}
+		}
+		files = append(files, node.URI)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
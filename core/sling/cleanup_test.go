@@ -0,0 +1,101 @@
+package sling
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanupTempObjects(t *testing.T) {
+	folder := t.TempDir()
+	dbURL := "sqlite://" + filepath.Join(folder, "cleanup.db")
+	t.Setenv("CLEANUP_SQLITE", dbURL)
+	t.Setenv("CLEANUP_LOCAL", "file://"+folder)
+	connection.GetLocalConns(true) // refresh the cached connections
+
+	// in-memory records of the temp tables
+	records := map[string]TempTable{}
+	origSet, origDelete, origList := TempTableSet, TempTableDelete, TempTableList
+	defer func() { TempTableSet, TempTableDelete, TempTableList = origSet, origDelete, origList }()
+	TempTableSet = func(table TempTable) error {
+		records[table.Name] = table
+		return nil
+	}
+	TempTableDelete = func(conn, name string) error {
+		delete(records, name)
+		return nil
+	}
+	TempTableList = func(conn string) (tables []TempTable, err error) {
+		for _, table := range records {
+			tables = append(tables, table)
+		}
+		return tables, nil
+	}
+
+	conn, err := database.NewConn(dbURL)
+	if !assert.NoError(t, err) || !assert.NoError(t, conn.Connect()) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecMulti(`create table orphan_tmp (id integer)`, `create table running_tmp (id integer)`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	TempTableSet(TempTable{Conn: "CLEANUP_SQLITE", Name: `"main"."orphan_tmp"`, CreatedAt: time.Now().Add(-48 * time.Hour)})
+	TempTableSet(TempTable{Conn: "CLEANUP_SQLITE", Name: `"main"."running_tmp"`, CreatedAt: time.Now()})
+
+	opts := CleanupOptions{Conn: "CLEANUP_SQLITE", OlderThan: 24 * time.Hour, DryRun: true}
+	result, err := CleanupTempObjects(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`"main"."orphan_tmp"`}, result.Tables)
+	assert.Len(t, records, 2)
+
+	opts.DryRun = false
+	result, err = CleanupTempObjects(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`"main"."orphan_tmp"`}, result.Tables)
+	assert.Len(t, records, 1)
+
+	data, err := conn.Query(`select name from sqlite_master where type = 'table' order by name`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"running_tmp"}, data.ColValuesStr(0))
+
+	// staging files of a storage connection
+	staging := filepath.Join(folder, database.TempCloudFolder(""))
+	assert.NoError(t, os.MkdirAll(staging, 0755))
+	oldFile, newFile := filepath.Join(staging, "old.csv"), filepath.Join(staging, "new.csv")
+	assert.NoError(t, os.WriteFile(oldFile, []byte("a\n1\n"), 0644))
+	assert.NoError(t, os.WriteFile(newFile, []byte("a\n1\n"), 0644))
+	assert.NoError(t, os.Chtimes(oldFile, time.Now().Add(-48*time.Hour), time.Now().Add(-48*time.Hour)))
+
+	result, err = CleanupTempObjects(CleanupOptions{Conn: "CLEANUP_LOCAL", OlderThan: 24 * time.Hour})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Files, 1) {
+		assert.Contains(t, result.Files[0], "old.csv")
+	}
+	assert.NoFileExists(t, oldFile)
+	assert.FileExists(t, newFile)
+
+	_, err = CleanupTempObjects(CleanupOptions{Conn: "CLEANUP_MISSING"})
+	assert.ErrorContains(t, err, "did not find connection")
+}
+
+func TestMakeTempTableName(t *testing.T) {
+	table := database.Table{Schema: "public", Name: "Orders", Dialect: dbio.TypeDbPostgres}
+
+	prefix, suffix := (*TargetOptions)(nil).tempTableAffixes()
+	assert.Equal(t, "orders_tmp", makeTempTableName(dbio.TypeDbPostgres, table, prefix, suffix).Name)
+
+	options := &TargetOptions{TempTablePrefix: g.String("_sling_"), TempTableSuffix: g.String("")}
+	prefix, suffix = options.tempTableAffixes()
+	assert.Equal(t, "_sling_orders", makeTempTableName(dbio.TypeDbPostgres, table, prefix, suffix).Name)
+	assert.Equal(t, "_SLING_ORDERS_STAGE", makeTempTableName(dbio.TypeDbSnowflake, table, prefix, "_stage").Name)
+}
@@ -52,6 +52,140 @@ var AllMode = []struct {
 	{BackfillMode, "BackfillMode"},
 }
 
+// LoadMethod is the method used to load data into a database target
+type LoadMethod string
+
+const (
+	// LoadMethodDefault uses the bulk loader of the target (or batched inserts)
+	LoadMethodDefault LoadMethod = "default"
+	// LoadMethodStreaming uses Snowflake Snowpipe Streaming
+	LoadMethodStreaming LoadMethod = "streaming"
+	// LoadMethodStorageWrite uses the BigQuery Storage Write API
+	LoadMethodStorageWrite LoadMethod = "storage_write"
+)
+
+// Validate checks the load method against the target type
+func (lm LoadMethod) Validate(tgtType dbio.Type) error {
+	switch LoadMethod(strings.ToLower(string(lm))) {
+	case "", LoadMethodDefault:
+		return nil
+	case LoadMethodStreaming:
+		if tgtType != dbio.TypeDbSnowflake {
+			return g.Error("load_method `streaming` is only supported for Snowflake targets")
+		}
+		return nil
+	case LoadMethodStorageWrite:
+		if tgtType != dbio.TypeDbBigQuery {
+			return g.Error("load_method `storage_write` is only supported for BigQuery targets")
+		}
+		return nil
+	}
+	return g.Error("invalid load_method value (%s)", lm)
+}
+
+// CommitStrategy is how the loaded data (in the temp table) is committed
+// into the target table
+type CommitStrategy string
+
+const (
+	// CommitStrategyAtomicSwap swaps the loaded temp table with the target
+	// table, so that readers never see a half-loaded table (full-refresh)
+	CommitStrategyAtomicSwap CommitStrategy = "atomic_swap"
+	// CommitStrategyTruncateInsert keeps the target table (and its grants),
+	// truncating it before inserting, instead of dropping it (full-refresh)
+	CommitStrategyTruncateInsert CommitStrategy = "truncate_insert"
+	// CommitStrategyAppendOnly only inserts into the target table, which
+	// is never dropped, truncated or merged into
+	CommitStrategyAppendOnly CommitStrategy = "append_only"
+)
+
+// Validate checks the commit strategy against the target type and mode
+func (cs CommitStrategy) Validate(tgtType dbio.Type, mode Mode) error {
+	switch CommitStrategy(strings.ToLower(string(cs))) {
+	case "":
+		return nil
+	case CommitStrategyAtomicSwap:
+		if !g.In(tgtType, dbio.TypeDbSnowflake, dbio.TypeDbPostgres, dbio.TypeDbGreenplum, dbio.TypeDbRedshift, dbio.TypeDbMySQL, dbio.TypeDbMariaDB, dbio.TypeDbTiDB, dbio.TypeDbSQLite, dbio.TypeDbDuckDb) {
+			return g.Error("commit_strategy `atomic_swap` is not supported for %s targets", tgtType)
+		} else if !g.In(mode, FullRefreshMode, TruncateMode) {
+			return g.Error("commit_strategy `atomic_swap` is only supported with the full-refresh and truncate modes")
+		}
+		return nil
+	case CommitStrategyTruncateInsert:
+		if !g.In(mode, FullRefreshMode, TruncateMode) {
+			return g.Error("commit_strategy `truncate_insert` is only supported with the full-refresh and truncate modes")
+		}
+		return nil
+	case CommitStrategyAppendOnly:
+		if mode == TruncateMode {
+			return g.Error("commit_strategy `append_only` is not supported with the truncate mode")
+		}
+		return nil
+	}
+	return g.Error("invalid commit_strategy value (%s). Expected atomic_swap, truncate_insert or append_only", cs)
+}
+
+// ColumnChanges is the policy applied when source columns are added,
+// removed or change type compared to the target table
+type ColumnChanges string
+
+const (
+	// ColumnChangesAdd adds new columns to the target table
+	ColumnChangesAdd ColumnChanges = "add"
+	// ColumnChangesAlter adds new columns and widens column types
+	ColumnChangesAlter ColumnChanges = "alter"
+	// ColumnChangesIgnore keeps the target schema, dropping new source columns
+	ColumnChangesIgnore ColumnChanges = "ignore"
+	// ColumnChangesError fails when the source schema differs from the target
+	ColumnChangesError ColumnChanges = "error"
+)
+
+// Validate checks that the policy is known
+func (cc ColumnChanges) Validate() error {
+	if !g.In(cc, ColumnChangesAdd, ColumnChangesAlter, ColumnChangesIgnore, ColumnChangesError) {
+		return g.Error("invalid column_changes value (%s). Expected add, alter, ignore or error", cc)
+	}
+	return nil
+}
+
+// IdentifierCasing is the casing of the identifiers (table & column names)
+// created in the target database
+type IdentifierCasing string
+
+const (
+	// IdentifierCasingPreserve keeps the casing of the names (default)
+	IdentifierCasingPreserve IdentifierCasing = "preserve"
+	// IdentifierCasingUpper makes the names upper case
+	IdentifierCasingUpper IdentifierCasing = "upper"
+	// IdentifierCasingLower makes the names lower case
+	IdentifierCasingLower IdentifierCasing = "lower"
+	// IdentifierCasingSnake makes the names snake case, in the casing of
+	// the target database
+	IdentifierCasingSnake IdentifierCasing = "snake_case"
+)
+
+// Validate checks that the casing is known
+func (ic IdentifierCasing) Validate() error {
+	switch IdentifierCasing(strings.ToLower(string(ic))) {
+	case IdentifierCasingPreserve, IdentifierCasingUpper, IdentifierCasingLower, IdentifierCasingSnake:
+		return nil
+	}
+	return g.Error("invalid identifier_casing value (%s). Expected preserve, upper, lower or snake_case", ic)
+}
+
+// ColumnCasing returns the equivalent column casing
+func (ic IdentifierCasing) ColumnCasing() iop.ColumnCasing {
+	switch IdentifierCasing(strings.ToLower(string(ic))) {
+	case IdentifierCasingUpper:
+		return iop.UpperColumnCasing
+	case IdentifierCasingLower:
+		return iop.LowerColumnCasing
+	case IdentifierCasingSnake:
+		return iop.SnakeColumnCasing
+	}
+	return iop.SourceColumnCasing
+}
+
 // NewConfig return a config object from a YAML / JSON string
 func NewConfig(cfgStr string) (cfg *Config, err error) {
 	// set default, unmarshalling will overwrite
@@ -138,7 +272,7 @@ func (cfg *Config) SetDefault() {
 
 	// set default transforms
 	switch cfg.SrcConn.Type {
-	case dbio.TypeDbMySQL, dbio.TypeDbMariaDB, dbio.TypeDbStarRocks:
+	case dbio.TypeDbMySQL, dbio.TypeDbMariaDB, dbio.TypeDbSingleStore, dbio.TypeDbTiDB, dbio.TypeDbStarRocks:
 		// parse_bit for MySQL
 		cfg.extraTransforms = append(cfg.extraTransforms, "parse_bit")
 	}
@@ -151,8 +285,12 @@ func (cfg *Config) SetDefault() {
 		cfg.Target.Options.DatetimeFormat = "2006-01-02 15:04:05.000000-07"
 	}
 
-	// set vars
+	// set vars. The stream env stays in the task config (for rendering), so
+	// that concurrent streams do not overwrite each other's values
 	for k, v := range cfg.Env {
+		if _, ok := g.PtrVal(cfg.ReplicationStream).Env[k]; ok {
+			continue
+		}
 		os.Setenv(k, v)
 	}
 
@@ -177,6 +315,9 @@ func (cfg *Config) SetDefault() {
 	if val := os.Getenv("SLING_EXEC_ID_COLUMN"); val != "" {
 		cfg.MetadataExecID = cast.ToBool(val)
 	}
+	if val := os.Getenv("SLING_STREAM_RUN_ID_COLUMN"); val != "" {
+		cfg.MetadataStreamRunID = cast.ToBool(val)
+	}
 	if val := os.Getenv("SLING_ROW_NUM_COLUMN"); val != "" {
 		cfg.MetadataRowNum = cast.ToBool(val)
 	}
@@ -286,6 +427,12 @@ func (cfg *Config) DetermineType() (Type JobType, err error) {
 		return
 	}
 
+	// composite & expression update keys are compiled into the source SQL
+	if key := cfg.Source.UpdateKey; key != "" && !isSimpleUpdateKey(key) && !srcDbProvided {
+		err = g.Error("composite or expression update_key (%s) is only supported with database sources", key)
+		return
+	}
+
 	if cfg.Mode == IncrementalMode {
 		if cfg.SrcConn.Info().Type == dbio.TypeDbBigTable {
 			// use default keys if none are provided
@@ -301,12 +448,21 @@ func (cfg *Config) DetermineType() (Type JobType, err error) {
 		} else if srcFileProvided && cfg.Source.UpdateKey == slingLoadedAtColumn {
 			// need to loaded_at column for file incremental
 			cfg.MetadataLoadedAt = g.Bool(true)
+		} else if srcFileProvided && g.PtrVal(cfg.Source.Options).FileWatermark != nil {
+			// OK, the new files are appended
 		} else if cfg.Source.UpdateKey == "" && len(cfg.Source.PrimaryKey()) == 0 {
-			err = g.Error("must specify value for 'update_key' and/or 'primary_key' for incremental mode. See docs for more details: https://docs.slingdata.io/sling-cli/run/configuration")
-			if args := os.Getenv("SLING_CLI_ARGS"); strings.Contains(args, "-src-conn") || strings.Contains(args, "-tgt-conn") {
-				err = g.Error("must specify value for '--update-key' and/or '--primary-key' for incremental mode. See docs for more details: https://docs.slingdata.io/sling-cli/run/configuration")
+			// discover the keys from the source metadata (key_discovery)
+			keys, adopted, discoverErr := cfg.discoverKeys(srcDbProvided)
+			if discoverErr != nil {
+				err = discoverErr
+				return
+			} else if !adopted {
+				err = g.Error("must specify value for 'update_key' and/or 'primary_key' for incremental mode.%s See docs for more details: https://docs.slingdata.io/sling-cli/run/configuration", keys.Proposal())
+				if args := os.Getenv("SLING_CLI_ARGS"); strings.Contains(args, "-src-conn") || strings.Contains(args, "-tgt-conn") {
+					err = g.Error("must specify value for '--update-key' and/or '--primary-key' for incremental mode.%s See docs for more details: https://docs.slingdata.io/sling-cli/run/configuration", keys.Proposal())
+				}
+				return
 			}
-			return
 		}
 	} else if cfg.Mode == BackfillMode {
 		if cfg.Source.UpdateKey == "" || len(cfg.Source.PrimaryKey()) == 0 {
@@ -339,7 +495,7 @@ func (cfg *Config) DetermineType() (Type JobType, err error) {
 	} else if srcFileProvided && !srcDbProvided && !tgtDbProvided && tgtFileProvided {
 		Type = FileToFile
 	} else if tgtDbProvided && cfg.Target.Options != nil && cfg.Target.Options.PostSQL != nil {
-		cfg.Target.Object = *cfg.Target.Options.PostSQL
+		cfg.Target.Object = cfg.Target.Options.PostSQL.String()
 		Type = DbSQL
 	}
 
@@ -423,6 +579,11 @@ func (cfg *Config) Prepare() (err error) {
 		return strings.ToLower(c.Connection.Name)
 	})
 
+	// a unix socket source is read like stdin
+	if cfg.Source.Options != nil && g.PtrVal(cfg.Source.Options.Socket) != "" {
+		cfg.Options.StdIn = true
+	}
+
 	// Check Inputs
 	if !cfg.Options.StdIn && cfg.Source.Conn == "" && cfg.Target.Conn == "" {
 		return g.Error("invalid source connection (blank or not found)")
@@ -596,7 +757,8 @@ func (cfg *Config) Prepare() (err error) {
 
 	// validate capability to write
 	switch cfg.Target.Type {
-	case dbio.TypeDbPrometheus, dbio.TypeDbMongoDB, dbio.TypeDbElasticsearch, dbio.TypeDbBigTable:
+	case dbio.TypeDbPrometheus, dbio.TypeDbMongoDB, dbio.TypeDbElasticsearch, dbio.TypeDbBigTable,
+		dbio.TypeDbStripe, dbio.TypeDbShopify, dbio.TypeDbHubSpot:
 		return g.Error("sling cannot currently write to %s", cfg.Target.Type)
 	}
 
@@ -626,6 +788,260 @@ func (cfg *Config) Prepare() (err error) {
 		}
 	}
 
+	// validate filter expression
+	if filter := g.PtrVal(cfg.Source.Options).Filter; filter != nil && strings.TrimSpace(*filter) != "" {
+		if _, err = iop.ParseExpression(*filter); err != nil {
+			return g.Error(err, "invalid source filter")
+		}
+	}
+
+	// validate flatten options
+	if arrays := g.PtrVal(cfg.Source.Options).FlattenArrays; arrays != nil {
+		fo := iop.FlattenOptions{Arrays: iop.FlattenArrayMode(strings.ToLower(*arrays))}
+		if err = fo.Validate(); err != nil {
+			return g.Error(err, "invalid source option")
+		}
+	}
+
+	// validate column changes policy
+	if cc := g.PtrVal(cfg.Target.Options).ColumnChanges; cc != nil {
+		if err = ColumnChanges(strings.ToLower(string(*cc))).Validate(); err != nil {
+			return g.Error(err, "invalid target option")
+		}
+	}
+
+	// validate audit columns
+	if err = g.PtrVal(cfg.Target.Options).AuditColumns.Validate(); err != nil {
+		return g.Error(err, "invalid target option")
+	}
+
+	// validate snapshot retention
+	if err = g.PtrVal(cfg.Target.Options).SnapshotRetention.Validate(cfg.Mode); err != nil {
+		return g.Error(err, "invalid target option")
+	}
+
+	// validate commit strategy
+	if cs := g.PtrVal(cfg.Target.Options).CommitStrategy; cs != nil {
+		if err = cs.Validate(cfg.Target.Type, cfg.Mode); err != nil {
+			return g.Error(err, "invalid target option")
+		}
+	}
+
+	// validate identifier casing & quoting
+	if ic := g.PtrVal(cfg.Target.Options).IdentifierCasing; ic != nil {
+		if err = ic.Validate(); err != nil {
+			return g.Error(err, "invalid target option")
+		}
+	}
+	if iq := g.PtrVal(cfg.Target.Options).IdentifierQuoting; iq != nil {
+		if err = iq.Validate(); err != nil {
+			return g.Error(err, "invalid target option")
+		}
+	}
+
+	// validate column sanitizer
+	if err = g.PtrVal(cfg.Target.Options).ColumnSanitizer.Validate(); err != nil {
+		return g.Error(err, "invalid target option")
+	}
+
+	// validate pushdown
+	if pm := g.PtrVal(cfg.Target.Options).Pushdown; pm != nil {
+		if err = pm.Validate(); err != nil {
+			return g.Error(err, "invalid target option")
+		}
+	}
+
+	// validate staging url
+	if su := g.PtrVal(cfg.Target.Options).StagingURL; su != nil && *su != "" {
+		if database.StagingType(*su) == dbio.TypeUnknown {
+			return g.Error("invalid target option staging_url (%s). Expected an s3://, gs:// or azure folder", *su)
+		} else if !cfg.SrcConn.Type.IsDb() || !cfg.TgtConn.Type.IsDb() {
+			return g.Error("invalid target option staging_url: source and target must be databases")
+		}
+	}
+
+	// validate load method
+	if lm := g.PtrVal(cfg.Target.Options).LoadMethod; lm != nil {
+		if err = lm.Validate(cfg.Target.Type); err != nil {
+			return g.Error(err, "invalid target option")
+		}
+	}
+
+	// validate partition type
+	if pt := g.PtrVal(cfg.Target.Options).PartitionType; pt != nil {
+		if !g.In(strings.ToLower(*pt), "range", "list", "hash") {
+			return g.Error("invalid target option partition_type (%s). Expected range, list or hash", *pt)
+		}
+	}
+
+	// validate time series
+	if ts := g.PtrVal(cfg.Target.Options).TimeSeries; ts != nil {
+		if !g.In(cfg.Target.Type, dbio.TypeDbPostgres, dbio.TypeDbInfluxDB) {
+			return g.Error("invalid target option time_series: only for postgres (timescale) and influxdb targets")
+		} else if cfg.Target.Type == dbio.TypeDbPostgres && ts.TimeColumn == "" {
+			return g.Error("invalid target option time_series: time_column is required for timescale")
+		} else if err = ts.Validate(); err != nil {
+			return g.Error(err, "invalid target option")
+		}
+	}
+
+	// validate graph
+	if gr := g.PtrVal(cfg.Target.Options).Graph; gr != nil {
+		if cfg.Target.Type != dbio.TypeDbNeo4j {
+			return g.Error("invalid target option graph: only for neo4j targets")
+		} else if err = gr.Validate(); err != nil {
+			return g.Error(err, "invalid target option")
+		}
+	}
+
+	// validate python transform
+	if err = g.PtrVal(cfg.Source.Options).PythonTransform.Validate(); err != nil {
+		return g.Error(err, "invalid source option")
+	}
+
+	// validate wasm transform
+	if err = g.PtrVal(cfg.Source.Options).WasmTransform.Validate(); err != nil {
+		return g.Error(err, "invalid source option")
+	}
+
+	// validate deduplicate keep value
+	if keep := g.PtrVal(cfg.Source.Options).DeduplicateKeep; keep != nil {
+		if _, err = iop.ParseDeduplicateKeep(*keep); err != nil {
+			return g.Error(err, "invalid source option")
+		}
+	}
+
+	// validate processed-file ledger
+	if onSeen := g.PtrVal(cfg.Source.Options).OnSeen; onSeen != nil {
+		if err = OnSeen(strings.ToLower(*onSeen)).Validate(); err != nil {
+			return err
+		}
+	}
+
+	if afterRead := g.PtrVal(cfg.Source.Options).AfterRead; afterRead != nil {
+		if _, err = ParseAfterRead(*afterRead); err != nil {
+			return err
+		}
+	}
+
+	// validate client-side encryption
+	if so := g.PtrVal(cfg.Source.Options); so.Encryption != nil {
+		_, err = iop.NewEncryptor(iop.EncryptionConfig{
+			Type:       iop.EncryptionType(strings.ToLower(*so.Encryption)),
+			Key:        g.PtrVal(so.EncryptionKey),
+			PrivateKey: g.PtrVal(so.EncryptionPrivateKey),
+		})
+		if err != nil {
+			return g.Error(err, "invalid source encryption options")
+		}
+	}
+	if to := g.PtrVal(cfg.Target.Options); to.Encryption != nil {
+		_, err = iop.NewEncryptor(iop.EncryptionConfig{
+			Type:      iop.EncryptionType(strings.ToLower(*to.Encryption)),
+			Key:       g.PtrVal(to.EncryptionKey),
+			PublicKey: g.PtrVal(to.EncryptionPublicKey),
+		})
+		if err != nil {
+			return g.Error(err, "invalid target encryption options")
+		}
+	}
+
+	// validate iceberg time travel
+	if so := g.PtrVal(cfg.Source.Options); so.SnapshotID != nil && so.SnapshotTimestamp != nil {
+		return g.Error("invalid source options: specify snapshot_id or snapshot_timestamp, not both")
+	} else if so.SnapshotTimestamp != nil {
+		if _, err = cast.ToTimeE(*so.SnapshotTimestamp); err != nil {
+			return g.Error(err, "invalid source option snapshot_timestamp: %s", *so.SnapshotTimestamp)
+		}
+	}
+
+	// validate lookback window
+	if lookback := g.PtrVal(cfg.Source.Options).Lookback; lookback != nil && *lookback != "" {
+		if _, _, err = parseLookback(*lookback); err != nil {
+			return g.Error(err, "invalid source option")
+		}
+	}
+
+	// validate binary options
+	so, to := g.PtrVal(cfg.Source.Options), g.PtrVal(cfg.Target.Options)
+	if err = iop.ValidateBinaryOptions(g.PtrVal(to.BinaryEncoding), g.PtrVal(so.BinaryOverflow)); err != nil {
+		return g.Error(err, "invalid options")
+	} else if g.PtrVal(so.BinaryMaxSize) < 0 {
+		return g.Error("invalid source option: binary_max_size must be positive")
+	}
+
+	// validate encodings
+	if err = iop.ValidateCharset(g.PtrVal(so.Encoding)); err != nil {
+		return g.Error(err, "invalid source option")
+	} else if err = iop.ValidateCharset(g.PtrVal(to.Encoding)); err != nil {
+		return g.Error(err, "invalid target option")
+	} else if enc, _ := iop.GetCharset(g.PtrVal(to.Encoding)); enc != nil && !cfg.TgtConn.Type.IsFile() {
+		return g.Error("invalid target option: encoding is only supported for file targets")
+	}
+
+	// validate compression
+	if to.Compression != nil {
+		if err = to.Compression.Validate(); err != nil {
+			return g.Error(err, "invalid target option")
+		}
+	}
+	if level := g.PtrVal(to.CompressionLevel); level < 0 || level > 22 {
+		return g.Error("invalid target option: compression_level must be between 0 and 22")
+	}
+
+	// validate output layout
+	if g.PtrVal(to.PartNumberPadding) < 0 || g.PtrVal(to.FolderMaxFiles) < 0 {
+		return g.Error("invalid target option: part_number_padding and folder_max_files cannot be negative")
+	} else if g.PtrVal(to.FolderMaxFiles) > 0 && !filesys.IsTemplatedPath(cfg.TgtConn.URL()) {
+		return g.Error("invalid target option: folder_max_files requires a {part_number} placeholder in the target object")
+	}
+
+	// validate micro-batches
+	if err = cfg.validateMicroBatches(); err != nil {
+		return err
+	}
+
+	// validate file watermark
+	if err = cfg.validateFileWatermark(); err != nil {
+		return err
+	}
+
+	if g.PtrVal(so.FileSplitSize) < 0 {
+		return g.Error("invalid source option: file_split_size cannot be negative")
+	}
+
+	// validate size limits & reject sink
+	hasRejectSink := g.PtrVal(so.RejectFile) != "" || g.PtrVal(so.RejectTable) != ""
+	if err = iop.ValidateOversizePolicy(g.PtrVal(so.OversizePolicy)); err != nil {
+		return g.Error(err, "invalid source option")
+	} else if err = iop.ValidateOnErrorPolicy(g.PtrVal(so.OnError)); err != nil {
+		return g.Error(err, "invalid source option")
+	} else if g.PtrVal(so.FieldMaxSize) < 0 || g.PtrVal(so.RowMaxSize) < 0 {
+		return g.Error("invalid source option: field_max_size and row_max_size must be positive")
+	} else if !hasRejectSink && (g.PtrVal(so.OversizePolicy) == iop.OversizeReject || g.PtrVal(so.OnError) == iop.OnErrorRoute) {
+		return g.Error("invalid source option: a reject_file or reject_table is required to route rejected rows")
+	} else if g.PtrVal(so.RejectFile) != "" && g.PtrVal(so.RejectTable) != "" {
+		return g.Error("invalid source option: only one of reject_file or reject_table can be specified")
+	} else if g.PtrVal(so.RejectTable) != "" && !cfg.TgtConn.Type.IsDb() {
+		return g.Error("invalid source option: reject_table requires a database target")
+	}
+
+	// validate row hash
+	if rowHash := g.PtrVal(cfg.Source.Options).RowHash; rowHash != nil {
+		if err = rowHash.Validate(); err != nil {
+			return g.Error(err, "invalid source option")
+		}
+	}
+
+	// validate partitioned reads
+	if pb := g.PtrVal(cfg.Source.Options).PartitionBy; pb != nil {
+		if err = pb.Validate(); err != nil {
+			return g.Error(err, "invalid source option")
+		} else if !cfg.SrcConn.Type.IsDb() {
+			return g.Error("invalid source option: partition_by is only supported for database sources")
+		}
+	}
+
 	// to expand variables for custom SQL
 	fMap, err := cfg.GetFormatMap()
 	if err != nil {
@@ -633,8 +1049,13 @@ func (cfg *Config) Prepare() (err error) {
 	}
 
 	// sql & where prop
-	cfg.Source.Where = g.Rm(cfg.Source.Where, fMap)
-	cfg.Source.Query = g.R(g.Rm(cfg.Source.Query, fMap), "where_cond", cfg.Source.Where)
+	if cfg.Source.Where, err = RenderTemplate(cfg.Source.Where, fMap); err != nil {
+		return g.Error(err, "could not render where")
+	}
+	if cfg.Source.Query, err = RenderTemplate(cfg.Source.Query, fMap); err != nil {
+		return g.Error(err, "could not render sql")
+	}
+	cfg.Source.Query = g.R(cfg.Source.Query, "where_cond", cfg.Source.Where)
 	if cfg.ReplicationStream != nil {
 		cfg.ReplicationStream.SQL = cfg.Source.Query
 	}
@@ -654,13 +1075,17 @@ func (cfg *Config) Prepare() (err error) {
 					err = nil // don't return error in case the table full name ends with .sql
 				}
 			} else {
-				cfg.Source.Stream = g.Rm(sqlFromFile, fMap)
+				if cfg.Source.Stream, err = RenderTemplate(sqlFromFile, fMap); err != nil {
+					return g.Error(err, "could not render sql of %s", sTable.Raw)
+				}
 				if cfg.ReplicationStream != nil {
 					cfg.ReplicationStream.SQL = cfg.Source.Stream
 				}
 			}
 		} else if sTable.IsQuery() {
-			cfg.Source.Stream = g.Rm(sTable.SQL, fMap)
+			if cfg.Source.Stream, err = RenderTemplate(sTable.SQL, fMap); err != nil {
+				return g.Error(err, "could not render sql")
+			}
 			if cfg.ReplicationStream != nil {
 				cfg.ReplicationStream.SQL = cfg.Source.Stream
 			}
@@ -670,25 +1095,40 @@ func (cfg *Config) Prepare() (err error) {
 	// compile pre and post sql
 	if cfg.TgtConn.Type.IsDb() {
 
+		// compiles the statements. runtime values are applied when executed
+		compile := func(statements *SQLStatements, stage string) (*SQLStatements, error) {
+			if err := statements.Validate(); err != nil {
+				return nil, g.Error(err, "invalid %s-sql", stage)
+			}
+			compiled := SQLStatements{}
+			for _, statement := range *statements {
+				sql, err := GetSQLText(statement.SQL)
+				if err != nil {
+					return nil, g.Error(err, "could not get %s-sql body", stage)
+				}
+				if sql, err = RenderTemplate(sql, fMap); err != nil {
+					return nil, g.Error(err, "could not render %s-sql", stage)
+				}
+				compiled = append(compiled, SQLStatement{SQL: sql, OnError: statement.OnError})
+			}
+			return &compiled, nil
+		}
+
 		// pre SQL
-		if preSQL := cfg.Target.Options.PreSQL; preSQL != nil && *preSQL != "" {
-			sql, err := GetSQLText(*preSQL)
-			if err != nil {
-				return g.Error(err, "could not get pre-sql body")
+		if preSQL := cfg.Target.Options.PreSQL; preSQL != nil && len(*preSQL) > 0 {
+			if cfg.Target.Options.PreSQL, err = compile(preSQL, "pre"); err != nil {
+				return err
 			}
-			cfg.Target.Options.PreSQL = g.String(g.Rm(sql, fMap))
 			if cfg.ReplicationStream != nil {
 				cfg.ReplicationStream.TargetOptions.PreSQL = cfg.Target.Options.PreSQL
 			}
 		}
 
 		// post SQL
-		if postSQL := cfg.Target.Options.PostSQL; postSQL != nil && *postSQL != "" {
-			sql, err := GetSQLText(*postSQL)
-			if err != nil {
-				return g.Error(err, "could not get post-sql body")
+		if postSQL := cfg.Target.Options.PostSQL; postSQL != nil && len(*postSQL) > 0 {
+			if cfg.Target.Options.PostSQL, err = compile(postSQL, "post"); err != nil {
+				return err
 			}
-			cfg.Target.Options.PostSQL = g.String(g.Rm(sql, fMap))
 			if cfg.ReplicationStream != nil {
 				cfg.ReplicationStream.TargetOptions.PostSQL = cfg.Target.Options.PostSQL
 			}
@@ -712,14 +1152,17 @@ func (cfg *Config) FormatTargetObjectName() (err error) {
 		if _, ok := dateMap[k]; ok {
 			continue // don't clean the date values
 		}
-		if g.In(k, "run_timestamp", "object_full_name", "stream_full_name") {
+		if g.In(k, "run_timestamp", "run_date", "object_full_name", "stream_full_name") {
 			continue // don't clean those keys, will add an underscore prefix
 		}
 		m[k] = iop.CleanName(cast.ToString(v))
 	}
 
 	// replace placeholders
-	cfg.Target.Object = strings.TrimSpace(g.Rm(cfg.Target.Object, m))
+	if cfg.Target.Object, err = RenderTemplate(cfg.Target.Object, m); err != nil {
+		return g.Error(err, "could not render target object")
+	}
+	cfg.Target.Object = strings.TrimSpace(cfg.Target.Object)
 
 	if cfg.TgtConn.Type.IsDb() {
 		// normalize casing of object names
@@ -731,11 +1174,19 @@ func (cfg *Config) FormatTargetObjectName() (err error) {
 		} else if table.Schema == "" {
 			table.Schema = cast.ToString(cfg.Target.Data["schema"])
 		}
+		if ic := g.PtrVal(cfg.Target.Options).IdentifierCasing; ic != nil {
+			casing := ic.ColumnCasing()
+			table.Schema = lo.Ternary(table.Schema != "", casing.Apply(table.Schema, cfg.TgtConn.Type), "")
+			table.Name = casing.Apply(table.Name, cfg.TgtConn.Type)
+		}
 		cfg.Target.Object = table.FullName()
 
 		// fill in temp table name if specified
 		if tgtOpts := cfg.Target.Options; tgtOpts != nil {
-			tgtOpts.TableTmp = strings.TrimSpace(g.Rm(tgtOpts.TableTmp, m))
+			if tgtOpts.TableTmp, err = RenderTemplate(tgtOpts.TableTmp, m); err != nil {
+				return g.Error(err, "could not render table_tmp")
+			}
+			tgtOpts.TableTmp = strings.TrimSpace(tgtOpts.TableTmp)
 			if tgtOpts.TableTmp != "" {
 				tableTmp, err := database.ParseTableName(tgtOpts.TableTmp, cfg.TgtConn.Type)
 				if err != nil {
@@ -760,7 +1211,10 @@ func (cfg *Config) FormatTargetObjectName() (err error) {
 		cfg.TgtConn.Data["url"] = cfg.Target.Object
 	} else if cfg.TgtConn.Type.IsFile() {
 		url := cast.ToString(cfg.Target.Data["url"])
-		cfg.Target.Data["url"] = strings.TrimSpace(g.Rm(url, m))
+		if url, err = RenderTemplate(url, m); err != nil {
+			return g.Error(err, "could not render target url")
+		}
+		cfg.Target.Data["url"] = strings.TrimSpace(url)
 	}
 
 	// set on ReplicationStream
@@ -774,8 +1228,10 @@ func (cfg *Config) FormatTargetObjectName() (err error) {
 // GetFormatMap returns a map to format a string with provided with variables
 func (cfg *Config) GetFormatMap() (m map[string]any, err error) {
 
+	runTime := time.Now()
 	m = g.M(
-		"run_timestamp", time.Now().Format("2006_01_02_150405"),
+		"run_timestamp", runTime.Format("2006_01_02_150405"),
+		"run_date", runTime.Format(time.DateOnly),
 	)
 
 	if cfg.SrcConn.Type.String() != "" {
@@ -795,8 +1251,8 @@ func (cfg *Config) GetFormatMap() (m map[string]any, err error) {
 		m["target_name"] = strings.ToLower(cfg.Target.Conn)
 	}
 
-	if cfg.ReplicationStream != nil && cfg.ReplicationStream.ID != "" {
-		m["stream_run_id"] = cfg.ReplicationStream.ID
+	if runID := cfg.RunID(); runID != "" {
+		m["run_id"] = runID
 	}
 
 	if cfg.SrcConn.Type.IsDb() {
@@ -896,7 +1352,7 @@ func (cfg *Config) GetFormatMap() (m map[string]any, err error) {
 			m["stream_file_ext"] = fileNameArr[len(fileNameArr)-1]
 			if len(fileNameArr) >= 3 {
 				// in case of compression (2 extension tokens)
-				for _, suff := range []string{"gz", "zst", "snappy"} {
+				for _, suff := range []string{"gz", "zst", "snappy", "lz4", "bz2"} {
 					if m["stream_file_ext"] == suff {
 						m["stream_file_ext"] = fileNameArr[len(fileNameArr)-2] + "_" + fileNameArr[len(fileNameArr)-1]
 						break
@@ -951,6 +1407,17 @@ func (cfg *Config) GetFormatMap() (m map[string]any, err error) {
 		}
 	}
 
+	streamRunID, err := cfg.streamRunIDFromMap(m)
+	if err != nil {
+		return m, err
+	}
+	m["stream_run_id"] = streamRunID
+
+	// render the user-defined variables
+	if err = renderTemplateVars(m, cfg.Vars); err != nil {
+		return m, err
+	}
+
 	// pass env values
 	for k, v := range cfg.Env {
 		if _, found := m[k]; !found && v != "" {
@@ -1020,6 +1487,7 @@ type Config struct {
 	Transforms any               `json:"transforms,omitempty" yaml:"transforms,omitempty"`
 	Options    ConfigOptions     `json:"options,omitempty" yaml:"options,omitempty"`
 	Env        map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	Vars       map[string]any    `json:"vars,omitempty" yaml:"vars,omitempty"` // user-defined template variables
 
 	StreamName        string                   `json:"stream_name,omitempty" yaml:"stream_name,omitempty"`
 	ReplicationStream *ReplicationStreamConfig `json:"replication_stream,omitempty" yaml:"replication_stream,omitempty"`
@@ -1032,11 +1500,15 @@ type Config struct {
 	IncrementalValStr string `json:"incremental_val_str" yaml:"incremental_val_str"`
 	IncrementalGTE    bool   `json:"incremental_gte,omitempty" yaml:"incremental_gte,omitempty"`
 
-	MetadataLoadedAt  *bool `json:"-" yaml:"-"`
-	MetadataStreamURL bool  `json:"-" yaml:"-"`
-	MetadataRowNum    bool  `json:"-" yaml:"-"`
-	MetadataRowID     bool  `json:"-" yaml:"-"`
-	MetadataExecID    bool  `json:"-" yaml:"-"`
+	MetadataLoadedAt    *bool `json:"-" yaml:"-"`
+	MetadataStreamURL   bool  `json:"-" yaml:"-"`
+	MetadataRowNum      bool  `json:"-" yaml:"-"`
+	MetadataRowID       bool  `json:"-" yaml:"-"`
+	MetadataExecID      bool  `json:"-" yaml:"-"`
+	MetadataStreamRunID bool  `json:"-" yaml:"-"`
+
+	runID       string `json:"-" yaml:"-"`
+	streamRunID string `json:"-" yaml:"-"`
 
 	extraTransforms []string `json:"-" yaml:"-"`
 }
@@ -1046,6 +1518,42 @@ func (cfg *Config) Scan(value interface{}) error {
 	return g.JSONScanner(cfg, value)
 }
 
+// RunID returns the id of the execution (shared by all streams of a replication)
+func (cfg *Config) RunID() string {
+	if cfg.runID != "" {
+		return cfg.runID
+	}
+	return os.Getenv("SLING_EXEC_ID")
+}
+
+// StreamRunID returns the id of the stream run. An explicit replication
+// stream `id` takes precedence, otherwise it is generated once with
+// `SLING_STREAM_RUN_ID_FORMAT` (or `SLING_RUN_ID_FORMAT`)
+func (cfg *Config) StreamRunID() (string, error) {
+	if cfg.streamRunID != "" {
+		return cfg.streamRunID, nil
+	}
+
+	m, err := cfg.GetFormatMap()
+	if err != nil {
+		return "", err
+	}
+	return cast.ToString(m["stream_run_id"]), nil
+}
+
+func (cfg *Config) streamRunIDFromMap(m map[string]any) (string, error) {
+	if cfg.ReplicationStream != nil && cfg.ReplicationStream.ID != "" {
+		cfg.streamRunID = cfg.ReplicationStream.ID
+	} else if cfg.streamRunID == "" {
+		streamRunID, err := StreamRunIDFormatFromEnv().Generate(m)
+		if err != nil {
+			return "", g.Error(err, "could not generate stream run id")
+		}
+		cfg.streamRunID = streamRunID
+	}
+	return cfg.streamRunID, nil
+}
+
 // ReplicationMode returns true for replication mode
 func (cfg *Config) ReplicationMode() bool {
 	return cfg.ReplicationStream != nil
@@ -1068,19 +1576,11 @@ func (cfg *Config) ColumnsPrepared() (columns iop.Columns) {
 		switch colsCasted := cfg.Target.Columns.(type) {
 		case map[string]any:
 			for colName, colType := range colsCasted {
-				col := iop.Column{
-					Name: colName,
-					Type: iop.ColumnType(cast.ToString(colType)),
-				}
-				columns = append(columns, col)
+				columns = append(columns, makeColumn(colName, colType))
 			}
 		case map[any]any:
 			for colName, colType := range colsCasted {
-				col := iop.Column{
-					Name: cast.ToString(colName),
-					Type: iop.ColumnType(cast.ToString(colType)),
-				}
-				columns = append(columns, col)
+				columns = append(columns, makeColumn(cast.ToString(colName), colType))
 			}
 		case []map[string]any:
 			for _, colItem := range colsCasted {
@@ -1113,6 +1613,19 @@ func (cfg *Config) ColumnsPrepared() (columns iop.Columns) {
 	return
 }
 
+// makeColumn creates a column from a columns map entry. The value is either
+// the type (`int`), or a map with the type and default (`{type: int, default: 0}`)
+func makeColumn(name string, value any) (col iop.Column) {
+	switch vals := value.(type) {
+	case map[string]any, map[any]any:
+		g.Unmarshal(g.Marshal(cast.ToStringMap(vals)), &col)
+		col.Name = name
+	default:
+		col = iop.Column{Name: name, Type: iop.ColumnType(cast.ToString(value))}
+	}
+	return col
+}
+
 // TransformsPrepared returns the transforms columns
 func (cfg *Config) TransformsPrepared() (colTransforms map[string][]string) {
 
@@ -1254,6 +1767,8 @@ type Source struct {
 	Options     *SourceOptions `json:"options,omitempty" yaml:"options,omitempty"`
 
 	Data map[string]interface{} `json:"-" yaml:"-"`
+
+	columns iop.Columns `json:"-" yaml:"-"` // source table columns with comments & constraints
 }
 
 func (s *Source) Limit() int {
@@ -1337,26 +1852,108 @@ func (t *Target) MD5() string {
 
 // SourceOptions are connection and stream processing options
 type SourceOptions struct {
-	EmptyAsNull    *bool               `json:"empty_as_null,omitempty" yaml:"empty_as_null,omitempty"`
-	Header         *bool               `json:"header,omitempty" yaml:"header,omitempty"`
-	Flatten        *bool               `json:"flatten,omitempty" yaml:"flatten,omitempty"`
-	FieldsPerRec   *int                `json:"fields_per_rec,omitempty" yaml:"fields_per_rec,omitempty"`
-	Compression    *iop.CompressorType `json:"compression,omitempty" yaml:"compression,omitempty"`
-	Format         *dbio.FileType      `json:"format,omitempty" yaml:"format,omitempty"`
-	NullIf         *string             `json:"null_if,omitempty" yaml:"null_if,omitempty"`
-	DatetimeFormat string              `json:"datetime_format,omitempty" yaml:"datetime_format,omitempty"`
-	SkipBlankLines *bool               `json:"skip_blank_lines,omitempty" yaml:"skip_blank_lines,omitempty"`
-	Delimiter      string              `json:"delimiter,omitempty" yaml:"delimiter,omitempty"`
-	Escape         string              `json:"escape,omitempty" yaml:"escape,omitempty"`
-	Quote          string              `json:"quote,omitempty" yaml:"quote,omitempty"`
-	MaxDecimals    *int                `json:"max_decimals,omitempty" yaml:"max_decimals,omitempty"`
-	JmesPath       *string             `json:"jmespath,omitempty" yaml:"jmespath,omitempty"`
-	Sheet          *string             `json:"sheet,omitempty" yaml:"sheet,omitempty"`
-	Range          *string             `json:"range,omitempty" yaml:"range,omitempty"`
-	Limit          *int                `json:"limit,omitempty" yaml:"limit,omitempty"`
-	Offset         *int                `json:"offset,omitempty" yaml:"offset,omitempty"`
-	FileSelect     *[]string           `json:"file_select,omitempty" yaml:"file_select,omitempty"` // include/exclude files
-	ChunkSize      any                 `json:"chunk_size,omitempty" yaml:"chunk_size,omitempty"`
+	EmptyAsNull      *bool               `json:"empty_as_null,omitempty" yaml:"empty_as_null,omitempty"`
+	Header           *bool               `json:"header,omitempty" yaml:"header,omitempty"`
+	Flatten          *bool               `json:"flatten,omitempty" yaml:"flatten,omitempty"`
+	FlattenDepth     *int                `json:"flatten_depth,omitempty" yaml:"flatten_depth,omitempty"` // max nesting depth, no limit if 0
+	FlattenSeparator *string             `json:"flatten_separator,omitempty" yaml:"flatten_separator,omitempty"`
+	FlattenArrays    *string             `json:"flatten_arrays,omitempty" yaml:"flatten_arrays,omitempty"` // stringify or explode
+	FieldsPerRec     *int                `json:"fields_per_rec,omitempty" yaml:"fields_per_rec,omitempty"`
+	Compression      *iop.CompressorType `json:"compression,omitempty" yaml:"compression,omitempty"`
+	Encoding         *string             `json:"encoding,omitempty" yaml:"encoding,omitempty"` // e.g. windows-1252, shift_jis
+	Format           *dbio.FileType      `json:"format,omitempty" yaml:"format,omitempty"`
+	NullIf           *string             `json:"null_if,omitempty" yaml:"null_if,omitempty"`
+	DatetimeFormat   string              `json:"datetime_format,omitempty" yaml:"datetime_format,omitempty"`
+	SkipBlankLines   *bool               `json:"skip_blank_lines,omitempty" yaml:"skip_blank_lines,omitempty"`
+	Delimiter        string              `json:"delimiter,omitempty" yaml:"delimiter,omitempty"`
+	Escape           string              `json:"escape,omitempty" yaml:"escape,omitempty"`
+	Quote            string              `json:"quote,omitempty" yaml:"quote,omitempty"`
+	MaxDecimals      *int                `json:"max_decimals,omitempty" yaml:"max_decimals,omitempty"`
+	JmesPath         *string             `json:"jmespath,omitempty" yaml:"jmespath,omitempty"`
+	Sheet            *string             `json:"sheet,omitempty" yaml:"sheet,omitempty"`
+	Range            *string             `json:"range,omitempty" yaml:"range,omitempty"`
+	Limit            *int                `json:"limit,omitempty" yaml:"limit,omitempty"`
+	Offset           *int                `json:"offset,omitempty" yaml:"offset,omitempty"`
+	FileSelect       *[]string           `json:"file_select,omitempty" yaml:"file_select,omitempty"`           // include/exclude files
+	ReadConcurrency  *int                `json:"read_concurrency,omitempty" yaml:"read_concurrency,omitempty"` // number of files read in parallel
+	FileSplitSize    *int64              `json:"file_split_size,omitempty" yaml:"file_split_size,omitempty"`   // min bytes of the chunks of a large csv / ndjson file, parsed in parallel
+	ChunkSize        any                 `json:"chunk_size,omitempty" yaml:"chunk_size,omitempty"`
+	Filter           *string             `json:"filter,omitempty" yaml:"filter,omitempty"` // row filter expression, evaluated by the engine
+	Deduplicate      *bool               `json:"deduplicate,omitempty" yaml:"deduplicate,omitempty"`
+	DeduplicateKeys  *[]string           `json:"deduplicate_keys,omitempty" yaml:"deduplicate_keys,omitempty"` // all columns if empty
+	DeduplicateKeep  *string             `json:"deduplicate_keep,omitempty" yaml:"deduplicate_keep,omitempty"` // first or last
+	PartitionBy      *SourcePartitionBy  `json:"partition_by,omitempty" yaml:"partition_by,omitempty"`         // parallel range reads
+	PythonTransform  *PythonTransform    `json:"python_transform,omitempty" yaml:"python_transform,omitempty"` // batches transformed by a python script
+	WasmTransform    *WasmTransform      `json:"wasm_transform,omitempty" yaml:"wasm_transform,omitempty"`     // batches transformed by a wasm module
+
+	// duckdb session settings, when files are read with duckdb
+	MemoryLimit   *string `json:"memory_limit,omitempty" yaml:"memory_limit,omitempty"`     // e.g. 4GB
+	Threads       *int    `json:"threads,omitempty" yaml:"threads,omitempty"`               // number of duckdb threads
+	TempDirectory *string `json:"temp_directory,omitempty" yaml:"temp_directory,omitempty"` // spill location
+
+	// processed-file ledger: skip or reload files already loaded
+	OnSeen *string `json:"on_seen,omitempty" yaml:"on_seen,omitempty"`
+
+	// delete, archive://<path> or move://<path>, once loaded
+	AfterRead *string `json:"after_read,omitempty" yaml:"after_read,omitempty"`
+
+	// incremental file selection, without a ledger: only the files newer than
+	// the stored watermark are read, by modified time (mtime) or by the
+	// timestamp in the file name (name), matched with file_name_pattern
+	FileWatermark      *string `json:"file_watermark,omitempty" yaml:"file_watermark,omitempty"`
+	FileNamePattern    *string `json:"file_name_pattern,omitempty" yaml:"file_name_pattern,omitempty"`         // regex, with the timestamp as first group
+	FileNameTimeFormat *string `json:"file_name_time_format,omitempty" yaml:"file_name_time_format,omitempty"` // e.g. YYYYMMDD_HHmmss
+
+	// decryption of encrypted files: aes-gcm, gpg or age
+	Encryption           *string `json:"encryption,omitempty" yaml:"encryption,omitempty"`
+	EncryptionKey        *string `json:"encryption_key,omitempty" yaml:"encryption_key,omitempty"`                 // aes key / passphrase
+	EncryptionPrivateKey *string `json:"encryption_private_key,omitempty" yaml:"encryption_private_key,omitempty"` // gpg private key / age identities
+
+	// throttling of the read, to limit the load on the source (0 is no limit)
+	RowsPerSecond  *int64 `json:"rows_per_second,omitempty" yaml:"rows_per_second,omitempty"`
+	BytesPerSecond *int64 `json:"bytes_per_second,omitempty" yaml:"bytes_per_second,omitempty"`
+
+	// cancels the source query after the number of seconds (minutes for trino)
+	QueryTimeout *int `json:"query_timeout,omitempty" yaml:"query_timeout,omitempty"`
+
+	// window subtracted from the incremental watermark (e.g. `2h`, `3d`),
+	// to re-capture late-arriving updates
+	Lookback *string `json:"lookback,omitempty" yaml:"lookback,omitempty"`
+
+	// discovery of the keys from the source metadata, when the primary_key
+	// and update_key are omitted in incremental mode: off (default), propose or auto
+	KeyDiscovery *KeyDiscovery `json:"key_discovery,omitempty" yaml:"key_discovery,omitempty"`
+
+	// size limit of binary values in bytes, with the overflow policy
+	// (truncate, null or error)
+	BinaryMaxSize  *int64              `json:"binary_max_size,omitempty" yaml:"binary_max_size,omitempty"`
+	BinaryOverflow *iop.BinaryOverflow `json:"binary_overflow,omitempty" yaml:"binary_overflow,omitempty"`
+
+	// size limits of values and rows in bytes, with the oversize policy
+	// (truncate, error or reject). Rejected rows are written to reject_file
+	FieldMaxSize   *int64              `json:"field_max_size,omitempty" yaml:"field_max_size,omitempty"`
+	RowMaxSize     *int64              `json:"row_max_size,omitempty" yaml:"row_max_size,omitempty"`
+	OversizePolicy *iop.OversizePolicy `json:"oversize_policy,omitempty" yaml:"oversize_policy,omitempty"`
+	RejectFile     *string             `json:"reject_file,omitempty" yaml:"reject_file,omitempty"`
+
+	// what happens with rows which cannot be parsed: skip, fail (default) or
+	// route, into the reject_file or the reject_table of the target database
+	OnError     *iop.OnErrorPolicy `json:"on_error,omitempty" yaml:"on_error,omitempty"`
+	RejectTable *string            `json:"reject_table,omitempty" yaml:"reject_table,omitempty"`
+
+	// micro-batching of a continuous stdin (or unix socket) stream: a batch
+	// is written to the target once either trigger is reached
+	MicroBatchRows     *int    `json:"micro_batch_rows,omitempty" yaml:"micro_batch_rows,omitempty"`
+	MicroBatchInterval *string `json:"micro_batch_interval,omitempty" yaml:"micro_batch_interval,omitempty"` // e.g. 5s, 1m
+	Socket             *string `json:"socket,omitempty" yaml:"socket,omitempty"`                             // unix socket path to listen on
+
+	// hash of the row values, added as a column (default `_row_hash`).
+	// In incremental mode without update_key, only the changed rows are merged
+	RowHash *RowHash `json:"row_hash,omitempty" yaml:"row_hash,omitempty"`
+
+	// iceberg time travel
+	SnapshotID        *int64  `json:"snapshot_id,omitempty" yaml:"snapshot_id,omitempty"`
+	SnapshotTimestamp *string `json:"snapshot_timestamp,omitempty" yaml:"snapshot_timestamp,omitempty"`
 
 	// columns & transforms were moved out of source_options
 	// https://github.com/slingdata-io/sling-cli/issues/348
@@ -1364,6 +1961,81 @@ type SourceOptions struct {
 	Transforms any `json:"transforms,omitempty" yaml:"transforms,omitempty"` // legacy
 }
 
+// PythonTransform is a python script transforming the batches of rows read,
+// with a `transform(batch)` function returning the new batch (a pandas
+// DataFrame or a pyarrow RecordBatch / Table), or None to drop it
+type PythonTransform struct {
+	Script    string `json:"script" yaml:"script"`
+	Python    string `json:"python,omitempty" yaml:"python,omitempty"`         // python executable, with pyarrow installed (default python3)
+	BatchSize int    `json:"batch_size,omitempty" yaml:"batch_size,omitempty"` // rows per batch (default 10000)
+	Format    string `json:"format,omitempty" yaml:"format,omitempty"`         // type of the batch passed: pandas (default) or arrow
+}
+
+// Validate checks the python_transform source option
+func (pt *PythonTransform) Validate() error {
+	if pt == nil {
+		return nil
+	} else if pt.Script == "" {
+		return g.Error("python_transform requires a script")
+	} else if !g.PathExists(pt.Script) {
+		return g.Error("python_transform script not found: %s", pt.Script)
+	} else if !g.In(pt.Format, "", "pandas", "arrow") {
+		return g.Error("invalid python_transform format: %s (expected 'pandas' or 'arrow')", pt.Format)
+	}
+	return nil
+}
+
+// WasmTransform is a WASM module (compiled from any language) transforming
+// the batches of rows read, in the sandbox of the embedded runtime. Its
+// `transform` function is called with each batch, as JSON:
+// {"columns": [{"name": "id", "type": "bigint"}, ...], "rows": [[1, ...], ...]}
+type WasmTransform struct {
+	Module    string `json:"module" yaml:"module"`
+	BatchSize int    `json:"batch_size,omitempty" yaml:"batch_size,omitempty"` // rows per batch (default 10000)
+}
+
+// Validate checks the wasm_transform source option
+func (wt *WasmTransform) Validate() error {
+	if wt == nil {
+		return nil
+	} else if wt.Module == "" {
+		return g.Error("wasm_transform requires a module")
+	} else if !g.PathExists(wt.Module) {
+		return g.Error("wasm_transform module not found: %s", wt.Module)
+	}
+	return nil
+}
+
+// SourcePartitionBy splits a database source read into parallel range
+// queries over a column, merged into one dataflow
+type SourcePartitionBy struct {
+	Column      string   `json:"column" yaml:"column"`                               // `rowid` for even ROWID ranges (oracle)
+	Chunks      int      `json:"chunks,omitempty" yaml:"chunks,omitempty"`           // number of even chunks between min & max values
+	Ranges      []string `json:"ranges,omitempty" yaml:"ranges,omitempty"`           // explicit `start,end` ranges (end excluded)
+	Concurrency int      `json:"concurrency,omitempty" yaml:"concurrency,omitempty"` // max parallel reads, all chunks if 0
+}
+
+// Validate checks the partition_by source option
+func (pb *SourcePartitionBy) Validate() error {
+	if pb == nil {
+		return nil
+	} else if pb.Column == "" {
+		return g.Error("partition_by requires a column")
+	} else if pb.Chunks < 2 && len(pb.Ranges) == 0 {
+		return g.Error("partition_by requires chunks (2 or more) or ranges")
+	} else if pb.Chunks > 0 && len(pb.Ranges) > 0 {
+		return g.Error("partition_by accepts either chunks or ranges, not both")
+	} else if pb.IsRowID() && len(pb.Ranges) > 0 {
+		return g.Error("partition_by on rowid requires chunks, not ranges")
+	}
+	return nil
+}
+
+// IsRowID returns true if partitioning by the Oracle ROWID pseudo-column
+func (pb *SourcePartitionBy) IsRowID() bool {
+	return pb != nil && strings.EqualFold(pb.Column, "rowid")
+}
+
 func (so *SourceOptions) RangeStartEnd() (start, end string) {
 	if so != nil && so.Range != nil {
 		values := strings.Split(g.PtrVal(so.Range), ",")
@@ -1376,28 +2048,332 @@ func (so *SourceOptions) RangeStartEnd() (start, end string) {
 
 // TargetOptions are target connection and stream processing options
 type TargetOptions struct {
-	Header           *bool               `json:"header,omitempty" yaml:"header,omitempty"`
-	Compression      *iop.CompressorType `json:"compression,omitempty" yaml:"compression,omitempty"`
-	Concurrency      int                 `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
-	BatchLimit       *int64              `json:"batch_limit,omitempty" yaml:"batch_limit,omitempty"`
-	DatetimeFormat   string              `json:"datetime_format,omitempty" yaml:"datetime_format,omitempty"`
-	Delimiter        string              `json:"delimiter,omitempty" yaml:"delimiter,omitempty"`
-	FileMaxRows      *int64              `json:"file_max_rows,omitempty" yaml:"file_max_rows,omitempty"`
-	FileMaxBytes     *int64              `json:"file_max_bytes,omitempty" yaml:"file_max_bytes,omitempty"`
-	Format           dbio.FileType       `json:"format,omitempty" yaml:"format,omitempty"`
-	MaxDecimals      *int                `json:"max_decimals,omitempty" yaml:"max_decimals,omitempty"`
-	UseBulk          *bool               `json:"use_bulk,omitempty" yaml:"use_bulk,omitempty"`
-	IgnoreExisting   *bool               `json:"ignore_existing,omitempty" yaml:"ignore_existing,omitempty"`
-	DeleteMissing    *string             `json:"delete_missing,omitempty" yaml:"delete_missing,omitempty"`
-	AddNewColumns    *bool               `json:"add_new_columns,omitempty" yaml:"add_new_columns,omitempty"`
-	AdjustColumnType *bool               `json:"adjust_column_type,omitempty" yaml:"adjust_column_type,omitempty"`
-	ColumnCasing     *iop.ColumnCasing   `json:"column_casing,omitempty" yaml:"column_casing,omitempty"`
+	Header            *bool               `json:"header,omitempty" yaml:"header,omitempty"`
+	Compression       *iop.CompressorType `json:"compression,omitempty" yaml:"compression,omitempty"`
+	CompressionLevel  *int                `json:"compression_level,omitempty" yaml:"compression_level,omitempty"` // codec level, 0 for the default
+	Encoding          *string             `json:"encoding,omitempty" yaml:"encoding,omitempty"`                   // for legacy consumers, utf-8 by default
+	Concurrency       int                 `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	BatchLimit        *int64              `json:"batch_limit,omitempty" yaml:"batch_limit,omitempty"`
+	DatetimeFormat    string              `json:"datetime_format,omitempty" yaml:"datetime_format,omitempty"`
+	Delimiter         string              `json:"delimiter,omitempty" yaml:"delimiter,omitempty"`
+	FileMaxRows       *int64              `json:"file_max_rows,omitempty" yaml:"file_max_rows,omitempty"`
+	FileMaxBytes      *int64              `json:"file_max_bytes,omitempty" yaml:"file_max_bytes,omitempty"`
+	PartNumberPadding *int                `json:"part_number_padding,omitempty" yaml:"part_number_padding,omitempty"` // width of {part_number}, 4 by default
+	FolderMaxFiles    *int                `json:"folder_max_files,omitempty" yaml:"folder_max_files,omitempty"`       // max files per {part_folder}
+	Format            dbio.FileType       `json:"format,omitempty" yaml:"format,omitempty"`
+	MaxDecimals       *int                `json:"max_decimals,omitempty" yaml:"max_decimals,omitempty"`
+	UseBulk           *bool               `json:"use_bulk,omitempty" yaml:"use_bulk,omitempty"`
+	IgnoreExisting    *bool               `json:"ignore_existing,omitempty" yaml:"ignore_existing,omitempty"`
+	DeleteMissing     *string             `json:"delete_missing,omitempty" yaml:"delete_missing,omitempty"`
+	AddNewColumns     *bool               `json:"add_new_columns,omitempty" yaml:"add_new_columns,omitempty"`
+	AdjustColumnType  *bool               `json:"adjust_column_type,omitempty" yaml:"adjust_column_type,omitempty"`
+	ColumnCasing      *iop.ColumnCasing   `json:"column_casing,omitempty" yaml:"column_casing,omitempty"`
+	ColumnChanges     *ColumnChanges      `json:"column_changes,omitempty" yaml:"column_changes,omitempty"`
+
+	// casing of the created table & column names (column_casing prevails
+	// for the columns), and quoting of the identifiers in the generated SQL
+	IdentifierCasing  *IdentifierCasing       `json:"identifier_casing,omitempty" yaml:"identifier_casing,omitempty"`
+	IdentifierQuoting *dbio.IdentifierQuoting `json:"identifier_quoting,omitempty" yaml:"identifier_quoting,omitempty"`
+
+	// renames the columns into valid identifiers of the target database
+	ColumnSanitizer *ColumnSanitizer `json:"column_sanitizer,omitempty" yaml:"column_sanitizer,omitempty"`
+
+	// object store uploads (s3, gcs, azure)
+	UploadPartSize      *int64  `json:"upload_part_size,omitempty" yaml:"upload_part_size,omitempty"`
+	UploadConcurrency   *int    `json:"upload_concurrency,omitempty" yaml:"upload_concurrency,omitempty"`
+	UploadMaxRetries    *int    `json:"upload_max_retries,omitempty" yaml:"upload_max_retries,omitempty"`
+	UploadRetryDelay    *string `json:"upload_retry_delay,omitempty" yaml:"upload_retry_delay,omitempty"`         // e.g. 500ms, 2s
+	UploadMaxRetryDelay *string `json:"upload_max_retry_delay,omitempty" yaml:"upload_max_retry_delay,omitempty"` // e.g. 1m
+	UploadChecksum      *bool   `json:"upload_checksum,omitempty" yaml:"upload_checksum,omitempty"`               // validate parts with checksums
+	StorageClass        *string `json:"storage_class,omitempty" yaml:"storage_class,omitempty"`                   // s3/gcs storage class, or azure access tier
+	KmsKeyID            *string `json:"kms_key_id,omitempty" yaml:"kms_key_id,omitempty"`                         // s3 SSE-KMS key, or gcs CMEK key name
+
+	// propagate source column details when creating the target table
+	AddColumnComments *bool `json:"add_column_comments,omitempty" yaml:"add_column_comments,omitempty"`
+	AddNotNull        *bool `json:"add_not_null,omitempty" yaml:"add_not_null,omitempty"`
+	AddPrimaryKey     *bool `json:"add_primary_key,omitempty" yaml:"add_primary_key,omitempty"`
+
+	// load method for the target, such as `streaming` (Snowflake Snowpipe Streaming)
+	// or `storage_write` (BigQuery Storage Write API)
+	LoadMethod *LoadMethod `json:"load_method,omitempty" yaml:"load_method,omitempty"`
+
+	// additional options appended to the bulk COPY statement (Redshift)
+	CopyOptions *string `json:"copy_options,omitempty" yaml:"copy_options,omitempty"`
+
+	// write parallelism & batching
+	BatchSize          *int `json:"batch_size,omitempty" yaml:"batch_size,omitempty"`                       // rows per insert statement
+	MaxInFlightBatches *int `json:"max_in_flight_batches,omitempty" yaml:"max_in_flight_batches,omitempty"` // files written & pending load, reads wait when reached
+
+	UpdateColumns       *[]string `json:"update_columns,omitempty" yaml:"update_columns,omitempty"`               // only update these columns on merge
+	IgnoreUpdateColumns *[]string `json:"ignore_update_columns,omitempty" yaml:"ignore_update_columns,omitempty"` // do not update these columns on merge
+
+	// partitioning & clustering used when creating the target table
+	PartitionBy             *[]string `json:"partition_by,omitempty" yaml:"partition_by,omitempty"`                           // columns or SQL expressions
+	PartitionType           *string   `json:"partition_type,omitempty" yaml:"partition_type,omitempty"`                       // postgres: range (default), list or hash
+	PartitionExpirationDays *int      `json:"partition_expiration_days,omitempty" yaml:"partition_expiration_days,omitempty"` // bigquery only
+	ClusterBy               *[]string `json:"cluster_by,omitempty" yaml:"cluster_by,omitempty"`                               // columns or SQL expressions
+
+	// time-series targets: timescale hypertables (postgres) & influxdb points
+	TimeSeries *database.TimeSeries `json:"time_series,omitempty" yaml:"time_series,omitempty"`
+
+	// graph targets (neo4j): rows as nodes, or relationships between nodes
+	Graph *database.Graph `json:"graph,omitempty" yaml:"graph,omitempty"`
+
+	// client-side encryption of written files: aes-gcm, gpg or age.
+	// key values accept env vars ($VAR) and secret references (vault://...)
+	Encryption          *string `json:"encryption,omitempty" yaml:"encryption,omitempty"`
+	EncryptionKey       *string `json:"encryption_key,omitempty" yaml:"encryption_key,omitempty"`               // aes key / passphrase
+	EncryptionPublicKey *string `json:"encryption_public_key,omitempty" yaml:"encryption_public_key,omitempty"` // gpg / age recipients
+
+	// throttling of the write, to limit the load on the target (0 is no limit)
+	RowsPerSecond  *int64 `json:"rows_per_second,omitempty" yaml:"rows_per_second,omitempty"`
+	BytesPerSecond *int64 `json:"bytes_per_second,omitempty" yaml:"bytes_per_second,omitempty"`
+
+	// cancels the target statements after the number of seconds
+	StatementTimeout *int `json:"statement_timeout,omitempty" yaml:"statement_timeout,omitempty"`
+
+	// encoding of binary values in csv & json files: hex or base64
+	BinaryEncoding *iop.BinaryEncoding `json:"binary_encoding,omitempty" yaml:"binary_encoding,omitempty"`
+
+	// standard metadata columns added to the target, e.g.
+	// `{loaded_at: true, run_id: true, stream: _source, row_hash: false}`
+	AuditColumns AuditColumns `json:"audit_columns,omitempty" yaml:"audit_columns,omitempty"`
+
+	// prunes the previous snapshots of the target table (snapshot mode)
+	SnapshotRetention *SnapshotRetention `json:"snapshot_retention,omitempty" yaml:"snapshot_retention,omitempty"`
+
+	// merge statement template (or path to a sql file) overriding the
+	// generated upsert, e.g. `merge into {target_table} tgt using {temp_table} src ...`
+	MergeSQL *string `json:"merge_sql,omitempty" yaml:"merge_sql,omitempty"`
+
+	// run the optimization statements of the database after the load
+	// (e.g. vacuum analyze, optimize final, recluster)
+	PostLoadOptimize *bool `json:"post_load_optimize,omitempty" yaml:"post_load_optimize,omitempty"`
+
+	// how the loaded temp table is committed into the target table
+	CommitStrategy *CommitStrategy `json:"commit_strategy,omitempty" yaml:"commit_strategy,omitempty"`
+
+	// run same-database tasks on the server: auto, always or never (default)
+	Pushdown *PushdownMode `json:"pushdown,omitempty" yaml:"pushdown,omitempty"`
+
+	// object store folder (s3, gs or azure) through which warehouses transfer
+	// the rows, unloaded by the source and loaded by the target
+	StagingURL *string `json:"staging_url,omitempty" yaml:"staging_url,omitempty"`
+
+	// naming of the temp tables, when table_tmp is not specified (default suffix is _tmp)
+	TempTablePrefix *string `json:"temp_table_prefix,omitempty" yaml:"temp_table_prefix,omitempty"`
+	TempTableSuffix *string `json:"temp_table_suffix,omitempty" yaml:"temp_table_suffix,omitempty"`
 
 	TableKeys database.TableKeys `json:"table_keys,omitempty" yaml:"table_keys,omitempty"`
 	TableTmp  string             `json:"table_tmp,omitempty" yaml:"table_tmp,omitempty"`
 	TableDDL  *string            `json:"table_ddl,omitempty" yaml:"table_ddl,omitempty"`
-	PreSQL    *string            `json:"pre_sql,omitempty" yaml:"pre_sql,omitempty"`
-	PostSQL   *string            `json:"post_sql,omitempty" yaml:"post_sql,omitempty"`
+	PreSQL    *SQLStatements     `json:"pre_sql,omitempty" yaml:"pre_sql,omitempty"`
+	PostSQL   *SQLStatements     `json:"post_sql,omitempty" yaml:"post_sql,omitempty"`
+}
+
+// RowHash is the hash column of the rows, for change detection
+type RowHash struct {
+	iop.RowHashOptions `json:",inline" yaml:",inline"`
+	Column             string `json:"column,omitempty" yaml:"column,omitempty"`
+}
+
+// ColumnName returns the name of the hash column
+func (rh *RowHash) ColumnName() string {
+	if rh.Column != "" {
+		return rh.Column
+	}
+	return rowHashColumn
+}
+
+// rowHashColumn returns the name of the row hash column, if any.
+// The audit column name prevails over the source option column.
+func (cfg *Config) rowHashColumn() string {
+	if name := g.PtrVal(cfg.Target.Options).AuditColumns.Name("row_hash"); name != "" {
+		return name
+	} else if rowHash := g.PtrVal(cfg.Source.Options).RowHash; rowHash != nil {
+		return rowHash.ColumnName()
+	}
+	return ""
+}
+
+// IncrementalByHash returns true if only the changed rows are merged, by
+// comparing the row hashes with the target (incremental mode, with a
+// primary key but without an update key)
+func (cfg *Config) IncrementalByHash() bool {
+	return cfg.Mode == IncrementalMode && cfg.Source.UpdateKey == "" &&
+		cfg.Source.HasPrimaryKey() && g.PtrVal(cfg.Source.Options).RowHash != nil
+}
+
+// AuditColumns are the audit metadata columns added to the target.
+// The value is true to add the column with its default name
+// (e.g. `_sling_loaded_at`), a string to rename it, or false to omit it.
+type AuditColumns map[string]any
+
+// AuditColumnKeys are the supported audit columns, with their default names
+var AuditColumnKeys = map[string]string{
+	"loaded_at": slingLoadedAtColumn,
+	"run_id":    slingRunIDColumn,
+	"stream":    slingStreamColumn,
+	"row_hash":  slingRowHashColumn,
+}
+
+// Validate checks the audit column keys and values
+func (ac AuditColumns) Validate() error {
+	for key, val := range ac {
+		if _, ok := AuditColumnKeys[key]; !ok {
+			return g.Error("invalid audit column (%s). Expected one of: loaded_at, run_id, stream, row_hash", key)
+		}
+		switch v := val.(type) {
+		case nil, bool:
+		case string:
+			if strings.TrimSpace(v) == "" {
+				return g.Error("audit column name is empty for %s", key)
+			}
+		default:
+			return g.Error("invalid value for audit column %s: expected a boolean or a column name", key)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the audit column, or empty if not enabled
+func (ac AuditColumns) Name(key string) string {
+	switch v := ac[key].(type) {
+	case bool:
+		if v {
+			return AuditColumnKeys[key]
+		}
+	case string:
+		return strings.TrimSpace(v)
+	}
+	return ""
+}
+
+// SnapshotRetention is how many snapshots are kept in snapshot mode
+type SnapshotRetention struct {
+	Days int `json:"days,omitempty" yaml:"days,omitempty"` // keeps the snapshots of the last N days
+	Runs int `json:"runs,omitempty" yaml:"runs,omitempty"` // keeps the last N snapshots
+}
+
+// Validate checks the retention values
+func (sr *SnapshotRetention) Validate(mode Mode) error {
+	if sr == nil {
+		return nil
+	} else if mode != SnapshotMode {
+		return g.Error("snapshot_retention is only supported with the snapshot mode")
+	} else if sr.Days < 0 || sr.Runs < 0 || (sr.Days == 0 && sr.Runs == 0) {
+		return g.Error("snapshot_retention requires a positive number of days and/or runs")
+	}
+	return nil
+}
+
+// SQLStatement is a pre/post-sql statement (or path to a sql file)
+type SQLStatement struct {
+	SQL     string `json:"sql" yaml:"sql"`
+	OnError string `json:"on_error,omitempty" yaml:"on_error,omitempty"` // `abort` (default) or `warn`
+}
+
+// SQLStatements are the pre/post-sql statements, specified as a single
+// string, or as a list of strings and/or `{sql, on_error}` mappings
+type SQLStatements []SQLStatement
+
+// NewSQLStatements returns the statements of the sql strings
+func NewSQLStatements(sqls ...string) *SQLStatements {
+	statements := SQLStatements{}
+	for _, sql := range sqls {
+		statements = append(statements, SQLStatement{SQL: sql})
+	}
+	return &statements
+}
+
+// String returns the statements joined
+func (ss *SQLStatements) String() string {
+	if ss == nil {
+		return ""
+	}
+	sqls := make([]string, len(*ss))
+	for i, statement := range *ss {
+		sqls[i] = statement.SQL
+	}
+	return strings.Join(sqls, ";\n")
+}
+
+// Validate checks the error policies of the statements
+func (ss *SQLStatements) Validate() error {
+	for _, statement := range g.PtrVal(ss) {
+		if !g.In(strings.ToLower(statement.OnError), "", "abort", "warn") {
+			return g.Error("invalid on_error value (%s). Expected abort or warn", statement.OnError)
+		}
+	}
+	return nil
+}
+
+// tolerant returns true if a statement only warns on error
+func (ss *SQLStatements) tolerant() bool {
+	for _, statement := range g.PtrVal(ss) {
+		if strings.EqualFold(statement.OnError, "warn") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SQLStatement) UnmarshalJSON(data []byte) error {
+	var sql string
+	if err := json.Unmarshal(data, &sql); err == nil {
+		*s = SQLStatement{SQL: sql}
+		return nil
+	}
+
+	type statement SQLStatement // no recursion
+	if err := json.Unmarshal(data, (*statement)(s)); err != nil {
+		return g.Error(err, "sql statement must be a string or a mapping with `sql` & `on_error`")
+	}
+	return nil
+}
+
+func (s SQLStatement) MarshalJSON() ([]byte, error) {
+	if s.OnError == "" {
+		return json.Marshal(s.SQL)
+	}
+	type statement SQLStatement // no recursion
+	return json.Marshal(statement(s))
+}
+
+func (ss *SQLStatements) UnmarshalJSON(data []byte) error {
+	var sql string
+	if err := json.Unmarshal(data, &sql); err == nil {
+		*ss = SQLStatements{} // an empty string overrides the defaults
+		if sql != "" {
+			*ss = append(*ss, SQLStatement{SQL: sql})
+		}
+		return nil
+	}
+
+	statements := []SQLStatement{}
+	if err := json.Unmarshal(data, &statements); err != nil {
+		return g.Error(err, "sql statements must be a string or a list")
+	}
+	*ss = statements
+	return nil
+}
+
+func (ss SQLStatements) MarshalJSON() ([]byte, error) {
+	switch {
+	case len(ss) == 0:
+		return json.Marshal("")
+	case len(ss) == 1 && ss[0].OnError == "":
+		return json.Marshal(ss[0].SQL)
+	}
+	return json.Marshal([]SQLStatement(ss))
+}
+
+func (ss *SQLStatements) UnmarshalYAML(unmarshal func(any) error) error {
+	var value any
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	return ss.UnmarshalJSON([]byte(g.Marshal(value)))
 }
 
 var SourceFileOptionsDefault = SourceOptions{
@@ -1479,6 +2455,9 @@ func (o *SourceOptions) SetDefaults(sourceOptions SourceOptions) {
 	if o.Compression == nil {
 		o.Compression = sourceOptions.Compression
 	}
+	if o.Encoding == nil {
+		o.Encoding = sourceOptions.Encoding
+	}
 	if o.NullIf == nil {
 		o.NullIf = sourceOptions.NullIf
 	}
@@ -1512,6 +2491,132 @@ func (o *SourceOptions) SetDefaults(sourceOptions SourceOptions) {
 	if o.MaxDecimals == nil {
 		o.MaxDecimals = sourceOptions.MaxDecimals
 	}
+	if o.Filter == nil {
+		o.Filter = sourceOptions.Filter
+	}
+	if o.FlattenDepth == nil {
+		o.FlattenDepth = sourceOptions.FlattenDepth
+	}
+	if o.FlattenSeparator == nil {
+		o.FlattenSeparator = sourceOptions.FlattenSeparator
+	}
+	if o.FlattenArrays == nil {
+		o.FlattenArrays = sourceOptions.FlattenArrays
+	}
+	if o.Deduplicate == nil {
+		o.Deduplicate = sourceOptions.Deduplicate
+	}
+	if o.DeduplicateKeys == nil {
+		o.DeduplicateKeys = sourceOptions.DeduplicateKeys
+	}
+	if o.DeduplicateKeep == nil {
+		o.DeduplicateKeep = sourceOptions.DeduplicateKeep
+	}
+	if o.PartitionBy == nil {
+		o.PartitionBy = sourceOptions.PartitionBy
+	}
+	if o.PythonTransform == nil {
+		o.PythonTransform = sourceOptions.PythonTransform
+	}
+	if o.WasmTransform == nil {
+		o.WasmTransform = sourceOptions.WasmTransform
+	}
+	if o.KeyDiscovery == nil {
+		o.KeyDiscovery = sourceOptions.KeyDiscovery
+	}
+	if o.ReadConcurrency == nil {
+		o.ReadConcurrency = sourceOptions.ReadConcurrency
+	}
+	if o.FileSplitSize == nil {
+		o.FileSplitSize = sourceOptions.FileSplitSize
+	}
+	if o.MemoryLimit == nil {
+		o.MemoryLimit = sourceOptions.MemoryLimit
+	}
+	if o.Threads == nil {
+		o.Threads = sourceOptions.Threads
+	}
+	if o.TempDirectory == nil {
+		o.TempDirectory = sourceOptions.TempDirectory
+	}
+	if o.OnSeen == nil {
+		o.OnSeen = sourceOptions.OnSeen
+	}
+	if o.AfterRead == nil {
+		o.AfterRead = sourceOptions.AfterRead
+	}
+	if o.FileWatermark == nil {
+		o.FileWatermark = sourceOptions.FileWatermark
+	}
+	if o.FileNamePattern == nil {
+		o.FileNamePattern = sourceOptions.FileNamePattern
+	}
+	if o.FileNameTimeFormat == nil {
+		o.FileNameTimeFormat = sourceOptions.FileNameTimeFormat
+	}
+	if o.Encryption == nil {
+		o.Encryption = sourceOptions.Encryption
+	}
+	if o.EncryptionKey == nil {
+		o.EncryptionKey = sourceOptions.EncryptionKey
+	}
+	if o.EncryptionPrivateKey == nil {
+		o.EncryptionPrivateKey = sourceOptions.EncryptionPrivateKey
+	}
+	if o.SnapshotID == nil {
+		o.SnapshotID = sourceOptions.SnapshotID
+	}
+	if o.SnapshotTimestamp == nil {
+		o.SnapshotTimestamp = sourceOptions.SnapshotTimestamp
+	}
+	if o.RowsPerSecond == nil {
+		o.RowsPerSecond = sourceOptions.RowsPerSecond
+	}
+	if o.BytesPerSecond == nil {
+		o.BytesPerSecond = sourceOptions.BytesPerSecond
+	}
+	if o.QueryTimeout == nil {
+		o.QueryTimeout = sourceOptions.QueryTimeout
+	}
+	if o.Lookback == nil {
+		o.Lookback = sourceOptions.Lookback
+	}
+	if o.RowHash == nil {
+		o.RowHash = sourceOptions.RowHash
+	}
+	if o.BinaryMaxSize == nil {
+		o.BinaryMaxSize = sourceOptions.BinaryMaxSize
+	}
+	if o.BinaryOverflow == nil {
+		o.BinaryOverflow = sourceOptions.BinaryOverflow
+	}
+	if o.FieldMaxSize == nil {
+		o.FieldMaxSize = sourceOptions.FieldMaxSize
+	}
+	if o.RowMaxSize == nil {
+		o.RowMaxSize = sourceOptions.RowMaxSize
+	}
+	if o.OversizePolicy == nil {
+		o.OversizePolicy = sourceOptions.OversizePolicy
+	}
+	if o.RejectFile == nil {
+		o.RejectFile = sourceOptions.RejectFile
+	}
+	if o.OnError == nil {
+		o.OnError = sourceOptions.OnError
+	}
+	if o.RejectTable == nil {
+		o.RejectTable = sourceOptions.RejectTable
+	}
+	if o.MicroBatchRows == nil {
+		o.MicroBatchRows = sourceOptions.MicroBatchRows
+	}
+	if o.MicroBatchInterval == nil {
+		o.MicroBatchInterval = sourceOptions.MicroBatchInterval
+	}
+	if o.Socket == nil {
+		o.Socket = sourceOptions.Socket
+	}
 	if o.Columns == nil {
 		o.Columns = sourceOptions.Columns // legacy
 	}
@@ -1532,6 +2637,12 @@ func (o *TargetOptions) SetDefaults(targetOptions TargetOptions) {
 	if o.Compression == nil {
 		o.Compression = targetOptions.Compression
 	}
+	if o.CompressionLevel == nil {
+		o.CompressionLevel = targetOptions.CompressionLevel
+	}
+	if o.Encoding == nil {
+		o.Encoding = targetOptions.Encoding
+	}
 	if o.Compression != nil {
 		o.Compression = o.Compression.Normalize()
 	}
@@ -1545,12 +2656,54 @@ func (o *TargetOptions) SetDefaults(targetOptions TargetOptions) {
 	if o.BatchLimit == nil {
 		o.BatchLimit = targetOptions.BatchLimit
 	}
+	if o.LoadMethod == nil {
+		o.LoadMethod = targetOptions.LoadMethod
+	}
+	if o.CopyOptions == nil {
+		o.CopyOptions = targetOptions.CopyOptions
+	}
+	if o.BatchSize == nil {
+		o.BatchSize = targetOptions.BatchSize
+	}
+	if o.MaxInFlightBatches == nil {
+		o.MaxInFlightBatches = targetOptions.MaxInFlightBatches
+	}
 	if o.FileMaxRows == nil {
 		o.FileMaxRows = targetOptions.FileMaxRows
 	}
 	if o.FileMaxBytes == nil {
 		o.FileMaxBytes = targetOptions.FileMaxBytes
 	}
+	if o.PartNumberPadding == nil {
+		o.PartNumberPadding = targetOptions.PartNumberPadding
+	}
+	if o.FolderMaxFiles == nil {
+		o.FolderMaxFiles = targetOptions.FolderMaxFiles
+	}
+	if o.UploadPartSize == nil {
+		o.UploadPartSize = targetOptions.UploadPartSize
+	}
+	if o.UploadConcurrency == nil {
+		o.UploadConcurrency = targetOptions.UploadConcurrency
+	}
+	if o.UploadMaxRetries == nil {
+		o.UploadMaxRetries = targetOptions.UploadMaxRetries
+	}
+	if o.UploadRetryDelay == nil {
+		o.UploadRetryDelay = targetOptions.UploadRetryDelay
+	}
+	if o.UploadMaxRetryDelay == nil {
+		o.UploadMaxRetryDelay = targetOptions.UploadMaxRetryDelay
+	}
+	if o.UploadChecksum == nil {
+		o.UploadChecksum = targetOptions.UploadChecksum
+	}
+	if o.StorageClass == nil {
+		o.StorageClass = targetOptions.StorageClass
+	}
+	if o.KmsKeyID == nil {
+		o.KmsKeyID = targetOptions.KmsKeyID
+	}
 	if o.UseBulk == nil {
 		o.UseBulk = targetOptions.UseBulk
 	}
@@ -1572,6 +2725,21 @@ func (o *TargetOptions) SetDefaults(targetOptions TargetOptions) {
 	if o.TableDDL == nil {
 		o.TableDDL = targetOptions.TableDDL
 	}
+	if o.ColumnChanges == nil {
+		o.ColumnChanges = targetOptions.ColumnChanges
+	}
+	if o.ColumnChanges != nil {
+		// column_changes takes precedence over add_new_columns & adjust_column_type
+		*o.ColumnChanges = ColumnChanges(strings.ToLower(string(*o.ColumnChanges)))
+		switch *o.ColumnChanges {
+		case ColumnChangesAdd:
+			o.AddNewColumns, o.AdjustColumnType = g.Bool(true), g.Bool(false)
+		case ColumnChangesAlter:
+			o.AddNewColumns, o.AdjustColumnType = g.Bool(true), g.Bool(true)
+		case ColumnChangesIgnore, ColumnChangesError:
+			o.AddNewColumns, o.AdjustColumnType = g.Bool(false), g.Bool(false)
+		}
+	}
 	if o.AdjustColumnType == nil {
 		o.AdjustColumnType = targetOptions.AdjustColumnType
 	}
@@ -1588,15 +2756,150 @@ func (o *TargetOptions) SetDefaults(targetOptions TargetOptions) {
 	if o.MaxDecimals == nil {
 		o.MaxDecimals = targetOptions.MaxDecimals
 	}
+	if o.IdentifierCasing == nil {
+		o.IdentifierCasing = targetOptions.IdentifierCasing
+	}
+	if o.IdentifierQuoting == nil {
+		o.IdentifierQuoting = targetOptions.IdentifierQuoting
+	}
+	if o.ColumnSanitizer == nil {
+		o.ColumnSanitizer = targetOptions.ColumnSanitizer
+	}
+	if o.ColumnCasing == nil && o.IdentifierCasing != nil {
+		o.ColumnCasing = g.Ptr(o.IdentifierCasing.ColumnCasing())
+	}
 	if o.ColumnCasing == nil {
 		o.ColumnCasing = targetOptions.ColumnCasing
 	}
+	if o.AddColumnComments == nil {
+		o.AddColumnComments = targetOptions.AddColumnComments
+	}
+	if o.AddNotNull == nil {
+		o.AddNotNull = targetOptions.AddNotNull
+	}
+	if o.AddPrimaryKey == nil {
+		o.AddPrimaryKey = targetOptions.AddPrimaryKey
+	}
+	if o.UpdateColumns == nil {
+		o.UpdateColumns = targetOptions.UpdateColumns
+	}
+	if o.IgnoreUpdateColumns == nil {
+		o.IgnoreUpdateColumns = targetOptions.IgnoreUpdateColumns
+	}
+	if o.PartitionBy == nil {
+		o.PartitionBy = targetOptions.PartitionBy
+	}
+	if o.PartitionType == nil {
+		o.PartitionType = targetOptions.PartitionType
+	}
+	if o.PartitionType != nil {
+		o.PartitionType = g.String(strings.ToLower(*o.PartitionType))
+	}
+	if o.PartitionExpirationDays == nil {
+		o.PartitionExpirationDays = targetOptions.PartitionExpirationDays
+	}
+	if o.ClusterBy == nil {
+		o.ClusterBy = targetOptions.ClusterBy
+	}
+	if o.TimeSeries == nil {
+		o.TimeSeries = targetOptions.TimeSeries
+	}
+	if o.Graph == nil {
+		o.Graph = targetOptions.Graph
+	}
+	if o.Encryption == nil {
+		o.Encryption = targetOptions.Encryption
+	}
+	if o.EncryptionKey == nil {
+		o.EncryptionKey = targetOptions.EncryptionKey
+	}
+	if o.EncryptionPublicKey == nil {
+		o.EncryptionPublicKey = targetOptions.EncryptionPublicKey
+	}
+	if o.RowsPerSecond == nil {
+		o.RowsPerSecond = targetOptions.RowsPerSecond
+	}
+	if o.BytesPerSecond == nil {
+		o.BytesPerSecond = targetOptions.BytesPerSecond
+	}
+	if o.StatementTimeout == nil {
+		o.StatementTimeout = targetOptions.StatementTimeout
+	}
+	if o.AuditColumns == nil {
+		o.AuditColumns = targetOptions.AuditColumns
+	}
+	if o.BinaryEncoding == nil {
+		o.BinaryEncoding = targetOptions.BinaryEncoding
+	}
+	if o.SnapshotRetention == nil {
+		o.SnapshotRetention = targetOptions.SnapshotRetention
+	}
+	if o.MergeSQL == nil {
+		o.MergeSQL = targetOptions.MergeSQL
+	}
+	if o.PostLoadOptimize == nil {
+		o.PostLoadOptimize = targetOptions.PostLoadOptimize
+	}
+	if o.CommitStrategy == nil {
+		o.CommitStrategy = targetOptions.CommitStrategy
+	}
+	if o.Pushdown == nil {
+		o.Pushdown = targetOptions.Pushdown
+	}
+	if o.StagingURL == nil {
+		o.StagingURL = targetOptions.StagingURL
+	}
+	if o.TempTablePrefix == nil {
+		o.TempTablePrefix = targetOptions.TempTablePrefix
+	}
+	if o.TempTableSuffix == nil {
+		o.TempTableSuffix = targetOptions.TempTableSuffix
+	}
 	if o.TableKeys == nil {
 		o.TableKeys = targetOptions.TableKeys
 		if o.TableKeys == nil {
 			o.TableKeys = database.TableKeys{}
 		}
 	}
+
+	// partition_by & cluster_by are shorthands for the table keys
+	if o.PartitionBy != nil && len(*o.PartitionBy) > 0 && len(o.TableKeys[iop.PartitionKey]) == 0 {
+		o.TableKeys = lo.Assign(o.TableKeys) // don't mutate defaults
+		o.TableKeys[iop.PartitionKey] = *o.PartitionBy
+	}
+	if o.ClusterBy != nil && len(*o.ClusterBy) > 0 && len(o.TableKeys[iop.ClusterKey]) == 0 {
+		o.TableKeys = lo.Assign(o.TableKeys)
+		o.TableKeys[iop.ClusterKey] = *o.ClusterBy
+	}
+}
+
+// addColumnDetails returns true if source column details need to be
+// propagated to the target table on creation
+func (o *TargetOptions) addColumnDetails() bool {
+	return o != nil && (g.PtrVal(o.AddColumnComments) || g.PtrVal(o.AddNotNull) || g.PtrVal(o.AddPrimaryKey))
+}
+
+// commitStrategy returns the lower-cased commit strategy (empty if default)
+func (o *TargetOptions) commitStrategy() CommitStrategy {
+	if o == nil || o.CommitStrategy == nil {
+		return ""
+	}
+	return CommitStrategy(strings.ToLower(string(*o.CommitStrategy)))
+}
+
+// tempTableAffixes returns the prefix and suffix of the temp table names
+func (o *TargetOptions) tempTableAffixes() (prefix, suffix string) {
+	prefix, suffix = "", "_tmp"
+	if o == nil {
+		return
+	}
+	if o.TempTablePrefix != nil {
+		prefix = *o.TempTablePrefix
+	}
+	if o.TempTableSuffix != nil {
+		suffix = *o.TempTableSuffix
+	}
+	return
 }
 
 func castKeyArray(keyI any) (key []string) {
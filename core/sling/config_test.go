@@ -2,11 +2,16 @@ package sling
 
 import (
 	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/flarco/g"
 	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
 	"github.com/slingdata-io/sling-cli/core/dbio/iop"
 	"github.com/spf13/cast"
 	"github.com/stretchr/testify/assert"
@@ -86,3 +91,209 @@ func TestColumnCasing(t *testing.T) {
 	applyColumnCasingToDf(df, dbio.TypeDbDuckDb, &snakeCasing)
 	assert.Equal(t, "dhl_original_tracking_number", df.Columns[0].Name)
 }
+
+func TestColumnsPreparedDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Target.Columns = map[string]any{
+		"id":     "bigint",
+		"status": map[any]any{"type": "string", "default": "'active'"},
+		"amount": map[string]any{"default": 0},
+	}
+
+	columns := cfg.ColumnsPrepared()
+	if assert.Len(t, columns, 3) {
+		assert.Equal(t, iop.BigIntType, columns.GetColumn("id").Type)
+		assert.Nil(t, columns.GetColumn("id").Default)
+		assert.Equal(t, iop.StringType, columns.GetColumn("status").Type)
+		assert.Equal(t, "'active'", columns.GetColumn("status").Default)
+		assert.EqualValues(t, 0, columns.GetColumn("amount").Default)
+	}
+
+	cols := applyColumnDefaults(cfg, iop.NewColumnsFromFields("AMOUNT", "other"))
+	assert.EqualValues(t, 0, cols[0].Default)
+	assert.Nil(t, cols[1].Default)
+
+	// only default provided, type is kept
+	cols = iop.Columns{{Name: "amount", Type: iop.DecimalType}}.Coerce(columns, true)
+	assert.Equal(t, iop.DecimalType, cols[0].Type)
+	assert.EqualValues(t, 0, cols[0].Default)
+}
+
+func TestColumnChanges(t *testing.T) {
+	cases := []struct {
+		policy           ColumnChanges
+		addNewColumns    bool
+		adjustColumnType bool
+	}{
+		{ColumnChangesAdd, true, false},
+		{ColumnChangesAlter, true, true},
+		{"IGNORE", false, false},
+		{ColumnChangesError, false, false},
+	}
+
+	for _, c := range cases {
+		options := &TargetOptions{ColumnChanges: g.Ptr(c.policy), AdjustColumnType: g.Bool(!c.adjustColumnType)}
+		options.SetDefaults(TargetDBOptionsDefault)
+		assert.Equal(t, c.addNewColumns, *options.AddNewColumns, c.policy)
+		assert.Equal(t, c.adjustColumnType, *options.AdjustColumnType, c.policy)
+	}
+
+	assert.NoError(t, ColumnChangesIgnore.Validate())
+	assert.Error(t, ColumnChanges("drop").Validate())
+
+	// detect added / removed columns against an existing table
+	conn, err := database.NewConn("sqlite://" + filepath.Join(t.TempDir(), "changes.db"))
+	if !assert.NoError(t, err) || !assert.NoError(t, conn.Connect()) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Exec(`create table tgt (id integer, name text)`)
+	assert.NoError(t, err)
+	table, _ := database.ParseTableName("main.tgt", conn.GetType())
+
+	err = checkColumnChanges(conn, table, iop.NewColumns(iop.Column{Name: "ID", Type: iop.IntegerType}, iop.Column{Name: "name", Type: iop.TextType}))
+	assert.NoError(t, err)
+
+	err = checkColumnChanges(conn, table, iop.NewColumns(iop.Column{Name: "id", Type: iop.IntegerType}, iop.Column{Name: "email", Type: iop.TextType}))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "added: email")
+		assert.Contains(t, err.Error(), "removed: name")
+	}
+}
+
+func TestIdentifierCasing(t *testing.T) {
+	options := &TargetOptions{IdentifierCasing: g.Ptr(IdentifierCasingSnake)}
+	options.SetDefaults(TargetDBOptionsDefault)
+	assert.Equal(t, iop.SnakeColumnCasing, *options.ColumnCasing)
+
+	// column_casing prevails
+	options = &TargetOptions{IdentifierCasing: g.Ptr(IdentifierCasingUpper), ColumnCasing: g.Ptr(iop.LowerColumnCasing)}
+	options.SetDefaults(TargetDBOptionsDefault)
+	assert.Equal(t, iop.LowerColumnCasing, *options.ColumnCasing)
+
+	assert.NoError(t, IdentifierCasing("PRESERVE").Validate())
+	assert.ErrorContains(t, IdentifierCasing("camel").Validate(), "invalid identifier_casing value")
+	assert.ErrorContains(t, dbio.IdentifierQuoting("sometimes").Validate(), "invalid identifier_quoting value")
+
+	folder := t.TempDir()
+	t.Setenv("CASING_SQLITE", "sqlite://"+filepath.Join(folder, "casing.db"))
+	connection.GetLocalConns(true) // refresh the cached connections
+
+	replication, err := LoadReplicationConfig(`
+source: CASING_SQLITE
+target: CASING_SQLITE
+defaults:
+  mode: full-refresh
+  target_options:
+    identifier_casing: snake_case
+    identifier_quoting: as-needed
+streams:
+  orders:
+    sql: select 1 as "orderId", 2 as "Line Number"
+    object: main.OpenOrders
+`)
+	if !assert.NoError(t, err) || !assert.NoError(t, replication.Compile(nil)) {
+		return
+	}
+	assert.Equal(t, `"main"."open_orders"`, replication.Tasks[0].Target.Object)
+
+	plans, err := replication.PreviewSQL()
+	if assert.NoError(t, err) && assert.Len(t, plans, 1) {
+		statements := strings.Join(plans[0].Statements, "\n")
+		assert.Contains(t, statements, "insert into main.open_orders (order_id, line_number) select order_id, line_number from main.open_orders_tmp")
+	}
+
+	task := NewTask("", replication.Tasks[0])
+	if assert.NoError(t, task.Execute()) {
+		conn, err := database.NewConn(os.Getenv("CASING_SQLITE"))
+		if assert.NoError(t, err) && assert.NoError(t, conn.Connect()) {
+			defer conn.Close()
+			columns, err := conn.GetColumns("main.open_orders")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"order_id", "line_number"}, columns.Names())
+		}
+	}
+
+	// the policy is of the connection, not of the dialect
+	asNeeded, err := database.NewConn(os.Getenv("CASING_SQLITE"), "identifier_quoting=as-needed")
+	if assert.NoError(t, err) {
+		always, _ := database.NewConn(os.Getenv("CASING_SQLITE"))
+		table1, _ := database.ParseConnTableName("main.open_orders", asNeeded)
+		table2, _ := database.ParseConnTableName("main.open_orders", always)
+		assert.Equal(t, "main.open_orders", table1.FullName())
+		assert.Equal(t, `"main"."open_orders"`, table2.FullName())
+		assert.Equal(t, "order_id", asNeeded.Quote("order_id"))
+		assert.Equal(t, `"order_id"`, always.Quote("order_id"))
+	}
+}
+
+func TestApplySourceColumnDetails(t *testing.T) {
+	pkKey := iop.PrimaryKey.MetadataKey()
+	cfg := &Config{}
+	cfg.Target.Options = &TargetOptions{}
+	cfg.Source.columns = iop.Columns{
+		{Name: "id", Metadata: map[string]string{pkKey: "source", "not_null": "true"}},
+		{Name: "name", Description: "the name"},
+	}
+
+	cols := iop.NewColumnsFromFields("ID", "name")
+	assert.Equal(t, cols, applySourceColumnDetails(cfg, cols))
+
+	cfg.Target.Options.AddNotNull = g.Bool(true)
+	cfg.Target.Options.AddPrimaryKey = g.Bool(true)
+	newCols := applySourceColumnDetails(cfg, cols)
+	assert.True(t, newCols[0].IsNotNull())
+	assert.True(t, newCols[0].IsKeyType(iop.PrimaryKey))
+	assert.False(t, newCols[1].IsNotNull())
+	assert.False(t, cols[0].IsNotNull()) // original is untouched
+}
+
+func TestTargetOptionsPartitionBy(t *testing.T) {
+	o := &TargetOptions{
+		PartitionBy:   &[]string{"date_trunc('month', created_at)"},
+		PartitionType: g.String("LIST"),
+		ClusterBy:     &[]string{"id", "name"},
+	}
+	o.SetDefaults(TargetOptions{})
+	assert.Equal(t, "list", *o.PartitionType)
+	assert.Equal(t, []string{"date_trunc('month', created_at)"}, o.TableKeys[iop.PartitionKey])
+	assert.Equal(t, []string{"id", "name"}, o.TableKeys[iop.ClusterKey])
+
+	// explicit table_keys take precedence
+	o = &TargetOptions{
+		PartitionBy: &[]string{"created_at"},
+		TableKeys:   database.TableKeys{iop.PartitionKey: []string{"updated_at"}},
+	}
+	o.SetDefaults(TargetOptions{})
+	assert.Equal(t, []string{"updated_at"}, o.TableKeys[iop.PartitionKey])
+}
+
+func TestChunkCheckpoint(t *testing.T) {
+	t.Setenv("SLING_CHECKPOINT_FOLDER", t.TempDir())
+	chunks := []string{"1,100", "101,200", "201,300"}
+
+	cp, err := LoadChunkCheckpoint("main.src", "1,300", "100", "src", "tgt")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, chunks, cp.Pending(chunks))
+	assert.NoError(t, cp.MarkCompleted("1,100"))
+	assert.FileExists(t, cp.path)
+
+	// resume
+	cp, err = LoadChunkCheckpoint("main.src", "1,300", "100", "src", "tgt")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"101,200", "201,300"}, cp.Pending(chunks))
+	assert.NoError(t, cp.MarkCompleted("101,200"))
+	assert.NoError(t, cp.MarkCompleted("201,300"))
+	assert.NoFileExists(t, cp.path)
+
+	// different chunks reset the checkpoint
+	cp, _ = LoadChunkCheckpoint("main.src", "1,300", "100", "src", "tgt")
+	assert.NoError(t, cp.MarkCompleted("1,100"))
+	cp, _ = LoadChunkCheckpoint("main.src", "1,300", "100", "src", "tgt")
+	assert.Equal(t, []string{"1,150", "151,300"}, cp.Pending([]string{"1,150", "151,300"}))
+}
@@ -0,0 +1,87 @@
+package sling
+
+import (
+	"time"
+
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+)
+
+// CostState is the volume and the estimated warehouse usage of a stream
+// run, for chargeback and optimization
+type CostState struct {
+	BytesRead    uint64  `json:"bytes_read"`             // bytes scanned from the source
+	BytesWritten uint64  `json:"bytes_written"`          // bytes written to the target (files, staging or tables)
+	BytesBilled  int64   `json:"bytes_billed,omitempty"` // bytes processed by the BigQuery query jobs (on-demand billing)
+	Credits      float64 `json:"credits,omitempty"`      // estimated Snowflake credits (warehouse size x duration)
+}
+
+// Add adds the values of the other cost
+func (c *CostState) Add(other CostState) {
+	c.BytesRead += other.BytesRead
+	c.BytesWritten += other.BytesWritten
+	c.BytesBilled += other.BytesBilled
+	c.Credits += other.Credits
+}
+
+// connMeter measures the warehouse usage of a connection during a task
+type connMeter struct {
+	conn        database.Connection
+	start       time.Time
+	bytesBilled int64 // bytes processed at start (connections are reused across streams)
+}
+
+// bytesProcessedConn is a connection which meters the bytes processed
+// by its queries (BigQuery)
+type bytesProcessedConn interface {
+	BytesProcessed() int64
+}
+
+// creditsConn is a connection which is billed in credits per hour (Snowflake)
+type creditsConn interface {
+	CreditsPerHour() float64
+}
+
+// meterConn starts measuring the warehouse usage of the connection
+func (t *TaskExecution) meterConn(conn database.Connection) {
+	for _, meter := range t.meters {
+		if meter.conn == conn {
+			return // same connection for source and target
+		}
+	}
+
+	meter := &connMeter{conn: conn, start: time.Now()}
+	if c, ok := conn.(bytesProcessedConn); ok {
+		meter.bytesBilled = c.BytesProcessed()
+	}
+	t.meters = append(t.meters, meter)
+}
+
+// Cost returns the volume and estimated warehouse usage of the task.
+// Final once the task has ended.
+func (t *TaskExecution) Cost() (cost CostState) {
+	if t.cost != nil {
+		return *t.cost
+	}
+
+	inBytes, outBytes := t.GetBytes()
+	cost.BytesRead = inBytes
+	cost.BytesWritten = outBytes
+	if outBytes == 0 && t.Config != nil && t.Config.TgtConn.Type.IsDb() {
+		cost.BytesWritten = inBytes // inserted as is into the tables
+	}
+
+	end := time.Now()
+	if t.EndTime != nil {
+		end = *t.EndTime
+	}
+	for _, meter := range t.meters {
+		if c, ok := meter.conn.(bytesProcessedConn); ok {
+			cost.BytesBilled += c.BytesProcessed() - meter.bytesBilled
+		}
+		if c, ok := meter.conn.(creditsConn); ok {
+			cost.Credits += c.CreditsPerHour() * end.Sub(meter.start).Hours()
+		}
+	}
+
+	return cost
+}
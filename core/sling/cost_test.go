@@ -0,0 +1,42 @@
+package sling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/stretchr/testify/assert"
+)
+
+type meteredConn struct {
+	database.Connection
+	bytesProcessed int64
+	creditsPerHour float64
+}
+
+func (c *meteredConn) BytesProcessed() int64   { return c.bytesProcessed }
+func (c *meteredConn) CreditsPerHour() float64 { return c.creditsPerHour }
+
+func TestTaskCost(t *testing.T) {
+	conn := &meteredConn{bytesProcessed: 1000, creditsPerHour: 4}
+
+	task := &TaskExecution{}
+	task.meterConn(conn)
+	task.meterConn(conn) // same source & target connection
+	assert.Len(t, task.meters, 1)
+
+	conn.bytesProcessed = 5000
+	task.meters[0].start = time.Now().Add(-30 * time.Minute)
+	end := task.meters[0].start.Add(15 * time.Minute)
+	task.EndTime = &end
+
+	cost := task.Cost()
+	assert.EqualValues(t, 4000, cost.BytesBilled)
+	assert.InDelta(t, 1.0, cost.Credits, 0.0001) // 4 credits/hour for 15 minutes
+
+	total := CostState{BytesRead: 10}
+	total.Add(cost)
+	total.Add(CostState{BytesRead: 5, Credits: 0.5})
+	assert.EqualValues(t, 15, total.BytesRead)
+	assert.InDelta(t, 1.5, total.Credits, 0.0001)
+}
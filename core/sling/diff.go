@@ -0,0 +1,441 @@
+package sling
+
+import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+)
+
+// DiffOptions are the options to compare a source stream with its target
+type DiffOptions struct {
+	Checksum bool     // compare the aggregated checksum of each column
+	Keys     []string // compare rows by hash, matched by key (defaults to the primary key when sampling)
+	Sample   int      // number of source rows to compare by key, 0 for all the rows
+	Where    string   // filter applied to both the source and the target
+}
+
+// DiffResult is the drift between a source stream and its target object
+type DiffResult struct {
+	Stream      string         `json:"stream"`
+	Source      string         `json:"source"`
+	Target      string         `json:"target"`
+	SourceCount uint64         `json:"source_count"`
+	TargetCount uint64         `json:"target_count"`
+	Columns     []ColumnDiff   `json:"columns,omitempty"`
+	Checksums   []ChecksumDiff `json:"checksums,omitempty"`
+	Rows        *RowsDiff      `json:"rows,omitempty"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// ColumnDiff is a column missing on a side, or with different types
+type ColumnDiff struct {
+	Name       string `json:"name"`
+	SourceType string `json:"source_type,omitempty"`
+	TargetType string `json:"target_type,omitempty"`
+	Issue      string `json:"issue"`
+}
+
+// ChecksumDiff is a column with different checksums
+type ChecksumDiff struct {
+	Column string `json:"column"`
+	Source uint64 `json:"source"`
+	Target uint64 `json:"target"`
+}
+
+// RowsDiff is the result of the keyed comparison of the rows
+type RowsDiff struct {
+	Keys            []string `json:"keys"`
+	Compared        int      `json:"compared"`
+	MissingInTarget int      `json:"missing_in_target"`
+	MissingInSource int      `json:"missing_in_source"` // only when not sampling
+	Mismatched      int      `json:"mismatched"`
+	Examples        []string `json:"examples,omitempty"` // keys of a few drifted rows
+}
+
+// HasDrift returns true if any difference was found
+func (dr DiffResult) HasDrift() bool {
+	return dr.SourceCount != dr.TargetCount || len(dr.Columns) > 0 ||
+		len(dr.Checksums) > 0 || dr.Error != "" ||
+		(dr.Rows != nil && dr.Rows.MissingInTarget+dr.Rows.MissingInSource+dr.Rows.Mismatched > 0)
+}
+
+// Diff compares the streams of the replication with their target objects.
+// All the streams are compared, and the drifted streams are reported at once.
+func (rd *ReplicationConfig) Diff(opts DiffOptions) (results []DiffResult, err error) {
+	drifted := []string{}
+	for _, task := range rd.Tasks {
+		if task.ReplicationStream != nil && task.ReplicationStream.Disabled {
+			continue
+		}
+
+		result, err := task.Diff(opts)
+		if err != nil {
+			result.Error = g.ErrMsgSimple(err)
+		}
+		results = append(results, result)
+
+		if result.HasDrift() {
+			drifted = append(drifted, result.Stream)
+		}
+	}
+
+	if len(drifted) > 0 {
+		return results, g.Error("drift found in %d of %d streams: %s", len(drifted), len(results), strings.Join(drifted, ", "))
+	}
+	return results, nil
+}
+
+// diffSide is the source or target of a diff
+type diffSide struct {
+	conn    database.Connection
+	table   database.Table
+	where   string
+	columns iop.Columns
+}
+
+// Diff compares the source stream with the target object: row counts,
+// columns, and optionally the column checksums and the rows by key.
+// Both the source and target must be databases.
+func (cfg *Config) Diff(opts DiffOptions) (result DiffResult, err error) {
+	result.Stream = lo.Ternary(cfg.StreamName != "", cfg.StreamName, cfg.Source.Stream)
+
+	// prepare a copy, so that the config is unchanged
+	task := &Config{}
+	if err = g.Unmarshal(g.Marshal(cfg), task); err != nil {
+		return result, g.Error(err, "could not copy config")
+	} else if err = task.Prepare(); err != nil {
+		return result, g.Error(err, "could not prepare stream %s", result.Stream)
+	}
+
+	if !task.SrcConn.Type.IsDb() || !task.TgtConn.Type.IsDb() {
+		return result, g.Error("diff is only supported between databases (%s -> %s)", task.SrcConn.Type, task.TgtConn.Type)
+	}
+
+	// source filter includes the stream filter
+	srcWhere := task.Source.Where
+	if opts.Where != "" {
+		srcWhere = lo.Ternary(srcWhere == "", opts.Where, g.F("(%s) and (%s)", srcWhere, opts.Where))
+	}
+
+	src, err := newDiffSide(task.SrcConn.Name, &task.SrcConn, task.Source.Stream, srcWhere)
+	if err != nil {
+		return result, g.Error(err, "could not init source")
+	}
+	defer src.conn.Close()
+	result.Source = task.SrcConn.Name + "." + lo.Ternary(src.table.IsQuery(), "(sql)", src.table.FullName())
+
+	tgt, err := newDiffSide(task.TgtConn.Name, &task.TgtConn, task.Target.Object, opts.Where)
+	if err != nil {
+		return result, g.Error(err, "could not init target")
+	}
+	defer tgt.conn.Close()
+	result.Target = task.TgtConn.Name + "." + tgt.table.FullName()
+
+	if result.SourceCount, err = src.count(); err != nil {
+		return result, g.Error(err, "could not count source rows")
+	}
+	if result.TargetCount, err = tgt.count(); err != nil {
+		return result, g.Error(err, "could not count target rows")
+	}
+
+	// common columns, by source column name
+	common := map[string]iop.Column{}
+	tgtCols := lo.KeyBy(tgt.columns, func(c iop.Column) string { return strings.ToLower(c.Name) })
+	for _, srcCol := range src.columns {
+		tgtCol, ok := tgtCols[strings.ToLower(srcCol.Name)]
+		switch {
+		case !ok:
+			result.Columns = append(result.Columns, ColumnDiff{Name: srcCol.Name, SourceType: string(srcCol.Type), Issue: "missing in target"})
+		case diffTypeKind(srcCol.Type) != diffTypeKind(tgtCol.Type):
+			result.Columns = append(result.Columns, ColumnDiff{Name: srcCol.Name, SourceType: string(srcCol.Type), TargetType: string(tgtCol.Type), Issue: "type mismatch"})
+		default:
+			common[srcCol.Name] = tgtCol
+		}
+	}
+	srcCols := lo.KeyBy(src.columns, func(c iop.Column) string { return strings.ToLower(c.Name) })
+	for _, tgtCol := range tgt.columns {
+		if _, ok := srcCols[strings.ToLower(tgtCol.Name)]; !ok && !strings.HasPrefix(strings.ToLower(tgtCol.Name), "_sling_") {
+			result.Columns = append(result.Columns, ColumnDiff{Name: tgtCol.Name, TargetType: string(tgtCol.Type), Issue: "missing in source"})
+		}
+	}
+
+	// common columns in the source order
+	srcCommon := lo.Filter(src.columns, func(c iop.Column, i int) bool { _, ok := common[c.Name]; return ok })
+	tgtCommon := lo.Map(srcCommon, func(c iop.Column, i int) iop.Column { return common[c.Name] })
+
+	if opts.Checksum && len(srcCommon) > 0 {
+		srcSums, err := src.checksums(srcCommon)
+		if err != nil {
+			return result, g.Error(err, "could not get source checksums")
+		}
+		tgtSums, err := tgt.checksums(tgtCommon)
+		if err != nil {
+			return result, g.Error(err, "could not get target checksums")
+		}
+		for i, col := range srcCommon {
+			if srcSums[i] != tgtSums[i] {
+				result.Checksums = append(result.Checksums, ChecksumDiff{Column: col.Name, Source: srcSums[i], Target: tgtSums[i]})
+			}
+		}
+	}
+
+	keys := opts.Keys
+	if len(keys) == 0 && opts.Sample > 0 {
+		keys = task.Source.PrimaryKey()
+	}
+	if len(keys) > 0 || opts.Sample > 0 {
+		if len(keys) == 0 {
+			return result, g.Error("must specify keys (or a primary key) to compare rows")
+		}
+		result.Rows, err = diffRows(src, tgt, srcCommon, tgtCommon, keys, opts.Sample)
+		if err != nil {
+			return result, g.Error(err, "could not compare rows")
+		}
+	}
+
+	return result, nil
+}
+
+func newDiffSide(name string, conn *connection.Connection, stream, where string) (side *diffSide, err error) {
+	side = &diffSide{where: where}
+
+	side.conn, err = conn.AsDatabase()
+	if err != nil {
+		return nil, g.Error(err, "could not init connection %s", name)
+	} else if err = side.conn.Connect(); err != nil {
+		return nil, g.Error(err, "could not connect to %s", name)
+	}
+
+	side.table, err = database.ParseTableName(stream, side.conn.GetType())
+	if err != nil {
+		return nil, g.Error(err, "could not parse %s", stream)
+	}
+
+	if side.table.IsQuery() {
+		side.columns, err = side.conn.GetSQLColumns(side.table)
+	} else {
+		side.columns, err = side.conn.GetColumns(side.table.FullName())
+	}
+	if err != nil {
+		return nil, g.Error(err, "could not get columns of %s", stream)
+	}
+
+	return side, nil
+}
+
+// from returns the table (or the query as a sub-query) with the filter
+func (side *diffSide) from(where ...string) string {
+	from := side.table.FullName()
+	if side.table.IsQuery() {
+		from = g.F("(\n%s\n) t", side.table.SQL)
+	}
+
+	wheres := lo.Compact(append([]string{side.where}, where...))
+	if len(wheres) > 0 {
+		from = g.F("%s where (%s)", from, strings.Join(wheres, ") and ("))
+	}
+	return from
+}
+
+func (side *diffSide) count() (uint64, error) {
+	data, err := side.conn.Query(g.F("select count(*) cnt from %s", side.from()))
+	if err != nil {
+		return 0, err
+	} else if len(data.Rows) == 0 {
+		return 0, g.Error("no rows returned")
+	}
+	return cast.ToUint64(data.Rows[0][0]), nil
+}
+
+// checksums returns the aggregated checksum of each column
+func (side *diffSide) checksums(columns iop.Columns) (sums []uint64, err error) {
+	exprs := lo.Map(columns, func(col iop.Column, i int) string {
+		return g.F("sum(%s) as c%d", side.conn.ChecksumExpr(col, col.Name), i)
+	})
+
+	data, err := side.conn.Query(g.F("select %s from %s", strings.Join(exprs, ", "), side.from()))
+	if err != nil {
+		return nil, err
+	} else if len(data.Rows) == 0 || len(data.Rows[0]) != len(columns) {
+		return nil, g.Error("unexpected checksum result")
+	}
+
+	for _, val := range data.Rows[0] {
+		sums = append(sums, uint64(cast.ToFloat64(val)))
+	}
+	return sums, nil
+}
+
+// rows streams the key values & hash of the rows
+func (side *diffSide) rows(columns iop.Columns, keys []string, limit int, where string, each func(keyVals []any, hash uint64)) (err error) {
+	fields := append([]string{}, keys...)
+	fields = append(fields, columns.Names()...)
+	fields = lo.Map(fields, func(f string, i int) string { return side.conn.Quote(f) })
+
+	table := side.table
+	selectOpts := database.SelectOptions{Fields: fields, Limit: limit}
+	if table.IsQuery() {
+		// filter the query as a sub-query
+		table = database.Table{SQL: g.F("select * from %s", side.from(where)), Dialect: table.Dialect}
+	} else {
+		selectOpts.Where = strings.Join(lo.Compact([]string{side.where, where}), ") and (")
+		if selectOpts.Where != "" {
+			selectOpts.Where = "(" + selectOpts.Where + ")"
+		}
+	}
+
+	ds, err := side.conn.StreamRows(table.Select(selectOpts))
+	if err != nil {
+		return err
+	}
+
+	for row := range ds.Rows() {
+		each(row[:len(keys)], diffRowHash(row[len(keys):], columns))
+	}
+	return ds.Err()
+}
+
+// diffKey returns the key of the row, normalized by type
+func diffKey(keyVals []any, keyCols iop.Columns) string {
+	return strings.Join(lo.Map(keyVals, func(v any, i int) string { return diffNormalize(v, keyCols[i].Type) }), "|")
+}
+
+// diffRows compares the rows by key. When sampling, the first rows of the
+// source are looked up in the target, by batches of keys.
+func diffRows(src, tgt *diffSide, srcColumns, tgtColumns iop.Columns, keys []string, sample int) (rows *RowsDiff, err error) {
+	rows = &RowsDiff{Keys: keys}
+
+	addExample := func(key string) {
+		if len(rows.Examples) < 10 {
+			rows.Examples = append(rows.Examples, key)
+		}
+	}
+
+	srcKeyCols := iop.Columns{}
+	for _, key := range keys {
+		col := src.columns.GetColumn(key)
+		if col == nil || tgt.columns.GetColumn(key) == nil {
+			return nil, g.Error("key column %s not found in source and target", key)
+		}
+		srcKeyCols = append(srcKeyCols, *col)
+	}
+	srcKeys := srcKeyCols.Names()
+	tgtKeys := lo.Map(keys, func(k string, i int) string { return tgt.columns.GetColumn(k).Name })
+
+	// hashes & key values of the source rows, by key
+	srcHashes := map[string]uint64{}
+	srcKeyVals := map[string][]any{}
+	err = src.rows(srcColumns, srcKeys, sample, "", func(keyVals []any, hash uint64) {
+		key := diffKey(keyVals, srcKeyCols)
+		srcHashes[key] = hash
+		if sample > 0 {
+			srcKeyVals[key] = keyVals
+		}
+	})
+	if err != nil {
+		return nil, g.Error(err, "could not read source rows")
+	}
+	rows.Compared = len(srcHashes)
+
+	compare := func(keyVals []any, hash uint64) {
+		key := diffKey(keyVals, srcKeyCols)
+		srcHash, ok := srcHashes[key]
+		if !ok {
+			if sample == 0 {
+				rows.MissingInSource++
+				addExample(key)
+			}
+			return
+		}
+		if srcHash != hash {
+			rows.Mismatched++
+			addExample(key)
+		}
+		delete(srcHashes, key)
+	}
+
+	if sample == 0 {
+		if err = tgt.rows(tgtColumns, tgtKeys, 0, "", compare); err != nil {
+			return nil, g.Error(err, "could not read target rows")
+		}
+	} else {
+		// look up the sampled keys in the target, by batches
+		for _, batch := range lo.Chunk(lo.Keys(srcKeyVals), 200) {
+			conds := lo.Map(batch, func(key string, i int) string {
+				exprs := lo.Map(tgtKeys, func(k string, j int) string {
+					val := iop.FormatValue(srcKeyVals[key][j], srcKeyCols[j].Type, tgt.conn.GetType())
+					return g.F("%s = %s", tgt.conn.Quote(k), val)
+				})
+				return "(" + strings.Join(exprs, " and ") + ")"
+			})
+			if err = tgt.rows(tgtColumns, tgtKeys, 0, strings.Join(conds, " or "), compare); err != nil {
+				return nil, g.Error(err, "could not read target rows")
+			}
+		}
+	}
+
+	// remaining source rows were not found in target
+	for key := range srcHashes {
+		rows.MissingInTarget++
+		addExample(key)
+	}
+
+	return rows, nil
+}
+
+// diffRowHash returns the hash of the row values, normalized by type so
+// that the values of different databases can be compared
+func diffRowHash(row []any, columns iop.Columns) uint64 {
+	h := fnv.New64a()
+	for i, val := range row {
+		h.Write([]byte(diffNormalize(val, columns[i].Type)))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+func diffNormalize(val any, colType iop.ColumnType) string {
+	if val == nil {
+		return "\x00null"
+	}
+
+	switch {
+	case colType.IsNumber():
+		return strconv.FormatFloat(cast.ToFloat64(val), 'f', -1, 64)
+	case colType.IsBool():
+		return cast.ToString(cast.ToBool(val))
+	case colType.IsDate():
+		return cast.ToTime(val).UTC().Format(time.DateOnly)
+	case colType.IsDatetime():
+		return cast.ToTime(val).UTC().Format(time.RFC3339Nano)
+	}
+	return strings.TrimRight(cast.ToString(val), " ")
+}
+
+// diffTypeKind returns the kind of the type, for the types of different
+// databases to be compared
+func diffTypeKind(colType iop.ColumnType) string {
+	switch {
+	case colType.IsJSON():
+		return "json"
+	case colType.IsString():
+		return "string"
+	case colType.IsNumber():
+		return "number"
+	case colType.IsBool():
+		return "bool"
+	case colType.IsDate(), colType.IsDatetime():
+		return "datetime"
+	case colType.IsBinary():
+		return "binary"
+	}
+	return string(colType)
+}
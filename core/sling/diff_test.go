@@ -0,0 +1,77 @@
+package sling
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	dbURL := "sqlite://" + filepath.Join(t.TempDir(), "diff.db")
+	t.Setenv("DIFF_SQLITE", dbURL)
+	connection.GetLocalConns(true) // refresh the cached connections
+
+	conn, err := database.NewConn(dbURL)
+	if !assert.NoError(t, err) || !assert.NoError(t, conn.Connect()) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecMulti(
+		`create table src (id integer, name text, amount decimal(10,2))`,
+		`insert into src values (1, 'a', 1.5), (2, 'b', 2.5), (3, 'c', 3.5)`,
+		`create table tgt (id integer, name text, amount decimal(10,2), extra text)`,
+		`insert into tgt values (1, 'a', 1.5, null), (2, 'B', 2.5, null), (4, 'd', 4.5, null)`,
+		`create table same (id integer, name text, amount decimal(10,2))`,
+		`insert into same select * from src`,
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cfg := &Config{}
+	cfg.Source.Conn = "DIFF_SQLITE"
+	cfg.Source.Stream = "main.src"
+	cfg.Target.Conn = "DIFF_SQLITE"
+	cfg.Target.Object = "main.tgt"
+
+	result, err := cfg.Diff(DiffOptions{Checksum: true, Keys: []string{"id"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, result.HasDrift())
+	assert.EqualValues(t, 3, result.SourceCount)
+	assert.EqualValues(t, 3, result.TargetCount)
+	if assert.Len(t, result.Columns, 1) {
+		assert.Equal(t, ColumnDiff{Name: "extra", TargetType: "text", Issue: "missing in source"}, result.Columns[0])
+	}
+	if assert.Len(t, result.Checksums, 2) { // row 3 vs 4
+		assert.Equal(t, ChecksumDiff{Column: "id", Source: 6, Target: 7}, result.Checksums[0])
+		assert.Equal(t, "amount", result.Checksums[1].Column)
+	}
+	if assert.NotNil(t, result.Rows) {
+		assert.Equal(t, 3, result.Rows.Compared)
+		assert.Equal(t, 1, result.Rows.MissingInTarget)
+		assert.Equal(t, 1, result.Rows.MissingInSource)
+		assert.Equal(t, 1, result.Rows.Mismatched)
+		assert.ElementsMatch(t, []string{"2", "3", "4"}, result.Rows.Examples)
+	}
+
+	// sampled: the source rows are looked up in the target
+	result, err = cfg.Diff(DiffOptions{Keys: []string{"id"}, Sample: 2, Where: "id <= 2"})
+	if assert.NoError(t, err) && assert.NotNil(t, result.Rows) {
+		assert.EqualValues(t, 2, result.SourceCount)
+		assert.Equal(t, 2, result.Rows.Compared)
+		assert.Equal(t, 0, result.Rows.MissingInTarget)
+		assert.Equal(t, 1, result.Rows.Mismatched)
+	}
+
+	cfg.Target.Object = "main.same"
+	result, err = cfg.Diff(DiffOptions{Checksum: true, Keys: []string{"id"}})
+	if assert.NoError(t, err) {
+		assert.False(t, result.HasDrift(), "%#v", result)
+	}
+}
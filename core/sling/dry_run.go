@@ -0,0 +1,386 @@
+package sling
+
+import (
+	"context"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+)
+
+// StreamPlan is the work a stream would do, as resolved by a dry run
+type StreamPlan struct {
+	Stream    string             `json:"stream"`
+	Mode      Mode               `json:"mode"`
+	Source    string             `json:"source"`
+	Target    string             `json:"target"`
+	Object    string             `json:"object"`
+	Watermark *ManifestWatermark `json:"watermark,omitempty"` // the incremental range (or backfill range)
+	SourceSQL string             `json:"source_sql,omitempty"`
+
+	// Rows is the number of rows to read, -1 if unknown.
+	// Estimated with the table statistics when the whole table is read.
+	Rows          int64 `json:"rows"`
+	RowsEstimated bool  `json:"rows_estimated,omitempty"`
+
+	Files []string `json:"files,omitempty"` // the files to read
+	Bytes uint64   `json:"bytes,omitempty"` // the size of the files to read
+
+	// Statements are the DDL / DML which would run on the target
+	Statements []string `json:"statements,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// DryRun resolves the work of every compiled task without writing anything:
+// it connects, resolves the incremental ranges, counts the source rows (or
+// estimates them), lists the files to read, and generates the DDL / DML that
+// would run on the target. All the streams are planned, and the failures are
+// reported at once.
+func (rd *ReplicationConfig) DryRun() (plans []StreamPlan, err error) {
+	return rd.planTasks(true)
+}
+
+// PreviewSQL resolves the SQL statements of every compiled task, with the
+// placeholders resolved, for review before running: the source query, and
+// the DDL / DML (including the pre/post-sql) which would run on the target.
+// Unlike DryRun, the source rows are not counted.
+func (rd *ReplicationConfig) PreviewSQL() (plans []StreamPlan, err error) {
+	return rd.planTasks(false)
+}
+
+// planTasks plans the enabled tasks, reporting the failures at once
+func (rd *ReplicationConfig) planTasks(count bool) (plans []StreamPlan, err error) {
+	failed := []string{}
+	for _, cfg := range rd.Tasks {
+		if cfg.ReplicationStream != nil && cfg.ReplicationStream.Disabled {
+			continue
+		}
+
+		plan := cfg.dryRun(count)
+		if plan.Error != "" {
+			failed = append(failed, g.F("  - %s\n    %s", plan.Stream, plan.Error))
+		}
+		plans = append(plans, plan)
+	}
+
+	if len(failed) > 0 {
+		return plans, g.Error("planning failed for %d of %d streams:\n%s", len(failed), len(plans), strings.Join(failed, "\n"))
+	}
+	return plans, nil
+}
+
+// dryRun returns the plan of the task. The source rows are counted if count.
+func (cfg *Config) dryRun(count bool) (plan StreamPlan) {
+	plan = StreamPlan{
+		Stream: cfg.StreamName,
+		Mode:   cfg.Mode,
+		Source: cfg.Source.Conn,
+		Target: cfg.Target.Conn,
+		Object: cfg.Target.Object,
+		Rows:   -1,
+	}
+	if plan.Stream == "" {
+		plan.Stream = cfg.Source.Stream
+	}
+
+	// prepare a copy, so that the task is prepared at run time
+	task := &Config{}
+	if err := g.Unmarshal(g.Marshal(cfg), task); err != nil {
+		plan.Error = g.ErrMsgSimple(g.Error(err, "could not copy config"))
+		return plan
+	} else if err = task.Prepare(); err != nil {
+		plan.Error = g.ErrMsgSimple(err)
+		return plan
+	}
+	task.ReplicationStream = cfg.ReplicationStream
+	task.SetDefault()
+
+	t := &TaskExecution{
+		ExecID:       NewExecID(),
+		Config:       task,
+		Context:      g.NewContext(context.Background()),
+		df:           iop.NewDataflow(),
+		cleanupFuncs: []func(){},
+	}
+	defer t.Cleanup()
+
+	if err := t.plan(&plan, count); err != nil {
+		plan.Error = g.ErrMsgSimple(err)
+	}
+	plan.Mode, plan.Object = task.Mode, task.Target.Object
+
+	return plan
+}
+
+// plan resolves the reads and the target statements of the task
+func (t *TaskExecution) plan(plan *StreamPlan, count bool) (err error) {
+	cfg := t.Config
+	if cfg.Mode == "" {
+		cfg.Mode = FullRefreshMode
+	}
+
+	var tgtConn database.Connection
+	if cfg.TgtConn.Type.IsDb() {
+		if tgtConn, err = t.getTgtDBConn(t.Context.Ctx); err != nil {
+			return g.Error(err, "could not connect to target")
+		}
+		if !t.isUsingPool() {
+			defer tgtConn.Close()
+		}
+	}
+
+	// resolve the incremental range
+	if t.isIncrementalStateWithUpdateKey() {
+		if err = getIncrementalValueViaState(t); err != nil {
+			return g.Error(err, "could not get incremental value")
+		}
+	} else if t.isIncrementalWithUpdateKey() && tgtConn != nil {
+		if err = getIncrementalValueViaDB(cfg, tgtConn, cfg.SrcConn.Type); err != nil {
+			return g.Error(err, "could not get incremental value")
+		}
+	}
+
+	if plan.Watermark = t.manifestWatermark(nil); plan.Watermark != nil {
+		if cfg.Mode == BackfillMode && cfg.Source.Options.Range != nil {
+			rangeArr := strings.Split(*cfg.Source.Options.Range, ",")
+			plan.Watermark.From, plan.Watermark.To = rangeArr[0], rangeArr[len(rangeArr)-1]
+		}
+	}
+
+	// the source reads
+	var columns iop.Columns
+	switch {
+	case cfg.SrcConn.Type.IsDb():
+		if columns, err = t.planDbSource(plan, count); err != nil {
+			return err
+		}
+	case cfg.sourceIsFile() && !cfg.Options.StdIn:
+		if columns, err = t.planFileSource(plan); err != nil {
+			return err
+		}
+	}
+
+	if tgtConn != nil && len(columns) > 0 {
+		if err = t.planDbTarget(plan, tgtConn, columns); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// planDbSource resolves the source query and counts its rows
+func (t *TaskExecution) planDbSource(plan *StreamPlan, count bool) (columns iop.Columns, err error) {
+	cfg := t.Config
+
+	srcConn, err := t.getSrcDBConn(t.Context.Ctx)
+	if err != nil {
+		return nil, g.Error(err, "could not connect to source")
+	}
+	if !t.isUsingPool() {
+		defer srcConn.Close()
+	}
+
+	sTable, err := t.sourceSelectTable(cfg, srcConn)
+	if err != nil {
+		return nil, g.Error(err, "could not get source select")
+	}
+	plan.SourceSQL = sTable.Select()
+
+	columns, err = srcConn.GetSQLColumns(database.Table{SQL: plan.SourceSQL, Dialect: srcConn.GetType()})
+	if err != nil {
+		return nil, g.Error(err, "could not get columns of source select")
+	} else if !count {
+		return columns, nil
+	}
+
+	// the whole table is read, estimate with the statistics
+	if !sTable.IsQuery() && sTable.SQL == "" {
+		count, err := database.GetCountEstimate(srcConn, sTable)
+		if err != nil {
+			return nil, g.Error(err, "could not get count of %s", sTable.FullName())
+		}
+		plan.Rows, plan.RowsEstimated = cast.ToInt64(count), true
+		return columns, nil
+	}
+
+	sql := g.F("select count(*) cnt from (%s) sling_dry_run", strings.TrimSuffix(strings.TrimSpace(plan.SourceSQL), ";"))
+	data, err := srcConn.Query(sql)
+	if err != nil {
+		return nil, g.Error(err, "could not count rows of source select")
+	} else if len(data.Rows) > 0 && len(data.Rows[0]) > 0 {
+		plan.Rows = cast.ToInt64(data.Rows[0][0])
+	}
+
+	return columns, nil
+}
+
+// planFileSource lists the files to read (excluding those already loaded per
+// the ledger or the watermark), and infers the columns from a sample
+func (t *TaskExecution) planFileSource(plan *StreamPlan) (columns iop.Columns, err error) {
+	cfg := t.Config
+	uri := cfg.SrcConn.URL()
+	if uri == "" {
+		return nil, nil
+	}
+
+	options := t.getOptionsMap()
+	props := append(g.MapToKVArr(cfg.SrcConn.DataS()), g.MapToKVArr(g.ToMapString(options))...)
+	fs, err := filesys.NewFileSysClientFromURLContext(t.Context.Ctx, uri, props...)
+	if err != nil {
+		return nil, g.Error(err, "could not obtain client for %s", cfg.SrcConn.Type)
+	}
+
+	nodes, err := fs.Self().ListRecursive(uri)
+	if err != nil {
+		return nil, g.Error(err, "could not list files")
+	}
+
+	if t.usesFileWatermark() {
+		if nodes, _, err = t.watermarkNewFiles(nodes); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := map[string]LedgerFile{}
+	onSeen := OnSeenReload
+	if t.usesLedger() {
+		if seen, err = LedgerGet(cfg.StreamID()); err != nil {
+			return nil, g.Error(err, "could not get file ledger")
+		}
+		onSeen = OnSeen(strings.ToLower(*cfg.Source.Options.OnSeen))
+	}
+
+	for _, file := range ledgerNewFiles(nodes, seen, onSeen) {
+		plan.Files = append(plan.Files, file.URI)
+		plan.Bytes += file.Size
+	}
+	if len(plan.Files) == 0 {
+		return nil, nil
+	}
+
+	// the columns, from a sample of the files
+	df, err := fs.ReadDataflow(uri, iop.FileStreamConfig{Select: cfg.Source.Select, Limit: 100, FileSelect: &plan.Files})
+	if err != nil {
+		return nil, g.Error(err, "could not read sample of files")
+	}
+	data, err := iop.MergeDataflow(df).Collect(100)
+	if err != nil {
+		return nil, g.Error(err, "could not read sample of files")
+	}
+
+	return data.Columns, nil
+}
+
+// planDbTarget generates the DDL / DML of the load into the target table
+func (t *TaskExecution) planDbTarget(plan *StreamPlan, tgtConn database.Connection, columns iop.Columns) (err error) {
+	cfg := t.Config
+
+	df := iop.NewDataflow()
+	df.Columns = columns.Clone()
+	applyColumnCasingToDf(df, tgtConn.GetType(), cfg.Target.Options.ColumnCasing)
+	applyColumnSanitizerToDf(df, tgtConn.GetType(), cfg.Target.Options.ColumnSanitizer)
+
+	targetTable, err := initializeTargetTable(cfg, tgtConn)
+	if err != nil {
+		return err
+	}
+	tableTmp, err := initializeTempTable(cfg, tgtConn, targetTable)
+	if err != nil {
+		return err
+	}
+
+	add := func(sql string) {
+		if sql = strings.TrimSpace(sql); sql != "" {
+			plan.Statements = append(plan.Statements, sql)
+		}
+	}
+	addSQL := func(statements *SQLStatements, stage string) {
+		if statements == nil || len(*statements) == 0 {
+			return
+		}
+		add(g.F("-- %s-sql", stage))
+		stateMap := t.GetStateMap()
+		for _, statement := range *statements {
+			add(g.Rm(statement.SQL, stateMap))
+		}
+	}
+	dropSQL := func(table database.Table) string {
+		return g.R(tgtConn.GetTemplateValue("core.drop_table"), "table", table.FullName())
+	}
+
+	// the temp table, loaded with the source rows
+	strategy := cfg.Target.Options.commitStrategy()
+	sample := iop.NewDataset(df.Columns)
+	sample.Inferred = true
+	tableTmp.Columns = sample.Columns
+	if err = tableTmp.SetKeys(cfg.Source.PrimaryKey(), cfg.Source.UpdateKey, cfg.Target.Options.TableKeys); err != nil {
+		return g.Error(err, "could not set keys for "+tableTmp.FullName())
+	}
+	ddl, err := tgtConn.GenerateDDL(tableTmp, sample, strategy != CommitStrategyAtomicSwap)
+	if err != nil {
+		return g.Error(err, "could not generate DDL of %s", tableTmp.FullName())
+	}
+	add(ddl)
+	add(g.F("-- load the source rows into %s", tableTmp.FullName()))
+	tgtConn.Base().SetPlannedColumns(tableTmp.FullName(), df.Columns)
+
+	addSQL(cfg.Target.Options.PreSQL, "pre")
+
+	if strategy == CommitStrategyAtomicSwap {
+		add(g.F("-- swap %s into %s", tableTmp.FullName(), targetTable.FullName()))
+		addSQL(cfg.Target.Options.PostSQL, "post")
+		return nil
+	}
+
+	// the target table
+	targetCols, _ := pullTargetTableColumns(cfg, tgtConn, false)
+	exists := len(targetCols) > 0
+	dropped := cfg.Mode == FullRefreshMode && !g.In(strategy, CommitStrategyTruncateInsert, CommitStrategyAppendOnly)
+	if exists && dropped {
+		add(dropSQL(targetTable))
+	}
+	if !exists || dropped {
+		targetSample := iop.NewDataset(applySourceColumnDetails(cfg, df.Columns))
+		targetSample.Inferred = true
+		if ddl, err = tgtConn.GenerateDDL(targetTable, targetSample, false); err != nil {
+			return g.Error(err, "could not generate DDL of %s", targetTable.FullName())
+		}
+		add(ddl)
+		tgtConn.Base().SetPlannedColumns(targetTable.FullName(), df.Columns)
+	} else if cfg.Mode == TruncateMode || (cfg.Mode == FullRefreshMode && strategy == CommitStrategyTruncateInsert) {
+		add(g.R(tgtConn.GetTemplateValue("core.truncate_table"), "table", targetTable.FullName()))
+	}
+
+	// the transfer from the temp table
+	upsert := (cfg.Mode == IncrementalMode && len(cfg.Source.PrimaryKey()) > 0) || cfg.Mode == BackfillMode
+	if upsert && strategy != CommitStrategyAppendOnly {
+		pk := lo.Map(cfg.Source.PrimaryKey(), func(key string, i int) string {
+			return cfg.Target.Options.columnName(key, tgtConn.GetType())
+		})
+		sql, err := tgtConn.GenerateUpsertSQL(tableTmp.FullName(), targetTable.FullName(), pk)
+		if err != nil {
+			return g.Error(err, "could not generate upsert into %s", targetTable.FullName())
+		}
+		add(sql)
+	} else {
+		fields := tgtConn.QuoteNames(df.Columns.Names()...)
+		add(g.R(
+			tgtConn.Template().Core["insert_from_table"],
+			"tgt_table", targetTable.FullName(),
+			"src_table", tableTmp.FullName(),
+			"tgt_fields", strings.Join(fields, ", "),
+			"src_fields", strings.Join(fields, ", "),
+		))
+	}
+
+	addSQL(cfg.Target.Options.PostSQL, "post")
+	add(dropSQL(tableTmp))
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package sling
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	folder := t.TempDir()
+	dbPath := filepath.Join(folder, "dry_run.db")
+	t.Setenv("DRY_SQLITE", "sqlite://"+dbPath)
+	connection.GetLocalConns(true) // refresh the cached connections
+
+	csvFolder := filepath.Join(folder, "files")
+	assert.NoError(t, os.MkdirAll(csvFolder, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(csvFolder, "a.csv"), []byte("id,name\n1,a\n2,b\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(csvFolder, "b.csv"), []byte("id,name\n3,c\n"), 0644))
+
+	// an existing target, with the incremental watermark
+	replication, err := LoadReplicationConfig(`
+source: DRY_SQLITE
+target: DRY_SQLITE
+streams:
+  existing:
+    sql: select 1 as id, 5 as updated
+    object: main.existing
+    mode: full-refresh
+`)
+	if !assert.NoError(t, err) || !assert.NoError(t, replication.Compile(nil)) {
+		return
+	}
+	assert.NoError(t, NewTask("", replication.Tasks[0]).Execute())
+
+	replication, err = LoadReplicationConfig(`
+source: DRY_SQLITE
+target: DRY_SQLITE
+streams:
+  rows:
+    sql: select 1 as id union all select 2 as id
+    object: main.new_table
+    mode: full-refresh
+  main.existing:
+    object: main.existing_copy
+    mode: full-refresh
+  incremental:
+    sql: select * from main.existing where {incremental_where_cond}
+    object: main.existing
+    mode: incremental
+    primary_key: [id]
+    update_key: updated
+`)
+	if !assert.NoError(t, err) || !assert.NoError(t, replication.Compile(nil)) {
+		return
+	}
+
+	plans, err := replication.DryRun()
+	if !assert.NoError(t, err) || !assert.Len(t, plans, 3) {
+		return
+	}
+	byStream := map[string]StreamPlan{}
+	for _, plan := range plans {
+		byStream[plan.Stream] = plan
+	}
+
+	plan := byStream["rows"]
+	assert.EqualValues(t, 2, plan.Rows)
+	assert.False(t, plan.RowsEstimated)
+	assert.Contains(t, plan.SourceSQL, "union all")
+	statements := strings.ToLower(strings.Join(plan.Statements, "\n"))
+	assert.Contains(t, statements, "create table")
+	assert.Contains(t, statements, "insert into")
+	assert.Contains(t, statements, "drop table")
+
+	plan = byStream["main.existing"]
+	assert.Empty(t, plan.Error)
+	assert.True(t, plan.Rows >= 0)
+
+	plan = byStream["incremental"]
+	assert.Empty(t, plan.Error)
+	if assert.NotNil(t, plan.Watermark) {
+		assert.Equal(t, "5", plan.Watermark.From)
+	}
+	assert.Contains(t, strings.ToLower(strings.Join(plan.Statements, "\n")), "update")
+
+	// files to read
+	replication, err = LoadReplicationConfig(`
+source: LOCAL
+target: DRY_SQLITE
+streams:
+  ` + "file://" + csvFolder + `/:
+    object: main.files
+    mode: full-refresh
+`)
+	if !assert.NoError(t, err) || !assert.NoError(t, replication.Compile(nil)) {
+		return
+	}
+	plans, err = replication.DryRun()
+	if assert.NoError(t, err) && assert.Len(t, plans, 1) {
+		assert.Len(t, plans[0].Files, 2)
+		assert.Greater(t, plans[0].Bytes, uint64(0))
+	}
+
+	// nothing was written
+	conn, err := connection.NewConnection("DRY_SQLITE", "sqlite", map[string]any{"url": "sqlite://" + dbPath})
+	if assert.NoError(t, err) {
+		dbConn, err := conn.AsDatabase()
+		if assert.NoError(t, err) {
+			defer dbConn.Close()
+			tables, err := dbConn.GetTables("main")
+			if assert.NoError(t, err) {
+				names := strings.ToLower(g.Marshal(tables.Rows))
+				assert.Contains(t, names, "existing")
+				assert.NotContains(t, names, "new_table")
+				assert.NotContains(t, names, "files")
+			}
+		}
+	}
+}
+
+func TestPreviewSQL(t *testing.T) {
+	folder := t.TempDir()
+	t.Setenv("PREVIEW_SQLITE", "sqlite://"+filepath.Join(folder, "preview.db"))
+	connection.GetLocalConns(true) // refresh the cached connections
+
+	replication, err := LoadReplicationConfig(`
+source: PREVIEW_SQLITE
+target: PREVIEW_SQLITE
+streams:
+  orders:
+    sql: select 1 as id
+    object: main.orders
+    mode: full-refresh
+    target_options:
+      pre_sql: delete from main.audit where stream = '{stream_name}'
+      post_sql:
+        - insert into main.audit (stream) values ('{stream_name}')
+        - sql: analyze {object_name}
+          on_error: warn
+`)
+	if !assert.NoError(t, err) || !assert.NoError(t, replication.Compile(nil)) {
+		return
+	}
+
+	plans, err := replication.PreviewSQL()
+	if !assert.NoError(t, err) || !assert.Len(t, plans, 1) {
+		return
+	}
+
+	plan := plans[0]
+	assert.EqualValues(t, -1, plan.Rows) // not counted
+	assert.Equal(t, "select 1 as id", strings.TrimSpace(plan.SourceSQL))
+
+	statements := plan.Statements
+	pre := lo.IndexOf(statements, "delete from main.audit where stream = 'orders'")
+	post := lo.IndexOf(statements, "insert into main.audit (stream) values ('orders')")
+	if assert.Greater(t, pre, 0) && assert.Greater(t, post, pre) {
+		assert.Equal(t, "-- pre-sql", statements[pre-1])
+		assert.Equal(t, "-- post-sql", statements[post-1])
+		assert.Contains(t, strings.ToLower(statements[pre+1]), "create table")
+		assert.Contains(t, statements[post+1], "analyze")
+		assert.Contains(t, strings.ToLower(statements[len(statements)-1]), "drop table")
+	}
+}
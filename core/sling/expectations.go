@@ -0,0 +1,123 @@
+package sling
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+)
+
+// ExpectationAction is what a violated stream expectation does
+type ExpectationAction string
+
+const (
+	// ExpectationActionWarn logs a warning, the stream ends with the
+	// warning status (default)
+	ExpectationActionWarn ExpectationAction = "warn"
+	// ExpectationActionFail fails the stream
+	ExpectationActionFail ExpectationAction = "fail"
+)
+
+// StreamExpectations are the expected volume and duration of a stream run,
+// checked at the end of the run to catch silently broken upstream feeds
+// (e.g. an empty extract, or a sudden drop of rows)
+type StreamExpectations struct {
+	MinRows     *uint64 `json:"min_rows,omitempty" yaml:"min_rows,omitempty"`
+	MaxRows     *uint64 `json:"max_rows,omitempty" yaml:"max_rows,omitempty"`
+	MaxDuration string  `json:"max_duration,omitempty" yaml:"max_duration,omitempty"` // e.g. 30m
+
+	// MaxChange is the maximum change (in percent) of the rows, compared
+	// to the previous successful run in the run history
+	MaxChange *float64 `json:"max_change,omitempty" yaml:"max_change,omitempty"`
+
+	OnViolation ExpectationAction `json:"on_violation,omitempty" yaml:"on_violation,omitempty"`
+}
+
+// Validate checks the expectation values
+func (se *StreamExpectations) Validate() (err error) {
+	if se == nil {
+		return nil
+	}
+
+	switch ExpectationAction(strings.ToLower(string(se.OnViolation))) {
+	case "", ExpectationActionWarn, ExpectationActionFail:
+	default:
+		return g.Error("invalid on_violation value (%s). Expected warn or fail", se.OnViolation)
+	}
+
+	if se.MinRows != nil && se.MaxRows != nil && *se.MinRows > *se.MaxRows {
+		return g.Error("min_rows (%d) is greater than max_rows (%d)", *se.MinRows, *se.MaxRows)
+	}
+	if se.MaxChange != nil && *se.MaxChange < 0 {
+		return g.Error("max_change must be a positive percentage: %v", *se.MaxChange)
+	}
+	if _, err = parseTimeout(se.MaxDuration); err != nil {
+		return g.Error(err, "invalid max_duration")
+	}
+	return nil
+}
+
+// Violations returns the violated expectations of a run. The previous
+// rows are those of the previous successful run, nil if none.
+func (se *StreamExpectations) Violations(rows uint64, duration time.Duration, prevRows *uint64) (violations []string) {
+	if se == nil {
+		return nil
+	}
+
+	if se.MinRows != nil && rows < *se.MinRows {
+		violations = append(violations, g.F("%d rows is less than min_rows (%d)", rows, *se.MinRows))
+	}
+	if se.MaxRows != nil && rows > *se.MaxRows {
+		violations = append(violations, g.F("%d rows is more than max_rows (%d)", rows, *se.MaxRows))
+	}
+	if maxDuration, _ := parseTimeout(se.MaxDuration); maxDuration > 0 && duration > maxDuration {
+		violations = append(violations, g.F("duration of %s is longer than max_duration (%s)", duration.Round(time.Second), maxDuration))
+	}
+	if se.MaxChange != nil && prevRows != nil && *prevRows > 0 {
+		change := math.Abs(float64(rows)-float64(*prevRows)) / float64(*prevRows) * 100
+		if change > *se.MaxChange {
+			violations = append(violations, g.F("%d rows is a change of %.1f%% from the previous run (%d rows), more than max_change (%v%%)", rows, change, *prevRows, *se.MaxChange))
+		}
+	}
+	return violations
+}
+
+// checkExpectations checks the stream expectations at the end of a
+// successful run. The violations are warned, or fail the stream.
+func (t *TaskExecution) checkExpectations() (err error) {
+	if t.Config.ReplicationStream == nil || t.Config.ReplicationStream.Expect == nil || t.StartTime == nil {
+		return nil
+	}
+	expect := t.Config.ReplicationStream.Expect
+
+	// rows of the previous successful run
+	var prevRows *uint64
+	if expect.MaxChange != nil {
+		runs, err := HistoryGet(HistoryFilter{StreamID: t.Config.StreamID(), Limit: 20})
+		if err != nil {
+			g.Debug("could not get previous runs of stream %s: %s", t.Config.StreamName, err.Error())
+		}
+		for _, run := range runs {
+			if g.In(run.Status, ExecStatusSuccess, ExecStatusWarning) {
+				prevRows = g.Ptr(run.Rows)
+				break
+			}
+		}
+	}
+
+	violations := expect.Violations(t.GetCount(), time.Since(*t.StartTime), prevRows)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	if ExpectationAction(strings.ToLower(string(expect.OnViolation))) == ExpectationActionFail {
+		return g.Error("stream expectations not met: %s", strings.Join(violations, "; "))
+	}
+
+	for _, violation := range violations {
+		g.Warn("stream expectation not met: %s", violation)
+	}
+	t.Status = ExecStatusWarning
+	return nil
+}
@@ -0,0 +1,98 @@
+package sling
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamExpectations(t *testing.T) {
+	expect := &StreamExpectations{MinRows: g.Ptr(uint64(1)), MaxRows: g.Ptr(uint64(1000)), MaxDuration: "10m", MaxChange: g.Ptr(50.0)}
+	assert.NoError(t, expect.Validate())
+	assert.Empty(t, expect.Violations(100, time.Minute, g.Ptr(uint64(120))))
+	assert.Empty(t, expect.Violations(100, time.Minute, nil))              // no previous run
+	assert.Empty(t, expect.Violations(100, time.Minute, g.Ptr(uint64(0)))) // previous run was empty
+
+	violations := expect.Violations(0, time.Hour, g.Ptr(uint64(200)))
+	assert.Equal(t, []string{
+		"0 rows is less than min_rows (1)",
+		"duration of 1h0m0s is longer than max_duration (10m0s)",
+		"0 rows is a change of 100.0% from the previous run (200 rows), more than max_change (50%)",
+	}, violations)
+	assert.Equal(t, []string{"2000 rows is more than max_rows (1000)"}, expect.Violations(2000, time.Minute, nil))
+
+	assert.ErrorContains(t, (&StreamExpectations{OnViolation: "ignore"}).Validate(), "invalid on_violation value")
+	assert.ErrorContains(t, (&StreamExpectations{MinRows: g.Ptr(uint64(10)), MaxRows: g.Ptr(uint64(1))}).Validate(), "min_rows (10) is greater than max_rows (1)")
+	assert.ErrorContains(t, (&StreamExpectations{MaxDuration: "soon"}).Validate(), "invalid max_duration")
+
+	folder := t.TempDir()
+	t.Setenv("EXPECT_SQLITE", "sqlite://"+filepath.Join(folder, "expect.db"))
+	connection.GetLocalConns(true) // refresh the cached connections
+
+	// the previous run is read from the history
+	getFunc := HistoryGet
+	HistoryGet = func(filter HistoryFilter) ([]HistoryRun, error) {
+		return []HistoryRun{
+			{StreamID: filter.StreamID, Status: ExecStatusError},
+			{StreamID: filter.StreamID, Status: ExecStatusSuccess, Rows: 10},
+		}, nil
+	}
+	defer func() { HistoryGet = getFunc }()
+
+	replicationYaml := `
+source: EXPECT_SQLITE
+target: EXPECT_SQLITE
+defaults:
+  mode: full-refresh
+  object: main.{stream_name}
+  expect:
+    min_rows: 1
+streams:
+  empty:
+    sql: select 1 as id where 1 = 0
+  dropped:
+    sql: select 1 as id
+    expect:
+      max_change: 50
+      on_violation: fail
+  steady:
+    sql: select 1 as id
+`
+	replication, err := LoadReplicationConfig(replicationYaml)
+	if !assert.NoError(t, err) || !assert.NoError(t, replication.Compile(nil)) {
+		return
+	}
+
+	tasks := map[string]*Config{}
+	for _, cfg := range replication.Tasks {
+		tasks[cfg.StreamName] = cfg
+	}
+
+	// warned by default
+	task := NewTask("", tasks["empty"])
+	assert.NoError(t, task.Execute())
+	assert.Equal(t, ExecStatusWarning, task.Status)
+
+	task = NewTask("", tasks["dropped"])
+	assert.ErrorContains(t, task.Execute(), "1 rows is a change of 90.0% from the previous run (10 rows)")
+	assert.Equal(t, ExecStatusError, task.Status)
+
+	task = NewTask("", tasks["steady"])
+	assert.NoError(t, task.Execute())
+	assert.Equal(t, ExecStatusSuccess, task.Status)
+
+	// invalid expectations are reported
+	replication, err = LoadReplicationConfig(strings.Replace(replicationYaml, "on_violation: fail", "on_violation: ignore", 1))
+	if assert.NoError(t, err) {
+		assert.ErrorContains(t, replication.Compile(nil), "invalid expect for stream: dropped")
+	}
+	issues := ValidateReplication(strings.Replace(replicationYaml, "min_rows: 1", "min_rows: 1\n    max_duration: later", 1))
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, "defaults.expect.max_duration", issues[0].Path)
+	}
+}
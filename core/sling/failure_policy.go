@@ -0,0 +1,54 @@
+package sling
+
+import (
+	"strings"
+
+	"github.com/flarco/g"
+)
+
+// FailurePolicy is how a replication run handles the failure of a stream
+type FailurePolicy string
+
+const (
+	// FailurePolicyContinue runs all the streams, and succeeds despite
+	// the failed streams (reported as warnings)
+	FailurePolicyContinue FailurePolicy = "continue"
+	// FailurePolicyFailFast stops at the first failed stream
+	FailurePolicyFailFast FailurePolicy = "fail_fast"
+	// FailurePolicyFailAfterAll runs all the streams, and fails at the
+	// end if a stream failed (default)
+	FailurePolicyFailAfterAll FailurePolicy = "fail_after_all"
+)
+
+// Validate checks the failure policy value
+func (fp FailurePolicy) Validate() error {
+	switch FailurePolicy(strings.ToLower(string(fp))) {
+	case "", FailurePolicyContinue, FailurePolicyFailFast, FailurePolicyFailAfterAll:
+		return nil
+	}
+	return g.Error("invalid on_failure value (%s). Expected continue, fail_fast or fail_after_all", fp)
+}
+
+// failurePolicy returns the failure policy, fail_after_all by default
+func (rd *ReplicationConfig) failurePolicy() FailurePolicy {
+	if rd.OnFailure == "" {
+		return FailurePolicyFailAfterAll
+	}
+	return FailurePolicy(strings.ToLower(string(rd.OnFailure)))
+}
+
+// FailsRun returns true if the failure of the stream fails the run.
+// The failures of optional streams, or with the continue policy, are
+// reported as warnings.
+func (rd *ReplicationConfig) FailsRun(cfg *Config) bool {
+	if cfg.ReplicationStream != nil && cfg.ReplicationStream.Optional {
+		return false
+	}
+	return rd.failurePolicy() != FailurePolicyContinue
+}
+
+// StopAfterFailure returns true if the remaining streams are not run
+// after the failure of the stream (fail_fast policy)
+func (rd *ReplicationConfig) StopAfterFailure(cfg *Config) bool {
+	return rd.FailsRun(cfg) && rd.failurePolicy() == FailurePolicyFailFast
+}
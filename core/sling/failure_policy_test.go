@@ -0,0 +1,64 @@
+package sling
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailurePolicy(t *testing.T) {
+	replicationYaml := `
+source: LOCAL
+target: LOCAL
+on_failure: fail_fast
+defaults:
+  mode: full-refresh
+  object: file:///tmp/sling/out/{stream_file_name}.csv
+streams:
+  file:///tmp/sling/required.csv:
+  file:///tmp/sling/optional.csv:
+    optional: true
+`
+	tasks := func(yaml string) (replication ReplicationConfig, required, optional *Config) {
+		replication, err := LoadReplicationConfig(yaml)
+		if !assert.NoError(t, err) || !assert.NoError(t, replication.Compile(nil)) {
+			t.FailNow()
+		}
+		for _, cfg := range replication.Tasks {
+			if strings.Contains(cfg.StreamName, "optional") {
+				optional = cfg
+			} else {
+				required = cfg
+			}
+		}
+		return replication, required, optional
+	}
+
+	replication, required, optional := tasks(replicationYaml)
+	assert.True(t, replication.FailsRun(required))
+	assert.True(t, replication.StopAfterFailure(required))
+	assert.False(t, replication.FailsRun(optional))
+	assert.False(t, replication.StopAfterFailure(optional))
+
+	replication, required, _ = tasks(strings.Replace(replicationYaml, "fail_fast", "fail_after_all", 1))
+	assert.True(t, replication.FailsRun(required))
+	assert.False(t, replication.StopAfterFailure(required))
+
+	replication, required, _ = tasks(strings.Replace(replicationYaml, "on_failure: fail_fast", "", 1))
+	assert.True(t, replication.FailsRun(required)) // fail_after_all by default
+	assert.False(t, replication.StopAfterFailure(required))
+
+	replication, required, optional = tasks(strings.Replace(replicationYaml, "fail_fast", "continue", 1))
+	assert.False(t, replication.FailsRun(required))
+	assert.False(t, replication.FailsRun(optional))
+
+	replication, err := LoadReplicationConfig(strings.Replace(replicationYaml, "fail_fast", "retry", 1))
+	if assert.NoError(t, err) {
+		assert.ErrorContains(t, replication.Compile(nil), "invalid on_failure value")
+	}
+	issues := ValidateReplication(strings.Replace(replicationYaml, "fail_fast", "retry", 1))
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, "on_failure", issues[0].Path)
+	}
+}
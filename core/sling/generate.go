@@ -0,0 +1,207 @@
+package sling
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v3"
+)
+
+// GenerateOptions are the options to scaffold a replication from the
+// discovery of the source connection
+type GenerateOptions struct {
+	Source    string // source connection name
+	Target    string // target connection name
+	Pattern   string // discovery pattern (e.g. my_schema.*, folder/*.csv)
+	Recursive bool   // list the files recursively
+	Mode      Mode   // default mode (full-refresh if empty)
+}
+
+// generatedStream is a discovered stream to write in the replication
+type generatedStream struct {
+	Name       string
+	Group      string // schema, or parent folder
+	PrimaryKey []string
+	IsView     bool
+}
+
+// GenerateReplication connects to the source, discovers the tables (or files)
+// and returns a ready-to-edit replication YAML. The streams are grouped by
+// schema (or folder), with the primary keys pulled from the source metadata.
+func GenerateReplication(opts GenerateOptions) (content string, err error) {
+	if opts.Source == "" || opts.Target == "" {
+		return "", g.Error("source and target connections are required")
+	}
+	if opts.Mode == "" {
+		opts.Mode = FullRefreshMode
+	} else if !g.In(string(opts.Mode), modeValues()...) {
+		return "", g.Error("invalid mode: %s", opts.Mode)
+	}
+
+	conns := connection.GetLocalConns()
+	source, target := conns.Get(opts.Source), conns.Get(opts.Target)
+	if source.Name == "" {
+		return "", g.Error("did not find connection %s", opts.Source)
+	} else if target.Name == "" {
+		return "", g.Error("did not find connection %s", opts.Target)
+	}
+
+	streams, err := generateStreams(source.Connection, opts)
+	if err != nil {
+		return "", g.Error(err, "could not discover streams in %s", source.Name)
+	} else if len(streams) == 0 {
+		return "", g.Error("no streams found in %s", source.Name)
+	}
+
+	// default target object, from the stream runtime variables
+	var object string
+	switch {
+	case source.Connection.Type.IsDb() && target.Connection.Type.IsDb():
+		object = "{target_schema}.{stream_schema}_{stream_table}"
+	case target.Connection.Type.IsDb():
+		object = "{target_schema}.{stream_file_folder}_{stream_file_name}"
+	case source.Connection.Type.IsDb():
+		object = "{stream_schema}/{stream_table}.parquet"
+	default:
+		object = "{stream_file_folder}/{stream_file_name}.parquet"
+	}
+
+	defaults := yamlMapping(
+		"mode", yamlScalar(string(opts.Mode)),
+		"object", yamlScalar(object),
+	)
+
+	streamsNode := yamlMapping()
+	group := ""
+	for _, stream := range streams {
+		key := yamlScalar(stream.Name)
+		if stream.Group != group {
+			group = stream.Group
+			key.HeadComment = lo.Ternary(source.Connection.Type.IsDb(), "schema: ", "folder: ") + group
+		}
+
+		value := yamlMapping()
+		if len(stream.PrimaryKey) > 0 {
+			keys := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+			for _, col := range stream.PrimaryKey {
+				keys.Content = append(keys.Content, yamlScalar(col))
+			}
+			value.Content = append(value.Content, yamlScalar("primary_key"), keys)
+		}
+		if stream.IsView {
+			key.LineComment = "view"
+		}
+		if len(value.Content) == 0 {
+			value = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"} // `stream:`
+		}
+		streamsNode.Content = append(streamsNode.Content, key, value)
+	}
+
+	root := yamlMapping(
+		"source", yamlScalar(source.Name),
+		"target", yamlScalar(target.Name),
+		"defaults", defaults,
+		"streams", streamsNode,
+	)
+	root.HeadComment = g.F("generated with `sling generate replication` on %s", time.Now().Format("2006-01-02"))
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}); err != nil {
+		return "", g.Error(err, "could not marshal replication")
+	}
+
+	// blank line between the top level sections, for readability
+	content = buf.String()
+	for _, section := range []string{"defaults:", "streams:"} {
+		content = strings.Replace(content, "\n"+section, "\n\n"+section, 1)
+	}
+
+	return content, nil
+}
+
+// generateStreams discovers the tables (with their primary keys) or files of
+// the connection, sorted by group and name
+func generateStreams(conn connection.Connection, opts GenerateOptions) (streams []generatedStream, err error) {
+	discoverOpts := &connection.DiscoverOptions{
+		Pattern:   opts.Pattern,
+		Level:     database.SchemataLevelTable,
+		Recursive: opts.Recursive,
+	}
+
+	_, nodes, schemata, err := conn.Discover(discoverOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	if conn.Type.IsDb() {
+		dbConn, err := conn.AsDatabase()
+		if err != nil {
+			return nil, g.Error(err, "could not initiate %s", conn.Name)
+		}
+		defer dbConn.Close()
+
+		for _, table := range schemata.Tables() {
+			stream := generatedStream{
+				Name:   strings.Join(lo.Compact([]string{table.Schema, table.Name}), "."),
+				Group:  table.Schema,
+				IsView: table.IsView,
+			}
+
+			if !table.IsView {
+				data, err := dbConn.GetPrimaryKeys(table.FullName())
+				if err != nil {
+					g.Warn("could not get primary keys for %s: %s", table.FullName(), err.Error())
+				}
+				records := data.Records()
+				sort.SliceStable(records, func(i, j int) bool {
+					return cast.ToInt(records[i]["position"]) < cast.ToInt(records[j]["position"])
+				})
+				for _, rec := range records {
+					stream.PrimaryKey = append(stream.PrimaryKey, strings.ToLower(cast.ToString(rec["column_name"])))
+				}
+			}
+
+			streams = append(streams, stream)
+		}
+	} else {
+		for _, node := range nodes {
+			path := strings.TrimSuffix(node.Path(), "/")
+			group := "/"
+			if i := strings.LastIndex(path, "/"); i > 0 {
+				group = path[:i]
+			}
+			streams = append(streams, generatedStream{Name: node.URI, Group: group})
+		}
+	}
+
+	sort.SliceStable(streams, func(i, j int) bool {
+		if streams[i].Group != streams[j].Group {
+			return streams[i].Group < streams[j].Group
+		}
+		return streams[i].Name < streams[j].Name
+	})
+
+	return streams, nil
+}
+
+func yamlScalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
+
+// yamlMapping returns a mapping node of the key/value pairs
+func yamlMapping(pairs ...any) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		node.Content = append(node.Content, yamlScalar(cast.ToString(pairs[i])), pairs[i+1].(*yaml.Node))
+	}
+	return node
+}
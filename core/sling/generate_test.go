@@ -0,0 +1,43 @@
+package sling
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateReplication(t *testing.T) {
+	dbURL := "sqlite://" + filepath.Join(t.TempDir(), "generate.db")
+	t.Setenv("GENERATE_SQLITE", dbURL)
+	connection.GetLocalConns(true) // refresh the cached connections
+
+	conn, err := database.NewConn(dbURL)
+	if !assert.NoError(t, err) || !assert.NoError(t, conn.Connect()) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecMulti(
+		`create table orders (region text, id integer, amount decimal(10,2), primary key (id, region))`,
+		`create table events (name text)`,
+		`create view orders_view as select * from orders`,
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = GenerateReplication(GenerateOptions{Source: "GENERATE_SQLITE", Target: "GENERATE_SQLITE", Mode: "bogus"})
+	assert.ErrorContains(t, err, "invalid mode")
+
+	content, err := GenerateReplication(GenerateOptions{Source: "GENERATE_SQLITE", Target: "GENERATE_SQLITE", Pattern: "main.*"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, content, "defaults:\n  mode: full-refresh\n  object: '{target_schema}.{stream_schema}_{stream_table}'\n")
+	assert.Contains(t, content, "  # schema: main\n  main.events:\n  main.orders:\n    primary_key: [id, region]\n  main.orders_view: # view\n")
+
+	assert.Empty(t, ValidateReplication(content))
+}
@@ -0,0 +1,166 @@
+package sling
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/spf13/cast"
+)
+
+// HistoryRun is the record of a stream run in the run history
+type HistoryRun struct {
+	ExecID    string     `json:"exec_id"`
+	StreamID  string     `json:"stream_id"`
+	Stream    string     `json:"stream"`
+	Config    string     `json:"config,omitempty"` // replication file path
+	Source    string     `json:"source"`           // connection name
+	Target    string     `json:"target"`           // connection name
+	Object    string     `json:"object"`
+	Mode      Mode       `json:"mode"`
+	Status    ExecStatus `json:"status"`
+	StartTime *time.Time `json:"start_time,omitempty"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	Duration  int64      `json:"duration"` // seconds
+	Rows      uint64     `json:"rows"`
+	Bytes     uint64     `json:"bytes"`
+	Watermark string     `json:"watermark,omitempty"` // the maximum update key value loaded, or the file watermark
+	Error     string     `json:"error,omitempty"`
+}
+
+// HistoryFilter selects the runs of the history
+type HistoryFilter struct {
+	Stream   string    // the stream name, with `*` wildcards. All if empty.
+	StreamID string    // the stream id
+	Since    time.Time // the runs started after
+	Limit    int       // the maximum number of runs, the latest first
+}
+
+// HistoryGet returns the recorded stream runs, the latest first.
+// Set by the store, which persists the runs in the local sling database.
+var HistoryGet = func(filter HistoryFilter) (runs []HistoryRun, err error) {
+	return nil, g.Error("run history is not available")
+}
+
+// HistorySet records a stream run
+var HistorySet = func(run HistoryRun) (err error) {
+	return g.Error("run history is not available")
+}
+
+// NewHistoryRun returns the history record of the executed task
+func NewHistoryRun(t *TaskExecution) (run HistoryRun) {
+	cfg := t.Config
+	run = HistoryRun{
+		ExecID:    t.ExecID,
+		StreamID:  cfg.StreamID(),
+		Stream:    cfg.StreamName,
+		Config:    cfg.Env["SLING_CONFIG_PATH"],
+		Source:    cfg.Source.Conn,
+		Target:    cfg.Target.Conn,
+		Object:    cfg.Target.Object,
+		Mode:      cfg.Mode,
+		Status:    t.Status,
+		StartTime: t.StartTime,
+		EndTime:   t.EndTime,
+		Rows:      t.GetCount(),
+	}
+	if run.Stream == "" {
+		run.Stream = cfg.Source.Stream
+	}
+	if t.StartTime != nil && t.EndTime != nil {
+		run.Duration = cast.ToInt64(t.EndTime.Sub(*t.StartTime).Seconds())
+	}
+	if inBytes, outBytes := t.GetBytes(); inBytes > 0 {
+		run.Bytes = inBytes
+	} else {
+		run.Bytes = outBytes
+	}
+	if t.Err != nil {
+		run.Error = g.ErrMsgSimple(t.Err)
+	}
+
+	if df := t.Df(); df != nil {
+		if watermark := t.manifestWatermark(df.Columns); watermark != nil {
+			run.Watermark = watermark.To
+		}
+	}
+	if t.fileWatermark > 0 {
+		run.Watermark = time.Unix(t.fileWatermark, 0).UTC().Format(time.RFC3339)
+	}
+
+	return run
+}
+
+// RecordHistory records the run of the task in the run history,
+// unless SLING_HISTORY is false
+func (t *TaskExecution) RecordHistory() {
+	if t == nil || t.Config == nil || os.Getenv("SLING_HISTORY") == "false" {
+		return
+	}
+
+	if err := HistorySet(NewHistoryRun(t)); err != nil {
+		g.Debug("could not record run history of stream %s: %s", t.Config.StreamName, err.Error())
+	}
+}
+
+// HistoryStreamStats are the stats of the recorded runs of a stream
+type HistoryStreamStats struct {
+	Stream        string     `json:"stream"`
+	Runs          int        `json:"runs"`
+	Failures      int        `json:"failures"`
+	LastRun       *time.Time `json:"last_run,omitempty"`
+	LastStatus    ExecStatus `json:"last_status"`
+	LastSuccess   *time.Time `json:"last_success,omitempty"`
+	LastWatermark string     `json:"last_watermark,omitempty"`
+	AvgRows       uint64     `json:"avg_rows"`
+	AvgDuration   int64      `json:"avg_duration"` // seconds
+}
+
+// HistoryStats returns the stats of the runs per stream (sorted by name):
+// the failures, the last success time and the average rows and durations of
+// the successful runs. The runs are expected the latest first.
+func HistoryStats(runs []HistoryRun) (stats []HistoryStreamStats) {
+	statsMap := map[string]*HistoryStreamStats{}
+	successes := map[string]int{}
+	totalRows := map[string]uint64{}
+	totalDuration := map[string]int64{}
+
+	for _, run := range runs {
+		s, ok := statsMap[run.Stream]
+		if !ok {
+			s = &HistoryStreamStats{Stream: run.Stream, LastRun: run.StartTime, LastStatus: run.Status}
+			statsMap[run.Stream] = s
+		}
+		s.Runs++
+
+		if run.Status.IsFailure() {
+			s.Failures++
+			continue
+		} else if run.Status == ExecStatusSkipped {
+			continue
+		}
+
+		if s.LastSuccess == nil {
+			s.LastSuccess = run.EndTime
+		}
+		if s.LastWatermark == "" {
+			s.LastWatermark = run.Watermark
+		}
+		successes[run.Stream]++
+		totalRows[run.Stream] += run.Rows
+		totalDuration[run.Stream] += run.Duration
+	}
+
+	for stream, s := range statsMap {
+		if count := successes[stream]; count > 0 {
+			s.AvgRows = totalRows[stream] / uint64(count)
+			s.AvgDuration = totalDuration[stream] / int64(count)
+		}
+		stats = append(stats, *s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Stream < stats[j].Stream })
+
+	return stats
+}
@@ -0,0 +1,72 @@
+package sling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+	recorded := []HistoryRun{}
+	setFunc := HistorySet
+	HistorySet = func(run HistoryRun) error { recorded = append(recorded, run); return nil }
+	defer func() { HistorySet = setFunc }()
+
+	cfg := &Config{Mode: FullRefreshMode, StreamName: "s3://bucket/orders/*.csv", Env: map[string]string{"SLING_CONFIG_PATH": "replication.yaml"}}
+	cfg.Source.Conn, cfg.Source.Stream = "S3", "s3://bucket/orders/*.csv"
+	cfg.Target.Conn, cfg.Target.Object = "PG", "raw.orders"
+
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(90 * time.Second)
+	task := NewTask("exec-1", cfg)
+	task.StartTime, task.EndTime = &start, &end
+	task.Status = ExecStatusError
+	task.Err = g.Error("connection refused")
+	task.fileWatermark = start.Unix()
+
+	task.RecordHistory()
+	if assert.Len(t, recorded, 1) {
+		run := recorded[0]
+		assert.Equal(t, "exec-1", run.ExecID)
+		assert.Equal(t, cfg.StreamID(), run.StreamID)
+		assert.Equal(t, "s3://bucket/orders/*.csv", run.Stream)
+		assert.Equal(t, "replication.yaml", run.Config)
+		assert.Equal(t, "S3", run.Source)
+		assert.Equal(t, "PG", run.Target)
+		assert.Equal(t, "raw.orders", run.Object)
+		assert.Equal(t, ExecStatusError, run.Status)
+		assert.EqualValues(t, 90, run.Duration)
+		assert.Equal(t, "2024-03-01T10:00:00Z", run.Watermark)
+		assert.Contains(t, run.Error, "connection refused")
+	}
+
+	t.Setenv("SLING_HISTORY", "false")
+	task.RecordHistory()
+	assert.Len(t, recorded, 1)
+
+	// stats per stream, from the latest runs
+	at := func(hour int) *time.Time { ts := start.Add(time.Duration(hour) * time.Hour); return &ts }
+	stats := HistoryStats([]HistoryRun{
+		{Stream: "orders", Status: ExecStatusError, StartTime: at(3), EndTime: at(3)},
+		{Stream: "items", Status: ExecStatusSuccess, StartTime: at(2), EndTime: at(2), Rows: 10, Duration: 4},
+		{Stream: "orders", Status: ExecStatusSuccess, StartTime: at(2), EndTime: at(2), Rows: 300, Duration: 30, Watermark: "2024-03-01"},
+		{Stream: "orders", Status: ExecStatusSkipped, StartTime: at(1), EndTime: at(1)},
+		{Stream: "orders", Status: ExecStatusSuccess, StartTime: at(0), EndTime: at(0), Rows: 100, Duration: 10, Watermark: "2024-02-28"},
+	})
+	if assert.Len(t, stats, 2) {
+		assert.Equal(t, "items", stats[0].Stream)
+		assert.Equal(t, 1, stats[0].Runs)
+
+		orders := stats[1]
+		assert.Equal(t, 4, orders.Runs)
+		assert.Equal(t, 1, orders.Failures)
+		assert.Equal(t, ExecStatusError, orders.LastStatus)
+		assert.Equal(t, at(3), orders.LastRun)
+		assert.Equal(t, at(2), orders.LastSuccess)
+		assert.Equal(t, "2024-03-01", orders.LastWatermark)
+		assert.EqualValues(t, 200, orders.AvgRows)
+		assert.EqualValues(t, 20, orders.AvgDuration)
+	}
+}
@@ -0,0 +1,122 @@
+package sling
+
+import (
+	"reflect"
+
+	"github.com/flarco/g"
+)
+
+// ReplicationJSONSchema returns the JSON Schema of the replication config,
+// for editor autocompletion & validation (e.g. VSCode YAML extension with
+// `# yaml-language-server: $schema=...`). It is generated from the structs,
+// with the same keys as accepted when parsing.
+func ReplicationJSONSchema() map[string]any {
+	sg := &schemaGenerator{defs: map[string]any{}}
+
+	root := sg.object(reflect.TypeOf(ReplicationConfig{}))
+	root["$schema"] = "https://json-schema.org/draft-07/schema#"
+	root["title"] = "Sling Replication"
+	root["required"] = []string{"source", "target", "streams"}
+
+	props := root["properties"].(map[string]any)
+	props["source"] = g.M("type", "string", "description", "The source connection name")
+	props["target"] = g.M("type", "string", "description", "The target connection name")
+	props["hooks"] = sg.hooks(HookStageStart, HookStageEnd)
+	props["streams"] = g.M(
+		"type", "object",
+		"description", "The streams to replicate, by name (table, file path or wildcard). Empty streams use the defaults",
+		"additionalProperties", g.M("oneOf", []any{
+			g.M("type", "null"),
+			g.M("$ref", "#/definitions/ReplicationStreamConfig"),
+		}),
+	)
+	props["env"] = g.M("type", "object", "description", "Variables available in the config as ${VAR}")
+	props["secrets"] = g.M("type", "array", "items", g.M("type", "string"), "description", "The env keys with secret values, masked in the logs and excluded from the payload and state")
+	props["vars"] = g.M("type", "object", "description", "Variables available in the templates as {var}, with runtime functions such as {run_date-1d:YYYYMMDD} or {upper(stream_table)}")
+	root["definitions"] = sg.defs
+
+	return root
+}
+
+type schemaGenerator struct {
+	defs map[string]any
+}
+
+// object returns the schema of the struct, accepting only its yaml keys
+func (sg *schemaGenerator) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if name, ok := yamlFieldName(field); ok {
+			props[name] = sg.schema(field.Type)
+		}
+	}
+	return g.M("type", "object", "properties", props, "additionalProperties", false)
+}
+
+// schema returns the schema of the type. Structs are referenced
+// in the definitions.
+func (sg *schemaGenerator) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	// types with custom parsing accept any shape
+	ptr := reflect.PointerTo(t)
+	if ptr.Implements(jsonUnmarshalerType) || ptr.Implements(textUnmarshalerType) {
+		return g.M()
+	}
+
+	switch t {
+	case reflect.TypeOf(Mode("")):
+		return g.M("type", "string", "enum", modeValues())
+	case reflect.TypeOf(HookMap{}):
+		return sg.hooks(HookStagePre, HookStagePost)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if _, ok := sg.defs[t.Name()]; !ok {
+			sg.defs[t.Name()] = g.M() // placeholder, for recursive types
+			sg.defs[t.Name()] = sg.object(t)
+		}
+		return g.M("$ref", "#/definitions/"+t.Name())
+	case reflect.Map:
+		return g.M("type", "object", "additionalProperties", sg.schema(t.Elem()))
+	case reflect.Slice, reflect.Array:
+		return g.M("type", "array", "items", sg.schema(t.Elem()))
+	case reflect.Bool:
+		return g.M("type", "boolean")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return g.M("type", "integer")
+	case reflect.Float32, reflect.Float64:
+		return g.M("type", "number")
+	case reflect.String:
+		return g.M("type", "string")
+	}
+	return g.M() // any
+}
+
+// hooks returns the schema of the hooks for the stages: lists of
+// hooks with a type, and the properties of the type
+func (sg *schemaGenerator) hooks(stages ...HookStage) map[string]any {
+	if _, ok := sg.defs["Hook"]; !ok {
+		sg.defs["Hook"] = g.M(
+			"type", "object",
+			"required", []string{"type"},
+			"properties", g.M(
+				"type", g.M("type", "string", "description", "The hook type, e.g. query, http, log, check, copy, delete, command, replication"),
+				"id", g.M("type", "string"),
+				"if", g.M("type", "string", "description", "Condition to execute the hook"),
+				"on_failure", g.M("type", "string", "description", "What to do when the hook fails, e.g. abort or warn"),
+			),
+		)
+	}
+
+	props := map[string]any{}
+	for _, stage := range stages {
+		props[string(stage)] = g.M("type", "array", "items", g.M("$ref", "#/definitions/Hook"))
+	}
+	return g.M("type", "object", "properties", props, "additionalProperties", false)
+}
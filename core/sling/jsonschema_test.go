@@ -0,0 +1,55 @@
+package sling
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/flarco/g"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicationJSONSchema(t *testing.T) {
+	schema := ReplicationJSONSchema()
+
+	// must be serializable
+	_, err := g.UnmarshalMap(g.Marshal(schema))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"source", "target", "streams"}, schema["required"])
+	props := schema["properties"].(map[string]any)
+	assert.Contains(t, props, "defaults")
+	assert.Contains(t, props, "env")
+	assert.Equal(t, g.M("$ref", "#/definitions/ReplicationStreamConfig"), props["defaults"])
+
+	defs := schema["definitions"].(map[string]any)
+
+	// every parsed key is in the schema
+	for name, typ := range map[string]reflect.Type{
+		"ReplicationStreamConfig": reflect.TypeOf(ReplicationStreamConfig{}),
+		"SourceOptions":           reflect.TypeOf(SourceOptions{}),
+		"TargetOptions":           reflect.TypeOf(TargetOptions{}),
+	} {
+		if assert.Contains(t, defs, name) {
+			def := defs[name].(map[string]any)
+			assert.Equal(t, false, def["additionalProperties"])
+			defProps := def["properties"].(map[string]any)
+			for key := range yamlFields(typ) {
+				assert.Contains(t, defProps, key, "%s.%s", name, key)
+			}
+		}
+	}
+
+	streamProps := defs["ReplicationStreamConfig"].(map[string]any)["properties"].(map[string]any)
+	assert.Equal(t, g.M("type", "string", "enum", modeValues()), streamProps["mode"])
+	assert.Equal(t, g.M("type", "array", "items", g.M("type", "string")), streamProps["select"])
+	assert.Equal(t, g.M("$ref", "#/definitions/SourceOptions"), streamProps["source_options"])
+
+	hookProps := streamProps["hooks"].(map[string]any)["properties"].(map[string]any)
+	assert.Contains(t, hookProps, "pre")
+	assert.NotContains(t, hookProps, "start")
+	assert.Equal(t, []string{"type"}, defs["Hook"].(map[string]any)["required"])
+
+	sourceProps := defs["SourceOptions"].(map[string]any)["properties"].(map[string]any)
+	assert.Equal(t, g.M("type", "boolean"), sourceProps["flatten"])
+	assert.Equal(t, g.M("type", "integer"), sourceProps["limit"])
+}
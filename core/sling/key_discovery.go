@@ -0,0 +1,167 @@
+package sling
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+)
+
+// KeyDiscovery is how the keys of an incremental stream are discovered from
+// the source metadata, when the primary_key and update_key are omitted.
+// It is opt-in, since it connects to the source to read its metadata.
+type KeyDiscovery string
+
+const (
+	// KeyDiscoveryPropose reports the discovered keys in the error
+	KeyDiscoveryPropose KeyDiscovery = "propose"
+	// KeyDiscoveryAuto adopts the discovered keys
+	KeyDiscoveryAuto KeyDiscovery = "auto"
+	// KeyDiscoveryOff does not discover the keys (default)
+	KeyDiscoveryOff KeyDiscovery = "off"
+)
+
+// ConfirmKeys asks to confirm the discovered keys of the stream before
+// adopting them (set by the CLI with `--confirm-keys`). The keys are not
+// adopted if it returns false.
+var ConfirmKeys func(stream string, keys DiscoveredKeys) bool
+
+// updateKeyCandidates are the common names of the last update column, by
+// preference. The column must be a date or a timestamp.
+var updateKeyCandidates = []string{
+	"updated_at", "updated_on", "updated", "update_time", "updated_time", "updated_date",
+	"modified_at", "modified_on", "modified", "modify_time", "modified_time", "modified_date",
+	"last_updated", "last_updated_at", "last_modified", "last_modified_at", "last_modified_date",
+	"changed_at", "last_changed", "_updated_at", "_modified_at",
+}
+
+// DiscoveredKeys are the keys of a table discovered from the source metadata
+type DiscoveredKeys struct {
+	PrimaryKey []string `json:"primary_key,omitempty"`
+	UpdateKey  string   `json:"update_key,omitempty"`
+}
+
+// IsEmpty returns true if no key was discovered
+func (k DiscoveredKeys) IsEmpty() bool {
+	return len(k.PrimaryKey) == 0 && k.UpdateKey == ""
+}
+
+func (k DiscoveredKeys) String() string {
+	parts := []string{}
+	if len(k.PrimaryKey) > 0 {
+		parts = append(parts, g.F("primary_key: [%s]", strings.Join(k.PrimaryKey, ", ")))
+	}
+	if k.UpdateKey != "" {
+		parts = append(parts, "update_key: "+k.UpdateKey)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Proposal returns the discovered keys to set, for the error message
+func (k DiscoveredKeys) Proposal() string {
+	if k.IsEmpty() {
+		return ""
+	}
+	return g.F(" Discovered from the source metadata: %s (set source option `key_discovery: auto` to adopt them).", k)
+}
+
+// DiscoverKeys returns the primary key of the table (from its constraints)
+// and the update key (a date or timestamp column with a common name, such
+// as `updated_at`)
+func DiscoverKeys(conn database.Connection, table database.Table) (keys DiscoveredKeys, err error) {
+	data, err := conn.GetPrimaryKeys(table.FullName())
+	if err != nil {
+		return keys, g.Error(err, "could not get primary keys of %s", table.FullName())
+	}
+
+	records := data.Records()
+	sort.SliceStable(records, func(i, j int) bool {
+		return cast.ToInt(records[i]["position"]) < cast.ToInt(records[j]["position"])
+	})
+	for _, rec := range records {
+		keys.PrimaryKey = append(keys.PrimaryKey, cast.ToString(rec["column_name"]))
+	}
+
+	columns, err := conn.GetColumns(table.FullName())
+	if err != nil {
+		return keys, g.Error(err, "could not get columns of %s", table.FullName())
+	}
+	keys.UpdateKey = discoverUpdateKey(columns)
+
+	return keys, nil
+}
+
+// discoverUpdateKey returns the first date or timestamp column matching
+// the candidate names
+func discoverUpdateKey(columns iop.Columns) string {
+	for _, candidate := range updateKeyCandidates {
+		for _, col := range columns {
+			if strings.EqualFold(col.Name, candidate) && (col.IsDatetime() || col.IsDate()) {
+				return col.Name
+			}
+		}
+	}
+	return ""
+}
+
+// discoverKeys discovers the keys of the source table, for an incremental
+// stream without keys, if set with `key_discovery`. They are adopted with
+// `auto` (once confirmed, with `--confirm-keys`), or only proposed with
+// `propose`.
+func (cfg *Config) discoverKeys(srcDbProvided bool) (keys DiscoveredKeys, adopted bool, err error) {
+	mode := KeyDiscoveryOff
+	if val := g.PtrVal(cfg.Source.Options).KeyDiscovery; val != nil && *val != "" {
+		mode = KeyDiscovery(strings.ToLower(string(*val)))
+	}
+
+	if !g.In(mode, KeyDiscoveryPropose, KeyDiscoveryAuto, KeyDiscoveryOff) {
+		return keys, false, g.Error("invalid key_discovery '%s', expected one of: propose, auto, off", mode)
+	} else if mode == KeyDiscoveryOff || !srcDbProvided {
+		return keys, false, nil
+	}
+
+	table, err := database.ParseTableName(cfg.Source.Stream, cfg.SrcConn.Type)
+	if err != nil || table.IsQuery() {
+		return keys, false, nil // custom SQL, no metadata
+	}
+
+	conn, err := cfg.SrcConn.AsDatabase()
+	if err == nil {
+		err = conn.Connect()
+	}
+	if err != nil {
+		g.Warn("could not connect to discover the keys of %s: %s", table.FullName(), err.Error())
+		return keys, false, nil
+	}
+	defer conn.Close()
+
+	keys, err = DiscoverKeys(conn, table)
+	if err != nil {
+		g.Warn("could not discover the keys of %s: %s", table.FullName(), err.Error())
+		return keys, false, nil
+	} else if keys.IsEmpty() || mode != KeyDiscoveryAuto {
+		return keys, false, nil
+	}
+
+	stream := lo.Ternary(cfg.StreamName != "", cfg.StreamName, cfg.Source.Stream)
+	if ConfirmKeys != nil && !ConfirmKeys(stream, keys) {
+		g.Warn("the discovered keys of %s were not confirmed", stream)
+		return keys, false, nil
+	}
+
+	g.Info("using the discovered keys of %s: %s", stream, keys)
+	if len(keys.PrimaryKey) > 0 {
+		cfg.Source.PrimaryKeyI = keys.PrimaryKey
+	}
+	cfg.Source.UpdateKey = keys.UpdateKey
+	if cfg.ReplicationStream != nil {
+		cfg.ReplicationStream.PrimaryKeyI = cfg.Source.PrimaryKeyI
+		cfg.ReplicationStream.UpdateKey = cfg.Source.UpdateKey
+	}
+
+	return keys, true, nil
+}
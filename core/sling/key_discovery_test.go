@@ -0,0 +1,91 @@
+package sling
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverKeys(t *testing.T) {
+	columns := iop.Columns{
+		{Name: "id", Type: iop.BigIntType},
+		{Name: "modified", Type: iop.StringType},
+		{Name: "Modified_At", Type: iop.TimestampType},
+		{Name: "created_at", Type: iop.TimestampType},
+	}
+	assert.Equal(t, "Modified_At", discoverUpdateKey(columns))
+	assert.Equal(t, "", discoverUpdateKey(columns[:2]))
+
+	dbURL := "sqlite://" + filepath.Join(t.TempDir(), "keys.db")
+	t.Setenv("KEYS_SQLITE", dbURL)
+	connection.GetLocalConns(true) // refresh the cached connections
+
+	conn, err := database.NewConn(dbURL)
+	if !assert.NoError(t, err) || !assert.NoError(t, conn.Connect()) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecMulti(`
+		create table users (id integer primary key, name text, updated_at datetime);
+		create table events (name text);
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	table, _ := database.ParseTableName("main.users", conn.GetType())
+	keys, err := DiscoverKeys(conn, table)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"id"}, keys.PrimaryKey)
+		assert.Equal(t, "updated_at", keys.UpdateKey)
+		assert.Equal(t, "primary_key: [id], update_key: updated_at", keys.String())
+	}
+
+	newTask := func(stream string, discovery KeyDiscovery) *TaskExecution {
+		cfg := &Config{
+			Source: Source{Conn: "KEYS_SQLITE", Stream: stream, Options: &SourceOptions{KeyDiscovery: &discovery}},
+			Target: Target{Conn: "KEYS_SQLITE", Object: "main.users_copy"},
+			Mode:   IncrementalMode,
+		}
+		return NewTask("", cfg)
+	}
+
+	// not discovered by default
+	task := newTask("main.users", "")
+	if assert.Error(t, task.Err) {
+		assert.NotContains(t, task.Err.Error(), "Discovered")
+	}
+
+	// proposed in the error
+	task = newTask("main.users", KeyDiscoveryPropose)
+	if assert.Error(t, task.Err) {
+		assert.Contains(t, task.Err.Error(), "Discovered from the source metadata: primary_key: [id], update_key: updated_at")
+	}
+
+	// adopted with auto
+	task = newTask("main.users", KeyDiscoveryAuto)
+	if assert.NoError(t, task.Err) {
+		assert.Equal(t, []string{"id"}, task.Config.Source.PrimaryKey())
+		assert.Equal(t, "updated_at", task.Config.Source.UpdateKey)
+	}
+
+	// not adopted if not confirmed
+	ConfirmKeys = func(stream string, keys DiscoveredKeys) bool { return false }
+	defer func() { ConfirmKeys = nil }()
+	task = newTask("main.users", KeyDiscoveryAuto)
+	assert.ErrorContains(t, task.Err, "Discovered from the source metadata")
+
+	// nothing to discover
+	task = newTask("main.events", KeyDiscoveryAuto)
+	if assert.Error(t, task.Err) {
+		assert.NotContains(t, task.Err.Error(), "Discovered")
+	}
+
+	task = newTask("main.users", "sometimes")
+	assert.ErrorContains(t, task.Err, "invalid key_discovery")
+}
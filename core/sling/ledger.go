@@ -0,0 +1,170 @@
+package sling
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+)
+
+// OnSeen is the action for files which are in the processed-file ledger
+type OnSeen string
+
+const (
+	// OnSeenSkip does not load files which were already loaded, unless changed
+	OnSeenSkip OnSeen = "skip"
+	// OnSeenReload loads all files again, and updates the ledger
+	OnSeenReload OnSeen = "reload"
+)
+
+// Validate checks the on_seen value
+func (o OnSeen) Validate() error {
+	if !g.In(o, OnSeenSkip, OnSeenReload) {
+		return g.Error("invalid source option on_seen: %s (expected skip or reload)", o)
+	}
+	return nil
+}
+
+// LedgerFile is a file recorded in the processed-file ledger of a stream
+type LedgerFile struct {
+	URI      string    `json:"uri"`
+	Size     uint64    `json:"size"`
+	Updated  int64     `json:"updated"`  // modified time, unix seconds
+	Checksum string    `json:"checksum"` // md5 of uri, size & modified time
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// NewLedgerFile returns the ledger entry of a file node
+func NewLedgerFile(node filesys.FileNode) LedgerFile {
+	return LedgerFile{
+		URI:      node.URI,
+		Size:     node.Size,
+		Updated:  node.Updated,
+		Checksum: g.MD5(node.URI, cast.ToString(node.Size), cast.ToString(node.Updated)),
+	}
+}
+
+// LedgerGet returns the files loaded for a stream, keyed by uri.
+// Set by the store, which persists the ledger in the local sling database.
+var LedgerGet = func(streamID string) (files map[string]LedgerFile, err error) {
+	return nil, g.Error("processed-file ledger is not available")
+}
+
+// LedgerSet records the loaded files of a stream
+var LedgerSet = func(streamID string, files []LedgerFile) (err error) {
+	return g.Error("processed-file ledger is not available")
+}
+
+// LedgerReset deletes the ledger of a stream
+var LedgerReset = func(streamID string) (err error) {
+	return g.Error("processed-file ledger is not available")
+}
+
+// ledgerResets holds the stream ids of which the ledger was reset
+var ledgerResets sync.Map
+
+// ledgerNewFiles returns the files to load. Unchanged files present in the
+// ledger are skipped, unless on_seen is reload.
+func ledgerNewFiles(nodes filesys.FileNodes, seen map[string]LedgerFile, onSeen OnSeen) (files []LedgerFile) {
+	for _, node := range nodes {
+		if node.IsDir {
+			continue
+		}
+
+		file := NewLedgerFile(node)
+		if prev, ok := seen[file.URI]; ok && prev.Checksum == file.Checksum && onSeen == OnSeenSkip {
+			continue
+		}
+		files = append(files, file)
+	}
+	return
+}
+
+// usesLedger returns true if the processed files are recorded in the ledger
+func (t *TaskExecution) usesLedger() bool {
+	return t.Config.sourceIsFile() && !t.Config.Options.StdIn &&
+		g.PtrVal(t.Config.Source.Options).OnSeen != nil
+}
+
+// selectSourceFiles lists the files of the stream, and sets the files
+// to read into the file_select option. Unchanged files in the ledger are
+// excluded. Returns the number of files to load.
+func (t *TaskExecution) selectSourceFiles(fs filesys.FileSysClient, uri string, fsCfg *iop.FileStreamConfig) (count int, err error) {
+	nodes, err := fs.Self().ListRecursive(uri)
+	if err != nil {
+		return 0, g.Error(err, "could not list files")
+	}
+
+	// keep the existing file selection
+	if fileSelect := g.PtrVal(fsCfg.FileSelect); len(fileSelect) > 0 {
+		excluded := lo.Filter(fileSelect, func(name string, i int) bool { return strings.HasPrefix(name, "-!") })
+		if prefixes, _ := lo.Difference(fileSelect, excluded); len(prefixes) > 0 {
+			nodes = nodes.SelectWithPrefix(prefixes...)
+		}
+		nodes = lo.Filter(nodes, func(node filesys.FileNode, i int) bool {
+			return !g.In("-!"+node.URI, excluded...) && !g.In("-!"+node.Path(), excluded...)
+		})
+	}
+
+	// keep the files newer than the stored watermark
+	if t.usesFileWatermark() {
+		if nodes, t.fileWatermark, err = t.watermarkNewFiles(nodes); err != nil {
+			return 0, err
+		}
+	}
+
+	seen := map[string]LedgerFile{}
+	onSeen := OnSeenReload
+	if t.usesLedger() {
+		streamID := t.Config.StreamID()
+
+		// reset once per process, not at every poll in watch mode
+		if _, done := ledgerResets.LoadOrStore(streamID, true); !done && cast.ToBool(os.Getenv("SLING_LEDGER_RESET")) {
+			if err = LedgerReset(streamID); err != nil {
+				return 0, g.Error(err, "could not reset file ledger")
+			}
+			g.Info("reset file ledger for stream %s", t.Config.StreamName)
+		}
+
+		if seen, err = LedgerGet(streamID); err != nil {
+			return 0, g.Error(err, "could not get file ledger")
+		}
+		onSeen = OnSeen(strings.ToLower(*t.Config.Source.Options.OnSeen))
+	}
+
+	t.readFs = fs
+	t.readFiles = ledgerNewFiles(nodes, seen, onSeen)
+
+	selected := make([]string, len(t.readFiles))
+	for i, file := range t.readFiles {
+		selected[i] = file.URI
+	}
+	fsCfg.FileSelect = &selected
+
+	g.Debug("selected %d files to load, %d files already loaded (on_seen=%s)", len(t.readFiles), len(seen), onSeen)
+
+	return len(t.readFiles), nil
+}
+
+// ledgerRecord records the loaded files, once written successfully
+func (t *TaskExecution) ledgerRecord() (err error) {
+	if !t.usesLedger() || len(t.readFiles) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for i := range t.readFiles {
+		t.readFiles[i].LoadedAt = now
+	}
+
+	if err = LedgerSet(t.Config.StreamID(), t.readFiles); err != nil {
+		return g.Error(err, "could not record files in ledger")
+	}
+	return nil
+}
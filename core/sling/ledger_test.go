@@ -0,0 +1,41 @@
+package sling
+
+import (
+	"testing"
+
+	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLedgerNewFiles(t *testing.T) {
+	nodes := filesys.FileNodes{
+		{URI: "s3://bucket/landing/", IsDir: true},
+		{URI: "s3://bucket/landing/a.csv", Size: 100, Updated: 1700000000},
+		{URI: "s3://bucket/landing/b.csv", Size: 200, Updated: 1700000000},
+		{URI: "s3://bucket/landing/c.csv", Size: 300, Updated: 1700000000},
+	}
+
+	seen := map[string]LedgerFile{}
+	for _, node := range nodes[1:3] {
+		seen[node.URI] = NewLedgerFile(node)
+	}
+
+	// b.csv was modified since loaded
+	nodes[2].Size = 250
+
+	uris := func(files []LedgerFile) (uris []string) {
+		for _, file := range files {
+			uris = append(uris, file.URI)
+		}
+		return
+	}
+
+	files := ledgerNewFiles(nodes, seen, OnSeenSkip)
+	assert.Equal(t, []string{"s3://bucket/landing/b.csv", "s3://bucket/landing/c.csv"}, uris(files))
+
+	files = ledgerNewFiles(nodes, seen, OnSeenReload)
+	assert.Len(t, files, 3)
+
+	assert.NoError(t, OnSeenSkip.Validate())
+	assert.Error(t, OnSeen("ignore").Validate())
+}
@@ -0,0 +1,256 @@
+package sling
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/flarco/g/net"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+)
+
+// RunManifest is the machine-readable record of a run (streams, source and
+// target datasets, column mappings, row counts, watermarks and durations),
+// for lineage tools such as OpenLineage / Marquez. It is written at the end
+// of the run to the path or http(s) url of `SLING_MANIFEST` (or --manifest).
+type RunManifest struct {
+	ExecID    string           `json:"exec_id"`
+	Producer  string           `json:"producer"`
+	Config    string           `json:"config,omitempty"` // replication / pipeline file path
+	Status    ExecStatus       `json:"status"`
+	StartTime time.Time        `json:"start_time"`
+	EndTime   time.Time        `json:"end_time"`
+	Duration  int64            `json:"duration"` // seconds
+	Streams   []ManifestStream `json:"streams"`
+
+	mux sync.Mutex
+}
+
+// ManifestStream is a stream run in the manifest
+type ManifestStream struct {
+	Stream    string             `json:"stream"`
+	Source    ManifestDataset    `json:"source"`
+	Target    ManifestDataset    `json:"target"`
+	Mode      Mode               `json:"mode"`
+	Status    ExecStatus         `json:"status"`
+	Rows      uint64             `json:"rows"`
+	Bytes     uint64             `json:"bytes"`
+	StartTime *time.Time         `json:"start_time,omitempty"`
+	EndTime   *time.Time         `json:"end_time,omitempty"`
+	Duration  int64              `json:"duration"` // seconds
+	Watermark *ManifestWatermark `json:"watermark,omitempty"`
+	Columns   []ManifestColumn   `json:"columns,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	Warnings  []string           `json:"warnings,omitempty"`
+
+	// ConfigChanges are the changes of the stream config since the
+	// last recorded run, e.g. `mode: full-refresh -> incremental`
+	ConfigChanges []string `json:"config_changes,omitempty"`
+}
+
+// ManifestDataset identifies a source or target dataset. The namespace is
+// the connection url without credentials (e.g. postgres://host:5432), as
+// in the OpenLineage naming conventions.
+type ManifestDataset struct {
+	Conn      string    `json:"conn"`
+	Type      dbio.Type `json:"type"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+}
+
+// ManifestColumn maps a source column to its target column
+type ManifestColumn struct {
+	Source    string         `json:"source,omitempty"` // empty for the columns added by sling
+	Target    string         `json:"target"`
+	Type      iop.ColumnType `json:"type"`
+	Sanitized string         `json:"sanitized,omitempty"` // the reasons of the renaming by the column sanitizer
+}
+
+// ManifestWatermark is the incremental value range of the update key
+type ManifestWatermark struct {
+	Column string `json:"column"`
+	From   string `json:"from,omitempty"` // the value the stream was read from
+	To     string `json:"to,omitempty"`   // the maximum value loaded
+}
+
+// NewRunManifest returns a manifest for the run
+func NewRunManifest(execID, configPath string) *RunManifest {
+	return &RunManifest{
+		ExecID:    execID,
+		Producer:  "sling-cli/" + core.Version,
+		Config:    configPath,
+		StartTime: time.Now(),
+		Streams:   []ManifestStream{},
+	}
+}
+
+// Add records the executed task in the manifest
+func (m *RunManifest) Add(t *TaskExecution) {
+	if m == nil || t == nil || t.Config == nil {
+		return
+	}
+
+	cfg := t.Config
+	stream := ManifestStream{
+		Stream:    cfg.StreamName,
+		Source:    newManifestDataset(cfg.SrcConn, cfg.Source.Stream),
+		Target:    newManifestDataset(cfg.TgtConn, cfg.Target.Object),
+		Mode:      cfg.Mode,
+		Status:    t.Status,
+		Rows:      t.GetCount(),
+		StartTime: t.StartTime,
+		EndTime:   t.EndTime,
+	}
+	if stream.Stream == "" {
+		stream.Stream = cfg.Source.Stream
+	}
+	if t.StartTime != nil && t.EndTime != nil {
+		stream.Duration = cast.ToInt64(t.EndTime.Sub(*t.StartTime).Seconds())
+	}
+	if inBytes, outBytes := t.GetBytes(); inBytes > 0 {
+		stream.Bytes = inBytes
+	} else {
+		stream.Bytes = outBytes
+	}
+	if t.Err != nil {
+		stream.Error = g.ErrMsgSimple(t.Err)
+	}
+	stream.Warnings = t.Warnings()
+	stream.ConfigChanges = cfg.recordConfigSnapshot()
+
+	var columns iop.Columns
+	if df := t.Df(); df != nil {
+		columns = df.Columns
+	}
+	for _, col := range columns {
+		source := col.Name
+		if name := col.Metadata[columnSourceNameKey]; name != "" {
+			source = name
+		}
+		if strings.HasPrefix(strings.ToLower(source), "_sling_") {
+			source = "" // added by sling (loaded_at, exec_id, ...)
+		}
+		stream.Columns = append(stream.Columns, ManifestColumn{Source: source, Target: col.Name, Type: col.Type, Sanitized: col.Metadata[columnSanitizedKey]})
+	}
+
+	stream.Watermark = t.manifestWatermark(columns)
+
+	m.mux.Lock()
+	m.Streams = append(m.Streams, stream)
+	m.mux.Unlock()
+}
+
+// Write finalizes the manifest, and writes it to the file path,
+// or posts it to the http(s) url
+func (m *RunManifest) Write(uri string) (err error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.finalize()
+
+	payload := g.Pretty(m)
+	if strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://") {
+		headers := map[string]string{"Content-Type": "application/json"}
+		if _, _, err = net.ClientDo("POST", uri, bytes.NewBufferString(payload), headers); err != nil {
+			return g.Error(err, "could not post manifest to %s", uri)
+		}
+		return nil
+	}
+
+	uri = strings.TrimPrefix(uri, "file://")
+	if err = os.MkdirAll(filepath.Dir(uri), 0755); err != nil {
+		return g.Error(err, "could not create folder for manifest %s", uri)
+	} else if err = os.WriteFile(uri, []byte(payload), 0644); err != nil {
+		return g.Error(err, "could not write manifest to %s", uri)
+	}
+
+	return nil
+}
+
+// finalize sets the end time and the status of the run
+func (m *RunManifest) finalize() {
+	if m.EndTime.IsZero() {
+		m.EndTime = time.Now()
+	}
+	m.Duration = cast.ToInt64(m.EndTime.Sub(m.StartTime).Seconds())
+	m.Status = ExecStatusSuccess
+	for _, stream := range m.Streams {
+		if stream.Status.IsFailure() {
+			m.Status = ExecStatusError
+		}
+	}
+}
+
+// columnSourceNameKey is the column metadata key of the source column name,
+// set when the column is renamed for the target (column casing)
+const columnSourceNameKey = "source_name"
+
+func newManifestDataset(conn connection.Connection, name string) ManifestDataset {
+	dataset := ManifestDataset{Conn: conn.Name, Type: conn.Type, Name: name}
+
+	u, err := url.Parse(conn.URL())
+	if err != nil || u.Scheme == "" {
+		dataset.Namespace = conn.Type.String()
+		return dataset
+	}
+
+	// no credentials nor options
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+	if u.Host != "" && conn.Type.IsDb() {
+		u.Path = ""
+	}
+	dataset.Namespace = strings.TrimSuffix(u.String(), "/")
+
+	// file urls are relative to the namespace, tables are unquoted
+	if conn.Type.IsFile() && strings.HasPrefix(name, dataset.Namespace) {
+		dataset.Name = strings.TrimPrefix(name, dataset.Namespace)
+	} else if table, err := database.ParseTableName(name, conn.Type); conn.Type.IsDb() && err == nil && !table.IsQuery() {
+		dataset.Name = strings.Join(lo.Compact([]string{table.Database, table.Schema, table.Name}), ".")
+	}
+
+	return dataset
+}
+
+// manifestWatermark returns the incremental value range of the update key,
+// nil if the stream is not incremental
+func (t *TaskExecution) manifestWatermark(columns iop.Columns) (watermark *ManifestWatermark) {
+	cfg := t.Config
+	updateKey := cfg.Source.UpdateKey
+	if updateKey == "" || (cfg.Mode != IncrementalMode && cfg.Mode != BackfillMode) {
+		return nil
+	}
+
+	watermark = &ManifestWatermark{Column: updateKey}
+	if cfg.HasIncrementalVal() {
+		watermark.From = cast.ToString(cfg.IncrementalVal)
+		if val, ok := cfg.IncrementalVal.(time.Time); ok {
+			watermark.From = val.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	if col := columns.GetColumn(updateKey); col != nil && t.GetCount() > 0 {
+		watermark.To = manifestMaxValue(col)
+	}
+	return watermark
+}
+
+// manifestMaxValue returns the maximum value of the column stats
+func manifestMaxValue(col *iop.Column) string {
+	switch {
+	case col.Type.IsDatetime() || col.Type.IsDate():
+		return time.UnixMicro(col.Stats.Max).UTC().Format(time.RFC3339Nano)
+	case col.Type.IsInteger():
+		return cast.ToString(col.Stats.Max)
+	}
+	return cast.ToString(col.Stats.LastVal)
+}
@@ -0,0 +1,327 @@
+package sling
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+)
+
+// BatchNumberPlaceholder is resolved with the micro-batch number,
+// in the target object of file targets
+const BatchNumberPlaceholder = "{batch_number}"
+
+// DefaultMicroBatchInterval is the time trigger of a socket source,
+// when no micro-batch trigger is provided
+var DefaultMicroBatchInterval = 10 * time.Second
+
+// usesMicroBatches returns true if the stdin (or socket) stream is
+// written to the target in micro-batches, on a size or time trigger
+func (cfg *Config) usesMicroBatches() bool {
+	so := cfg.Source.Options
+	if so == nil || !cfg.Options.StdIn {
+		return false
+	}
+	return g.PtrVal(so.MicroBatchRows) > 0 || g.PtrVal(so.MicroBatchInterval) != "" || g.PtrVal(so.Socket) != ""
+}
+
+// microBatchTriggers returns the row count and interval triggers of the micro-batches
+func (cfg *Config) microBatchTriggers() (rows int, interval time.Duration, err error) {
+	so := g.PtrVal(cfg.Source.Options)
+	rows = g.PtrVal(so.MicroBatchRows)
+	if rows < 0 {
+		return 0, 0, g.Error("micro_batch_rows cannot be negative")
+	}
+
+	if val := g.PtrVal(so.MicroBatchInterval); val != "" {
+		if interval, err = time.ParseDuration(val); err != nil {
+			return 0, 0, g.Error(err, "invalid micro_batch_interval: %s", val)
+		} else if interval < 100*time.Millisecond {
+			return 0, 0, g.Error("micro_batch_interval must be at least 100ms, got %s", val)
+		}
+	} else if rows == 0 {
+		interval = DefaultMicroBatchInterval
+	}
+
+	return rows, interval, nil
+}
+
+// validateMicroBatches checks the micro-batch options
+func (cfg *Config) validateMicroBatches() (err error) {
+	so := g.PtrVal(cfg.Source.Options)
+	if !cfg.usesMicroBatches() {
+		if so.MicroBatchRows != nil || so.MicroBatchInterval != nil {
+			return g.Error("invalid source option: micro_batch_rows and micro_batch_interval require a stdin or socket source")
+		}
+		return nil
+	}
+
+	if _, _, err = cfg.microBatchTriggers(); err != nil {
+		return g.Error(err, "invalid source option")
+	}
+
+	if g.PtrVal(so.Socket) != "" && cfg.Source.Conn != "" {
+		return g.Error("invalid source option: socket cannot be used with a source connection")
+	}
+
+	// each batch is written into its own file
+	if !cfg.Options.StdOut && cfg.TgtConn.Type.IsFile() && !strings.Contains(cfg.TgtConn.URL(), BatchNumberPlaceholder) {
+		return g.Error("invalid source option: micro-batches into files require a %s placeholder in the target object", BatchNumberPlaceholder)
+	}
+
+	return nil
+}
+
+// microBatcher splits a continuous stream of NDJSON or CSV lines into
+// batches, on a row count or time trigger. Records must be on a single
+// line (CSV values with line breaks are not supported).
+// With a CSV stream, the header line is repeated at the top of each batch.
+type microBatcher struct {
+	rows      int
+	interval  time.Duration
+	format    dbio.FileType // detected from the first line if none
+	csvHeader bool          // whether csv streams start with a header line
+	header    string
+	lines     chan string
+	errChan   chan error
+	closer    io.Closer
+	mux       sync.Mutex
+	wg        sync.WaitGroup
+}
+
+// newMicroBatcher creates a batcher with the triggers of the source options
+func newMicroBatcher(cfg *Config) (mb *microBatcher, err error) {
+	mb = &microBatcher{
+		lines:   make(chan string, 10000),
+		errChan: make(chan error, 1),
+	}
+
+	if mb.rows, mb.interval, err = cfg.microBatchTriggers(); err != nil {
+		return nil, err
+	}
+
+	so := g.PtrVal(cfg.Source.Options)
+	mb.format = g.PtrVal(so.Format)
+	mb.csvHeader = so.Header == nil || *so.Header
+
+	return mb, nil
+}
+
+// start reads the lines from stdin, or from the connections
+// of the unix socket, until the context is canceled
+func (mb *microBatcher) start(ctx context.Context, socketPath string) (err error) {
+	if socketPath == "" {
+		go func() {
+			mb.readLines(os.Stdin)
+			close(mb.lines)
+		}()
+		return nil
+	}
+
+	// remove a stale socket file
+	if _, err := os.Stat(socketPath); err == nil {
+		os.Remove(socketPath)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return g.Error(err, "could not listen on socket: %s", socketPath)
+	}
+	mb.closer = listener
+	g.Info("listening on socket %s", socketPath)
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	go func() {
+		defer func() {
+			mb.wg.Wait()
+			close(mb.lines)
+		}()
+
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return // listener closed
+			}
+			mb.wg.Add(1)
+			go func() {
+				defer mb.wg.Done()
+				defer conn.Close()
+				mb.readLines(conn)
+			}()
+		}
+	}()
+
+	return nil
+}
+
+// readLines pushes the lines of the reader into the batcher. For CSV,
+// the first line of each reader is the header, kept from the first reader.
+func (mb *microBatcher) readLines(reader io.Reader) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 100*1024*1024)
+
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if !first {
+			mb.lines <- line
+			continue
+		}
+		first = false
+
+		mb.mux.Lock()
+		if mb.format == dbio.FileTypeNone {
+			mb.format = lo.Ternary(strings.HasPrefix(strings.TrimSpace(line), "{"), dbio.FileTypeJsonLines, dbio.FileTypeCsv)
+		}
+		if mb.format == dbio.FileTypeCsv && mb.csvHeader {
+			header := mb.header
+			if header == "" {
+				mb.header = line
+			}
+			mb.mux.Unlock()
+
+			if header != "" && header != line {
+				g.Warn("skipping csv stream with different header: %s", line)
+				return
+			}
+			continue
+		}
+		mb.mux.Unlock()
+
+		mb.lines <- line
+	}
+
+	if err := scanner.Err(); err != nil {
+		select {
+		case mb.errChan <- g.Error(err, "could not read stream"):
+		default:
+		}
+	}
+}
+
+// Next returns the lines of the next batch, once a trigger is reached.
+// It returns io.EOF with the remaining lines when the stream ends.
+func (mb *microBatcher) Next(ctx context.Context) (batch []byte, count int, err error) {
+	var buf bytes.Buffer
+
+	var timer <-chan time.Time
+	if mb.interval > 0 {
+		ticker := time.NewTicker(mb.interval)
+		defer ticker.Stop()
+		timer = ticker.C
+	}
+
+	makeBatch := func() []byte {
+		if count == 0 {
+			return nil
+		}
+		mb.mux.Lock()
+		header := mb.header
+		mb.mux.Unlock()
+
+		if header != "" {
+			return append([]byte(header+"\n"), buf.Bytes()...)
+		}
+		return buf.Bytes()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if count > 0 {
+				g.Warn("stream canceled, discarding %d rows not yet written", count)
+			}
+			return nil, 0, io.EOF
+		case err = <-mb.errChan:
+			return nil, 0, err
+		case line, ok := <-mb.lines:
+			if !ok {
+				return makeBatch(), count, io.EOF
+			}
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+			count++
+			if mb.rows > 0 && count >= mb.rows {
+				return makeBatch(), count, nil
+			}
+		case <-timer:
+			if count > 0 {
+				return makeBatch(), count, nil
+			}
+		}
+	}
+}
+
+// Close stops listening on the socket
+func (mb *microBatcher) Close() {
+	if mb.closer != nil {
+		mb.closer.Close()
+	}
+}
+
+// runMicroBatches reads the continuous stdin (or socket) stream, and runs
+// runFunc to write each micro-batch into the target. After the first batch,
+// the rows of full-refresh and truncate tasks are appended.
+func (t *TaskExecution) runMicroBatches(runFunc func() error) (err error) {
+	batcher, err := newMicroBatcher(t.Config)
+	if err != nil {
+		return g.Error(err, "could not read stream")
+	} else if err = batcher.start(t.Context.Ctx, g.PtrVal(t.Config.Source.Options.Socket)); err != nil {
+		return g.Error(err, "could not read stream")
+	}
+	defer batcher.Close()
+
+	urlTemplate := t.Config.TgtConn.URL()
+	defer func() { t.stdin = nil }()
+
+	total := 0
+	for number := 1; ; number++ {
+		batch, count, err := batcher.Next(t.Context.Ctx)
+		if err != nil && err != io.EOF {
+			return g.Error(err, "could not read micro-batch #%d", number)
+		}
+
+		if count > 0 {
+			if strings.Contains(urlTemplate, BatchNumberPlaceholder) {
+				url := strings.ReplaceAll(urlTemplate, BatchNumberPlaceholder, fmt.Sprintf("%06d", number))
+				t.Config.TgtConn.Set(g.M("url", url))
+			}
+
+			t.SetProgress("writing micro-batch #%d (%d rows)", number, count)
+			t.stdin = bytes.NewReader(batch)
+			if err := runFunc(); err != nil {
+				return g.Error(err, "could not write micro-batch #%d", number)
+			}
+			total += count
+
+			if t.Config.Mode == FullRefreshMode || t.Config.Mode == TruncateMode {
+				t.Config.Mode = IncrementalMode // append next batches
+			}
+		} else {
+			number--
+		}
+
+		if err == io.EOF {
+			t.SetProgress("wrote %d rows in %d micro-batches", total, number)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package sling
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+// Override is a config value set from the command line, such as
+// `streams.users.mode=full-refresh` or `defaults.target_options.batch_size=50000`
+type Override struct {
+	Path  []string
+	Value any
+}
+
+// ParseOverride parses a `key.path=value` override. Keys containing dots can
+// be quoted (`streams."public.users".mode=full-refresh`), and the value is
+// parsed as YAML (numbers, booleans, lists such as `[id, name]`...).
+func ParseOverride(text string) (o Override, err error) {
+	key, value, found := strings.Cut(text, "=")
+	if !found {
+		return o, g.Error("invalid override (expected key.path=value): %s", text)
+	}
+
+	o.Path, err = splitOverridePath(strings.TrimSpace(key))
+	if err != nil {
+		return o, g.Error(err, "invalid override key: %s", key)
+	}
+
+	value = strings.TrimSpace(value)
+	if err = yaml.Unmarshal([]byte(value), &o.Value); err != nil {
+		o.Value = value // keep as string
+	}
+
+	return o, nil
+}
+
+// OverrideArgs returns the values of the `--set` flags in the command line
+// arguments, as given. The flag parser splits slice values on commas, which
+// cannot be joined back unambiguously (e.g. `where=a=1,b=2`).
+func OverrideArgs(cliArgs []string) (overrides []string) {
+	for i := 0; i < len(cliArgs); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(cliArgs[i], "-"), "=")
+		if name != "set" || !strings.HasPrefix(cliArgs[i], "-") {
+			continue
+		} else if !hasValue {
+			if i+1 >= len(cliArgs) {
+				break
+			}
+			i++
+			value = cliArgs[i]
+		}
+		overrides = append(overrides, value)
+	}
+	return overrides
+}
+
+func splitOverridePath(key string) (path []string, err error) {
+	var (
+		part   strings.Builder
+		quoted bool
+	)
+	for _, r := range key {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == '.' && !quoted:
+			path = append(path, part.String())
+			part.Reset()
+		default:
+			part.WriteRune(r)
+		}
+	}
+	path = append(path, part.String())
+
+	if quoted {
+		return nil, g.Error("unterminated quote")
+	}
+	for _, p := range path {
+		if p == "" {
+			return nil, g.Error("empty key")
+		}
+	}
+	return path, nil
+}
+
+// Apply sets the value in the config map, creating the missing levels.
+// A key with dots (such as the stream `public.users`) matches an existing
+// key of the map.
+func (o Override) Apply(m map[string]any) error {
+	path := o.Path
+	for len(path) > 0 {
+		keys := lo.Keys(m)
+		sort.Strings(keys)
+		key, n := matchOverrideKey(keys, path)
+		path = path[n:]
+		if len(path) == 0 {
+			m[key] = o.Value
+			return nil
+		}
+
+		switch next := m[key].(type) {
+		case map[string]any:
+			m = next
+		case nil:
+			newMap := map[string]any{}
+			m[key] = newMap
+			m = newMap
+		default:
+			return g.Error("cannot set %s, since %s is not a mapping", strings.Join(o.Path, "."), key)
+		}
+	}
+	return nil
+}
+
+// ApplyNode sets the value in the YAML mapping node, creating the missing
+// levels. The order of the keys, the comments and the anchors are kept.
+func (o Override) ApplyNode(node *yaml.Node) error {
+	value := &yaml.Node{}
+	if err := value.Encode(o.Value); err != nil {
+		return g.Error(err, "could not encode value of %s", strings.Join(o.Path, "."))
+	}
+
+	path := o.Path
+	for len(path) > 0 {
+		keys := make([]string, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keys = append(keys, node.Content[i].Value)
+		}
+		key, n := matchOverrideKey(keys, path)
+		path = path[n:]
+
+		index := lo.IndexOf(keys, key)
+		if index == -1 {
+			node.Content = append(node.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+				&yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"},
+			)
+			index = len(keys)
+		}
+		next := node.Content[index*2+1]
+
+		if len(path) == 0 {
+			node.Content[index*2+1] = value
+			return nil
+		}
+
+		if next.Kind == yaml.AliasNode {
+			// only change the value at this path, not the anchored one
+			*next = *copyNode(next.Alias)
+			next.Anchor = ""
+		}
+
+		switch {
+		case next.Kind == yaml.MappingNode:
+			node = next
+		case next.Kind == yaml.ScalarNode && next.Tag == "!!null":
+			*next = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node = next
+		default:
+			return g.Error("cannot set %s, since %s is not a mapping", strings.Join(o.Path, "."), key)
+		}
+	}
+	return nil
+}
+
+// copyNode returns a deep copy of the YAML node
+func copyNode(node *yaml.Node) *yaml.Node {
+	newNode := *node
+	newNode.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		newNode.Content[i] = copyNode(child)
+	}
+	return &newNode
+}
+
+// matchOverrideKey returns the key matching the first parts of the path
+// (the longest one), and the number of parts used
+func matchOverrideKey(keys []string, path []string) (key string, n int) {
+	for n = len(path); n > 0; n-- {
+		candidate := strings.Join(path[:n], ".")
+		if lo.Contains(keys, candidate) {
+			return candidate, n
+		}
+		for _, k := range keys {
+			if strings.EqualFold(k, candidate) {
+				return k, n
+			}
+		}
+	}
+	return path[0], 1
+}
+
+// ApplyOverrides applies the overrides to the config content (YAML or
+// JSON), returning the new content as YAML
+func ApplyOverrides(content string, overrides []string) (string, error) {
+	if len(overrides) == 0 {
+		return content, nil
+	}
+
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal([]byte(content), doc); err != nil {
+		return content, g.Error(err, "could not parse config to apply overrides")
+	}
+
+	// the root mapping
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return content, g.Error("could not apply overrides, config is not a mapping")
+	}
+
+	for _, text := range overrides {
+		o, err := ParseOverride(text)
+		if err != nil {
+			return content, err
+		} else if err = o.ApplyNode(root); err != nil {
+			return content, g.Error(err, "could not apply override: %s", text)
+		}
+		g.Debug("config override: %s", text)
+	}
+
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return content, g.Error(err, "could not marshal config with overrides")
+	}
+	return string(out), nil
+}
+
+// ApplyOverridesMap applies the overrides to the config map
+func ApplyOverridesMap(m map[string]any, overrides []string) error {
+	for _, text := range overrides {
+		o, err := ParseOverride(text)
+		if err != nil {
+			return err
+		} else if err = o.Apply(m); err != nil {
+			return g.Error(err, "could not apply override: %s", text)
+		}
+		g.Debug("config override: %s", text)
+	}
+	return nil
+}
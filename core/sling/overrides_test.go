@@ -0,0 +1,134 @@
+package sling
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOverride(t *testing.T) {
+	o, err := ParseOverride("defaults.target_options.batch_size=50000")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"defaults", "target_options", "batch_size"}, o.Path)
+		assert.Equal(t, 50000, o.Value)
+	}
+
+	o, err = ParseOverride(`streams."public.users".primary_key=[id, name]`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"streams", "public.users", "primary_key"}, o.Path)
+		assert.Equal(t, []any{"id", "name"}, o.Value)
+	}
+
+	o, err = ParseOverride("streams.users.mode = full-refresh")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "full-refresh", o.Value)
+	}
+
+	o, err = ParseOverride("streams.users.where=status='a',a=b")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"streams", "users", "where"}, o.Path)
+		assert.Equal(t, "status='a',a=b", o.Value)
+	}
+
+	for _, text := range []string{"mode", "streams..mode=x", `streams."users.mode=x`} {
+		_, err = ParseOverride(text)
+		assert.Error(t, err, text)
+	}
+
+	assert.Equal(t,
+		[]string{"streams.users.primary_key=id,name", "streams.users.where=status='a',a=b", "mode=incremental"},
+		OverrideArgs([]string{
+			"run", "-r", "replication.yaml",
+			"--set", "streams.users.primary_key=id,name",
+			"--set=streams.users.where=status='a',a=b",
+			"-d", "-set", "mode=incremental", "--set",
+		}),
+	)
+}
+
+func TestApplyOverrides(t *testing.T) {
+	content := `
+source: MY_PG
+target: MY_SNOWFLAKE
+
+defaults:
+  mode: incremental
+  object: 'raw.{stream_table}'
+
+streams:
+  public.users:
+  public.orders:
+    mode: incremental
+    update_key: updated_at
+`
+
+	content, err := ApplyOverrides(content, []string{
+		"streams.public.users.mode=full-refresh",
+		"streams.PUBLIC.ORDERS.source_options.limit=100",
+		"defaults.target_options.batch_size=50000",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	replication, err := UnmarshalReplication(content)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Len(t, replication.Streams, 2)
+	assert.EqualValues(t, "full-refresh", replication.Streams["public.users"].Mode)
+	assert.EqualValues(t, "incremental", replication.Streams["public.orders"].Mode)
+	assert.Equal(t, "updated_at", replication.Streams["public.orders"].UpdateKey)
+	assert.Equal(t, 100, *replication.Streams["public.orders"].SourceOptions.Limit)
+	assert.EqualValues(t, 50000, *replication.Defaults.TargetOptions.BatchSize)
+
+	// cannot go through a scalar
+	_, err = ApplyOverrides(content, []string{"defaults.mode.x=1"})
+	assert.Error(t, err)
+}
+
+func TestApplyOverridesOrder(t *testing.T) {
+	content := `
+source: MY_PG
+target: MY_SNOWFLAKE
+
+base: &base
+  mode: incremental
+  update_key: updated_at
+
+streams:
+  # runs first
+  zeta:
+  alpha: *base
+  mid:
+    <<: *base
+`
+
+	content, err := ApplyOverrides(content, []string{
+		"streams.alpha.mode=full-refresh",
+		"streams.mid.primary_key=[id]",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the keys are in the original order, with the comments and anchors
+	assert.Less(t, strings.Index(content, "zeta:"), strings.Index(content, "alpha:"))
+	assert.Less(t, strings.Index(content, "alpha:"), strings.Index(content, "mid:"))
+	assert.Contains(t, content, "# runs first")
+	assert.Contains(t, content, "<<: *base")
+
+	replication, err := UnmarshalReplication(content)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"zeta", "alpha", "mid"}, replication.StreamsOrdered())
+
+	// the anchored value is not changed
+	assert.EqualValues(t, "full-refresh", replication.Streams["alpha"].Mode)
+	assert.Equal(t, "updated_at", replication.Streams["alpha"].UpdateKey)
+	assert.EqualValues(t, "incremental", replication.Streams["mid"].Mode)
+	assert.Equal(t, []string{"id"}, replication.Streams["mid"].PrimaryKey())
+}
@@ -0,0 +1,226 @@
+package sling
+
+import (
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+)
+
+// PreflightCheck is a check of the pre-flight phase, shared by the
+// streams which depend on it (e.g. connecting to the target)
+type PreflightCheck struct {
+	Name    string   `json:"name"`
+	Streams []string `json:"streams"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// preflight runs each check once
+type preflight struct {
+	checks []*PreflightCheck
+	byName map[string]*PreflightCheck
+}
+
+func (p *preflight) run(name, stream string, check func() error) (ok bool) {
+	if c, exists := p.byName[name]; exists {
+		c.Streams = append(c.Streams, stream)
+		return c.Error == ""
+	}
+
+	g.Debug("preflight: %s", name)
+	c := &PreflightCheck{Name: name, Streams: []string{stream}}
+	if err := check(); err != nil {
+		c.Error = g.ErrMsgSimple(err)
+	}
+
+	p.byName[name] = c
+	p.checks = append(p.checks, c)
+	return c.Error == ""
+}
+
+// Preflight validates every compiled task before any data moves: source and
+// target connectivity, read access to the source, CREATE/INSERT permission
+// on the target schema (with a temporary table which is dropped), and write
+// access to the target folder and the staging bucket of the target.
+// All the checks are run, and the failures are reported at once.
+func (rd *ReplicationConfig) Preflight() (checks []PreflightCheck, err error) {
+	p := &preflight{byName: map[string]*PreflightCheck{}}
+
+	for _, task := range rd.Tasks {
+		if task.ReplicationStream != nil && task.ReplicationStream.Disabled {
+			continue
+		}
+		task.preflight(p)
+	}
+
+	failed := []string{}
+	for _, c := range p.checks {
+		checks = append(checks, *c)
+		if c.Error != "" {
+			failed = append(failed, g.F("  - %s (streams: %s)\n    %s", c.Name, strings.Join(c.Streams, ", "), c.Error))
+		}
+	}
+
+	if len(failed) > 0 {
+		return checks, g.Error("preflight failed for %d of %d checks:\n%s", len(failed), len(checks), strings.Join(failed, "\n"))
+	}
+
+	g.Info("preflight succeeded (%d checks)", len(checks))
+	return checks, nil
+}
+
+// preflight runs the checks of the task
+func (cfg *Config) preflight(p *preflight) {
+	stream := cfg.StreamName
+	if stream == "" {
+		stream = cfg.Source.Stream
+	}
+
+	// prepare a copy, so that the task is prepared at run time
+	task := &Config{}
+	if !p.run("prepare "+stream, stream, func() error {
+		if err := g.Unmarshal(g.Marshal(cfg), task); err != nil {
+			return g.Error(err, "could not copy config")
+		}
+		return task.Prepare()
+	}) {
+		return
+	}
+
+	// source
+	if task.SrcConn.Type.IsDb() {
+		conn := task.SrcConn
+		if p.run("connect "+conn.Name, stream, func() error { _, err := conn.Test(); return err }) {
+			table, err := database.ParseTableName(task.Source.Stream, conn.Type)
+			if err == nil && table.SQL == "" {
+				p.run("read "+table.FullName(), stream, func() error {
+					dbConn, err := conn.AsDatabase()
+					if err != nil {
+						return err
+					}
+					_, err = dbConn.GetColumns(table.FullName())
+					return err
+				})
+			}
+		}
+	} else if task.SrcConn.Type.IsFile() && !task.Options.StdIn {
+		conn := task.SrcConn
+		p.run("read "+conn.URL(), stream, func() error { _, err := conn.Test(); return err })
+	}
+
+	// target
+	if task.TgtConn.Type.IsDb() {
+		conn := task.TgtConn
+		if !p.run("connect "+conn.Name, stream, func() error { _, err := conn.Test(); return err }) {
+			return
+		}
+
+		dbConn, err := conn.AsDatabase()
+		if err != nil {
+			return
+		}
+
+		table, err := database.ParseTableName(task.Target.Object, conn.Type)
+		if err == nil && !g.In(conn.Type, dbio.TypeDbMongoDB, dbio.TypeDbElasticsearch, dbio.TypeDbPrometheus, dbio.TypeDbInfluxDB, dbio.TypeDbNeo4j, dbio.TypeDbBigTable, dbio.TypeDbStripe, dbio.TypeDbShopify, dbio.TypeDbHubSpot, dbio.TypeDbPlugin) {
+			schema := table.Schema
+			if schema == "" {
+				schema = conn.DataS()["schema"]
+			}
+			p.run(g.F("create & insert in %s.%s", conn.Name, schema), stream, func() error {
+				return preflightTargetSchema(dbConn, schema)
+			})
+		}
+
+		if stagingType, stagingURL := preflightStaging(dbConn); stagingURL != "" {
+			p.run("write "+stagingURL, stream, func() error {
+				fs, err := filesys.NewFileSysClient(stagingType, dbConn.Base().PropArrExclude("url")...)
+				if err != nil {
+					return g.Error(err, "could not init staging connection")
+				}
+				return preflightWrite(fs, stagingURL)
+			})
+		}
+	} else if task.TgtConn.Type.IsFile() && !task.Options.StdOut {
+		conn := task.TgtConn
+		folder := preflightFolder(conn.URL())
+		p.run("write "+folder, stream, func() error {
+			fs, err := conn.AsFile()
+			if err != nil {
+				return g.Error(err, "could not init %s", conn.Name)
+			}
+			return preflightWrite(fs, folder)
+		})
+	}
+}
+
+// preflightTargetSchema creates a table in the schema, inserts a row and
+// drops it
+func preflightTargetSchema(conn database.Connection, schema string) (err error) {
+	table := database.Table{
+		Schema:  schema,
+		Name:    "_sling_preflight_" + g.RandString(g.AlphaRunesLower, 6),
+		Dialect: conn.GetType(),
+	}
+	data := iop.NewDataset(iop.Columns{{Name: "id", Type: iop.IntegerType, Position: 1}})
+
+	if _, err = createTableIfNotExists(conn, data, &table, false); err != nil {
+		return g.Error(err, "cannot create table in schema %s", schema)
+	}
+	defer conn.DropTable(table.FullName())
+
+	sql := g.F("insert into %s (%s) values (1)", table.FullName(), conn.Quote("id"))
+	if _, err = conn.Exec(sql); err != nil {
+		return g.Error(err, "cannot insert into table in schema %s", schema)
+	}
+
+	return nil
+}
+
+// preflightStaging returns the file system type and folder of the staging
+// bucket used by the database connection for bulk loading, if any
+func preflightStaging(conn database.Connection) (fsType dbio.Type, url string) {
+	switch {
+	case conn.GetProp("AWS_BUCKET") != "":
+		fsType = dbio.TypeFileS3
+		url = g.F("s3://%s/", conn.GetProp("AWS_BUCKET"))
+	case conn.GetProp("GC_BUCKET") != "":
+		fsType = dbio.TypeFileGoogle
+		url = g.F("gs://%s/", conn.GetProp("GC_BUCKET"))
+	case conn.GetProp("AZURE_ACCOUNT") != "" && conn.GetProp("AZURE_CONTAINER") != "":
+		fsType = dbio.TypeFileAzure
+		url = g.F("https://%s.blob.core.windows.net/%s/", conn.GetProp("AZURE_ACCOUNT"), conn.GetProp("AZURE_CONTAINER"))
+	default:
+		return fsType, ""
+	}
+
+	return fsType, url + database.TempCloudFolder(conn.GetProp("temp_cloud_folder")) + "/"
+}
+
+// preflightFolder returns the folder of the target url, before any
+// runtime variable or file name
+func preflightFolder(url string) string {
+	if i := strings.Index(url, "{"); i > -1 {
+		url = url[:i]
+	}
+	if i := strings.LastIndex(url, "/"); i > -1 {
+		url = url[:i+1]
+	}
+	return url
+}
+
+// preflightWrite writes a file in the folder, and deletes it
+func preflightWrite(fs filesys.FileSysClient, folder string) (err error) {
+	uri := folder + "_sling_preflight_" + g.RandString(g.AlphaRunesLower, 6)
+
+	if _, err = fs.Write(uri, strings.NewReader("sling preflight")); err != nil {
+		return g.Error(err, "cannot write to %s", folder)
+	}
+
+	if err = filesys.Delete(fs, uri); err != nil {
+		return g.Error(err, "cannot delete from %s", folder)
+	}
+	return nil
+}
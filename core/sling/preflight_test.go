@@ -0,0 +1,62 @@
+package sling
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flarco/g"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreflight(t *testing.T) {
+	folder := t.TempDir()
+	os.WriteFile(filepath.Join(folder, "t1.csv"), []byte("a,b\n1,x\n"), 0644)
+	os.WriteFile(filepath.Join(folder, "t2.csv"), []byte("a,b\n2,y\n"), 0644)
+
+	replicationYaml := g.R(`
+source: LOCAL
+target: LOCAL
+defaults:
+  mode: full-refresh
+  object: file://{folder}/out/{stream_file_name}.csv
+streams:
+  file://{folder}/t1.csv:
+  file://{folder}/t2.csv:
+  file://{folder}/missing.csv:
+  file://{folder}/t1.csv?bad:
+    object: file:///dev/null/out/t1.csv
+`, "folder", folder)
+
+	replication, err := LoadReplicationConfig(replicationYaml)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, replication.Compile(nil)) {
+		return
+	}
+
+	checks, err := replication.Preflight()
+	assert.ErrorContains(t, err, "preflight failed for 2 of")
+
+	failed := map[string]PreflightCheck{}
+	for _, check := range checks {
+		if check.Error != "" {
+			failed[check.Name] = check
+		}
+	}
+	assert.Contains(t, failed, "read file://"+folder+"/missing.csv")
+	assert.Contains(t, failed, "write file:///dev/null/out/")
+
+	// the target folder is checked once for the streams
+	for _, check := range checks {
+		if check.Name == "write file://"+folder+"/out/" {
+			assert.Len(t, check.Streams, 3)
+			assert.Empty(t, check.Error)
+		}
+	}
+
+	// preflight files are removed
+	entries, _ := os.ReadDir(filepath.Join(folder, "out"))
+	assert.Len(t, entries, 0)
+}
@@ -0,0 +1,263 @@
+package sling
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+)
+
+// PushdownMode is whether a database to database task, with the same
+// source and target connection, runs on the server without moving
+// the rows through sling
+type PushdownMode string
+
+const (
+	// PushdownAuto pushes down when the task has no row-level processing
+	PushdownAuto PushdownMode = "auto"
+	// PushdownAlways pushes down, failing if not possible
+	PushdownAlways PushdownMode = "always"
+	// PushdownNever always streams the rows through sling
+	PushdownNever PushdownMode = "never"
+)
+
+// Validate checks the pushdown mode value
+func (pm PushdownMode) Validate() error {
+	switch PushdownMode(strings.ToLower(string(pm))) {
+	case "", PushdownAuto, PushdownAlways, PushdownNever:
+		return nil
+	}
+	return g.Error("invalid pushdown value (%s). Expected auto, always or never", pm)
+}
+
+// pushdownMode returns the pushdown mode, never by default (opt-in)
+func (o *TargetOptions) pushdownMode() PushdownMode {
+	if o == nil || o.Pushdown == nil || *o.Pushdown == "" {
+		return PushdownNever
+	}
+	return PushdownMode(strings.ToLower(string(*o.Pushdown)))
+}
+
+// sameDatabase returns true if the source and target are the same database connection
+func (cfg *Config) sameDatabase() bool {
+	src, tgt := cfg.SrcConn, cfg.TgtConn
+	if !src.Type.IsDb() || src.Type != tgt.Type {
+		return false
+	} else if src.Name != "" && strings.EqualFold(src.Name, tgt.Name) {
+		return true
+	}
+	return src.URL() != "" && src.URL() == tgt.URL()
+}
+
+// pushdownBlocker returns why the task cannot be pushed down, empty if it can
+func (t *TaskExecution) pushdownBlocker() string {
+	cfg := t.Config
+	switch {
+	case !cfg.sameDatabase():
+		return "source and target are not the same database connection"
+	case cfg.SrcConn.Type.IsNoSQL() || g.In(cfg.SrcConn.Type, dbio.TypeDbMongoDB, dbio.TypeDbElasticsearch, dbio.TypeDbPrometheus):
+		return g.F("not supported for %s", cfg.SrcConn.Type)
+	}
+	return t.rowProcessingBlocker()
+}
+
+// rowProcessingBlocker returns the processing of the rows by sling, which
+// prevents loading the target on the server, empty if none
+func (t *TaskExecution) rowProcessingBlocker() string {
+	cfg := t.Config
+	so := g.PtrVal(cfg.Source.Options)
+
+	switch {
+	case cfg.Transforms != nil || len(cfg.extraTransforms) > 0:
+		return "transforms are applied to the rows"
+	case len(cfg.ColumnsPrepared()) > 0:
+		return "column types or constraints are specified"
+	case len(cfg.Target.Options.AuditColumns) > 0:
+		return "audit columns are added to the rows"
+	case g.PtrVal(cfg.MetadataLoadedAt) || cfg.MetadataStreamURL || cfg.MetadataRowNum || cfg.MetadataRowID || cfg.MetadataExecID || cfg.MetadataStreamRunID:
+		return "metadata columns are added to the rows"
+	case g.PtrVal(so.Deduplicate) || so.Filter != nil:
+		return "rows are deduplicated or filtered by sling"
+	case so.PythonTransform != nil:
+		return "rows are transformed by a python script"
+	case so.WasmTransform != nil:
+		return "rows are transformed by a wasm module"
+	case so.FieldMaxSize != nil || so.RowMaxSize != nil || so.BinaryMaxSize != nil || so.RejectFile != nil:
+		return "rows are checked against size limits"
+	case t.hasStateWithUpdateKey():
+		return "the incremental value is tracked in the state"
+	case cast.ToUint64(os.Getenv("SLING_CHECKSUM_ROWS")) > 0:
+		return "checksums are compared"
+	}
+	return ""
+}
+
+// usePushdown returns true if the task is run on the server, per the pushdown option
+func (t *TaskExecution) usePushdown() (ok bool, err error) {
+	mode := t.Config.Target.Options.pushdownMode()
+	if mode == PushdownNever {
+		return false, nil
+	}
+
+	if reason := t.pushdownBlocker(); reason != "" {
+		if mode == PushdownAlways {
+			return false, g.Error("cannot use pushdown: %s", reason)
+		}
+		g.Debug("not using pushdown: %s", reason)
+		return false, nil
+	}
+	return true, nil
+}
+
+// serverLoadFunc loads the rows of the source select into the temp table
+// on the server, with the source and temp table columns
+type serverLoadFunc func(selectSQL string, srcColumns iop.Columns, tableTmp database.Table, tmpColumns iop.Columns) error
+
+// runPushdown inserts the selected source rows into the temp table with an
+// `insert into ... select` statement, and commits it into the target table
+// as with the streamed rows. No row goes through sling.
+func (t *TaskExecution) runPushdown(srcConn, tgtConn database.Connection) (cnt uint64, err error) {
+	return t.runServerLoad(srcConn, tgtConn, "pushdown", func(selectSQL string, srcColumns iop.Columns, tableTmp database.Table, tmpColumns iop.Columns) error {
+		srcFields := make([]string, len(srcColumns))
+		tgtFields := make([]string, len(tmpColumns))
+		for i := range srcColumns {
+			srcFields[i] = srcConn.Quote(srcColumns[i].Name)
+			tgtFields[i] = tgtConn.Quote(tmpColumns[i].Name)
+		}
+
+		sql := g.R(
+			tgtConn.Template().Core["insert_from_table"],
+			"tgt_table", tableTmp.FullName(),
+			"src_table", "("+strings.TrimSuffix(strings.TrimSpace(selectSQL), ";")+") sling_pushdown",
+			"tgt_fields", strings.Join(tgtFields, ", "),
+			"src_fields", strings.Join(srcFields, ", "),
+		)
+
+		if err := tgtConn.BeginContext(t.Context.Ctx); err != nil {
+			return g.Error(err, "could not open transaction to write to temp table")
+		}
+
+		if _, err := tgtConn.Exec(sql); err != nil {
+			tgtConn.Rollback()
+			return g.Error(err, "could not insert into "+tableTmp.FullName())
+		}
+
+		if err := tgtConn.Commit(); err != nil {
+			return g.Error(err, "could not commit transaction")
+		}
+		return nil
+	})
+}
+
+// runServerLoad creates the temp table, loads it with the load function
+// (on the servers), and commits it into the target table, as with the
+// streamed rows
+func (t *TaskExecution) runServerLoad(srcConn, tgtConn database.Connection, method string, load serverLoadFunc) (cnt uint64, err error) {
+	cfg := t.Config
+
+	sTable, err := t.sourceSelectTable(cfg, srcConn)
+	if err != nil {
+		return 0, g.Error(err, "could not get source select")
+	}
+
+	selectSQL := sTable.Select() // resolves the placeholders
+
+	// the columns of the select statement, named per the target casing
+	srcColumns, err := srcConn.GetSQLColumns(database.Table{SQL: selectSQL, Dialect: srcConn.GetType()})
+	if err != nil {
+		return 0, g.Error(err, "could not get columns of source select")
+	} else if len(srcColumns) == 0 {
+		return 0, g.Error("no source columns detected")
+	}
+
+	df := iop.NewDataflowContext(t.Context.Ctx)
+	df.Columns = srcColumns.Clone()
+	applyColumnCasingToDf(df, tgtConn.GetType(), cfg.Target.Options.ColumnCasing)
+	applyColumnSanitizerToDf(df, tgtConn.GetType(), cfg.Target.Options.ColumnSanitizer)
+	t.df = df
+
+	targetTable, err := initializeTargetTable(cfg, tgtConn)
+	if err != nil {
+		return 0, err
+	}
+
+	tableTmp, err := initializeTempTable(cfg, tgtConn, targetTable)
+	if err != nil {
+		return 0, err
+	}
+
+	setStage("4 - prepare-temp")
+
+	if err := ensureSchemaExists(tgtConn, tableTmp.Schema); err != nil {
+		return 0, err
+	}
+
+	if err := dropTableIfExists(tgtConn, tableTmp.FullName()); err != nil {
+		return 0, err
+	}
+
+	sample := iop.NewDataset(df.Columns)
+	sample.Inferred = true
+	tableTmp.Columns = sample.Columns
+	if err := tableTmp.SetKeys(cfg.Source.PrimaryKey(), cfg.Source.UpdateKey, cfg.Target.Options.TableKeys); err != nil {
+		return 0, g.Error(err, "could not set keys for "+tableTmp.FullName())
+	}
+
+	swap := cfg.Target.Options.commitStrategy() == CommitStrategyAtomicSwap
+	if err := createTable(t, tgtConn, tableTmp, sample, !swap); err != nil {
+		return 0, g.Error(err, "could not create table "+tableTmp.FullName())
+	}
+	cfg.Target.Options.TableDDL = g.String(tableTmp.DDL)
+	cfg.Target.TmpTableCreated = true
+
+	tempTable := TempTable{Conn: cfg.TgtConn.Name, Name: tableTmp.FullName(), CreatedAt: time.Now()}
+	if err := TempTableSet(tempTable); err != nil {
+		g.Debug("could not record temp table %s: %s", tempTable.Name, err.Error())
+	}
+
+	t.AddCleanupTaskFirst(func() {
+		if cast.ToBool(os.Getenv("SLING_KEEP_TEMP")) {
+			return
+		}
+
+		conn := tgtConn
+		if tgtConn.Context().Err() != nil {
+			conn, err = t.getTgtDBConn(context.Background())
+			if err == nil {
+				conn.Connect()
+			}
+		}
+		if err := conn.DropTable(tableTmp.FullName()); err != nil {
+			g.LogError(err)
+		} else if err = TempTableDelete(tempTable.Conn, tempTable.Name); err != nil {
+			g.Debug("could not delete record of temp table %s: %s", tempTable.Name, err.Error())
+		}
+		conn.Close()
+	})
+
+	setStage("4 - load-into-temp")
+	t.SetProgress("loading temp table on the server (%s)", method)
+
+	if err = load(selectSQL, srcColumns, tableTmp, df.Columns); err != nil {
+		return 0, err
+	}
+
+	if cnt, err = tgtConn.GetCount(tableTmp.FullName()); err != nil {
+		return 0, g.Error(err, "could not get count for temp table "+tableTmp.FullName())
+	}
+
+	// report the count, as with the streamed rows
+	ds := iop.NewDatastreamContext(t.Context.Ctx, df.Columns)
+	ds.Count = cnt
+	ds.Ready = true
+	df.Streams = append(df.Streams, ds)
+	df.Ready = true
+
+	return t.commitTempTable(cfg, tgtConn, tableTmp, targetTable, df, cnt)
+}
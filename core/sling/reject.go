@@ -0,0 +1,130 @@
+package sling
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/env"
+)
+
+// prepareRejectSink determines the local file of the rejected rows. With a
+// reject_table, rows are written to a temporary file, loaded after the run.
+// A reject_file is appended to.
+func (t *TaskExecution) prepareRejectSink() {
+	so := g.PtrVal(t.Config.Source.Options)
+
+	switch {
+	case g.PtrVal(so.RejectTable) != "":
+		name := g.RandSuffix("sling_rejects_", 6) + ".jsonl"
+		t.rejectFile = path.Join(env.GetTempFolder(), name)
+	case g.PtrVal(so.RejectFile) != "":
+		t.rejectFile = g.PtrVal(so.RejectFile)
+	}
+}
+
+// GetRejectCount returns the number of rows rejected or skipped
+func (t *TaskExecution) GetRejectCount() uint64 {
+	if t.df == nil {
+		return 0
+	}
+	return t.df.RejectCount()
+}
+
+// loadRejects inserts the rejected rows into the reject_table of the
+// target database, with the run id and time
+func (t *TaskExecution) loadRejects() (err error) {
+	tableName := g.PtrVal(g.PtrVal(t.Config.Source.Options).RejectTable)
+	if tableName == "" || t.rejectFile == "" {
+		return nil
+	} else if _, err = os.Stat(t.rejectFile); os.IsNotExist(err) {
+		return nil // nothing rejected, or only skipped
+	}
+
+	recs, err := iop.ReadRejectFile(t.rejectFile)
+	if err != nil {
+		return g.Error(err, "could not read rejected rows")
+	} else if len(recs) == 0 {
+		return nil
+	}
+
+	stream := t.Config.StreamName
+	if stream == "" {
+		stream = t.Config.Source.Stream
+	}
+
+	data := iop.NewDataset(iop.NewColumns(iop.Columns{
+		{Name: "run_id", Type: iop.StringType},
+		{Name: "stream", Type: iop.StringType},
+		{Name: "location", Type: iop.StringType},
+		{Name: "line", Type: iop.BigIntType},
+		{Name: "row_num", Type: iop.BigIntType},
+		{Name: "reason", Type: iop.TextType},
+		{Name: "record", Type: iop.JsonType},
+		{Name: "rejected_at", Type: iop.TimestampType},
+	}...))
+
+	now := time.Now()
+	for _, rec := range recs {
+		record := g.Marshal(rec.Record)
+		if rec.Record == nil {
+			record = g.Marshal(rec.Raw)
+		}
+		data.Append([]any{t.ExecID, stream, rec.Stream, rec.Line, rec.RowNum, rec.Reason, record, now})
+	}
+
+	conn, err := t.getTgtDBConn(t.Context.Ctx)
+	if err != nil {
+		return g.Error(err, "could not connect to load rejected rows")
+	} else if !t.isUsingPool() {
+		defer conn.Close()
+	}
+
+	table, err := database.ParseTableName(tableName, conn.GetType())
+	if err != nil {
+		return g.Error(err, "invalid reject_table: %s", tableName)
+	}
+
+	if _, err = createTableIfNotExists(conn, data, &table, false); err != nil {
+		return g.Error(err, "could not create reject table %s", table.FullName())
+	}
+
+	if _, err = conn.InsertBatchStream(table.FullName(), data.Stream()); err != nil {
+		return g.Error(err, "could not insert rejected rows into %s", table.FullName())
+	}
+
+	g.Debug("inserted %d rejected rows into %s", len(recs), table.FullName())
+	return nil
+}
+
+// reportRejects warns of the rejected rows, and loads them into the
+// reject_table if specified
+func (t *TaskExecution) reportRejects() (err error) {
+	so := g.PtrVal(t.Config.Source.Options)
+	if g.PtrVal(so.RejectTable) != "" && t.rejectFile != "" {
+		defer os.Remove(t.rejectFile) // temporary file
+	}
+
+	cnt := t.GetRejectCount()
+	if cnt == 0 {
+		return nil
+	}
+
+	switch {
+	case g.PtrVal(so.RejectTable) != "":
+		if err = t.loadRejects(); err != nil {
+			return err
+		}
+		g.Warn("%d rows rejected, inserted into %s", cnt, *so.RejectTable)
+	case t.rejectFile != "":
+		g.Warn("%d rows rejected, written to %s", cnt, t.rejectFile)
+	default:
+		g.Warn("%d rows skipped (on_error: skip)", cnt)
+	}
+
+	t.Status = ExecStatusWarning // set as warning status
+	return nil
+}
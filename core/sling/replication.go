@@ -15,6 +15,7 @@ import (
 	"github.com/slingdata-io/sling-cli/core/dbio/database"
 	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
 	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/env"
 	"github.com/spf13/cast"
 	"gopkg.in/yaml.v2"
 )
@@ -24,9 +25,31 @@ type ReplicationConfig struct {
 	Target   string                              `json:"target,omitempty" yaml:"target,omitempty"`
 	Hooks    HookMap                             `json:"hooks,omitempty" yaml:"hooks,omitempty"`
 	Defaults ReplicationStreamConfig             `json:"defaults,omitempty" yaml:"defaults,omitempty"`
+	Groups   map[string]ReplicationStreamConfig  `json:"groups,omitempty" yaml:"groups,omitempty"` // defaults per stream group
 	Streams  map[string]*ReplicationStreamConfig `json:"streams,omitempty" yaml:"streams,omitempty"`
 	Env      map[string]any                      `json:"env,omitempty" yaml:"env,omitempty"`
 
+	// Secrets are the keys of the env (replication or stream) holding
+	// secret values, masked in the logs and excluded from the JSON payload
+	// and the runtime state
+	Secrets []string `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+
+	// Vars are user-defined variables for the templates of the streams
+	// (object, sql, where...), which can use the runtime functions,
+	// e.g. `day: "{run_date-1d:YYYYMMDD}"`. See RenderTemplate.
+	Vars map[string]any `json:"vars,omitempty" yaml:"vars,omitempty"`
+
+	// Timeout is the time budget of the whole replication run (e.g. 2h)
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// RunOrder is the order of the streams: priority (default), as_listed,
+	// smallest_first or largest_first
+	RunOrder RunOrder `json:"run_order,omitempty" yaml:"run_order,omitempty"`
+
+	// OnFailure is how the run handles the failure of a stream: continue,
+	// fail_fast or fail_after_all (default)
+	OnFailure FailurePolicy `json:"on_failure,omitempty" yaml:"on_failure,omitempty"`
+
 	// Tasks are compiled tasks
 	Tasks    []*Config `json:"tasks"`
 	Compiled bool      `json:"compiled"`
@@ -36,10 +59,15 @@ type ReplicationConfig struct {
 	originalCfg    string
 	maps           replicationConfigMaps // raw maps for validation
 	state          *ReplicationState
+	checkpoints    map[string]*ChunkCheckpoint // chunked stream name => backfill checkpoint
+	deadline       time.Time                   // end of the timeout budget, from compilation
+	runDeadline    time.Time                   // wall clock deadline of the run (SLING_DEADLINE), from compilation
+	backfill       bool                        // planned with `sling backfill`
 }
 
 type replicationConfigMaps struct {
 	Defaults map[string]any
+	Groups   map[string]map[string]any
 	Streams  map[string]map[string]any
 }
 
@@ -56,9 +84,14 @@ func (rd *ReplicationConfig) JSON() string {
 		g.M("hooks", rd.Hooks),
 		g.M("defaults", rd.Defaults),
 		g.M("streams", rd.Streams),
-		g.M("env", rd.Env),
+		g.M("env", rd.publicEnv(rd.Env)),
 	})
 
+	// mask the secret values, such as in the env of the streams
+	for _, value := range rd.secretValues() {
+		payload = strings.ReplaceAll(payload, strings.Trim(g.Marshal(value), `"`), env.SecretMask)
+	}
+
 	// clean up
 	if strings.Contains(rd.Source, "://") {
 		cleanSource := strings.Split(rd.Source, "://")[0] + "://"
@@ -73,12 +106,64 @@ func (rd *ReplicationConfig) JSON() string {
 	return payload
 }
 
+// IsSecret returns true if the env key is declared in `secrets`
+func (rd *ReplicationConfig) IsSecret(key string) bool {
+	for _, secret := range rd.Secrets {
+		if strings.EqualFold(secret, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicEnv returns the env without the secret keys
+func (rd *ReplicationConfig) publicEnv(envMap map[string]any) map[string]any {
+	if len(rd.Secrets) == 0 || envMap == nil {
+		return envMap
+	}
+
+	public := map[string]any{}
+	for k, v := range envMap {
+		if !rd.IsSecret(k) {
+			public[k] = v
+		}
+	}
+	return public
+}
+
+// secretValues returns the values of the secret keys, in the replication
+// env and the env of the streams
+func (rd *ReplicationConfig) secretValues() (values []string) {
+	if len(rd.Secrets) == 0 {
+		return
+	}
+
+	envMaps := []map[string]any{rd.Env, rd.Defaults.Env}
+	for _, group := range rd.Groups {
+		envMaps = append(envMaps, group.Env)
+	}
+	for _, stream := range rd.Streams {
+		if stream != nil {
+			envMaps = append(envMaps, stream.Env)
+		}
+	}
+
+	for _, envMap := range envMaps {
+		for k, v := range envMap {
+			if value := cast.ToString(v); value != "" && rd.IsSecret(k) {
+				values = append(values, value, os.ExpandEnv(value))
+			}
+		}
+	}
+	return lo.Uniq(values)
+}
+
 // StateMap returns map for use
 func (rd *ReplicationConfig) RuntimeState() (_ *ReplicationState, err error) {
 	if rd.state == nil {
 		rd.state = &ReplicationState{
 			State:     map[string]map[string]any{},
-			Env:       rd.Env,
+			Env:       rd.publicEnv(rd.Env),
 			Runs:      map[string]*RunState{},
 			Execution: ExecutionState{},
 			Source:    ConnState{Name: rd.Source},
@@ -119,14 +204,15 @@ func (rd *ReplicationConfig) RuntimeState() (_ *ReplicationState, err error) {
 			rd.state.Target.Schema = cast.ToString(task.TgtConn.Data["schema"])
 
 			runID := iop.CleanName(rd.Normalize(task.StreamName))
-			if id := cast.ToString(fMap["stream_run_id"]); id != "" {
-				runID = id
+			if task.ReplicationStream != nil && task.ReplicationStream.ID != "" {
+				runID = task.ReplicationStream.ID
 			}
 
 			if _, ok := rd.state.Runs[runID]; !ok {
 				rd.state.Runs[runID] = &RunState{
-					ID:     runID,
-					Status: ExecStatusCreated,
+					ID:          runID,
+					StreamRunID: cast.ToString(fMap["stream_run_id"]),
+					Status:      ExecStatusCreated,
 					Stream: &StreamState{
 						FileFolder: cast.ToString(fMap["stream_file_folder"]),
 						FileName:   cast.ToString(fMap["stream_file_name"]),
@@ -199,6 +285,22 @@ func (rd ReplicationConfig) MatchStreams(pattern string) (streams map[string]*Re
 	return
 }
 
+// hasGroup returns true if the group is defined in `groups`, or set on
+// a stream
+func (rd ReplicationConfig) hasGroup(group string) bool {
+	if _, ok := rd.Groups[group]; ok {
+		return true
+	} else if rd.Defaults.Group == group {
+		return true
+	}
+	for _, stream := range rd.Streams {
+		if stream != nil && stream.Group == group {
+			return true
+		}
+	}
+	return false
+}
+
 // Normalize normalized the name
 func (rd ReplicationConfig) Normalize(n string) string {
 	n = strings.ReplaceAll(n, "`", "")
@@ -436,6 +538,9 @@ func (rd *ReplicationConfig) ProcessChunks() (err error) {
 		chunks []Stream
 	}
 	streamsToChunk := []Stream{}
+	if rd.checkpoints == nil {
+		rd.checkpoints = map[string]*ChunkCheckpoint{}
+	}
 	for _, name := range rd.streamsOrdered {
 		stream := rd.Streams[name]
 
@@ -482,7 +587,10 @@ func (rd *ReplicationConfig) ProcessChunks() (err error) {
 	sourceConnDB, err := sourceConn.Connection.AsDatabase()
 	if err != nil {
 		return g.Error(err)
+	} else if err = sourceConnDB.Connect(); err != nil {
+		return g.Error(err, "could not connect to source for chunking: %s", rd.Source)
 	}
+	defer sourceConnDB.Close()
 
 	for i, stream := range streamsToChunk {
 		chunkSize := cast.ToString(stream.config.SourceOptions.ChunkSize)
@@ -500,6 +608,8 @@ func (rd *ReplicationConfig) ProcessChunks() (err error) {
 
 		if stream.config.UpdateKey == "" {
 			return g.Error(err, "did not provided update_key for stream chunking: %s", stream.name)
+		} else if !isSimpleUpdateKey(stream.config.UpdateKey) {
+			return g.Error("stream chunking requires a single update_key column: %s", stream.name)
 		}
 
 		chunkRanges, err := database.ChunkByColumnRange(sourceConnDB, table, stream.config.UpdateKey, chunkSize, min, max)
@@ -511,8 +621,29 @@ func (rd *ReplicationConfig) ProcessChunks() (err error) {
 			continue
 		}
 
-		streamsToChunk[i].chunks = make([]Stream, len(chunkRanges))
+		// skip chunks completed in a previous interrupted run. The checkpoints
+		// of `sling backfill` are apart from those of the replication runs.
+		keyValues := []string{rd.Source, rd.Target, stream.config.Object, stream.config.UpdateKey}
+		if rd.backfill {
+			keyValues = append([]string{"backfill:"}, keyValues...)
+		}
+		checkpoint, err := LoadChunkCheckpoint(
+			stream.name, g.PtrVal(stream.config.SourceOptions.Range), chunkSize, keyValues...,
+		)
+		if err != nil {
+			return g.Error(err, "could not load checkpoint for stream: %s", stream.name)
+		}
+		pending := g.ArrMapString(checkpoint.Pending(chunkRanges))
+		if skipped := len(chunkRanges) - len(pending); skipped > 0 {
+			g.Info("resuming backfill of %s, skipping %d completed chunks", stream.name, skipped)
+		}
+
+		streamsToChunk[i].chunks = []Stream{}
 		for j, chunkRange := range chunkRanges {
+			if _, ok := pending[chunkRange]; !ok {
+				continue
+			}
+
 			chunkedStream := Stream{
 				name:   table.FullName() + g.F(" (part-%03d)", j+1),
 				config: stream.config,
@@ -527,8 +658,11 @@ func (rd *ReplicationConfig) ProcessChunks() (err error) {
 			// set temp table
 			to := TargetOptions{}
 			g.Unmarshal(g.Marshal(stream.config.TargetOptions), &to)
-			suffix := g.F("_%03d", j+1)
-			tempTable := makeTempTableName(targetConn.Connection.Type, object, suffix)
+			prefix, suffix := to.tempTableAffixes()
+			if to.TempTableSuffix == nil {
+				suffix = "" // default chunk temp tables are object_001, object_002...
+			}
+			tempTable := makeTempTableName(targetConn.Connection.Type, object, prefix, g.F("%s_%03d", suffix, j+1))
 			tempTable.Name = strings.ToLower(tempTable.Name)
 			to.TableTmp = tempTable.FullName()
 
@@ -537,7 +671,8 @@ func (rd *ReplicationConfig) ProcessChunks() (err error) {
 			// pass as table name to enumerate stream name
 			chunkedStream.config.SQL = table.FullName()
 
-			streamsToChunk[i].chunks[j] = chunkedStream
+			streamsToChunk[i].chunks = append(streamsToChunk[i].chunks, chunkedStream)
+			rd.checkpoints[chunkedStream.name] = checkpoint
 		}
 	}
 
@@ -568,6 +703,14 @@ func (rd *ReplicationConfig) ProcessChunks() (err error) {
 	return nil
 }
 
+// CheckpointChunk records the chunked stream as completed in its backfill checkpoint
+func (rd *ReplicationConfig) CheckpointChunk(streamName, chunkRange string) error {
+	if checkpoint, ok := rd.checkpoints[streamName]; ok {
+		return checkpoint.MarkCompleted(chunkRange)
+	}
+	return nil
+}
+
 func (rd *ReplicationConfig) AddStream(key string, cfg *ReplicationStreamConfig) {
 	newCfg := ReplicationStreamConfig{}
 	g.Unmarshal(g.Marshal(cfg), &newCfg) // copy config over
@@ -678,6 +821,9 @@ func (rd *ReplicationConfig) ProcessWildcardsFile(c connection.Connection, patte
 
 // Compile compiles the replication into tasks
 func (rd *ReplicationConfig) Compile(cfgOverwrite *Config, selectStreams ...string) (err error) {
+	// mask the secret env values in the logs
+	env.AddSecret(rd.secretValues()...)
+
 	if rd.Compiled {
 		// apply the selection if specified
 		if len(selectStreams) > 0 {
@@ -707,6 +853,8 @@ func (rd *ReplicationConfig) Compile(cfgOverwrite *Config, selectStreams ...stri
 	matchedStreams := map[string]*ReplicationStreamConfig{}
 	includeTags := []string{}
 	excludeTags := []string{}
+	includeGroups := []string{}
+	excludeGroups := []string{}
 	for _, selectStream := range selectStreams {
 		for key, val := range rd.MatchStreams(selectStream) {
 			key = rd.Normalize(key)
@@ -718,10 +866,30 @@ func (rd *ReplicationConfig) Compile(cfgOverwrite *Config, selectStreams ...stri
 		if strings.HasPrefix(selectStream, "-tag:") {
 			excludeTags = append(excludeTags, strings.TrimPrefix(selectStream, "-tag:"))
 		}
+		if strings.HasPrefix(selectStream, "group:") {
+			includeGroups = append(includeGroups, strings.TrimPrefix(selectStream, "group:"))
+		}
+		if strings.HasPrefix(selectStream, "-group:") {
+			excludeGroups = append(excludeGroups, strings.TrimPrefix(selectStream, "-group:"))
+		}
 	}
 
 	if len(includeTags) > 0 && len(excludeTags) > 0 {
 		return g.Error("cannot include and exclude tags. Either include or exclude.")
+	} else if len(includeGroups) > 0 && len(excludeGroups) > 0 {
+		return g.Error("cannot include and exclude groups. Either include or exclude.")
+	}
+
+	// with only exclusions (e.g. `-group:finance`), the other streams are selected
+	onlyExclusions := len(selectStreams) > 0
+	for _, selectStream := range selectStreams {
+		onlyExclusions = onlyExclusions && strings.HasPrefix(selectStream, "-")
+	}
+
+	for _, group := range append(includeGroups, excludeGroups...) {
+		if !rd.hasGroup(group) {
+			return g.Error("stream group not found: %s", group)
+		}
 	}
 
 	for _, name := range rd.StreamsOrdered() {
@@ -755,14 +923,31 @@ func (rd *ReplicationConfig) Compile(cfgOverwrite *Config, selectStreams ...stri
 			}
 		}
 
+		// match on group, or exclude it (all the other streams)
+		if stream.Group != "" && g.In(stream.Group, includeGroups...) {
+			matchedStreams[rd.Normalize(name)] = &stream
+		}
+		if len(excludeGroups) > 0 {
+			if g.In(stream.Group, excludeGroups...) {
+				delete(matchedStreams, rd.Normalize(name))
+			} else if onlyExclusions {
+				matchedStreams[rd.Normalize(name)] = &stream
+			}
+		}
+
 		_, matched := matchedStreams[rd.Normalize(name)]
 		if len(selectStreams) > 0 && !matched {
 			g.Trace("skipping stream %s since it is not selected", name)
 			continue
 		}
 
-		// config overwrite
+		// stream env, merged over the replication env
 		taskEnv := g.ToMapString(rd.Env)
+		for k, v := range stream.Env {
+			taskEnv[k] = os.ExpandEnv(cast.ToString(v))
+		}
+
+		// config overwrite
 		var incrementalValStr string
 
 		if cfgOverwrite != nil {
@@ -822,6 +1007,12 @@ func (rd *ReplicationConfig) Compile(cfgOverwrite *Config, selectStreams ...stri
 			}
 		}
 
+		if _, err = parseTimeout(stream.Timeout); err != nil {
+			return g.Error(err, "invalid timeout for stream: %s", name)
+		} else if err = stream.Expect.Validate(); err != nil {
+			return g.Error(err, "invalid expect for stream: %s", name)
+		}
+
 		cfg := Config{
 			Source: Source{
 				Conn:        rd.Source,
@@ -840,6 +1031,7 @@ func (rd *ReplicationConfig) Compile(cfgOverwrite *Config, selectStreams ...stri
 			Mode:              stream.Mode,
 			Transforms:        stream.Transforms,
 			Env:               taskEnv,
+			Vars:              rd.Vars,
 			StreamName:        name,
 			IncrementalValStr: incrementalValStr,
 			ReplicationStream: &stream,
@@ -868,8 +1060,26 @@ func (rd *ReplicationConfig) Compile(cfgOverwrite *Config, selectStreams ...stri
 		rd.Tasks = append(rd.Tasks, &cfg)
 	}
 
+	if err = rd.OnFailure.Validate(); err != nil {
+		return err
+	}
+
+	if err = rd.orderTasks(); err != nil {
+		return g.Error(err, "could not order streams")
+	}
+
 	rd.Compiled = true
 
+	// start the timeout budget of the run
+	if timeout, err := parseTimeout(rd.Timeout); err != nil {
+		return g.Error(err, "invalid replication timeout")
+	} else if timeout > 0 {
+		rd.deadline = time.Now().Add(timeout)
+	}
+	if rd.runDeadline, err = runDeadline(time.Now()); err != nil {
+		return err
+	}
+
 	// generate state
 	if _, err = rd.RuntimeState(); err != nil {
 		return g.Error(err, "could not make runtime state")
@@ -885,24 +1095,30 @@ func (rd *ReplicationConfig) Compile(cfgOverwrite *Config, selectStreams ...stri
 }
 
 type ReplicationStreamConfig struct {
-	ID            string         `json:"id,omitempty" yaml:"id,omitempty"`
-	Description   string         `json:"description,omitempty" yaml:"description,omitempty"`
-	Mode          Mode           `json:"mode,omitempty" yaml:"mode,omitempty"`
-	Object        string         `json:"object,omitempty" yaml:"object,omitempty"`
-	Select        []string       `json:"select,omitempty" yaml:"select,flow,omitempty"`
-	Where         string         `json:"where,omitempty" yaml:"where,omitempty"`
-	PrimaryKeyI   any            `json:"primary_key,omitempty" yaml:"primary_key,flow,omitempty"`
-	UpdateKey     string         `json:"update_key,omitempty" yaml:"update_key,omitempty"`
-	SQL           string         `json:"sql,omitempty" yaml:"sql,omitempty"`
-	Tags          []string       `json:"tags,omitempty" yaml:"tags,omitempty"`
-	SourceOptions *SourceOptions `json:"source_options,omitempty" yaml:"source_options,omitempty"`
-	TargetOptions *TargetOptions `json:"target_options,omitempty" yaml:"target_options,omitempty"`
-	Schedule      string         `json:"schedule,omitempty" yaml:"schedule,omitempty"`
-	Disabled      bool           `json:"disabled,omitempty" yaml:"disabled,omitempty"`
-	Single        *bool          `json:"single,omitempty" yaml:"single,omitempty"`
-	Transforms    any            `json:"transforms,omitempty" yaml:"transforms,omitempty"`
-	Columns       any            `json:"columns,omitempty" yaml:"columns,omitempty"`
-	Hooks         HookMap        `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+	ID            string              `json:"id,omitempty" yaml:"id,omitempty"`
+	Description   string              `json:"description,omitempty" yaml:"description,omitempty"`
+	Mode          Mode                `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Object        string              `json:"object,omitempty" yaml:"object,omitempty"`
+	Select        []string            `json:"select,omitempty" yaml:"select,flow,omitempty"`
+	Where         string              `json:"where,omitempty" yaml:"where,omitempty"`
+	PrimaryKeyI   any                 `json:"primary_key,omitempty" yaml:"primary_key,flow,omitempty"`
+	UpdateKey     string              `json:"update_key,omitempty" yaml:"update_key,omitempty"`
+	SQL           string              `json:"sql,omitempty" yaml:"sql,omitempty"`
+	Tags          []string            `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Group         string              `json:"group,omitempty" yaml:"group,omitempty"` // the defaults of `groups`, selected with `group:<name>`
+	SourceOptions *SourceOptions      `json:"source_options,omitempty" yaml:"source_options,omitempty"`
+	TargetOptions *TargetOptions      `json:"target_options,omitempty" yaml:"target_options,omitempty"`
+	Schedule      string              `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	Disabled      bool                `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	Single        *bool               `json:"single,omitempty" yaml:"single,omitempty"`
+	Transforms    any                 `json:"transforms,omitempty" yaml:"transforms,omitempty"`
+	Columns       any                 `json:"columns,omitempty" yaml:"columns,omitempty"`
+	Hooks         HookMap             `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+	Timeout       string              `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Priority      int                 `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Optional      bool                `json:"optional,omitempty" yaml:"optional,omitempty"`
+	Expect        *StreamExpectations `json:"expect,omitempty" yaml:"expect,omitempty"`
+	Env           map[string]any      `json:"env,omitempty" yaml:"env,omitempty"` // merged over the replication env
 
 	replication *ReplicationConfig `json:"-" yaml:"-"`
 }
@@ -936,25 +1152,64 @@ func SetStreamDefaults(name string, stream *ReplicationStreamConfig, replication
 	}
 
 	// the keys to check if provided in map
-	defaultSet := map[string]func(){
-		"mode":        func() { stream.Mode = replicationCfg.Defaults.Mode },
-		"object":      func() { stream.Object = replicationCfg.Defaults.Object },
-		"select":      func() { stream.Select = replicationCfg.Defaults.Select },
-		"where":       func() { stream.Where = replicationCfg.Defaults.Where },
-		"primary_key": func() { stream.PrimaryKeyI = replicationCfg.Defaults.PrimaryKeyI },
-		"update_key":  func() { stream.UpdateKey = replicationCfg.Defaults.UpdateKey },
-		"sql":         func() { stream.SQL = replicationCfg.Defaults.SQL },
-		"schedule":    func() { stream.Schedule = replicationCfg.Defaults.Schedule },
-		"tags":        func() { stream.Tags = replicationCfg.Defaults.Tags },
-		"disabled":    func() { stream.Disabled = replicationCfg.Defaults.Disabled },
-		"single":      func() { stream.Single = g.Ptr(g.PtrVal(replicationCfg.Defaults.Single)) },
-		"transforms":  func() { stream.Transforms = replicationCfg.Defaults.Transforms },
-		"columns":     func() { stream.Columns = replicationCfg.Defaults.Columns },
-		"hooks":       func() { stream.Hooks = g.PtrVal(g.Ptr(replicationCfg.Defaults.Hooks)) },
-	}
-
-	for key, setFunc := range defaultSet {
-		if _, found := streamMap[key]; !found {
+	defaultSet := func(defaults ReplicationStreamConfig) map[string]func() {
+		return map[string]func(){
+			"mode":        func() { stream.Mode = defaults.Mode },
+			"object":      func() { stream.Object = defaults.Object },
+			"select":      func() { stream.Select = defaults.Select },
+			"where":       func() { stream.Where = defaults.Where },
+			"primary_key": func() { stream.PrimaryKeyI = defaults.PrimaryKeyI },
+			"update_key":  func() { stream.UpdateKey = defaults.UpdateKey },
+			"sql":         func() { stream.SQL = defaults.SQL },
+			"schedule":    func() { stream.Schedule = defaults.Schedule },
+			"tags":        func() { stream.Tags = defaults.Tags },
+			"disabled":    func() { stream.Disabled = defaults.Disabled },
+			"single":      func() { stream.Single = g.Ptr(g.PtrVal(defaults.Single)) },
+			"transforms":  func() { stream.Transforms = defaults.Transforms },
+			"columns":     func() { stream.Columns = defaults.Columns },
+			"hooks":       func() { stream.Hooks = g.PtrVal(g.Ptr(defaults.Hooks)) },
+			"timeout":     func() { stream.Timeout = defaults.Timeout },
+			"priority":    func() { stream.Priority = defaults.Priority },
+			"optional":    func() { stream.Optional = defaults.Optional },
+			"expect":      func() { stream.Expect = defaults.Expect },
+		}
+	}
+
+	provided := map[string]bool{}
+	for key := range streamMap {
+		provided[key] = true
+	}
+
+	if _, found := streamMap["group"]; !found {
+		stream.Group = replicationCfg.Defaults.Group
+	}
+
+	// the defaults of the group first, then the replication defaults
+	group, hasGroup := replicationCfg.Groups[stream.Group]
+	if hasGroup {
+		groupMap := replicationCfg.maps.Groups[stream.Group]
+		for key, setFunc := range defaultSet(group) {
+			if _, found := groupMap[key]; found && !provided[key] {
+				setFunc()
+				provided[key] = true
+			}
+		}
+
+		if stream.SourceOptions == nil {
+			stream.SourceOptions = g.Ptr(g.PtrVal(group.SourceOptions))
+		} else if group.SourceOptions != nil {
+			stream.SourceOptions.SetDefaults(*group.SourceOptions)
+		}
+
+		if stream.TargetOptions == nil {
+			stream.TargetOptions = g.Ptr(g.PtrVal(group.TargetOptions))
+		} else if group.TargetOptions != nil {
+			stream.TargetOptions.SetDefaults(*group.TargetOptions)
+		}
+	}
+
+	for key, setFunc := range defaultSet(replicationCfg.Defaults) {
+		if !provided[key] {
 			setFunc() // if not found, set default
 		}
 	}
@@ -971,6 +1226,17 @@ func SetStreamDefaults(name string, stream *ReplicationStreamConfig, replication
 	} else if replicationCfg.Defaults.TargetOptions != nil {
 		stream.TargetOptions.SetDefaults(*replicationCfg.Defaults.TargetOptions)
 	}
+
+	// env is merged: stream keys over group keys over default keys
+	if len(replicationCfg.Defaults.Env) > 0 || len(group.Env) > 0 {
+		streamEnv := map[string]any{}
+		for _, envMap := range []map[string]any{replicationCfg.Defaults.Env, group.Env, stream.Env} {
+			for k, v := range envMap {
+				streamEnv[k] = v
+			}
+		}
+		stream.Env = streamEnv
+	}
 }
 
 // UnmarshalReplication converts a yaml file to a replication
@@ -1039,12 +1305,18 @@ func UnmarshalReplication(replicYAML string) (config ReplicationConfig, err erro
 
 	maps := replicationConfigMaps{}
 	g.Unmarshal(g.Marshal(defaults), &maps.Defaults)
+	g.Unmarshal(g.Marshal(m["groups"]), &maps.Groups)
 	g.Unmarshal(g.Marshal(streams), &maps.Streams)
 
 	config = ReplicationConfig{
 		Source:      cast.ToString(source),
 		Target:      cast.ToString(target),
 		Env:         Env,
+		Vars:        cast.ToStringMap(m["vars"]),
+		Secrets:     cast.ToStringSlice(m["secrets"]),
+		Timeout:     cast.ToString(m["timeout"]),
+		RunOrder:    RunOrder(cast.ToString(m["run_order"])),
+		OnFailure:   FailurePolicy(cast.ToString(m["on_failure"])),
 		maps:        maps,
 		originalCfg: replicYAML, // set originalCfg
 	}
@@ -1056,6 +1328,15 @@ func UnmarshalReplication(replicYAML string) (config ReplicationConfig, err erro
 		return
 	}
 
+	// parse groups
+	if groups, ok := m["groups"]; ok {
+		err = g.Unmarshal(g.Marshal(groups), &config.Groups)
+		if err != nil {
+			err = g.Error(err, "could not parse 'groups'")
+			return
+		}
+	}
+
 	// parse streams
 	err = g.Unmarshal(g.Marshal(streams), &config.Streams)
 	if err != nil {
@@ -1151,6 +1432,13 @@ func makeColumns(nodes yaml.MapSlice) (columns []any) {
 			if slice, ok := node.Value.(yaml.MapSlice); ok {
 				for _, columnNode := range slice {
 					col := g.M("name", cast.ToString(columnNode.Key), "type", cast.ToString(columnNode.Value))
+					if props, ok := columnNode.Value.(yaml.MapSlice); ok {
+						// e.g. `col: {type: int, default: 0}`
+						col = g.M("name", cast.ToString(columnNode.Key))
+						for _, prop := range props {
+							col[cast.ToString(prop.Key)] = prop.Value
+						}
+					}
 					columns = append(columns, col)
 				}
 			}
@@ -1164,7 +1452,7 @@ func makeColumns(nodes yaml.MapSlice) (columns []any) {
 	return columns
 }
 
-func LoadReplicationConfigFromFile(cfgPath string) (config ReplicationConfig, err error) {
+func LoadReplicationConfigFromFile(cfgPath string, overrides ...string) (config ReplicationConfig, err error) {
 	cfgFile, err := os.Open(cfgPath)
 	if err != nil {
 		err = g.Error(err, "Unable to open replication path: "+cfgPath)
@@ -1177,7 +1465,13 @@ func LoadReplicationConfigFromFile(cfgPath string) (config ReplicationConfig, er
 		return
 	}
 
-	config, err = LoadReplicationConfig(string(cfgBytes))
+	// apply the overrides of the command line (--set)
+	content, err := ApplyOverrides(string(cfgBytes), overrides)
+	if err != nil {
+		return
+	}
+
+	config, err = LoadReplicationConfig(content)
 	if err != nil {
 		return
 	}
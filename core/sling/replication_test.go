@@ -1,11 +1,17 @@
 package sling
 
 import (
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 
 	"github.com/flarco/g"
+	"github.com/samber/lo"
 	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/env"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -193,3 +199,173 @@ func TestReplicationWildcards(t *testing.T) {
 
 	}
 }
+
+func TestReplicationColumnDefaults(t *testing.T) {
+	yaml := `
+source: POSTGRES
+target: SNOWFLAKE
+streams:
+	public.orders:
+		columns:
+			id: bigint
+			status: { type: string, default: "'new'" }
+	`
+	yaml = strings.ReplaceAll(yaml, "\t", "  ")
+	replication, err := UnmarshalReplication(yaml)
+	assert.NoError(t, err)
+
+	stream := replication.Streams["public.orders"]
+	if assert.NotNil(t, stream) {
+		cfg := &Config{}
+		cfg.Target.Columns = stream.Columns
+		columns := cfg.ColumnsPrepared()
+		if assert.Len(t, columns, 2) {
+			assert.Equal(t, "status", columns[1].Name)
+			assert.Equal(t, iop.StringType, columns[1].Type)
+			assert.Equal(t, "'new'", columns[1].Default)
+		}
+	}
+}
+
+func TestReplicationGroups(t *testing.T) {
+	folder := t.TempDir()
+	for _, name := range []string{"invoices", "payments", "users"} {
+		os.WriteFile(filepath.Join(folder, name+".csv"), []byte("id,name\n1,a\n"), 0644)
+	}
+
+	replicationYaml := g.R(`
+source: LOCAL
+target: LOCAL
+defaults:
+  mode: full-refresh
+  object: file://{folder}/out/{stream_file_name}.csv
+  target_options:
+    format: csv
+groups:
+  finance:
+    mode: truncate
+    object: file://{folder}/finance/{stream_file_name}.csv
+    target_options:
+      format: jsonlines
+streams:
+  file://{folder}/invoices.csv:
+    group: finance
+  file://{folder}/payments.csv:
+    group: finance
+    mode: full-refresh
+  file://{folder}/users.csv:
+`, "folder", folder)
+
+	compile := func(selectStreams ...string) map[string]*Config {
+		replication, err := LoadReplicationConfig(replicationYaml)
+		if !assert.NoError(t, err) || !assert.NoError(t, replication.Compile(nil, selectStreams...)) {
+			return nil
+		}
+		tasks := map[string]*Config{}
+		for _, cfg := range replication.Tasks {
+			tasks[strings.TrimSuffix(filepath.Base(cfg.StreamName), ".csv")] = cfg
+		}
+		return tasks
+	}
+	names := func(tasks map[string]*Config) []string {
+		keys := lo.Keys(tasks)
+		sort.Strings(keys)
+		return keys
+	}
+
+	// the group defaults come before the replication defaults
+	tasks := compile()
+	if assert.Len(t, tasks, 3) {
+		assert.Equal(t, TruncateMode, tasks["invoices"].Mode)
+		assert.Contains(t, tasks["invoices"].Target.Object, "/finance/invoices")
+		assert.EqualValues(t, "jsonlines", tasks["invoices"].Target.Options.Format)
+		assert.Equal(t, FullRefreshMode, tasks["payments"].Mode)
+		assert.Equal(t, FullRefreshMode, tasks["users"].Mode)
+		assert.Contains(t, tasks["users"].Target.Object, "/out/users")
+		assert.EqualValues(t, "csv", tasks["users"].Target.Options.Format)
+	}
+
+	assert.Equal(t, []string{"invoices", "payments"}, names(compile("group:finance")))
+	assert.Equal(t, []string{"users"}, names(compile("-group:finance")))
+
+	replication, err := LoadReplicationConfig(replicationYaml)
+	if assert.NoError(t, err) {
+		assert.Error(t, replication.Compile(nil, "group:unknown"))
+	}
+
+	issues := ValidateReplication(strings.Replace(replicationYaml, "mode: truncate", "mode: wrong", 1))
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, "groups.finance.mode", issues[0].Path)
+	}
+}
+
+func TestReplicationEnv(t *testing.T) {
+	folder := t.TempDir()
+	for _, name := range []string{"orders", "users"} {
+		os.WriteFile(filepath.Join(folder, name+".csv"), []byte("id,name\n1,a\n"), 0644)
+	}
+
+	// restored at the end
+	t.Setenv("REGION", "")
+	t.Setenv("API_TOKEN", "")
+
+	replicationYaml := g.R(`
+source: LOCAL
+target: LOCAL
+env:
+  REGION: eu
+  API_TOKEN: token-replication-1234
+secrets: [API_TOKEN, ORDERS_PASSWORD, ORDERS_PIN]
+defaults:
+  mode: full-refresh
+  object: file://{folder}/out/{stream_file_name}.csv
+streams:
+  file://{folder}/orders.csv:
+    env:
+      REGION: us
+      ORDERS_PASSWORD: password-orders-5678
+      ORDERS_PIN: k9x
+  file://{folder}/users.csv:
+`, "folder", folder)
+
+	replication, err := LoadReplicationConfig(replicationYaml)
+	if !assert.NoError(t, err) || !assert.NoError(t, replication.Compile(nil)) {
+		return
+	}
+
+	tasks := map[string]*Config{}
+	for _, cfg := range replication.Tasks {
+		tasks[strings.TrimSuffix(filepath.Base(cfg.StreamName), ".csv")] = cfg
+	}
+	if assert.Len(t, tasks, 2) {
+		assert.Equal(t, "us", tasks["orders"].Env["REGION"])
+		assert.Equal(t, "password-orders-5678", tasks["orders"].Env["ORDERS_PASSWORD"])
+		assert.Equal(t, "token-replication-1234", tasks["orders"].Env["API_TOKEN"])
+		assert.Equal(t, "eu", tasks["users"].Env["REGION"])
+		assert.NotContains(t, tasks["users"].Env, "ORDERS_PASSWORD")
+	}
+
+	// the stream env is not set in the process env, only rendered
+	tasks["orders"].SetDefault()
+	tasks["users"].SetDefault()
+	assert.Equal(t, "", os.Getenv("ORDERS_PASSWORD"))
+	assert.Equal(t, "eu", os.Getenv("REGION"))
+	m, err := tasks["orders"].GetFormatMap()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "us", m["REGION"])
+	}
+
+	// secrets are masked in the logs, and excluded from the payload and state
+	assert.Equal(t, "token=*** password=***", env.MaskSecrets("token=token-replication-1234 password=password-orders-5678"))
+	assert.Equal(t, "pin=*** pins=[***, k9x1, xk9x]", env.MaskSecrets("pin=k9x pins=[k9x, k9x1, xk9x]"), "short secrets as whole words")
+
+	payload := replication.JSON()
+	assert.NotContains(t, payload, "token-replication-1234")
+	assert.NotContains(t, payload, "password-orders-5678")
+	assert.Contains(t, payload, `"REGION":"us"`)
+
+	state, err := replication.RuntimeState()
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]any{"REGION": "eu"}, state.Env)
+	}
+}
@@ -0,0 +1,357 @@
+package sling
+
+import (
+	"bytes"
+	htmlTemplate "html/template"
+	"path"
+	"sort"
+	"strings"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/flarco/g"
+	"github.com/nqd/flat"
+	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
+	"github.com/spf13/cast"
+)
+
+// StreamConfigGet returns the config snapshot (flattened keys) of the last
+// recorded run of a stream, nil if none. Set by the store, which persists
+// the snapshots in the local sling database.
+var StreamConfigGet = func(streamID string) (config map[string]string, err error) {
+	return nil, g.Error("stream config history is not available")
+}
+
+// StreamConfigSet records the config snapshot of a stream run
+var StreamConfigSet = func(streamID string, config map[string]string) (err error) {
+	return g.Error("stream config history is not available")
+}
+
+// configSnapshot returns the stream config as flattened keys
+// (e.g. `target_options.column_casing`), to compare runs
+func (cfg *Config) configSnapshot() (snapshot map[string]string) {
+	stream := ReplicationStreamConfig{
+		Mode:          cfg.Mode,
+		Object:        cfg.Target.Object,
+		Select:        cfg.Source.Select,
+		Where:         cfg.Source.Where,
+		PrimaryKeyI:   cfg.Source.PrimaryKeyI,
+		UpdateKey:     cfg.Source.UpdateKey,
+		Transforms:    cfg.Transforms,
+		Columns:       cfg.Target.Columns,
+		SourceOptions: cfg.Source.Options,
+		TargetOptions: cfg.Target.Options,
+	}
+	if cfg.ReplicationStream != nil {
+		stream = *cfg.ReplicationStream // as configured, before compilation
+	}
+
+	m, _ := g.UnmarshalMap(g.Marshal(stream))
+	flattened, err := flat.Flatten(m, &flat.Options{Delimiter: ".", Safe: true})
+	if err != nil {
+		flattened = m
+	}
+
+	snapshot = map[string]string{}
+	for key, value := range flattened {
+		switch value.(type) {
+		case nil:
+			continue
+		case string, bool, float64, int, int64:
+			snapshot[key] = cast.ToString(value)
+		default:
+			if val := g.Marshal(value); val != "{}" && val != "[]" {
+				snapshot[key] = val
+			}
+		}
+	}
+	return snapshot
+}
+
+// recordConfigSnapshot records the config snapshot of the stream, and
+// returns the changes since the last recorded run
+func (cfg *Config) recordConfigSnapshot() (changes []string) {
+	streamID := cfg.StreamID()
+	snapshot := cfg.configSnapshot()
+
+	prev, err := StreamConfigGet(streamID)
+	if err != nil {
+		g.Debug("could not get previous config of stream %s: %s", cfg.StreamName, err.Error())
+	} else if prev != nil {
+		changes = configChanges(prev, snapshot)
+	}
+
+	if err = StreamConfigSet(streamID, snapshot); err != nil {
+		g.Debug("could not record config of stream %s: %s", cfg.StreamName, err.Error())
+	}
+	return changes
+}
+
+// configChanges returns the changed keys between two config snapshots,
+// e.g. `mode: full-refresh -> incremental`
+func configChanges(prev, curr map[string]string) (changes []string) {
+	keys := map[string]bool{}
+	for key := range prev {
+		keys[key] = true
+	}
+	for key := range curr {
+		keys[key] = true
+	}
+
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	for _, key := range sortedKeys {
+		prevVal, prevOk := prev[key]
+		currVal, currOk := curr[key]
+		switch {
+		case !prevOk:
+			changes = append(changes, g.F("%s: (none) -> %s", key, currVal))
+		case !currOk:
+			changes = append(changes, g.F("%s: %s -> (none)", key, prevVal))
+		case prevVal != currVal:
+			changes = append(changes, g.F("%s: %s -> %s", key, prevVal, currVal))
+		}
+	}
+	return changes
+}
+
+// ReportFormat is the format of the run report
+type ReportFormat string
+
+const (
+	ReportFormatMarkdown ReportFormat = "markdown"
+	ReportFormatHTML     ReportFormat = "html"
+)
+
+// ReportFormatFromPath returns the report format of the file extension,
+// markdown unless .html
+func ReportFormatFromPath(uri string) ReportFormat {
+	switch strings.ToLower(path.Ext(strings.Split(uri, "?")[0])) {
+	case ".html", ".htm":
+		return ReportFormatHTML
+	}
+	return ReportFormatMarkdown
+}
+
+// reportStream is a stream in the report, with the values formatted
+type reportStream struct {
+	ManifestStream
+	RowsStr       string
+	BytesStr      string
+	DurationStr   string
+	Throughput    float64 // rows per second
+	ThroughputStr string
+	BarPercent    int    // width of the throughput bar, relative to the fastest stream
+	Bar           string // text bar for markdown
+}
+
+// reportData is the data of the report templates
+type reportData struct {
+	*RunManifest
+	Title       string
+	StartStr    string
+	DurationStr string
+	Succeeded   int
+	Failed      int
+	RowsStr     string
+	BytesStr    string
+	Streams     []reportStream
+}
+
+func (m *RunManifest) reportData() (data reportData) {
+	data = reportData{
+		RunManifest: m,
+		Title:       "Sling Run Report",
+		StartStr:    m.StartTime.Format(time.RFC3339),
+		DurationStr: g.DurationString(time.Duration(m.Duration) * time.Second),
+	}
+
+	var rows, bytes uint64
+	maxThroughput := 0.0
+	for _, stream := range m.Streams {
+		rs := reportStream{
+			ManifestStream: stream,
+			RowsStr:        humanize.Comma(cast.ToInt64(stream.Rows)),
+			BytesStr:       humanize.Bytes(stream.Bytes),
+			DurationStr:    g.DurationString(time.Duration(stream.Duration) * time.Second),
+		}
+		if stream.Duration > 0 {
+			rs.Throughput = float64(stream.Rows) / float64(stream.Duration)
+		} else {
+			rs.Throughput = float64(stream.Rows)
+		}
+		rs.ThroughputStr = humanize.Comma(cast.ToInt64(rs.Throughput)) + " r/s"
+		if rs.Throughput > maxThroughput {
+			maxThroughput = rs.Throughput
+		}
+
+		if stream.Status.IsFailure() {
+			data.Failed++
+		} else {
+			data.Succeeded++
+		}
+		rows += stream.Rows
+		bytes += stream.Bytes
+		data.Streams = append(data.Streams, rs)
+	}
+	data.RowsStr = humanize.Comma(cast.ToInt64(rows))
+	data.BytesStr = humanize.Bytes(bytes)
+
+	for i, rs := range data.Streams {
+		if maxThroughput > 0 {
+			data.Streams[i].BarPercent = int(rs.Throughput / maxThroughput * 100)
+		}
+		data.Streams[i].Bar = strings.Repeat("█", data.Streams[i].BarPercent/4)
+	}
+
+	return data
+}
+
+var reportMarkdownTemplate = textTemplate.Must(textTemplate.New("report").Parse(`# {{ .Title }}
+
+- **Status**: {{ .Status }}
+- **Run ID**: {{ .ExecID }}{{ if .Config }}
+- **Config**: {{ .Config }}{{ end }}
+- **Started**: {{ .StartStr }} ({{ .DurationStr }})
+- **Streams**: {{ len .Streams }} ({{ .Succeeded }} succeeded, {{ .Failed }} failed)
+- **Rows**: {{ .RowsStr }} ({{ .BytesStr }})
+
+## Streams
+
+| Stream | Status | Rows | Bytes | Duration | Throughput |
+|--------|--------|-----:|------:|---------:|-----------:|
+{{- range .Streams }}
+| {{ .Stream }} | {{ .Status }} | {{ .RowsStr }} | {{ .BytesStr }} | {{ .DurationStr }} | {{ .ThroughputStr }} |
+{{- end }}
+
+## Throughput
+
+` + "```" + `
+{{- range .Streams }}
+{{ printf "%-40.40s" .Stream }} {{ printf "%-25s" .Bar }} {{ .ThroughputStr }}
+{{- end }}
+` + "```" + `
+{{ range .Streams }}{{ if or .Error .Warnings .ConfigChanges }}
+### {{ .Stream }}
+{{ if .Error }}
+**Error**
+
+` + "```" + `
+{{ .Error }}
+` + "```" + `
+{{ end }}{{ if .Warnings }}
+**Warnings**
+{{ range .Warnings }}
+- {{ . }}{{ end }}
+{{ end }}{{ if .ConfigChanges }}
+**Config changes since last run**
+{{ range .ConfigChanges }}
+- ` + "`{{ . }}`" + `{{ end }}
+{{ end }}{{ end }}{{ end }}`))
+
+var reportHTMLTemplate = htmlTemplate.Must(htmlTemplate.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+  body { font-family: -apple-system, Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+  table { border-collapse: collapse; margin-bottom: 2em; }
+  th, td { border: 1px solid #ddd; padding: 6px 10px; text-align: left; }
+  td.num { text-align: right; }
+  .success { color: #1a7f37; } .error, .interrupted { color: #cf222e; } .warning, .skipped { color: #9a6700; }
+  .bar { background: #4c8eda; height: 14px; }
+  pre { background: #f6f8fa; padding: 10px; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+<ul>
+  <li><b>Status</b>: <span class="{{ .Status }}">{{ .Status }}</span></li>
+  <li><b>Run ID</b>: {{ .ExecID }}</li>{{ if .Config }}
+  <li><b>Config</b>: {{ .Config }}</li>{{ end }}
+  <li><b>Started</b>: {{ .StartStr }} ({{ .DurationStr }})</li>
+  <li><b>Streams</b>: {{ len .Streams }} ({{ .Succeeded }} succeeded, {{ .Failed }} failed)</li>
+  <li><b>Rows</b>: {{ .RowsStr }} ({{ .BytesStr }})</li>
+</ul>
+
+<h2>Streams</h2>
+<table>
+  <tr><th>Stream</th><th>Status</th><th>Rows</th><th>Bytes</th><th>Duration</th><th>Throughput</th><th></th></tr>
+  {{- range .Streams }}
+  <tr>
+    <td>{{ .Stream }}</td>
+    <td class="{{ .Status }}">{{ .Status }}</td>
+    <td class="num">{{ .RowsStr }}</td>
+    <td class="num">{{ .BytesStr }}</td>
+    <td class="num">{{ .DurationStr }}</td>
+    <td class="num">{{ .ThroughputStr }}</td>
+    <td style="width: 200px"><div class="bar" style="width: {{ .BarPercent }}%"></div></td>
+  </tr>
+  {{- end }}
+</table>
+{{ range .Streams }}{{ if or .Error .Warnings .ConfigChanges }}
+<h3>{{ .Stream }}</h3>
+{{- if .Error }}
+<p><b>Error</b></p>
+<pre>{{ .Error }}</pre>
+{{- end }}
+{{- if .Warnings }}
+<p><b>Warnings</b></p>
+<ul>{{ range .Warnings }}<li>{{ . }}</li>{{ end }}</ul>
+{{- end }}
+{{- if .ConfigChanges }}
+<p><b>Config changes since last run</b></p>
+<ul>{{ range .ConfigChanges }}<li><code>{{ . }}</code></li>{{ end }}</ul>
+{{- end }}
+{{ end }}{{ end }}
+</body>
+</html>
+`))
+
+// Report renders the run summary: the status, rows, duration and
+// throughput of each stream, with the errors, warnings and config
+// changes since the last run
+func (m *RunManifest) Report(format ReportFormat) (content string, err error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.finalize()
+	data := m.reportData()
+
+	buf := &bytes.Buffer{}
+	if format == ReportFormatHTML {
+		err = reportHTMLTemplate.Execute(buf, data)
+	} else {
+		err = reportMarkdownTemplate.Execute(buf, data)
+	}
+	if err != nil {
+		return "", g.Error(err, "could not render run report")
+	}
+	return buf.String(), nil
+}
+
+// WriteReport renders the run report, in the format of the file extension
+// (.html, otherwise markdown), and writes it to the local path or object
+// store url (e.g. s3://bucket/reports/run.html)
+func (m *RunManifest) WriteReport(uri string) (err error) {
+	content, err := m.Report(ReportFormatFromPath(uri))
+	if err != nil {
+		return err
+	}
+
+	fs, err := filesys.NewFileSysClientFromURL(uri)
+	if err != nil {
+		return g.Error(err, "could not get file system for report %s", uri)
+	}
+
+	if _, err = fs.Self().Write(uri, strings.NewReader(content)); err != nil {
+		return g.Error(err, "could not write report to %s", uri)
+	}
+	return nil
+}
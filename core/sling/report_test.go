@@ -0,0 +1,76 @@
+package sling
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flarco/g"
+	"github.com/rs/zerolog"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunReport(t *testing.T) {
+	// config changes since the last run
+	snapshots := map[string]map[string]string{}
+	getFunc, setFunc := StreamConfigGet, StreamConfigSet
+	StreamConfigGet = func(streamID string) (map[string]string, error) { return snapshots[streamID], nil }
+	StreamConfigSet = func(streamID string, config map[string]string) error { snapshots[streamID] = config; return nil }
+	defer func() { StreamConfigGet, StreamConfigSet = getFunc, setFunc }()
+
+	cfg := &Config{Mode: FullRefreshMode, StreamName: "public.orders"}
+	cfg.Source.Conn, cfg.Source.Stream = "PG", "public.orders"
+	cfg.Target.Conn, cfg.Target.Object = "SNOW", "raw.orders"
+	cfg.Target.Options = &TargetOptions{ColumnCasing: g.Ptr(iop.ColumnCasing("snake"))}
+	assert.Empty(t, cfg.recordConfigSnapshot()) // first run
+
+	cfg.Mode = IncrementalMode
+	cfg.Source.UpdateKey = "updated_at"
+	cfg.Target.Options.ColumnCasing = nil
+	assert.Equal(t, []string{
+		"mode: full-refresh -> incremental",
+		"target_options.column_casing: snake -> (none)",
+		"update_key: (none) -> updated_at",
+	}, cfg.recordConfigSnapshot())
+	assert.Empty(t, cfg.recordConfigSnapshot()) // unchanged
+
+	// warnings of the task
+	task := NewTask("", cfg)
+	task.AppendOutput(&g.LogLine{Level: zerolog.InfoLevel, Text: "ok"})
+	task.AppendOutput(&g.LogLine{Level: zerolog.WarnLevel, Text: "column '%s' had %d constraint failures", Args: []any{"id", 3}})
+	assert.Equal(t, []string{"column 'id' had 3 constraint failures"}, task.Warnings())
+
+	manifest := NewRunManifest("exec-1", "replication.yaml")
+	manifest.Streams = append(manifest.Streams,
+		ManifestStream{Stream: "public.orders", Status: ExecStatusSuccess, Rows: 5000, Bytes: 1 << 20, Duration: 10, Warnings: task.Warnings(), ConfigChanges: []string{"mode: full-refresh -> incremental"}},
+		ManifestStream{Stream: "public.items", Status: ExecStatusError, Rows: 100, Duration: 1, Error: "relation <items> does not exist"},
+	)
+
+	assert.Equal(t, ReportFormatHTML, ReportFormatFromPath("s3://bucket/reports/run.html"))
+	assert.Equal(t, ReportFormatMarkdown, ReportFormatFromPath("/tmp/run.md"))
+
+	folder := t.TempDir()
+	mdPath := filepath.Join(folder, "reports", "run.md")
+	if assert.NoError(t, manifest.WriteReport(mdPath)) {
+		content, _ := os.ReadFile(mdPath)
+		md := string(content)
+		assert.Contains(t, md, "# Sling Run Report")
+		assert.Contains(t, md, "- **Status**: error")
+		assert.Contains(t, md, "- **Streams**: 2 (1 succeeded, 1 failed)")
+		assert.Contains(t, md, "| public.orders | success | 5,000 | 1.0 MB | 10s | 500 r/s |")
+		assert.Contains(t, md, "█████████████████████████ 500 r/s") // fastest stream
+		assert.Contains(t, md, "- column 'id' had 3 constraint failures")
+		assert.Contains(t, md, "- `mode: full-refresh -> incremental`")
+		assert.Contains(t, md, "relation <items> does not exist")
+	}
+
+	htmlPath := filepath.Join(folder, "run.html")
+	if assert.NoError(t, manifest.WriteReport(htmlPath)) {
+		content, _ := os.ReadFile(htmlPath)
+		html := string(content)
+		assert.Contains(t, html, "<title>Sling Run Report</title>")
+		assert.Contains(t, html, `<div class="bar" style="width: 100%"></div>`)
+		assert.Contains(t, html, "relation &lt;items&gt; does not exist") // escaped
+	}
+}
@@ -0,0 +1,139 @@
+package sling
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/google/uuid"
+	"github.com/segmentio/ksuid"
+)
+
+// RunIDFormat is the format used to generate a run id or a stream run id.
+// Can be `ksuid` (default), `ulid`, `uuid` or a custom template
+// such as `{YYYY}{MM}{DD}_{ulid}` or `{run_id}.{stream_table}`.
+type RunIDFormat string
+
+const (
+	RunIDFormatKSUID RunIDFormat = "ksuid"
+	RunIDFormatULID  RunIDFormat = "ulid"
+	RunIDFormatUUID  RunIDFormat = "uuid"
+)
+
+var runIDTemplateVarRegex = regexp.MustCompile(`\{([\w\.]+)\}`)
+
+// RunIDFormatFromEnv returns the run id format from `SLING_RUN_ID_FORMAT`
+func RunIDFormatFromEnv() RunIDFormat {
+	return RunIDFormat(strings.TrimSpace(os.Getenv("SLING_RUN_ID_FORMAT")))
+}
+
+// StreamRunIDFormatFromEnv returns the stream run id format
+// from `SLING_STREAM_RUN_ID_FORMAT`, falling back to `SLING_RUN_ID_FORMAT`
+func StreamRunIDFormatFromEnv() RunIDFormat {
+	if val := strings.TrimSpace(os.Getenv("SLING_STREAM_RUN_ID_FORMAT")); val != "" {
+		return RunIDFormat(val)
+	}
+	return RunIDFormatFromEnv()
+}
+
+// IsTemplate returns true if the format is a custom template
+func (f RunIDFormat) IsTemplate() bool {
+	return strings.Contains(string(f), "{")
+}
+
+// Validate checks that the format is known
+func (f RunIDFormat) Validate() error {
+	switch RunIDFormat(strings.ToLower(string(f))) {
+	case "", RunIDFormatKSUID, RunIDFormatULID, RunIDFormatUUID:
+		return nil
+	}
+	if f.IsTemplate() {
+		return nil
+	}
+	return g.Error("invalid run id format (%s). Expected ksuid, ulid, uuid or a template such as `{YYYY}{MM}{DD}_{ulid}`", f)
+}
+
+// Generate creates a new id. For templates, the provided vars are available,
+// as well as `ksuid`, `ulid`, `uuid`, `run_timestamp` and date parts
+// (`YYYY`, `YY`, `MM`, `DD`, `HH`, `mm`, `ss`)
+func (f RunIDFormat) Generate(vars map[string]any) (id string, err error) {
+	switch RunIDFormat(strings.ToLower(string(f))) {
+	case "", RunIDFormatKSUID:
+		return newKSUID(), nil
+	case RunIDFormatULID:
+		return NewULID(time.Now()), nil
+	case RunIDFormatUUID:
+		return uuid.NewString(), nil
+	}
+
+	if !f.IsTemplate() {
+		return "", f.Validate()
+	}
+
+	now := time.Now()
+	m := g.M(
+		"run_timestamp", now.Format("2006_01_02_150405"),
+		"YYYY", now.Format("2006"),
+		"YY", now.Format("06"),
+		"MM", now.Format("01"),
+		"DD", now.Format("02"),
+		"HH", now.Format("15"),
+		"mm", now.Format("04"),
+		"ss", now.Format("05"),
+	)
+	for k, v := range vars {
+		m[k] = v
+	}
+
+	// only generate random parts when requested
+	tmpl := string(f)
+	if strings.Contains(tmpl, "{ksuid}") {
+		m["ksuid"] = newKSUID()
+	}
+	if strings.Contains(tmpl, "{ulid}") {
+		m["ulid"] = NewULID(now)
+	}
+	if strings.Contains(tmpl, "{uuid}") {
+		m["uuid"] = uuid.NewString()
+	}
+
+	id = g.Rm(tmpl, m)
+	if matches := runIDTemplateVarRegex.FindAllStringSubmatch(id, -1); len(matches) > 0 {
+		return "", g.Error("could not render run id template (%s), unknown variable: %s", f, matches[0][1])
+	}
+
+	return id, nil
+}
+
+func newKSUID() string {
+	uid, err := ksuid.NewRandom()
+	if err != nil {
+		return g.NewTsID("exec")
+	}
+	return uid.String()
+}
+
+// crockford base32 alphabet used by ULIDs
+const ulidEncoding = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a new ULID (https://github.com/ulid/spec) for the provided time
+func NewULID(t time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(t.UnixMilli())<<16)
+	_, _ = rand.Read(b[6:])
+
+	// encode 128 bits into 26 characters, 5 bits at a time (first char has 3 bits)
+	out := make([]byte, 26)
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = ulidEncoding[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
@@ -0,0 +1,66 @@
+package sling
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunIDFormat(t *testing.T) {
+	id, err := RunIDFormat("").Generate(nil)
+	assert.NoError(t, err)
+	assert.Len(t, id, 27) // ksuid
+
+	id, err = RunIDFormatULID.Generate(nil)
+	assert.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`), id)
+
+	id, err = RunIDFormat("UUID").Generate(nil)
+	assert.NoError(t, err)
+	assert.Len(t, id, 36)
+
+	id, err = RunIDFormat("{run_id}.{stream_table}").Generate(map[string]any{"run_id": "abc", "stream_table": "users"})
+	assert.NoError(t, err)
+	assert.Equal(t, "abc.users", id)
+
+	id, err = RunIDFormat("{YYYY}_{ulid}").Generate(nil)
+	assert.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^\d{4}_[0-9A-Z]{26}$`), id)
+
+	_, err = RunIDFormat("{run_id}.{unknown}").Generate(map[string]any{"run_id": "abc"})
+	assert.Error(t, err)
+
+	assert.Error(t, RunIDFormat("wrong").Validate())
+	assert.NoError(t, RunIDFormat("ulid").Validate())
+
+	// ulids sort by time
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Less(t, NewULID(t1), NewULID(t1.Add(time.Millisecond)))
+	assert.Equal(t, "01HK153X00", NewULID(t1)[:10])
+}
+
+func TestStreamRunID(t *testing.T) {
+	t.Setenv("SLING_EXEC_ID", "exec1")
+	t.Setenv("SLING_STREAM_RUN_ID_FORMAT", "{run_id}-{source_name}")
+
+	cfg := &Config{Source: Source{Conn: "MY_PG"}}
+	m, err := cfg.GetFormatMap()
+	assert.NoError(t, err)
+	assert.Equal(t, "exec1", m["run_id"])
+	assert.Equal(t, "exec1-my_pg", m["stream_run_id"])
+
+	// explicit stream id takes precedence
+	cfg = &Config{ReplicationStream: &ReplicationStreamConfig{ID: "my_stream"}}
+	id, err := cfg.StreamRunID()
+	assert.NoError(t, err)
+	assert.Equal(t, "my_stream", id)
+
+	// generated once
+	t.Setenv("SLING_STREAM_RUN_ID_FORMAT", "ulid")
+	cfg = &Config{}
+	id1, _ := cfg.StreamRunID()
+	id2, _ := cfg.StreamRunID()
+	assert.Equal(t, id1, id2)
+}
@@ -0,0 +1,133 @@
+package sling
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/spf13/cast"
+)
+
+// RunOrder is the order in which the streams of a replication are run
+type RunOrder string
+
+const (
+	// RunOrderPriority runs the streams with the highest priority first,
+	// then as listed (default)
+	RunOrderPriority RunOrder = "priority"
+	// RunOrderAsListed runs the streams as listed, ignoring the priority
+	RunOrderAsListed RunOrder = "as_listed"
+	// RunOrderSmallestFirst runs the streams with the fewest rows (or bytes
+	// of files) first, within a same priority
+	RunOrderSmallestFirst RunOrder = "smallest_first"
+	// RunOrderLargestFirst runs the streams with the most rows (or bytes
+	// of files) first, within a same priority, so that the long-pole
+	// streams start early
+	RunOrderLargestFirst RunOrder = "largest_first"
+)
+
+// Validate checks the run order value
+func (ro RunOrder) Validate() error {
+	switch RunOrder(strings.ToLower(string(ro))) {
+	case "", RunOrderPriority, RunOrderAsListed, RunOrderSmallestFirst, RunOrderLargestFirst:
+		return nil
+	}
+	return g.Error("invalid run_order value (%s). Expected priority, as_listed, smallest_first or largest_first", ro)
+}
+
+// orderTasks sorts the compiled tasks per the run order
+func (rd *ReplicationConfig) orderTasks() (err error) {
+	runOrder := RunOrder(strings.ToLower(string(rd.RunOrder)))
+	if err = runOrder.Validate(); err != nil {
+		return err
+	} else if runOrder == RunOrderAsListed {
+		return nil
+	}
+
+	priority := func(cfg *Config) int {
+		if cfg.ReplicationStream == nil {
+			return 0
+		}
+		return cfg.ReplicationStream.Priority
+	}
+
+	// sizes of the sources, discovered for the size orders
+	sizes := map[*Config]int64{}
+	if g.In(runOrder, RunOrderSmallestFirst, RunOrderLargestFirst) {
+		for _, cfg := range rd.Tasks {
+			if cfg.ReplicationStream != nil && cfg.ReplicationStream.Disabled {
+				continue
+			}
+			size, err := cfg.sourceSize()
+			if err != nil {
+				g.Debug("could not get size of stream %s: %s", cfg.StreamName, err.Error())
+				size = -1
+			}
+			sizes[cfg] = size
+		}
+	}
+
+	sort.SliceStable(rd.Tasks, func(i, j int) bool {
+		ti, tj := rd.Tasks[i], rd.Tasks[j]
+		if pi, pj := priority(ti), priority(tj); pi != pj {
+			return pi > pj
+		}
+
+		switch runOrder {
+		case RunOrderSmallestFirst:
+			return sizes[ti] < sizes[tj]
+		case RunOrderLargestFirst:
+			return sizes[ti] > sizes[tj]
+		}
+		return false
+	})
+
+	return nil
+}
+
+// sourceSize returns the size of the source stream: the estimated row count
+// of a table, or the total bytes of the files. -1 if unknown (custom SQL).
+func (cfg *Config) sourceSize() (size int64, err error) {
+	switch {
+	case cfg.SrcConn.Type.IsDb():
+		table, err := database.ParseTableName(cfg.Source.Stream, cfg.SrcConn.Type)
+		if err != nil {
+			return -1, g.Error(err, "could not parse source table")
+		} else if table.IsQuery() {
+			return -1, nil
+		}
+
+		conn, err := cfg.SrcConn.AsDatabase(true)
+		if err != nil {
+			return -1, g.Error(err, "could not init source connection")
+		} else if err = conn.Connect(); err != nil {
+			return -1, g.Error(err, "could not connect to source")
+		}
+
+		count, err := database.GetCountEstimate(conn, table)
+		if err != nil {
+			return -1, g.Error(err, "could not get count of %s", table.FullName())
+		}
+		return cast.ToInt64(count), nil
+
+	case cfg.SrcConn.Type.IsFile():
+		uri := cast.ToString(cfg.Source.Data["url"])
+		if uri == "" || cfg.Options.StdIn {
+			return -1, nil
+		}
+
+		fs, err := cfg.SrcConn.AsFile(true)
+		if err != nil {
+			return -1, g.Error(err, "could not init source connection")
+		}
+
+		nodes, err := fs.Self().ListRecursive(uri)
+		if err != nil {
+			return -1, g.Error(err, "could not list files of %s", uri)
+		}
+		return cast.ToInt64(nodes.TotalSize()), nil
+	}
+
+	return -1, nil
+}
@@ -0,0 +1,104 @@
+package sling
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunOrder(t *testing.T) {
+	folder := t.TempDir()
+	for name, rows := range map[string]int{"small": 1, "medium": 50, "large": 500} {
+		content := "id,name\n" + strings.Repeat("1,abcdefghij\n", rows)
+		os.WriteFile(filepath.Join(folder, name+".csv"), []byte(content), 0644)
+	}
+
+	streamNames := func(yaml string) []string {
+		replication, err := LoadReplicationConfig(yaml)
+		if !assert.NoError(t, err) || !assert.NoError(t, replication.Compile(nil)) {
+			return nil
+		}
+		names := []string{}
+		for _, cfg := range replication.Tasks {
+			names = append(names, strings.TrimSuffix(filepath.Base(cfg.StreamName), ".csv"))
+		}
+		return names
+	}
+
+	replicationYaml := g.R(`
+source: LOCAL
+target: LOCAL
+run_order: {run_order}
+defaults:
+  mode: full-refresh
+  object: file://{folder}/out/{stream_file_name}.csv
+streams:
+  file://{folder}/medium.csv:
+  file://{folder}/small.csv:
+  file://{folder}/large.csv:
+`, "folder", folder)
+
+	order := func(runOrder string) []string {
+		return streamNames(g.R(replicationYaml, "run_order", runOrder))
+	}
+
+	assert.Equal(t, []string{"medium", "small", "large"}, order("as_listed"))
+	assert.Equal(t, []string{"medium", "small", "large"}, order("priority"))
+	assert.Equal(t, []string{"large", "medium", "small"}, order("largest_first"))
+	assert.Equal(t, []string{"small", "medium", "large"}, order("smallest_first"))
+
+	// the priority comes first, except as listed
+	withPriority := strings.Replace(replicationYaml, "small.csv:", "small.csv:\n    priority: 10", 1)
+	assert.Equal(t, []string{"small", "large", "medium"}, streamNames(g.R(withPriority, "run_order", "largest_first")))
+	assert.Equal(t, []string{"small", "medium", "large"}, streamNames(g.R(withPriority, "run_order", "priority")))
+	assert.Equal(t, []string{"medium", "small", "large"}, streamNames(g.R(withPriority, "run_order", "as_listed")))
+
+	replication, err := LoadReplicationConfig(g.R(replicationYaml, "run_order", "random"))
+	if assert.NoError(t, err) {
+		assert.ErrorContains(t, replication.Compile(nil), "invalid run_order value")
+	}
+	issues := ValidateReplication(g.R(replicationYaml, "run_order", "random"))
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, "run_order", issues[0].Path)
+	}
+
+	// tables are ordered by row count
+	dbURL := "sqlite://" + filepath.Join(folder, "order.db")
+	t.Setenv("ORDER_SQLITE", dbURL)
+	connection.GetLocalConns(true) // refresh the cached connections
+
+	conn, err := database.NewConn(dbURL)
+	if !assert.NoError(t, err) || !assert.NoError(t, conn.Connect()) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecMulti(
+		`create table few (id integer)`,
+		`insert into few values (1)`,
+		`create table many (id integer)`,
+		`insert into many values (1), (2), (3)`,
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	names := streamNames(`
+source: ORDER_SQLITE
+target: ORDER_SQLITE
+run_order: largest_first
+defaults:
+  mode: full-refresh
+  object: main.{stream_table}_copy
+streams:
+  main.few:
+  main.many:
+`)
+	assert.Equal(t, []string{"main.many", "main.few"}, names)
+}
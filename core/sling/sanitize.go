@@ -0,0 +1,236 @@
+package sling
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+)
+
+// ColumnSanitizer renames the columns into valid identifiers of the target
+// database, before the table DDL is generated. Enabled with `true`, or with
+// a mapping of the settings.
+type ColumnSanitizer struct {
+	Replacement    *string `json:"replacement,omitempty" yaml:"replacement,omitempty"`         // replaces the invalid characters, `_` by default
+	NumericPrefix  *string `json:"numeric_prefix,omitempty" yaml:"numeric_prefix,omitempty"`   // prefixes the names starting with a digit, `_` by default
+	ReservedSuffix *string `json:"reserved_suffix,omitempty" yaml:"reserved_suffix,omitempty"` // suffixes the reserved words, `_` by default. Blank to keep them
+	MaxLength      int     `json:"max_length,omitempty" yaml:"max_length,omitempty"`           // truncates the names, to the database maximum by default
+
+	disabled bool
+}
+
+// columnSanitizedKey is the column metadata key of the sanitation reasons
+const columnSanitizedKey = "sanitized"
+
+var (
+	invalidIdentifierChars = regexp.MustCompile(`[^_0-9a-zA-Z]+`)
+	validSanitizerAffix    = regexp.MustCompile(`^[_0-9a-zA-Z]*$`)
+)
+
+func (cs *ColumnSanitizer) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*cs = ColumnSanitizer{disabled: !enabled}
+		return nil
+	}
+
+	type sanitizer ColumnSanitizer // no recursion
+	if err := json.Unmarshal(data, (*sanitizer)(cs)); err != nil {
+		return g.Error(err, "column_sanitizer must be a boolean or a mapping")
+	}
+	return nil
+}
+
+func (cs ColumnSanitizer) MarshalJSON() ([]byte, error) {
+	if cs.disabled {
+		return json.Marshal(false)
+	}
+	type sanitizer ColumnSanitizer // no recursion
+	return json.Marshal(sanitizer(cs))
+}
+
+// Enabled returns true if the columns are sanitized
+func (cs *ColumnSanitizer) Enabled() bool {
+	return cs != nil && !cs.disabled
+}
+
+// Validate checks the sanitizer settings
+func (cs *ColumnSanitizer) Validate() error {
+	if !cs.Enabled() {
+		return nil
+	}
+	for key, val := range map[string]*string{"replacement": cs.Replacement, "numeric_prefix": cs.NumericPrefix, "reserved_suffix": cs.ReservedSuffix} {
+		if !validSanitizerAffix.MatchString(g.PtrVal(val)) {
+			return g.Error("invalid column_sanitizer %s (%s). Only letters, digits and underscores are allowed", key, *val)
+		}
+	}
+	if prefix := g.PtrVal(cs.NumericPrefix); prefix != "" && prefix[0] >= '0' && prefix[0] <= '9' {
+		return g.Error("invalid column_sanitizer numeric_prefix (%s). Cannot start with a digit", prefix)
+	}
+	if cs.MaxLength < 0 {
+		return g.Error("invalid column_sanitizer max_length (%d)", cs.MaxLength)
+	}
+	return nil
+}
+
+func (cs *ColumnSanitizer) affix(val *string) string {
+	if val == nil {
+		return "_"
+	}
+	return *val
+}
+
+// maxLength returns the maximum length of the names, 0 if not limited
+func (cs *ColumnSanitizer) maxLength(tgtType dbio.Type) int {
+	if cs.MaxLength > 0 {
+		return cs.MaxLength
+	}
+	return tgtType.MaxIdentifierLength()
+}
+
+// SanitizeName returns the valid identifier of the name, with the reasons
+// of the changes (e.g. `reserved word`)
+func (cs *ColumnSanitizer) SanitizeName(name string, tgtType dbio.Type) (newName string, reasons []string) {
+	if !cs.Enabled() {
+		return name, nil
+	}
+
+	replacement := cs.affix(cs.Replacement)
+	newName = invalidIdentifierChars.ReplaceAllString(strings.TrimSpace(name), replacement)
+	if replacement != "" && newName != name {
+		// no leading / trailing replacements, e.g. `(amount)` => `amount`
+		if trimmed := strings.Trim(newName, replacement); trimmed != "" {
+			newName = trimmed
+		}
+	}
+	if newName != name {
+		reasons = append(reasons, "invalid characters")
+	}
+	if newName == "" {
+		newName, reasons = "col", []string{"blank name"}
+	}
+
+	if prefix := cs.affix(cs.NumericPrefix); prefix != "" && newName[0] >= '0' && newName[0] <= '9' {
+		newName = prefix + newName
+		reasons = append(reasons, "leading digit")
+	}
+
+	if suffix := cs.affix(cs.ReservedSuffix); suffix != "" && tgtType.IsReservedWord(newName) {
+		newName = newName + suffix
+		reasons = append(reasons, "reserved word")
+	}
+
+	if maxLength := cs.maxLength(tgtType); maxLength > 0 && len(newName) > maxLength {
+		newName = truncateName(newName, maxLength)
+		reasons = append(reasons, "truncated")
+	}
+
+	return newName, reasons
+}
+
+// Sanitize returns the valid identifiers of the names, with the reasons of
+// the changes. The names made duplicate (case-insensitive) by the sanitation
+// are suffixed with a number (e.g. `amount_2`), within the maximum length.
+func (cs *ColumnSanitizer) Sanitize(names []string, tgtType dbio.Type) (newNames []string, reasons [][]string) {
+	newNames = make([]string, len(names))
+	reasons = make([][]string, len(names))
+	if !cs.Enabled() {
+		copy(newNames, names)
+		return
+	}
+
+	// the unchanged names are kept, the changed ones are disambiguated
+	taken := map[string]bool{}
+	for i, name := range names {
+		newNames[i], reasons[i] = cs.SanitizeName(name, tgtType)
+		if newNames[i] == name {
+			taken[strings.ToLower(name)] = true
+		}
+	}
+
+	maxLength := cs.maxLength(tgtType)
+	for i, name := range names {
+		if newNames[i] == name {
+			continue
+		}
+
+		base, newName := newNames[i], newNames[i]
+		for n := 2; taken[strings.ToLower(newName)]; n++ {
+			suffix := g.F("_%d", n)
+			if maxLength > 0 && len(base)+len(suffix) > maxLength {
+				base = truncateName(base, maxLength-len(suffix))
+			}
+			newName = base + suffix
+		}
+		if newName != newNames[i] {
+			newNames[i] = newName
+			reasons[i] = append(reasons[i], "duplicate")
+		}
+		taken[strings.ToLower(newName)] = true
+	}
+
+	return newNames, reasons
+}
+
+// truncateName truncates the name to the number of bytes, without splitting
+// a multi-byte character
+func truncateName(name string, length int) string {
+	for len(name) > length {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+// applyColumnSanitizerToDf renames the columns into valid identifiers of the
+// target, keeping the source name and the reasons (for the manifest)
+func applyColumnSanitizerToDf(df *iop.Dataflow, connType dbio.Type, sanitizer *ColumnSanitizer) {
+	if !sanitizer.Enabled() {
+		return
+	}
+
+	newNames, reasons := sanitizer.Sanitize(df.Columns.Names(), connType)
+	mapping := map[string]string{}
+	for i, col := range df.Columns {
+		if newNames[i] == col.Name {
+			continue
+		}
+		if col.Metadata[columnSourceNameKey] == "" {
+			df.Columns[i].SetMetadata(columnSourceNameKey, col.Name)
+		}
+		df.Columns[i].SetMetadata(columnSanitizedKey, strings.Join(reasons[i], ", "))
+		df.Columns[i].Name = newNames[i]
+		mapping[col.Name] = newNames[i]
+	}
+
+	// propagate names to streams
+	rename := func(columns iop.Columns) {
+		for i, col := range columns {
+			if name, ok := mapping[col.Name]; ok {
+				columns[i].Name = name
+			}
+		}
+	}
+	for _, ds := range df.Streams {
+		rename(ds.Columns)
+		if ds.CurrentBatch != nil {
+			rename(ds.CurrentBatch.Columns)
+		}
+	}
+}
+
+// columnName returns the target name of a source column (e.g. a key), per
+// the column casing and sanitizer
+func (o *TargetOptions) columnName(name string, tgtType dbio.Type) string {
+	if o == nil {
+		return name
+	}
+	if o.ColumnCasing != nil {
+		name = o.ColumnCasing.Apply(name, tgtType)
+	}
+	name, _ = o.ColumnSanitizer.SanitizeName(name, tgtType)
+	return name
+}
@@ -0,0 +1,92 @@
+package sling
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumnSanitizer(t *testing.T) {
+	sanitizer := &ColumnSanitizer{}
+	names, reasons := sanitizer.Sanitize([]string{"Order Id", "order", "1st_value", "amount ($)", "amount", "Order_Id", " "}, dbio.TypeDbPostgres)
+	assert.Equal(t, []string{"Order_Id_2", "order_", "_1st_value", "amount_2", "amount", "Order_Id", "col"}, names)
+	assert.Equal(t, []string{"invalid characters", "duplicate"}, reasons[0])
+	assert.Equal(t, []string{"reserved word"}, reasons[1])
+	assert.Equal(t, []string{"leading digit"}, reasons[2])
+	assert.Empty(t, reasons[4])
+	assert.Equal(t, []string{"blank name"}, reasons[6])
+
+	// truncated to the maximum length, disambiguated
+	long := strings.Repeat("x", 70)
+	names, reasons = sanitizer.Sanitize([]string{long + "a", long + "b"}, dbio.TypeDbPostgres)
+	assert.Equal(t, []string{strings.Repeat("x", 63), strings.Repeat("x", 61) + "_2"}, names)
+	assert.Equal(t, []string{"truncated", "duplicate"}, reasons[1])
+
+	sanitizer = &ColumnSanitizer{Replacement: g.String(""), NumericPrefix: g.String("c"), ReservedSuffix: g.String(""), MaxLength: 5}
+	names, _ = sanitizer.Sanitize([]string{"my col", "9lives", "select"}, dbio.TypeDbPostgres)
+	assert.Equal(t, []string{"mycol", "c9liv", "selec"}, names)
+
+	assert.ErrorContains(t, (&ColumnSanitizer{Replacement: g.String("-")}).Validate(), "invalid column_sanitizer replacement")
+	assert.ErrorContains(t, (&ColumnSanitizer{NumericPrefix: g.String("1")}).Validate(), "Cannot start with a digit")
+
+	// enabled with true, disabled with false
+	options := &TargetOptions{}
+	assert.NoError(t, g.Unmarshal(`{"column_sanitizer": true}`, options))
+	assert.True(t, options.ColumnSanitizer.Enabled())
+	assert.NoError(t, g.Unmarshal(`{"column_sanitizer": false}`, options))
+	assert.False(t, options.ColumnSanitizer.Enabled())
+	assert.Contains(t, g.Marshal(options), `"column_sanitizer":false`)
+
+	folder := t.TempDir()
+	t.Setenv("SANITIZE_SQLITE", "sqlite://"+filepath.Join(folder, "sanitize.db"))
+	connection.GetLocalConns(true) // refresh the cached connections
+
+	replication, err := LoadReplicationConfig(`
+source: SANITIZE_SQLITE
+target: SANITIZE_SQLITE
+streams:
+  orders:
+    sql: select 1 as "order", 2 as "unit price", 3 as "2nd"
+    object: main.orders
+    mode: incremental
+    primary_key: [order]
+    target_options:
+      column_sanitizer: true
+`)
+	if !assert.NoError(t, err) || !assert.NoError(t, replication.Compile(nil)) {
+		return
+	}
+
+	for i := 0; i < 2; i++ { // merged the second time, on the sanitized key
+		task := NewTask("", replication.Tasks[0])
+		if !assert.NoError(t, task.Execute()) {
+			return
+		}
+
+		manifest := NewRunManifest(task.ExecID, "")
+		manifest.Add(task)
+		if assert.Len(t, manifest.Streams, 1) && assert.Len(t, manifest.Streams[0].Columns, 3) {
+			column := manifest.Streams[0].Columns[1]
+			assert.Equal(t, "unit price", column.Source)
+			assert.Equal(t, "unit_price", column.Target)
+			assert.Equal(t, "invalid characters", column.Sanitized)
+		}
+	}
+
+	conn, err := database.NewConn(os.Getenv("SANITIZE_SQLITE"))
+	if assert.NoError(t, err) && assert.NoError(t, conn.Connect()) {
+		defer conn.Close()
+		data, err := conn.Query(`select * from main.orders`)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"order_", "unit_price", "_2nd"}, data.Columns.Names())
+			assert.Len(t, data.Rows, 1)
+		}
+	}
+}
@@ -0,0 +1,488 @@
+package sling
+
+import (
+	"context"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/spf13/cast"
+)
+
+// CronSchedule is a parsed cron expression with 5 fields (minute hour
+// day-of-month month day-of-week), or a descriptor such as `@hourly`,
+// `@daily`, `@weekly`, `@monthly`, `@yearly` or `@every 15m`.
+type CronSchedule struct {
+	Expr string
+
+	every   time.Duration
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	domStar bool
+	dowStar bool
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+var cronDayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// ParseCronSchedule parses a cron expression or descriptor
+func ParseCronSchedule(expr string) (cs *CronSchedule, err error) {
+	cs = &CronSchedule{Expr: strings.TrimSpace(expr)}
+	spec := strings.ToLower(cs.Expr)
+
+	if strings.HasPrefix(spec, "@every ") {
+		cs.every, err = time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil || cs.every < time.Second {
+			return nil, g.Error("invalid schedule duration: %s", cs.Expr)
+		}
+		return cs, nil
+	} else if val, ok := cronDescriptors[spec]; ok {
+		spec = val
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, g.Error("invalid schedule (%s). Expected 5 fields (minute hour day-of-month month day-of-week) or a descriptor such as @daily", cs.Expr)
+	}
+
+	parsers := []struct {
+		bits     *uint64
+		min, max int
+		names    map[string]int
+	}{
+		{&cs.minute, 0, 59, nil},
+		{&cs.hour, 0, 23, nil},
+		{&cs.dom, 1, 31, nil},
+		{&cs.month, 1, 12, cronMonthNames},
+		{&cs.dow, 0, 7, cronDayNames},
+	}
+
+	for i, p := range parsers {
+		*p.bits, err = parseCronField(fields[i], p.min, p.max, p.names)
+		if err != nil {
+			return nil, g.Error(err, "invalid schedule: %s", cs.Expr)
+		}
+	}
+
+	// sunday can be 0 or 7
+	if cs.dow&(1<<7) > 0 {
+		cs.dow |= 1
+	}
+	cs.domStar = fields[2] == "*" || fields[2] == "?"
+	cs.dowStar = fields[4] == "*" || fields[4] == "?"
+
+	return cs, nil
+}
+
+// parseCronField parses a field with lists, ranges & steps into a bitset
+func parseCronField(field string, min, max int, names map[string]int) (bits uint64, err error) {
+	toInt := func(s string) (int, error) {
+		if n, ok := names[s]; ok {
+			return n, nil
+		}
+		return cast.ToIntE(s)
+	}
+
+	for _, part := range strings.Split(field, ",") {
+		start, end, step := min, max, 1
+
+		rangeExpr, stepExpr, hasStep := strings.Cut(part, "/")
+		if hasStep {
+			if step, err = cast.ToIntE(stepExpr); err != nil || step < 1 {
+				return 0, g.Error("invalid step: %s", part)
+			}
+		}
+
+		switch {
+		case rangeExpr == "*" || rangeExpr == "?":
+		case strings.Contains(rangeExpr, "-"):
+			startExpr, endExpr, _ := strings.Cut(rangeExpr, "-")
+			if start, err = toInt(startExpr); err != nil {
+				return 0, g.Error("invalid value: %s", part)
+			}
+			if end, err = toInt(endExpr); err != nil {
+				return 0, g.Error("invalid value: %s", part)
+			}
+		default:
+			if start, err = toInt(rangeExpr); err != nil {
+				return 0, g.Error("invalid value: %s", part)
+			}
+			if !hasStep {
+				end = start
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return 0, g.Error("value out of range [%d-%d]: %s", min, max, part)
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+// Next returns the next activation time after the given time
+func (cs *CronSchedule) Next(after time.Time) time.Time {
+	if cs.every > 0 {
+		return after.Add(cs.every).Truncate(time.Second)
+	}
+
+	has := func(bits uint64, v int) bool { return bits&(1<<uint(v)) > 0 }
+	dayMatches := func(t time.Time) bool {
+		domMatch := has(cs.dom, t.Day())
+		dowMatch := has(cs.dow, int(t.Weekday()))
+		if cs.domStar || cs.dowStar {
+			return domMatch && dowMatch
+		}
+		return domMatch || dowMatch // both restricted: either matches
+	}
+
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if !has(cs.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(cs.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(cs.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{} // never
+}
+
+// ScheduleOverlap is the policy when a run is due while the previous run of the job is still running
+type ScheduleOverlap string
+
+const (
+	ScheduleOverlapSkip  ScheduleOverlap = "skip"  // the run is skipped (default)
+	ScheduleOverlapQueue ScheduleOverlap = "queue" // the run starts once the previous one ends
+	ScheduleOverlapAllow ScheduleOverlap = "allow" // runs are concurrent
+)
+
+// Validate checks the overlap policy
+func (so ScheduleOverlap) Validate() error {
+	switch so {
+	case "", ScheduleOverlapSkip, ScheduleOverlapQueue, ScheduleOverlapAllow:
+		return nil
+	}
+	return g.Error("invalid schedule overlap policy (%s). Expected skip, queue or allow", so)
+}
+
+// ScheduleJob is the set of streams of a replication sharing the same schedule
+type ScheduleJob struct {
+	ID          string     `json:"id"`
+	Replication string     `json:"replication"`
+	Schedule    string     `json:"schedule"`
+	Streams     []string   `json:"streams"`
+	NextRun     time.Time  `json:"next_run"`
+	LastStart   *time.Time `json:"last_start,omitempty"`
+	LastEnd     *time.Time `json:"last_end,omitempty"`
+	LastStatus  string     `json:"last_status,omitempty"` // running, success, error or skipped
+	LastError   string     `json:"last_error,omitempty"`
+	Running     int        `json:"running"`
+	Queued      bool       `json:"queued"`
+	Runs        int        `json:"runs"`
+	Failures    int        `json:"failures"`
+
+	cron *CronSchedule
+}
+
+// SchedulerStatus is the status written by the scheduler
+type SchedulerStatus struct {
+	PID       int           `json:"pid"`
+	StartedAt time.Time     `json:"started_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	Overlap   string        `json:"overlap"`
+	Jobs      []ScheduleJob `json:"jobs"`
+}
+
+// Scheduler runs the replication streams according to their `schedule`,
+// until the context is canceled
+type Scheduler struct {
+	Jobs       []*ScheduleJob
+	Overlap    ScheduleOverlap
+	StatusFile string
+
+	// RunFunc executes a job, i.e. the replication with the job streams
+	RunFunc func(ctx context.Context, job *ScheduleJob) error
+
+	startedAt time.Time
+	mux       sync.Mutex
+	wg        sync.WaitGroup
+}
+
+// DefaultSchedulerStatusFile returns the path of the scheduler status file
+func DefaultSchedulerStatusFile() string {
+	if val := os.Getenv("SLING_SCHEDULER_STATUS_FILE"); val != "" {
+		return val
+	}
+	return path.Join(env.HomeDir, "scheduler", "status.json")
+}
+
+// NewScheduler creates a scheduler
+func NewScheduler(overlap ScheduleOverlap, runFunc func(ctx context.Context, job *ScheduleJob) error) (s *Scheduler, err error) {
+	if err = overlap.Validate(); err != nil {
+		return nil, err
+	} else if overlap == "" {
+		overlap = ScheduleOverlapSkip
+	}
+
+	return &Scheduler{
+		Overlap:    overlap,
+		StatusFile: DefaultSchedulerStatusFile(),
+		RunFunc:    runFunc,
+	}, nil
+}
+
+// AddReplication adds a job per distinct schedule of the replication streams.
+// Streams inherit the schedule of the defaults, and disabled streams are ignored.
+func (s *Scheduler) AddReplication(cfgPath string, rd ReplicationConfig) (err error) {
+	jobMap := map[string]*ScheduleJob{}
+	jobs := []*ScheduleJob{}
+
+	for _, name := range rd.StreamsOrdered() {
+		stream := ReplicationStreamConfig{}
+		if rd.Streams[name] != nil {
+			stream = *rd.Streams[name]
+		}
+		SetStreamDefaults(name, &stream, rd)
+
+		schedule := strings.TrimSpace(stream.Schedule)
+		if schedule == "" || stream.Disabled {
+			continue
+		}
+
+		job, ok := jobMap[schedule]
+		if !ok {
+			cron, err := ParseCronSchedule(schedule)
+			if err != nil {
+				return g.Error(err, "invalid schedule for stream %s", name)
+			}
+			job = &ScheduleJob{
+				ID:          g.F("%s | %s", cfgPath, schedule),
+				Replication: cfgPath,
+				Schedule:    schedule,
+				cron:        cron,
+			}
+			jobMap[schedule] = job
+			jobs = append(jobs, job)
+		}
+		job.Streams = append(job.Streams, name)
+	}
+
+	if len(jobs) == 0 {
+		return g.Error("no streams with a schedule in replication %s", cfgPath)
+	}
+
+	s.mux.Lock()
+	s.Jobs = append(s.Jobs, jobs...)
+	s.mux.Unlock()
+
+	return nil
+}
+
+// Start runs the jobs as they become due, until the context is canceled.
+// Running jobs are waited for before returning.
+func (s *Scheduler) Start(ctx context.Context) (err error) {
+	if len(s.Jobs) == 0 {
+		return g.Error("no jobs to schedule")
+	} else if s.RunFunc == nil {
+		return g.Error("no run function for the scheduler")
+	}
+
+	s.mux.Lock()
+	s.startedAt = time.Now()
+	for _, job := range s.Jobs {
+		job.NextRun = job.cron.Next(s.startedAt)
+		g.Info("scheduled %s [%d streams] with `%s`, next run at %s", job.Replication, len(job.Streams), job.Schedule, job.NextRun.Format(time.RFC3339))
+	}
+	s.mux.Unlock()
+	s.writeStatus()
+
+	for {
+		next := s.nextRun()
+		if next.IsZero() {
+			g.Warn("no more scheduled runs")
+			break
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			g.Info("stopping scheduler, waiting for running jobs")
+			s.wg.Wait()
+			s.writeStatus()
+			return nil
+		case <-timer.C:
+			s.runDue(ctx, time.Now())
+		}
+	}
+
+	s.wg.Wait()
+	s.writeStatus()
+	return nil
+}
+
+// nextRun returns the earliest next run of the jobs
+func (s *Scheduler) nextRun() (next time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, job := range s.Jobs {
+		if !job.NextRun.IsZero() && (next.IsZero() || job.NextRun.Before(next)) {
+			next = job.NextRun
+		}
+	}
+	return next
+}
+
+// runDue starts the jobs which are due, applying the overlap policy
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) {
+	s.mux.Lock()
+	for _, job := range s.Jobs {
+		if job.NextRun.IsZero() || job.NextRun.After(now) {
+			continue
+		}
+		job.NextRun = job.cron.Next(now)
+
+		if job.Running > 0 {
+			switch s.Overlap {
+			case ScheduleOverlapQueue:
+				g.Info("queuing run of %s since previous run is still running", job.ID)
+				job.Queued = true
+				continue
+			case ScheduleOverlapAllow:
+			default:
+				g.Warn("skipping run of %s since previous run is still running", job.ID)
+				job.LastStatus = "skipped"
+				continue
+			}
+		}
+
+		s.startJob(ctx, job)
+	}
+	s.mux.Unlock()
+
+	s.writeStatus()
+}
+
+// startJob runs the job in the background. The lock must be held.
+func (s *Scheduler) startJob(ctx context.Context, job *ScheduleJob) {
+	start := time.Now()
+	job.Running++
+	job.Runs++
+	job.LastStart = &start
+	job.LastStatus = "running"
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		g.Info("running %s [%s]", job.Replication, strings.Join(job.Streams, ", "))
+		err := s.RunFunc(ctx, job)
+
+		s.mux.Lock()
+		end := time.Now()
+		job.Running--
+		job.LastEnd = &end
+		if err != nil {
+			job.LastStatus = "error"
+			job.LastError = err.Error()
+			job.Failures++
+			g.Warn("run of %s failed after %s: %s", job.ID, g.DurationString(end.Sub(start)), err.Error())
+		} else {
+			job.LastStatus = "success"
+			job.LastError = ""
+			g.Info("run of %s succeeded in %s", job.ID, g.DurationString(end.Sub(start)))
+		}
+
+		// start the queued run
+		if job.Queued && ctx.Err() == nil {
+			job.Queued = false
+			s.startJob(ctx, job)
+		}
+		s.mux.Unlock()
+
+		s.writeStatus()
+	}()
+}
+
+// Status returns the current status of the scheduler
+func (s *Scheduler) Status() (status SchedulerStatus) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	status = SchedulerStatus{
+		PID:       os.Getpid(),
+		StartedAt: s.startedAt,
+		UpdatedAt: time.Now(),
+		Overlap:   string(s.Overlap),
+	}
+	for _, job := range s.Jobs {
+		status.Jobs = append(status.Jobs, *job)
+	}
+	sort.SliceStable(status.Jobs, func(i, j int) bool { return status.Jobs[i].NextRun.Before(status.Jobs[j].NextRun) })
+	return status
+}
+
+// writeStatus writes the status file, if set
+func (s *Scheduler) writeStatus() {
+	if s.StatusFile == "" {
+		return
+	}
+
+	if err := os.MkdirAll(path.Dir(s.StatusFile), 0755); err != nil {
+		g.Debug("could not create scheduler status folder: %s", err.Error())
+		return
+	}
+	if err := os.WriteFile(s.StatusFile, []byte(g.Pretty(s.Status())), 0644); err != nil {
+		g.Debug("could not write scheduler status: %s", err.Error())
+	}
+}
+
+// ReadSchedulerStatus reads the status written by a scheduler
+func ReadSchedulerStatus(statusFile string) (status SchedulerStatus, err error) {
+	bytes, err := os.ReadFile(statusFile)
+	if err != nil {
+		return status, g.Error(err, "could not read scheduler status (is the scheduler running?)")
+	}
+
+	if err = g.Unmarshal(string(bytes), &status); err != nil {
+		return status, g.Error(err, "could not parse scheduler status")
+	}
+	return status, nil
+}
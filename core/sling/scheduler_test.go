@@ -0,0 +1,126 @@
+package sling
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCronSchedule(t *testing.T) {
+	base := time.Date(2024, 1, 31, 10, 17, 30, 0, time.UTC) // a wednesday
+
+	cases := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2024, 2, 1, 2, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"30 9 * * mon-fri", time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 */3 *", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2024, 2, 4, 12, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 5", time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)}, // day-of-month or day-of-week
+		{"@every 90s", time.Date(2024, 1, 31, 10, 19, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		cs, err := ParseCronSchedule(c.expr)
+		if assert.NoError(t, err, c.expr) {
+			assert.Equal(t, c.expected, cs.Next(base), c.expr)
+		}
+	}
+
+	for _, expr := range []string{"* * * *", "61 * * * *", "* * * * mon-", "*/0 * * * *", "@every 1ms"} {
+		_, err := ParseCronSchedule(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestSchedulerJobs(t *testing.T) {
+	replication, err := UnmarshalReplication(`
+source: postgres
+target: snowflake
+defaults:
+  mode: full-refresh
+  object: public.{stream_table}
+  schedule: "0 * * * *"
+streams:
+  public.orders:
+  public.customers:
+  public.events:
+    schedule: "*/5 * * * *"
+  public.logs:
+    disabled: true
+`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var runs, concurrent, maxConcurrent int32
+	release := make(chan struct{})
+	runFunc := func(ctx context.Context, job *ScheduleJob) error {
+		n := atomic.AddInt32(&concurrent, 1)
+		if n > atomic.LoadInt32(&maxConcurrent) {
+			atomic.StoreInt32(&maxConcurrent, n)
+		}
+		atomic.AddInt32(&runs, 1)
+		<-release
+		atomic.AddInt32(&concurrent, -1)
+		return nil
+	}
+
+	_, err = NewScheduler("sometimes", runFunc)
+	assert.Error(t, err)
+
+	s, err := NewScheduler("", runFunc)
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.StatusFile = ""
+
+	err = s.AddReplication("replication.yaml", replication)
+	if !assert.NoError(t, err) || !assert.Len(t, s.Jobs, 2) {
+		return
+	}
+	assert.Equal(t, []string{"public.orders", "public.customers"}, s.Jobs[0].Streams)
+	assert.Equal(t, []string{"public.events"}, s.Jobs[1].Streams)
+
+	// skip: due again while running
+	ctx := context.Background()
+	job := s.Jobs[1]
+	job.NextRun = time.Now().Add(-time.Second)
+	s.runDue(ctx, time.Now())
+	job.NextRun = time.Now().Add(-time.Second)
+	s.runDue(ctx, time.Now())
+	assert.Equal(t, 1, s.Status().Jobs[0].Runs+s.Status().Jobs[1].Runs)
+	assert.Equal(t, "skipped", job.LastStatus)
+
+	// queue: runs once the previous one ends
+	s.Overlap = ScheduleOverlapQueue
+	job.NextRun = time.Now().Add(-time.Second)
+	s.runDue(ctx, time.Now())
+	assert.True(t, job.Queued)
+	release <- struct{}{}
+	release <- struct{}{}
+	s.wg.Wait()
+
+	assert.EqualValues(t, 2, atomic.LoadInt32(&runs))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&maxConcurrent))
+	assert.Equal(t, "success", job.LastStatus)
+	assert.False(t, job.Queued)
+
+	// allow: concurrent runs
+	s.Overlap = ScheduleOverlapAllow
+	for i := 0; i < 2; i++ {
+		job.NextRun = time.Now().Add(-time.Second)
+		s.runDue(ctx, time.Now())
+	}
+	close(release)
+	s.wg.Wait()
+	assert.EqualValues(t, 4, atomic.LoadInt32(&runs))
+	assert.Equal(t, 4, job.Runs)
+}
@@ -0,0 +1,72 @@
+package sling
+
+import (
+	"os"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/slingdata-io/sling-cli/core/env"
+	"github.com/spf13/cast"
+)
+
+// stagingURL returns the object store folder to stage into, empty if none
+func (o *TargetOptions) stagingURL() string {
+	if o == nil {
+		return ""
+	}
+	return strings.TrimSuffix(g.PtrVal(o.StagingURL), "/")
+}
+
+// useStaging returns true if the task is transferred via the object store
+// of the staging_url option. Since staging is requested explicitly, it
+// errors if not possible.
+func (t *TaskExecution) useStaging(srcConn, tgtConn database.Connection) (ok bool, err error) {
+	stagingURL := t.Config.Target.Options.stagingURL()
+	if stagingURL == "" {
+		return false, nil
+	}
+
+	switch {
+	case !database.SupportsStaging(srcConn, stagingURL):
+		return false, g.Error("cannot use staging_url: %s cannot unload into %s", srcConn.GetType(), database.StagingType(stagingURL))
+	case !database.SupportsStaging(tgtConn, stagingURL):
+		return false, g.Error("cannot use staging_url: %s cannot load from %s", tgtConn.GetType(), database.StagingType(stagingURL))
+	}
+
+	if reason := t.rowProcessingBlocker(); reason != "" {
+		return false, g.Error("cannot use staging_url: %s", reason)
+	}
+	return true, nil
+}
+
+// runStaged unloads the selected source rows into a folder of the staging
+// object store, and loads the files into the temp table, which is committed
+// into the target table as with the streamed rows. No row goes through sling.
+func (t *TaskExecution) runStaged(srcConn, tgtConn database.Connection) (cnt uint64, err error) {
+	folderURL := g.F("%s/%s", t.Config.Target.Options.stagingURL(), g.NewTsID(env.CleanTableName(t.Config.StreamName)))
+
+	t.AddCleanupTaskLast(func() {
+		if cast.ToBool(os.Getenv("SLING_KEEP_TEMP")) {
+			return
+		}
+		if err := database.DeleteStagingFolder(tgtConn, folderURL); err != nil {
+			g.Warn("could not delete staged files in %s: %s", folderURL, err.Error())
+		}
+	})
+
+	return t.runServerLoad(srcConn, tgtConn, "staging", func(selectSQL string, srcColumns iop.Columns, tableTmp database.Table, tmpColumns iop.Columns) error {
+		srcTable := database.Table{SQL: selectSQL, Dialect: srcConn.GetType()}
+		g.Debug("unloading into %s", folderURL)
+		if err := srcConn.(database.StorageStager).UnloadToStorage(srcTable, folderURL); err != nil {
+			return g.Error(err, "could not unload into %s", folderURL)
+		}
+
+		g.Debug("loading from %s", folderURL)
+		if err := tgtConn.(database.StorageStager).LoadFromStorage(tableTmp.FullName(), folderURL, tmpColumns); err != nil {
+			return g.Error(err, "could not load from %s", folderURL)
+		}
+		return nil
+	})
+}
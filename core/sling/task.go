@@ -1,6 +1,8 @@
 package sling
 
 import (
+	"context"
+	"io"
 	"math"
 	"os"
 	"strings"
@@ -8,9 +10,11 @@ import (
 
 	"github.com/dustin/go-humanize"
 	"github.com/flarco/g"
-	"github.com/segmentio/ksuid"
+	"github.com/rs/zerolog"
 	"github.com/slingdata-io/sling-cli/core/dbio"
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
 	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
 	"github.com/slingdata-io/sling-cli/core/dbio/iop"
 	"github.com/slingdata-io/sling-cli/core/env"
 	"github.com/spf13/cast"
@@ -36,9 +40,16 @@ type TaskExecution struct {
 	data          *iop.Dataset  `json:"-"`
 	prevRowCount  uint64
 	prevByteCount uint64
-	skipStream    bool            `json:"skip_stream"`
-	lastIncrement time.Time       // the time of last row increment (to determine stalling)
-	Output        strings.Builder `json:"-"`
+	skipStream    bool                  `json:"skip_stream"`
+	readFs        filesys.FileSysClient // source file system of the listed files
+	readFiles     []LedgerFile          // files listed to read (for the ledger & after_read)
+	fileWatermark int64                 // new file watermark, recorded once loaded
+	lastIncrement time.Time             // the time of last row increment (to determine stalling)
+	timeoutErr    error                 // the cancel cause of the timeout budget
+	warnings      []string              // the warnings logged during the run
+	rejectFile    string                // local file of the rejected rows
+	stdin         io.Reader             // micro-batch read instead of stdin
+	Output        strings.Builder       `json:"-"`
 	OutputLines   chan *g.LogLine
 
 	Replication    *ReplicationConfig `json:"replication"`
@@ -46,6 +57,8 @@ type TaskExecution struct {
 	PBar           *ProgressBar       `json:"-"`
 	ProcStatsStart g.ProcStats        `json:"-"` // process stats at beginning
 	cleanupFuncs   []func()
+	meters         []*connMeter // warehouse usage of the connections
+	cost           *CostState   // final cost, once ended
 }
 
 // ExecutionStatus is an execution status object
@@ -62,11 +75,17 @@ type ExecutionStatus struct {
 	AvgDuration int        `json:"avg_duration,omitempty"`
 }
 
+// NewExecID returns a new execution (run) id. The id can be provided
+// with `SLING_RUN_ID`, otherwise it is generated with `SLING_RUN_ID_FORMAT`
 func NewExecID() string {
-	uid, err := ksuid.NewRandom()
-	execID := g.NewTsID("exec")
-	if err == nil {
-		execID = uid.String()
+	if val := strings.TrimSpace(os.Getenv("SLING_RUN_ID")); val != "" {
+		return val
+	}
+
+	execID, err := RunIDFormatFromEnv().Generate(nil)
+	if err != nil {
+		g.Warn("could not generate run id: %s", err.Error())
+		execID = newKSUID()
 	}
 
 	return execID
@@ -78,6 +97,10 @@ func NewTask(execID string, cfg *Config) (t *TaskExecution) {
 		execID = NewExecID()
 	}
 
+	if cfg != nil {
+		cfg.runID = execID
+	}
+
 	t = &TaskExecution{
 		ExecID:       execID,
 		Config:       cfg,
@@ -190,7 +213,7 @@ func (t *TaskExecution) GetTotalBytes() (rcBytes, txBytes uint64) {
 	procStatsEnd := g.GetProcStats(os.Getpid())
 
 	switch {
-	case g.In(t.Config.SrcConn.Type, dbio.TypeDbPostgres, dbio.TypeDbOracle, dbio.TypeDbMySQL, dbio.TypeDbStarRocks, dbio.TypeDbMariaDB):
+	case g.In(t.Config.SrcConn.Type, dbio.TypeDbPostgres, dbio.TypeDbGreenplum, dbio.TypeDbVertica, dbio.TypeDbOracle, dbio.TypeDbMySQL, dbio.TypeDbStarRocks, dbio.TypeDbMariaDB, dbio.TypeDbSingleStore, dbio.TypeDbTiDB):
 		rcBytes = procStatsEnd.RcBytes - t.ProcStatsStart.RcBytes
 	case g.In(t.Config.SrcConn.Type, dbio.TypeDbSnowflake, dbio.TypeDbBigQuery, dbio.TypeDbRedshift):
 		rcBytes = procStatsEnd.RcBytes - t.ProcStatsStart.RcBytes
@@ -200,7 +223,7 @@ func (t *TaskExecution) GetTotalBytes() (rcBytes, txBytes uint64) {
 	}
 
 	switch {
-	case g.In(t.Config.TgtConn.Type, dbio.TypeDbPostgres, dbio.TypeDbOracle, dbio.TypeDbMySQL):
+	case g.In(t.Config.TgtConn.Type, dbio.TypeDbPostgres, dbio.TypeDbGreenplum, dbio.TypeDbVertica, dbio.TypeDbOracle, dbio.TypeDbMySQL, dbio.TypeDbSingleStore, dbio.TypeDbTiDB):
 		txBytes = procStatsEnd.TxBytes - t.ProcStatsStart.TxBytes
 	case g.In(t.Config.TgtConn.Type, dbio.TypeDbSnowflake, dbio.TypeDbBigQuery, dbio.TypeDbRedshift):
 		txBytes = procStatsEnd.TxBytes - t.ProcStatsStart.TxBytes
@@ -239,6 +262,14 @@ func (t *TaskExecution) GetBytes() (inBytes, outBytes uint64) {
 func (t *TaskExecution) AppendOutput(ll *g.LogLine) {
 	t.Output.WriteString(ll.Line() + "\n") // add new-line char
 
+	if ll.Level == zerolog.WarnLevel {
+		warning := ll.Text
+		if len(ll.Args) > 0 {
+			warning = g.F(ll.Text, ll.Args...)
+		}
+		t.warnings = append(t.warnings, warning)
+	}
+
 	// push line if not full
 	select {
 	case t.OutputLines <- ll:
@@ -246,6 +277,11 @@ func (t *TaskExecution) AppendOutput(ll *g.LogLine) {
 	}
 }
 
+// Warnings returns the warnings logged during the run
+func (t *TaskExecution) Warnings() []string {
+	return t.warnings
+}
+
 func (t *TaskExecution) GetBytesString() (s string) {
 	inBytes, _ := t.GetBytes()
 	if inBytes == 0 {
@@ -332,10 +368,47 @@ func (t *TaskExecution) setGetMetadata() (metadata iop.Metadata) {
 		metadata.ExecID.Value = t.ExecID
 	}
 
+	if t.Config.MetadataStreamRunID {
+		metadata.StreamRunID.Key = slingStreamRunIDColumn
+		metadata.StreamRunID.Value, _ = t.Config.StreamRunID()
+	}
+
 	if t.Config.MetadataRowNum {
 		metadata.RowNum.Key = slingRowNumColumn
 	}
 
+	// audit columns (`target_options.audit_columns`)
+	auditColumns := g.PtrVal(t.Config.Target.Options).AuditColumns
+	if name := auditColumns.Name("loaded_at"); name != "" {
+		metadata.LoadedAt.Key = name
+		if metadata.LoadedAt.Value == nil {
+			metadata.LoadedAt.Value = *t.StartTime
+		}
+	}
+	if name := auditColumns.Name("run_id"); name != "" {
+		metadata.ExecID.Key = name
+		metadata.ExecID.Value = t.ExecID
+	}
+	if name := auditColumns.Name("stream"); name != "" {
+		metadata.Stream.Key = name
+		metadata.Stream.Value = t.Config.StreamName
+		if t.Config.StreamName == "" {
+			metadata.Stream.Value = t.Config.Source.Stream
+		}
+	}
+	if name := t.Config.rowHashColumn(); name != "" {
+		metadata.RowHash.Key = name
+		if rowHash := g.PtrVal(t.Config.Source.Options).RowHash; rowHash != nil {
+			metadata.RowHash.Value = rowHash.RowHashOptions
+		}
+	}
+
+	// each snapshot is tagged with the start time of the run
+	if t.Config.Mode == SnapshotMode {
+		metadata.SnapshotAt.Key = slingSnapshotAtColumn
+		metadata.SnapshotAt.Value = *t.StartTime
+	}
+
 	// StarRocks: add _sling_row_id column if there is no primary,
 	// duplicate or hash key defined and set as Hash Key
 	if t.Config.TgtConn.Type == dbio.TypeDbStarRocks {
@@ -432,6 +505,16 @@ func (t *TaskExecution) shouldWriteViaDuckDB(uri string) bool {
 		return false
 	}
 
+	// duckdb writes the files directly, without client-side encryption
+	if g.PtrVal(t.Config.Target.Options).Encryption != nil {
+		return false
+	}
+
+	// templated output paths are written by the file writer
+	if filesys.IsTemplatedPath(uri) {
+		return false
+	}
+
 	if g.In(t.Config.Target.ObjectFileFormat(), dbio.FileTypeParquet, dbio.FileTypeCsv) && len(iop.ExtractPartitionFields(uri)) > 0 {
 		return true
 	}
@@ -466,9 +549,36 @@ func (t *TaskExecution) getOptionsMap() (options map[string]any) {
 		// set as string so that StreamProcessor parses it
 		options["transforms"] = g.Marshal(colTransforms)
 	}
+
+	if t.rejectFile != "" {
+		options["reject_file"] = t.rejectFile
+	}
 	return
 }
 
+// resolveEncryptionKeys resolves the encryption key values referencing an
+// env var (`$VAR`) or a secret (`vault://secret/keys#aes`). Only done when
+// creating the file system client, so that keys are not kept in the config.
+func resolveEncryptionKeys(options map[string]any) (err error) {
+	for _, key := range []string{"encryption_key", "encryption_public_key", "encryption_private_key"} {
+		val, ok := options[key].(string)
+		if !ok || val == "" {
+			continue
+		}
+
+		if strings.HasPrefix(val, "$") {
+			if options[key] = os.Getenv(strings.TrimPrefix(val, "$")); options[key] == "" {
+				return g.Error("no env var value found for %s (%s)", val, key)
+			}
+		} else if ref, ok := connection.ParseSecretRef(val); ok {
+			if options[key], err = ref.Resolve(context.Background()); err != nil {
+				return g.Error(err, "could not resolve %s", key)
+			}
+		}
+	}
+	return nil
+}
+
 // apply column casing
 func applyColumnCasingToDf(df *iop.Dataflow, connType dbio.Type, casing *iop.ColumnCasing) {
 
@@ -476,9 +586,14 @@ func applyColumnCasingToDf(df *iop.Dataflow, connType dbio.Type, casing *iop.Col
 		return
 	}
 
-	// convert to target system casing
+	// convert to target system casing, keeping the source name (for the manifest)
 	for i, col := range df.Columns {
-		df.Columns[i].Name = casing.Apply(col.Name, connType)
+		if name := casing.Apply(col.Name, connType); name != col.Name {
+			if col.Metadata[columnSourceNameKey] == "" {
+				df.Columns[i].SetMetadata(columnSourceNameKey, col.Name)
+			}
+			df.Columns[i].Name = name
+		}
 	}
 
 	// propagate names to streams
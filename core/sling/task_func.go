@@ -126,6 +126,13 @@ func insertFromTemp(cfg *Config, tgtConn database.Connection) (err error) {
 		}
 	}
 
+	// with the ignore policy, columns missing in the target are not inserted
+	if g.PtrVal(cfg.Target.Options.ColumnChanges) == ColumnChangesIgnore {
+		tmpColumns = lo.Filter(tmpColumns, func(col iop.Column, i int) bool {
+			return tgtColumns.GetColumn(col.Name) != nil
+		})
+	}
+
 	// TODO: need to validate the source table types are casted
 	// into the target column type
 	tgtCols, err := tgtConn.ValidateColumnNames(
@@ -140,13 +147,13 @@ func insertFromTemp(cfg *Config, tgtConn database.Connection) (err error) {
 
 	srcFields := tgtConn.CastColumnsForSelect(tmpColumns, tgtColumns)
 
-	srcTable, err := database.ParseTableName(cfg.Target.Options.TableTmp, tgtConn.GetType())
+	srcTable, err := database.ParseConnTableName(cfg.Target.Options.TableTmp, tgtConn)
 	if err != nil {
 		err = g.Error(err, "unable to parse tmp table name")
 		return
 	}
 
-	tgtTable, err := database.ParseTableName(cfg.Target.Object, tgtConn.GetType())
+	tgtTable, err := database.ParseConnTableName(cfg.Target.Object, tgtConn)
 	if err != nil {
 		err = g.Error(err, "unable to parse tmp table name")
 		return
@@ -159,6 +166,14 @@ func insertFromTemp(cfg *Config, tgtConn database.Connection) (err error) {
 		"tgt_fields", strings.Join(tgtCols.Names(), ", "),
 		"src_fields", strings.Join(srcFields, ", "),
 	)
+
+	// insert in time order into hypertables, filling the chunks one at a time
+	if ts := cfg.Target.Options.TimeSeries; ts != nil && ts.TimeColumn != "" {
+		if col := tmpColumns.GetColumn(ts.TimeColumn); col != nil {
+			sql = sql + " order by " + tgtConn.Quote(col.Name, false)
+		}
+	}
+
 	_, err = tgtConn.Exec(sql)
 	if err != nil {
 		err = g.Error(err, "Could not execute SQL: "+sql)
@@ -193,29 +208,32 @@ func getIncrementalValueViaDB(cfg *Config, tgtConn database.Connection, srcConnT
 	// in order to get max value
 	// does table exists?
 	// get max value from key_field
-	table, err := database.ParseTableName(cfg.Target.Object, tgtConn.GetType())
+	table, err := database.ParseConnTableName(cfg.Target.Object, tgtConn)
 	if err != nil {
 		err = g.Error(err, "could not parse target table name: %s", cfg.Target.Object)
 		return
 	}
 
 	tgtUpdateKey := cfg.Source.UpdateKey
-	if cc := cfg.Target.Options.ColumnCasing; cc != nil {
-		tgtUpdateKey = cc.Apply(tgtUpdateKey, tgtConn.GetType())
+	if cc, sanitizer := cfg.Target.Options.ColumnCasing, cfg.Target.Options.ColumnSanitizer; cc != nil || sanitizer.Enabled() {
+		if keyColumns := updateKeyColumns(tgtUpdateKey); len(keyColumns) > 0 {
+			for i := range keyColumns {
+				keyColumns[i] = cfg.Target.Options.columnName(keyColumns[i], tgtConn.GetType())
+			}
+			tgtUpdateKey = strings.Join(keyColumns, ",")
+		}
 	}
 
 	// get target columns to match update-key
 	// in case column casing needs adjustment
 	targetCols, _ := pullTargetTableColumns(cfg, tgtConn, false)
-	if updateCol := targetCols.GetColumn(tgtUpdateKey); updateCol != nil && updateCol.Name != "" {
-		tgtUpdateKey = updateCol.Name // overwrite with correct casing
-	} else if len(targetCols) == 0 {
+	if len(targetCols) == 0 {
 		return // target table does not exist
 	}
 
 	sql := g.F(
 		"select max(%s) as max_val from %s",
-		tgtConn.Quote(tgtUpdateKey, false),
+		updateKeyExpr(tgtConn, tgtUpdateKey, targetCols),
 		table.FDQN(),
 	)
 
@@ -248,6 +266,11 @@ func getIncrementalValueViaDB(cfg *Config, tgtConn database.Connection, srcConnT
 		data.Columns[0].Type = iop.DateType // force date type
 	}
 
+	// re-capture late-arriving updates
+	if err = applyLookback(cfg); err != nil {
+		return g.Error(err, "could not apply lookback")
+	}
+
 	cfg.IncrementalValStr = iop.FormatValue(cfg.IncrementalVal, data.Columns[0].Type, srcConnType)
 
 	return
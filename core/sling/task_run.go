@@ -26,15 +26,26 @@ import (
 var connPool = map[string]database.Connection{}
 
 var (
-	start                time.Time
-	slingLoadedAtColumn  = "_sling_loaded_at"
-	slingDeletedAtColumn = "_sling_deleted_at"
-	slingStreamURLColumn = "_sling_stream_url"
-	slingRowNumColumn    = "_sling_row_num"
-	slingRowIDColumn     = "_sling_row_id"
-	slingExecIDColumn    = "_sling_exec_id"
+	start                  time.Time
+	slingLoadedAtColumn    = "_sling_loaded_at"
+	slingDeletedAtColumn   = "_sling_deleted_at"
+	slingStreamURLColumn   = "_sling_stream_url"
+	slingRowNumColumn      = "_sling_row_num"
+	slingRowIDColumn       = "_sling_row_id"
+	slingExecIDColumn      = "_sling_exec_id"
+	slingStreamRunIDColumn = "_sling_stream_run_id"
+	slingSnapshotAtColumn  = "_sling_snapshot_at"
+	slingRunIDColumn       = "_sling_run_id"
+	slingStreamColumn      = "_sling_stream"
+	slingRowHashColumn     = "_sling_row_hash"
+	rowHashColumn          = "_row_hash"
 )
 
+// CancelGracePeriod is how long a cancelled task waits for its in-flight
+// queries to abort, and then for its temp tables and staging files to be
+// removed, before giving up
+var CancelGracePeriod = 30 * time.Second
+
 var deleteMissing func(*TaskExecution, database.Connection, database.Connection) error = func(_ *TaskExecution, _, _ database.Connection) error {
 	g.Warn("use the official release of sling-cli to use delete_missing")
 	return nil
@@ -63,6 +74,13 @@ func (t *TaskExecution) Execute() error {
 		t.Context = g.NewContext(context.Background())
 	}
 
+	// cancel at the end of the stream, replication or run time budget
+	cancelTimeout, err := t.applyTimeout(now)
+	if err != nil && t.Err == nil {
+		t.Err = err
+	}
+	defer cancelTimeout()
+
 	// get stats of process at beginning
 	t.ProcStatsStart = g.GetProcStats(os.Getpid())
 
@@ -71,6 +89,9 @@ func (t *TaskExecution) Execute() error {
 
 	// print for debugging
 	g.Trace("using Config:\n%s", g.Pretty(t.Config))
+	if streamRunID, err := t.Config.StreamRunID(); err == nil {
+		g.Debug("run_id: %s | stream_run_id: %s", t.ExecID, streamRunID)
+	}
 	env.SetTelVal("stage", "2 - task-execution")
 
 	if StoreSet != nil {
@@ -126,17 +147,27 @@ func (t *TaskExecution) Execute() error {
 			return
 		}
 
+		t.prepareRejectSink()
+
 		switch t.Type {
 		case DbSQL:
 			t.Err = t.runDbSQL()
 		case FileToDB:
-			t.Err = t.runFileToDB()
+			if t.Config.usesMicroBatches() {
+				t.Err = t.runMicroBatches(t.runFileToDB)
+			} else {
+				t.Err = t.runFileToDB()
+			}
 		case DbToDb:
 			t.Err = t.runDbToDb()
 		case DbToFile:
 			t.Err = t.runDbToFile()
 		case FileToFile:
-			t.Err = t.runFileToFile()
+			if t.Config.usesMicroBatches() {
+				t.Err = t.runMicroBatches(t.runFileToFile)
+			} else {
+				t.Err = t.runFileToFile()
+			}
 		default:
 			t.SetProgress("task execution configuration is invalid")
 			t.Err = g.Error("Cannot Execute. Task Type is not specified")
@@ -151,18 +182,41 @@ func (t *TaskExecution) Execute() error {
 				}
 			}
 		}
+
+		// warn & load rejected rows
+		if err := t.reportRejects(); err != nil && t.Err == nil {
+			t.Err = err
+		}
+
+		// check the expected volume and duration
+		if t.Err == nil {
+			t.Err = t.checkExpectations()
+		}
 	}()
 
 	select {
 	case <-done:
 		t.Cleanup()
 	case <-t.Context.Ctx.Done():
-		go t.Cleanup()
-
+		// wait for the in-flight queries to abort with the context,
+		// then drop the temp tables and staging files
 		select {
 		case <-done:
-		case <-time.After(5 * time.Second):
+		case <-time.After(CancelGracePeriod):
+			g.Warn("task did not stop within %s after cancellation", CancelGracePeriod)
+		}
+
+		cleaned := make(chan struct{})
+		go func() {
+			defer close(cleaned)
+			t.Cleanup()
+		}()
+		select {
+		case <-cleaned:
+		case <-time.After(CancelGracePeriod):
+			g.Warn("could not clean up temporary artifacts within %s", CancelGracePeriod)
 		}
+
 		if t.Err == nil {
 			t.Err = g.Error("Execution interrupted")
 		}
@@ -175,6 +229,14 @@ func (t *TaskExecution) Execute() error {
 			t.SetProgress("execution succeeded")
 			t.Status = ExecStatusSuccess
 		}
+	} else if timeoutErr := t.timedOut(); timeoutErr != nil {
+		t.SetProgress("execution timed out")
+		t.Status = ExecStatusError
+		t.Err = g.Error(timeoutErr) // the cause of the cancellation errors
+	} else if t.Context.Ctx.Err() != nil {
+		t.SetProgress("execution interrupted")
+		t.Status = ExecStatusInterrupted
+		t.Err = g.Error(t.Err)
 	} else {
 		t.SetProgress("execution failed")
 		t.Status = ExecStatusError
@@ -190,6 +252,7 @@ func (t *TaskExecution) Execute() error {
 
 	now2 := time.Now()
 	t.EndTime = &now2
+	t.cost = g.Ptr(t.Cost())
 
 	// update into store
 	StateSet(t)
@@ -201,6 +264,13 @@ func (t *TaskExecution) Execute() error {
 		}
 	}
 
+	// checkpoint chunked backfill
+	if t.Err == nil && t.Replication != nil && t.Config.Source.Options != nil {
+		if err := t.Replication.CheckpointChunk(t.Config.StreamName, g.PtrVal(t.Config.Source.Options.Range)); err != nil {
+			g.Warn("could not checkpoint chunk: %s", err.Error())
+		}
+	}
+
 	return t.Err
 }
 
@@ -231,6 +301,24 @@ func (t *TaskExecution) GetStateMap() map[string]any {
 		cMap[k] = v
 	}
 
+	// runtime values of the run, e.g. {run.total_rows}
+	bytes, _ := t.GetBytes()
+	cMap["run"] = g.M(
+		"total_rows", t.GetCount(),
+		"total_bytes", bytes,
+		"status", t.Status,
+	)
+
+	// environment variables, e.g. {env.MY_VAR}
+	envMap := g.M()
+	for key, value := range g.KVArrToMap(os.Environ()...) {
+		envMap[key] = value
+	}
+	for key, value := range t.Config.Env {
+		envMap[key] = value
+	}
+	cMap["env"] = envMap
+
 	// flatten with dot separator
 	sMap, err := flat.Flatten(cMap, &flat.Options{Delimiter: ".", Safe: true})
 	if err != nil {
@@ -265,6 +353,8 @@ func (t *TaskExecution) getSrcDBConn(ctx context.Context) (conn database.Connect
 		return
 	}
 
+	t.meterConn(conn)
+
 	// set read_only if sqlite / duckdb since it's a source
 	if g.In(conn.GetType(), dbio.TypeDbSQLite, dbio.TypeDbD1, dbio.TypeDbDuckDb, dbio.TypeDbMotherDuck) {
 		conn.SetProp("read_only", "true")
@@ -294,6 +384,12 @@ func (t *TaskExecution) getTgtDBConn(ctx context.Context) (conn database.Connect
 		err = g.Error(err, "Could not connect to target connection")
 		return
 	}
+	t.meterConn(conn)
+
+	// quoting of the identifiers in the generated SQL, for this connection
+	if quoting := t.Config.Target.Options.IdentifierQuoting; quoting != nil && *quoting != "" {
+		conn.SetProp("identifier_quoting", string(*quoting))
+	}
 
 	// set bulk
 	if val := t.Config.Target.Options.UseBulk; val != nil && !*val {
@@ -446,7 +542,11 @@ func (t *TaskExecution) runFileToDB() (err error) {
 	t.df, err = t.ReadFromFile(t.Config)
 	if err != nil {
 		if strings.Contains(err.Error(), "Provided 0 files") {
-			if t.isIncrementalWithUpdateKey() && t.Config.HasIncrementalVal() && !t.Config.IsFileStreamWithStateAndParts() {
+			if t.usesLedger() {
+				t.SetProgress("no new files found (per file ledger)")
+			} else if t.usesFileWatermark() {
+				t.SetProgress("no new files found (per file watermark)")
+			} else if t.isIncrementalWithUpdateKey() && t.Config.HasIncrementalVal() && !t.Config.IsFileStreamWithStateAndParts() {
 				t.SetProgress("no new files found since latest timestamp (%s)", time.Unix(cast.ToInt64(t.Config.IncrementalValStr), 0))
 			} else {
 				t.SetProgress("no files found")
@@ -471,6 +571,18 @@ func (t *TaskExecution) runFileToDB() (err error) {
 	elapsed := int(time.Since(start).Seconds())
 	t.SetProgress("inserted %d rows into %s in %d secs [%s r/s]", cnt, t.getTargetObjectValue(), elapsed, getRate(cnt))
 
+	if err = t.ledgerRecord(); err != nil {
+		return err
+	}
+
+	if err = t.watermarkRecord(); err != nil {
+		return err
+	}
+
+	if err = t.afterRead(); err != nil {
+		return err
+	}
+
 	if cnt > 0 && t.Config.IsFileStreamWithStateAndParts() {
 		if err = setIncrementalValueViaState(t); err != nil {
 			err = g.Error(err, "Could not set incremental value")
@@ -493,7 +605,11 @@ func (t *TaskExecution) runFileToFile() (err error) {
 	t.df, err = t.ReadFromFile(t.Config)
 	if err != nil {
 		if strings.Contains(err.Error(), "Provided 0 files") {
-			if t.isIncrementalWithUpdateKey() && t.Config.HasIncrementalVal() {
+			if t.usesLedger() {
+				t.SetProgress("no new files found (per file ledger)")
+			} else if t.usesFileWatermark() {
+				t.SetProgress("no new files found (per file watermark)")
+			} else if t.isIncrementalWithUpdateKey() && t.Config.HasIncrementalVal() {
 				t.SetProgress("no new files found since latest timestamp (%s)", time.Unix(cast.ToInt64(t.Config.IncrementalValStr), 0))
 			} else {
 				t.SetProgress("no files found")
@@ -524,7 +640,18 @@ func (t *TaskExecution) runFileToFile() (err error) {
 
 	if t.df.Err() != nil {
 		err = g.Error(t.df.Err(), "Error in runFileToFile")
+		return
+	}
+
+	if err = t.ledgerRecord(); err != nil {
+		return
+	}
+
+	if err = t.watermarkRecord(); err != nil {
+		return
 	}
+
+	err = t.afterRead()
 	return
 }
 
@@ -578,29 +705,62 @@ func (t *TaskExecution) runDbToDb() (err error) {
 		t.Context.Map.Set("incremental_value", t.Config.IncrementalValStr)
 	}
 
-	t.SetProgress("reading from source database")
-	t.df, err = t.ReadFromDB(t.Config, srcConn)
+	pushdown, err := t.usePushdown()
 	if err != nil {
-		err = g.Error(err, "Could not ReadFromDB")
-		return
+		return err
 	}
-	defer t.df.Close()
 
-	// to DirectLoad if possible
-	if t.df.FsURL != "" {
-		data := g.M("url", t.df.FsURL)
-		for k, v := range srcConn.Props() {
-			data[k] = v
+	staging := false
+	if !pushdown {
+		if staging, err = t.useStaging(srcConn, tgtConn); err != nil {
+			return err
 		}
-		t.Config.Source.Data["SOURCE_FILE"] = g.M("data", data)
 	}
 
-	t.SetProgress("writing to target database [mode: %s]", t.Config.Mode)
-	defer t.Cleanup()
-	cnt, err := t.WriteToDb(t.Config, t.df, tgtConn)
-	if err != nil {
-		err = g.Error(err, "Could not WriteToDb")
-		return
+	var cnt uint64
+	if pushdown || staging {
+		// same database, insert on the server. Or unload & load via object store
+		t.SetProgress("writing to target database on the server [mode: %s]", t.Config.Mode)
+		defer t.Cleanup()
+		method := "pushdown"
+		if staging {
+			method = "staging"
+			cnt, err = t.runStaged(srcConn, tgtConn)
+		} else {
+			cnt, err = t.runPushdown(srcConn, tgtConn)
+		}
+		if t.df != nil {
+			defer t.df.Close()
+		}
+		if err != nil {
+			err = g.Error(err, "Could not write with %s", method)
+			return
+		}
+	} else {
+		t.SetProgress("reading from source database")
+		t.df, err = t.ReadFromDB(t.Config, srcConn)
+		if err != nil {
+			err = g.Error(err, "Could not ReadFromDB")
+			return
+		}
+		defer t.df.Close()
+
+		// to DirectLoad if possible
+		if t.df.FsURL != "" {
+			data := g.M("url", t.df.FsURL)
+			for k, v := range srcConn.Props() {
+				data[k] = v
+			}
+			t.Config.Source.Data["SOURCE_FILE"] = g.M("data", data)
+		}
+
+		t.SetProgress("writing to target database [mode: %s]", t.Config.Mode)
+		defer t.Cleanup()
+		cnt, err = t.WriteToDb(t.Config, t.df, tgtConn)
+		if err != nil {
+			err = g.Error(err, "Could not WriteToDb")
+			return
+		}
 	}
 
 	bytesStr := ""
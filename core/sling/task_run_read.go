@@ -2,6 +2,7 @@ package sling
 
 import (
 	"bufio"
+	"io"
 	"os"
 	"strings"
 
@@ -19,11 +20,62 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 
 	setStage("3 - prepare-dataflow")
 
+	sTable, err := t.sourceSelectTable(cfg, srcConn)
+	if err != nil {
+		return t.df, err
+	}
+
+	if pb := cfg.Source.Options.PartitionBy; pb != nil && cfg.Source.Limit() == 0 {
+		df, err = t.readPartitions(srcConn, sTable, pb)
+	} else {
+		if pb != nil {
+			g.Warn("partition_by is ignored when using a limit")
+		}
+		df, err = srcConn.BulkExportFlow(sTable)
+	}
+	if err != nil {
+		err = g.Error(err, "Could not BulkExportFlow")
+		return t.df, err
+	}
+
+	df, err = t.deduplicateDataflow(df)
+	if err != nil {
+		err = g.Error(err, "Could not deduplicate")
+		return t.df, err
+	}
+
+	df, err = t.pythonTransformDataflow(df)
+	if err != nil {
+		err = g.Error(err, "Could not transform with python")
+		return t.df, err
+	}
+
+	df, err = t.wasmTransformDataflow(df)
+	if err != nil {
+		err = g.Error(err, "Could not transform with wasm")
+		return t.df, err
+	}
+
+	err = t.setColumnKeys(df)
+	if err != nil {
+		err = g.Error(err, "Could not set column keys")
+		return t.df, err
+	}
+
+	g.Trace("%#v", df.Columns.Types())
+	setStage("3 - dataflow-stream")
+
+	return
+}
+
+// sourceSelectTable returns the source table, with the select statement of
+// the selected fields, the where condition and the incremental filter
+func (t *TaskExecution) sourceSelectTable(cfg *Config, srcConn database.Connection) (sTable database.Table, err error) {
 	selectFieldsStr := "*"
-	sTable, err := t.GetSourceTable()
+	sTable, err = t.GetSourceTable()
 	if err != nil {
 		err = g.Error(err, "Could not parse source stream text")
-		return t.df, err
+		return sTable, err
 	}
 
 	// get source columns
@@ -33,7 +85,20 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 	sTable.Columns, err = srcConn.GetSQLColumns(st)
 	if err != nil {
 		err = g.Error(err, "Could not get source columns")
-		return t.df, err
+		return sTable, err
+	}
+
+	// get source column comments & constraints to propagate to the target table
+	if cfg.TgtConn.Type.IsDb() && !sTable.IsQuery() && cfg.Target.Options.addColumnDetails() {
+		cols := sTable.Columns.Clone()
+		for i := range cols {
+			cols[i].Metadata = lo.Assign(cols[i].Metadata) // do not alter source columns
+		}
+		if err := database.LoadColumnDetails(srcConn, sTable, cols); err != nil {
+			g.Warn("could not get source column details: %s", err.Error())
+		} else {
+			cfg.Source.columns = cols
+		}
 	}
 
 	if len(cfg.Source.Select) > 0 {
@@ -47,7 +112,7 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 
 		if len(excluded) > 0 {
 			if len(excluded) != len(cfg.Source.Select) {
-				return t.df, g.Error("All specified select columns must be excluded with prefix '-'. Cannot do partial exclude.")
+				return sTable, g.Error("All specified select columns must be excluded with prefix '-'. Cannot do partial exclude.")
 			}
 
 			q := database.GetQualifierQuote(srcConn.GetType())
@@ -62,7 +127,7 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 			})
 
 			if len(includedCols) == 0 {
-				return t.df, g.Error("All available columns were excluded")
+				return sTable, g.Error("All available columns were excluded")
 			}
 			fields = iop.Columns(includedCols).Names()
 		}
@@ -76,16 +141,23 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 
 		// get source columns to match update-key
 		// in case column casing needs adjustment
-		updateCol := sTable.Columns.GetColumn(cfg.Source.UpdateKey)
-		if updateCol != nil && updateCol.Name != "" {
-			cfg.Source.UpdateKey = updateCol.Name // overwrite with correct casing
+		updateCol := &iop.Column{} // unknown for expressions
+		if keyColumns := updateKeyColumns(cfg.Source.UpdateKey); len(keyColumns) > 0 {
+			// the first column sets the type of a composite key watermark
+			if col := sTable.Columns.GetColumn(keyColumns[0]); col != nil && col.Name != "" {
+				updateCol = col
+				if len(keyColumns) == 1 {
+					cfg.Source.UpdateKey = updateCol.Name // overwrite with correct casing
+				}
+			}
 		}
+		updateKey := updateKeyExpr(srcConn, cfg.Source.UpdateKey, sTable.Columns)
 
 		// select only records that have been modified after last max value
 		if cfg.IncrementalValStr != "" {
 			incrementalWhereCond = g.R(
 				srcConn.GetTemplateValue("core.incremental_where"),
-				"update_key", srcConn.Quote(cfg.Source.UpdateKey, false),
+				"update_key", updateKey,
 				"value", cfg.IncrementalValStr,
 				"gt", lo.Ternary(t.Config.IncrementalGTE, ">=", ">"),
 			)
@@ -115,14 +187,14 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 				timestampTemplate := srcConn.GetTemplateValue("variable.timestamp_layout_str")
 				startValue = g.R(timestampTemplate, "value", startValue)
 				endValue = g.R(timestampTemplate, "value", endValue)
-			} else if updateCol.IsString() {
+			} else if _, numErr := cast.ToFloat64E(startValue); updateCol.IsString() || (updateCol.Type == "" && numErr != nil) {
 				startValue = `'` + startValue + `'`
 				endValue = `'` + endValue + `'`
 			}
 
 			incrementalWhereCond = g.R(
 				srcConn.GetTemplateValue("core.backfill_where"),
-				"update_key", srcConn.Quote(cfg.Source.UpdateKey, false),
+				"update_key", updateKey,
 				"start_value", startValue,
 				"end_value", endValue,
 			)
@@ -143,18 +215,18 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 				"fields", selectFieldsStr,
 				"table", sTable.FDQN(),
 				"incremental_where_cond", incrementalWhereCond,
-				"update_key", srcConn.Quote(cfg.Source.UpdateKey, false),
+				"update_key", updateKey,
 			)
 		} else {
 			if g.In(t.Config.Mode, IncrementalMode, BackfillMode) && !(strings.Contains(sTable.SQL, "{incremental_where_cond}") || strings.Contains(sTable.SQL, "{incremental_value}")) {
 				err = g.Error("Since using %s mode + custom SQL, with an `update_key`, the SQL text needs to contain a placeholder: {incremental_where_cond} or {incremental_value}. See https://docs.slingdata.io for help.", t.Config.Mode)
-				return t.df, err
+				return sTable, err
 			}
 
 			sTable.SQL = g.R(
 				sTable.SQL,
 				"incremental_where_cond", incrementalWhereCond,
-				"update_key", srcConn.Quote(cfg.Source.UpdateKey, false),
+				"update_key", updateKey,
 				"incremental_value", cfg.IncrementalValStr,
 			)
 		}
@@ -163,7 +235,7 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 		cfg.Source.Where = g.R(
 			cfg.Source.Where,
 			"incremental_where_cond", incrementalWhereCond,
-			"update_key", srcConn.Quote(cfg.Source.UpdateKey, false),
+			"update_key", updateKey,
 			"incremental_value", cfg.IncrementalValStr,
 		)
 	}
@@ -192,22 +264,26 @@ func (t *TaskExecution) ReadFromDB(cfg *Config, srcConn database.Connection) (df
 		}
 	}
 
-	df, err = srcConn.BulkExportFlow(sTable)
-	if err != nil {
-		err = g.Error(err, "Could not BulkExportFlow")
-		return t.df, err
-	}
+	return sTable, nil
+}
 
-	err = t.setColumnKeys(df)
+// readPartitions splits the source table read into range queries,
+// which are read in parallel into one dataflow
+func (t *TaskExecution) readPartitions(srcConn database.Connection, sTable database.Table, pb *SourcePartitionBy) (df *iop.Dataflow, err error) {
+	var tables []database.Table
+	if pb.IsRowID() && srcConn.GetType() == dbio.TypeDbOracle {
+		tables, err = database.ChunkByRowID(srcConn, sTable, pb.Chunks)
+	} else if len(pb.Ranges) > 0 {
+		tables, err = database.ChunkByRanges(srcConn, sTable, pb.Column, pb.Ranges)
+	} else {
+		tables, err = database.ChunkByColumn(srcConn, sTable, pb.Column, pb.Chunks)
+	}
 	if err != nil {
-		err = g.Error(err, "Could not set column keys")
-		return t.df, err
+		return t.df, g.Error(err, "could not partition source read by column %s", pb.Column)
 	}
 
-	g.Trace("%#v", df.Columns.Types())
-	setStage("3 - dataflow-stream")
-
-	return
+	t.SetProgress("reading %d partitions by column %s", len(tables), pb.Column)
+	return database.BulkExportFlowParallel(srcConn, tables, pb.Concurrency)
 }
 
 // ReadFromFile reads from a source file
@@ -221,6 +297,9 @@ func (t *TaskExecution) ReadFromFile(cfg *Config) (df *iop.Dataflow, err error)
 	var stream *iop.Datastream
 	options := t.getOptionsMap()
 	options["METADATA"] = g.Marshal(metadata)
+	if err = resolveEncryptionKeys(options); err != nil {
+		return t.df, err
+	}
 
 	if t.Config.HasIncrementalVal() && !t.Config.IsFileStreamWithStateAndParts() {
 		// file stream incremental mode
@@ -252,8 +331,13 @@ func (t *TaskExecution) ReadFromFile(cfg *Config) (df *iop.Dataflow, err error)
 			Limit:            cfg.Source.Limit(),
 			SQL:              cfg.Source.Query,
 			FileSelect:       cfg.Source.Options.FileSelect,
+			Concurrency:      g.PtrVal(cfg.Source.Options.ReadConcurrency),
+			SplitSize:        g.PtrVal(cfg.Source.Options.FileSplitSize),
 			IncrementalKey:   cfg.Source.UpdateKey,
 			IncrementalValue: cfg.IncrementalValStr,
+
+			SnapshotID:        g.PtrVal(cfg.Source.Options.SnapshotID),
+			SnapshotTimestamp: g.PtrVal(cfg.Source.Options.SnapshotTimestamp),
 		}
 
 		// format the uri if it has placeholders
@@ -312,14 +396,31 @@ func (t *TaskExecution) ReadFromFile(cfg *Config) (df *iop.Dataflow, err error)
 
 		if ffmt := cfg.Source.Options.Format; ffmt != nil {
 			fsCfg.Format = *ffmt
+		} else if fs.GetProp("iceberg_catalog_type") != "" {
+			fsCfg.Format = dbio.FileTypeIceberg // tables of the catalog
+		}
+
+		// list the files to read, to skip files already loaded (ledger or
+		// watermark), and to process them once loaded (after_read)
+		if (t.usesLedger() || t.usesFileWatermark() || t.usesAfterRead()) && !g.In(fsCfg.Format, dbio.FileTypeIceberg, dbio.FileTypeDelta) && fsCfg.SQL == "" {
+			if count, err := t.selectSourceFiles(fs, uri, &fsCfg); err != nil {
+				return t.df, g.Error(err, "could not select source files")
+			} else if count == 0 {
+				return t.df, g.Error("Provided 0 files for: %s (already loaded per file ledger or watermark)", uri)
+			}
 		}
+
 		df, err = fs.ReadDataflow(uri, fsCfg)
 		if err != nil {
 			err = g.Error(err, "Could not FileSysReadDataflow for %s", cfg.SrcConn.Type)
 			return t.df, err
 		}
 	} else {
-		stream, err = filesys.MakeDatastream(bufio.NewReader(os.Stdin), g.ToMapString(options))
+		var reader io.Reader = os.Stdin
+		if t.stdin != nil {
+			reader = t.stdin // micro-batch
+		}
+		stream, err = filesys.MakeDatastream(bufio.NewReader(reader), g.ToMapString(options))
 		if err != nil {
 			err = g.Error(err, "Could not MakeDatastream")
 			return t.df, err
@@ -338,6 +439,24 @@ func (t *TaskExecution) ReadFromFile(cfg *Config) (df *iop.Dataflow, err error)
 		return df, g.Error("Could not read columns")
 	}
 
+	df, err = t.deduplicateDataflow(df)
+	if err != nil {
+		err = g.Error(err, "Could not deduplicate")
+		return t.df, err
+	}
+
+	df, err = t.pythonTransformDataflow(df)
+	if err != nil {
+		err = g.Error(err, "Could not transform with python")
+		return t.df, err
+	}
+
+	df, err = t.wasmTransformDataflow(df)
+	if err != nil {
+		err = g.Error(err, "Could not transform with wasm")
+		return t.df, err
+	}
+
 	err = t.setColumnKeys(df)
 	if err != nil {
 		err = g.Error(err, "Could not set column keys")
@@ -350,6 +469,59 @@ func (t *TaskExecution) ReadFromFile(cfg *Config) (df *iop.Dataflow, err error)
 	return
 }
 
+// deduplicateDataflow drops the duplicate rows when source_options.deduplicate is enabled
+func (t *TaskExecution) deduplicateDataflow(df *iop.Dataflow) (*iop.Dataflow, error) {
+	so := t.Config.Source.Options
+	if so == nil || !g.PtrVal(so.Deduplicate) {
+		return df, nil
+	}
+
+	keepLast, err := iop.ParseDeduplicateKeep(g.PtrVal(so.DeduplicateKeep))
+	if err != nil {
+		return df, err
+	}
+
+	opts := iop.DeduplicateOptions{
+		Keys:     g.PtrVal(so.DeduplicateKeys),
+		KeepLast: keepLast,
+	}
+	g.Debug("deduplicating rows (keys: %s, keep: %s)", g.Marshal(opts.Keys), lo.Ternary(keepLast, "last", "first"))
+
+	return iop.DeduplicateDataflow(df, opts)
+}
+
+// pythonTransformDataflow transforms the rows with the script of
+// source_options.python_transform
+func (t *TaskExecution) pythonTransformDataflow(df *iop.Dataflow) (*iop.Dataflow, error) {
+	so := t.Config.Source.Options
+	if so == nil || so.PythonTransform == nil {
+		return df, nil
+	}
+
+	pt := so.PythonTransform
+	return iop.PythonTransformDataflow(df, iop.PythonTransformOptions{
+		Script:    pt.Script,
+		Python:    pt.Python,
+		BatchSize: pt.BatchSize,
+		Format:    pt.Format,
+	})
+}
+
+// wasmTransformDataflow transforms the rows with the module of
+// source_options.wasm_transform
+func (t *TaskExecution) wasmTransformDataflow(df *iop.Dataflow) (*iop.Dataflow, error) {
+	so := t.Config.Source.Options
+	if so == nil || so.WasmTransform == nil {
+		return df, nil
+	}
+
+	wt := so.WasmTransform
+	return iop.WasmTransformDataflow(df, iop.WasmTransformOptions{
+		Module:    wt.Module,
+		BatchSize: wt.BatchSize,
+	})
+}
+
 // setColumnKeys sets the column keys
 func (t *TaskExecution) setColumnKeys(df *iop.Dataflow) (err error) {
 	eG := g.ErrorGroup{}
@@ -363,7 +535,7 @@ func (t *TaskExecution) setColumnKeys(df *iop.Dataflow) (err error) {
 	}
 
 	if t.Config.Source.HasUpdateKey() {
-		eG.Capture(df.Columns.SetMetadata(iop.UpdateKey.MetadataKey(), "source", t.Config.Source.UpdateKey))
+		eG.Capture(df.Columns.SetMetadata(iop.UpdateKey.MetadataKey(), "source", updateKeyColumns(t.Config.Source.UpdateKey)...))
 	}
 
 	if tkMap := t.Config.Target.Options.TableKeys; tkMap != nil {
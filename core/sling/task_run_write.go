@@ -12,6 +12,7 @@ import (
 
 	"github.com/dustin/go-humanize"
 	"github.com/flarco/g"
+	"github.com/samber/lo"
 	"github.com/slingdata-io/sling-cli/core/dbio"
 	"github.com/slingdata-io/sling-cli/core/dbio/database"
 	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
@@ -25,6 +26,7 @@ func (t *TaskExecution) WriteToFile(cfg *Config, df *iop.Dataflow) (cnt uint64,
 	var bw int64
 	defer t.PBar.Finish()
 	setStage("5 - load-into-final")
+	setThrottle(cfg, df)
 
 	if uri := cfg.TgtConn.URL(); uri != "" {
 		dateMap := iop.GetISO8601DateMap(time.Now())
@@ -38,6 +40,9 @@ func (t *TaskExecution) WriteToFile(cfg *Config, df *iop.Dataflow) (cnt uint64,
 		// construct props by merging with options
 		options := g.M()
 		g.Unmarshal(g.Marshal(cfg.Target.Options), &options)
+		if err = resolveEncryptionKeys(options); err != nil {
+			return cnt, err
+		}
 		props := append(
 			g.MapToKVArr(cfg.TgtConn.DataS()),
 			g.MapToKVArr(g.ToMapString(options))...,
@@ -60,10 +65,19 @@ func (t *TaskExecution) WriteToFile(cfg *Config, df *iop.Dataflow) (cnt uint64,
 			} else {
 				bw, err = filesys.WriteDataflowViaDuckDB(fs, df, uri)
 			}
+		} else if len(iop.ExtractPartitionFields(uri)) > 0 {
+			// partition by the update key, with the file writer
+			if !isSimpleUpdateKey(cfg.Source.UpdateKey) {
+				return cnt, g.Error("missing update_key in order to partition")
+			}
+			bw, err = filesys.WriteDataflowPartitioned(fs, df, uri, cfg.Source.UpdateKey)
 		} else {
 			bw, err = filesys.WriteDataflow(fs, df, uri)
 		}
 		if err != nil {
+			if t.Context.Ctx.Err() != nil {
+				removePartialFiles(uri, props)
+			}
 			err = g.Error(err, "Could not write")
 			return cnt, err
 		}
@@ -150,6 +164,7 @@ func (t *TaskExecution) WriteToFile(cfg *Config, df *iop.Dataflow) (cnt uint64,
 // insert / incremental / replace into target table
 func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn database.Connection) (cnt uint64, err error) {
 	defer t.PBar.Finish()
+	setThrottle(cfg, df)
 
 	// Detect empty columns
 	if len(df.Columns) == 0 {
@@ -157,6 +172,11 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		return 0, err
 	}
 
+	// write points / graph elements / plugin records (no tables)
+	if g.In(tgtConn.GetType(), dbio.TypeDbInfluxDB, dbio.TypeDbNeo4j, dbio.TypeDbPlugin) {
+		return t.writeToSchemaless(cfg, df, tgtConn)
+	}
+
 	// write directly to the final table (no temp table)
 	if directInsert := cast.ToBool(os.Getenv("SLING_DIRECT_INSERT")); directInsert {
 		if g.In(cfg.Mode, IncrementalMode, BackfillMode) && len(cfg.Source.PrimaryKey()) > 0 {
@@ -208,8 +228,9 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		return 0, err
 	}
 
-	// Create temp table
-	if err := createTable(t, tgtConn, tableTmp, sampleData, true); err != nil {
+	// Create temp table. When swapped in, it is created as the final table.
+	swap := cfg.Target.Options.commitStrategy() == CommitStrategyAtomicSwap
+	if err := createTable(t, tgtConn, tableTmp, sampleData, !swap); err != nil {
 		err = g.Error(err, "could not create table "+tableTmp.FullName())
 		return 0, err
 	}
@@ -219,6 +240,12 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 	df.Columns = sampleData.Columns
 	setStage("4 - load-into-temp")
 
+	// record the temp table, to be removed by `sling cleanup` if orphaned
+	tempTable := TempTable{Conn: cfg.TgtConn.Name, Name: tableTmp.FullName(), CreatedAt: time.Now()}
+	if err := TempTableSet(tempTable); err != nil {
+		g.Debug("could not record temp table %s: %s", tempTable.Name, err.Error())
+	}
+
 	// Add cleanup task for temp table
 	t.AddCleanupTaskFirst(func() {
 		if cast.ToBool(os.Getenv("SLING_KEEP_TEMP")) {
@@ -232,7 +259,11 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 				conn.Connect()
 			}
 		}
-		g.LogError(conn.DropTable(tableTmp.FullName()))
+		if err := conn.DropTable(tableTmp.FullName()); err != nil {
+			g.LogError(err)
+		} else if err = TempTableDelete(tempTable.Conn, tempTable.Name); err != nil {
+			g.Debug("could not delete record of temp table %s: %s", tempTable.Name, err.Error())
+		}
 		conn.Close()
 	})
 
@@ -290,17 +321,7 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		}
 	}
 
-	// Execute pre-SQL
-	if err := executeSQL(t, tgtConn, cfg.Target.Options.PreSQL, "pre"); err != nil {
-		err = g.Error(err, "Error executing %s-sql", "pre")
-		return 0, err
-	}
-
-	// Handle empty data case
-	if cnt == 0 && !cast.ToBool(os.Getenv("SLING_ALLOW_EMPTY_TABLES")) && !cast.ToBool(os.Getenv("SLING_ALLOW_EMPTY")) {
-		g.Warn("no data or records found in stream. Nothing to do. To allow Sling to create empty tables, set SLING_ALLOW_EMPTY=TRUE")
-		return 0, nil
-	} else if cnt > 0 {
+	if cnt > 0 {
 		// FIXME: find root cause of why columns don't sync while streaming
 		df.SyncColumns()
 
@@ -317,6 +338,26 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		}
 	}
 
+	return t.commitTempTable(cfg, tgtConn, tableTmp, targetTable, df, cnt)
+}
+
+// commitTempTable runs the pre-sql, and writes the rows loaded in the temp
+// table into the target table, in a transaction
+func (t *TaskExecution) commitTempTable(cfg *Config, tgtConn database.Connection, tableTmp, targetTable database.Table, df *iop.Dataflow, cnt uint64) (_ uint64, err error) {
+	swap := cfg.Target.Options.commitStrategy() == CommitStrategyAtomicSwap
+
+	// Execute pre-SQL
+	if err := executeSQL(t, tgtConn, cfg.Target.Options.PreSQL, "pre"); err != nil {
+		err = g.Error(err, "Error executing %s-sql", "pre")
+		return 0, err
+	}
+
+	// Handle empty data case
+	if cnt == 0 && !cast.ToBool(os.Getenv("SLING_ALLOW_EMPTY_TABLES")) && !cast.ToBool(os.Getenv("SLING_ALLOW_EMPTY")) {
+		g.Warn("no data or records found in stream. Nothing to do. To allow Sling to create empty tables, set SLING_ALLOW_EMPTY=TRUE")
+		return 0, nil
+	}
+
 	// need to contain the final write in a transcation after data is loaded
 
 	txOptions := determineTxOptions(tgtConn.GetType())
@@ -329,8 +370,20 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 
 	setStage("5 - prepare-final")
 
-	// Prepare final table operations
-	if err = prepareFinal(t, cfg, tgtConn, targetTable, df); err != nil {
+	if swap {
+		// Check the target schema, then replace the final table with the loaded temp table
+		if err = prepareSwap(cfg, tgtConn, targetTable, df); err != nil {
+			err = g.Error(err, "error preparing final table")
+			return 0, err
+		}
+		setStage("5 - load-into-final")
+		if err := swapTables(tgtConn, tableTmp, targetTable); err != nil {
+			err = g.Error(err, "error swapping temp table into final table")
+			return 0, err
+		}
+		t.SetProgress("swapped %s into %s", tableTmp.FullName(), targetTable.FullName())
+	} else if err = prepareFinal(t, cfg, tgtConn, targetTable, df); err != nil {
+		// Prepare final table operations
 		err = g.Error(err, "error preparing final table")
 		return 0, err
 	}
@@ -339,13 +392,21 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 	setStage("5 - load-into-final")
 
 	// Transfer data from temp to final table
-	if cnt == 0 {
+	if swap {
+		// already in the final table
+	} else if cnt == 0 {
 		t.SetProgress("0 rows inserted. Nothing to do.")
 	} else if err := transferData(cfg, tgtConn, tableTmp, targetTable); err != nil {
 		err = g.Error(err, "error transferring data from temp to final table")
 		return 0, err
 	}
 
+	// Prune the previous snapshots
+	if err := pruneSnapshots(t, cfg, tgtConn, targetTable); err != nil {
+		err = g.Error(err, "error pruning snapshots")
+		return 0, err
+	}
+
 	// Execute post-SQL
 	if err := executeSQL(t, tgtConn, cfg.Target.Options.PostSQL, "post"); err != nil {
 		err = g.Error(err, "error executing %s-sql", "post")
@@ -364,6 +425,9 @@ func (t *TaskExecution) WriteToDb(cfg *Config, df *iop.Dataflow, tgtConn databas
 		return cnt, err
 	}
 
+	// Optimize the final table (outside of the transaction)
+	optimizeTable(t, cfg, tgtConn, targetTable)
+
 	setStage("6 - closing")
 
 	return cnt, nil
@@ -488,6 +552,11 @@ func (t *TaskExecution) writeToDbDirectly(cfg *Config, df *iop.Dataflow, tgtConn
 		g.Warn("no data or records found in stream. Nothing to insert.")
 	}
 
+	// Prune the previous snapshots
+	if err := pruneSnapshots(t, cfg, tgtConn, targetTable); err != nil {
+		return cnt, g.Error(err, "error pruning snapshots")
+	}
+
 	// Execute post-SQL
 	if err := executeSQL(t, tgtConn, cfg.Target.Options.PostSQL, "post"); err != nil {
 		return cnt, err
@@ -499,6 +568,9 @@ func (t *TaskExecution) writeToDbDirectly(cfg *Config, df *iop.Dataflow, tgtConn
 		return cnt, err
 	}
 
+	// Optimize the final table
+	optimizeTable(t, cfg, tgtConn, targetTable)
+
 	setStage("6 - closing")
 	return cnt, nil
 }
@@ -514,8 +586,59 @@ func determineTxOptions(dbType dbio.Type) sql.TxOptions {
 	}
 }
 
+// writeToSchemaless writes the rows into a target without tables: as points
+// of the measurement (influxdb), or as nodes / relationships (neo4j) merged on
+// the primary key. Full-refresh & truncate delete the existing points, nodes
+// or relationships first.
+func (t *TaskExecution) writeToSchemaless(cfg *Config, df *iop.Dataflow, tgtConn database.Connection) (cnt uint64, err error) {
+	targetTable, err := database.ParseConnTableName(cfg.Target.Object, tgtConn)
+	if err != nil {
+		return 0, g.Error(err, "could not parse object table name")
+	}
+
+	// Pause dataflow to map the columns
+	if paused := df.Pause(); !paused {
+		err = g.Error(err, "could not pause streams to infer columns")
+		return 0, err
+	}
+
+	sampleData, err := prepareDataflow(t, df, tgtConn)
+	if err != nil {
+		return 0, err
+	}
+	df.Columns = sampleData.Columns
+	setStage("5 - load-into-final")
+
+	// the key properties of the nodes / relationships
+	if pk := cfg.Source.PrimaryKey(); len(pk) > 0 {
+		keys := make([]string, len(pk))
+		for i := range pk {
+			keys[i] = cfg.Target.Options.columnName(pk[i], tgtConn.GetType())
+		}
+		tgtConn.SetProp("primary_key", strings.Join(keys, ","))
+	}
+
+	if g.In(cfg.Mode, FullRefreshMode, TruncateMode) {
+		if err = tgtConn.DropTable(targetTable.FullName()); err != nil {
+			return 0, g.Error(err, "could not delete existing data of "+targetTable.FullName())
+		}
+	}
+
+	df.Unpause() // Resume dataflow
+	t.SetProgress("streaming data (schemaless)")
+
+	cnt, err = tgtConn.BulkImportFlow(targetTable.FullName(), df)
+	if err != nil {
+		return 0, g.Error(err, "could not write into "+targetTable.FullName())
+	}
+
+	setStage("6 - closing")
+
+	return cnt, nil
+}
+
 func initializeTargetTable(cfg *Config, tgtConn database.Connection) (database.Table, error) {
-	targetTable, err := database.ParseTableName(cfg.Target.Object, tgtConn.GetType())
+	targetTable, err := database.ParseConnTableName(cfg.Target.Object, tgtConn)
 	if err != nil {
 		return database.Table{}, g.Error(err, "could not parse object table name")
 	}
@@ -543,11 +666,12 @@ func initializeTargetTable(cfg *Config, tgtConn database.Connection) (database.T
 	return targetTable, nil
 }
 
-func makeTempTableName(connType dbio.Type, base database.Table, suffix string) (tableTmp database.Table) {
+func makeTempTableName(connType dbio.Type, base database.Table, prefix, suffix string) (tableTmp database.Table) {
 	tableTmp = base
 
 	// tmp table name normalization to not have mixed case
-	tableTmp.Name = strings.ToLower(tableTmp.Name)
+	tableTmp.Name = strings.ToLower(prefix + tableTmp.Name)
+	suffix = strings.ToLower(suffix)
 	if connType.DBNameUpperCase() {
 		tableTmp.Name = strings.ToUpper(tableTmp.Name)
 		suffix = strings.ToUpper(suffix)
@@ -573,14 +697,15 @@ func initializeTempTable(cfg *Config, tgtConn database.Connection, targetTable d
 	var err error
 
 	if cfg.Target.Options.TableTmp == "" {
-		tableTmp, err = database.ParseTableName(cfg.Target.Object, tgtConn.GetType())
+		tableTmp, err = database.ParseConnTableName(cfg.Target.Object, tgtConn)
 		if err != nil {
 			return database.Table{}, g.Error(err, "could not parse object table name")
 		}
-		tableTmp = makeTempTableName(tgtConn.GetType(), tableTmp, "_tmp")
+		prefix, suffix := cfg.Target.Options.tempTableAffixes()
+		tableTmp = makeTempTableName(tgtConn.GetType(), tableTmp, prefix, suffix)
 		cfg.Target.Options.TableTmp = tableTmp.FullName()
 	} else {
-		tableTmp, err = database.ParseTableName(cfg.Target.Options.TableTmp, tgtConn.GetType())
+		tableTmp, err = database.ParseConnTableName(cfg.Target.Options.TableTmp, tgtConn)
 		if err != nil {
 			return database.Table{}, g.Error(err, "could not parse temp table name")
 		}
@@ -611,12 +736,69 @@ func dropTableIfExists(tgtConn database.Connection, tableName string) error {
 }
 
 func createTable(t *TaskExecution, tgtConn database.Connection, table database.Table, sampleData iop.Dataset, isTemp bool) error {
+	if !isTemp {
+		sampleData.Columns = applySourceColumnDetails(t.Config, sampleData.Columns)
+	}
+
 	created, err := createTableIfNotExists(tgtConn, sampleData, &table, isTemp)
 	if err != nil {
 		return g.Error(err, "could not create table "+table.FullName())
 	}
 	if created {
 		t.SetProgress("created table %s", table.FullName())
+		if !isTemp {
+			if err = commentColumns(t.Config, tgtConn, table, sampleData.Columns); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applySourceColumnDetails sets the NOT NULL and primary key constraints
+// on the columns used to create the target table, as specified in the target options
+func applySourceColumnDetails(cfg *Config, cols iop.Columns) iop.Columns {
+	options := cfg.Target.Options
+	if !options.addColumnDetails() {
+		return cols
+	}
+
+	pkKey := iop.PrimaryKey.MetadataKey()
+	cols = cols.Clone()
+	for i := range cols {
+		cols[i].Metadata = lo.Assign(cols[i].Metadata)
+
+		srcCol := cfg.Source.columns.GetColumn(cols[i].Name)
+		if g.PtrVal(options.AddNotNull) && srcCol != nil && srcCol.IsNotNull() {
+			cols[i].SetMetadata("not_null", "true")
+		}
+
+		// source primary keys are flagged with value `source`
+		isSourcePK := cols[i].Metadata[pkKey] == "source" || (srcCol != nil && srcCol.Metadata[pkKey] == "source")
+		if g.PtrVal(options.AddPrimaryKey) && isSourcePK {
+			cols[i].SetMetadata(pkKey, "true")
+		}
+	}
+
+	return cols
+}
+
+// commentColumns sets the source column comments on the newly created target table
+func commentColumns(cfg *Config, tgtConn database.Connection, table database.Table, cols iop.Columns) error {
+	if !g.PtrVal(cfg.Target.Options.AddColumnComments) || len(cfg.Source.columns) == 0 {
+		return nil
+	}
+
+	commentCols := iop.Columns{}
+	for _, col := range cols {
+		if srcCol := cfg.Source.columns.GetColumn(col.Name); srcCol != nil && srcCol.Description != "" {
+			col.Description = srcCol.Description
+			commentCols = append(commentCols, col)
+		}
+	}
+
+	if err := database.CommentColumns(tgtConn, table, commentCols); err != nil {
+		return g.Error(err, "could not add column comments")
 	}
 	return nil
 }
@@ -653,8 +835,24 @@ func configureColumnHandlers(t *TaskExecution, cfg *Config, df *iop.Dataflow, tg
 		}
 	}
 
-	// set OnColumnAdded handler if adding new columns is enabled
-	if cfg.Target.Options.AddNewColumns != nil && *cfg.Target.Options.AddNewColumns {
+	// with the error policy, fail on new columns if the target table exists
+	columnChanges := g.PtrVal(cfg.Target.Options.ColumnChanges)
+	if columnChanges == ColumnChangesError {
+		targetExists, err := database.TableExists(tgtConn, cfg.Target.Object)
+		if err != nil {
+			return g.Error(err, "could not check if table exists: %s", cfg.Target.Object)
+		} else if targetExists {
+			df.OnColumnAdded = func(col iop.Column) error {
+				return g.Error("new column '%s' detected in stream (column_changes: error)", col.Name)
+			}
+			return nil
+		}
+	}
+
+	// set OnColumnAdded handler if adding new columns is enabled.
+	// with the ignore policy, the column is only added to the temp table
+	addNewColumns := cfg.Target.Options.AddNewColumns != nil && *cfg.Target.Options.AddNewColumns
+	if addNewColumns || g.In(columnChanges, ColumnChangesIgnore, ColumnChangesError) {
 		df.OnColumnAdded = func(col iop.Column) error {
 
 			// sleep to allow transaction to close
@@ -663,7 +861,7 @@ func configureColumnHandlers(t *TaskExecution, cfg *Config, df *iop.Dataflow, tg
 			// df.Context.Lock()
 			// defer df.Context.Unlock()
 
-			ok, err := tgtConn.AddMissingColumns(table, iop.Columns{col})
+			ok, err := tgtConn.AddMissingColumns(table, applyColumnDefaults(cfg, iop.Columns{col}))
 			if err != nil {
 				return g.Error(err, "could not add missing columns")
 			}
@@ -679,6 +877,67 @@ func configureColumnHandlers(t *TaskExecution, cfg *Config, df *iop.Dataflow, tg
 	return nil
 }
 
+// checkColumnChanges returns an error if the source columns were added, removed
+// or changed type compared to the existing target table
+func checkColumnChanges(tgtConn database.Connection, table database.Table, srcColumns iop.Columns) (err error) {
+	table.Columns, err = tgtConn.GetSQLColumns(table)
+	if err != nil {
+		return g.Error(err, "could not get table columns for %s", table.FullName())
+	}
+
+	changes := []string{}
+	if added := table.Columns.GetMissing(srcColumns...); len(added) > 0 {
+		changes = append(changes, g.F("added: %s", strings.Join(added.Names(), ", ")))
+	}
+	if removed := srcColumns.GetMissing(table.Columns...); len(removed) > 0 {
+		changes = append(changes, g.F("removed: %s", strings.Join(removed.Names(), ", ")))
+	}
+
+	// detect type changes that would require altering the table
+	common := iop.Columns{}
+	for _, col := range srcColumns {
+		if table.Columns.GetColumn(col.Name) != nil {
+			common = append(common, col)
+		}
+	}
+
+	tableCopy := table
+	tableCopy.Columns = table.Columns.Clone()
+	if ok, _, err := database.GetOptimizeTableStatements(tgtConn, &tableCopy, common, false); err != nil {
+		return g.Error(err, "could not compare column types for %s", table.FullName())
+	} else if ok {
+		changed := []string{}
+		for i, col := range table.Columns {
+			if newType := tableCopy.Columns[i].Type; newType != col.Type {
+				changed = append(changed, g.F("%s (%s => %s)", col.Name, col.Type, newType))
+			}
+		}
+		changes = append(changes, g.F("type changed: %s", strings.Join(changed, ", ")))
+	}
+
+	if len(changes) > 0 {
+		return g.Error("column changes detected for %s (column_changes: error)\n%s", table.FullName(), strings.Join(changes, "\n"))
+	}
+	return nil
+}
+
+// applyColumnDefaults sets the default values provided in the columns config,
+// used to backfill existing rows when columns are added to the target table
+func applyColumnDefaults(cfg *Config, cols iop.Columns) iop.Columns {
+	cfgCols := cfg.ColumnsPrepared()
+	if len(cfgCols) == 0 {
+		return cols
+	}
+
+	cols = cols.Clone()
+	for i, col := range cols {
+		if cfgCol := cfgCols.GetColumn(col.Name); cfgCol != nil && cfgCol.Default != nil {
+			cols[i].Default = cfgCol.Default
+		}
+	}
+	return cols
+}
+
 func prepareDataflow(t *TaskExecution, df *iop.Dataflow, tgtConn database.Connection) (iop.Dataset, error) {
 
 	// if final target column is string and source col is uuid, we need to match type
@@ -696,8 +955,9 @@ func prepareDataflow(t *TaskExecution, df *iop.Dataflow, tgtConn database.Connec
 		}
 	}
 
-	// apply column casing
+	// apply column casing & sanitation
 	applyColumnCasingToDf(df, tgtConn.GetType(), t.Config.Target.Options.ColumnCasing)
+	applyColumnSanitizerToDf(df, tgtConn.GetType(), t.Config.Target.Options.ColumnSanitizer)
 
 	sampleData := df.BufferDataset()
 	if !sampleData.Inferred {
@@ -717,15 +977,18 @@ func prepareFinal(
 	df *iop.Dataflow,
 ) error {
 
-	// Handle Full Refresh Mode: Drop the target table if it exists
-	if cfg.Mode == FullRefreshMode {
+	// Handle Full Refresh Mode: Drop the target table if it exists,
+	// unless the commit strategy keeps it
+	strategy := cfg.Target.Options.commitStrategy()
+	dropped := cfg.Mode == FullRefreshMode && !g.In(strategy, CommitStrategyTruncateInsert, CommitStrategyAppendOnly)
+	if dropped {
 		if err := tgtConn.DropTable(targetTable.FullName()); err != nil {
 			return g.Error(err, "could not drop table "+targetTable.FullName())
 		}
 	}
 
 	// Create the target table if it does not exist
-	sample := iop.NewDataset(df.Columns)
+	sample := iop.NewDataset(applySourceColumnDetails(cfg, df.Columns))
 	sample.Rows = df.Buffer
 	sample.Inferred = true // already inferred with SyncStats
 
@@ -734,7 +997,10 @@ func prepareFinal(
 		return g.Error(err, "could not create table "+targetTable.FullName())
 	} else if created {
 		t.SetProgress("created table %s", targetTable.FullName())
-	} else if cfg.Mode == TruncateMode {
+		if err := commentColumns(cfg, tgtConn, targetTable, sample.Columns); err != nil {
+			return err
+		}
+	} else if cfg.Mode == TruncateMode || (cfg.Mode == FullRefreshMode && strategy == CommitStrategyTruncateInsert) {
 		// Truncate table since it exists
 		if err := truncateTable(t, tgtConn, targetTable.FullName()); err != nil {
 			return err
@@ -742,11 +1008,18 @@ func prepareFinal(
 		t.SetProgress("truncated table %s", targetTable.FullName())
 	}
 
-	// If the table wasn't created and we're not in Full Refresh Mode, handle schema updates
-	if !created && cfg.Mode != FullRefreshMode {
+	// If the table wasn't created nor dropped, handle schema updates
+	if !created && !dropped {
+		// Fail if the source schema differs from the target with the error policy
+		if g.PtrVal(cfg.Target.Options.ColumnChanges) == ColumnChangesError {
+			if err := checkColumnChanges(tgtConn, targetTable, sample.Columns); err != nil {
+				return err
+			}
+		}
+
 		// Add missing columns if the option is enabled
 		if cfg.Target.Options.AddNewColumns != nil && *cfg.Target.Options.AddNewColumns {
-			if ok, err := tgtConn.AddMissingColumns(targetTable, sample.Columns); err != nil {
+			if ok, err := tgtConn.AddMissingColumns(targetTable, applyColumnDefaults(cfg, sample.Columns)); err != nil {
 				return g.Error(err, "could not add missing columns")
 			} else if ok {
 				if targetTable.Columns, err = pullTargetTableColumns(cfg, tgtConn, true); err != nil {
@@ -795,7 +1068,8 @@ func transferData(cfg *Config, tgtConn database.Connection, tableTmp, targetTabl
 		return transferBySwappingTables(tgtConn, tableTmp, targetTable)
 	}
 
-	if (cfg.Mode == IncrementalMode && len(cfg.Source.PrimaryKey()) == 0) || cfg.Mode == SnapshotMode || cfg.Mode == FullRefreshMode || cfg.Mode == TruncateMode {
+	appendOnly := cfg.Target.Options.commitStrategy() == CommitStrategyAppendOnly
+	if (cfg.Mode == IncrementalMode && len(cfg.Source.PrimaryKey()) == 0) || cfg.Mode == SnapshotMode || cfg.Mode == FullRefreshMode || cfg.Mode == TruncateMode || appendOnly {
 		// insert directly
 		if err := insertFromTemp(cfg, tgtConn); err != nil {
 			err = g.Error(err, "could not insert from temp")
@@ -827,6 +1101,97 @@ func transferBySwappingTables(tgtConn database.Connection, tableTmp, targetTable
 	return nil
 }
 
+// prepareSwap runs the checks of prepareFinal which apply to a swapped table.
+// The column comments are set when the temp table is created (as the final table),
+// and only the truncate mode keeps the schema of an existing target table.
+func prepareSwap(cfg *Config, tgtConn database.Connection, targetTable database.Table, df *iop.Dataflow) error {
+	if cfg.Mode != TruncateMode || g.PtrVal(cfg.Target.Options.ColumnChanges) != ColumnChangesError {
+		return nil
+	}
+
+	exists, err := database.TableExists(tgtConn, targetTable.FullName())
+	if err != nil {
+		return g.Error(err, "could not check if table exists: %s", targetTable.FullName())
+	} else if !exists {
+		return nil
+	}
+
+	// Fail if the source schema differs from the target with the error policy
+	return checkColumnChanges(tgtConn, targetTable, applySourceColumnDetails(cfg, df.Columns))
+}
+
+// swapTables replaces the target table with the loaded temp table, so that
+// readers never see a half-loaded table (commit_strategy: atomic_swap). The
+// previous target table is dropped. Only postgres, greenplum, redshift, sqlite
+// and duckdb run the renames in the open transaction; on snowflake and
+// mysql / mariadb / tidb the DDL commits implicitly, the tables being
+// exchanged in a single atomic statement.
+func swapTables(tgtConn database.Connection, tableTmp, targetTable database.Table) (err error) {
+	if !strings.EqualFold(tableTmp.Schema, targetTable.Schema) {
+		return g.Error("temp table %s must be in the same schema as %s to be swapped", tableTmp.FullName(), targetTable.FullName())
+	}
+
+	exists, err := database.TableExists(tgtConn, targetTable.FullName())
+	if err != nil {
+		return g.Error(err, "could not check if table exists: %s", targetTable.FullName())
+	}
+
+	g.Debug("swapping temp table %s with target table %s", tableTmp.FullName(), targetTable.FullName())
+	for _, sql := range swapTablesSQL(tgtConn, tableTmp, targetTable, exists) {
+		if _, err = tgtConn.Exec(sql); err != nil {
+			return g.Error(err, "could not swap tables %s to %s", tableTmp.FullName(), targetTable.FullName())
+		}
+	}
+
+	return nil
+}
+
+// swapTablesSQL returns the statements swapping the temp table with the
+// target table, per database
+func swapTablesSQL(tgtConn database.Connection, tableTmp, targetTable database.Table, exists bool) (sqls []string) {
+	// the previous target table is renamed to a backup, then dropped
+	backup := targetTable
+	backup.Name = backup.Name + lo.Ternary(strings.ToUpper(backup.Name) == backup.Name, "_OLD", "_old")
+
+	switch tgtConn.GetType() {
+	case dbio.TypeDbSnowflake:
+		if exists {
+			// the temp table ends up with the previous data, and is dropped on cleanup
+			sqls = append(sqls, g.F("alter table %s swap with %s", targetTable.FullName(), tableTmp.FullName()))
+		} else {
+			sqls = append(sqls, g.F("alter table %s rename to %s", tableTmp.FullName(), targetTable.FullName()))
+		}
+	case dbio.TypeDbMySQL, dbio.TypeDbMariaDB, dbio.TypeDbTiDB:
+		// DDL is not transactional, but a multi-table rename is atomic
+		if exists {
+			sqls = append(sqls,
+				g.F("rename table %s to %s, %s to %s", targetTable.FullName(), backup.FullName(), tableTmp.FullName(), targetTable.FullName()),
+				g.F("drop table %s", backup.FullName()),
+			)
+		} else {
+			sqls = append(sqls, g.F("rename table %s to %s", tableTmp.FullName(), targetTable.FullName()))
+		}
+	default:
+		// transactional DDL (postgres, greenplum, redshift, sqlite, duckdb)
+		if exists {
+			sqls = append(sqls, g.F("alter table %s rename to %s", targetTable.FullName(), backup.NameQ()))
+		}
+		sqls = append(sqls, g.F("alter table %s rename to %s", tableTmp.FullName(), targetTable.NameQ()))
+		if exists {
+			sqls = append(sqls, g.F("drop table %s", backup.FullName()))
+		}
+		if g.In(tgtConn.GetType(), dbio.TypeDbPostgres, dbio.TypeDbGreenplum) {
+			// keep the primary key index name of the target table
+			sqls = append(sqls, g.F(
+				"alter index if exists %s.%s rename to %s",
+				tableTmp.SchemaQ(), tgtConn.Quote(tableTmp.Name+"_pkey"), tgtConn.Quote(targetTable.Name+"_pkey"),
+			))
+		}
+	}
+
+	return sqls
+}
+
 func truncateTable(t *TaskExecution, tgtConn database.Connection, tableName string) error {
 	truncSQL := g.R(
 		tgtConn.GetTemplateValue("core.truncate_table"),
@@ -885,7 +1250,7 @@ func writeDataflowViaTempDuckDB(t *TaskExecution, df *iop.Dataflow, fs filesys.F
 		Format:             t.Config.Target.ObjectFileFormat(),
 		Compression:        g.PtrVal(t.Config.Target.Options.Compression),
 		PartitionFields:    iop.ExtractPartitionFields(uri),
-		PartitionKey:       t.Config.Source.UpdateKey,
+		PartitionKey:       lo.Ternary(isSimpleUpdateKey(t.Config.Source.UpdateKey), t.Config.Source.UpdateKey, ""),
 		WritePartitionCols: true,
 		FileSizeBytes:      g.PtrVal(t.Config.Target.Options.FileMaxBytes),
 	}
@@ -945,11 +1310,42 @@ func writeDataflowViaTempDuckDB(t *TaskExecution, df *iop.Dataflow, fs filesys.F
 
 func performUpsert(tgtConn database.Connection, tableTmp, targetTable database.Table, cfg *Config) error {
 	tgtPrimaryKey := cfg.Source.PrimaryKey()
-	if casing := cfg.Target.Options.ColumnCasing; casing != nil {
+	if casing, sanitizer := cfg.Target.Options.ColumnCasing, cfg.Target.Options.ColumnSanitizer; casing != nil || sanitizer.Enabled() {
 		for i, pk := range tgtPrimaryKey {
-			tgtPrimaryKey[i] = casing.Apply(pk, tgtConn.GetType())
+			tgtPrimaryKey[i] = cfg.Target.Options.columnName(pk, tgtConn.GetType())
+		}
+
+		// apply casing to the columns to update as well
+		for key, cols := range map[string]*[]string{
+			"update_columns":        cfg.Target.Options.UpdateColumns,
+			"ignore_update_columns": cfg.Target.Options.IgnoreUpdateColumns,
+		} {
+			if cols == nil {
+				continue
+			}
+			tgtCols := make([]string, len(*cols))
+			for i, col := range *cols {
+				tgtCols[i] = cfg.Target.Options.columnName(col, tgtConn.GetType())
+			}
+			tgtConn.SetProp(key, g.Marshal(tgtCols))
+		}
+	}
+	// user-provided merge statement, instead of the generated upsert
+	if mergeSQL := cfg.Target.Options.MergeSQL; mergeSQL != nil && *mergeSQL != "" {
+		sql, err := GetSQLText(*mergeSQL)
+		if err != nil {
+			return g.Error(err, "could not get merge-sql body")
+		}
+		tgtConn.SetProp("merge_sql", sql)
+	}
+
+	// only merge the changed rows, comparing the row hashes
+	if cfg.IncrementalByHash() {
+		if err := deleteUnchangedRows(tgtConn, tableTmp, targetTable, tgtPrimaryKey, cfg); err != nil {
+			return err
 		}
 	}
+
 	g.Debug("performing upsert from temporary table %s to target table %s with primary keys %v",
 		tableTmp.FullName(), targetTable.FullName(), tgtPrimaryKey)
 	rowAffCnt, err := tgtConn.Upsert(tableTmp.FullName(), targetTable.FullName(), tgtPrimaryKey)
@@ -963,18 +1359,194 @@ func performUpsert(tgtConn database.Connection, tableTmp, targetTable database.T
 	return nil
 }
 
-func executeSQL(t *TaskExecution, tgtConn database.Connection, sqlStatements *string, stage string) error {
-	if sqlStatements == nil || *sqlStatements == "" {
+// deleteUnchangedRows deletes the rows of the temp table whose hash is
+// the same in the target table, so that only the new or changed rows are merged
+func deleteUnchangedRows(tgtConn database.Connection, tableTmp, targetTable database.Table, pk []string, cfg *Config) error {
+	hashCol := cfg.Target.Options.columnName(cfg.rowHashColumn(), tgtConn.GetType())
+
+	conditions := []string{}
+	for _, col := range append(append([]string{}, pk...), hashCol) {
+		colQ := tgtConn.Quote(col, false)
+		conditions = append(conditions, g.F("tgt.%s = %s.%s", colQ, tableTmp.FullName(), colQ))
+	}
+
+	sql := g.F(
+		"delete from %s where exists (select 1 from %s tgt where %s)",
+		tableTmp.FullName(), targetTable.FullName(), strings.Join(conditions, " and "),
+	)
+	result, err := tgtConn.Exec(sql)
+	if err != nil {
+		return g.Error(err, "could not delete unchanged rows from temp table")
+	}
+
+	if cnt, _ := result.RowsAffected(); cnt > 0 {
+		g.Debug("skipped %d unchanged rows (same row hash)", cnt)
+	}
+	return nil
+}
+
+func executeSQL(t *TaskExecution, tgtConn database.Connection, statements *SQLStatements, stage string) (err error) {
+	if statements == nil || len(*statements) == 0 {
 		return nil
 	}
 
-	// apply values
-	sql := g.Rm(*sqlStatements, t.GetStateMap())
+	// apply runtime values
+	stateMap := t.GetStateMap()
+
+	// a list of statements is executed in a transaction (unless already in
+	// one, or errors are tolerated), so that all or none are applied
+	inTx := len(*statements) > 1 && tgtConn.Tx() == nil && !statements.tolerant()
+	if inTx {
+		txOptions := determineTxOptions(tgtConn.GetType())
+		if err = tgtConn.BeginContext(t.Context.Ctx, &txOptions); err != nil {
+			return g.Error(err, "could not open transaction for %s-sql", stage)
+		}
+		defer tgtConn.Rollback() // rollback in case of error
+	}
 
 	t.SetProgress(fmt.Sprintf("executing %s-sql", stage))
-	if _, err := tgtConn.ExecMulti(sql); err != nil {
-		err = g.Error(err, "Error executing %s-sql", stage)
-		return err
+	for i, statement := range *statements {
+		sql := g.Rm(statement.SQL, stateMap)
+		if _, err = tgtConn.ExecMulti(sql); err != nil {
+			if strings.EqualFold(statement.OnError, "warn") {
+				g.Warn("error executing %s-sql statement #%d: %s", stage, i+1, err.Error())
+				continue
+			}
+			return g.Error(err, "Error executing %s-sql", stage)
+		}
+	}
+
+	if inTx {
+		if err = tgtConn.Commit(); err != nil {
+			return g.Error(err, "could not commit %s-sql", stage)
+		}
+	}
+	return nil
+}
+
+// pruneSnapshots deletes the snapshots of the target table which are not
+// retained (`snapshot_retention`), in snapshot mode. The retained snapshots
+// are the most recent ones, so the oldest retained value is the cutoff.
+func pruneSnapshots(t *TaskExecution, cfg *Config, tgtConn database.Connection, targetTable database.Table) (err error) {
+	retention := cfg.Target.Options.SnapshotRetention
+	if retention == nil || cfg.Mode != SnapshotMode {
+		return nil
+	}
+
+	columns, err := tgtConn.GetColumns(targetTable.FullName())
+	if err != nil {
+		return g.Error(err, "could not get columns of %s", targetTable.FullName())
+	}
+	snapshotCol := columns.GetColumn(slingSnapshotAtColumn)
+	if snapshotCol == nil {
+		return g.Error("did not find column %s in %s", slingSnapshotAtColumn, targetTable.FullName())
+	}
+	snapshotColQ := tgtConn.Quote(snapshotCol.Name, false)
+
+	sql := g.F("select distinct %s as snapshot_at from %s order by 1 desc", snapshotColQ, targetTable.FullName())
+	data, err := tgtConn.Query(sql)
+	if err != nil {
+		return g.Error(err, "could not list snapshots of %s", targetTable.FullName())
 	}
+
+	// the snapshots are sorted from the newest, the current one is always kept
+	minTime := time.Now().AddDate(0, 0, -retention.Days)
+	kept := 1
+	for i := 1; i < len(data.Rows); i++ {
+		if retention.Runs > 0 && i >= retention.Runs {
+			break
+		} else if retention.Days > 0 && cast.ToTime(data.Rows[i][0]).Before(minTime) {
+			break
+		}
+		kept++
+	}
+	if kept >= len(data.Rows) {
+		return nil // nothing to prune
+	}
+
+	cutoff := iop.FormatValue(data.Rows[kept-1][0], data.Columns[0].Type, tgtConn.GetType())
+	sql = g.F("delete from %s where %s < %s", targetTable.FullName(), snapshotColQ, cutoff)
+	if _, err = tgtConn.Exec(sql); err != nil {
+		return g.Error(err, "could not delete snapshots of %s", targetTable.FullName())
+	}
+
+	t.SetProgress("pruned %d snapshots from %s", len(data.Rows)-kept, targetTable.FullName())
 	return nil
 }
+
+// optimizeTable runs the post-load optimization statements of the target
+// database on the final table (e.g. vacuum analyze, optimize final), when
+// `post_load_optimize` is enabled. Since the data is already committed,
+// failures are only warned about.
+func optimizeTable(t *TaskExecution, cfg *Config, tgtConn database.Connection, targetTable database.Table) {
+	if !g.PtrVal(cfg.Target.Options.PostLoadOptimize) {
+		return
+	}
+
+	template := tgtConn.GetTemplateValue("core.optimize_table")
+	if template == "" {
+		g.Warn("post_load_optimize is not supported for %s", tgtConn.GetType())
+		return
+	} else if tgtConn.GetType() == dbio.TypeDbSnowflake && len(cfg.Target.Options.TableKeys[iop.ClusterKey]) == 0 {
+		return // only clustered tables are reclustered
+	}
+
+	sql := g.R(
+		template,
+		"table", targetTable.FullName(),
+		"schema", targetTable.Schema,
+		"name", targetTable.Name,
+	)
+
+	t.SetProgress("optimizing table %s", targetTable.FullName())
+	if _, err := tgtConn.ExecMulti(sql); err != nil {
+		g.Warn("could not optimize table %s: %s", targetTable.FullName(), err.Error())
+	}
+}
+
+// setThrottle limits the rows and bytes per second of the dataflow, with
+// the lowest of the source and target limits (`rows_per_second`,
+// `bytes_per_second`), to spare production databases and metered APIs
+func setThrottle(cfg *Config, df *iop.Dataflow) {
+	limit := func(values ...*int64) (lowest int64) {
+		for _, val := range values {
+			if val != nil && *val > 0 && (lowest == 0 || *val < lowest) {
+				lowest = *val
+			}
+		}
+		return lowest
+	}
+
+	var rows, bytes int64
+	if so := cfg.Source.Options; so != nil {
+		rows, bytes = limit(so.RowsPerSecond), limit(so.BytesPerSecond)
+	}
+	if to := cfg.Target.Options; to != nil {
+		rows, bytes = limit(&rows, to.RowsPerSecond), limit(&bytes, to.BytesPerSecond)
+	}
+
+	if rows > 0 || bytes > 0 {
+		g.Debug("throttling stream to %d rows/s and %d bytes/s (0 = no limit)", rows, bytes)
+		df.SetThrottle(rows, bytes)
+	}
+}
+
+// removePartialFiles deletes the files partially written to the target
+// when the task is cancelled (the target path was overwritten already)
+func removePartialFiles(uri string, props []string) {
+	if cast.ToBool(os.Getenv("SLING_KEEP_TEMP")) || len(iop.ExtractPartitionFields(uri)) > 0 {
+		return
+	}
+
+	// the task context is cancelled
+	fs, err := filesys.NewFileSysClientFromURLContext(context.Background(), uri, props...)
+	if err != nil {
+		g.Warn("could not remove partially written files at %s: %s", uri, err.Error())
+		return
+	}
+
+	g.Debug("removing partially written files at %s", uri)
+	if err = filesys.Delete(fs, uri); err != nil {
+		g.Warn("could not remove partially written files at %s: %s", uri, err.Error())
+	}
+}
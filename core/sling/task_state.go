@@ -83,15 +83,17 @@ func (dts *DateTimeState) Update() {
 }
 
 type ExecutionState struct {
-	ID         string     `json:"id,omitempty"`
-	FilePath   string     `json:"string,omitempty"`
-	TotalBytes uint64     `json:"total_bytes,omitempty"`
-	TotalRows  uint64     `json:"total_rows,omitempty"`
-	Status     StatusMap  `json:"status,omitempty"`
-	StartTime  *time.Time `json:"start_time,omitempty"`
-	EndTime    *time.Time `json:"end_time,omitempty"`
-	Duration   int64      `json:"duration,omitempty"`
-	Error      *string    `json:"error,omitempty"`
+	ID            string     `json:"id,omitempty"`
+	FilePath      string     `json:"string,omitempty"`
+	TotalBytes    uint64     `json:"total_bytes,omitempty"`
+	TotalRows     uint64     `json:"total_rows,omitempty"`
+	TotalRejected uint64     `json:"total_rejected,omitempty"`
+	Cost          CostState  `json:"cost,omitempty"`
+	Status        StatusMap  `json:"status,omitempty"`
+	StartTime     *time.Time `json:"start_time,omitempty"`
+	EndTime       *time.Time `json:"end_time,omitempty"`
+	Duration      int64      `json:"duration,omitempty"`
+	Error         *string    `json:"error,omitempty"`
 }
 
 type StatusMap struct {
@@ -105,18 +107,21 @@ type StatusMap struct {
 }
 
 type RunState struct {
-	ID         string                  `json:"id,omitempty"`
-	Stream     *StreamState            `json:"stream,omitempty"`
-	Object     *ObjectState            `json:"object,omitempty"`
-	TotalBytes uint64                  `json:"total_bytes,omitempty"`
-	TotalRows  uint64                  `json:"total_rows,omitempty"`
-	Status     ExecStatus              `json:"status,omitempty"`
-	StartTime  *time.Time              `json:"start_time,omitempty"`
-	EndTime    *time.Time              `json:"end_time,omitempty"`
-	Duration   int64                   `json:"duration,omitempty"`
-	Error      *string                 `json:"error,omitempty"`
-	Config     ReplicationStreamConfig `json:"config,omitempty"`
-	Task       *TaskExecution          `json:"-"`
+	ID           string                  `json:"id,omitempty"`
+	StreamRunID  string                  `json:"stream_run_id,omitempty"`
+	Stream       *StreamState            `json:"stream,omitempty"`
+	Object       *ObjectState            `json:"object,omitempty"`
+	TotalBytes   uint64                  `json:"total_bytes,omitempty"`
+	TotalRows    uint64                  `json:"total_rows,omitempty"`
+	RejectedRows uint64                  `json:"rejected_rows,omitempty"`
+	Cost         CostState               `json:"cost,omitempty"`
+	Status       ExecStatus              `json:"status,omitempty"`
+	StartTime    *time.Time              `json:"start_time,omitempty"`
+	EndTime      *time.Time              `json:"end_time,omitempty"`
+	Duration     int64                   `json:"duration,omitempty"`
+	Error        *string                 `json:"error,omitempty"`
+	Config       ReplicationStreamConfig `json:"config,omitempty"`
+	Task         *TaskExecution          `json:"-"`
 }
 
 type ConnState struct {
@@ -165,12 +170,15 @@ func StateSet(t *TaskExecution) {
 		}
 
 		state.Execution.FilePath = t.Config.Env["SLING_CONFIG_PATH"]
+		if state.Execution.ID == "" {
+			state.Execution.ID = t.ExecID
+		}
 
 		fMap, _ := t.Config.GetFormatMap()
 
 		runID := iop.CleanName(t.Replication.Normalize(t.Config.StreamName))
-		if id := cast.ToString(fMap["stream_run_id"]); id != "" {
-			runID = id
+		if t.Config.ReplicationStream != nil && t.Config.ReplicationStream.ID != "" {
+			runID = t.Config.ReplicationStream.ID
 		}
 
 		run := state.Runs[runID]
@@ -182,6 +190,7 @@ func StateSet(t *TaskExecution) {
 			}
 		}
 
+		run.StreamRunID = cast.ToString(fMap["stream_run_id"])
 		run.Stream.FileFolder = cast.ToString(fMap["stream_file_folder"])
 		run.Stream.FileName = cast.ToString(fMap["stream_file_name"])
 		run.Stream.FileExt = cast.ToString(fMap["stream_file_ext"])
@@ -208,6 +217,8 @@ func StateSet(t *TaskExecution) {
 		bytes, _ := t.GetBytes()
 		run.TotalBytes = bytes
 		run.TotalRows = t.GetCount()
+		run.RejectedRows = t.GetRejectCount()
+		run.Cost = t.Cost()
 		run.Status = t.Status
 		run.StartTime = t.StartTime
 		run.EndTime = t.EndTime
@@ -231,15 +242,19 @@ func StateSet(t *TaskExecution) {
 		state.Execution.Status = StatusMap{}
 		state.Execution.TotalBytes = 0
 		state.Execution.TotalRows = 0
+		state.Execution.TotalRejected = 0
+		state.Execution.Cost = CostState{}
 
 		for _, run := range state.Runs {
 			state.Execution.TotalBytes = state.Execution.TotalBytes + run.TotalBytes
 			state.Execution.TotalRows = state.Execution.TotalRows + run.TotalRows
+			state.Execution.TotalRejected = state.Execution.TotalRejected + run.RejectedRows
+			state.Execution.Cost.Add(run.Cost)
 
 			switch run.Status {
 			case ExecStatusSuccess:
 				state.Execution.Status.Success++
-			case ExecStatusError:
+			case ExecStatusError, ExecStatusInterrupted:
 				state.Execution.Status.Error++
 			case ExecStatusWarning:
 				state.Execution.Status.Warning++
@@ -0,0 +1,321 @@
+package sling
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+)
+
+// RenderTemplate replaces the placeholders of the text (such as the target
+// object or the custom SQL) with the variables, and evaluates the runtime
+// expressions:
+//
+//	{stream_table}               a variable
+//	{run_date-1d}                date math on the run date (units: s, m, h, d, w, M, y)
+//	{run_date-1d:YYYY/MM/DD}     with a format (YYYY, MM, DD, HH, mm, ss)
+//	{run_timestamp+2h:HH}        the run timestamp, with a format
+//	{upper(stream_table)}        string functions: upper, lower, trim, replace,
+//	                             substr, concat, coalesce
+//	{replace(stream_table, "_", "-")}
+//
+// Unknown placeholders are left as is, to be rendered at runtime
+// (e.g. `{incremental_where_cond}`).
+func RenderTemplate(text string, vars map[string]any) (string, error) {
+	text = g.Rm(text, vars)
+	if !strings.Contains(text, "{") {
+		return text, nil
+	}
+
+	var err error
+	text = templateExprRegex.ReplaceAllStringFunc(text, func(match string) string {
+		if err != nil {
+			return match
+		}
+
+		val, ok, evalErr := evalTemplateExpr(strings.TrimSpace(match[1:len(match)-1]), vars)
+		if evalErr != nil {
+			err = g.Error(evalErr, "could not render %s", match)
+			return match
+		} else if !ok {
+			return match
+		}
+		return val
+	})
+
+	return text, err
+}
+
+var (
+	templateExprRegex = regexp.MustCompile(`\{([^{}]+)\}`)
+	templateDateRegex = regexp.MustCompile(`^(run_date|run_timestamp)((?:\s*[+-]\s*\d+\s*[smhdwMy])*)\s*(?::\s*(.+))?$`)
+	templateFuncRegex = regexp.MustCompile(`^([a-z_]+)\s*\((.*)\)$`)
+	templateVarRegex  = regexp.MustCompile(`^[A-Za-z_][\w\.]*$`)
+	templateIntRegex  = regexp.MustCompile(`^-?\d+$`)
+	templateUnitRegex = regexp.MustCompile(`([+-])\s*(\d+)\s*([smhdwMy])`)
+)
+
+// templateFuncs are the string functions of the templates
+var templateFuncs = map[string]func(args []string) (string, error){
+	"upper": func(args []string) (string, error) {
+		if len(args) != 1 {
+			return "", g.Error("upper expects 1 argument")
+		}
+		return strings.ToUpper(args[0]), nil
+	},
+	"lower": func(args []string) (string, error) {
+		if len(args) != 1 {
+			return "", g.Error("lower expects 1 argument")
+		}
+		return strings.ToLower(args[0]), nil
+	},
+	"trim": func(args []string) (string, error) {
+		if len(args) == 1 {
+			return strings.TrimSpace(args[0]), nil
+		} else if len(args) == 2 {
+			return strings.Trim(args[0], args[1]), nil
+		}
+		return "", g.Error("trim expects 1 or 2 arguments")
+	},
+	"replace": func(args []string) (string, error) {
+		if len(args) != 3 {
+			return "", g.Error("replace expects 3 arguments")
+		}
+		return strings.ReplaceAll(args[0], args[1], args[2]), nil
+	},
+	"substr": func(args []string) (string, error) {
+		if len(args) != 2 && len(args) != 3 {
+			return "", g.Error("substr expects 2 or 3 arguments")
+		}
+		runes := []rune(args[0])
+		start, err := cast.ToIntE(args[1])
+		if err != nil {
+			return "", g.Error("invalid substr start: %s", args[1])
+		}
+		start = max(0, min(start, len(runes)))
+		end := len(runes)
+		if len(args) == 3 {
+			length, err := cast.ToIntE(args[2])
+			if err != nil {
+				return "", g.Error("invalid substr length: %s", args[2])
+			}
+			end = max(start, min(start+length, len(runes)))
+		}
+		return string(runes[start:end]), nil
+	},
+	"concat": func(args []string) (string, error) {
+		return strings.Join(args, ""), nil
+	},
+	"coalesce": func(args []string) (string, error) {
+		for _, arg := range args {
+			if arg != "" {
+				return arg, nil
+			}
+		}
+		return "", nil
+	},
+}
+
+// evalTemplateExpr evaluates the expression, ok is false if the expression
+// is not a date or a function call (left as is)
+func evalTemplateExpr(expr string, vars map[string]any) (val string, ok bool, err error) {
+	if matches := templateDateRegex.FindStringSubmatch(expr); matches != nil {
+		val, err = evalTemplateDate(matches[1], matches[2], matches[3], vars)
+		return val, err == nil, err
+	}
+
+	matches := templateFuncRegex.FindStringSubmatch(expr)
+	if matches == nil {
+		return "", false, nil
+	}
+
+	function, found := templateFuncs[matches[1]]
+	if !found {
+		return "", false, nil
+	}
+
+	argExprs, err := splitTemplateArgs(matches[2])
+	if err != nil {
+		return "", false, g.Error(err, "invalid arguments of %s", matches[1])
+	}
+
+	args := make([]string, len(argExprs))
+	for i, argExpr := range argExprs {
+		if args[i], err = evalTemplateArg(argExpr, vars); err != nil {
+			return "", false, err
+		}
+	}
+
+	val, err = function(args)
+	return val, err == nil, err
+}
+
+// evalTemplateArg evaluates an argument of a function: a quoted string, an
+// integer, a variable or an expression
+func evalTemplateArg(arg string, vars map[string]any) (string, error) {
+	switch {
+	case len(arg) >= 2 && (arg[0] == '"' || arg[0] == '\'') && arg[len(arg)-1] == arg[0]:
+		return arg[1 : len(arg)-1], nil
+	case templateIntRegex.MatchString(arg):
+		return arg, nil
+	case templateDateRegex.MatchString(arg), templateFuncRegex.MatchString(arg):
+		val, ok, err := evalTemplateExpr(arg, vars)
+		if err != nil {
+			return "", err
+		} else if !ok {
+			return "", g.Error("unknown function: %s", arg)
+		}
+		return val, nil
+	case templateVarRegex.MatchString(arg):
+		val, found := lookupTemplateVar(vars, arg)
+		if !found {
+			return "", g.Error("unknown variable: %s", arg)
+		}
+		return cast.ToString(val), nil
+	}
+	return "", g.Error("invalid argument: %s", arg)
+}
+
+// lookupTemplateVar returns the value of the variable, such as
+// `stream_table` or `stream.table` (nested maps)
+func lookupTemplateVar(vars map[string]any, key string) (val any, found bool) {
+	if val, found = vars[key]; found {
+		return val, true
+	}
+
+	parts := strings.Split(key, ".")
+	current := any(vars)
+	for _, part := range parts {
+		m, err := cast.ToStringMapE(current)
+		if err != nil {
+			return nil, false
+		} else if current, found = m[part]; !found {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// splitTemplateArgs splits the arguments on the top level commas
+func splitTemplateArgs(text string) (args []string, err error) {
+	if strings.TrimSpace(text) == "" {
+		return args, nil
+	}
+
+	var (
+		quote rune
+		depth int
+		arg   strings.Builder
+	)
+	for _, r := range text {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(arg.String()))
+			arg.Reset()
+			continue
+		}
+		arg.WriteRune(r)
+	}
+
+	if quote != 0 {
+		return nil, g.Error("unterminated quote")
+	} else if depth != 0 {
+		return nil, g.Error("unbalanced parentheses")
+	}
+	return append(args, strings.TrimSpace(arg.String())), nil
+}
+
+// evalTemplateDate returns the run date or timestamp, shifted by the
+// offsets (e.g. `-1d+2h`), in the format (ISO 8601 tokens)
+func evalTemplateDate(name, offsets, format string, vars map[string]any) (string, error) {
+	t := time.Now()
+	if ts := cast.ToString(vars["run_timestamp"]); ts != "" {
+		if parsed, err := time.ParseInLocation("2006_01_02_150405", ts, time.Local); err == nil {
+			t = parsed
+		}
+	}
+
+	for _, match := range templateUnitRegex.FindAllStringSubmatch(offsets, -1) {
+		n := cast.ToInt(match[2])
+		if match[1] == "-" {
+			n = -n
+		}
+		switch match[3] {
+		case "s":
+			t = t.Add(time.Duration(n) * time.Second)
+		case "m":
+			t = t.Add(time.Duration(n) * time.Minute)
+		case "h":
+			t = t.Add(time.Duration(n) * time.Hour)
+		case "d":
+			t = t.AddDate(0, 0, n)
+		case "w":
+			t = t.AddDate(0, 0, 7*n)
+		case "M":
+			t = t.AddDate(0, n, 0)
+		case "y":
+			t = t.AddDate(n, 0, 0)
+		}
+	}
+
+	if format = strings.TrimSpace(format); format != "" {
+		return t.Format(iop.Iso8601ToGoLayout(format)), nil
+	} else if name == "run_date" {
+		return t.Format(time.DateOnly), nil
+	}
+	return t.Format("2006_01_02_150405"), nil
+}
+
+// renderTemplateVars renders the user-defined variables (`vars`) into the
+// map. Variables can refer to each other, but cannot replace the built-in
+// variables (already in the map).
+func renderTemplateVars(m map[string]any, vars map[string]any) (err error) {
+	keys := make([]string, 0, len(vars))
+	for k, v := range vars {
+		if _, found := m[k]; found {
+			g.Warn("variable %s is built-in, ignoring the value of vars", k)
+			continue
+		}
+		keys = append(keys, k)
+		m[k] = v
+	}
+	sort.Strings(keys)
+
+	// several passes, for variables referring to other variables
+	for pass := 0; pass <= len(keys); pass++ {
+		changed := false
+		for _, k := range keys {
+			val, ok := m[k].(string)
+			if !ok {
+				continue
+			}
+
+			rendered, err := RenderTemplate(val, m)
+			if err != nil {
+				return g.Error(err, "could not render variable %s", k)
+			} else if rendered != val {
+				m[k] = rendered
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+	}
+
+	return g.Error("could not render vars, circular reference in: %s", strings.Join(keys, ", "))
+}
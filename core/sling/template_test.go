@@ -0,0 +1,83 @@
+package sling
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	vars := map[string]any{
+		"run_timestamp": "2024_03_01_101500",
+		"run_date":      "2024-03-01",
+		"stream_table":  "My_Users",
+		"stream":        map[string]any{"schema": "public"},
+		"YYYY":          "2024",
+	}
+
+	cases := []struct {
+		text     string
+		expected string
+	}{
+		{"{stream_table}", "My_Users"},
+		{"{YYYY}/{run_date}", "2024/2024-03-01"},
+		{"{run_date-1d}", "2024-02-29"},
+		{"{run_date - 1M}", "2024-02-01"},
+		{"{run_date+1y-2d:YYYYMMDD}", "20250227"},
+		{"{run_date-1d:YYYY}/{run_date-1d:MM}", "2024/02"},
+		{"{run_timestamp-30m:HH:mm}", "09:45"},
+		{"{run_timestamp}", "2024_03_01_101500"},
+		{"{upper(stream_table)}", "MY_USERS"},
+		{"{lower(stream.schema)}_{lower(stream_table)}", "public_my_users"},
+		{`{replace(stream_table, "_", "-")}`, "My-Users"},
+		{"{substr(stream_table, 0, 2)}", "My"},
+		{"{substr(stream_table, 3)}", "Users"},
+		{"{concat(lower(stream_table), '_', run_date-1d:YYYYMMDD)}", "my_users_20240229"},
+		{"{coalesce('', stream_table)}", "My_Users"},
+		{"{trim('  a ')}", "a"},
+
+		// left as is, rendered at runtime
+		{"select * from t where {incremental_where_cond}", "select * from t where {incremental_where_cond}"},
+		{"{unknown_func(stream_table)}", "{unknown_func(stream_table)}"},
+		{`select '{"a": 1}'`, `select '{"a": 1}'`},
+	}
+
+	for _, c := range cases {
+		actual, err := RenderTemplate(c.text, vars)
+		if assert.NoError(t, err, c.text) {
+			assert.Equal(t, c.expected, actual, c.text)
+		}
+	}
+
+	for _, text := range []string{"{upper(missing_var)}", "{upper(a, b)}", "{replace(stream_table, 'a')}", "{upper('a)}"} {
+		_, err := RenderTemplate(text, vars)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestRenderTemplateVars(t *testing.T) {
+	m := map[string]any{"run_timestamp": "2024_03_01_101500", "stream_table": "users"}
+	vars := map[string]any{
+		"prefix":       "{upper(env_name)}_",
+		"day":          "{run_date-1d:YYYYMMDD}",
+		"name":         "{prefix}{stream_table}_{day}",
+		"env_name":     "dev",
+		"stream_table": "ignored", // built-in
+	}
+
+	assert.NoError(t, renderTemplateVars(m, vars))
+	assert.Equal(t, "DEV_", m["prefix"])
+	assert.Equal(t, "20240229", m["day"])
+	assert.Equal(t, "DEV_users_20240229", m["name"])
+	assert.Equal(t, "users", m["stream_table"])
+
+	err := renderTemplateVars(map[string]any{}, map[string]any{"a": "{b}x", "b": "{a}y"})
+	assert.Error(t, err)
+
+	// vars are available in the format map
+	cfg := &Config{Vars: map[string]any{"folder": "{lower(source_name)}/{run_date:YYYY}"}, Source: Source{Conn: "MY_PG"}}
+	fm, err := cfg.GetFormatMap()
+	if assert.NoError(t, err) {
+		assert.Regexp(t, `^my_pg/\d{4}$`, fm["folder"])
+	}
+}
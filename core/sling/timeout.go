@@ -0,0 +1,137 @@
+package sling
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/spf13/cast"
+)
+
+// parseTimeout parses a timeout, a duration (e.g. `45m`, `1h30m`)
+// or a number of seconds. Empty is no timeout.
+func parseTimeout(value string) (timeout time.Duration, err error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	if secs, err := cast.ToFloat64E(value); err == nil {
+		timeout = time.Duration(secs * float64(time.Second))
+	} else if timeout, err = time.ParseDuration(value); err != nil {
+		return 0, g.Error("invalid timeout (%s). Expected a duration such as 30m or 1h30m", value)
+	}
+
+	if timeout <= 0 {
+		return 0, g.Error("invalid timeout (%s). Must be positive", value)
+	}
+	return timeout, nil
+}
+
+// ParseDeadline parses a wall clock deadline: a timestamp (e.g.
+// `2024-06-01T06:00:00Z`), a time of day (e.g. `06:00`, at its next
+// occurrence after now) or a duration from now (e.g. `2h`)
+func ParseDeadline(value string, now time.Time) (deadline time.Time, err error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if clock, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			deadline = time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, now.Location())
+			if !deadline.After(now) {
+				deadline = deadline.AddDate(0, 0, 1)
+			}
+			return deadline, nil
+		}
+	}
+
+	if timeout, err := parseTimeout(value); err == nil {
+		return now.Add(timeout), nil
+	}
+
+	if deadline, err = cast.ToTimeInDefaultLocationE(value, now.Location()); err != nil {
+		return deadline, g.Error("invalid deadline (%s). Expected a timestamp, a time of day (e.g. 06:00) or a duration (e.g. 2h)", value)
+	}
+	return deadline, nil
+}
+
+// runDeadline returns the wall clock deadline of the run started at start,
+// from the SLING_DEADLINE env var. It is resolved at the start of each run
+// (every poll when watching), so that a relative value counts from there.
+func runDeadline(start time.Time) (time.Time, error) {
+	deadline, err := ParseDeadline(os.Getenv("SLING_DEADLINE"), start)
+	if err != nil {
+		return deadline, g.Error(err, "invalid SLING_DEADLINE")
+	}
+	return deadline, nil
+}
+
+// timeoutBudget returns the earliest deadline of the stream timeout, the
+// replication timeout and the run deadline, with the error to cancel with.
+// The deadline is zero if there is no budget.
+func (t *TaskExecution) timeoutBudget(start time.Time) (deadline time.Time, cause error, err error) {
+	apply := func(d time.Time, c error) {
+		if !d.IsZero() && (deadline.IsZero() || d.Before(deadline)) {
+			deadline, cause = d, c
+		}
+	}
+
+	if rs := t.Config.ReplicationStream; rs != nil {
+		timeout, err := parseTimeout(rs.Timeout)
+		if err != nil {
+			return deadline, nil, g.Error(err, "invalid stream timeout")
+		} else if timeout > 0 {
+			apply(start.Add(timeout), g.Error("stream %s timed out after %s", t.Config.StreamName, timeout))
+		}
+	}
+
+	if r := t.Replication; r != nil && !r.deadline.IsZero() {
+		apply(r.deadline, g.Error("replication timed out after %s", r.Timeout))
+	}
+
+	// resolved with the replication, or at the start of a single task
+	runEnd, err := runDeadline(start)
+	if r := t.Replication; r != nil {
+		runEnd, err = r.runDeadline, nil
+	}
+	if err != nil {
+		return deadline, nil, err
+	}
+	apply(runEnd, g.Error("run deadline reached (%s)", runEnd.Format(time.RFC3339)))
+
+	return deadline, cause, nil
+}
+
+// applyTimeout cancels the task context at the deadline of its timeout
+// budget, with a clear error. The returned function releases the timer.
+func (t *TaskExecution) applyTimeout(start time.Time) (cancel func(), err error) {
+	cancel = func() {}
+
+	deadline, cause, err := t.timeoutBudget(start)
+	if err != nil || deadline.IsZero() {
+		return cancel, err
+	} else if !deadline.After(start) {
+		return cancel, g.Error(cause, "not started")
+	}
+
+	ctx, cancel := context.WithDeadlineCause(t.Context.Ctx, deadline, cause)
+	taskCtx := g.NewContext(ctx)
+	taskCtx.Map = t.Context.Map // keep the values of the parent context
+	t.Context = taskCtx
+	t.timeoutErr = cause
+
+	return cancel, nil
+}
+
+// timedOut returns the timeout error if the task was canceled by its
+// timeout budget, nil otherwise
+func (t *TaskExecution) timedOut() error {
+	if t.timeoutErr != nil && context.Cause(t.Context.Ctx) == t.timeoutErr {
+		return t.timeoutErr
+	}
+	return nil
+}
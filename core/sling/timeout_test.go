@@ -0,0 +1,139 @@
+package sling
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slingdata-io/sling-cli/core/dbio/connection"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeout(t *testing.T) {
+	timeout, err := parseTimeout("1h30m")
+	assert.NoError(t, err)
+	assert.Equal(t, 90*time.Minute, timeout)
+
+	timeout, err = parseTimeout("90")
+	assert.NoError(t, err)
+	assert.Equal(t, 90*time.Second, timeout)
+
+	timeout, err = parseTimeout("")
+	assert.NoError(t, err)
+	assert.Zero(t, timeout)
+
+	_, err = parseTimeout("soon")
+	assert.Error(t, err)
+	_, err = parseTimeout("-5m")
+	assert.Error(t, err)
+
+	now := time.Date(2024, 6, 1, 22, 0, 0, 0, time.UTC)
+	deadline, err := ParseDeadline("06:00", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 2, 6, 0, 0, 0, time.UTC), deadline) // next occurrence
+
+	deadline, err = ParseDeadline("23:30", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 1, 23, 30, 0, 0, time.UTC), deadline)
+
+	deadline, err = ParseDeadline("2h", now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(2*time.Hour), deadline)
+
+	deadline, err = ParseDeadline("2024-06-02T05:00:00Z", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 2, 5, 0, 0, 0, time.UTC), deadline)
+
+	_, err = ParseDeadline("whenever", now)
+	assert.Error(t, err)
+}
+
+func TestTimeout(t *testing.T) {
+	folder := t.TempDir()
+	t.Setenv("TIMEOUT_SQLITE", "sqlite://"+filepath.Join(folder, "timeout.db"))
+	connection.GetLocalConns(true) // refresh the cached connections
+
+	replicationYaml := `
+source: TIMEOUT_SQLITE
+target: TIMEOUT_SQLITE
+timeout: 1h
+defaults:
+  mode: full-refresh
+  object: main.{stream_name}
+  timeout: 200ms
+streams:
+  slow:
+    sql: with recursive c(x) as (select 1 union all select x + 1 from c limit 1000000000) select count(*) as cnt from c
+  fast:
+    sql: select 1 as id
+    timeout: 1m
+`
+	replication, err := LoadReplicationConfig(replicationYaml)
+	if !assert.NoError(t, err) || !assert.NoError(t, replication.Compile(nil)) {
+		return
+	}
+	assert.Equal(t, "1h", replication.Timeout)
+
+	tasks := map[string]*Config{}
+	for _, cfg := range replication.Tasks {
+		tasks[cfg.StreamName] = cfg
+	}
+	assert.Equal(t, "200ms", tasks["slow"].ReplicationStream.Timeout)
+	assert.Equal(t, "1m", tasks["fast"].ReplicationStream.Timeout)
+
+	// the stream is canceled at its timeout
+	task := NewTask("", tasks["slow"])
+	task.Replication = &replication
+	start := time.Now()
+	err = task.Execute()
+	assert.ErrorContains(t, err, "stream slow timed out after 200ms")
+	assert.Equal(t, ExecStatusError, task.Status)
+	assert.Less(t, time.Since(start), 30*time.Second)
+
+	task = NewTask("", tasks["fast"])
+	task.Replication = &replication
+	assert.NoError(t, task.Execute())
+
+	// the streams do not start once the replication budget is spent
+	replication.deadline = time.Now().Add(-time.Second)
+	task = NewTask("", tasks["fast"])
+	task.Replication = &replication
+	assert.ErrorContains(t, task.Execute(), "replication timed out after 1h")
+
+	// invalid timeout values are reported
+	replication, err = LoadReplicationConfig(strings.Replace(replicationYaml, "timeout: 1m", "timeout: 1 minute", 1))
+	if assert.NoError(t, err) {
+		assert.ErrorContains(t, replication.Compile(nil), "invalid timeout for stream: fast")
+	}
+	issues := ValidateReplication(strings.Replace(replicationYaml, "timeout: 1h", "timeout: later", 1))
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, "timeout", issues[0].Path)
+	}
+
+	// the run deadline is resolved at every run (every poll when watching)
+	t.Setenv("SLING_DEADLINE", "1h")
+	compile := func() time.Time {
+		replication, err := LoadReplicationConfig(replicationYaml)
+		if !assert.NoError(t, err) || !assert.NoError(t, replication.Compile(nil)) {
+			return time.Time{}
+		}
+		return replication.runDeadline
+	}
+	first := compile()
+	assert.WithinDuration(t, time.Now().Add(time.Hour), first, time.Minute)
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, compile().After(first))
+
+	// or at the start of a single task
+	start = time.Now().Add(time.Minute)
+	deadline, cause, err := (&TaskExecution{Config: &Config{}}).timeoutBudget(start)
+	assert.NoError(t, err)
+	assert.Equal(t, start.Add(time.Hour), deadline)
+	assert.ErrorContains(t, cause, "run deadline reached")
+
+	t.Setenv("SLING_DEADLINE", "whenever")
+	if replication, err = LoadReplicationConfig(replicationYaml); assert.NoError(t, err) {
+		assert.ErrorContains(t, replication.Compile(nil), "invalid deadline")
+	}
+}
@@ -0,0 +1,184 @@
+package sling
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/shopspring/decimal"
+	"github.com/slingdata-io/sling-cli/core/dbio/database"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+)
+
+// An update key is either a column (`updated_at`), a composite of columns
+// (`updated_at, created_at`) whose watermark is the greatest of the values,
+// or an SQL expression (`coalesce(updated_at, created_at)`).
+
+// updateKeyColumns returns the columns of the update key,
+// or nil if the update key is an expression
+func updateKeyColumns(updateKey string) (columns []string) {
+	if strings.Contains(updateKey, "(") {
+		return nil // expression
+	}
+	for _, column := range strings.Split(updateKey, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// isSimpleUpdateKey returns true if the update key is a single column
+func isSimpleUpdateKey(updateKey string) bool {
+	return len(updateKeyColumns(updateKey)) == 1
+}
+
+// updateKeyExpr compiles the update key into the watermark SQL expression
+// of the connection dialect. The key columns are matched against the
+// provided columns, for the correct casing.
+func updateKeyExpr(conn database.Connection, updateKey string, columns iop.Columns) string {
+	names := updateKeyColumns(updateKey)
+	if len(names) == 0 {
+		return updateKey // expression, as is
+	}
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		if col := columns.GetColumn(name); col != nil && col.Name != "" {
+			name = col.Name // overwrite with correct casing
+		}
+		quoted[i] = conn.Quote(name, false)
+	}
+
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+
+	// the greatest of the values, with nulls falling back on the other columns
+	values := make([]string, len(quoted))
+	valuesRows := make([]string, len(quoted))
+	for i, field := range quoted {
+		fields := append([]string{field}, lo.Without(quoted, field)...)
+		values[i] = g.F("coalesce(%s)", strings.Join(fields, ", "))
+		valuesRows[i] = g.F("(%s)", field)
+	}
+
+	return g.R(
+		conn.GetTemplateValue("function.greatest"),
+		"values", strings.Join(values, ", "),
+		"values_rows", strings.Join(valuesRows, ", "),
+	)
+}
+
+// parseLookback parses the lookback window: a duration (e.g. `30m`, `2h`,
+// `3d`, `1w`) for time watermarks, or a number for numeric watermarks
+func parseLookback(value string) (duration time.Duration, number decimal.Decimal, err error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, number, g.Error("lookback value is empty")
+	} else if number, err = decimal.NewFromString(value); err == nil {
+		return 0, number, nil
+	}
+
+	days := map[string]int64{"d": 1, "w": 7}
+	if factor, ok := days[value[len(value)-1:]]; ok {
+		if count, err := decimal.NewFromString(value[:len(value)-1]); err == nil {
+			day := decimal.NewFromInt(factor * int64(24*time.Hour))
+			return time.Duration(count.Mul(day).IntPart()), decimal.Zero, nil
+		}
+	} else if duration, err = time.ParseDuration(value); err == nil {
+		return duration, decimal.Zero, nil
+	}
+
+	return 0, decimal.Zero, g.Error("invalid lookback value (%s). Expected a duration (e.g. 30m, 2h, 3d) or a number", value)
+}
+
+// applyLookback moves the incremental value back by the lookback window
+// (`source_options.lookback`), to re-capture late-arriving updates
+func applyLookback(cfg *Config) (err error) {
+	lookback := g.PtrVal(g.PtrVal(cfg.Source.Options).Lookback)
+	if lookback == "" || cfg.IncrementalVal == nil {
+		return nil
+	}
+
+	duration, number, err := parseLookback(lookback)
+	if err != nil {
+		return err
+	}
+
+	moveBack := func(t time.Time) (time.Time, error) {
+		if duration == 0 {
+			return t, g.Error("lookback (%s) must be a duration for a time update_key", lookback)
+		}
+		return t.Add(-duration), nil
+	}
+
+	numberErr := g.Error("lookback (%s) must be a number for a numeric update_key", lookback)
+
+	switch val := cfg.IncrementalVal.(type) {
+	case time.Time:
+		cfg.IncrementalVal, err = moveBack(val)
+	case int, int8, int16, int32, int64, uint8, uint16, uint32:
+		if number.IsZero() {
+			return numberErr
+		} else if number.IsInteger() {
+			cfg.IncrementalVal = cast.ToInt64(val) - number.IntPart()
+		} else {
+			cfg.IncrementalVal = decimal.NewFromInt(cast.ToInt64(val)).Sub(number)
+		}
+	case decimal.Decimal:
+		if number.IsZero() {
+			return numberErr
+		}
+		cfg.IncrementalVal = val.Sub(number)
+	default:
+		str := cast.ToString(val)
+		if num, numErr := decimal.NewFromString(str); numErr == nil {
+			if number.IsZero() {
+				return numberErr
+			}
+			cfg.IncrementalVal = num.Sub(number)
+		} else if layout := timeLayout(str); layout != "" {
+			// time stored as text, kept in the same layout
+			t, _ := time.Parse(layout, str)
+			t, err = moveBack(t)
+			cfg.IncrementalVal = t.Format(layout)
+		} else {
+			return g.Error("lookback is not supported for the update_key value: %s", str)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	g.Debug("incremental value moved back by lookback of %s", lookback)
+	return nil
+}
+
+// timeFractionRegex matches the fractional seconds of a time text
+var timeFractionRegex = regexp.MustCompile(`:\d{2}\.(\d+)`)
+
+// timeLayout returns the layout of the time text (with its fractional
+// seconds and offset), or blank if not recognized
+func timeLayout(str string) string {
+	fraction := ""
+	if match := timeFractionRegex.FindStringSubmatch(str); match != nil {
+		fraction = "." + strings.Repeat("0", len(match[1]))
+	}
+
+	for _, base := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		for _, offset := range []string{"", "Z07:00", "-07:00", "-0700", " -07:00", " -0700"} {
+			layout := base + fraction + offset
+			if base == time.DateOnly {
+				layout = base
+			}
+			if t, err := time.Parse(layout, str); err == nil && t.Format(layout) == str {
+				return layout
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,471 @@
+package sling
+
+import (
+	"encoding"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/flarco/g"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationIssue is a problem found in a replication config, with the
+// position of the offending node in the file
+type ValidationIssue struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Path    string `json:"path,omitempty"` // e.g. streams.public.users.mode
+	Message string `json:"message"`
+}
+
+func (vi ValidationIssue) String() string {
+	pos := g.F("%d:%d", vi.Line, vi.Column)
+	if vi.File != "" {
+		pos = vi.File + ":" + pos
+	}
+	if vi.Path != "" {
+		return g.F("%s: %s: %s", pos, vi.Path, vi.Message)
+	}
+	return g.F("%s: %s", pos, vi.Message)
+}
+
+// ValidateReplicationFile validates the replication config file.
+// The error is only returned if the file cannot be read.
+func ValidateReplicationFile(path string) (issues []ValidationIssue, err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, g.Error(err, "could not read replication config: %s", path)
+	}
+
+	issues = ValidateReplication(string(content))
+	for i := range issues {
+		issues[i].File = path
+	}
+	return issues, nil
+}
+
+// ValidateReplication checks the replication config (YAML or JSON) against
+// the config spec, without connecting: unknown keys, invalid modes, bad
+// hook shapes, streams without target object and conflicting options.
+// The issues are sorted by position.
+func ValidateReplication(content string) (issues []ValidationIssue) {
+	v := &validator{}
+	v.validate(content)
+
+	sort.SliceStable(v.issues, func(i, j int) bool {
+		if v.issues[i].Line != v.issues[j].Line {
+			return v.issues[i].Line < v.issues[j].Line
+		}
+		return v.issues[i].Column < v.issues[j].Column
+	})
+	return v.issues
+}
+
+var yamlErrLineRegex = regexp.MustCompile(`line (\d+)`)
+
+type validator struct {
+	issues []ValidationIssue
+}
+
+func (v *validator) add(node *yaml.Node, path, format string, args ...any) {
+	issue := ValidationIssue{Path: path, Message: g.F(format, args...)}
+	if node != nil {
+		issue.Line, issue.Column = node.Line, node.Column
+	}
+	v.issues = append(v.issues, issue)
+}
+
+func (v *validator) validate(content string) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		issue := ValidationIssue{Line: 1, Column: 1, Message: strings.TrimPrefix(err.Error(), "yaml: ")}
+		if matches := yamlErrLineRegex.FindStringSubmatch(err.Error()); len(matches) == 2 {
+			issue.Line = cast.ToInt(matches[1])
+		}
+		v.issues = append(v.issues, issue)
+		return
+	}
+
+	if len(doc.Content) == 0 {
+		v.add(&doc, "", "replication config is empty")
+		return
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		v.add(root, "", "replication config must be a mapping")
+		return
+	}
+
+	v.checkKeys(root, "", reflect.TypeOf(ReplicationConfig{}))
+
+	for _, key := range []string{"source", "target", "streams"} {
+		if _, val := mappingGet(root, key); val == nil {
+			v.add(root, "", "missing required key '%s'", key)
+		} else if key != "streams" && (val.Kind != yaml.ScalarNode || val.Value == "") {
+			v.add(val, key, "must be a connection name")
+		}
+	}
+
+	if _, hooks := mappingGet(root, "hooks"); hooks != nil {
+		v.checkHooks(hooks, "hooks", HookStageStart, HookStageEnd)
+	}
+
+	v.checkTimeout(root, "")
+
+	if _, runOrder := mappingGet(root, "run_order"); runOrder != nil && runOrder.Kind == yaml.ScalarNode && !hasVariable(runOrder.Value) {
+		if err := RunOrder(runOrder.Value).Validate(); err != nil {
+			v.add(runOrder, "run_order", "invalid run_order '%s', expected one of: priority, as_listed, smallest_first, largest_first", runOrder.Value)
+		}
+	}
+
+	if _, onFailure := mappingGet(root, "on_failure"); onFailure != nil && onFailure.Kind == yaml.ScalarNode && !hasVariable(onFailure.Value) {
+		if err := FailurePolicy(onFailure.Value).Validate(); err != nil {
+			v.add(onFailure, "on_failure", "invalid on_failure '%s', expected one of: continue, fail_fast, fail_after_all", onFailure.Value)
+		}
+	}
+
+	_, defaults := mappingGet(root, "defaults")
+	if defaults != nil {
+		if defaults.Kind != yaml.MappingNode {
+			v.add(defaults, "defaults", "must be a mapping")
+			defaults = nil
+		} else {
+			v.checkStream(defaults, "defaults")
+		}
+	}
+
+	if _, groups := mappingGet(root, "groups"); groups != nil && groups.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(groups.Content); i += 2 {
+			keyNode, group := groups.Content[i], groups.Content[i+1]
+			if group.Kind == yaml.MappingNode {
+				v.checkStream(group, "groups."+keyNode.Value)
+			} else if group.Kind != yaml.ScalarNode || group.Tag != "!!null" {
+				v.add(group, "groups."+keyNode.Value, "must be a mapping of stream defaults")
+			}
+		}
+	}
+
+	_, streams := mappingGet(root, "streams")
+	if streams == nil {
+		return
+	} else if streams.Kind != yaml.MappingNode {
+		v.add(streams, "streams", "must be a mapping of stream names")
+		return
+	} else if len(streams.Content) == 0 {
+		v.add(streams, "streams", "no streams defined")
+		return
+	}
+
+	for i := 0; i+1 < len(streams.Content); i += 2 {
+		keyNode, stream := streams.Content[i], streams.Content[i+1]
+		path := "streams." + keyNode.Value
+
+		if stream.Kind == yaml.ScalarNode && stream.Tag == "!!null" {
+			stream = nil // inherits the defaults
+		} else if stream.Kind != yaml.MappingNode {
+			v.add(stream, path, "must be a mapping (or empty, to use the defaults)")
+			continue
+		} else {
+			v.checkStream(stream, path)
+		}
+
+		v.checkStreamOptions(keyNode, stream, defaults, path)
+	}
+}
+
+// checkStream checks the keys and values of a stream (or the defaults)
+func (v *validator) checkStream(stream *yaml.Node, path string) {
+	v.checkKeys(stream, path, reflect.TypeOf(ReplicationStreamConfig{}))
+
+	if _, mode := mappingGet(stream, "mode"); mode != nil && mode.Kind == yaml.ScalarNode && !hasVariable(mode.Value) {
+		valid := modeValues()
+		if !g.In(mode.Value, valid...) {
+			v.add(mode, path+".mode", "invalid mode '%s', expected one of: %s", mode.Value, strings.Join(valid, ", "))
+		}
+	}
+
+	if _, hooks := mappingGet(stream, "hooks"); hooks != nil {
+		v.checkHooks(hooks, path+".hooks", HookStagePre, HookStagePost)
+	}
+
+	v.checkTimeout(stream, path)
+
+	if _, expect := mappingGet(stream, "expect"); expect != nil && expect.Kind == yaml.MappingNode {
+		v.checkExpect(expect, path+".expect")
+	}
+}
+
+// checkExpect checks the values of the stream expectations
+func (v *validator) checkExpect(expect *yaml.Node, path string) {
+	if _, action := mappingGet(expect, "on_violation"); action != nil && action.Kind == yaml.ScalarNode && !hasVariable(action.Value) {
+		if !g.In(ExpectationAction(strings.ToLower(action.Value)), ExpectationActionWarn, ExpectationActionFail) {
+			v.add(action, path+".on_violation", "invalid on_violation '%s', expected one of: warn, fail", action.Value)
+		}
+	}
+
+	if _, maxDuration := mappingGet(expect, "max_duration"); maxDuration != nil && maxDuration.Kind == yaml.ScalarNode && !hasVariable(maxDuration.Value) {
+		if _, err := parseTimeout(maxDuration.Value); err != nil {
+			v.add(maxDuration, path+".max_duration", "invalid max_duration '%s', expected a duration such as 30m or 1h30m", maxDuration.Value)
+		}
+	}
+}
+
+// checkTimeout checks the timeout value of the replication or a stream
+func (v *validator) checkTimeout(node *yaml.Node, path string) {
+	_, timeout := mappingGet(node, "timeout")
+	if timeout == nil || timeout.Kind != yaml.ScalarNode || hasVariable(timeout.Value) {
+		return
+	}
+	if _, err := parseTimeout(timeout.Value); err != nil {
+		v.add(timeout, strings.TrimPrefix(path+".timeout", "."), "invalid timeout '%s', expected a duration such as 30m or 1h30m", timeout.Value)
+	}
+}
+
+// checkStreamOptions checks the options of the stream merged with the
+// defaults, for missing or conflicting values
+func (v *validator) checkStreamOptions(keyNode, stream, defaults *yaml.Node, path string) {
+	get := func(keys ...string) (node *yaml.Node) {
+		for _, parent := range []*yaml.Node{stream, defaults} {
+			node = parent
+			for _, key := range keys {
+				if node == nil || node.Kind != yaml.MappingNode {
+					node = nil
+					break
+				}
+				_, node = mappingGet(node, key)
+			}
+			if node != nil && !(node.Kind == yaml.ScalarNode && node.Tag == "!!null") {
+				return node
+			}
+		}
+		return nil
+	}
+
+	if get("disabled") != nil && cast.ToBool(get("disabled").Value) {
+		return
+	}
+
+	if object := get("object"); object == nil || object.Value == "" {
+		v.add(keyNode, path, "missing target 'object' (in stream or defaults)")
+	}
+
+	mode, modeNode := Mode(""), get("mode")
+	if modeNode != nil {
+		mode = Mode(modeNode.Value)
+	}
+	primaryKey, updateKey := get("primary_key"), get("update_key")
+
+	switch mode {
+	case IncrementalMode:
+		discovery := get("source_options", "key_discovery")
+		autoKeys := discovery != nil && strings.EqualFold(discovery.Value, string(KeyDiscoveryAuto))
+		if primaryKey == nil && updateKey == nil && !autoKeys {
+			v.add(modeNode, path, "must specify 'update_key' and/or 'primary_key' for incremental mode")
+		}
+	case BackfillMode:
+		if primaryKey == nil || updateKey == nil {
+			v.add(modeNode, path, "must specify 'update_key' and 'primary_key' for backfill mode")
+		}
+		if rng := get("source_options", "range"); rng == nil {
+			v.add(modeNode, path, "must specify 'source_options.range' for backfill mode")
+		} else if !hasVariable(rng.Value) && len(strings.Split(rng.Value, ",")) != 2 {
+			v.add(rng, path+".source_options.range", "must be a range separated by one comma, e.g. `2021-01-01,2021-02-01`")
+		}
+	}
+
+	if discovery := get("source_options", "key_discovery"); discovery != nil && discovery.Kind == yaml.ScalarNode && !hasVariable(discovery.Value) {
+		if !g.In(KeyDiscovery(strings.ToLower(discovery.Value)), KeyDiscoveryPropose, KeyDiscoveryAuto, KeyDiscoveryOff) {
+			v.add(discovery, path+".source_options.key_discovery", "invalid key_discovery '%s', expected one of: propose, auto, off", discovery.Value)
+		}
+	}
+
+	if id, ts := get("source_options", "snapshot_id"), get("source_options", "snapshot_timestamp"); id != nil && ts != nil {
+		v.add(ts, path+".source_options", "specify snapshot_id or snapshot_timestamp, not both")
+	}
+
+	if chunks, ranges := get("source_options", "partition_by", "chunks"), get("source_options", "partition_by", "ranges"); chunks != nil && ranges != nil {
+		v.add(ranges, path+".source_options.partition_by", "specify either chunks or ranges, not both")
+	}
+
+	if cols, ignoreCols := get("target_options", "update_columns"), get("target_options", "ignore_update_columns"); cols != nil && ignoreCols != nil {
+		v.add(ignoreCols, path+".target_options", "specify update_columns or ignore_update_columns, not both")
+	}
+
+	for _, key := range []string{"source_options", "target_options"} {
+		if enc, encKey := get(key, "encryption"), get(key, "encryption_key"); encKey != nil && enc == nil {
+			v.add(encKey, path+"."+key+".encryption_key", "'encryption' must be specified with 'encryption_key'")
+		}
+	}
+}
+
+// checkHooks checks that the hooks are lists of mappings with a type,
+// for the allowed stages
+func (v *validator) checkHooks(hooks *yaml.Node, path string, stages ...HookStage) {
+	stageNames := strings.Join(lo.Map(stages, func(s HookStage, i int) string { return string(s) }), ", ")
+	if hooks.Kind != yaml.MappingNode {
+		v.add(hooks, path, "must be a mapping of stages (%s)", stageNames)
+		return
+	}
+
+	for i := 0; i+1 < len(hooks.Content); i += 2 {
+		keyNode, list := hooks.Content[i], hooks.Content[i+1]
+		stagePath := path + "." + keyNode.Value
+
+		if !g.In(HookStage(keyNode.Value), stages...) {
+			v.add(keyNode, stagePath, "invalid hook stage '%s', expected one of: %s", keyNode.Value, stageNames)
+			continue
+		}
+
+		if list.Kind == yaml.ScalarNode && list.Tag == "!!null" {
+			continue
+		} else if list.Kind != yaml.SequenceNode {
+			v.add(list, stagePath, "must be a list of hooks")
+			continue
+		}
+
+		for j, hook := range list.Content {
+			hookPath := g.F("%s[%d]", stagePath, j)
+			if hook.Kind != yaml.MappingNode {
+				v.add(hook, hookPath, "hook must be a mapping with a 'type'")
+				continue
+			}
+			if _, hookType := mappingGet(hook, "type"); hookType == nil {
+				v.add(hook, hookPath, "hook is missing 'type'")
+			} else if hookType.Kind != yaml.ScalarNode || hookType.Value == "" {
+				v.add(hookType, hookPath+".type", "hook type must be a string")
+			}
+		}
+	}
+}
+
+// checkKeys checks the keys of the mapping against the yaml keys of the
+// struct type, and the shape of the values against the field types
+func (v *validator) checkKeys(node *yaml.Node, path string, t reflect.Type) {
+	fields := yamlFields(t)
+	seen := map[string]bool{}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valNode := node.Content[i], node.Content[i+1]
+		key := keyNode.Value
+		keyPath := strings.TrimPrefix(path+"."+key, ".")
+
+		if seen[key] {
+			v.add(keyNode, keyPath, "duplicate key '%s'", key)
+		}
+		seen[key] = true
+
+		fieldType, ok := fields[key]
+		if !ok {
+			v.add(keyNode, keyPath, "unknown key '%s'", key)
+			continue
+		}
+
+		v.checkValue(valNode, keyPath, fieldType)
+	}
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*interface{ UnmarshalJSON([]byte) error })(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// checkValue checks that the node kind matches the type
+func (v *validator) checkValue(node *yaml.Node, path string, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	isNull := node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+	if isNull || node.Kind == yaml.AliasNode || t.Kind() == reflect.Interface {
+		return
+	}
+
+	// types with custom parsing accept any shape
+	ptr := reflect.PointerTo(t)
+	if ptr.Implements(jsonUnmarshalerType) || ptr.Implements(textUnmarshalerType) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			v.add(node, path, "must be a mapping")
+			return
+		}
+		// hooks & defaults are checked separately
+		if !g.In(t, reflect.TypeOf(HookMap{}), reflect.TypeOf(ReplicationStreamConfig{})) {
+			v.checkKeys(node, path, t)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			v.add(node, path, "must be a mapping")
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			v.add(node, path, "must be a list")
+		}
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || (node.Tag != "!!bool" && !hasVariable(node.Value)) {
+			v.add(node, path, "must be true or false")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if node.Kind != yaml.ScalarNode || (node.Tag != "!!int" && !hasVariable(node.Value)) {
+			v.add(node, path, "must be an integer")
+		}
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			v.add(node, path, "must be a string")
+		}
+	}
+}
+
+// yamlFields returns the field types of the struct, by yaml key
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := yamlFieldName(t.Field(i)); ok {
+			fields[name] = t.Field(i).Type
+		}
+	}
+	return fields
+}
+
+// yamlFieldName returns the yaml key of the field, if parsed
+func yamlFieldName(field reflect.StructField) (name string, ok bool) {
+	name, _, _ = strings.Cut(field.Tag.Get("yaml"), ",")
+	return name, field.IsExported() && name != "" && name != "-"
+}
+
+// modeValues returns the valid modes
+func modeValues() (values []string) {
+	for _, m := range AllMode {
+		values = append(values, string(m.Value))
+	}
+	return values
+}
+
+// mappingGet returns the key and value nodes of the mapping
+func mappingGet(node *yaml.Node, key string) (keyNode, valNode *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// hasVariable returns true if the value is rendered at runtime
+// (env var or runtime variable), and cannot be validated statically
+func hasVariable(val string) bool {
+	return strings.Contains(val, "$") || strings.Contains(val, "{")
+}
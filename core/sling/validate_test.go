@@ -0,0 +1,133 @@
+package sling
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateReplication(t *testing.T) {
+	valid := `
+source: POSTGRES
+target: SNOWFLAKE
+env:
+  SCHEMA: public
+hooks:
+  start:
+    - type: log
+      message: starting
+defaults:
+  object: '{target_schema}.{stream_table}'
+  mode: incremental
+  primary_key: [id]
+  source_options:
+    flatten: true
+    limit: 10
+  target_options:
+    column_casing: snake
+streams:
+  public.users:
+  public.events:
+    update_key: updated_at
+    hooks:
+      post:
+        - type: query
+          query: select 1
+  public.logs:
+    mode: full-refresh
+    select: [id, name]
+    disabled: true
+`
+	issues := ValidateReplication(valid)
+	assert.Empty(t, issues)
+
+	// JSON is valid YAML
+	issues = ValidateReplication(`{"source": "PG", "target": "SF", "streams": {"public.users": {"object": "public.users"}}}`)
+	assert.Empty(t, issues)
+
+	invalid := `
+source: POSTGRES
+target: SNOWFLAKE
+hooks:
+  pre:
+    - type: log
+defaults:
+  object: public.{stream_table}
+  colums: [id]
+streams:
+  public.users:
+    mode: upsert
+  public.events:
+    mode: incremental
+    hooks:
+      post:
+        - query: select 1
+      end: []
+  public.orders:
+    mode: backfill
+    update_key: id
+    source_options:
+      flaten: true
+      limit: ten
+      snapshot_id: 1
+      snapshot_timestamp: '2024-01-01'
+  public.*:
+    target_options: true
+`
+	issues = ValidateReplication(invalid)
+	messages := []string{}
+	for _, issue := range issues {
+		messages = append(messages, issue.String())
+	}
+	expected := []string{
+		"5:3: hooks.pre: invalid hook stage 'pre', expected one of: start, end",
+		"9:3: defaults.colums: unknown key 'colums'",
+		"12:11: streams.public.users.mode: invalid mode 'upsert', expected one of: full-refresh, incremental, truncate, snapshot, backfill",
+		"14:11: streams.public.events: must specify 'update_key' and/or 'primary_key' for incremental mode",
+		"17:11: streams.public.events.hooks.post[0]: hook is missing 'type'",
+		"18:7: streams.public.events.hooks.end: invalid hook stage 'end', expected one of: pre, post",
+		"20:11: streams.public.orders: must specify 'update_key' and 'primary_key' for backfill mode",
+		"20:11: streams.public.orders: must specify 'source_options.range' for backfill mode",
+		"23:7: streams.public.orders.source_options.flaten: unknown key 'flaten'",
+		"24:14: streams.public.orders.source_options.limit: must be an integer",
+		"26:27: streams.public.orders.source_options: specify snapshot_id or snapshot_timestamp, not both",
+		"28:21: streams.public.*.target_options: must be a mapping",
+	}
+	assert.Equal(t, expected, messages)
+
+	// missing keys & object
+	issues = ValidateReplication("source: PG\nstreams:\n  public.users:\n")
+	if assert.Len(t, issues, 2) {
+		assert.Equal(t, "missing required key 'target'", issues[0].Message)
+		assert.Equal(t, "missing target 'object' (in stream or defaults)", issues[1].Message)
+		assert.Equal(t, 3, issues[1].Line)
+	}
+
+	// the keys are discovered with key_discovery: auto
+	issues = ValidateReplication(`
+source: PG
+target: SF
+defaults:
+  object: public.{stream_table}
+  mode: incremental
+  source_options:
+    key_discovery: auto
+streams:
+  public.users:
+  public.events:
+    source_options:
+      key_discovery: always
+`)
+	if assert.Len(t, issues, 2) {
+		assert.Equal(t, "streams.public.events", issues[0].Path)
+		assert.Equal(t, "must specify 'update_key' and/or 'primary_key' for incremental mode", issues[0].Message)
+		assert.Equal(t, "invalid key_discovery 'always', expected one of: propose, auto, off", issues[1].Message)
+	}
+
+	// syntax error
+	issues = ValidateReplication(strings.Join([]string{"source: PG", "target: SF", "streams:", "  a: [b"}, "\n"))
+	if assert.Len(t, issues, 1) {
+		assert.Contains(t, issues[0].Message, "did not find expected")
+	}
+}
@@ -0,0 +1,78 @@
+package sling
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/flarco/g"
+)
+
+// DefaultWatchInterval is the default poll interval in watch mode
+var DefaultWatchInterval = 30 * time.Second
+
+// WatchInterval returns the poll interval of watch mode, from the
+// SLING_WATCH_INTERVAL env var (e.g. `10s`, `5m`)
+func WatchInterval() (interval time.Duration, err error) {
+	val := os.Getenv("SLING_WATCH_INTERVAL")
+	if val == "" {
+		return DefaultWatchInterval, nil
+	}
+
+	interval, err = time.ParseDuration(val)
+	if err != nil {
+		return 0, g.Error(err, "invalid value for SLING_WATCH_INTERVAL: %s", val)
+	} else if interval < time.Second {
+		return 0, g.Error("SLING_WATCH_INTERVAL must be at least 1s, got %s", val)
+	}
+	return interval, nil
+}
+
+// ValidateWatch checks that the compiled tasks can run in watch mode.
+// Only file sources can be watched, and they must be loaded incrementally,
+// so that each poll only picks up the files which were not yet processed.
+// With `update_key: _sling_loaded_at`, files are selected by modified time
+// against the latest value loaded in the target. With the `file_watermark`
+// source option, the new files are appended, without keys.
+func (rd *ReplicationConfig) ValidateWatch() (err error) {
+	for _, task := range rd.Tasks {
+		if task.ReplicationStream != nil && task.ReplicationStream.Disabled {
+			continue
+		}
+
+		if !task.sourceIsFile() || task.Options.StdIn {
+			return g.Error("watch mode is only supported for file sources, stream `%s` is not a file", task.StreamName)
+		}
+
+		if task.Mode != IncrementalMode {
+			return g.Error("watch mode requires the incremental mode for stream `%s`. Use `update_key: %s` or the `file_watermark` source option to load new files.", task.StreamName, slingLoadedAtColumn)
+		}
+	}
+	return nil
+}
+
+// Watch calls runFunc every interval until the context is canceled.
+// The first run must succeed (to surface configuration errors), after which
+// a failed run does not stop the loop: the files are picked up at the next poll.
+func Watch(ctx context.Context, interval time.Duration, runFunc func(ctx context.Context) error) (err error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for runs := 0; ; runs++ {
+		if err = runFunc(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			} else if runs == 0 {
+				return err
+			}
+			g.LogError(err, "watch run failed, retrying in %s", interval)
+		}
+
+		g.Debug("watching for new files (next poll in %s)", interval)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package sling
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatch(t *testing.T) {
+	os.Setenv("SLING_WATCH_INTERVAL", "500ms")
+	_, err := WatchInterval()
+	assert.Error(t, err)
+
+	os.Setenv("SLING_WATCH_INTERVAL", "2m")
+	interval, err := WatchInterval()
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, interval)
+	os.Unsetenv("SLING_WATCH_INTERVAL")
+
+	// first run failure stops the loop
+	err = Watch(context.Background(), time.Millisecond, func(ctx context.Context) error {
+		return g.Error("bad config")
+	})
+	assert.Error(t, err)
+
+	// later failures are retried until canceled
+	runs := 0
+	ctx, cancel := context.WithCancel(context.Background())
+	err = Watch(ctx, time.Millisecond, func(ctx context.Context) error {
+		runs++
+		if runs == 4 {
+			cancel()
+		}
+		if runs > 1 {
+			return g.Error("transient")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, runs)
+}
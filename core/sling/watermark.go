@@ -0,0 +1,206 @@
+package sling
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/dbio/filesys"
+	"github.com/slingdata-io/sling-cli/core/dbio/iop"
+	"github.com/spf13/cast"
+)
+
+// FileWatermark is how the files newer than the stored watermark are selected
+type FileWatermark string
+
+const (
+	// FileWatermarkMtime selects the files by modified time
+	FileWatermarkMtime FileWatermark = "mtime"
+	// FileWatermarkName selects the files by the timestamp in their name,
+	// matched with the file_name_pattern
+	FileWatermarkName FileWatermark = "name"
+)
+
+// WatermarkGet returns the file watermark of a stream (unix seconds),
+// 0 if none. Set by the store, which persists it in the local sling database.
+var WatermarkGet = func(streamID string) (value int64, err error) {
+	return 0, g.Error("file watermark is not available")
+}
+
+// WatermarkSet records the file watermark of a stream
+var WatermarkSet = func(streamID string, value int64) (err error) {
+	return g.Error("file watermark is not available")
+}
+
+// WatermarkReset deletes the file watermark of a stream
+var WatermarkReset = func(streamID string) (err error) {
+	return g.Error("file watermark is not available")
+}
+
+// watermarkResets holds the stream ids of which the watermark was reset
+var watermarkResets sync.Map
+
+// validateFileWatermark checks the file watermark options
+func (cfg *Config) validateFileWatermark() (err error) {
+	so := g.PtrVal(cfg.Source.Options)
+	if so.FileWatermark == nil {
+		if so.FileNamePattern != nil || so.FileNameTimeFormat != nil {
+			return g.Error("invalid source option: file_name_pattern and file_name_time_format require file_watermark: name")
+		}
+		return nil
+	}
+
+	switch FileWatermark(strings.ToLower(*so.FileWatermark)) {
+	case FileWatermarkMtime:
+		if so.FileNamePattern != nil {
+			return g.Error("invalid source option: file_name_pattern requires file_watermark: name")
+		}
+	case FileWatermarkName:
+		if _, err = newFileNameTimeParser(g.PtrVal(so.FileNamePattern), g.PtrVal(so.FileNameTimeFormat)); err != nil {
+			return g.Error(err, "invalid source option")
+		}
+	default:
+		return g.Error("invalid source option file_watermark: %s (expected mtime or name)", *so.FileWatermark)
+	}
+
+	if !cfg.sourceIsFile() || cfg.Options.StdIn {
+		return g.Error("invalid source option: file_watermark is only supported with file sources")
+	}
+	return nil
+}
+
+// fileNameTimeParser extracts the timestamp from the name of a file
+type fileNameTimeParser struct {
+	pattern *regexp.Regexp
+	layout  string // go layout, auto-detected if empty
+}
+
+// newFileNameTimeParser compiles the pattern. The timestamp is the `ts` named
+// group, or the first group. The format uses the ISO 8601 tokens
+// (e.g. `YYYYMMDD_HHmmss`), the timestamp is auto-detected if empty.
+func newFileNameTimeParser(pattern, format string) (p *fileNameTimeParser, err error) {
+	if pattern == "" {
+		return nil, g.Error("file_name_pattern is required with file_watermark: name")
+	}
+
+	p = &fileNameTimeParser{}
+	if p.pattern, err = regexp.Compile(pattern); err != nil {
+		return nil, g.Error(err, "invalid file_name_pattern: %s", pattern)
+	} else if p.pattern.NumSubexp() == 0 {
+		return nil, g.Error("file_name_pattern must have a capture group for the timestamp: %s", pattern)
+	}
+
+	if format != "" {
+		p.layout = iop.Iso8601ToGoLayout(format)
+	}
+	return p, nil
+}
+
+// Parse returns the timestamp in the name of the file, false if not matched
+func (p *fileNameTimeParser) Parse(name string) (ts time.Time, ok bool) {
+	matches := p.pattern.FindStringSubmatch(name)
+	if matches == nil {
+		return ts, false
+	}
+
+	value := matches[1]
+	if i := p.pattern.SubexpIndex("ts"); i > 0 {
+		value = matches[i]
+	}
+
+	var err error
+	if p.layout != "" {
+		ts, err = time.Parse(p.layout, value)
+		return ts, err == nil
+	}
+
+	// compact timestamps are not handled by cast
+	for _, layout := range []string{"20060102150405", "20060102T150405", "20060102_150405", "200601021504", "20060102"} {
+		if len(value) == len(layout) {
+			if ts, err = time.Parse(layout, value); err == nil {
+				return ts, true
+			}
+		}
+	}
+
+	ts, err = cast.ToTimeE(value)
+	return ts, err == nil
+}
+
+// usesFileWatermark returns true if the files are selected by watermark
+func (t *TaskExecution) usesFileWatermark() bool {
+	return t.Config.sourceIsFile() && !t.Config.Options.StdIn &&
+		g.PtrVal(t.Config.Source.Options).FileWatermark != nil
+}
+
+// watermarkNewFiles keeps the files newer than the stored watermark,
+// and returns the new watermark, to record once loaded
+func (t *TaskExecution) watermarkNewFiles(nodes filesys.FileNodes) (newNodes filesys.FileNodes, watermark int64, err error) {
+	streamID := t.Config.StreamID()
+
+	// reset once per process, not at every poll in watch mode
+	if _, done := watermarkResets.LoadOrStore(streamID, true); !done && cast.ToBool(os.Getenv("SLING_WATERMARK_RESET")) {
+		if err = WatermarkReset(streamID); err != nil {
+			return nil, 0, g.Error(err, "could not reset file watermark")
+		}
+		g.Info("reset file watermark for stream %s", t.Config.StreamName)
+	}
+
+	if watermark, err = WatermarkGet(streamID); err != nil {
+		return nil, 0, g.Error(err, "could not get file watermark")
+	}
+	previous := watermark
+
+	so := t.Config.Source.Options
+	var parser *fileNameTimeParser
+	if FileWatermark(strings.ToLower(*so.FileWatermark)) == FileWatermarkName {
+		if parser, err = newFileNameTimeParser(g.PtrVal(so.FileNamePattern), g.PtrVal(so.FileNameTimeFormat)); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	unmatched := 0
+	for _, node := range nodes {
+		if node.IsDir {
+			continue
+		}
+
+		ts := node.Updated
+		if parser != nil {
+			parts := strings.Split(node.Path(), "/")
+			nameTs, ok := parser.Parse(parts[len(parts)-1])
+			if !ok {
+				unmatched++
+				continue
+			}
+			ts = nameTs.Unix()
+		}
+
+		if ts > previous {
+			newNodes = append(newNodes, node)
+			watermark = max(watermark, ts)
+		}
+	}
+
+	if unmatched > 0 {
+		g.Debug("skipped %d files not matching the file_name_pattern", unmatched)
+	}
+	g.Debug("selected %d files newer than the file watermark (%s)", len(newNodes), time.Unix(previous, 0).UTC().Format(time.RFC3339))
+
+	return newNodes, watermark, nil
+}
+
+// watermarkRecord records the new file watermark, once written successfully
+func (t *TaskExecution) watermarkRecord() (err error) {
+	if !t.usesFileWatermark() || t.fileWatermark == 0 {
+		return nil
+	}
+
+	if err = WatermarkSet(t.Config.StreamID(), t.fileWatermark); err != nil {
+		return g.Error(err, "could not record file watermark")
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package sling
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileNameTimeParser(t *testing.T) {
+	parser, err := newFileNameTimeParser(`^orders_(\d{8}_\d{6})\.csv$`, "")
+	if assert.NoError(t, err) {
+		ts, ok := parser.Parse("orders_20240105_103000.csv")
+		assert.True(t, ok)
+		assert.Equal(t, time.Date(2024, 1, 5, 10, 30, 0, 0, time.UTC), ts)
+
+		_, ok = parser.Parse("customers_20240105_103000.csv")
+		assert.False(t, ok)
+	}
+
+	// named group & explicit format
+	parser, err = newFileNameTimeParser(`^(\w+)-(?P<ts>\d{2}\.\d{2}\.\d{4})\.json$`, "DD.MM.YYYY")
+	if assert.NoError(t, err) {
+		ts, ok := parser.Parse("events-31.12.2023.json")
+		assert.True(t, ok)
+		assert.Equal(t, time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC), ts)
+	}
+
+	// iso timestamps are auto-detected
+	parser, err = newFileNameTimeParser(`_(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z)`, "")
+	if assert.NoError(t, err) {
+		ts, ok := parser.Parse("dump_2024-02-01T00:00:00Z.parquet")
+		assert.True(t, ok)
+		assert.Equal(t, int64(1706745600), ts.Unix())
+	}
+
+	_, err = newFileNameTimeParser(`orders_\d{8}\.csv`, "")
+	assert.ErrorContains(t, err, "capture group")
+	_, err = newFileNameTimeParser("", "")
+	assert.ErrorContains(t, err, "file_name_pattern is required")
+}
+
+func TestFileWatermark(t *testing.T) {
+	watermarks := map[string]int64{}
+	getFunc, setFunc := WatermarkGet, WatermarkSet
+	WatermarkGet = func(streamID string) (int64, error) { return watermarks[streamID], nil }
+	WatermarkSet = func(streamID string, value int64) error { watermarks[streamID] = value; return nil }
+	defer func() { WatermarkGet, WatermarkSet = getFunc, setFunc }()
+
+	folder := t.TempDir()
+	srcFolder := filepath.Join(folder, "landing")
+	os.MkdirAll(srcFolder, 0755)
+	writeFile := func(name, content string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(srcFolder, name), []byte(content), 0644))
+	}
+	writeFile("orders_20240101.csv", "id,name\n1,a\n")
+	writeFile("orders_20240102.csv", "id,name\n2,b\n")
+	writeFile("readme.csv", "id,name\n0,x\n") // not matching, never loaded
+
+	outPath := filepath.Join(folder, "out.csv")
+	run := func() (string, error) {
+		cfg := &Config{}
+		cfg.Source.Conn = "LOCAL"
+		cfg.Source.Stream = "file://" + srcFolder + "/"
+		cfg.Source.Options = &SourceOptions{
+			FileWatermark:   g.String("name"),
+			FileNamePattern: g.String(`^orders_(\d{8})\.csv$`),
+		}
+		cfg.Target.Conn = "LOCAL"
+		cfg.Target.Object = "file://" + outPath
+
+		os.Remove(outPath)
+		task := NewTask("", cfg)
+		if task.Err != nil {
+			return "", task.Err
+		} else if err := task.Execute(); err != nil {
+			return "", err
+		}
+		content, _ := os.ReadFile(outPath)
+		return string(content), nil
+	}
+
+	content, err := run()
+	if assert.NoError(t, err) {
+		assert.Contains(t, content, "1,a")
+		assert.Contains(t, content, "2,b")
+		assert.NotContains(t, content, "0,x")
+	}
+	assert.Len(t, watermarks, 1)
+	for _, value := range watermarks {
+		assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC).Unix(), value)
+	}
+
+	// only the new file is loaded
+	writeFile("orders_20240103.csv", "id,name\n3,c\n")
+	content, err = run()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "id,name\n3,c\n", content)
+	}
+
+	// no new files
+	content, err = run()
+	assert.NoError(t, err)
+	assert.Empty(t, content)
+
+	// validation
+	cfg := &Config{}
+	cfg.Source.Conn = "LOCAL"
+	cfg.Source.Stream = "file://" + srcFolder + "/"
+	cfg.Source.Options = &SourceOptions{FileWatermark: g.String("name")}
+	cfg.Target.Conn = "LOCAL"
+	cfg.Target.Object = "file://" + outPath
+	task := NewTask("", cfg)
+	assert.ErrorContains(t, task.Err, "file_name_pattern is required")
+}
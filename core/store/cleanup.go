@@ -0,0 +1,66 @@
+package store
+
+import (
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/sling"
+	"gorm.io/gorm/clause"
+)
+
+// TempTable is a temp table created in a target connection, until dropped.
+// PK = conn + name
+type TempTable struct {
+	Conn      string    `json:"conn" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+func init() {
+	sling.TempTableSet = TempTableSet
+	sling.TempTableDelete = TempTableDelete
+	sling.TempTableList = TempTableList
+}
+
+// TempTableSet records a created temp table
+func TempTableSet(table sling.TempTable) (err error) {
+	if Db == nil {
+		return g.Error("local .sling.db is not available")
+	}
+
+	entry := TempTable{Conn: table.Conn, Name: table.Name, CreatedAt: table.CreatedAt}
+	if err = Db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&entry).Error; err != nil {
+		return g.Error(err, "could not record temp table")
+	}
+	return nil
+}
+
+// TempTableDelete deletes the record of a dropped temp table
+func TempTableDelete(conn, name string) (err error) {
+	if Db == nil {
+		return g.Error("local .sling.db is not available")
+	}
+
+	err = Db.Where("conn = ? and name = ?", conn, name).Delete(&TempTable{}).Error
+	if err != nil {
+		return g.Error(err, "could not delete temp table record")
+	}
+	return nil
+}
+
+// TempTableList returns the recorded temp tables of a connection
+func TempTableList(conn string) (tables []sling.TempTable, err error) {
+	if Db == nil {
+		return nil, g.Error("local .sling.db is not available")
+	}
+
+	entries := []TempTable{}
+	if err = Db.Where("conn = ?", conn).Order("created_at").Find(&entries).Error; err != nil {
+		return nil, g.Error(err, "could not list temp tables")
+	}
+
+	for _, entry := range entries {
+		tables = append(tables, sling.TempTable{Conn: entry.Conn, Name: entry.Name, CreatedAt: entry.CreatedAt})
+	}
+	return tables, nil
+}
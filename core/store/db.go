@@ -48,6 +48,11 @@ func InitDB() {
 
 	allTables := []interface{}{
 		&Setting{},
+		&FileLedger{},
+		&StreamWatermark{},
+		&StreamConfig{},
+		&StreamRun{},
+		&TempTable{},
 	}
 
 	for _, table := range allTables {
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/sling"
+)
+
+// StreamRun is a stream run in the run history. PK = id
+type StreamRun struct {
+	// ID auto-increments
+	ID int64 `json:"id" gorm:"primaryKey"`
+
+	ExecID string `json:"exec_id" gorm:"index"`
+
+	// StreamID is an MD5 construct:`md5(Source, Target, Stream, Object)`.
+	StreamID string `json:"stream_id" gorm:"index"`
+
+	StreamName string           `json:"stream_name" gorm:"index"`
+	Config     string           `json:"config"`
+	SourceConn string           `json:"source_conn"`
+	TargetConn string           `json:"target_conn"`
+	Object     string           `json:"object"`
+	Mode       sling.Mode       `json:"mode"`
+	Status     sling.ExecStatus `json:"status" gorm:"index"`
+	StartTime  *time.Time       `json:"start_time" gorm:"index"`
+	EndTime    *time.Time       `json:"end_time"`
+	Duration   int64            `json:"duration"`
+	Rows       uint64           `json:"rows"`
+	Bytes      uint64           `json:"bytes"`
+	Watermark  string           `json:"watermark"`
+	Err        string           `json:"error"`
+}
+
+func init() {
+	sling.HistoryGet = HistoryGet
+	sling.HistorySet = HistorySet
+}
+
+// HistoryGet returns the stream runs of the filter, the latest first
+func HistoryGet(filter sling.HistoryFilter) (runs []sling.HistoryRun, err error) {
+	if Db == nil {
+		return nil, g.Error("local .sling.db is not available")
+	}
+
+	query := Db.Model(&StreamRun{}).Order("start_time desc, id desc")
+	if filter.Stream != "" {
+		query = query.Where("lower(stream_name) like ?", strings.ReplaceAll(strings.ToLower(filter.Stream), "*", "%"))
+	}
+	if filter.StreamID != "" {
+		query = query.Where("stream_id = ?", filter.StreamID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("start_time >= ?", filter.Since)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	entries := []StreamRun{}
+	if err = query.Find(&entries).Error; err != nil {
+		return nil, g.Error(err, "could not get run history")
+	}
+
+	runs = make([]sling.HistoryRun, len(entries))
+	for i, entry := range entries {
+		runs[i] = sling.HistoryRun{
+			ExecID:    entry.ExecID,
+			StreamID:  entry.StreamID,
+			Stream:    entry.StreamName,
+			Config:    entry.Config,
+			Source:    entry.SourceConn,
+			Target:    entry.TargetConn,
+			Object:    entry.Object,
+			Mode:      entry.Mode,
+			Status:    entry.Status,
+			StartTime: entry.StartTime,
+			EndTime:   entry.EndTime,
+			Duration:  entry.Duration,
+			Rows:      entry.Rows,
+			Bytes:     entry.Bytes,
+			Watermark: entry.Watermark,
+			Error:     entry.Err,
+		}
+	}
+	return runs, nil
+}
+
+// HistorySet records a stream run
+func HistorySet(run sling.HistoryRun) (err error) {
+	if Db == nil {
+		return g.Error("local .sling.db is not available")
+	}
+
+	entry := StreamRun{
+		ExecID:     run.ExecID,
+		StreamID:   run.StreamID,
+		StreamName: run.Stream,
+		Config:     run.Config,
+		SourceConn: run.Source,
+		TargetConn: run.Target,
+		Object:     run.Object,
+		Mode:       run.Mode,
+		Status:     run.Status,
+		StartTime:  run.StartTime,
+		EndTime:    run.EndTime,
+		Duration:   run.Duration,
+		Rows:       run.Rows,
+		Bytes:      run.Bytes,
+		Watermark:  run.Watermark,
+		Err:        run.Error,
+	}
+	if err = Db.Create(&entry).Error; err != nil {
+		return g.Error(err, "could not record run history")
+	}
+	return nil
+}
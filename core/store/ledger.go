@@ -0,0 +1,140 @@
+package store
+
+import (
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/sling"
+	"gorm.io/gorm/clause"
+)
+
+// FileLedger is a file loaded by a stream. PK = stream_id + uri
+type FileLedger struct {
+	// StreamID is an MD5 construct:`md5(Source, Target, Stream, Object)`.
+	StreamID string    `json:"stream_id" gorm:"primaryKey"`
+	URI      string    `json:"uri" gorm:"primaryKey"`
+	Size     uint64    `json:"size"`
+	Updated  int64     `json:"updated"`
+	Checksum string    `json:"checksum"`
+	LoadedAt time.Time `json:"loaded_at" gorm:"index"`
+}
+
+func init() {
+	sling.LedgerGet = LedgerGet
+	sling.LedgerSet = LedgerSet
+	sling.LedgerReset = LedgerReset
+	sling.WatermarkGet = WatermarkGet
+	sling.WatermarkSet = WatermarkSet
+	sling.WatermarkReset = WatermarkReset
+}
+
+// LedgerGet returns the files loaded by a stream, keyed by uri
+func LedgerGet(streamID string) (files map[string]sling.LedgerFile, err error) {
+	if Db == nil {
+		return nil, g.Error("local .sling.db is not available")
+	}
+
+	entries := []FileLedger{}
+	if err = Db.Where("stream_id = ?", streamID).Find(&entries).Error; err != nil {
+		return nil, g.Error(err, "could not get file ledger")
+	}
+
+	files = map[string]sling.LedgerFile{}
+	for _, entry := range entries {
+		files[entry.URI] = sling.LedgerFile{
+			URI:      entry.URI,
+			Size:     entry.Size,
+			Updated:  entry.Updated,
+			Checksum: entry.Checksum,
+			LoadedAt: entry.LoadedAt,
+		}
+	}
+	return files, nil
+}
+
+// LedgerSet upserts the files loaded by a stream
+func LedgerSet(streamID string, files []sling.LedgerFile) (err error) {
+	if Db == nil {
+		return g.Error("local .sling.db is not available")
+	}
+
+	entries := make([]FileLedger, len(files))
+	for i, file := range files {
+		entries[i] = FileLedger{
+			StreamID: streamID,
+			URI:      file.URI,
+			Size:     file.Size,
+			Updated:  file.Updated,
+			Checksum: file.Checksum,
+			LoadedAt: file.LoadedAt,
+		}
+	}
+
+	err = Db.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(entries, 500).Error
+	if err != nil {
+		return g.Error(err, "could not record file ledger")
+	}
+	return nil
+}
+
+// LedgerReset deletes the ledger of a stream
+func LedgerReset(streamID string) (err error) {
+	if Db == nil {
+		return g.Error("local .sling.db is not available")
+	}
+
+	err = Db.Where("stream_id = ?", streamID).Delete(&FileLedger{}).Error
+	if err != nil {
+		return g.Error(err, "could not reset file ledger")
+	}
+	return nil
+}
+
+// StreamWatermark is the file watermark of a stream. PK = stream_id
+type StreamWatermark struct {
+	StreamID  string    `json:"stream_id" gorm:"primaryKey"`
+	Value     int64     `json:"value"` // unix seconds
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WatermarkGet returns the file watermark of a stream, 0 if none
+func WatermarkGet(streamID string) (value int64, err error) {
+	if Db == nil {
+		return 0, g.Error("local .sling.db is not available")
+	}
+
+	entries := []StreamWatermark{}
+	if err = Db.Where("stream_id = ?", streamID).Find(&entries).Error; err != nil {
+		return 0, g.Error(err, "could not get file watermark")
+	} else if len(entries) == 0 {
+		return 0, nil
+	}
+	return entries[0].Value, nil
+}
+
+// WatermarkSet upserts the file watermark of a stream
+func WatermarkSet(streamID string, value int64) (err error) {
+	if Db == nil {
+		return g.Error("local .sling.db is not available")
+	}
+
+	entry := StreamWatermark{StreamID: streamID, Value: value, UpdatedAt: time.Now()}
+	err = Db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&entry).Error
+	if err != nil {
+		return g.Error(err, "could not record file watermark")
+	}
+	return nil
+}
+
+// WatermarkReset deletes the file watermark of a stream
+func WatermarkReset(streamID string) (err error) {
+	if Db == nil {
+		return g.Error("local .sling.db is not available")
+	}
+
+	err = Db.Where("stream_id = ?", streamID).Delete(&StreamWatermark{}).Error
+	if err != nil {
+		return g.Error(err, "could not reset file watermark")
+	}
+	return nil
+}
@@ -46,6 +46,9 @@ type Execution struct {
 	// Is an MD5 construct:`md5(Source, Target, Stream, Object)`.
 	StreamID string `json:"stream_id,omitempty" sql:"not null" gorm:"index"`
 
+	// StreamRunID is the id of the stream run (see SLING_STREAM_RUN_ID_FORMAT)
+	StreamRunID string `json:"stream_run_id,omitempty" gorm:"index"`
+
 	// ConfigMD5 points to config table. not null
 	TaskMD5        string `json:"task_md5,omitempty" sql:"not null" gorm:"index"`
 	ReplicationMD5 string `json:"replication_md5,omitempty" sql:"not null" gorm:"index"`
@@ -141,22 +144,24 @@ func (r Replication) Value() (driver.Value, error) {
 func ToExecutionObject(t *sling.TaskExecution) *Execution {
 
 	bytes, _ := t.GetBytes()
+	streamRunID, _ := t.Config.StreamRunID()
 
 	exec := Execution{
-		ExecID:    t.ExecID,
-		StreamID:  t.Config.StreamID(),
-		Status:    t.Status,
-		StartTime: t.StartTime,
-		EndTime:   t.EndTime,
-		Bytes:     bytes,
-		Output:    t.Output.String(),
-		Rows:      t.GetCount(),
-		ProjectID: g.String(t.Config.Env["SLING_PROJECT_ID"]),
-		FilePath:  g.String(t.Config.Env["SLING_CONFIG_PATH"]),
-		WorkPath:  g.String(t.Config.Env["SLING_WORK_PATH"]),
-		Pid:       os.Getpid(),
-		Version:   core.Version,
-		TaskExec:  t,
+		ExecID:      t.ExecID,
+		StreamID:    t.Config.StreamID(),
+		StreamRunID: streamRunID,
+		Status:      t.Status,
+		StartTime:   t.StartTime,
+		EndTime:     t.EndTime,
+		Bytes:       bytes,
+		Output:      t.Output.String(),
+		Rows:        t.GetCount(),
+		ProjectID:   g.String(t.Config.Env["SLING_PROJECT_ID"]),
+		FilePath:    g.String(t.Config.Env["SLING_CONFIG_PATH"]),
+		WorkPath:    g.String(t.Config.Env["SLING_WORK_PATH"]),
+		Pid:         os.Getpid(),
+		Version:     core.Version,
+		TaskExec:    t,
 	}
 
 	if t.Err != nil {
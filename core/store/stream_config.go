@@ -0,0 +1,55 @@
+package store
+
+import (
+	"time"
+
+	"github.com/flarco/g"
+	"github.com/slingdata-io/sling-cli/core/sling"
+	"gorm.io/gorm/clause"
+)
+
+// StreamConfig is the config snapshot of the last run of a stream. PK = stream_id
+type StreamConfig struct {
+	StreamID  string    `json:"stream_id" gorm:"primaryKey"`
+	Config    string    `json:"config"` // json of the flattened keys
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func init() {
+	sling.StreamConfigGet = StreamConfigGet
+	sling.StreamConfigSet = StreamConfigSet
+}
+
+// StreamConfigGet returns the config snapshot of the last run of a stream, nil if none
+func StreamConfigGet(streamID string) (config map[string]string, err error) {
+	if Db == nil {
+		return nil, g.Error("local .sling.db is not available")
+	}
+
+	entries := []StreamConfig{}
+	if err = Db.Where("stream_id = ?", streamID).Find(&entries).Error; err != nil {
+		return nil, g.Error(err, "could not get stream config")
+	} else if len(entries) == 0 {
+		return nil, nil
+	}
+
+	config = map[string]string{}
+	if err = g.Unmarshal(entries[0].Config, &config); err != nil {
+		return nil, g.Error(err, "could not parse stream config")
+	}
+	return config, nil
+}
+
+// StreamConfigSet upserts the config snapshot of a stream
+func StreamConfigSet(streamID string, config map[string]string) (err error) {
+	if Db == nil {
+		return g.Error("local .sling.db is not available")
+	}
+
+	entry := StreamConfig{StreamID: streamID, Config: g.Marshal(config), UpdatedAt: time.Now()}
+	err = Db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&entry).Error
+	if err != nil {
+		return g.Error(err, "could not record stream config")
+	}
+	return nil
+}